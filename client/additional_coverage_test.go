@@ -37,15 +37,14 @@ func TestRegister_WithAPIKeyHeader(t *testing.T) {
 		ServerKey:       expectedKey,
 	}
 
-	gpuCollector := NewGPUCollector(60)
+	gpuCollector := NewGPUCollector(60, 0)
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 60),
-		memorySamples:  make([]float64, 60),
-		diskSamples:    make([]float64, 60),
+		cpuSamples:     NewCoreSampleRing(60, 0),
+		memorySamples:  NewSampleRing(60, 0),
+		diskSamples:    NewSampleRing(60, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     60,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -86,15 +85,14 @@ func TestRegister_WithoutAPIKeyHeader(t *testing.T) {
 		ServerKey:       "", // No API key
 	}
 
-	gpuCollector := NewGPUCollector(60)
+	gpuCollector := NewGPUCollector(60, 0)
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 60),
-		memorySamples:  make([]float64, 60),
-		diskSamples:    make([]float64, 60),
+		cpuSamples:     NewCoreSampleRing(60, 0),
+		memorySamples:  NewSampleRing(60, 0),
+		diskSamples:    NewSampleRing(60, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     60,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -133,24 +131,22 @@ func TestReportStats_WithAPIKeyHeader(t *testing.T) {
 		ServerKey:       expectedKey,
 	}
 
-	gpuCollector := NewGPUCollector(60)
+	gpuCollector := NewGPUCollector(60, 0)
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 60),
-		memorySamples:  make([]float64, 60),
-		diskSamples:    make([]float64, 60),
+		cpuSamples:     NewCoreSampleRing(60, 0),
+		memorySamples:  NewSampleRing(60, 0),
+		diskSamples:    NewSampleRing(60, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     60,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
 
 	// Add sample data
-	collector.cpuSamples[0] = []float64{50.0}
-	collector.memorySamples[0] = 60.0
-	collector.diskSamples[0] = 70.0
-	collector.sampleIndex = 1
+	collector.cpuSamples.Add([]float64{50.0})
+	collector.memorySamples.Add(60.0)
+	collector.diskSamples.Add(70.0)
 
 	err := collector.reportStats()
 	if err != nil {
@@ -185,24 +181,22 @@ func TestReportStats_WithoutAPIKeyHeader(t *testing.T) {
 		ServerKey:       "", // No API key
 	}
 
-	gpuCollector := NewGPUCollector(60)
+	gpuCollector := NewGPUCollector(60, 0)
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 60),
-		memorySamples:  make([]float64, 60),
-		diskSamples:    make([]float64, 60),
+		cpuSamples:     NewCoreSampleRing(60, 0),
+		memorySamples:  NewSampleRing(60, 0),
+		diskSamples:    NewSampleRing(60, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     60,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
 
 	// Add sample data
-	collector.cpuSamples[0] = []float64{50.0}
-	collector.memorySamples[0] = 60.0
-	collector.diskSamples[0] = 70.0
-	collector.sampleIndex = 1
+	collector.cpuSamples.Add([]float64{50.0})
+	collector.memorySamples.Add(60.0)
+	collector.diskSamples.Add(70.0)
 
 	err := collector.reportStats()
 	if err != nil {
@@ -222,25 +216,22 @@ func TestCalculateAverages(t *testing.T) {
 			ReportInterval: 60,
 			DiskPath:       "/",
 		},
-		cpuSamples:    make([][]float64, 5),
-		memorySamples: make([]float64, 5),
-		diskSamples:   make([]float64, 5),
-		maxSamples:    5,
-		sampleIndex:   0,
-		gpuCollector:  NewGPUCollector(5),
+		cpuSamples:    NewCoreSampleRing(5, 0),
+		memorySamples: NewSampleRing(5, 0),
+		diskSamples:   NewSampleRing(5, 0),
+		gpuCollector:  NewGPUCollector(5, 0),
 	}
 
 	// Add some sample data
-	collector.cpuSamples[0] = []float64{10.0, 20.0}
-	collector.cpuSamples[1] = []float64{30.0, 40.0}
-	collector.cpuSamples[2] = []float64{50.0, 60.0}
-	collector.memorySamples[0] = 1.0
-	collector.memorySamples[1] = 2.0
-	collector.memorySamples[2] = 3.0
-	collector.diskSamples[0] = 10.0
-	collector.diskSamples[1] = 20.0
-	collector.diskSamples[2] = 30.0
-	collector.sampleIndex = 3
+	collector.cpuSamples.Add([]float64{10.0, 20.0})
+	collector.cpuSamples.Add([]float64{30.0, 40.0})
+	collector.cpuSamples.Add([]float64{50.0, 60.0})
+	collector.memorySamples.Add(1.0)
+	collector.memorySamples.Add(2.0)
+	collector.memorySamples.Add(3.0)
+	collector.diskSamples.Add(10.0)
+	collector.diskSamples.Add(20.0)
+	collector.diskSamples.Add(30.0)
 
 	// Calculate CPU averages
 	cpuAvg := collector.calculateCPUAverages()
@@ -249,13 +240,13 @@ func TestCalculateAverages(t *testing.T) {
 	}
 
 	// Calculate memory average
-	memAvg := collector.calculateAverage(collector.memorySamples)
+	memAvg := collector.memorySamples.Mean(time.Now())
 	if memAvg == 0 {
 		t.Error("Expected non-zero memory average")
 	}
 
 	// Calculate disk average
-	diskAvg := collector.calculateAverage(collector.diskSamples)
+	diskAvg := collector.diskSamples.Mean(time.Now())
 	if diskAvg == 0 {
 		t.Error("Expected non-zero disk average")
 	}
@@ -478,15 +469,14 @@ func TestRegister_WithGeoLocation(t *testing.T) {
 		GeoIPDBPath:     dbPath,
 	}
 
-	gpuCollector := NewGPUCollector(60)
+	gpuCollector := NewGPUCollector(60, 0)
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 10 * time.Second},
-		cpuSamples:     make([][]float64, 60),
-		memorySamples:  make([]float64, 60),
-		diskSamples:    make([]float64, 60),
+		cpuSamples:     NewCoreSampleRing(60, 0),
+		memorySamples:  NewSampleRing(60, 0),
+		diskSamples:    NewSampleRing(60, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     60,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -579,14 +569,13 @@ func TestCalculateCPUAverages_VariousSamples(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			collector := &MetricsCollector{
-				cpuSamples:  make([][]float64, len(tt.samples)),
-				maxSamples:  len(tt.samples),
-				sampleIndex: 0,
+				cpuSamples: NewCoreSampleRing(len(tt.samples), 0),
 			}
 
 			// Populate samples
-			copy(collector.cpuSamples, tt.samples)
-			collector.sampleIndex = len(tt.samples)
+			for _, sample := range tt.samples {
+				collector.cpuSamples.Add(sample)
+			}
 
 			// Calculate averages
 			avg := collector.calculateCPUAverages()
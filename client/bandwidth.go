@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// bandwidthRTTSamples is how many small requests are timed; the fastest is the round-trip time
+const bandwidthRTTSamples = 3
+
+// validateBandwidthTest checks the link test settings before the first registration
+func validateBandwidthTest(cfg common.BandwidthTestConfig) error {
+	if cfg.SizeMB <= 0 || cfg.TimeoutSecs <= 0 {
+		return fmt.Errorf("bandwidth_test.size_mb and bandwidth_test.timeout_seconds must be positive")
+	}
+	if cfg.SkipServer && cfg.ReferenceURL == "" {
+		return fmt.Errorf("bandwidth_test.skip_server requires bandwidth_test.reference_url")
+	}
+	if cfg.ReferenceURL != "" {
+		if parsed, err := url.Parse(cfg.ReferenceURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("bandwidth_test.reference_url must be an http(s) URL: %s", cfg.ReferenceURL)
+		}
+	}
+	return nil
+}
+
+// measureBandwidth runs the configured link tests. Failures are recorded in the measurement and never
+// block registration
+func (c *MetricsCollector) measureBandwidth() []common.BandwidthMeasurement {
+	cfg := c.config.BandwidthTest
+	if !cfg.Enabled {
+		return nil
+	}
+
+	size := int64(cfg.SizeMB) << 20
+	timeout := time.Duration(cfg.TimeoutSecs) * time.Second
+	var results []common.BandwidthMeasurement
+	if !cfg.SkipServer {
+		results = append(results, c.measureServerLink(size, timeout))
+	}
+	if cfg.ReferenceURL != "" {
+		results = append(results, c.measureReferenceLink(cfg.ReferenceURL, size, timeout))
+	}
+
+	for _, m := range results {
+		LogInfoWithData("Bandwidth test", map[string]interface{}{
+			"target":        m.Target,
+			"rtt_ms":        m.RTTMs,
+			"download_mbps": m.DownloadMbps,
+			"upload_mbps":   m.UploadMbps,
+			"error":         m.Error,
+		})
+	}
+	return results
+}
+
+// measureServerLink times round trips, a download and an upload against the load balancer's /bandwidth endpoint
+func (c *MetricsCollector) measureServerLink(size int64, timeout time.Duration) common.BandwidthMeasurement {
+	m := common.BandwidthMeasurement{Target: common.BandwidthTargetServer, MeasuredAt: time.Now()}
+
+	newRequest := func(method, path string, body []byte) (*http.Request, error) {
+		return c.newServerRequest(method, path, body)
+	}
+	rtt, err := timeRoundTrips(c.httpClient, "GET", newRequest, "/bandwidth", timeout)
+	if err != nil {
+		m.Error = err.Error()
+		return m
+	}
+	download, err := timeDownload(c.httpClient, newRequest, fmt.Sprintf("/bandwidth?bytes=%d", size), size, timeout)
+	if err != nil {
+		m.Error = err.Error()
+		return m
+	}
+
+	payload := make([]byte, size)
+	rand.Read(payload)
+	upload, err := timeUpload(c.httpClient, newRequest, "/bandwidth", payload, timeout)
+	if err != nil {
+		m.Error = err.Error()
+		return m
+	}
+
+	m.RTTMs, m.DownloadMbps, m.UploadMbps = rtt, download, upload
+	return m
+}
+
+// measureReferenceLink times round trips and a download of up to size bytes from a reference URL
+func (c *MetricsCollector) measureReferenceLink(referenceURL string, size int64, timeout time.Duration) common.BandwidthMeasurement {
+	m := common.BandwidthMeasurement{Target: referenceURL, MeasuredAt: time.Now()}
+
+	newRequest := func(method, _ string, _ []byte) (*http.Request, error) {
+		req, err := http.NewRequest(method, referenceURL, nil)
+		if err == nil && method == "GET" {
+			req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", size-1))
+		}
+		return req, err
+	}
+	rtt, err := timeRoundTrips(c.httpClient, "HEAD", newRequest, "", timeout)
+	if err != nil {
+		m.Error = err.Error()
+		return m
+	}
+	download, err := timeDownload(c.httpClient, newRequest, "", size, timeout)
+	if err != nil {
+		m.Error = err.Error()
+		return m
+	}
+
+	m.RTTMs, m.DownloadMbps = rtt, download
+	return m
+}
+
+// bandwidthRequestFunc builds the request for one step of a link test
+type bandwidthRequestFunc func(method, path string, body []byte) (*http.Request, error)
+
+// timeRoundTrips returns the fastest of a few bodiless requests in milliseconds
+func timeRoundTrips(client *http.Client, method string, newRequest bandwidthRequestFunc, path string, timeout time.Duration) (float64, error) {
+	fastest := time.Duration(0)
+	for i := 0; i < bandwidthRTTSamples; i++ {
+		req, err := newRequest(method, path, nil)
+		if err != nil {
+			return 0, err
+		}
+		start := time.Now()
+		if _, err := doBandwidthRequest(client, req, 0, timeout); err != nil {
+			return 0, fmt.Errorf("round trip failed: %w", err)
+		}
+		if elapsed := time.Since(start); fastest == 0 || elapsed < fastest {
+			fastest = elapsed
+		}
+	}
+	return float64(fastest.Microseconds()) / 1000, nil
+}
+
+// timeDownload returns the throughput of reading up to size bytes of a response body in Mbit/s
+func timeDownload(client *http.Client, newRequest bandwidthRequestFunc, path string, size int64, timeout time.Duration) (float64, error) {
+	req, err := newRequest("GET", path, nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	received, err := doBandwidthRequest(client, req, size, timeout)
+	if err != nil {
+		return 0, fmt.Errorf("download failed: %w", err)
+	}
+	if received == 0 {
+		return 0, fmt.Errorf("download failed: empty response")
+	}
+	return mbps(received, time.Since(start)), nil
+}
+
+// timeUpload returns the throughput of sending payload in Mbit/s
+func timeUpload(client *http.Client, newRequest bandwidthRequestFunc, path string, payload []byte, timeout time.Duration) (float64, error) {
+	req, err := newRequest("POST", path, payload)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	if _, err := doBandwidthRequest(client, req, 0, timeout); err != nil {
+		return 0, fmt.Errorf("upload failed: %w", err)
+	}
+	return mbps(int64(len(payload)), time.Since(start)), nil
+}
+
+// doBandwidthRequest sends a request within timeout and returns how many body bytes came back, reading at
+// most limit (reference servers may ignore the Range header and send a much larger file)
+func doBandwidthRequest(client *http.Client, req *http.Request, limit int64, timeout time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("status=%s", resp.Status)
+	}
+	return io.Copy(io.Discard, io.LimitReader(resp.Body, limit))
+}
+
+// mbps converts bytes moved in elapsed to Mbit/s
+func mbps(bytes int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(bytes) * 8 / 1e6 / elapsed.Seconds()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestMeasureBandwidth verifies the agent measures its link to the server and a reference endpoint,
+// and records failures without dropping the other measurements
+func TestMeasureBandwidth(t *testing.T) {
+	var uploaded int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bandwidth" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == "POST" {
+			uploaded, _ = io.Copy(io.Discard, r.Body)
+			w.Write([]byte(`{"received": 0}`))
+			return
+		}
+		n, _ := strconv.Atoi(r.URL.Query().Get("bytes"))
+		w.Write([]byte(strings.Repeat("x", n)))
+	}))
+	defer server.Close()
+
+	// The reference endpoint ignores Range and sends more than asked for
+	reference := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 4<<20)))
+	}))
+	defer reference.Close()
+
+	collector := &MetricsCollector{
+		config: Config{
+			ServerURL:     server.URL,
+			BandwidthTest: common.BandwidthTestConfig{Enabled: true, ReferenceURL: reference.URL, SizeMB: 1, TimeoutSecs: 5},
+		},
+		httpClient: &http.Client{},
+	}
+	results := collector.measureBandwidth()
+	if len(results) != 2 {
+		t.Fatalf("Expected server and reference measurements, got %+v", results)
+	}
+
+	srv := results[0]
+	if srv.Target != common.BandwidthTargetServer || srv.Error != "" || srv.DownloadMbps <= 0 || srv.UploadMbps <= 0 || srv.RTTMs <= 0 {
+		t.Errorf("Expected a complete server measurement, got %+v", srv)
+	}
+	if uploaded != 1<<20 {
+		t.Errorf("Expected 1 MB uploaded, got %d bytes", uploaded)
+	}
+	if ref := results[1]; ref.Target != reference.URL || ref.Error != "" || ref.DownloadMbps <= 0 || ref.UploadMbps != 0 {
+		t.Errorf("Expected a download-only reference measurement, got %+v", ref)
+	}
+
+	// Older servers without /bandwidth fail the server test only
+	older := httptest.NewServer(http.NotFoundHandler())
+	defer older.Close()
+	collector.config.ServerURL = older.URL
+	results = collector.measureBandwidth()
+	if len(results) != 2 || results[0].Error == "" || results[1].Error != "" {
+		t.Errorf("Expected only the server test to fail, got %+v", results)
+	}
+}
+
+// TestValidateBandwidthTest verifies sizes, timeouts and the reference URL are checked
+func TestValidateBandwidthTest(t *testing.T) {
+	valid := common.BandwidthTestConfig{Enabled: true, SizeMB: 4, TimeoutSecs: 15}
+	if err := validateBandwidthTest(valid); err != nil {
+		t.Errorf("Expected a valid config, got %v", err)
+	}
+	noSize := valid
+	noSize.SizeMB = 0
+	badURL := valid
+	badURL.ReferenceURL = "ftp://example.com/file"
+	nothing := valid
+	nothing.SkipServer = true
+	for _, cfg := range []common.BandwidthTestConfig{noSize, badURL, nothing} {
+		if err := validateBandwidthTest(cfg); err == nil {
+			t.Errorf("Expected an error for %+v", cfg)
+		}
+	}
+}
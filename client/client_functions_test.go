@@ -7,15 +7,13 @@ import (
 // TestCalculateCPUAverages verifies CPU averaging across cores
 func TestCalculateCPUAverages(t *testing.T) {
 	collector := &MetricsCollector{
-		maxSamples: 3,
-		cpuSamples: make([][]float64, 3),
+		cpuSamples: NewCoreSampleRing(3, 0),
 	}
 
 	// Add CPU samples
-	collector.cpuSamples[0] = []float64{10.0, 20.0, 30.0, 40.0}
-	collector.cpuSamples[1] = []float64{15.0, 25.0, 35.0, 45.0}
-	collector.cpuSamples[2] = []float64{20.0, 30.0, 40.0, 50.0}
-	collector.sampleIndex = 3
+	collector.cpuSamples.Add([]float64{10.0, 20.0, 30.0, 40.0})
+	collector.cpuSamples.Add([]float64{15.0, 25.0, 35.0, 45.0})
+	collector.cpuSamples.Add([]float64{20.0, 30.0, 40.0, 50.0})
 
 	averages := collector.calculateCPUAverages()
 
@@ -47,9 +45,7 @@ func TestCalculateCPUAverages(t *testing.T) {
 // TestCalculateCPUAverages_EmptySamples verifies handling of empty samples
 func TestCalculateCPUAverages_EmptySamples(t *testing.T) {
 	collector := &MetricsCollector{
-		maxSamples: 3,
-		cpuSamples: make([][]float64, 3),
-		sampleIndex: 0,
+		cpuSamples: NewCoreSampleRing(3, 0),
 	}
 
 	averages := collector.calculateCPUAverages()
@@ -62,13 +58,11 @@ func TestCalculateCPUAverages_EmptySamples(t *testing.T) {
 // TestCalculateCPUAverages_PartialSamples verifies handling of partial samples
 func TestCalculateCPUAverages_PartialSamples(t *testing.T) {
 	collector := &MetricsCollector{
-		maxSamples: 3,
-		cpuSamples: make([][]float64, 3),
+		cpuSamples: NewCoreSampleRing(3, 0),
 	}
 
 	// Only first sample has data
-	collector.cpuSamples[0] = []float64{30.0, 40.0}
-	collector.sampleIndex = 1
+	collector.cpuSamples.Add([]float64{30.0, 40.0})
 
 	averages := collector.calculateCPUAverages()
 
@@ -89,15 +83,13 @@ func TestCalculateCPUAverages_PartialSamples(t *testing.T) {
 // The function uses the FIRST non-empty sample's core count
 func TestCalculateCPUAverages_VariableCoreCounts(t *testing.T) {
 	collector := &MetricsCollector{
-		maxSamples: 3,
-		cpuSamples: make([][]float64, 3),
+		cpuSamples: NewCoreSampleRing(3, 0),
 	}
 
 	// Different number of cores per sample (uses first sample's count)
-	collector.cpuSamples[0] = []float64{10.0, 20.0}
-	collector.cpuSamples[1] = []float64{15.0, 25.0, 35.0}
-	collector.cpuSamples[2] = []float64{20.0, 30.0}
-	collector.sampleIndex = 3
+	collector.cpuSamples.Add([]float64{10.0, 20.0})
+	collector.cpuSamples.Add([]float64{15.0, 25.0, 35.0})
+	collector.cpuSamples.Add([]float64{20.0, 30.0})
 
 	averages := collector.calculateCPUAverages()
 
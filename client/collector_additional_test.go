@@ -22,16 +22,15 @@ func TestCollectMetrics_DataCollection(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(5)
+	gpuCollector := NewGPUCollector(5, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     nil,
-		cpuSamples:     make([][]float64, 5),
-		memorySamples:  make([]float64, 5),
-		diskSamples:    make([]float64, 5),
+		cpuSamples:     NewCoreSampleRing(5, 0),
+		memorySamples:  NewSampleRing(5, 0),
+		diskSamples:    NewSampleRing(5, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     5,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -48,19 +47,19 @@ func TestCollectMetrics_DataCollection(t *testing.T) {
 			// CPU per-core usage
 			perCore, err := cpu.Percent(0, true)
 			if err == nil && len(perCore) > 0 {
-				collector.cpuSamples[collector.sampleIndex] = perCore
+				collector.cpuSamples.Add(perCore)
 			}
 
 			// Memory usage
 			memInfo, err := mem.VirtualMemory()
 			if err == nil {
-				collector.memorySamples[collector.sampleIndex] = float64(memInfo.Used) / 1024 / 1024 / 1024
+				collector.memorySamples.Add(float64(memInfo.Used) / 1024 / 1024 / 1024)
 			}
 
 			// Disk usage
 			diskInfo, err := disk.Usage(collector.config.DiskPath)
 			if err == nil {
-				collector.diskSamples[collector.sampleIndex] = float64(diskInfo.Used) / 1024 / 1024 / 1024
+				collector.diskSamples.Add(float64(diskInfo.Used) / 1024 / 1024 / 1024)
 			}
 
 			// GPU metrics (if available)
@@ -68,7 +67,6 @@ func TestCollectMetrics_DataCollection(t *testing.T) {
 				_ = collector.gpuCollector.CollectSample()
 			}
 
-			collector.sampleIndex = (collector.sampleIndex + 1) % collector.maxSamples
 			collected++
 
 			if collected >= 3 {
@@ -87,38 +85,32 @@ func TestCollectMetrics_DataCollection(t *testing.T) {
 	}
 
 	// Verify some data was collected
-	hasData := false
-	for i := 0; i < collector.maxSamples; i++ {
-		if len(collector.cpuSamples[i]) > 0 || collector.memorySamples[i] > 0 || collector.diskSamples[i] > 0 {
-			hasData = true
-			break
-		}
-	}
+	hasData := collector.cpuSamples.Len() > 0 || collector.memorySamples.Len() > 0 || collector.diskSamples.Len() > 0
 
 	if !hasData {
 		t.Error("No metrics data was collected")
 	}
 }
 
-// TestCollectMetrics_SampleIndexWrap verifies sample index wraps correctly
-func TestCollectMetrics_SampleIndexWrap(t *testing.T) {
+// TestCollectMetrics_SampleRingWrap verifies the ring keeps only the most recent samples
+func TestCollectMetrics_SampleRingWrap(t *testing.T) {
 	collector := &MetricsCollector{
-		cpuSamples:    make([][]float64, 3),
-		memorySamples: make([]float64, 3),
-		diskSamples:   make([]float64, 3),
-		maxSamples:    3,
-		sampleIndex:   0,
+		cpuSamples:    NewCoreSampleRing(3, 0),
+		memorySamples: NewSampleRing(3, 0),
+		diskSamples:   NewSampleRing(3, 0),
 	}
 
 	// Simulate multiple collections
 	for i := 0; i < 10; i++ {
-		collector.sampleIndex = (collector.sampleIndex + 1) % collector.maxSamples
+		collector.memorySamples.Add(float64(i))
 	}
 
-	// Verify index wrapped correctly (10 % 3 = 1)
-	expectedIndex := 10 % 3
-	if collector.sampleIndex != expectedIndex {
-		t.Errorf("Expected sampleIndex %d after 10 increments, got %d", expectedIndex, collector.sampleIndex)
+	// Only samples 7, 8, 9 remain
+	if collector.memorySamples.Len() != 3 {
+		t.Errorf("Expected 3 samples after 10 adds, got %d", collector.memorySamples.Len())
+	}
+	if avg := collector.memorySamples.Mean(time.Now()); avg != 8.0 {
+		t.Errorf("Expected average 8.0 of the latest samples, got %f", avg)
 	}
 }
 
@@ -136,16 +128,15 @@ func TestCollectMetrics_ConcurrentAccess(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(10)
+	gpuCollector := NewGPUCollector(10, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     nil,
-		cpuSamples:     make([][]float64, 10),
-		memorySamples:  make([]float64, 10),
-		diskSamples:    make([]float64, 10),
+		cpuSamples:     NewCoreSampleRing(10, 0),
+		memorySamples:  NewSampleRing(10, 0),
+		diskSamples:    NewSampleRing(10, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     10,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -165,10 +156,7 @@ func TestCollectMetrics_ConcurrentAccess(t *testing.T) {
 				if err == nil && len(perCore) > 0 {
 					// Use mutex to safely access shared state in test
 					mu.Lock()
-					idx := collector.sampleIndex
-					if idx < len(collector.cpuSamples) {
-						collector.cpuSamples[idx] = perCore
-					}
+					collector.cpuSamples.Add(perCore)
 					mu.Unlock()
 				}
 
@@ -182,13 +170,7 @@ func TestCollectMetrics_ConcurrentAccess(t *testing.T) {
 
 	// Verify that we have collected some data
 	mu.Lock()
-	hasData := false
-	for _, sample := range collector.cpuSamples {
-		if len(sample) > 0 {
-			hasData = true
-			break
-		}
-	}
+	hasData := collector.cpuSamples.Len() > 0
 	mu.Unlock()
 
 	if !hasData {
@@ -199,8 +181,7 @@ func TestCollectMetrics_ConcurrentAccess(t *testing.T) {
 // TestCalculateCPUAverages_EmptyData verifies handling of empty CPU data
 func TestCalculateCPUAverages_EmptyData(t *testing.T) {
 	collector := &MetricsCollector{
-		cpuSamples: make([][]float64, 3),
-		maxSamples: 3,
+		cpuSamples: NewCoreSampleRing(3, 0),
 	}
 
 	// Calculate averages with no data
@@ -214,16 +195,15 @@ func TestCalculateCPUAverages_EmptyData(t *testing.T) {
 // TestCalculateCPUAverages_VariableCores verifies handling of variable core counts
 func TestCalculateCPUAverages_VariableCores(t *testing.T) {
 	collector := &MetricsCollector{
-		cpuSamples: make([][]float64, 3),
-		maxSamples: 3,
+		cpuSamples: NewCoreSampleRing(3, 0),
 	}
 
 	// Sample 0: 2 cores
-	collector.cpuSamples[0] = []float64{10.0, 20.0}
+	collector.cpuSamples.Add([]float64{10.0, 20.0})
 	// Sample 1: 4 cores (different count)
-	collector.cpuSamples[1] = []float64{15.0, 25.0, 35.0, 45.0}
+	collector.cpuSamples.Add([]float64{15.0, 25.0, 35.0, 45.0})
 	// Sample 2: 2 cores again
-	collector.cpuSamples[2] = []float64{20.0, 30.0}
+	collector.cpuSamples.Add([]float64{20.0, 30.0})
 
 	// Calculate averages
 	result := collector.calculateCPUAverages()
@@ -238,9 +218,7 @@ func TestCalculateCPUAverages_VariableCores(t *testing.T) {
 
 // TestCalculateAverage_EmptySlice verifies handling of empty slice
 func TestCalculateAverage_EmptySlice(t *testing.T) {
-	collector := &MetricsCollector{}
-
-	result := collector.calculateAverage([]float64{})
+	result := mean([]float64{})
 
 	if result != 0.0 {
 		t.Errorf("Expected 0.0 for empty slice, got %f", result)
@@ -249,25 +227,21 @@ func TestCalculateAverage_EmptySlice(t *testing.T) {
 
 // TestCalculateAverage_AllZeros verifies handling of all-zero values
 func TestCalculateAverage_AllZeros(t *testing.T) {
-	collector := &MetricsCollector{}
-
 	samples := []float64{0.0, 0.0, 0.0}
-	result := collector.calculateAverage(samples)
+	result := mean(samples)
 
 	if result != 0.0 {
 		t.Errorf("Expected 0.0 for all-zero samples, got %f", result)
 	}
 }
 
-// TestCalculateAverage_MixedValues verifies correct average calculation
+// TestCalculateAverage_MixedValues verifies zero samples are real observations, not gaps
 func TestCalculateAverage_MixedValues(t *testing.T) {
-	collector := &MetricsCollector{}
-
 	samples := []float64{10.0, 20.0, 30.0, 0.0, 0.0}
-	result := collector.calculateAverage(samples)
+	result := mean(samples)
 
-	// The function skips zero values, so: (10 + 20 + 30) / 3 = 20.0
-	expected := 20.0
+	// Zeros count: (10 + 20 + 30 + 0 + 0) / 5 = 12.0
+	expected := 12.0
 	if result != expected {
 		t.Errorf("Expected average %f, got %f", expected, result)
 	}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+
+	"cyqle.in/opsen/common"
+)
+
+// readIOCounters returns cumulative per-device I/O counters (replaced in tests)
+var readIOCounters = func() (map[string]disk.IOCountersStat, error) {
+	return disk.IOCounters()
+}
+
+// ignoredIODevicePrefixes are virtual block devices whose I/O says nothing about the host's disks
+var ignoredIODevicePrefixes = []string{"loop", "ram", "zram", "sr", "fd"}
+
+// DiskIOCollector turns cumulative block device counters into throughput, IOPS and queue depth
+// Each reading reports the averages since the previous one, i.e. over one report interval
+type DiskIOCollector struct {
+	diskDevice string // Device backing disk_path (e.g. "nvme0n1p2"), empty if unknown
+	last       map[string]disk.IOCountersStat
+	lastAt     time.Time
+}
+
+// NewDiskIOCollector creates a collector; the first Read only records a baseline
+func NewDiskIOCollector(diskPath string) *DiskIOCollector {
+	return &DiskIOCollector{diskDevice: deviceForPath(diskPath)}
+}
+
+// Read returns per-device I/O activity since the previous call
+// Returns nil on the first call and when counters are unavailable (non-Linux, containers without /proc/diskstats)
+// Safe to call on a nil collector
+func (d *DiskIOCollector) Read() []common.DiskIOStats {
+	if d == nil {
+		return nil
+	}
+	counters, err := readIOCounters()
+	if err != nil || len(counters) == 0 {
+		return nil
+	}
+	now := time.Now()
+	last, lastAt := d.last, d.lastAt
+	d.last, d.lastAt = counters, now
+	if last == nil {
+		return nil
+	}
+
+	elapsed := now.Sub(lastAt).Seconds()
+	if elapsed <= 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(counters))
+	for name := range counters {
+		if !ignoredIODevice(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	stats := make([]common.DiskIOStats, 0, len(names))
+	for _, name := range names {
+		cur := counters[name]
+		prev, ok := last[name]
+		// Counters reset when a device is re-attached; skip it for one interval
+		if !ok || cur.ReadBytes < prev.ReadBytes || cur.WriteBytes < prev.WriteBytes ||
+			cur.ReadCount < prev.ReadCount || cur.WriteCount < prev.WriteCount ||
+			cur.IoTime < prev.IoTime || cur.WeightedIO < prev.WeightedIO {
+			continue
+		}
+
+		elapsedMs := elapsed * 1000
+		stats = append(stats, common.DiskIOStats{
+			Device:     name,
+			DiskPath:   name == d.diskDevice,
+			ReadMBps:   float64(cur.ReadBytes-prev.ReadBytes) / 1024 / 1024 / elapsed,
+			WriteMBps:  float64(cur.WriteBytes-prev.WriteBytes) / 1024 / 1024 / elapsed,
+			ReadIOPS:   float64(cur.ReadCount-prev.ReadCount) / elapsed,
+			WriteIOPS:  float64(cur.WriteCount-prev.WriteCount) / elapsed,
+			QueueDepth: float64(cur.WeightedIO-prev.WeightedIO) / elapsedMs,
+			UtilPct:    min(float64(cur.IoTime-prev.IoTime)/elapsedMs*100, 100),
+		})
+	}
+	return stats
+}
+
+func ignoredIODevice(name string) bool {
+	for _, prefix := range ignoredIODevicePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// deviceForPath finds the block device mounted at the longest prefix of path ("/dev/sda1" → "sda1")
+func deviceForPath(path string) string {
+	partitions, err := disk.Partitions(false)
+	if err != nil {
+		return ""
+	}
+
+	device, longest := "", -1
+	for _, p := range partitions {
+		if !strings.HasPrefix(p.Device, "/dev/") || !pathUnderMount(path, p.Mountpoint) {
+			continue
+		}
+		if len(p.Mountpoint) > longest {
+			// Symlinked devices (/dev/mapper/vg-root, /dev/disk/by-uuid/...) are named by their target in /proc/diskstats
+			resolved, err := filepath.EvalSymlinks(p.Device)
+			if err != nil {
+				resolved = p.Device
+			}
+			device, longest = filepath.Base(resolved), len(p.Mountpoint)
+		}
+	}
+	return device
+}
+
+func pathUnderMount(path, mountpoint string) bool {
+	if mountpoint == "/" {
+		return strings.HasPrefix(path, "/")
+	}
+	return path == mountpoint || strings.HasPrefix(path, mountpoint+"/")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// TestDiskIOCollector_Rates verifies cumulative counters become per-second rates, queue depth and utilization
+func TestDiskIOCollector_Rates(t *testing.T) {
+	counters := map[string]disk.IOCountersStat{
+		"sda":   {ReadBytes: 0, WriteBytes: 0, ReadCount: 0, WriteCount: 0, IoTime: 0, WeightedIO: 0},
+		"loop0": {ReadBytes: 0},
+	}
+	original := readIOCounters
+	readIOCounters = func() (map[string]disk.IOCountersStat, error) { return counters, nil }
+	defer func() { readIOCounters = original }()
+
+	collector := &DiskIOCollector{diskDevice: "sda"}
+	if stats := collector.Read(); stats != nil {
+		t.Fatalf("Expected the first read to only record a baseline, got %+v", stats)
+	}
+
+	// Pretend exactly one second passed
+	collector.lastAt = time.Now().Add(-time.Second)
+	counters = map[string]disk.IOCountersStat{
+		"sda":   {ReadBytes: 50 << 20, WriteBytes: 10 << 20, ReadCount: 400, WriteCount: 100, IoTime: 500, WeightedIO: 2000},
+		"loop0": {ReadBytes: 1 << 30},
+	}
+	stats := collector.Read()
+	if len(stats) != 1 {
+		t.Fatalf("Expected loop devices to be ignored, got %+v", stats)
+	}
+
+	dev := stats[0]
+	near := func(got, want float64) bool { return got > want*0.95 && got < want*1.05 }
+	if !dev.DiskPath || !near(dev.ReadMBps, 50) || !near(dev.WriteMBps, 10) || !near(dev.ReadIOPS, 400) || !near(dev.WriteIOPS, 100) {
+		t.Errorf("Unexpected throughput/IOPS: %+v", dev)
+	}
+	if !near(dev.QueueDepth, 2) || !near(dev.UtilPct, 50) {
+		t.Errorf("Expected queue depth ~2 and ~50%% utilization, got %+v", dev)
+	}
+
+	var disabled *DiskIOCollector
+	if disabled.Read() != nil {
+		t.Error("Expected a nil collector to report nothing")
+	}
+}
+
+// TestPathUnderMount verifies disk_path is matched to mountpoints on path boundaries
+func TestPathUnderMount(t *testing.T) {
+	tests := []struct {
+		path, mount string
+		want        bool
+	}{
+		{"/var/lib/data", "/", true},
+		{"/var/lib/data", "/var/lib", true},
+		{"/var/lib", "/var/lib", true},
+		{"/var/library", "/var/lib", false},
+	}
+	for _, tt := range tests {
+		if got := pathUnderMount(tt.path, tt.mount); got != tt.want {
+			t.Errorf("pathUnderMount(%q, %q) = %v, want %v", tt.path, tt.mount, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// maxPendingErrors caps distinct error events held between reports; further new events are dropped
+const maxPendingErrors = 100
+
+// errErrorReportingUnsupported means the server predates POST /errors
+var errErrorReportingUnsupported = errors.New("server does not support error reporting")
+
+// ErrorReporter collects structured error events until the next report to the load balancer
+// Repeats of a pending event (same source, severity and message) only bump its count
+type ErrorReporter struct {
+	mu       sync.Mutex
+	pending  []common.ClientError
+	index    map[string]int // source/severity/message → position in pending
+	disabled bool           // Server does not accept error reports
+}
+
+// NewErrorReporter creates an empty error reporter
+func NewErrorReporter() *ErrorReporter {
+	return &ErrorReporter{index: make(map[string]int)}
+}
+
+// Record queues an error event; details are optional context (device index, path...)
+func (er *ErrorReporter) Record(source, severity string, err error, details map[string]string) {
+	if er == nil || err == nil {
+		return
+	}
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	if er.disabled {
+		return
+	}
+
+	message := err.Error()
+	key := source + "\x00" + severity + "\x00" + message
+	if i, ok := er.index[key]; ok {
+		er.pending[i].Count++
+		return
+	}
+	if len(er.pending) >= maxPendingErrors {
+		return
+	}
+	er.index[key] = len(er.pending)
+	er.pending = append(er.pending, common.ClientError{
+		Timestamp: time.Now(),
+		Source:    source,
+		Severity:  severity,
+		Message:   message,
+		Count:     1,
+		Details:   details,
+	})
+}
+
+// Drain returns the pending events and clears them
+func (er *ErrorReporter) Drain() []common.ClientError {
+	if er == nil {
+		return nil
+	}
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	events := er.pending
+	er.pending = nil
+	er.index = make(map[string]int)
+	return events
+}
+
+// Requeue puts undelivered events back, keeping newer events already recorded within the cap
+func (er *ErrorReporter) Requeue(events []common.ClientError) {
+	if er == nil || len(events) == 0 {
+		return
+	}
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	merged := append(append([]common.ClientError{}, events...), er.pending...)
+	er.pending = nil
+	er.index = make(map[string]int)
+	for _, event := range merged {
+		key := event.Source + "\x00" + event.Severity + "\x00" + event.Message
+		if i, ok := er.index[key]; ok {
+			er.pending[i].Count += event.Count
+			continue
+		}
+		if len(er.pending) >= maxPendingErrors {
+			continue
+		}
+		er.index[key] = len(er.pending)
+		er.pending = append(er.pending, event)
+	}
+}
+
+// disable stops collecting events (the server cannot receive them)
+func (er *ErrorReporter) disable() {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	er.disabled = true
+	er.pending = nil
+	er.index = make(map[string]int)
+}
+
+// reportErrors sends pending error events to the load balancer
+// Events are requeued when delivery fails and dropped if the server does not support POST /errors
+func (c *MetricsCollector) reportErrors() error {
+	events := c.errorReports.Drain()
+	if len(events) == 0 {
+		return nil
+	}
+
+	body, _ := json.Marshal(common.ClientErrorReport{ClientID: c.config.ClientID, Errors: events})
+	resp, _, err := c.sendToServer("POST", "/errors", body)
+	if err != nil {
+		c.errorReports.Requeue(events)
+		return fmt.Errorf("error report request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		// Older servers answer with the mux's generic 404 (unknown clients get a descriptive one)
+		if resp.StatusCode == http.StatusMethodNotAllowed ||
+			(resp.StatusCode == http.StatusNotFound && string(bodyBytes) == "404 page not found\n") {
+			c.errorReports.disable()
+			return errErrorReportingUnsupported
+		}
+		if resp.StatusCode >= 500 {
+			c.errorReports.Requeue(events)
+		}
+		return fmt.Errorf("error report failed: status=%s, body=%s", resp.Status, string(bodyBytes))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestErrorReporter_CoalescesRepeats verifies repeated events only bump the count of the pending one
+func TestErrorReporter_CoalescesRepeats(t *testing.T) {
+	reporter := NewErrorReporter()
+	for i := 0; i < 5; i++ {
+		reporter.Record("gpu_collector", common.ErrorSeverityError, errors.New("NVML: GPU is lost"), nil)
+	}
+	reporter.Record("disk", common.ErrorSeverityError, errors.New("input/output error"), map[string]string{"path": "/"})
+
+	events := reporter.Drain()
+	if len(events) != 2 || events[0].Count != 5 || events[1].Details["path"] != "/" {
+		t.Fatalf("Expected 2 coalesced events, got %+v", events)
+	}
+	if len(reporter.Drain()) != 0 {
+		t.Error("Expected Drain to clear pending events")
+	}
+
+	var disabled *ErrorReporter
+	disabled.Record("disk", common.ErrorSeverityError, errors.New("ignored"), nil)
+	if disabled.Drain() != nil {
+		t.Error("Expected a nil reporter to drop events")
+	}
+}
+
+// TestReportErrors verifies events are sent to /errors, requeued on server errors and dropped on old servers
+func TestReportErrors(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	var reports []common.ClientErrorReport
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status == http.StatusNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		var report common.ClientErrorReport
+		json.NewDecoder(r.Body).Decode(&report)
+		reports = append(reports, report)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	collector := &MetricsCollector{
+		config:       Config{ServerURL: server.URL, ClientID: "agent-1"},
+		httpClient:   &http.Client{},
+		errorReports: NewErrorReporter(),
+	}
+
+	collector.errorReports.Record("probe", common.ErrorSeverityWarning, errors.New("connection refused"), nil)
+	if err := collector.reportErrors(); err == nil {
+		t.Fatal("Expected a 503 to fail the report")
+	}
+
+	// The failed event is merged with the repeat recorded meanwhile
+	collector.errorReports.Record("probe", common.ErrorSeverityWarning, errors.New("connection refused"), nil)
+	status = http.StatusOK
+	if err := collector.reportErrors(); err != nil {
+		t.Fatalf("Expected the report to succeed, got %v", err)
+	}
+	last := reports[len(reports)-1]
+	if last.ClientID != "agent-1" || len(last.Errors) != 1 || last.Errors[0].Count != 2 {
+		t.Errorf("Expected one requeued event with count 2, got %+v", last)
+	}
+
+	status = http.StatusNotFound
+	collector.errorReports.Record("disk", common.ErrorSeverityError, errors.New("input/output error"), nil)
+	if err := collector.reportErrors(); !errors.Is(err, errErrorReportingUnsupported) {
+		t.Fatalf("Expected old servers to disable error reporting, got %v", err)
+	}
+	collector.errorReports.Record("disk", common.ErrorSeverityError, errors.New("input/output error"), nil)
+	if len(collector.errorReports.Drain()) != 0 {
+		t.Error("Expected no events to be collected once reporting is disabled")
+	}
+}
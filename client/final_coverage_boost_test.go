@@ -41,16 +41,15 @@ func TestRegister_FullFlow(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(5)
+	gpuCollector := NewGPUCollector(5, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 5),
-		memorySamples:  make([]float64, 5),
-		diskSamples:    make([]float64, 5),
+		cpuSamples:     NewCoreSampleRing(5, 0),
+		memorySamples:  NewSampleRing(5, 0),
+		diskSamples:    NewSampleRing(5, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     5,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -102,16 +101,15 @@ func TestRegister_WithRetry(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(3)
+	gpuCollector := NewGPUCollector(3, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 2 * time.Second},
-		cpuSamples:     make([][]float64, 3),
-		memorySamples:  make([]float64, 3),
-		diskSamples:    make([]float64, 3),
+		cpuSamples:     NewCoreSampleRing(3, 0),
+		memorySamples:  NewSampleRing(3, 0),
+		diskSamples:    NewSampleRing(3, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     3,
 		circuitBreaker: NewCircuitBreaker(10, 30*time.Second),
 		retryConfig: RetryConfig{
 			MaxAttempts: 3,
@@ -154,31 +152,29 @@ func TestReportStats_DetailedMetrics(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(3)
+	gpuCollector := NewGPUCollector(3, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 3),
-		memorySamples:  make([]float64, 3),
-		diskSamples:    make([]float64, 3),
+		cpuSamples:     NewCoreSampleRing(3, 0),
+		memorySamples:  NewSampleRing(3, 0),
+		diskSamples:    NewSampleRing(3, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     3,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
 
 	// Add detailed sample data
-	collector.cpuSamples[0] = []float64{25.0, 30.0, 35.0, 40.0}
-	collector.cpuSamples[1] = []float64{26.0, 31.0, 36.0, 41.0}
-	collector.cpuSamples[2] = []float64{27.0, 32.0, 37.0, 42.0}
-	collector.memorySamples[0] = 8.5
-	collector.memorySamples[1] = 9.0
-	collector.memorySamples[2] = 9.5
-	collector.diskSamples[0] = 150.0
-	collector.diskSamples[1] = 151.0
-	collector.diskSamples[2] = 152.0
-	collector.sampleIndex = 3
+	collector.cpuSamples.Add([]float64{25.0, 30.0, 35.0, 40.0})
+	collector.cpuSamples.Add([]float64{26.0, 31.0, 36.0, 41.0})
+	collector.cpuSamples.Add([]float64{27.0, 32.0, 37.0, 42.0})
+	collector.memorySamples.Add(8.5)
+	collector.memorySamples.Add(9.0)
+	collector.memorySamples.Add(9.5)
+	collector.diskSamples.Add(150.0)
+	collector.diskSamples.Add(151.0)
+	collector.diskSamples.Add(152.0)
 
 	err := collector.reportStats()
 	if err != nil {
@@ -268,30 +264,28 @@ func TestCollectMetrics_FullIntegration(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(5)
+	gpuCollector := NewGPUCollector(5, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 60),
-		memorySamples:  make([]float64, 60),
-		diskSamples:    make([]float64, 60),
+		cpuSamples:     NewCoreSampleRing(60, 0),
+		memorySamples:  NewSampleRing(60, 0),
+		diskSamples:    NewSampleRing(60, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     60,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
-		sampleIndex:    0,
 	}
 
 	// Simulate some collection cycles
 	for i := 0; i < 10; i++ {
-		collector.sampleIndex = (collector.sampleIndex + 1) % collector.maxSamples
+		collector.collectSample()
 	}
 
 	// Calculate averages
 	cpuAvg := collector.calculateCPUAverages()
-	memAvg := collector.calculateAverage(collector.memorySamples)
-	diskAvg := collector.calculateAverage(collector.diskSamples)
+	memAvg := collector.memorySamples.Mean(time.Now())
+	diskAvg := collector.diskSamples.Mean(time.Now())
 
 	t.Logf("Collection integration: %d CPU cores, %.2f GB mem avg, %.2f GB disk avg",
 		len(cpuAvg), memAvg, diskAvg)
@@ -316,16 +310,15 @@ func TestRegister_ErrorResponse(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(3)
+	gpuCollector := NewGPUCollector(3, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 2 * time.Second},
-		cpuSamples:     make([][]float64, 3),
-		memorySamples:  make([]float64, 3),
-		diskSamples:    make([]float64, 3),
+		cpuSamples:     NewCoreSampleRing(3, 0),
+		memorySamples:  NewSampleRing(3, 0),
+		diskSamples:    NewSampleRing(3, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     3,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig: RetryConfig{
 			MaxAttempts: 1,
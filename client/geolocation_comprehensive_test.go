@@ -194,17 +194,16 @@ func TestRegister_WithAPIGeolocation(t *testing.T) {
 		GeoIPDBPath:     "",    // Use API, not database
 	}
 
-	gpuCollector := NewGPUCollector(60)
+	gpuCollector := NewGPUCollector(60, 0)
 	defer gpuCollector.Close()
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 60),
-		memorySamples:  make([]float64, 60),
-		diskSamples:    make([]float64, 60),
+		cpuSamples:     NewCoreSampleRing(60, 0),
+		memorySamples:  NewSampleRing(60, 0),
+		diskSamples:    NewSampleRing(60, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     60,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -240,17 +239,16 @@ func TestRegister_GeolocationAPIFailure(t *testing.T) {
 		GeoIPDBPath:     "", // Will try API which might fail
 	}
 
-	gpuCollector := NewGPUCollector(60)
+	gpuCollector := NewGPUCollector(60, 0)
 	defer gpuCollector.Close()
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 1 * time.Second}, // Short timeout
-		cpuSamples:     make([][]float64, 60),
-		memorySamples:  make([]float64, 60),
-		diskSamples:    make([]float64, 60),
+		cpuSamples:     NewCoreSampleRing(60, 0),
+		memorySamples:  NewSampleRing(60, 0),
+		diskSamples:    NewSampleRing(60, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     60,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -285,17 +283,16 @@ func TestRegister_WithServerKey(t *testing.T) {
 		ServerKey:       "test-api-key-12345",
 	}
 
-	gpuCollector := NewGPUCollector(60)
+	gpuCollector := NewGPUCollector(60, 0)
 	defer gpuCollector.Close()
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 60),
-		memorySamples:  make([]float64, 60),
-		diskSamples:    make([]float64, 60),
+		cpuSamples:     NewCoreSampleRing(60, 0),
+		memorySamples:  NewSampleRing(60, 0),
+		diskSamples:    NewSampleRing(60, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     60,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -339,17 +336,16 @@ func TestRegister_LocalIPFailure(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(60)
+	gpuCollector := NewGPUCollector(60, 0)
 	defer gpuCollector.Close()
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 60),
-		memorySamples:  make([]float64, 60),
-		diskSamples:    make([]float64, 60),
+		cpuSamples:     NewCoreSampleRing(60, 0),
+		memorySamples:  NewSampleRing(60, 0),
+		diskSamples:    NewSampleRing(60, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     60,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -75,16 +75,15 @@ func TestRegister_SkipGeolocation(t *testing.T) {
 		SkipGeolocation: true, // Skip geolocation
 	}
 
-	gpuCollector := NewGPUCollector(60)
+	gpuCollector := NewGPUCollector(60, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 60),
-		memorySamples:  make([]float64, 60),
-		diskSamples:    make([]float64, 60),
+		cpuSamples:     NewCoreSampleRing(60, 0),
+		memorySamples:  NewSampleRing(60, 0),
+		diskSamples:    NewSampleRing(60, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     60,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -123,16 +122,15 @@ func TestRegister_WithGeoIPDB(t *testing.T) {
 		GeoIPDBPath:     "/nonexistent/GeoLite2-City.mmdb", // Will fail but continue
 	}
 
-	gpuCollector := NewGPUCollector(60)
+	gpuCollector := NewGPUCollector(60, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 60),
-		memorySamples:  make([]float64, 60),
-		diskSamples:    make([]float64, 60),
+		cpuSamples:     NewCoreSampleRing(60, 0),
+		memorySamples:  NewSampleRing(60, 0),
+		diskSamples:    NewSampleRing(60, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     60,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -165,16 +163,15 @@ func TestRegister_ServerError(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(60)
+	gpuCollector := NewGPUCollector(60, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 60),
-		memorySamples:  make([]float64, 60),
-		diskSamples:    make([]float64, 60),
+		cpuSamples:     NewCoreSampleRing(60, 0),
+		memorySamples:  NewSampleRing(60, 0),
+		diskSamples:    NewSampleRing(60, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     60,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -220,16 +217,15 @@ func TestRegister_WithGPUs(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(60)
+	gpuCollector := NewGPUCollector(60, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 60),
-		memorySamples:  make([]float64, 60),
-		diskSamples:    make([]float64, 60),
+		cpuSamples:     NewCoreSampleRing(60, 0),
+		memorySamples:  NewSampleRing(60, 0),
+		diskSamples:    NewSampleRing(60, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     60,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/NVIDIA/go-nvml/pkg/nvml"
 	"cyqle.in/opsen/common"
@@ -13,19 +15,48 @@ type GPUCollector struct {
 	enabled      bool
 	devices      []nvml.Device
 	deviceModels []string
-	sampleWindow [][]common.GPUStats // [sample_index][device_index]
-	sampleIndex  int
-	maxSamples   int
+	computeCaps  []float64          // CUDA compute capability per device (0 = unknown)
+	samples      []gpuDeviceSamples // Per-device readings over the report window (index = device)
+
+	// ECC counters and throttling state are reported as of the latest sample, not averaged
+	latestMu sync.Mutex
+	latest   []common.GPUStats
+
+	// XID error events (critical GPU faults reported by the driver)
+	xidMu      sync.Mutex
+	recentXIDs map[int][]uint64 // device index → XIDs not yet delivered in a report
+	stopXID    chan struct{}
+	xidDone    chan struct{}
+}
+
+// gpuDeviceSamples holds one GPU's averaged readings
+type gpuDeviceSamples struct {
+	utilization *SampleRing
+	memoryUsed  *SampleRing
+	memoryTotal *SampleRing
+	temperature *SampleRing
+	power       *SampleRing
+}
+
+// newGPUSamples creates sample rings for each device, aggregated like the CPU and memory samples
+func newGPUSamples(devices, capacity int, window time.Duration) []gpuDeviceSamples {
+	samples := make([]gpuDeviceSamples, devices)
+	for i := range samples {
+		samples[i] = gpuDeviceSamples{
+			utilization: NewSampleRing(capacity, window),
+			memoryUsed:  NewSampleRing(capacity, window),
+			memoryTotal: NewSampleRing(capacity, window),
+			temperature: NewSampleRing(capacity, window),
+			power:       NewSampleRing(capacity, window),
+		}
+	}
+	return samples
 }
 
 // NewGPUCollector initializes GPU monitoring with graceful degradation
 // Returns a disabled collector if GPUs are not available or NVML fails to initialize
-func NewGPUCollector(samplesPerWindow int) *GPUCollector {
-	collector := &GPUCollector{
-		enabled:      false,
-		sampleWindow: make([][]common.GPUStats, samplesPerWindow),
-		maxSamples:   samplesPerWindow,
-	}
+func NewGPUCollector(samplesPerWindow int, window time.Duration) *GPUCollector {
+	collector := &GPUCollector{enabled: false}
 
 	// Attempt to initialize NVML
 	ret := nvml.Init()
@@ -55,6 +86,7 @@ func NewGPUCollector(samplesPerWindow int) *GPUCollector {
 	// Initialize device handles
 	devices := make([]nvml.Device, 0, count)
 	deviceModels := make([]string, 0, count)
+	computeCaps := make([]float64, 0, count)
 
 	for i := 0; i < count; i++ {
 		device, ret := nvml.DeviceGetHandleByIndex(i)
@@ -69,9 +101,16 @@ func NewGPUCollector(samplesPerWindow int) *GPUCollector {
 			name = "Unknown GPU"
 		}
 
+		// Compute capability lets tiers exclude older architectures with enough VRAM
+		computeCap := 0.0
+		if major, minor, ret := device.GetCudaComputeCapability(); ret == nvml.SUCCESS {
+			computeCap = float64(major) + float64(minor)/10
+		}
+
 		devices = append(devices, device)
 		deviceModels = append(deviceModels, name)
-		log.Printf("GPU %d detected: %s", i, name)
+		computeCaps = append(computeCaps, computeCap)
+		log.Printf("GPU %d detected: %s (compute capability %.1f)", i, name, computeCap)
 	}
 
 	if len(devices) == 0 {
@@ -85,11 +124,127 @@ func NewGPUCollector(samplesPerWindow int) *GPUCollector {
 	collector.enabled = true
 	collector.devices = devices
 	collector.deviceModels = deviceModels
+	collector.computeCaps = computeCaps
+	collector.samples = newGPUSamples(len(devices), samplesPerWindow, window)
+	collector.startXIDMonitor()
 
 	log.Printf("GPU monitoring enabled: %d NVIDIA GPU(s) detected", len(devices))
 	return collector
 }
 
+// startXIDMonitor subscribes to XID critical error events on all devices
+// XID monitoring is best-effort: unsupported devices are skipped and failures only disable XID reporting
+func (gc *GPUCollector) startXIDMonitor() {
+	set, ret := nvml.EventSetCreate()
+	if ret != nvml.SUCCESS {
+		log.Printf("GPU XID monitoring disabled: failed to create event set (%v)", nvml.ErrorString(ret))
+		return
+	}
+
+	registered := 0
+	for i, device := range gc.devices {
+		if ret := device.RegisterEvents(nvml.EventTypeXidCriticalError, set); ret != nvml.SUCCESS {
+			log.Printf("GPU %d: XID events not available (%v)", i, nvml.ErrorString(ret))
+			continue
+		}
+		registered++
+	}
+	if registered == 0 {
+		set.Free()
+		return
+	}
+
+	gc.stopXID = make(chan struct{})
+	gc.xidDone = make(chan struct{})
+	go gc.watchXIDs(set, gc.stopXID, gc.xidDone)
+}
+
+// watchXIDs records XID events until stopped, then frees the event set
+func (gc *GPUCollector) watchXIDs(set nvml.EventSet, stop, done chan struct{}) {
+	defer close(done)
+	defer set.Free()
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		data, ret := set.Wait(1000)
+		if ret == nvml.ERROR_TIMEOUT {
+			continue
+		}
+		if ret != nvml.SUCCESS {
+			time.Sleep(time.Second)
+			continue
+		}
+		if data.EventType != nvml.EventTypeXidCriticalError {
+			continue
+		}
+
+		for i, device := range gc.devices {
+			if data.Device == device {
+				log.Printf("Warning: GPU %d reported XID %d", i, data.EventData)
+				gc.recordXID(i, data.EventData)
+				break
+			}
+		}
+	}
+}
+
+// recordXID remembers an XID error until the next stats report
+func (gc *GPUCollector) recordXID(deviceIndex int, xid uint64) {
+	gc.xidMu.Lock()
+	defer gc.xidMu.Unlock()
+	if gc.recentXIDs == nil {
+		gc.recentXIDs = make(map[int][]uint64)
+	}
+	gc.recentXIDs[deviceIndex] = append(gc.recentXIDs[deviceIndex], xid)
+}
+
+// pendingXIDs returns a copy of the XIDs not yet delivered in a report
+func (gc *GPUCollector) pendingXIDs() map[int][]uint64 {
+	gc.xidMu.Lock()
+	defer gc.xidMu.Unlock()
+	if len(gc.recentXIDs) == 0 {
+		return nil
+	}
+	xids := make(map[int][]uint64, len(gc.recentXIDs))
+	for idx, list := range gc.recentXIDs {
+		xids[idx] = append([]uint64(nil), list...)
+	}
+	return xids
+}
+
+// ackXIDs forgets the XIDs carried by a report once it was delivered (or spooled for delivery)
+// XIDs recorded after the report was built stay pending for the next one
+func (gc *GPUCollector) ackXIDs(reported []common.GPUStats) {
+	if gc == nil {
+		return
+	}
+	gc.xidMu.Lock()
+	defer gc.xidMu.Unlock()
+	for _, gpu := range reported {
+		pending := gc.recentXIDs[gpu.DeviceID]
+		if len(gpu.RecentXIDs) == 0 || len(pending) == 0 {
+			continue
+		}
+		if rest := pending[min(len(gpu.RecentXIDs), len(pending)):]; len(rest) > 0 {
+			gc.recentXIDs[gpu.DeviceID] = rest
+		} else {
+			delete(gc.recentXIDs, gpu.DeviceID)
+		}
+	}
+}
+
+// throttleState decodes NVML clock throttle reasons into thermal and power throttling
+func throttleState(reasons uint64) (thermal, power bool) {
+	thermal = reasons&(nvml.ClocksThrottleReasonSwThermalSlowdown|nvml.ClocksThrottleReasonHwThermalSlowdown) != 0
+	power = reasons&(nvml.ClocksThrottleReasonSwPowerCap|nvml.ClocksThrottleReasonHwPowerBrakeSlowdown) != 0
+	return thermal, power
+}
+
 // IsEnabled returns whether GPU monitoring is active
 func (gc *GPUCollector) IsEnabled() bool {
 	return gc.enabled
@@ -111,7 +266,15 @@ func (gc *GPUCollector) GetDeviceModels() []string {
 	return gc.deviceModels
 }
 
-// CollectSample collects current GPU metrics and stores in sample window
+// GetComputeCapabilities returns the CUDA compute capability of each GPU (0 = unknown)
+func (gc *GPUCollector) GetComputeCapabilities() []float64 {
+	if !gc.enabled {
+		return []float64{}
+	}
+	return gc.computeCaps
+}
+
+// CollectSample collects current GPU metrics and stores them in the sample rings
 func (gc *GPUCollector) CollectSample() error {
 	if !gc.enabled {
 		return nil
@@ -150,23 +313,60 @@ func (gc *GPUCollector) CollectSample() error {
 			powerW = float64(power) / 1000.0 // Convert milliwatts to watts
 		}
 
+		// Get ECC error counts (only on ECC-capable GPUs with ECC enabled)
+		eccCorrected, ret := device.GetTotalEccErrors(nvml.MEMORY_ERROR_TYPE_CORRECTED, nvml.VOLATILE_ECC)
+		if ret != nvml.SUCCESS {
+			eccCorrected = 0
+		}
+		eccUncorrected, ret := device.GetTotalEccErrors(nvml.MEMORY_ERROR_TYPE_UNCORRECTED, nvml.VOLATILE_ECC)
+		if ret != nvml.SUCCESS {
+			eccUncorrected = 0
+		}
+
+		// Get throttling state
+		thermalThrottling, powerThrottling := false, false
+		if reasons, ret := device.GetCurrentClocksThrottleReasons(); ret == nvml.SUCCESS {
+			thermalThrottling, powerThrottling = throttleState(reasons)
+		}
+
 		stats = append(stats, common.GPUStats{
-			DeviceID:       i,
-			Name:           gc.deviceModels[i],
-			UtilizationPct: gpuUtil,
-			MemoryUsedGB:   memUsedGB,
-			MemoryTotalGB:  memTotalGB,
-			TemperatureC:   tempC,
-			PowerDrawW:     powerW,
+			DeviceID:             i,
+			Name:                 gc.deviceModels[i],
+			UtilizationPct:       gpuUtil,
+			MemoryUsedGB:         memUsedGB,
+			MemoryTotalGB:        memTotalGB,
+			TemperatureC:         tempC,
+			PowerDrawW:           powerW,
+			ECCErrorsCorrected:   eccCorrected,
+			ECCErrorsUncorrected: eccUncorrected,
+			ThermalThrottling:    thermalThrottling,
+			PowerThrottling:      powerThrottling,
 		})
 	}
 
-	gc.sampleWindow[gc.sampleIndex] = stats
-	gc.sampleIndex = (gc.sampleIndex + 1) % gc.maxSamples
-
+	gc.recordSample(time.Now(), stats)
 	return nil
 }
 
+// recordSample adds one reading per device to the sample rings and keeps it as the latest sample
+func (gc *GPUCollector) recordSample(at time.Time, stats []common.GPUStats) {
+	for _, gpuStat := range stats {
+		if gpuStat.DeviceID < 0 || gpuStat.DeviceID >= len(gc.samples) {
+			continue
+		}
+		rings := gc.samples[gpuStat.DeviceID]
+		rings.utilization.AddAt(at, gpuStat.UtilizationPct)
+		rings.memoryUsed.AddAt(at, gpuStat.MemoryUsedGB)
+		rings.memoryTotal.AddAt(at, gpuStat.MemoryTotalGB)
+		rings.temperature.AddAt(at, gpuStat.TemperatureC)
+		rings.power.AddAt(at, gpuStat.PowerDrawW)
+	}
+
+	gc.latestMu.Lock()
+	gc.latest = stats
+	gc.latestMu.Unlock()
+}
+
 // CalculateAverages computes averaged GPU metrics over the sample window
 func (gc *GPUCollector) CalculateAverages() []common.GPUStats {
 	if !gc.enabled || len(gc.devices) == 0 {
@@ -175,43 +375,41 @@ func (gc *GPUCollector) CalculateAverages() []common.GPUStats {
 
 	numDevices := len(gc.devices)
 	averages := make([]common.GPUStats, numDevices)
-	counts := make([]int, numDevices)
+	now := time.Now()
 
-	// Initialize with device info
 	for i := 0; i < numDevices; i++ {
 		averages[i] = common.GPUStats{
 			DeviceID: i,
 			Name:     gc.deviceModels[i],
 		}
-	}
-
-	// Sum all samples
-	for _, sample := range gc.sampleWindow {
-		if len(sample) == 0 {
-			continue
+		if i < len(gc.samples) {
+			rings := gc.samples[i]
+			averages[i].UtilizationPct = rings.utilization.Mean(now)
+			averages[i].MemoryUsedGB = rings.memoryUsed.Mean(now)
+			averages[i].MemoryTotalGB = rings.memoryTotal.Mean(now)
+			averages[i].TemperatureC = rings.temperature.Mean(now)
+			averages[i].PowerDrawW = rings.power.Mean(now)
 		}
+	}
 
-		for _, gpuStat := range sample {
-			if gpuStat.DeviceID < numDevices {
-				idx := gpuStat.DeviceID
-				averages[idx].UtilizationPct += gpuStat.UtilizationPct
-				averages[idx].MemoryUsedGB += gpuStat.MemoryUsedGB
-				averages[idx].MemoryTotalGB += gpuStat.MemoryTotalGB
-				averages[idx].TemperatureC += gpuStat.TemperatureC
-				averages[idx].PowerDrawW += gpuStat.PowerDrawW
-				counts[idx]++
-			}
+	// ECC counters and throttling state are reported as of the latest sample, not averaged
+	gc.latestMu.Lock()
+	latest := gc.latest
+	gc.latestMu.Unlock()
+	for _, gpuStat := range latest {
+		if gpuStat.DeviceID >= 0 && gpuStat.DeviceID < numDevices {
+			idx := gpuStat.DeviceID
+			averages[idx].ECCErrorsCorrected = gpuStat.ECCErrorsCorrected
+			averages[idx].ECCErrorsUncorrected = gpuStat.ECCErrorsUncorrected
+			averages[idx].ThermalThrottling = gpuStat.ThermalThrottling
+			averages[idx].PowerThrottling = gpuStat.PowerThrottling
 		}
 	}
 
-	// Calculate averages
-	for i := 0; i < numDevices; i++ {
-		if counts[i] > 0 {
-			averages[i].UtilizationPct /= float64(counts[i])
-			averages[i].MemoryUsedGB /= float64(counts[i])
-			averages[i].MemoryTotalGB /= float64(counts[i])
-			averages[i].TemperatureC /= float64(counts[i])
-			averages[i].PowerDrawW /= float64(counts[i])
+	// XIDs are events: they stay pending until a report carrying them is acknowledged (ackXIDs)
+	for idx, xids := range gc.pendingXIDs() {
+		if idx < numDevices {
+			averages[idx].RecentXIDs = xids
 		}
 	}
 
@@ -220,6 +418,12 @@ func (gc *GPUCollector) CalculateAverages() []common.GPUStats {
 
 // Close shuts down NVML gracefully
 func (gc *GPUCollector) Close() {
+	// Stop the XID watcher before NVML shuts down (it wakes up at least once per second)
+	if gc.stopXID != nil {
+		close(gc.stopXID)
+		<-gc.xidDone
+		gc.stopXID = nil
+	}
 	if gc.enabled {
 		ret := nvml.Shutdown()
 		if ret != nvml.SUCCESS {
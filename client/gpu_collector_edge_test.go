@@ -2,46 +2,41 @@ package main
 
 import (
 	"testing"
+	"time"
 
 	"github.com/NVIDIA/go-nvml/pkg/nvml"
 	"cyqle.in/opsen/common"
 )
 
-// TestGPUCollector_SampleRotationEdgeCase tests that sample index wraps around correctly
+// TestGPUCollector_SampleRotationEdgeCase tests that only the newest samples are kept once the rings wrap
 func TestGPUCollector_SampleRotationEdgeCase(t *testing.T) {
 	// Create a collector with small sample window
 	gc := &GPUCollector{
 		enabled:      true,
+		devices:      make([]nvml.Device, 2),
 		deviceModels: []string{"GPU 0", "GPU 1"},
-		sampleWindow: make([][]common.GPUStats, 3), // maxSamples = 3
-		maxSamples:   3,
-		sampleIndex:  0,
+		samples:      newGPUSamples(2, 3, 0),
 	}
 
-	// Manually simulate adding samples (what CollectSample would do)
+	// Record more samples than the rings hold (what CollectSample would do)
 	for sampleNum := 0; sampleNum < 5; sampleNum++ {
-		// Create sample data
-		sample := []common.GPUStats{
+		gc.recordSample(time.Now(), []common.GPUStats{
 			{DeviceID: 0, UtilizationPct: float64(sampleNum * 10), MemoryUsedGB: float64(sampleNum)},
 			{DeviceID: 1, UtilizationPct: float64(sampleNum * 15), MemoryUsedGB: float64(sampleNum * 2)},
-		}
-
-		// Add to window
-		gc.sampleWindow[gc.sampleIndex] = sample
-		gc.sampleIndex = (gc.sampleIndex + 1) % gc.maxSamples
+		})
 	}
 
-	// Verify sampleIndex wrapped around correctly (5 % 3 = 2)
-	expectedIndex := 2
-	if gc.sampleIndex != expectedIndex {
-		t.Errorf("Expected sampleIndex=%d after 5 samples, got %d", expectedIndex, gc.sampleIndex)
+	for i, rings := range gc.samples {
+		if rings.utilization.Len() != 3 {
+			t.Errorf("Expected 3 samples kept for GPU %d, got %d", i, rings.utilization.Len())
+		}
 	}
 
-	// Verify all slots in window have data
-	for i := 0; i < gc.maxSamples; i++ {
-		if len(gc.sampleWindow[i]) != 2 {
-			t.Errorf("Expected 2 devices in sample window[%d], got %d", i, len(gc.sampleWindow[i]))
-		}
+	// Only samples 2-4 remain: GPU 0 (20+30+40)/3, GPU 1 (30+45+60)/3
+	averages := gc.CalculateAverages()
+	if averages[0].UtilizationPct != 30.0 || averages[1].UtilizationPct != 45.0 {
+		t.Errorf("Expected utilization 30.0%%/45.0%% over the newest samples, got %.1f%%/%.1f%%",
+			averages[0].UtilizationPct, averages[1].UtilizationPct)
 	}
 }
 
@@ -52,20 +47,19 @@ func TestGPUCollector_CalculateAverages_MismatchedDeviceID(t *testing.T) {
 		enabled:      true,
 		devices:      make([]nvml.Device, 2), // Zero-value devices for testing logic
 		deviceModels: []string{"GPU 0", "GPU 1"},
-		sampleWindow: make([][]common.GPUStats, 2),
-		maxSamples:   2,
+		samples:      newGPUSamples(2, 2, 0),
 	}
 
 	// Add sample with INVALID device ID (ID=5, but we only have 2 devices)
-	gc.sampleWindow[0] = []common.GPUStats{
+	gc.recordSample(time.Now(), []common.GPUStats{
 		{DeviceID: 0, UtilizationPct: 50.0, MemoryUsedGB: 1.0},
 		{DeviceID: 1, UtilizationPct: 60.0, MemoryUsedGB: 2.0},
 		{DeviceID: 5, UtilizationPct: 70.0, MemoryUsedGB: 3.0}, // Invalid!
-	}
-	gc.sampleWindow[1] = []common.GPUStats{
+	})
+	gc.recordSample(time.Now(), []common.GPUStats{
 		{DeviceID: 0, UtilizationPct: 55.0, MemoryUsedGB: 1.5},
 		{DeviceID: 1, UtilizationPct: 65.0, MemoryUsedGB: 2.5},
-	}
+	})
 
 	// Calculate averages - should skip invalid device ID
 	averages := gc.CalculateAverages()
@@ -101,21 +95,20 @@ func TestGPUCollector_CalculateAverages_MixedEmptySamples(t *testing.T) {
 		enabled:      true,
 		devices:      make([]nvml.Device, 2),
 		deviceModels: []string{"GPU 0", "GPU 1"},
-		sampleWindow: make([][]common.GPUStats, 4),
-		maxSamples:   4,
+		samples:      newGPUSamples(2, 4, 0),
 	}
 
 	// Mix of nil, empty, and populated samples
-	gc.sampleWindow[0] = []common.GPUStats{
+	gc.recordSample(time.Now(), []common.GPUStats{
 		{DeviceID: 0, UtilizationPct: 40.0, MemoryUsedGB: 2.0, TemperatureC: 60.0},
 		{DeviceID: 1, UtilizationPct: 50.0, MemoryUsedGB: 3.0, TemperatureC: 65.0},
-	}
-	gc.sampleWindow[1] = nil // nil sample
-	gc.sampleWindow[2] = []common.GPUStats{} // empty sample
-	gc.sampleWindow[3] = []common.GPUStats{
+	})
+	gc.recordSample(time.Now(), nil)                 // nil sample
+	gc.recordSample(time.Now(), []common.GPUStats{}) // empty sample
+	gc.recordSample(time.Now(), []common.GPUStats{
 		{DeviceID: 0, UtilizationPct: 60.0, MemoryUsedGB: 3.0, TemperatureC: 70.0},
 		{DeviceID: 1, UtilizationPct: 70.0, MemoryUsedGB: 4.0, TemperatureC: 75.0},
-	}
+	})
 
 	averages := gc.CalculateAverages()
 
@@ -148,12 +141,11 @@ func TestGPUCollector_CalculateAverages_SingleSample(t *testing.T) {
 		enabled:      true,
 		devices:      make([]nvml.Device, 1),
 		deviceModels: []string{"Tesla V100"},
-		sampleWindow: make([][]common.GPUStats, 3),
-		maxSamples:   3,
+		samples:      newGPUSamples(1, 3, 0),
 	}
 
-	// Only first slot has data
-	gc.sampleWindow[0] = []common.GPUStats{
+	// Only the first sample has data
+	gc.recordSample(time.Now(), []common.GPUStats{
 		{
 			DeviceID:       0,
 			Name:           "Tesla V100",
@@ -163,9 +155,9 @@ func TestGPUCollector_CalculateAverages_SingleSample(t *testing.T) {
 			TemperatureC:   82.0,
 			PowerDrawW:     250.0,
 		},
-	}
-	gc.sampleWindow[1] = nil
-	gc.sampleWindow[2] = nil
+	})
+	gc.recordSample(time.Now(), nil)
+	gc.recordSample(time.Now(), nil)
 
 	averages := gc.CalculateAverages()
 
@@ -198,14 +190,13 @@ func TestGPUCollector_CalculateAverages_AllEmptySamples(t *testing.T) {
 		enabled:      true,
 		devices:      make([]nvml.Device, 2),
 		deviceModels: []string{"GPU 0", "GPU 1"},
-		sampleWindow: make([][]common.GPUStats, 3),
-		maxSamples:   3,
+		samples:      newGPUSamples(2, 3, 0),
 	}
 
 	// All samples are nil or empty
-	gc.sampleWindow[0] = nil
-	gc.sampleWindow[1] = []common.GPUStats{}
-	gc.sampleWindow[2] = nil
+	gc.recordSample(time.Now(), nil)
+	gc.recordSample(time.Now(), []common.GPUStats{})
+	gc.recordSample(time.Now(), nil)
 
 	averages := gc.CalculateAverages()
 
@@ -229,20 +220,19 @@ func TestGPUCollector_CalculateAverages_PartialDeviceData(t *testing.T) {
 		enabled:      true,
 		devices:      make([]nvml.Device, 2),
 		deviceModels: []string{"GPU 0", "GPU 1"},
-		sampleWindow: make([][]common.GPUStats, 2),
-		maxSamples:   2,
+		samples:      newGPUSamples(2, 2, 0),
 	}
 
 	// First sample has both GPUs
-	gc.sampleWindow[0] = []common.GPUStats{
+	gc.recordSample(time.Now(), []common.GPUStats{
 		{DeviceID: 0, UtilizationPct: 40.0, MemoryUsedGB: 2.0},
 		{DeviceID: 1, UtilizationPct: 60.0, MemoryUsedGB: 4.0},
-	}
+	})
 
 	// Second sample only has GPU 0 (GPU 1 missing)
-	gc.sampleWindow[1] = []common.GPUStats{
+	gc.recordSample(time.Now(), []common.GPUStats{
 		{DeviceID: 0, UtilizationPct: 80.0, MemoryUsedGB: 3.0},
-	}
+	})
 
 	averages := gc.CalculateAverages()
 
@@ -274,15 +264,14 @@ func TestGPUCollector_CalculateAverages_PartialDeviceData(t *testing.T) {
 // TestGPUCollector_DisabledCollector tests that disabled collector returns empty results
 func TestGPUCollector_DisabledCollector(t *testing.T) {
 	gc := &GPUCollector{
-		enabled:      false, // Disabled
-		sampleWindow: make([][]common.GPUStats, 2),
-		maxSamples:   2,
+		enabled: false, // Disabled
+		samples: newGPUSamples(1, 2, 0),
 	}
 
 	// Add some data (shouldn't be used since disabled)
-	gc.sampleWindow[0] = []common.GPUStats{
+	gc.recordSample(time.Now(), []common.GPUStats{
 		{DeviceID: 0, UtilizationPct: 50.0},
-	}
+	})
 
 	averages := gc.CalculateAverages()
 
@@ -298,22 +287,21 @@ func TestGPUCollector_CalculateAverages_MultipleDevices(t *testing.T) {
 		enabled:      true,
 		devices:      make([]nvml.Device, 4), // 4 GPUs
 		deviceModels: []string{"GPU 0", "GPU 1", "GPU 2", "GPU 3"},
-		sampleWindow: make([][]common.GPUStats, 2),
-		maxSamples:   2,
+		samples:      newGPUSamples(4, 2, 0),
 	}
 
-	gc.sampleWindow[0] = []common.GPUStats{
+	gc.recordSample(time.Now(), []common.GPUStats{
 		{DeviceID: 0, UtilizationPct: 10.0},
 		{DeviceID: 1, UtilizationPct: 20.0},
 		{DeviceID: 2, UtilizationPct: 30.0},
 		{DeviceID: 3, UtilizationPct: 40.0},
-	}
-	gc.sampleWindow[1] = []common.GPUStats{
+	})
+	gc.recordSample(time.Now(), []common.GPUStats{
 		{DeviceID: 0, UtilizationPct: 50.0},
 		{DeviceID: 1, UtilizationPct: 60.0},
 		{DeviceID: 2, UtilizationPct: 70.0},
 		{DeviceID: 3, UtilizationPct: 80.0},
-	}
+	})
 
 	averages := gc.CalculateAverages()
 
@@ -330,4 +318,3 @@ func TestGPUCollector_CalculateAverages_MultipleDevices(t *testing.T) {
 		}
 	}
 }
-
@@ -2,6 +2,7 @@ package main
 
 import (
 	"testing"
+	"time"
 
 	"cyqle.in/opsen/common"
 )
@@ -9,20 +10,16 @@ import (
 // TestGPUCollector_NewGPUCollector_NoGPUs verifies collector initialization without GPUs
 func TestGPUCollector_NewGPUCollector_NoGPUs(t *testing.T) {
 	// This will typically create a disabled collector if no NVIDIA GPUs present
-	gc := NewGPUCollector(60)
+	gc := NewGPUCollector(60, 0)
 	defer gc.Close()
 
 	if gc == nil {
 		t.Fatal("NewGPUCollector should never return nil")
 	}
 
-	// Should have sample window initialized even if disabled
-	if gc.sampleWindow == nil {
-		t.Error("Sample window should be initialized")
-	}
-
-	if gc.maxSamples != 60 {
-		t.Errorf("Expected maxSamples 60, got %d", gc.maxSamples)
+	// Every detected GPU gets its own sample rings
+	if len(gc.samples) != gc.GetDeviceCount() {
+		t.Errorf("Expected sample rings for %d GPU(s), got %d", gc.GetDeviceCount(), len(gc.samples))
 	}
 
 	// Most systems won't have GPUs in CI
@@ -35,7 +32,7 @@ func TestGPUCollector_NewGPUCollector_NoGPUs(t *testing.T) {
 
 // TestGPUCollector_CollectSample_MultipleDevices verifies multi-GPU collection
 func TestGPUCollector_CollectSample_MultipleDevices(t *testing.T) {
-	gc := NewGPUCollector(3)
+	gc := NewGPUCollector(3, 0)
 	defer gc.Close()
 
 	if !gc.IsEnabled() {
@@ -51,16 +48,18 @@ func TestGPUCollector_CollectSample_MultipleDevices(t *testing.T) {
 		t.Fatalf("Failed to collect GPU sample: %v", err)
 	}
 
-	// Verify sample was stored
-	if len(gc.sampleWindow[0]) != deviceCount {
-		t.Errorf("Expected %d GPU stats, got %d", deviceCount, len(gc.sampleWindow[0]))
+	// Verify a sample was stored for every GPU
+	for i := 0; i < deviceCount; i++ {
+		if got := gc.samples[i].utilization.Len(); got != 1 {
+			t.Errorf("Expected 1 sample for GPU %d, got %d", i, got)
+		}
 	}
 }
 
 // TestGPUCollector_CalculateAverages_SingleDevice verifies single GPU averaging
 func TestGPUCollector_CalculateAverages_SingleDevice(t *testing.T) {
 	// Test with real GPU collector (will use actual or disabled collector)
-	gc := NewGPUCollector(3)
+	gc := NewGPUCollector(3, 0)
 	defer gc.Close()
 
 	if !gc.IsEnabled() || gc.GetDeviceCount() == 0 {
@@ -72,15 +71,15 @@ func TestGPUCollector_CalculateAverages_SingleDevice(t *testing.T) {
 	t.Logf("Testing with %d GPU(s), injecting test data for averaging", deviceCount)
 
 	// Add sample data (only for first GPU)
-	gc.sampleWindow[0] = []common.GPUStats{
+	gc.recordSample(time.Now(), []common.GPUStats{
 		{DeviceID: 0, Name: gc.deviceModels[0], UtilizationPct: 30.0, MemoryUsedGB: 5.0, MemoryTotalGB: 16.0, TemperatureC: 55.0, PowerDrawW: 80.0},
-	}
-	gc.sampleWindow[1] = []common.GPUStats{
+	})
+	gc.recordSample(time.Now(), []common.GPUStats{
 		{DeviceID: 0, Name: gc.deviceModels[0], UtilizationPct: 40.0, MemoryUsedGB: 6.0, MemoryTotalGB: 16.0, TemperatureC: 60.0, PowerDrawW: 90.0},
-	}
-	gc.sampleWindow[2] = []common.GPUStats{
+	})
+	gc.recordSample(time.Now(), []common.GPUStats{
 		{DeviceID: 0, Name: gc.deviceModels[0], UtilizationPct: 50.0, MemoryUsedGB: 7.0, MemoryTotalGB: 16.0, TemperatureC: 65.0, PowerDrawW: 100.0},
-	}
+	})
 
 	averages := gc.CalculateAverages()
 
@@ -120,8 +119,6 @@ func TestGPUCollector_CalculateAverages_SkipInvalidDeviceID(t *testing.T) {
 	gc := &GPUCollector{
 		enabled:      false,
 		deviceModels: []string{"GPU0", "GPU1"},
-		sampleWindow: make([][]common.GPUStats, 3),
-		maxSamples:   3,
 	}
 
 	// CalculateAverages returns empty for disabled collector
@@ -138,8 +135,6 @@ func TestGPUCollector_CalculateAverages_MixedSamples(t *testing.T) {
 	gc := &GPUCollector{
 		enabled:      false,
 		deviceModels: []string{},
-		sampleWindow: make([][]common.GPUStats, 4),
-		maxSamples:   4,
 	}
 
 	// Disabled collector returns empty
@@ -152,7 +147,7 @@ func TestGPUCollector_CalculateAverages_MixedSamples(t *testing.T) {
 
 // TestGPUCollector_Close_Enabled verifies closing enabled collector
 func TestGPUCollector_Close_Enabled(t *testing.T) {
-	gc := NewGPUCollector(3)
+	gc := NewGPUCollector(3, 0)
 
 	// Should not panic regardless of enabled state
 	gc.Close()
@@ -166,7 +161,7 @@ func TestGPUCollector_Close_Enabled(t *testing.T) {
 
 // TestGPUCollector_GetInstantMetrics_WithDevices verifies instant metrics retrieval
 func TestGPUCollector_GetInstantMetrics_WithDevices(t *testing.T) {
-	gc := NewGPUCollector(3)
+	gc := NewGPUCollector(3, 0)
 	defer gc.Close()
 
 	if !gc.IsEnabled() {
@@ -199,34 +194,26 @@ func TestGPUCollector_GetInstantMetrics_WithDevices(t *testing.T) {
 	}
 }
 
-// TestGPUCollector_SampleRotation verifies sample window rotation
+// TestGPUCollector_SampleRotation verifies the sample rings keep only the newest samples
 func TestGPUCollector_SampleRotation(t *testing.T) {
 	// Use disabled collector (no NVML required)
 	gc := &GPUCollector{
 		enabled:      false,
 		deviceModels: []string{"Test GPU"},
-		sampleWindow: make([][]common.GPUStats, 3),
-		maxSamples:   3,
-		sampleIndex:  0,
+		samples:      newGPUSamples(1, 3, 0),
 	}
 
 	// Collect more samples than window size
 	for i := 0; i < 5; i++ {
-		gc.sampleWindow[gc.sampleIndex] = []common.GPUStats{
+		gc.recordSample(time.Now(), []common.GPUStats{
 			{DeviceID: 0, UtilizationPct: float64(i * 10)},
-		}
-		gc.sampleIndex = (gc.sampleIndex + 1) % gc.maxSamples
-	}
-
-	// After 5 samples, index should be at 2 (5 % 3)
-	if gc.sampleIndex != 2 {
-		t.Errorf("Expected sampleIndex 2, got %d", gc.sampleIndex)
+		})
 	}
 
 	// Window should contain samples 2, 3, 4 (overwritten 0, 1)
-	// Sample at index 0 should be from iteration 3
-	if gc.sampleWindow[0][0].UtilizationPct != 30.0 {
-		t.Logf("Sample 0 util: %.1f", gc.sampleWindow[0][0].UtilizationPct)
+	values := gc.samples[0].utilization.Values(time.Now())
+	if len(values) != 3 || values[0] != 20.0 || values[2] != 40.0 {
+		t.Errorf("Expected utilization samples [20 30 40], got %v", values)
 	}
 }
 
@@ -236,8 +223,6 @@ func TestGPUCollector_ZeroSamples(t *testing.T) {
 	gc := &GPUCollector{
 		enabled:      false,
 		deviceModels: []string{},
-		sampleWindow: make([][]common.GPUStats, 3),
-		maxSamples:   3,
 	}
 
 	// No samples collected - should return empty for disabled collector
@@ -295,7 +280,7 @@ func TestGPUCollector_DeviceCount_Zero(t *testing.T) {
 
 // TestGPUCollector_RealHardware_Integration verifies real GPU hardware if available
 func TestGPUCollector_RealHardware_Integration(t *testing.T) {
-	gc := NewGPUCollector(5)
+	gc := NewGPUCollector(5, 0)
 	defer gc.Close()
 
 	if !gc.IsEnabled() {
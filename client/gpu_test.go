@@ -2,8 +2,10 @@ package main
 
 import (
 	"testing"
+	"time"
 
 	"cyqle.in/opsen/common"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
 )
 
 // TestGPUCollector_CalculateAverages verifies GPU metrics averaging
@@ -11,30 +13,29 @@ func TestGPUCollector_CalculateAverages(t *testing.T) {
 	// Note: Cannot fully test without real NVML devices due to len(gc.devices) check
 	// However, we can test the averaging logic by using the real NewGPUCollector
 	// which will create a disabled collector if no GPUs are present
-	gc := NewGPUCollector(3)
+	gc := NewGPUCollector(3, 0)
 
 	if !gc.IsEnabled() {
 		t.Skip("No GPUs available for testing, testing with mock data")
 	}
 
 	// If GPUs are available, this test will exercise the real code path
-	gc.sampleWindow = make([][]common.GPUStats, 3)
-	gc.maxSamples = 3
+	gc.samples = newGPUSamples(2, 3, 0)
 	gc.deviceModels = []string{"Test GPU 0", "Test GPU 1"}
 
 	// Add sample data
-	gc.sampleWindow[0] = []common.GPUStats{
+	gc.recordSample(time.Now(), []common.GPUStats{
 		{DeviceID: 0, UtilizationPct: 50.0, MemoryUsedGB: 4.0, MemoryTotalGB: 8.0, TemperatureC: 60.0, PowerDrawW: 100.0},
 		{DeviceID: 1, UtilizationPct: 30.0, MemoryUsedGB: 2.0, MemoryTotalGB: 8.0, TemperatureC: 55.0, PowerDrawW: 80.0},
-	}
-	gc.sampleWindow[1] = []common.GPUStats{
+	})
+	gc.recordSample(time.Now(), []common.GPUStats{
 		{DeviceID: 0, UtilizationPct: 60.0, MemoryUsedGB: 5.0, MemoryTotalGB: 8.0, TemperatureC: 65.0, PowerDrawW: 110.0},
 		{DeviceID: 1, UtilizationPct: 40.0, MemoryUsedGB: 3.0, MemoryTotalGB: 8.0, TemperatureC: 60.0, PowerDrawW: 90.0},
-	}
-	gc.sampleWindow[2] = []common.GPUStats{
+	})
+	gc.recordSample(time.Now(), []common.GPUStats{
 		{DeviceID: 0, UtilizationPct: 70.0, MemoryUsedGB: 6.0, MemoryTotalGB: 8.0, TemperatureC: 70.0, PowerDrawW: 120.0},
 		{DeviceID: 1, UtilizationPct: 50.0, MemoryUsedGB: 4.0, MemoryTotalGB: 8.0, TemperatureC: 65.0, PowerDrawW: 100.0},
-	}
+	})
 
 	averages := gc.CalculateAverages()
 
@@ -72,9 +73,7 @@ func TestGPUCollector_CalculateAverages(t *testing.T) {
 func TestGPUCollector_CalculateAverages_EmptySamples(t *testing.T) {
 	// Test with disabled collector (safe, no NVML required)
 	gc := &GPUCollector{
-		enabled:      false,
-		sampleWindow: make([][]common.GPUStats, 3),
-		maxSamples:   3,
+		enabled: false,
 	}
 
 	// No sample data added - should return empty
@@ -109,7 +108,6 @@ func TestGPUCollector_CalculateAverages_NoDevices(t *testing.T) {
 	gc := &GPUCollector{
 		enabled:      true,
 		deviceModels: []string{}, // Empty devices
-		sampleWindow: make([][]common.GPUStats, 3),
 	}
 
 	averages := gc.CalculateAverages()
@@ -236,3 +234,65 @@ func TestGPUCollector_CollectSample_Disabled(t *testing.T) {
 		t.Errorf("Expected no error for disabled collector, got: %v", err)
 	}
 }
+
+// TestThrottleState verifies NVML throttle reason bits map to thermal and power throttling
+func TestThrottleState(t *testing.T) {
+	tests := []struct {
+		reasons uint64
+		thermal bool
+		power   bool
+	}{
+		{0, false, false},
+		{nvml.ClocksThrottleReasonGpuIdle, false, false},
+		{nvml.ClocksThrottleReasonHwThermalSlowdown, true, false},
+		{nvml.ClocksThrottleReasonSwPowerCap, false, true},
+		{nvml.ClocksThrottleReasonSwThermalSlowdown | nvml.ClocksThrottleReasonHwPowerBrakeSlowdown, true, true},
+	}
+
+	for _, tt := range tests {
+		thermal, power := throttleState(tt.reasons)
+		if thermal != tt.thermal || power != tt.power {
+			t.Errorf("Reasons %#x: expected thermal=%v power=%v, got thermal=%v power=%v",
+				tt.reasons, tt.thermal, tt.power, thermal, power)
+		}
+	}
+}
+
+// TestGPUCollector_CalculateAverages_Health verifies ECC and throttling come from the latest sample and XIDs stay
+// pending until a report carrying them is delivered
+func TestGPUCollector_CalculateAverages_Health(t *testing.T) {
+	gc := &GPUCollector{
+		enabled:      true,
+		devices:      make([]nvml.Device, 2),
+		deviceModels: []string{"GPU-A", "GPU-B"},
+		samples:      newGPUSamples(2, 3, 0),
+	}
+	gc.recordSample(time.Now(), []common.GPUStats{{DeviceID: 0, ECCErrorsUncorrected: 1, ThermalThrottling: true}, {DeviceID: 1}})
+	gc.recordSample(time.Now(), []common.GPUStats{{DeviceID: 0, ECCErrorsUncorrected: 2}, {DeviceID: 1, PowerThrottling: true}})
+	gc.recordXID(1, 79)
+
+	averages := gc.CalculateAverages()
+	if averages[0].ECCErrorsUncorrected != 2 || averages[0].ThermalThrottling {
+		t.Errorf("Expected latest ECC count 2 without throttling on GPU 0, got %+v", averages[0])
+	}
+	if !averages[1].PowerThrottling {
+		t.Error("Expected power throttling on GPU 1")
+	}
+	if len(averages[1].RecentXIDs) != 1 || averages[1].RecentXIDs[0] != 79 {
+		t.Errorf("Expected XID 79 on GPU 1, got %v", averages[1].RecentXIDs)
+	}
+
+	// Until a report carrying them is delivered, XIDs stay pending
+	gc.recordXID(1, 48)
+	again := gc.CalculateAverages()
+	if len(again[1].RecentXIDs) != 2 {
+		t.Fatalf("Expected undelivered XIDs to be carried over, got %v", again[1].RecentXIDs)
+	}
+
+	// XIDs recorded after the delivered report was built are kept for the next one
+	gc.recordXID(1, 31)
+	gc.ackXIDs(again)
+	if next := gc.CalculateAverages(); len(next[1].RecentXIDs) != 1 || next[1].RecentXIDs[0] != 31 {
+		t.Errorf("Expected only XID 31 after the report was delivered, got %v", next[1].RecentXIDs)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// Workload runtimes the inventory can enumerate (inventory.runtime)
+const (
+	InventoryRuntimeDocker  = "docker"
+	InventoryRuntimeLibvirt = "libvirt"
+)
+
+// inventoryTimeout bounds one enumeration, so a hung runtime never delays a stats report for long
+const inventoryTimeout = 5 * time.Second
+
+// runVirsh runs virsh and returns its stdout (replaced in tests)
+var runVirsh = func(ctx context.Context, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "virsh", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil && stderr.Len() > 0 {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, err
+}
+
+// InventoryCollector enumerates the containers or VMs on the host every refresh_seconds
+// Enumeration runs at most once per refresh, so reports in between carry the cached inventory
+type InventoryCollector struct {
+	config common.InventoryConfig
+	docker *http.Client
+
+	mu          sync.Mutex
+	last        *common.InventoryStats
+	lastErrText string // Last enumeration error that was logged, so a broken runtime warns once
+}
+
+// validateInventory checks the inventory settings before the first report
+func validateInventory(cfg common.InventoryConfig) error {
+	switch cfg.Runtime {
+	case InventoryRuntimeDocker, InventoryRuntimeLibvirt:
+	default:
+		return fmt.Errorf("inventory.runtime must be %s or %s, got %q", InventoryRuntimeDocker, InventoryRuntimeLibvirt, cfg.Runtime)
+	}
+	if cfg.RefreshSecs <= 0 || cfg.MaxWorkloads < 0 {
+		return fmt.Errorf("inventory.refresh_seconds must be positive and inventory.max_workloads must not be negative")
+	}
+	return nil
+}
+
+// NewInventoryCollector creates a collector, or returns nil if the inventory is disabled
+func NewInventoryCollector(cfg common.InventoryConfig) *InventoryCollector {
+	if !cfg.Enabled {
+		return nil
+	}
+	socket := cfg.DockerSocket
+	return &InventoryCollector{
+		config: cfg,
+		docker: &http.Client{
+			Timeout: inventoryTimeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// Read returns the host's inventory, re-enumerating it once the cached one is older than refresh_seconds
+// Enumeration failures are reported in the inventory's error field rather than dropping it
+// Safe to call on a nil collector
+func (ic *InventoryCollector) Read() *common.InventoryStats {
+	if ic == nil {
+		return nil
+	}
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	now := time.Now()
+	if ic.last != nil && now.Sub(ic.last.CollectedAt) < time.Duration(ic.config.RefreshSecs)*time.Second {
+		return ic.last
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), inventoryTimeout)
+	defer cancel()
+
+	var workloads []common.WorkloadInfo
+	var err error
+	if ic.config.Runtime == InventoryRuntimeLibvirt {
+		workloads, err = listLibvirtDomains(ctx, ic.config.LibvirtURI)
+	} else {
+		workloads, err = ic.listDockerContainers(ctx)
+	}
+
+	inventory := summarizeInventory(ic.config.Runtime, workloads, ic.config.MaxWorkloads)
+	inventory.CollectedAt = now.UTC()
+	if err != nil {
+		inventory.Error = err.Error()
+		if inventory.Error != ic.lastErrText {
+			LogWarnWithData("Failed to enumerate workloads for inventory", map[string]interface{}{
+				"runtime": ic.config.Runtime,
+				"error":   inventory.Error,
+			})
+		}
+	}
+	ic.lastErrText = inventory.Error
+	ic.last = inventory
+	return inventory
+}
+
+// summarizeInventory totals the limits of running workloads and keeps up to maxWorkloads of them, running first
+func summarizeInventory(runtime string, workloads []common.WorkloadInfo, maxWorkloads int) *common.InventoryStats {
+	inventory := &common.InventoryStats{Runtime: runtime, Total: len(workloads)}
+	for _, workload := range workloads {
+		if !isRunningWorkload(workload.State) {
+			continue
+		}
+		inventory.Running++
+		inventory.VCPULimit += workload.VCPU
+		inventory.MemoryLimitGB += workload.MemoryGB
+		if workload.VCPU == 0 || workload.MemoryGB == 0 {
+			inventory.Unlimited++
+		}
+	}
+
+	sort.SliceStable(workloads, func(i, j int) bool {
+		ri, rj := isRunningWorkload(workloads[i].State), isRunningWorkload(workloads[j].State)
+		if ri != rj {
+			return ri
+		}
+		return workloads[i].Name < workloads[j].Name
+	})
+	if len(workloads) > maxWorkloads {
+		workloads = workloads[:maxWorkloads]
+		inventory.Truncated = true
+	}
+	if len(workloads) > 0 {
+		inventory.Workloads = workloads
+	}
+	return inventory
+}
+
+func isRunningWorkload(state string) bool {
+	return state == "running"
+}
+
+// dockerContainer is the part of a GET /containers/json entry the inventory uses
+type dockerContainer struct {
+	ID    string   `json:"Id"`
+	Names []string `json:"Names"`
+	Image string   `json:"Image"`
+	State string   `json:"State"`
+}
+
+// dockerInspect is the part of GET /containers/{id}/json holding resource limits
+type dockerInspect struct {
+	HostConfig struct {
+		NanoCPUs  int64 `json:"NanoCpus"`
+		CPUQuota  int64 `json:"CpuQuota"`
+		CPUPeriod int64 `json:"CpuPeriod"`
+		Memory    int64 `json:"Memory"`
+	} `json:"HostConfig"`
+}
+
+// listDockerContainers lists all containers through the Docker Engine API, with the limits of running ones
+func (ic *InventoryCollector) listDockerContainers(ctx context.Context) ([]common.WorkloadInfo, error) {
+	var containers []dockerContainer
+	if err := ic.dockerGet(ctx, "/containers/json?all=1", &containers); err != nil {
+		return nil, err
+	}
+
+	workloads := make([]common.WorkloadInfo, 0, len(containers))
+	for _, container := range containers {
+		workload := common.WorkloadInfo{
+			Name:  strings.TrimPrefix(firstOr(container.Names, container.ID), "/"),
+			Image: container.Image,
+			State: container.State,
+		}
+		if isRunningWorkload(container.State) {
+			var inspect dockerInspect
+			if err := ic.dockerGet(ctx, "/containers/"+url.PathEscape(container.ID)+"/json", &inspect); err != nil {
+				return nil, err
+			}
+			limits := inspect.HostConfig
+			switch {
+			case limits.NanoCPUs > 0:
+				workload.VCPU = float64(limits.NanoCPUs) / 1e9
+			case limits.CPUQuota > 0 && limits.CPUPeriod > 0:
+				workload.VCPU = float64(limits.CPUQuota) / float64(limits.CPUPeriod)
+			}
+			workload.MemoryGB = float64(limits.Memory) / 1024 / 1024 / 1024
+		}
+		workloads = append(workloads, workload)
+	}
+	return workloads, nil
+}
+
+func (ic *InventoryCollector) dockerGet(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := ic.docker.Do(req)
+	if err != nil {
+		return fmt.Errorf("docker: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("docker: GET %s returned %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func firstOr(values []string, fallback string) string {
+	if len(values) > 0 {
+		return values[0]
+	}
+	return fallback
+}
+
+// listLibvirtDomains lists all domains with virsh, with the vCPUs and memory of each
+func listLibvirtDomains(ctx context.Context, uri string) ([]common.WorkloadInfo, error) {
+	out, err := runVirsh(ctx, "-c", uri, "list", "--all", "--name")
+	if err != nil {
+		return nil, fmt.Errorf("virsh list: %w", err)
+	}
+
+	var workloads []common.WorkloadInfo
+	for _, name := range strings.Fields(string(out)) {
+		info, err := runVirsh(ctx, "-c", uri, "dominfo", name)
+		if err != nil {
+			return nil, fmt.Errorf("virsh dominfo %s: %w", name, err)
+		}
+		workloads = append(workloads, parseDominfo(name, info))
+	}
+	return workloads, nil
+}
+
+// parseDominfo reads the state, vCPUs and maximum memory from virsh dominfo output
+func parseDominfo(name string, info []byte) common.WorkloadInfo {
+	workload := common.WorkloadInfo{Name: name}
+	scanner := bufio.NewScanner(bytes.NewReader(info))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "State":
+			workload.State = value
+		case "CPU(s)":
+			if vcpus, err := strconv.Atoi(value); err == nil {
+				workload.VCPU = float64(vcpus)
+			}
+		case "Max memory":
+			// "4194304 KiB"
+			if kib, err := strconv.ParseFloat(strings.TrimSuffix(value, " KiB"), 64); err == nil {
+				workload.MemoryGB = kib / 1024 / 1024
+			}
+		}
+	}
+	return workload
+}
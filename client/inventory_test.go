@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestInventoryCollector_Docker verifies containers are listed through the Docker socket with the limits of running ones
+func TestInventoryCollector_Docker(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("Unix sockets unavailable: %v", err)
+	}
+	inspects := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"Id": "c1", "Names": []string{"/web"}, "Image": "nginx:1.27", "State": "running"},
+			{"Id": "c2", "Names": []string{"/worker"}, "Image": "worker:2", "State": "running"},
+			{"Id": "c3", "Names": []string{"/migrate"}, "Image": "tools:1", "State": "exited"},
+		})
+	})
+	mux.HandleFunc("/containers/", func(w http.ResponseWriter, r *http.Request) {
+		inspects++
+		limits := map[string]interface{}{}
+		if strings.Contains(r.URL.Path, "/c1/") {
+			limits = map[string]interface{}{"NanoCpus": 1500000000, "Memory": 2 << 30}
+		} else if strings.Contains(r.URL.Path, "/c2/") {
+			limits = map[string]interface{}{"CpuQuota": 50000, "CpuPeriod": 100000}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"HostConfig": limits})
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Close()
+
+	collector := NewInventoryCollector(common.InventoryConfig{
+		Enabled: true, Runtime: InventoryRuntimeDocker, DockerSocket: socket, RefreshSecs: 60, MaxWorkloads: 50,
+	})
+	inventory := collector.Read()
+	if inventory == nil || inventory.Error != "" {
+		t.Fatalf("Expected an inventory, got %+v", inventory)
+	}
+	if inventory.Total != 3 || inventory.Running != 2 || inventory.VCPULimit != 2 || inventory.MemoryLimitGB != 2 {
+		t.Errorf("Expected 2 of 3 containers running with 2 vCPU and 2GB of limits, got %+v", inventory)
+	}
+	if inventory.Unlimited != 1 {
+		t.Errorf("Expected the worker without a memory limit to be counted, got %d", inventory.Unlimited)
+	}
+	if len(inventory.Workloads) != 3 || inventory.Workloads[0].Name != "web" || inventory.Workloads[2].State != "exited" {
+		t.Errorf("Expected running containers listed first, got %+v", inventory.Workloads)
+	}
+	if inspects != 2 {
+		t.Errorf("Expected only running containers to be inspected, got %d inspections", inspects)
+	}
+
+	// Reports within refresh_seconds reuse the inventory
+	collector.Read()
+	if inspects != 2 {
+		t.Errorf("Expected the cached inventory to be reused, got %d inspections", inspects)
+	}
+}
+
+// TestInventoryCollector_Libvirt verifies domains are enumerated with virsh and their vCPUs and memory parsed
+func TestInventoryCollector_Libvirt(t *testing.T) {
+	original := runVirsh
+	defer func() { runVirsh = original }()
+	runVirsh = func(ctx context.Context, args ...string) ([]byte, error) {
+		switch {
+		case strings.Join(args, " ") == "-c qemu:///system list --all --name":
+			return []byte("db-vm\nbuild-vm\n\n"), nil
+		case args[len(args)-1] == "db-vm":
+			return []byte("Id:             1\nName:           db-vm\nState:          running\nCPU(s):         4\nMax memory:     8388608 KiB\n"), nil
+		case args[len(args)-1] == "build-vm":
+			return []byte("Id:             -\nName:           build-vm\nState:          shut off\nCPU(s):         2\nMax memory:     2097152 KiB\n"), nil
+		}
+		return nil, fmt.Errorf("unexpected virsh call: %v", args)
+	}
+
+	collector := NewInventoryCollector(common.InventoryConfig{
+		Enabled: true, Runtime: InventoryRuntimeLibvirt, LibvirtURI: "qemu:///system", RefreshSecs: 60, MaxWorkloads: 1,
+	})
+	inventory := collector.Read()
+	if inventory.Error != "" || inventory.Total != 2 || inventory.Running != 1 || inventory.VCPULimit != 4 || inventory.MemoryLimitGB != 8 {
+		t.Errorf("Expected one running 4 vCPU/8GB domain of two, got %+v", inventory)
+	}
+	if len(inventory.Workloads) != 1 || inventory.Workloads[0].Name != "db-vm" || !inventory.Truncated {
+		t.Errorf("Expected max_workloads to keep only the running domain, got %+v", inventory.Workloads)
+	}
+}
+
+// TestInventoryCollector_Unavailable verifies an unreachable runtime is reported instead of dropping the inventory
+func TestInventoryCollector_Unavailable(t *testing.T) {
+	collector := NewInventoryCollector(common.InventoryConfig{
+		Enabled: true, Runtime: InventoryRuntimeDocker, DockerSocket: filepath.Join(t.TempDir(), "missing.sock"), RefreshSecs: 60,
+	})
+	inventory := collector.Read()
+	if inventory == nil || inventory.Error == "" || inventory.Total != 0 {
+		t.Errorf("Expected an empty inventory with an error, got %+v", inventory)
+	}
+
+	if NewInventoryCollector(common.InventoryConfig{}).Read() != nil {
+		t.Error("Expected no inventory when disabled")
+	}
+	if err := validateInventory(common.InventoryConfig{Runtime: "podman", RefreshSecs: 60}); err == nil {
+		t.Error("Expected an unknown runtime to be rejected")
+	}
+}
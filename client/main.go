@@ -2,8 +2,8 @@ package main
 
 import (
 	"bytes"
-	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -11,42 +11,84 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/oschwald/geoip2-golang"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
 	"github.com/shirou/gopsutil/v3/mem"
 	"cyqle.in/opsen/common"
 )
 
 type Config struct {
 	ServerURL       string
+	ServerURLs      []string
+	ServerSRV       string
+	ServerSRVScheme string
 	ClientID        string
 	Hostname        string
 	WindowMinutes   int
+	ShortWindowSecs int
 	ReportInterval  int
 	DiskPath        string
 	EndpointURL     string
+	EndpointProtocol string
+	EndpointPort    int
+	DisableIPv6     bool
 	Endpoints       []common.EndpointConfig
 	GeoIPDBPath     string
 	SkipGeolocation bool
 	InsecureTLS     bool
 	ServerKey       string
+	AuthMode        string
+	HourlyCost      float64
+	Tenant          string
+	Pool            string
+	ServiceVersion  string
+	Labels          map[string]string
+	ApprovalToken   string
+	CompressRequests bool
+	StatsDelta      bool
+	StatsFullEvery  int
+	BandwidthTest   common.BandwidthTestConfig
+	Inventory       common.InventoryConfig
+	ProbeStatsListen string
+	ProbeStatsURL   string
 }
 
 type MetricsCollector struct {
 	config          Config
 	httpClient      *http.Client
-	cpuSamples      [][]float64 // [sample_index][core_index]
-	memorySamples   []float64
-	diskSamples     []float64
-	gpuCollector    *GPUCollector // GPU metrics collector
-	sampleIndex     int
-	maxSamples      int
+	cpuSamples      *CoreSampleRing // Per-core CPU usage over the window
+	memorySamples   *SampleRing     // Memory used (GB) over the window
+	diskSamples     *SampleRing     // Disk used (GB) over the window
+	gpuCollector    *GPUCollector   // GPU metrics collector
+	thermal         *ThermalCollector // CPU temperature, fan and power telemetry (nil = not collected)
+	diskIO          *DiskIOCollector  // Block device throughput, IOPS and queue depth (nil = not collected)
+	inventory       *InventoryCollector // Containers or VMs on the host (nil = not collected)
+	probeStats      *ProbeStats // Latest report served to a restarted server (nil = probe_stats_listen unset)
 	circuitBreaker  *CircuitBreaker
 	retryConfig     RetryConfig
+	servers         *ServerPool // Failover pool (nil = single server_url)
+	spool           *StatsSpool // Undelivered reports awaiting replay (nil = spooling disabled)
+	errorReports    *ErrorReporter // Error events awaiting the next report to the server
+	registeredURL   string      // Server that accepted the latest registration
+
+	reachabilityMu sync.Mutex
+	reachability   []common.EndpointReachability // Latest probe-back result, sent with stats
+
+	// Delta stats encoding state (only touched by the reporting loop)
+	instanceID     string                     // Random ID of this agent process, sent with registrations and stats
+	statsSeq       uint64                     // Sequence number of the latest report
+	deltaBase      map[string]json.RawMessage // Fields of the last report the server accepted
+	deltaBaseSeq   uint64                     // Sequence number of deltaBase
+	deltaSupported bool                       // Server advertised delta support in its last /stats response
+	deltasSinceFull int                       // Delta reports sent since the last full snapshot
 }
 
 func main() {
@@ -56,10 +98,19 @@ func main() {
 	reportInterval := flag.Int("interval", 0, "Report interval in seconds")
 	diskPath := flag.String("disk", "", "Disk path to monitor")
 	clientID := flag.String("id", "", "Client ID (auto-generated if empty)")
+	showVersion := flag.Bool("version", false, "Print version and exit")
+	probeMode := flag.Bool("probe", false, "Run as a vantage probe that only measures backend latency")
+	profile := flag.String("profile", "", "Configuration profile(s) to apply, comma-separated (overrides the file's profile key)")
+	printEffectiveConfig := flag.Bool("print-effective-config", false, "Print the merged configuration (includes, profile and flags applied) and exit")
 	flag.Parse()
 
+	if *showVersion {
+		fmt.Println(Version)
+		return
+	}
+
 	// Load configuration from YAML file
-	yamlConfig, err := common.LoadClientConfig(*configFile)
+	yamlConfig, err := common.LoadClientConfigProfile(*configFile, *profile)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
@@ -67,6 +118,8 @@ func main() {
 	// Override with command-line flags if provided
 	if *serverURL != "" {
 		yamlConfig.ServerURL = *serverURL
+		yamlConfig.ServerURLs = nil
+		yamlConfig.ServerSRV = ""
 	}
 	if *windowMinutes > 0 {
 		yamlConfig.WindowMinutes = *windowMinutes
@@ -80,6 +133,18 @@ func main() {
 	if *clientID != "" {
 		yamlConfig.ClientID = *clientID
 	}
+	if *probeMode {
+		yamlConfig.VantageProbe.Enabled = true
+	}
+
+	if *printEffectiveConfig {
+		out, err := common.EffectiveConfigYAML(yamlConfig)
+		if err != nil {
+			log.Fatalf("Failed to render config: %v", err)
+		}
+		os.Stdout.Write(out)
+		return
+	}
 
 	// Auto-generate client ID if not set
 	if yamlConfig.ClientID == "" {
@@ -97,30 +162,55 @@ func main() {
 
 	config := Config{
 		ServerURL:       yamlConfig.ServerURL,
+		ServerURLs:      yamlConfig.ServerURLs,
+		ServerSRV:       yamlConfig.ServerSRV,
+		ServerSRVScheme: yamlConfig.ServerSRVScheme,
 		ClientID:        yamlConfig.ClientID,
 		Hostname:        hostname,
 		WindowMinutes:   yamlConfig.WindowMinutes,
+		ShortWindowSecs: yamlConfig.ShortWindowSecs,
 		ReportInterval:  yamlConfig.ReportInterval,
 		DiskPath:        yamlConfig.DiskPath,
 		EndpointURL:     yamlConfig.EndpointURL,
+		EndpointProtocol: yamlConfig.EndpointProtocol,
+		EndpointPort:    yamlConfig.EndpointPort,
+		DisableIPv6:     yamlConfig.DisableIPv6,
 		Endpoints:       yamlConfig.Endpoints,
 		GeoIPDBPath:     yamlConfig.GeoIPDBPath,
 		SkipGeolocation: yamlConfig.SkipGeolocation,
 		InsecureTLS:     yamlConfig.InsecureTLS,
 		ServerKey:       yamlConfig.ServerKey,
-	}
-
-	// Create HTTP client with TLS configuration
-	httpClient := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+		AuthMode:        yamlConfig.AuthMode,
+		HourlyCost:      yamlConfig.HourlyCost,
+		Tenant:          yamlConfig.Tenant,
+		Pool:            yamlConfig.Pool,
+		ServiceVersion:  yamlConfig.ServiceVersion,
+		Labels:          yamlConfig.Labels,
+		ApprovalToken:   yamlConfig.ApprovalToken,
+		CompressRequests: yamlConfig.CompressRequests,
+		StatsDelta:      yamlConfig.StatsDelta,
+		StatsFullEvery:  yamlConfig.StatsFullEvery,
+		BandwidthTest:   yamlConfig.BandwidthTest,
+		Inventory:       yamlConfig.Inventory,
+		ProbeStatsListen: yamlConfig.ProbeStatsListen,
+		ProbeStatsURL:   yamlConfig.ProbeStatsURL,
+	}
+
+	if err := validateAuthMode(config); err != nil {
+		log.Fatalf("Invalid auth configuration: %v", err)
+	}
+
+	// Create HTTP client with proxy and TLS configuration
 	if config.InsecureTLS {
 		log.Printf("Warning: TLS certificate verification disabled (insecure_tls: true)")
-		httpClient.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-		}
+	}
+	transport, err := newOutboundTransport(*yamlConfig)
+	if err != nil {
+		log.Fatalf("Invalid outbound connection configuration: %v", err)
+	}
+	httpClient := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: transport,
 	}
 
 	// Initialize logger
@@ -129,26 +219,98 @@ func main() {
 
 	// Calculate samples per window (1 sample per second)
 	samplesPerWindow := config.WindowMinutes * 60
+	window := time.Duration(config.WindowMinutes) * time.Minute
 
 	// Create circuit breaker (max 5 failures, 30 second reset timeout)
 	circuitBreaker := NewCircuitBreaker(5, 30*time.Second)
 
+	// Probe mode only dials backends, so it skips the GPU and hardware collectors
+	if yamlConfig.VantageProbe.Enabled {
+		if err := validateVantageProbe(yamlConfig.VantageProbe); err != nil {
+			LogFatal(fmt.Sprintf("Invalid probe configuration: %v", err))
+		}
+	}
+
 	// Initialize GPU collector (gracefully disabled if no GPUs present)
-	gpuCollector := NewGPUCollector(samplesPerWindow)
-	defer gpuCollector.Close()
+	var gpuCollector *GPUCollector
+	if !yamlConfig.VantageProbe.Enabled {
+		gpuCollector = NewGPUCollector(samplesPerWindow, window)
+		defer gpuCollector.Close()
+	}
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     httpClient,
-		cpuSamples:     make([][]float64, samplesPerWindow),
-		memorySamples:  make([]float64, samplesPerWindow),
-		diskSamples:    make([]float64, samplesPerWindow),
+		cpuSamples:     NewCoreSampleRing(samplesPerWindow, window),
+		memorySamples:  NewSampleRing(samplesPerWindow, window),
+		diskSamples:    NewSampleRing(samplesPerWindow, window),
 		gpuCollector:   gpuCollector,
-		maxSamples:     samplesPerWindow,
+		thermal:        NewThermalCollector(),
+		diskIO:         NewDiskIOCollector(config.DiskPath),
+		inventory:      NewInventoryCollector(config.Inventory),
+		errorReports:   NewErrorReporter(),
+		instanceID:     uuid.New().String(),
 		circuitBreaker: circuitBreaker,
 		retryConfig:    DefaultRetryConfig(),
 	}
 
+	// Reports missed while the server is unreachable are kept on disk and replayed later
+	spool, err := OpenStatsSpool(yamlConfig.StatsSpoolPath, yamlConfig.StatsSpoolMaxReports)
+	if err != nil {
+		LogWarn(fmt.Sprintf("Stats spool disabled: %v", err))
+	}
+	collector.spool = spool
+	if spool.Len() > 0 {
+		LogInfo(fmt.Sprintf("Found %d spooled stats reports to replay", spool.Len()))
+	}
+
+	// Multiple servers or SRV discovery enable failover (server_urls replaces server_url)
+	if len(config.ServerURLs) > 0 || config.ServerSRV != "" {
+		servers, err := NewServerPool(config.ServerURLs, config.ServerSRV, config.ServerSRVScheme)
+		if err != nil {
+			LogFatal(fmt.Sprintf("Failed to initialize server list: %v", err))
+		}
+		collector.servers = servers
+		LogInfoWithData("Load balancer failover enabled", map[string]interface{}{
+			"servers": servers.Servers(),
+			"srv":     config.ServerSRV,
+		})
+		go collector.maintainServerPool(time.Duration(yamlConfig.ServerFailbackSecs) * time.Second)
+	}
+
+	// A vantage probe reports latency from its region instead of registering as a backend
+	if yamlConfig.VantageProbe.Enabled {
+		LogInfoWithData("Running as vantage probe", map[string]interface{}{
+			"region":           yamlConfig.VantageProbe.Region,
+			"interval_seconds": yamlConfig.VantageProbe.IntervalSecs,
+		})
+		collector.runVantageProbe(yamlConfig.VantageProbe)
+		return
+	}
+
+	if config.BandwidthTest.Enabled {
+		if err := validateBandwidthTest(config.BandwidthTest); err != nil {
+			LogFatal(fmt.Sprintf("Invalid bandwidth test configuration: %v", err))
+		}
+	}
+
+	if config.Inventory.Enabled {
+		if err := validateInventory(config.Inventory); err != nil {
+			LogFatal(fmt.Sprintf("Invalid inventory configuration: %v", err))
+		}
+	}
+
+	// A restarted server fetches the latest report from here instead of waiting for the next one
+	if config.ProbeStatsListen != "" {
+		probeStats, err := StartProbeStats(config.ProbeStatsListen)
+		if err != nil {
+			LogWarn(fmt.Sprintf("Probe stats endpoint disabled: %v", err))
+		} else {
+			collector.probeStats = probeStats
+			LogInfo(fmt.Sprintf("Serving latest stats at %s%s", config.ProbeStatsListen, probeStatsPath))
+		}
+	}
+
 	// Register with server (with retry logic)
 	err = RetryWithBackoff(collector.retryConfig, func() error {
 		return collector.register()
@@ -185,6 +347,25 @@ func main() {
 		collector.collectMetrics()
 	}()
 
+	// Verify the advertised endpoint is reachable from the load balancer (NAT, firewall, wrong address)
+	if yamlConfig.ReachabilityCheckSecs > 0 {
+		go collector.runReachabilityChecks(time.Duration(yamlConfig.ReachabilityCheckSecs) * time.Second)
+	}
+
+	// Replace the agent binary when a new signed release is published for the configured channel
+	if yamlConfig.AutoUpdate.Enabled {
+		updater, err := NewUpdater(yamlConfig.AutoUpdate, httpClient.Transport)
+		if err != nil {
+			LogFatal(fmt.Sprintf("Failed to initialize auto-update: %v", err))
+		}
+		LogInfoWithData("Agent auto-update enabled", map[string]interface{}{
+			"version":  Version,
+			"channel":  updater.channel,
+			"manifest": yamlConfig.AutoUpdate.ManifestURL,
+		})
+		go updater.Run(time.Duration(yamlConfig.AutoUpdate.CheckIntervalSecs) * time.Second)
+	}
+
 	// Report to server periodically
 	ticker := time.NewTicker(time.Duration(config.ReportInterval) * time.Second)
 	defer ticker.Stop()
@@ -193,9 +374,26 @@ func main() {
 
 	for range ticker.C {
 		// Use circuit breaker for stats reporting
+		stats := collector.buildStats()
+		collector.probeStats.Record(stats)
 		err := collector.circuitBreaker.Call(func() error {
-			return collector.reportStats()
+			return collector.sendReport(stats)
 		})
+		// GPU XIDs stay pending until a report carrying them is delivered or spooled
+		if collector.spoolOrReplay(stats, err) {
+			collector.gpuCollector.ackXIDs(stats.GPUs)
+		}
+
+		// Error events ride along with successful reports; they wait while the server is unreachable
+		if err == nil {
+			if errReport := collector.reportErrors(); errReport != nil {
+				if errors.Is(errReport, errErrorReportingUnsupported) {
+					LogInfo("Server does not support error reporting, error events will only be logged")
+				} else {
+					LogWarn(fmt.Sprintf("Failed to report error events: %v", errReport))
+				}
+			}
+		}
 
 		if err != nil {
 			if err == ErrCircuitOpen {
@@ -213,12 +411,24 @@ func main() {
 
 func (c *MetricsCollector) register() error {
 	// Get local IP address
+	localIPv6 := ""
+	if !c.config.DisableIPv6 {
+		localIPv6 = c.getLocalIPv6()
+	}
 	localIP, err := c.getLocalIP()
-	if err != nil {
+	if err != nil && localIPv6 == "" {
 		log.Printf("Warning: Failed to get local IP: %v", err)
 		localIP = "127.0.0.1"
 	}
 	log.Printf("Detected local IP: %s", localIP)
+	if localIPv6 != "" {
+		log.Printf("Detected local IPv6: %s", localIPv6)
+	}
+	// IPv6-only hosts are geolocated by their IPv6 address
+	geoIP := localIP
+	if geoIP == "" {
+		geoIP = localIPv6
+	}
 
 	// Default geolocation values
 	publicIP := "unknown"
@@ -254,12 +464,12 @@ func (c *MetricsCollector) register() error {
 			// Try to lookup geolocation using local IP
 			// Note: This will only work if the client has a public IP address
 			// For clients behind NAT, geolocation will use the local IP which may not be accurate
-			geoData, err := c.getGeolocationFromIP(geoIPPath, localIP)
+			geoData, err := c.getGeolocationFromIP(geoIPPath, geoIP)
 			if err != nil {
 				log.Printf("Warning: Failed to get geolocation from database: %v", err)
 				log.Printf("Continuing without geolocation data")
 			} else {
-				publicIP = localIP // Use local IP as public IP
+				publicIP = geoIP // Use local IP as public IP
 				latitude = geoData["latitude"].(float64)
 				longitude = geoData["longitude"].(float64)
 				country = geoData["country"].(string)
@@ -285,10 +495,13 @@ func (c *MetricsCollector) register() error {
 	gpuModels := c.gpuCollector.GetDeviceModels()
 
 	registration := common.ClientRegistration{
+		SchemaVersion: common.SchemaVersion,
 		ClientID:     c.config.ClientID,
 		Hostname:     c.config.Hostname,
 		PublicIP:     publicIP,
 		LocalIP:      localIP,
+		LocalIPv6:    localIPv6,
+		EndpointPort: c.config.EndpointPort,
 		Latitude:     latitude,
 		Longitude:    longitude,
 		Country:      country,
@@ -298,8 +511,21 @@ func (c *MetricsCollector) register() error {
 		TotalStorage: float64(diskInfo.Total) / 1024 / 1024 / 1024,
 		TotalGPUs:    totalGPUs,
 		GPUModels:    gpuModels,
+		GPUComputeCapabilities: c.gpuCollector.GetComputeCapabilities(),
 		EndpointURL:  c.config.EndpointURL,
+		EndpointProtocol: c.config.EndpointProtocol,
 		Endpoints:    c.config.Endpoints,
+		HourlyCost:   c.config.HourlyCost,
+		Tenant:       c.config.Tenant,
+		Pool:         c.config.Pool,
+		InstanceID:   c.instanceID,
+		ServiceVersion: c.config.ServiceVersion,
+		Labels:       c.config.Labels,
+		ProbeStatsURL: c.probeStats.URL(c.config.ProbeStatsURL, localIP),
+		ProbeStatsToken: c.probeStats.Token(),
+		ApprovalToken: c.config.ApprovalToken,
+		ReportIntervalSecs: c.config.ReportInterval,
+		Bandwidth:    c.measureBandwidth(),
 	}
 
 	if totalGPUs > 0 {
@@ -308,68 +534,209 @@ func (c *MetricsCollector) register() error {
 
 	body, _ := json.Marshal(registration)
 
-	// Create request with server key header if configured
-	req, err := http.NewRequest("POST", c.config.ServerURL+"/register", bytes.NewBuffer(body))
+	resp, serverURL, err := c.sendToServer("POST", "/register", body)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	if c.config.ServerKey != "" {
-		req.Header.Set("X-API-Key", c.config.ServerKey)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// The body explains rejections such as an unsupported schema_version
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("registration failed: %s: %s", resp.Status, strings.TrimSpace(string(bodyBytes)))
 	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return err
+	// Servers with registration_approval hold new backends out of routing until an admin approves them
+	var result struct {
+		Status string `json:"status"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&result) == nil && result.Status == "pending_approval" {
+		LogWarnWithData("Registered, waiting for approval before receiving traffic", map[string]interface{}{
+			"server":    serverURL,
+			"client_id": c.config.ClientID,
+		})
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("registration failed: %s", resp.Status)
+	c.registeredURL = serverURL
+	return nil
+}
+
+// sendToServer sends a request to the primary server, failing over through the pool on
+// connection errors and 5xx responses. Returns the response and the server that answered
+func (c *MetricsCollector) sendToServer(method, path string, body []byte) (*http.Response, string, error) {
+	candidates := []string{c.config.ServerURL}
+	if c.servers != nil {
+		candidates = c.servers.Servers()
 	}
 
+	var lastErr error
+	for i, serverURL := range candidates {
+		req, err := c.newServerRequestTo(serverURL, method, path, body)
+		if err != nil {
+			return nil, "", err
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err == nil && resp.StatusCode < 500 {
+			return resp, serverURL, nil
+		}
+
+		if c.servers != nil {
+			c.servers.Failover(serverURL)
+		}
+
+		// Let the caller report the last server's error response as-is
+		if err == nil && i == len(candidates)-1 {
+			return resp, serverURL, nil
+		}
+		if err != nil {
+			lastErr = err
+		} else {
+			lastErr = fmt.Errorf("%s returned %s", serverURL, resp.Status)
+			resp.Body.Close()
+		}
+	}
+
+	return nil, "", lastErr
+}
+
+// ensureRegistered re-registers when the primary server changed since the last registration
+func (c *MetricsCollector) ensureRegistered() error {
+	if c.servers == nil || c.registeredURL == c.servers.Current() {
+		return nil
+	}
+
+	LogInfoWithData("Registering with new primary server", map[string]interface{}{
+		"server":   c.servers.Current(),
+		"previous": c.registeredURL,
+	})
+	return c.register()
+}
+
+// validateAuthMode rejects an unknown auth_mode, which would otherwise fall back to key auth,
+// and hmac mode without a server_key, which would send requests unsigned
+func validateAuthMode(config Config) error {
+	switch config.AuthMode {
+	case "", common.AuthModeKey:
+	case common.AuthModeHMAC:
+		if config.ServerKey == "" {
+			return fmt.Errorf("auth_mode: hmac requires server_key to be set")
+		}
+	default:
+		return fmt.Errorf("unknown auth_mode %q (want %s or %s)", config.AuthMode, common.AuthModeKey, common.AuthModeHMAC)
+	}
 	return nil
 }
 
+// newServerRequest builds a JSON request to the load balancer with authentication applied
+// In hmac mode the body is signed with the server key instead of sending the key itself
+func (c *MetricsCollector) newServerRequest(method, path string, body []byte) (*http.Request, error) {
+	serverURL := c.config.ServerURL
+	if c.servers != nil {
+		serverURL = c.servers.Current()
+	}
+	return c.newServerRequestTo(serverURL, method, path, body)
+}
+
+// newServerRequestTo builds an authenticated JSON request to a specific load balancer server
+func (c *MetricsCollector) newServerRequestTo(serverURL, method, path string, body []byte) (*http.Request, error) {
+	// Compress before signing so the signature covers the bytes on the wire
+	if c.config.CompressRequests {
+		compressed, err := gzipBody(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress request body: %w", err)
+		}
+		body = compressed
+	}
+
+	req, err := http.NewRequest(method, serverURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.config.CompressRequests {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	if c.config.ServerKey == "" {
+		return req, nil
+	}
+
+	if c.config.AuthMode == common.AuthModeHMAC {
+		nonce, err := common.NewNonce()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate nonce: %w", err)
+		}
+		timestamp := time.Now().Unix()
+		req.Header.Set(common.SignatureTimestampHeader, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(common.SignatureNonceHeader, nonce)
+		req.Header.Set(common.SignatureHeader, common.SignRequest(c.config.ServerKey, timestamp, nonce, method, req.URL.Path, body))
+	} else {
+		req.Header.Set("X-API-Key", c.config.ServerKey)
+	}
+
+	return req, nil
+}
+
 func (c *MetricsCollector) collectMetrics() {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		// CPU per-core usage
-		perCore, err := cpu.Percent(0, true)
-		if err == nil && len(perCore) > 0 {
-			c.cpuSamples[c.sampleIndex] = perCore
-		}
+		c.collectSample()
+	}
+}
 
-		// Memory usage
-		memInfo, err := mem.VirtualMemory()
-		if err == nil {
-			c.memorySamples[c.sampleIndex] = float64(memInfo.Used) / 1024 / 1024 / 1024
-		}
+// collectSample records one timestamped sample of CPU, memory, disk, and GPU usage
+func (c *MetricsCollector) collectSample() {
+	// CPU per-core usage
+	perCore, err := cpu.Percent(0, true)
+	if err == nil && len(perCore) > 0 {
+		c.cpuSamples.Add(perCore)
+	}
 
-		// Disk usage
-		diskInfo, err := disk.Usage(c.config.DiskPath)
-		if err == nil {
-			c.diskSamples[c.sampleIndex] = float64(diskInfo.Used) / 1024 / 1024 / 1024
-		}
+	// Memory usage
+	memInfo, err := mem.VirtualMemory()
+	if err == nil {
+		c.memorySamples.Add(float64(memInfo.Used) / 1024 / 1024 / 1024)
+	}
 
-		// GPU metrics (if available)
-		if c.gpuCollector.IsEnabled() {
-			if err := c.gpuCollector.CollectSample(); err != nil {
-				LogWarn(fmt.Sprintf("Failed to collect GPU sample: %v", err))
-			}
-		}
+	// Disk usage
+	diskInfo, err := disk.Usage(c.config.DiskPath)
+	if err == nil {
+		c.diskSamples.Add(float64(diskInfo.Used) / 1024 / 1024 / 1024)
+	} else {
+		c.errorReports.Record("disk", common.ErrorSeverityError, err, map[string]string{"path": c.config.DiskPath})
+	}
 
-		c.sampleIndex = (c.sampleIndex + 1) % c.maxSamples
+	// GPU metrics (if available)
+	if c.gpuCollector.IsEnabled() {
+		if err := c.gpuCollector.CollectSample(); err != nil {
+			LogWarn(fmt.Sprintf("Failed to collect GPU sample: %v", err))
+			c.errorReports.Record("gpu_collector", common.ErrorSeverityError, err, nil)
+		}
 	}
 }
 
+// reportStats collects and sends one stats report
 func (c *MetricsCollector) reportStats() error {
-	// Calculate averages over the window
+	stats := c.buildStats()
+	if err := c.sendReport(stats); err != nil {
+		return err
+	}
+	c.gpuCollector.ackXIDs(stats.GPUs)
+	return nil
+}
+
+// buildStats computes a report from the sample windows and current system state
+func (c *MetricsCollector) buildStats() common.ResourceStats {
+	// Calculate averages and p95 over the window
+	now := time.Now()
 	cpuCoreAvg := c.calculateCPUAverages()
-	memoryUsed := c.calculateAverage(c.memorySamples)
-	diskUsed := c.calculateAverage(c.diskSamples)
+	cpuCoreP95 := c.cpuSamples.Percentiles(now, 95)
+	memoryUsed := c.memorySamples.Mean(now)
+	memoryP95 := c.memorySamples.Percentile(now, 95)
+	diskUsed := c.diskSamples.Mean(now)
 
 	// Get current total resources
 	memInfo, _ := mem.VirtualMemory()
@@ -378,34 +745,75 @@ func (c *MetricsCollector) reportStats() error {
 	// Get GPU averages if available
 	gpuStats := c.gpuCollector.CalculateAverages()
 
-	stats := common.ResourceStats{
-		ClientID:    c.config.ClientID,
-		Hostname:    c.config.Hostname,
-		Timestamp:   time.Now(),
-		CPUCores:    len(cpuCoreAvg),
-		CPUUsageAvg: cpuCoreAvg,
-		MemoryTotal: float64(memInfo.Total) / 1024 / 1024 / 1024,
-		MemoryUsed:  memoryUsed,
-		MemoryAvail: float64(memInfo.Total)/1024/1024/1024 - memoryUsed,
-		DiskTotal:   float64(diskInfo.Total) / 1024 / 1024 / 1024,
-		DiskUsed:    diskUsed,
-		DiskAvail:   float64(diskInfo.Total)/1024/1024/1024 - diskUsed,
-		GPUs:        gpuStats,
-	}
-
-	body, _ := json.Marshal(stats)
-
-	// Create request with server key header if configured
-	req, err := http.NewRequest("POST", c.config.ServerURL+"/stats", bytes.NewBuffer(body))
+	// Load averages and swap are already time-averaged by the kernel, sample them directly
+	loadAvg, err := load.Avg()
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		loadAvg = &load.AvgStat{}
 	}
-	req.Header.Set("Content-Type", "application/json")
-	if c.config.ServerKey != "" {
-		req.Header.Set("X-API-Key", c.config.ServerKey)
+	swapInfo, err := mem.SwapMemory()
+	if err != nil {
+		swapInfo = &mem.SwapMemoryStat{}
 	}
 
-	resp, err := c.httpClient.Do(req)
+	stats := common.ResourceStats{
+		SchemaVersion: common.SchemaVersion,
+		ClientID:      c.config.ClientID,
+		InstanceID:    c.instanceID,
+		Hostname:      c.config.Hostname,
+		Timestamp:     time.Now(),
+		CPUCores:      len(cpuCoreAvg),
+		CPUUsageAvg:   cpuCoreAvg,
+		CPUUsageP95:   cpuCoreP95,
+		MemoryTotal:   float64(memInfo.Total) / 1024 / 1024 / 1024,
+		MemoryUsed:    memoryUsed,
+		MemoryUsedP95: memoryP95,
+		MemoryAvail:   float64(memInfo.Total)/1024/1024/1024 - memoryUsed,
+		Memory:        memoryBreakdown(memInfo),
+		DiskTotal:     float64(diskInfo.Total) / 1024 / 1024 / 1024,
+		DiskUsed:      diskUsed,
+		DiskAvail:     float64(diskInfo.Total)/1024/1024/1024 - diskUsed,
+		GPUs:          gpuStats,
+		LoadAvg1:      loadAvg.Load1,
+		LoadAvg5:      loadAvg.Load5,
+		LoadAvg15:     loadAvg.Load15,
+		SwapTotal:     float64(swapInfo.Total) / 1024 / 1024 / 1024,
+		SwapUsed:      float64(swapInfo.Used) / 1024 / 1024 / 1024,
+		PSI:           readPressureStats(),
+		Thermal:       c.thermal.Read(),
+		Sockets:       readSocketStats(),
+		DiskIO:        c.diskIO.Read(),
+		Inventory:     c.inventory.Read(),
+		Reachability:  c.latestReachability(),
+	}
+
+	// Latency-sensitive tiers can route on a short window, where load spikes aren't averaged away
+	if short := c.shortWindow(); short > 0 {
+		stats.CPUUsageShort = c.cpuSamples.MeansOver(now, short)
+		stats.CPUShortWindowSecs = int(short / time.Second)
+	}
+	return stats
+}
+
+// shortWindow returns the short CPU averaging window, or 0 if it is disabled or not shorter than the main one
+func (c *MetricsCollector) shortWindow() time.Duration {
+	short := time.Duration(c.config.ShortWindowSecs) * time.Second
+	if short <= 0 || short >= time.Duration(c.config.WindowMinutes)*time.Minute {
+		return 0
+	}
+	return short
+}
+
+// sendReport delivers a report to the load balancer
+// Errors wrapping errStatsRejected mean the server refused the report itself, so retrying it is pointless
+func (c *MetricsCollector) sendReport(stats common.ResourceStats) error {
+	// A server we failed over to has never seen our registration
+	if err := c.ensureRegistered(); err != nil {
+		return fmt.Errorf("registration with new primary failed: %w", err)
+	}
+
+	c.statsSeq++
+	stats.Seq = c.statsSeq
+	resp, serverURL, err := c.sendStats(stats)
 	if err != nil {
 		return fmt.Errorf("http request failed: %w", err)
 	}
@@ -413,86 +821,74 @@ func (c *MetricsCollector) reportStats() error {
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode < 500 {
+			return fmt.Errorf("%w: status=%s, body=%s", errStatsRejected, resp.Status, string(bodyBytes))
+		}
 		return fmt.Errorf("stats report failed: status=%s, body=%s", resp.Status, string(bodyBytes))
 	}
 
+	// Failed over mid-report: register so the next report is attributed
+	if c.servers != nil && serverURL != c.registeredURL {
+		if err := c.register(); err != nil {
+			LogWarn(fmt.Sprintf("Failed to register with %s after failover: %v", serverURL, err))
+		}
+	}
+
 	logData := map[string]interface{}{
 		"cpu_cores":    stats.CPUCores,
 		"memory_used":  fmt.Sprintf("%.1fGB", stats.MemoryUsed),
 		"memory_total": fmt.Sprintf("%.1fGB", stats.MemoryTotal),
 		"disk_used":    fmt.Sprintf("%.1fGB", stats.DiskUsed),
 		"disk_total":   fmt.Sprintf("%.1fGB", stats.DiskTotal),
+		"load_avg":     fmt.Sprintf("%.2f/%.2f/%.2f", stats.LoadAvg1, stats.LoadAvg5, stats.LoadAvg15),
 	}
 
-	if len(gpuStats) > 0 {
-		logData["gpu_count"] = len(gpuStats)
-		for i, gpu := range gpuStats {
-			logData[fmt.Sprintf("gpu_%d_util", i)] = fmt.Sprintf("%.1f%%", gpu.UtilizationPct)
-			logData[fmt.Sprintf("gpu_%d_mem", i)] = fmt.Sprintf("%.1f/%.1fGB", gpu.MemoryUsedGB, gpu.MemoryTotalGB)
-		}
+	if stats.PSI != nil {
+		logData["psi_cpu_some"] = fmt.Sprintf("%.2f%%", stats.PSI.CPUSomeAvg10)
+		logData["psi_memory_some"] = fmt.Sprintf("%.2f%%", stats.PSI.MemorySomeAvg10)
+		logData["psi_io_some"] = fmt.Sprintf("%.2f%%", stats.PSI.IOSomeAvg10)
 	}
 
-	LogDebugWithData("Stats reported successfully", logData)
-
-	return nil
-}
-
-func (c *MetricsCollector) calculateCPUAverages() []float64 {
-	if len(c.cpuSamples) == 0 {
-		return []float64{}
-	}
-
-	// Find the first non-empty sample to determine number of cores
-	var numCores int
-	for _, sample := range c.cpuSamples {
-		if len(sample) > 0 {
-			numCores = len(sample)
-			break
+	if stats.Thermal != nil {
+		logData["cpu_temp"] = fmt.Sprintf("%.1fC", stats.Thermal.CPUTempC)
+		logData["cpu_throttling"] = stats.Thermal.CPUThrottling
+		if stats.Thermal.CPUPowerW > 0 {
+			logData["cpu_power"] = fmt.Sprintf("%.1fW", stats.Thermal.CPUPowerW)
 		}
 	}
 
-	if numCores == 0 {
-		return []float64{}
+	if stats.Sockets != nil {
+		logData["open_fds"] = fmt.Sprintf("%d/%d", stats.Sockets.OpenFDs, stats.Sockets.MaxFDs)
+		logData["tcp_connections"] = stats.Sockets.TCPConnections
+		logData["ephemeral_ports"] = fmt.Sprintf("%d/%d", stats.Sockets.EphemeralPortsUsed, stats.Sockets.EphemeralPortsTotal)
 	}
 
-	averages := make([]float64, numCores)
-	counts := make([]int, numCores)
-
-	for _, sample := range c.cpuSamples {
-		if len(sample) == 0 {
-			continue
-		}
-		for core := 0; core < len(sample) && core < numCores; core++ {
-			averages[core] += sample[core]
-			counts[core]++
-		}
+	if stats.Inventory != nil {
+		logData["workloads_running"] = fmt.Sprintf("%d/%d", stats.Inventory.Running, stats.Inventory.Total)
 	}
 
-	for core := 0; core < numCores; core++ {
-		if counts[core] > 0 {
-			averages[core] /= float64(counts[core])
+	for _, dev := range stats.DiskIO {
+		if dev.DiskPath {
+			logData["disk_io"] = fmt.Sprintf("%.1f/%.1fMB/s %.0f%%", dev.ReadMBps, dev.WriteMBps, dev.UtilPct)
 		}
 	}
 
-	return averages
-}
-
-func (c *MetricsCollector) calculateAverage(samples []float64) float64 {
-	sum := 0.0
-	count := 0
-
-	for _, sample := range samples {
-		if sample > 0 {
-			sum += sample
-			count++
+	if len(stats.GPUs) > 0 {
+		logData["gpu_count"] = len(stats.GPUs)
+		for i, gpu := range stats.GPUs {
+			logData[fmt.Sprintf("gpu_%d_util", i)] = fmt.Sprintf("%.1f%%", gpu.UtilizationPct)
+			logData[fmt.Sprintf("gpu_%d_mem", i)] = fmt.Sprintf("%.1f/%.1fGB", gpu.MemoryUsedGB, gpu.MemoryTotalGB)
 		}
 	}
 
-	if count == 0 {
-		return 0
-	}
+	LogDebugWithData("Stats reported successfully", logData)
 
-	return sum / float64(count)
+	return nil
+}
+
+// calculateCPUAverages returns per-core CPU usage averaged over the window
+func (c *MetricsCollector) calculateCPUAverages() []float64 {
+	return c.cpuSamples.Means(time.Now())
 }
 
 // Helper functions for safe type conversion from map[string]interface{}
@@ -538,6 +934,22 @@ func (c *MetricsCollector) getLocalIP() (string, error) {
 	return "", fmt.Errorf("no local IP address found")
 }
 
+// getLocalIPv6 returns the first global unicast IPv6 address, or "" on IPv4-only hosts
+// Link-local addresses are skipped: they need a zone and are not reachable from the load balancer
+func (c *MetricsCollector) getLocalIPv6() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() == nil && ipnet.IP.IsGlobalUnicast() {
+			return ipnet.IP.String()
+		}
+	}
+	return ""
+}
+
 func (c *MetricsCollector) getGeolocationFromIP(dbPath, ipAddress string) (map[string]interface{}, error) {
 	db, err := geoip2.Open(dbPath)
 	if err != nil {
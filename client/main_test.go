@@ -194,16 +194,15 @@ func TestMetricsCollector_Registration(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(60)
+	gpuCollector := NewGPUCollector(60, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 60),
-		memorySamples:  make([]float64, 60),
-		diskSamples:    make([]float64, 60),
+		cpuSamples:     NewCoreSampleRing(60, 0),
+		memorySamples:  NewSampleRing(60, 0),
+		diskSamples:    NewSampleRing(60, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     60,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -258,27 +257,25 @@ func TestMetricsCollector_StatsReporting(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(3)
+	gpuCollector := NewGPUCollector(3, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 3),
-		memorySamples:  make([]float64, 3),
-		diskSamples:    make([]float64, 3),
+		cpuSamples:     NewCoreSampleRing(3, 0),
+		memorySamples:  NewSampleRing(3, 0),
+		diskSamples:    NewSampleRing(3, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     3,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
 
 	// Add some sample data
 	for i := 0; i < 3; i++ {
-		collector.cpuSamples[i] = []float64{10.0, 20.0, 30.0, 40.0}
-		collector.memorySamples[i] = 16.0
-		collector.diskSamples[i] = 100.0
+		collector.cpuSamples.Add([]float64{10.0, 20.0, 30.0, 40.0})
+		collector.memorySamples.Add(16.0)
+		collector.diskSamples.Add(100.0)
 	}
-	collector.sampleIndex = 3
 
 	// Report stats (note: actual implementation needs real metrics)
 	// This test verifies the HTTP request structure
@@ -330,8 +327,6 @@ func TestDefaultRetryConfig(t *testing.T) {
 
 // TestCalculateAverage verifies average calculation
 func TestCalculateAverage(t *testing.T) {
-	collector := &MetricsCollector{}
-
 	tests := []struct {
 		name     string
 		samples  []float64
@@ -343,9 +338,9 @@ func TestCalculateAverage(t *testing.T) {
 			expected: 20.0,
 		},
 		{
-			name:     "With zeros (ignored)",
-			samples:  []float64{10.0, 0.0, 30.0},
-			expected: 20.0,
+			name:     "With zeros (real idle samples count)",
+			samples:  []float64{10.0, 0.0, 20.0},
+			expected: 10.0,
 		},
 		{
 			name:     "All zeros",
@@ -366,7 +361,7 @@ func TestCalculateAverage(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := collector.calculateAverage(tt.samples)
+			result := mean(tt.samples)
 			if result != tt.expected {
 				t.Errorf("Expected %.2f, got %.2f", tt.expected, result)
 			}
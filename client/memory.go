@@ -0,0 +1,24 @@
+package main
+
+import (
+	"github.com/shirou/gopsutil/v3/mem"
+
+	"cyqle.in/opsen/common"
+)
+
+const bytesPerGB = 1024 * 1024 * 1024
+
+// memoryBreakdown reports free, cached, available and committed memory separately (nil if unavailable)
+func memoryBreakdown(info *mem.VirtualMemoryStat) *common.MemoryBreakdown {
+	if info == nil || info.Total == 0 {
+		return nil
+	}
+	return &common.MemoryBreakdown{
+		FreeGB:        float64(info.Free) / bytesPerGB,
+		BuffersGB:     float64(info.Buffers) / bytesPerGB,
+		CachedGB:      float64(info.Cached) / bytesPerGB,
+		AvailableGB:   float64(info.Available) / bytesPerGB,
+		CommittedGB:   float64(info.CommittedAS) / bytesPerGB,
+		CommitLimitGB: float64(info.CommitLimit) / bytesPerGB,
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// TestMemoryBreakdown verifies kernel memory figures are reported separately in GB
+func TestMemoryBreakdown(t *testing.T) {
+	const gb = 1024 * 1024 * 1024
+	breakdown := memoryBreakdown(&mem.VirtualMemoryStat{
+		Total:       16 * gb,
+		Free:        1 * gb,
+		Buffers:     gb / 2,
+		Cached:      6 * gb,
+		Available:   5 * gb,
+		CommittedAS: 12 * gb,
+		CommitLimit: 20 * gb,
+	})
+	if breakdown == nil {
+		t.Fatal("Expected a memory breakdown")
+	}
+	if breakdown.FreeGB != 1 || breakdown.BuffersGB != 0.5 || breakdown.CachedGB != 6 || breakdown.AvailableGB != 5 ||
+		breakdown.CommittedGB != 12 || breakdown.CommitLimitGB != 20 {
+		t.Errorf("Unexpected breakdown: %+v", breakdown)
+	}
+
+	if memoryBreakdown(nil) != nil || memoryBreakdown(&mem.VirtualMemoryStat{}) != nil {
+		t.Error("Expected no breakdown without memory information")
+	}
+}
@@ -3,8 +3,6 @@ package main
 import (
 	"testing"
 	"time"
-
-	"cyqle.in/opsen/common"
 )
 
 // TestCollectMetrics_Integration verifies metrics collection loop
@@ -19,17 +17,16 @@ func TestCollectMetrics_Integration(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(3)
+	gpuCollector := NewGPUCollector(3, 0)
 	defer gpuCollector.Close()
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     nil,
-		cpuSamples:     make([][]float64, 3),
-		memorySamples:  make([]float64, 3),
-		diskSamples:    make([]float64, 3),
+		cpuSamples:     NewCoreSampleRing(3, 0),
+		memorySamples:  NewSampleRing(3, 0),
+		diskSamples:    NewSampleRing(3, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     3,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -45,21 +42,19 @@ func TestCollectMetrics_Integration(t *testing.T) {
 		for range ticker.C {
 			// CPU per-core usage (simulated)
 			perCore := []float64{10.0, 20.0, 30.0}
-			collector.cpuSamples[collector.sampleIndex] = perCore
+			collector.cpuSamples.Add(perCore)
 
 			// Memory usage (simulated)
-			collector.memorySamples[collector.sampleIndex] = 8.0
+			collector.memorySamples.Add(8.0)
 
 			// Disk usage (simulated)
-			collector.diskSamples[collector.sampleIndex] = 50.0
+			collector.diskSamples.Add(50.0)
 
 			// GPU metrics (if available)
 			if collector.gpuCollector.IsEnabled() {
 				_ = collector.gpuCollector.CollectSample()
 			}
 
-			collector.sampleIndex = (collector.sampleIndex + 1) % collector.maxSamples
-
 			count++
 			if count >= 2 {
 				break
@@ -77,12 +72,7 @@ func TestCollectMetrics_Integration(t *testing.T) {
 	}
 
 	// Verify samples were collected
-	nonEmptyCount := 0
-	for _, sample := range collector.cpuSamples {
-		if len(sample) > 0 {
-			nonEmptyCount++
-		}
-	}
+	nonEmptyCount := collector.cpuSamples.Len()
 
 	if nonEmptyCount < 2 {
 		t.Errorf("Expected at least 2 CPU samples, got %d", nonEmptyCount)
@@ -91,25 +81,23 @@ func TestCollectMetrics_Integration(t *testing.T) {
 
 // TestCollectMetrics_GPUEnabled verifies GPU collection when enabled
 func TestCollectMetrics_GPUEnabled(t *testing.T) {
-	gpuCollector := NewGPUCollector(3)
+	gpuCollector := NewGPUCollector(3, 0)
 	defer gpuCollector.Close()
 
 	collector := &MetricsCollector{
 		config: Config{
 			DiskPath: "/",
 		},
-		cpuSamples:    make([][]float64, 3),
-		memorySamples: make([]float64, 3),
-		diskSamples:   make([]float64, 3),
+		cpuSamples:    NewCoreSampleRing(3, 0),
+		memorySamples: NewSampleRing(3, 0),
+		diskSamples:   NewSampleRing(3, 0),
 		gpuCollector:  gpuCollector,
-		maxSamples:    3,
-		sampleIndex:   0,
 	}
 
 	// Simulate one collection cycle
-	collector.cpuSamples[0] = []float64{10.0, 20.0}
-	collector.memorySamples[0] = 8.0
-	collector.diskSamples[0] = 50.0
+	collector.cpuSamples.Add([]float64{10.0, 20.0})
+	collector.memorySamples.Add(8.0)
+	collector.diskSamples.Add(50.0)
 
 	if gpuCollector.IsEnabled() {
 		err := gpuCollector.CollectSample()
@@ -122,10 +110,8 @@ func TestCollectMetrics_GPUEnabled(t *testing.T) {
 		t.Log("GPU collection disabled (no GPUs available)")
 	}
 
-	collector.sampleIndex = (collector.sampleIndex + 1) % collector.maxSamples
-
 	// Verify sample was stored
-	if len(collector.cpuSamples[0]) == 0 {
+	if collector.cpuSamples.Len() == 0 {
 		t.Error("Expected CPU samples to be collected")
 	}
 }
@@ -136,58 +122,45 @@ func TestCollectMetrics_SampleRotation(t *testing.T) {
 		config: Config{
 			DiskPath: "/",
 		},
-		cpuSamples:    make([][]float64, 3),
-		memorySamples: make([]float64, 3),
-		diskSamples:   make([]float64, 3),
+		cpuSamples:    NewCoreSampleRing(3, 0),
+		memorySamples: NewSampleRing(3, 0),
+		diskSamples:   NewSampleRing(3, 0),
 		gpuCollector:  &GPUCollector{enabled: false},
-		maxSamples:    3,
-		sampleIndex:   0,
 	}
 
 	// Collect 5 samples (more than window size)
 	for i := 0; i < 5; i++ {
-		collector.cpuSamples[collector.sampleIndex] = []float64{float64(i * 10)}
-		collector.memorySamples[collector.sampleIndex] = float64(i)
-		collector.diskSamples[collector.sampleIndex] = float64(i * 5)
-		collector.sampleIndex = (collector.sampleIndex + 1) % collector.maxSamples
-	}
-
-	// After 5 samples, index should be at position 2 (5 % 3)
-	if collector.sampleIndex != 2 {
-		t.Errorf("Expected sampleIndex 2, got %d", collector.sampleIndex)
+		collector.cpuSamples.Add([]float64{float64(i * 10)})
+		collector.memorySamples.Add(float64(i))
+		collector.diskSamples.Add(float64(i * 5))
 	}
 
-	// Verify samples were overwritten (should have samples 2, 3, 4)
-	// Sample at index 2 should be from iteration 2 (or was overwritten by iteration 5)
-	if collector.memorySamples[0] != 3.0 {
-		t.Logf("Sample 0 memory: %.1f (iteration 3)", collector.memorySamples[0])
-	}
-	if collector.memorySamples[1] != 4.0 {
-		t.Logf("Sample 1 memory: %.1f (iteration 4)", collector.memorySamples[1])
+	// Oldest samples were overwritten (should have samples 2, 3, 4)
+	values := collector.memorySamples.Values(time.Now())
+	if len(values) != 3 || values[0] != 2.0 || values[2] != 4.0 {
+		t.Errorf("Expected memory samples [2 3 4], got %v", values)
 	}
 }
 
 // TestCollectMetrics_AllMetricTypes verifies all metric types are collected
 func TestCollectMetrics_AllMetricTypes(t *testing.T) {
-	gpuCollector := NewGPUCollector(3)
+	gpuCollector := NewGPUCollector(3, 0)
 	defer gpuCollector.Close()
 
 	collector := &MetricsCollector{
 		config: Config{
 			DiskPath: "/",
 		},
-		cpuSamples:    make([][]float64, 3),
-		memorySamples: make([]float64, 3),
-		diskSamples:   make([]float64, 3),
+		cpuSamples:    NewCoreSampleRing(3, 0),
+		memorySamples: NewSampleRing(3, 0),
+		diskSamples:   NewSampleRing(3, 0),
 		gpuCollector:  gpuCollector,
-		maxSamples:    3,
-		sampleIndex:   0,
 	}
 
 	// Simulate one complete collection cycle
-	collector.cpuSamples[0] = []float64{25.5, 30.2, 15.8}
-	collector.memorySamples[0] = 12.3
-	collector.diskSamples[0] = 67.9
+	collector.cpuSamples.Add([]float64{25.5, 30.2, 15.8})
+	collector.memorySamples.Add(12.3)
+	collector.diskSamples.Add(67.9)
 
 	if gpuCollector.IsEnabled() {
 		// Try to collect GPU samples
@@ -198,13 +171,13 @@ func TestCollectMetrics_AllMetricTypes(t *testing.T) {
 	}
 
 	// Verify all types collected
-	if len(collector.cpuSamples[0]) == 0 {
+	if collector.cpuSamples.Len() == 0 {
 		t.Error("CPU samples not collected")
 	}
-	if collector.memorySamples[0] == 0 {
+	if collector.memorySamples.Len() == 0 {
 		t.Error("Memory samples not collected")
 	}
-	if collector.diskSamples[0] == 0 {
+	if collector.diskSamples.Len() == 0 {
 		t.Error("Disk samples not collected")
 	}
 
@@ -214,12 +187,12 @@ func TestCollectMetrics_AllMetricTypes(t *testing.T) {
 		t.Logf("CPU averages calculated: %d cores", len(cpuAvg))
 	}
 
-	memAvg := collector.calculateAverage(collector.memorySamples)
+	memAvg := collector.memorySamples.Mean(time.Now())
 	if memAvg > 0 {
 		t.Logf("Memory average: %.2f GB", memAvg)
 	}
 
-	diskAvg := collector.calculateAverage(collector.diskSamples)
+	diskAvg := collector.diskSamples.Mean(time.Now())
 	if diskAvg > 0 {
 		t.Logf("Disk average: %.2f GB", diskAvg)
 	}
@@ -229,26 +202,23 @@ func TestCollectMetrics_AllMetricTypes(t *testing.T) {
 func TestReportStats_GPUMetrics(t *testing.T) {
 	// This test verifies that GPU stats are included in report when available
 	gpuCollector := &GPUCollector{
-		enabled:      false, // Simulate no GPUs
-		sampleWindow: make([][]common.GPUStats, 3),
-		maxSamples:   3,
+		enabled: false, // Simulate no GPUs
 	}
 
 	collector := &MetricsCollector{
 		config: Config{
 			DiskPath: "/",
 		},
-		cpuSamples:    make([][]float64, 3),
-		memorySamples: make([]float64, 3),
-		diskSamples:   make([]float64, 3),
+		cpuSamples:    NewCoreSampleRing(3, 0),
+		memorySamples: NewSampleRing(3, 0),
+		diskSamples:   NewSampleRing(3, 0),
 		gpuCollector:  gpuCollector,
-		maxSamples:    3,
 	}
 
 	// Add sample data
-	collector.cpuSamples[0] = []float64{10.0, 20.0}
-	collector.memorySamples[0] = 8.0
-	collector.diskSamples[0] = 50.0
+	collector.cpuSamples.Add([]float64{10.0, 20.0})
+	collector.memorySamples.Add(8.0)
+	collector.diskSamples.Add(50.0)
 
 	// Get GPU averages (should be empty)
 	gpuStats := gpuCollector.CalculateAverages()
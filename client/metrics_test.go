@@ -41,31 +41,29 @@ func TestReportStats_Success(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(3)
+	gpuCollector := NewGPUCollector(3, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 3),
-		memorySamples:  make([]float64, 3),
-		diskSamples:    make([]float64, 3),
+		cpuSamples:     NewCoreSampleRing(3, 0),
+		memorySamples:  NewSampleRing(3, 0),
+		diskSamples:    NewSampleRing(3, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     3,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
 
 	// Add sample data
-	collector.cpuSamples[0] = []float64{10.0, 20.0}
-	collector.cpuSamples[1] = []float64{15.0, 25.0}
-	collector.cpuSamples[2] = []float64{20.0, 30.0}
-	collector.memorySamples[0] = 8.0
-	collector.memorySamples[1] = 9.0
-	collector.memorySamples[2] = 10.0
-	collector.diskSamples[0] = 50.0
-	collector.diskSamples[1] = 55.0
-	collector.diskSamples[2] = 60.0
-	collector.sampleIndex = 3
+	collector.cpuSamples.Add([]float64{10.0, 20.0})
+	collector.cpuSamples.Add([]float64{15.0, 25.0})
+	collector.cpuSamples.Add([]float64{20.0, 30.0})
+	collector.memorySamples.Add(8.0)
+	collector.memorySamples.Add(9.0)
+	collector.memorySamples.Add(10.0)
+	collector.diskSamples.Add(50.0)
+	collector.diskSamples.Add(55.0)
+	collector.diskSamples.Add(60.0)
 
 	// Report stats
 	err := collector.reportStats()
@@ -108,19 +106,17 @@ func TestReportStats_ServerError(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(3)
+	gpuCollector := NewGPUCollector(3, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 3),
-		memorySamples:  make([]float64, 3),
-		diskSamples:    make([]float64, 3),
+		cpuSamples:     NewCoreSampleRing(3, 0),
+		memorySamples:  NewSampleRing(3, 0),
+		diskSamples:    NewSampleRing(3, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     3,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
-		sampleIndex:    3,
 	}
 
 	// Report stats - should fail
@@ -151,19 +147,17 @@ func TestReportStats_EmptyData(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(3)
+	gpuCollector := NewGPUCollector(3, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 3),
-		memorySamples:  make([]float64, 3),
-		diskSamples:    make([]float64, 3),
+		cpuSamples:     NewCoreSampleRing(3, 0),
+		memorySamples:  NewSampleRing(3, 0),
+		diskSamples:    NewSampleRing(3, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     3,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
-		sampleIndex:    0, // No samples collected yet
 	}
 
 	// Report stats with empty data - should still succeed
@@ -187,16 +181,15 @@ func TestCollectMetrics_Timeout(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(3)
+	gpuCollector := NewGPUCollector(3, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 3),
-		memorySamples:  make([]float64, 3),
-		diskSamples:    make([]float64, 3),
+		cpuSamples:     NewCoreSampleRing(3, 0),
+		memorySamples:  NewSampleRing(3, 0),
+		diskSamples:    NewSampleRing(3, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     3,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -247,31 +240,29 @@ func TestReportStats_WithGPUData(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(3)
+	gpuCollector := NewGPUCollector(3, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 5 * time.Second},
-		cpuSamples:     make([][]float64, 3),
-		memorySamples:  make([]float64, 3),
-		diskSamples:    make([]float64, 3),
+		cpuSamples:     NewCoreSampleRing(3, 0),
+		memorySamples:  NewSampleRing(3, 0),
+		diskSamples:    NewSampleRing(3, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     3,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
-		sampleIndex:    3,
 	}
 
 	// Add sample data
-	collector.cpuSamples[0] = []float64{10.0}
-	collector.cpuSamples[1] = []float64{15.0}
-	collector.cpuSamples[2] = []float64{20.0}
-	collector.memorySamples[0] = 8.0
-	collector.memorySamples[1] = 9.0
-	collector.memorySamples[2] = 10.0
-	collector.diskSamples[0] = 50.0
-	collector.diskSamples[1] = 55.0
-	collector.diskSamples[2] = 60.0
+	collector.cpuSamples.Add([]float64{10.0})
+	collector.cpuSamples.Add([]float64{15.0})
+	collector.cpuSamples.Add([]float64{20.0})
+	collector.memorySamples.Add(8.0)
+	collector.memorySamples.Add(9.0)
+	collector.memorySamples.Add(10.0)
+	collector.diskSamples.Add(50.0)
+	collector.diskSamples.Add(55.0)
+	collector.diskSamples.Add(60.0)
 
 	// Report stats
 	err := collector.reportStats()
@@ -303,25 +294,23 @@ func TestRun_CircuitOpen(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
-	gpuCollector := NewGPUCollector(3)
+	gpuCollector := NewGPUCollector(3, 0)
 
 	collector := &MetricsCollector{
 		config:         config,
 		httpClient:     &http.Client{Timeout: 2 * time.Second},
-		cpuSamples:     make([][]float64, 3),
-		memorySamples:  make([]float64, 3),
-		diskSamples:    make([]float64, 3),
+		cpuSamples:     NewCoreSampleRing(3, 0),
+		memorySamples:  NewSampleRing(3, 0),
+		diskSamples:    NewSampleRing(3, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     3,
 		circuitBreaker: NewCircuitBreaker(3, 100*time.Millisecond), // Quick reset for testing
 		retryConfig:    DefaultRetryConfig(),
-		sampleIndex:    3,
 	}
 
 	// Add sample data
-	collector.cpuSamples[0] = []float64{10.0}
-	collector.cpuSamples[1] = []float64{15.0}
-	collector.cpuSamples[2] = []float64{20.0}
+	collector.cpuSamples.Add([]float64{10.0})
+	collector.cpuSamples.Add([]float64{15.0})
+	collector.cpuSamples.Add([]float64{20.0})
 
 	// Attempt multiple stats reports to trigger circuit breaker
 	for i := 0; i < 5; i++ {
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/net/http/httpproxy"
+
+	"cyqle.in/opsen/common"
+)
+
+// newOutboundTransport builds the transport for every call to the load balancer and for downloads
+// (GeoIP database, self-update, bandwidth tests): proxy and no_proxy override HTTP_PROXY, HTTPS_PROXY
+// and NO_PROXY, ca_cert_file adds trusted roots, and insecure_tls skips verification altogether
+func newOutboundTransport(cfg common.ClientConfig) (*http.Transport, error) {
+	proxyConfig := httpproxy.FromEnvironment()
+	if cfg.Proxy != "" {
+		parsed, err := url.Parse(cfg.Proxy)
+		if err != nil || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q", cfg.Proxy)
+		}
+		switch parsed.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("proxy scheme must be http, https, socks5 or socks5h, got %q", parsed.Scheme)
+		}
+		proxyConfig.HTTPProxy, proxyConfig.HTTPSProxy = cfg.Proxy, cfg.Proxy
+	}
+	if cfg.NoProxy != "" {
+		proxyConfig.NoProxy = cfg.NoProxy
+	}
+	proxyFunc := proxyConfig.ProxyFunc()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+
+	if cfg.CACertFile != "" {
+		pem, err := os.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_cert_file: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_cert_file %s holds no PEM certificates", cfg.CACertFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+	if cfg.InsecureTLS {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return transport, nil
+}
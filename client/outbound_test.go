@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestOutboundTransport_Proxy verifies the proxy setting applies to outbound calls except hosts in no_proxy
+func TestOutboundTransport_Proxy(t *testing.T) {
+	transport, err := newOutboundTransport(common.ClientConfig{
+		Proxy:   "socks5://proxy.corp.example:1080",
+		NoProxy: "lb.internal,10.0.0.0/8",
+	})
+	if err != nil {
+		t.Fatalf("Failed to build transport: %v", err)
+	}
+
+	for target, want := range map[string]string{
+		"https://lb.example.com/stats":  "socks5://proxy.corp.example:1080",
+		"http://geoip.example.com/db":   "socks5://proxy.corp.example:1080",
+		"https://lb.internal/register":  "",
+		"http://10.1.2.3:8080/register": "",
+	} {
+		req, _ := http.NewRequest(http.MethodGet, target, nil)
+		proxy, err := transport.Proxy(req)
+		if err != nil {
+			t.Fatalf("Proxy lookup failed for %s: %v", target, err)
+		}
+		got := ""
+		if proxy != nil {
+			got = proxy.String()
+		}
+		if got != want {
+			t.Errorf("%s: expected proxy %q, got %q", target, want, got)
+		}
+	}
+
+	for _, invalid := range []string{"ftp://proxy:21", "proxy.corp.example:3128"} {
+		if _, err := newOutboundTransport(common.ClientConfig{Proxy: invalid}); err == nil {
+			t.Errorf("Expected proxy %q to be rejected", invalid)
+		}
+	}
+}
+
+// TestOutboundTransport_CACertFile verifies a server signed by a custom CA is trusted only with ca_cert_file
+func TestOutboundTransport_CACertFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write CA bundle: %v", err)
+	}
+
+	get := func(cfg common.ClientConfig) error {
+		transport, err := newOutboundTransport(cfg)
+		if err != nil {
+			t.Fatalf("Failed to build transport: %v", err)
+		}
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	if err := get(common.ClientConfig{}); err == nil {
+		t.Error("Expected the self-signed server to be rejected without ca_cert_file")
+	}
+	if err := get(common.ClientConfig{CACertFile: caFile}); err != nil {
+		t.Errorf("Expected ca_cert_file to trust the server: %v", err)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	os.WriteFile(empty, []byte("not a certificate"), 0o600)
+	if _, err := newOutboundTransport(common.ClientConfig{CACertFile: empty}); err == nil {
+		t.Error("Expected a bundle without certificates to be rejected")
+	}
+}
@@ -46,7 +46,7 @@ func BenchmarkDiskSampling(b *testing.B) {
 
 // BenchmarkGPUSampling measures GPU sampling overhead (if available)
 func BenchmarkGPUSampling(b *testing.B) {
-	collector := NewGPUCollector(60)
+	collector := NewGPUCollector(60, 0)
 
 	if !collector.IsEnabled() {
 		b.Skip("No NVIDIA GPUs available, skipping GPU sampling benchmark")
@@ -143,7 +143,7 @@ func TestClientOverhead_DiskSampling(t *testing.T) {
 
 // TestClientOverhead_GPUSampling measures GPU sampling overhead
 func TestClientOverhead_GPUSampling(t *testing.T) {
-	collector := NewGPUCollector(60)
+	collector := NewGPUCollector(60, 0)
 
 	if !collector.IsEnabled() {
 		t.Skip("No NVIDIA GPUs available, skipping GPU overhead test")
@@ -167,7 +167,7 @@ func TestClientOverhead_GPUSampling(t *testing.T) {
 
 // TestClientOverhead_CombinedSampling measures total overhead of all sampling
 func TestClientOverhead_CombinedSampling(t *testing.T) {
-	gpuCollector := NewGPUCollector(60)
+	gpuCollector := NewGPUCollector(60, 0)
 	hasGPU := gpuCollector.IsEnabled()
 
 	start := time.Now()
@@ -205,7 +205,7 @@ func TestClientOverhead_CombinedSampling(t *testing.T) {
 // TestClientOverhead_ReportInterval measures HTTP reporting overhead
 func TestClientOverhead_ReportInterval(t *testing.T) {
 	// Test shows time to prepare report (not including network I/O)
-	gpuCollector := NewGPUCollector(60)
+	gpuCollector := NewGPUCollector(60, 0)
 
 	// Collect some sample data first
 	cpuSamples := make([][]float64, 60)
@@ -281,7 +281,7 @@ func TestClientMemoryUsage_Baseline(t *testing.T) {
 	runtime.ReadMemStats(&m1)
 
 	// Create metrics collector (without starting goroutines)
-	gpuCollector := NewGPUCollector(60)
+	gpuCollector := NewGPUCollector(60, 0)
 
 	config := Config{
 		ServerURL:       "http://localhost:8080",
@@ -293,13 +293,13 @@ func TestClientMemoryUsage_Baseline(t *testing.T) {
 		SkipGeolocation: true,
 	}
 
+	samplesPerWindow := config.WindowMinutes * 60
 	collector := &MetricsCollector{
 		config:         config,
-		cpuSamples:     make([][]float64, 900), // 15 minutes * 60 samples/min
-		memorySamples:  make([]float64, 900),
-		diskSamples:    make([]float64, 900),
+		cpuSamples:     NewCoreSampleRing(samplesPerWindow, 0),
+		memorySamples:  NewSampleRing(samplesPerWindow, 0),
+		diskSamples:    NewSampleRing(samplesPerWindow, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     900,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -311,7 +311,7 @@ func TestClientMemoryUsage_Baseline(t *testing.T) {
 	t.Logf("✓ Client baseline memory usage: %.2f MB", allocatedMB)
 	t.Logf("  Heap objects: %d", m2.HeapObjects-m1.HeapObjects)
 	t.Logf("  Sys memory: %.2f MB", float64(m2.Sys-m1.Sys)/1024/1024)
-	t.Logf("  Sample window: %d minutes (%d samples)", config.WindowMinutes, collector.maxSamples)
+	t.Logf("  Sample window: %d minutes (%d samples)", collector.config.WindowMinutes, samplesPerWindow)
 
 	// Note: This includes test overhead, actual client should be lower
 	if allocatedMB > 10 {
@@ -323,7 +323,7 @@ func TestClientMemoryUsage_Baseline(t *testing.T) {
 func TestClientMemoryUsage_WithSamples(t *testing.T) {
 	var m1, m2 runtime.MemStats
 
-	gpuCollector := NewGPUCollector(900)
+	gpuCollector := NewGPUCollector(900, 0)
 
 	config := Config{
 		ServerURL:       "http://localhost:8080",
@@ -337,11 +337,10 @@ func TestClientMemoryUsage_WithSamples(t *testing.T) {
 
 	collector := &MetricsCollector{
 		config:         config,
-		cpuSamples:     make([][]float64, 900),
-		memorySamples:  make([]float64, 900),
-		diskSamples:    make([]float64, 900),
+		cpuSamples:     NewCoreSampleRing(900, 0),
+		memorySamples:  NewSampleRing(900, 0),
+		diskSamples:    NewSampleRing(900, 0),
 		gpuCollector:   gpuCollector,
-		maxSamples:     900,
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 		retryConfig:    DefaultRetryConfig(),
 	}
@@ -352,12 +351,13 @@ func TestClientMemoryUsage_WithSamples(t *testing.T) {
 	// Fill sample buffers
 	numCPUs := 8 // Typical CPU count
 	for i := 0; i < 900; i++ {
-		collector.cpuSamples[i] = make([]float64, numCPUs)
+		perCore := make([]float64, numCPUs)
 		for j := 0; j < numCPUs; j++ {
-			collector.cpuSamples[i][j] = 10.0 + float64(i%50)
+			perCore[j] = 10.0 + float64(i%50)
 		}
-		collector.memorySamples[i] = 16.0
-		collector.diskSamples[i] = 100.0
+		collector.cpuSamples.Add(perCore)
+		collector.memorySamples.Add(16.0)
+		collector.diskSamples.Add(100.0)
 	}
 
 	runtime.GC()
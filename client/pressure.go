@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"cyqle.in/opsen/common"
+)
+
+// pressureDir is where the kernel exposes PSI files (Linux 4.20+)
+var pressureDir = "/proc/pressure"
+
+// pressureAverages holds the avg10/avg60 values of one PSI line ("some" or "full")
+type pressureAverages struct {
+	Avg10 float64
+	Avg60 float64
+}
+
+// readPressureStats reads CPU, memory, and I/O pressure stall information
+// Returns nil if PSI is not available on this host (non-Linux or older kernel)
+func readPressureStats() *common.PressureStats {
+	cpuPressure, err := readPressureFile(pressureDir + "/cpu")
+	if err != nil {
+		return nil
+	}
+
+	psi := &common.PressureStats{
+		CPUSomeAvg10: cpuPressure["some"].Avg10,
+		CPUSomeAvg60: cpuPressure["some"].Avg60,
+	}
+
+	if memPressure, err := readPressureFile(pressureDir + "/memory"); err == nil {
+		psi.MemorySomeAvg10 = memPressure["some"].Avg10
+		psi.MemoryFullAvg10 = memPressure["full"].Avg10
+	}
+
+	if ioPressure, err := readPressureFile(pressureDir + "/io"); err == nil {
+		psi.IOSomeAvg10 = ioPressure["some"].Avg10
+		psi.IOFullAvg10 = ioPressure["full"].Avg10
+	}
+
+	return psi
+}
+
+// readPressureFile parses a PSI file into its "some" and "full" lines
+func readPressureFile(path string) (map[string]pressureAverages, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := make(map[string]pressureAverages)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		kind, averages, err := parsePressureLine(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		result[kind] = averages
+	}
+
+	return result, scanner.Err()
+}
+
+// parsePressureLine parses a line like "some avg10=1.23 avg60=0.50 avg300=0.10 total=12345"
+func parsePressureLine(line string) (string, pressureAverages, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", pressureAverages{}, fmt.Errorf("empty pressure line")
+	}
+
+	kind := fields[0]
+	if kind != "some" && kind != "full" {
+		return "", pressureAverages{}, fmt.Errorf("unknown pressure line type: %s", kind)
+	}
+
+	var averages pressureAverages
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "avg10", "avg60":
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return "", pressureAverages{}, fmt.Errorf("invalid %s value %q: %w", key, value, err)
+			}
+			if key == "avg10" {
+				averages.Avg10 = parsed
+			} else {
+				averages.Avg60 = parsed
+			}
+		}
+	}
+
+	return kind, averages, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestParsePressureLine verifies PSI line parsing
+func TestParsePressureLine(t *testing.T) {
+	kind, averages, err := parsePressureLine("some avg10=12.50 avg60=3.25 avg300=0.80 total=123456")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if kind != "some" {
+		t.Errorf("Expected kind 'some', got %s", kind)
+	}
+	if averages.Avg10 != 12.5 || averages.Avg60 != 3.25 {
+		t.Errorf("Expected avg10=12.5 avg60=3.25, got avg10=%.2f avg60=%.2f", averages.Avg10, averages.Avg60)
+	}
+
+	if _, _, err := parsePressureLine("bogus avg10=1.0"); err == nil {
+		t.Error("Expected error for unknown line type")
+	}
+	if _, _, err := parsePressureLine("full avg10=abc"); err == nil {
+		t.Error("Expected error for non-numeric average")
+	}
+}
+
+// TestReadPressureStats verifies PSI files are combined into PressureStats
+func TestReadPressureStats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"cpu":    "some avg10=5.00 avg60=2.00 avg300=1.00 total=100\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+		"memory": "some avg10=7.50 avg60=1.00 avg300=0.00 total=100\nfull avg10=2.50 avg60=0.50 avg300=0.00 total=50\n",
+		"io":     "some avg10=9.00 avg60=4.00 avg300=1.00 total=100\nfull avg10=6.00 avg60=3.00 avg300=1.00 total=50\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	original := pressureDir
+	pressureDir = dir
+	defer func() { pressureDir = original }()
+
+	psi := readPressureStats()
+	if psi == nil {
+		t.Fatal("Expected pressure stats, got nil")
+	}
+	if psi.CPUSomeAvg10 != 5.0 || psi.CPUSomeAvg60 != 2.0 {
+		t.Errorf("Unexpected CPU pressure: %+v", psi)
+	}
+	if psi.MemorySomeAvg10 != 7.5 || psi.MemoryFullAvg10 != 2.5 {
+		t.Errorf("Unexpected memory pressure: %+v", psi)
+	}
+	if psi.IOSomeAvg10 != 9.0 || psi.IOFullAvg10 != 6.0 {
+		t.Errorf("Unexpected I/O pressure: %+v", psi)
+	}
+}
+
+// TestReadPressureStats_Unavailable verifies nil is returned when PSI is missing
+func TestReadPressureStats_Unavailable(t *testing.T) {
+	original := pressureDir
+	pressureDir = filepath.Join(t.TempDir(), "missing")
+	defer func() { pressureDir = original }()
+
+	if psi := readPressureStats(); psi != nil {
+		t.Errorf("Expected nil pressure stats, got %+v", psi)
+	}
+}
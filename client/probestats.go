@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// probeStatsPath is where the agent serves its latest stats report (probe_stats_listen)
+const probeStatsPath = "/probe-stats"
+
+// ProbeStats serves the agent's latest stats report so a restarted load balancer can fetch it at
+// once instead of waiting up to report_interval_seconds for the next one. Requests must carry the
+// random token sent with the registration, so only the server the agent registered with can read it
+type ProbeStats struct {
+	token string
+	port  int
+
+	mu     sync.Mutex
+	latest *common.ResourceStats
+}
+
+// StartProbeStats listens on addr and serves GET /probe-stats in the background
+func StartProbeStats(addr string) (*ProbeStats, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ProbeStats{token: hex.EncodeToString(tokenBytes), port: listener.Addr().(*net.TCPAddr).Port}
+	mux := http.NewServeMux()
+	mux.HandleFunc(probeStatsPath, p.handle)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			LogWarn(fmt.Sprintf("Probe stats listener stopped: %v", err))
+		}
+	}()
+	return p, nil
+}
+
+// Record keeps the report just built as the one served; safe to call on a nil ProbeStats
+func (p *ProbeStats) Record(stats common.ResourceStats) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.latest = &stats
+}
+
+// URL returns the address the server should fetch stats from: override, or the listen port on localIP
+func (p *ProbeStats) URL(override, localIP string) string {
+	if p == nil {
+		return ""
+	}
+	if override != "" {
+		return override
+	}
+	return "http://" + net.JoinHostPort(localIP, strconv.Itoa(p.port)) + probeStatsPath
+}
+
+// Token returns the bearer token the server must present; empty on a nil ProbeStats
+func (p *ProbeStats) Token() string {
+	if p == nil {
+		return ""
+	}
+	return p.token
+}
+
+func (p *ProbeStats) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(p.token)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	p.mu.Lock()
+	latest := p.latest
+	p.mu.Unlock()
+	if latest == nil {
+		http.Error(w, "No stats collected yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(latest); err != nil {
+		LogWarn(fmt.Sprintf("Failed to encode probe stats: %v", err))
+	}
+}
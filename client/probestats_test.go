@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestProbeStats_ServesLatestReport verifies the latest report is served only to requests carrying the registration token
+func TestProbeStats_ServesLatestReport(t *testing.T) {
+	probe, err := StartProbeStats("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start probe stats listener: %v", err)
+	}
+	url := probe.URL("", "127.0.0.1")
+
+	get := func(token string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Probe request failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := get(probe.Token())
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before the first report, got %d", resp.StatusCode)
+	}
+
+	probe.Record(common.ResourceStats{ClientID: "edge-1", CPUCores: 4, Seq: 7})
+	resp = get("wrong")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong token, got %d", resp.StatusCode)
+	}
+
+	resp = get(probe.Token())
+	defer resp.Body.Close()
+	var stats common.ResourceStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the latest report, got %d (%v)", resp.StatusCode, err)
+	}
+	if stats.ClientID != "edge-1" || stats.CPUCores != 4 || stats.Seq != 7 {
+		t.Errorf("Expected the recorded report, got %+v", stats)
+	}
+
+	var disabled *ProbeStats
+	disabled.Record(stats)
+	if disabled.URL("", "127.0.0.1") != "" || disabled.Token() != "" {
+		t.Error("Expected a disabled endpoint to advertise nothing")
+	}
+	if got := probe.URL("https://edge-1.example.com/probe-stats", "127.0.0.1"); got != "https://edge-1.example.com/probe-stats" {
+		t.Errorf("Expected probe_stats_url to override the derived URL, got %s", got)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// errProbeBackUnsupported means the server predates POST /probe-back
+var errProbeBackUnsupported = errors.New("server does not support probe-back")
+
+// checkReachability asks the load balancer to probe our advertised endpoints back and keeps
+// the result for the next stats report
+func (c *MetricsCollector) checkReachability() error {
+	body, _ := json.Marshal(common.ProbeBackRequest{ClientID: c.config.ClientID})
+
+	resp, _, err := c.sendToServer("POST", "/probe-back", body)
+	if err != nil {
+		return fmt.Errorf("probe-back request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		// Older servers answer with the mux's generic 404 (unknown clients get a descriptive one)
+		if resp.StatusCode == http.StatusMethodNotAllowed ||
+			(resp.StatusCode == http.StatusNotFound && string(bodyBytes) == "404 page not found\n") {
+			return errProbeBackUnsupported
+		}
+		return fmt.Errorf("probe-back failed: status=%s, body=%s", resp.Status, string(bodyBytes))
+	}
+
+	var result common.ProbeBackResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid probe-back response: %w", err)
+	}
+
+	for _, endpoint := range result.Endpoints {
+		if endpoint.Reachable {
+			continue
+		}
+		LogWarnWithData("Advertised endpoint is not reachable from the load balancer", map[string]interface{}{
+			"endpoint": endpoint.Endpoint,
+			"error":    endpoint.Error,
+			"hint":     endpoint.Hint,
+		})
+		c.errorReports.Record("probe", common.ErrorSeverityWarning, errors.New(endpoint.Error), map[string]string{
+			"endpoint": endpoint.Endpoint,
+			"hint":     endpoint.Hint,
+		})
+	}
+
+	c.reachabilityMu.Lock()
+	c.reachability = result.Endpoints
+	c.reachabilityMu.Unlock()
+	return nil
+}
+
+// latestReachability returns the most recent probe-back result (nil if none yet)
+func (c *MetricsCollector) latestReachability() []common.EndpointReachability {
+	c.reachabilityMu.Lock()
+	defer c.reachabilityMu.Unlock()
+	return c.reachability
+}
+
+// runReachabilityChecks checks endpoint reachability immediately and then every interval
+// Stops if the server does not support probe-back
+func (c *MetricsCollector) runReachabilityChecks(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.checkReachability(); err != nil {
+			if errors.Is(err, errProbeBackUnsupported) {
+				LogInfo("Server does not support probe-back, endpoint reachability checks disabled")
+				return
+			}
+			LogWarn(fmt.Sprintf("Endpoint reachability check failed: %v", err))
+			c.errorReports.Record("probe", common.ErrorSeverityWarning, err, nil)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestCheckReachability verifies the probe-back result is kept for the next stats report
+func TestCheckReachability(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/probe-back" {
+			http.NotFound(w, r)
+			return
+		}
+		var req common.ProbeBackRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(common.ProbeBackResponse{
+			ClientID: req.ClientID,
+			Endpoints: []common.EndpointReachability{
+				{Endpoint: "http://10.0.0.5:11000", Reachable: false, Error: "i/o timeout", Hint: "timed out"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	collector := &MetricsCollector{
+		config:     Config{ServerURL: server.URL, ClientID: "agent-1"},
+		httpClient: &http.Client{},
+	}
+
+	if err := collector.checkReachability(); err != nil {
+		t.Fatalf("Expected probe-back to succeed, got %v", err)
+	}
+	reachability := collector.latestReachability()
+	if len(reachability) != 1 || reachability[0].Reachable {
+		t.Errorf("Expected one unreachable endpoint, got %+v", reachability)
+	}
+}
+
+// TestCheckReachability_Unsupported verifies older servers without probe-back are detected
+func TestCheckReachability_Unsupported(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	collector := &MetricsCollector{
+		config:     Config{ServerURL: server.URL, ClientID: "agent-1"},
+		httpClient: &http.Client{},
+	}
+
+	if err := collector.checkReachability(); !errors.Is(err, errProbeBackUnsupported) {
+		t.Errorf("Expected errProbeBackUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// timedSample is one scalar observation
+type timedSample struct {
+	at    time.Time
+	value float64
+}
+
+// SampleRing is a fixed-capacity ring of timestamped samples
+// Aggregates only consider samples inside the time window, so stale or never-written
+// slots never skew the result
+type SampleRing struct {
+	mu      sync.Mutex
+	samples []timedSample
+	next    int
+	count   int
+	window  time.Duration
+}
+
+// NewSampleRing creates a ring holding up to capacity samples aggregated over window
+func NewSampleRing(capacity int, window time.Duration) *SampleRing {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &SampleRing{samples: make([]timedSample, capacity), window: window}
+}
+
+// Add records a sample taken now
+func (r *SampleRing) Add(value float64) {
+	r.AddAt(time.Now(), value)
+}
+
+// AddAt records a sample taken at the given time
+func (r *SampleRing) AddAt(at time.Time, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.samples[r.next] = timedSample{at: at, value: value}
+	r.next = (r.next + 1) % len(r.samples)
+	if r.count < len(r.samples) {
+		r.count++
+	}
+}
+
+// Len returns the number of stored samples (including ones outside the window)
+func (r *SampleRing) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.count
+}
+
+// Values returns samples taken within the window ending at now, oldest first
+func (r *SampleRing) Values(now time.Time) []float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cutoff := now.Add(-r.window)
+	values := make([]float64, 0, r.count)
+	start := (r.next - r.count + len(r.samples)) % len(r.samples)
+	for i := 0; i < r.count; i++ {
+		sample := r.samples[(start+i)%len(r.samples)]
+		if r.window > 0 && sample.at.Before(cutoff) {
+			continue
+		}
+		values = append(values, sample.value)
+	}
+	return values
+}
+
+// Mean returns the average of in-window samples (0 if there are none)
+func (r *SampleRing) Mean(now time.Time) float64 {
+	return mean(r.Values(now))
+}
+
+// Percentile returns the p-th percentile (0-100) of in-window samples (0 if there are none)
+func (r *SampleRing) Percentile(now time.Time, p float64) float64 {
+	return percentile(r.Values(now), p)
+}
+
+// timedVector is one per-core observation
+type timedVector struct {
+	at     time.Time
+	values []float64
+}
+
+// CoreSampleRing is a fixed-capacity ring of timestamped per-core samples
+// The core count follows the most recent sample, so CPU hotplug neither drops new
+// cores nor keeps reporting removed ones
+type CoreSampleRing struct {
+	mu      sync.Mutex
+	samples []timedVector
+	next    int
+	count   int
+	window  time.Duration
+}
+
+// NewCoreSampleRing creates a per-core ring holding up to capacity samples aggregated over window
+func NewCoreSampleRing(capacity int, window time.Duration) *CoreSampleRing {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &CoreSampleRing{samples: make([]timedVector, capacity), window: window}
+}
+
+// Add records a per-core sample taken now
+func (r *CoreSampleRing) Add(values []float64) {
+	r.AddAt(time.Now(), values)
+}
+
+// AddAt records a per-core sample taken at the given time
+func (r *CoreSampleRing) AddAt(at time.Time, values []float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.samples[r.next] = timedVector{at: at, values: append([]float64(nil), values...)}
+	r.next = (r.next + 1) % len(r.samples)
+	if r.count < len(r.samples) {
+		r.count++
+	}
+}
+
+// Len returns the number of stored samples (including ones outside the window)
+func (r *CoreSampleRing) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.count
+}
+
+// perCore groups samples within window of now by core index, sized to the latest core count
+func (r *CoreSampleRing) perCore(now time.Time, window time.Duration) [][]float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.count == 0 {
+		return nil
+	}
+
+	latest := r.samples[(r.next-1+len(r.samples))%len(r.samples)]
+	cores := make([][]float64, len(latest.values))
+
+	cutoff := now.Add(-window)
+	start := (r.next - r.count + len(r.samples)) % len(r.samples)
+	for i := 0; i < r.count; i++ {
+		sample := r.samples[(start+i)%len(r.samples)]
+		if window > 0 && sample.at.Before(cutoff) {
+			continue
+		}
+		for core := 0; core < len(sample.values) && core < len(cores); core++ {
+			cores[core] = append(cores[core], sample.values[core])
+		}
+	}
+	return cores
+}
+
+// Means returns the per-core average of in-window samples
+func (r *CoreSampleRing) Means(now time.Time) []float64 {
+	return r.MeansOver(now, r.window)
+}
+
+// MeansOver returns the per-core average of samples taken within window of now
+// window may be shorter than the ring's, e.g. to catch spikes the full window averages away
+func (r *CoreSampleRing) MeansOver(now time.Time, window time.Duration) []float64 {
+	cores := r.perCore(now, window)
+	result := make([]float64, len(cores))
+	for core, values := range cores {
+		result[core] = mean(values)
+	}
+	return result
+}
+
+// Percentiles returns the per-core p-th percentile (0-100) of in-window samples
+func (r *CoreSampleRing) Percentiles(now time.Time, p float64) []float64 {
+	cores := r.perCore(now, r.window)
+	result := make([]float64, len(cores))
+	for core, values := range cores {
+		result[core] = percentile(values, p)
+	}
+	return result
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// percentile uses the nearest-rank method
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
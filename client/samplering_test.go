@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSampleRing_WindowFiltersStaleSamples verifies samples older than the window are not aggregated
+func TestSampleRing_WindowFiltersStaleSamples(t *testing.T) {
+	now := time.Now()
+	ring := NewSampleRing(10, time.Minute)
+
+	ring.AddAt(now.Add(-5*time.Minute), 100.0)
+	ring.AddAt(now.Add(-30*time.Second), 10.0)
+	ring.AddAt(now, 20.0)
+
+	if ring.Len() != 3 {
+		t.Errorf("Expected 3 stored samples, got %d", ring.Len())
+	}
+	if mean := ring.Mean(now); mean != 15.0 {
+		t.Errorf("Expected mean 15.0 over the window, got %.2f", mean)
+	}
+}
+
+// TestSampleRing_ZeroValuesCount verifies real zero readings are averaged instead of skipped
+func TestSampleRing_ZeroValuesCount(t *testing.T) {
+	ring := NewSampleRing(5, time.Minute)
+	ring.Add(0)
+	ring.Add(30.0)
+
+	if mean := ring.Mean(time.Now()); mean != 15.0 {
+		t.Errorf("Expected mean 15.0, got %.2f", mean)
+	}
+	if empty := NewSampleRing(5, time.Minute).Mean(time.Now()); empty != 0 {
+		t.Errorf("Expected 0 for an empty ring, got %.2f", empty)
+	}
+}
+
+// TestSampleRing_Percentile verifies nearest-rank p95 over in-window samples
+func TestSampleRing_Percentile(t *testing.T) {
+	ring := NewSampleRing(100, 0)
+	for i := 1; i <= 100; i++ {
+		ring.Add(float64(i))
+	}
+
+	if p95 := ring.Percentile(time.Now(), 95); p95 != 95.0 {
+		t.Errorf("Expected p95 95.0, got %.2f", p95)
+	}
+	if p100 := ring.Percentile(time.Now(), 100); p100 != 100.0 {
+		t.Errorf("Expected p100 100.0, got %.2f", p100)
+	}
+}
+
+// TestCoreSampleRing_Hotplug verifies the core count follows the latest sample
+func TestCoreSampleRing_Hotplug(t *testing.T) {
+	now := time.Now()
+	ring := NewCoreSampleRing(10, time.Minute)
+
+	ring.AddAt(now.Add(-2*time.Second), []float64{10.0, 20.0})
+	ring.AddAt(now.Add(-time.Second), []float64{30.0, 40.0, 90.0, 50.0})
+
+	means := ring.Means(now)
+	if len(means) != 4 {
+		t.Fatalf("Expected 4 cores after hotplug, got %d", len(means))
+	}
+	expected := []float64{20.0, 30.0, 90.0, 50.0}
+	for core := range expected {
+		if means[core] != expected[core] {
+			t.Errorf("Core %d: expected %.2f, got %.2f", core, expected[core], means[core])
+		}
+	}
+
+	// Removing cores stops reporting them
+	ring.AddAt(now, []float64{60.0})
+	if means := ring.Means(now); len(means) != 1 || means[0] != 100.0/3 {
+		t.Errorf("Expected 1 core with mean 33.33, got %v", means)
+	}
+}
+
+// TestCoreSampleRing_Wrap verifies the oldest samples are overwritten once capacity is reached
+func TestCoreSampleRing_Wrap(t *testing.T) {
+	ring := NewCoreSampleRing(3, 0)
+	for i := 1; i <= 5; i++ {
+		ring.Add([]float64{float64(i * 10)})
+	}
+
+	if ring.Len() != 3 {
+		t.Errorf("Expected 3 stored samples, got %d", ring.Len())
+	}
+	if means := ring.Means(time.Now()); means[0] != 40.0 {
+		t.Errorf("Expected mean 40.0 of the last 3 samples, got %.2f", means[0])
+	}
+	if p95 := ring.Percentiles(time.Now(), 95); p95[0] != 50.0 {
+		t.Errorf("Expected p95 50.0, got %.2f", p95[0])
+	}
+}
+
+// TestCoreSampleRing_MeansOver verifies a shorter window averages only the recent samples, exposing a spike
+func TestCoreSampleRing_MeansOver(t *testing.T) {
+	now := time.Now()
+	ring := NewCoreSampleRing(1000, 15*time.Minute)
+
+	for i := 600; i > 60; i-- {
+		ring.AddAt(now.Add(-time.Duration(i)*time.Second), []float64{10.0})
+	}
+	for i := 60; i > 0; i-- {
+		ring.AddAt(now.Add(-time.Duration(i)*time.Second), []float64{90.0})
+	}
+
+	if long := ring.Means(now)[0]; long > 20 {
+		t.Errorf("Expected the long window to average the spike away, got %.2f", long)
+	}
+	if short := ring.MeansOver(now, time.Minute)[0]; short != 90.0 {
+		t.Errorf("Expected the short window to show the spike, got %.2f", short)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// Version is set at build time via -ldflags
+var Version = "dev"
+
+// maxManifestBytes caps the release manifest and signature downloads
+const maxManifestBytes = 1 << 20
+
+// Updater replaces the agent binary with the release published for its channel
+// The manifest must carry a valid Ed25519 signature and the binary must match the manifest's
+// checksum before anything on disk is touched; the swap itself is a rename in the binary's directory
+type Updater struct {
+	manifestURL string
+	channel     string
+	publicKey   ed25519.PublicKey
+	httpClient  *http.Client
+	version     string                  // Running version
+	executable  string                  // Path of the running binary (symlinks resolved)
+	platform    string                  // GOOS/GOARCH key into the manifest's binaries
+	restart     func(path string) error // Re-executes the new binary (replaced in tests)
+}
+
+// NewUpdater validates the auto-update configuration for the running binary
+func NewUpdater(config common.AutoUpdateConfig, transport http.RoundTripper) (*Updater, error) {
+	if config.ManifestURL == "" {
+		return nil, fmt.Errorf("auto_update.manifest_url is required")
+	}
+	if _, err := url.Parse(config.ManifestURL); err != nil {
+		return nil, fmt.Errorf("invalid auto_update.manifest_url: %w", err)
+	}
+	channel := config.Channel
+	if channel == "" {
+		channel = common.UpdateChannelStable
+	}
+	if channel != common.UpdateChannelStable && channel != common.UpdateChannelBeta {
+		return nil, fmt.Errorf("invalid auto_update.channel: %s (expected stable or beta)", channel)
+	}
+	publicKey, err := common.ParseUpdatePublicKey(config.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate agent binary: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+
+	return &Updater{
+		manifestURL: config.ManifestURL,
+		channel:     channel,
+		publicKey:   publicKey,
+		httpClient:  &http.Client{Transport: transport, Timeout: 10 * time.Minute},
+		version:     Version,
+		executable:  executable,
+		platform:    runtime.GOOS + "/" + runtime.GOARCH,
+		restart:     restartProcess,
+	}, nil
+}
+
+// Run polls the manifest every interval (with jitter so a fleet does not update in lockstep)
+// and restarts into the new binary after a successful update
+func (u *Updater) Run(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	for {
+		jitter := time.Duration(rand.Int63n(int64(interval)/10 + 1))
+		time.Sleep(interval + jitter)
+
+		release, err := u.checkForUpdate()
+		if err != nil {
+			LogWarnWithData("Agent update check failed", map[string]interface{}{
+				"channel": u.channel,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		if release == nil {
+			continue
+		}
+
+		LogInfoWithData("Agent updated, restarting", map[string]interface{}{
+			"from":    u.version,
+			"to":      release.Version,
+			"channel": u.channel,
+		})
+		if err := u.restart(u.executable); err != nil {
+			// The new binary is in place and runs on the next service restart
+			LogErrorWithData("Failed to restart into updated agent", map[string]interface{}{
+				"error": err.Error(),
+			})
+			u.version = release.Version
+		}
+	}
+}
+
+// checkForUpdate installs the channel's release if it is newer than the running version
+// Returns the installed release, or nil when already up to date (or ahead of the channel)
+func (u *Updater) checkForUpdate() (*common.UpdateRelease, error) {
+	manifestBytes, err := u.fetch(u.manifestURL, maxManifestBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+	signature, err := u.fetch(u.manifestURL+common.UpdateSignatureSuffix, maxManifestBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch manifest signature: %w", err)
+	}
+	if !common.VerifyUpdateManifest(u.publicKey, manifestBytes, string(signature)) {
+		return nil, fmt.Errorf("manifest signature verification failed")
+	}
+
+	var manifest common.UpdateManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	release, ok := manifest.Channels[u.channel]
+	if !ok || release.Version == "" {
+		return nil, fmt.Errorf("manifest has no release for channel %s", u.channel)
+	}
+	// Only strictly newer releases are installed, so a replayed older manifest (validly signed when it was
+	// current) cannot downgrade the fleet. Builds without a release version ("dev") take any release
+	if err := common.ValidateReleaseVersion(release.Version); err != nil {
+		return nil, fmt.Errorf("channel %s: %w", u.channel, err)
+	}
+	if cmp, err := common.CompareReleaseVersions(release.Version, u.version); err == nil && cmp <= 0 {
+		return nil, nil
+	}
+	binary, ok := release.Binaries[u.platform]
+	if !ok {
+		return nil, fmt.Errorf("release %s has no binary for %s", release.Version, u.platform)
+	}
+
+	if err := u.install(binary); err != nil {
+		return nil, fmt.Errorf("failed to install %s: %w", release.Version, err)
+	}
+	return &release, nil
+}
+
+// install downloads a binary next to the running one, verifies its checksum and renames it into place
+func (u *Updater) install(binary common.UpdateBinary) error {
+	binaryURL, err := u.resolve(binary.URL)
+	if err != nil {
+		return err
+	}
+	expected, err := hex.DecodeString(binary.SHA256)
+	if err != nil || len(expected) != sha256.Size {
+		return fmt.Errorf("invalid sha256 in manifest")
+	}
+
+	info, err := os.Stat(u.executable)
+	if err != nil {
+		return err
+	}
+
+	// Same directory as the binary so the final rename is atomic
+	tmp, err := os.CreateTemp(filepath.Dir(u.executable), "."+filepath.Base(u.executable)+".update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	resp, err := u.httpClient.Get(binaryURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("binary download returned %s", resp.Status)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), resp.Body); err != nil {
+		return fmt.Errorf("binary download failed: %w", err)
+	}
+	if actual := hash.Sum(nil); !strings.EqualFold(hex.EncodeToString(actual), hex.EncodeToString(expected)) {
+		return fmt.Errorf("checksum mismatch: expected %s, got %x", binary.SHA256, actual)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0o100); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), u.executable)
+}
+
+// resolve turns a binary URL from the manifest into an absolute URL
+func (u *Updater) resolve(ref string) (string, error) {
+	base, err := url.Parse(u.manifestURL)
+	if err != nil {
+		return "", err
+	}
+	target, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid binary URL: %w", err)
+	}
+	return base.ResolveReference(target).String(), nil
+}
+
+func (u *Updater) fetch(rawURL string, limit int64) ([]byte, error) {
+	resp, err := u.httpClient.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", rawURL, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
+
+// restartProcess replaces the running agent with the binary at path, keeping arguments and environment
+func restartProcess(path string) error {
+	return syscall.Exec(path, os.Args, os.Environ())
+}
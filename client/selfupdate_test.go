@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// releaseServer publishes a signed manifest for one stable release and its binary
+type releaseServer struct {
+	*httptest.Server
+	manifest  []byte
+	signature string
+	binary    []byte
+}
+
+func newReleaseServer(t *testing.T, key ed25519.PrivateKey, version string, binary []byte, checksum string) *releaseServer {
+	rs := &releaseServer{binary: binary}
+	rs.manifest, _ = json.Marshal(common.UpdateManifest{Channels: map[string]common.UpdateRelease{
+		"stable": {Version: version, Binaries: map[string]common.UpdateBinary{
+			"linux/amd64": {URL: "bin/opsen-client", SHA256: checksum},
+		}},
+	}})
+	rs.signature = common.SignUpdateManifest(key, rs.manifest)
+	rs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/releases/manifest.json":
+			w.Write(rs.manifest)
+		case "/releases/manifest.json.sig":
+			w.Write([]byte(rs.signature))
+		case "/releases/bin/opsen-client":
+			w.Write(rs.binary)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(rs.Close)
+	return rs
+}
+
+func newTestUpdater(t *testing.T, publicKey ed25519.PublicKey, manifestURL string) *Updater {
+	executable := filepath.Join(t.TempDir(), "opsen-client")
+	if err := os.WriteFile(executable, []byte("old binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &Updater{
+		manifestURL: manifestURL,
+		channel:     common.UpdateChannelStable,
+		publicKey:   publicKey,
+		httpClient:  &http.Client{},
+		version:     "1.0.0",
+		executable:  executable,
+		platform:    "linux/amd64",
+		restart:     func(string) error { return nil },
+	}
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// TestUpdater_InstallsSignedRelease verifies a new release is downloaded, verified and swapped in
+func TestUpdater_InstallsSignedRelease(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(nil)
+	newBinary := []byte("new binary")
+	rs := newReleaseServer(t, privateKey, "1.1.0", newBinary, checksum(newBinary))
+	updater := newTestUpdater(t, publicKey, rs.URL+"/releases/manifest.json")
+
+	release, err := updater.checkForUpdate()
+	if err != nil {
+		t.Fatalf("Expected update to succeed, got %v", err)
+	}
+	if release == nil || release.Version != "1.1.0" {
+		t.Fatalf("Expected release 1.1.0 to be installed, got %+v", release)
+	}
+	data, _ := os.ReadFile(updater.executable)
+	if string(data) != "new binary" {
+		t.Errorf("Expected binary to be replaced, got %q", data)
+	}
+	if info, _ := os.Stat(updater.executable); info.Mode().Perm()&0100 == 0 {
+		t.Errorf("Expected replaced binary to be executable, got %v", info.Mode())
+	}
+
+	updater.version = "1.1.0"
+	if release, err := updater.checkForUpdate(); err != nil || release != nil {
+		t.Errorf("Expected no update when already on the channel version, got %+v, %v", release, err)
+	}
+}
+
+// TestUpdater_RejectsTamperedReleases verifies bad signatures and checksums leave the binary untouched
+func TestUpdater_RejectsTamperedReleases(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(nil)
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	newBinary := []byte("new binary")
+
+	tests := []struct {
+		name    string
+		key     ed25519.PrivateKey
+		sum     string
+		wantErr string
+	}{
+		{"wrong signing key", otherKey, checksum(newBinary), "signature"},
+		{"checksum mismatch", privateKey, checksum([]byte("something else")), "checksum mismatch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newReleaseServer(t, tt.key, "1.1.0", newBinary, tt.sum)
+			updater := newTestUpdater(t, publicKey, rs.URL+"/releases/manifest.json")
+
+			_, err := updater.checkForUpdate()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+			data, _ := os.ReadFile(updater.executable)
+			if string(data) != "old binary" {
+				t.Errorf("Expected binary to be untouched, got %q", data)
+			}
+			entries, _ := os.ReadDir(filepath.Dir(updater.executable))
+			if len(entries) != 1 {
+				t.Errorf("Expected temporary download to be removed, got %d files", len(entries))
+			}
+		})
+	}
+}
+
+// TestNewUpdater_Validation verifies misconfigured auto-update settings are rejected
+func TestNewUpdater_Validation(t *testing.T) {
+	publicKey, _, _ := ed25519.GenerateKey(nil)
+	valid := common.AutoUpdateConfig{
+		ManifestURL: "https://releases.example.com/manifest.json",
+		PublicKey:   base64.StdEncoding.EncodeToString(publicKey),
+	}
+	if _, err := NewUpdater(valid, nil); err != nil {
+		t.Errorf("Expected valid config to be accepted, got %v", err)
+	}
+
+	badChannel := valid
+	badChannel.Channel = "nightly"
+	if _, err := NewUpdater(badChannel, nil); err == nil {
+		t.Error("Expected unknown channel to be rejected")
+	}
+
+	badKey := valid
+	badKey.PublicKey = "not-a-key"
+	if _, err := NewUpdater(badKey, nil); err == nil {
+		t.Error("Expected invalid public key to be rejected")
+	}
+}
+
+// TestUpdater_RefusesDowngrades verifies a replayed older manifest is not installed, while dev builds take any release
+func TestUpdater_RefusesDowngrades(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(nil)
+	oldBinary := []byte("vulnerable binary")
+	rs := newReleaseServer(t, privateKey, "0.9.0", oldBinary, checksum(oldBinary))
+	updater := newTestUpdater(t, publicKey, rs.URL+"/releases/manifest.json")
+
+	if release, err := updater.checkForUpdate(); err != nil || release != nil {
+		t.Errorf("Expected an older release to be ignored, got %+v, %v", release, err)
+	}
+	if data, _ := os.ReadFile(updater.executable); string(data) != "old binary" {
+		t.Errorf("Expected the binary to be untouched, got %q", data)
+	}
+
+	updater.version = "dev"
+	if release, err := updater.checkForUpdate(); err != nil || release == nil {
+		t.Errorf("Expected a dev build to install the channel release, got %+v, %v", release, err)
+	}
+}
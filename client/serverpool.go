@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lookupSRV resolves DNS SRV records (replaceable in tests)
+var lookupSRV = func(name string) ([]*net.SRV, error) {
+	_, records, err := net.LookupSRV("", "", name)
+	return records, err
+}
+
+// ServerPool tracks the load balancer servers an agent can report to
+// Requests go to the current primary; on failure the pool fails over to the next server
+// and periodically fails back to higher-priority servers once they are healthy again
+type ServerPool struct {
+	mu        sync.Mutex
+	static    []string // server_urls in priority order
+	srvName   string   // DNS SRV name (e.g. _opsen._tcp.example.com), empty if unused
+	srvScheme string   // URL scheme for SRV targets
+	servers   []string // static servers followed by SRV targets
+	current   int
+}
+
+// NewServerPool creates a pool from explicit URLs and an optional SRV name
+func NewServerPool(urls []string, srvName, srvScheme string) (*ServerPool, error) {
+	if srvScheme == "" {
+		srvScheme = "https"
+	}
+
+	pool := &ServerPool{srvName: srvName, srvScheme: srvScheme}
+	for _, u := range urls {
+		u = strings.TrimRight(strings.TrimSpace(u), "/")
+		if u != "" {
+			pool.static = append(pool.static, u)
+		}
+	}
+
+	if err := pool.Refresh(); err != nil && len(pool.static) == 0 {
+		return nil, err
+	}
+	if len(pool.servers) == 0 {
+		return nil, fmt.Errorf("no load balancer servers configured")
+	}
+	return pool, nil
+}
+
+// Refresh re-resolves the SRV record, keeping the current server selected if it is still listed
+func (p *ServerPool) Refresh() error {
+	var discovered []string
+	var lookupErr error
+	if p.srvName != "" {
+		records, err := lookupSRV(p.srvName)
+		if err != nil {
+			lookupErr = fmt.Errorf("SRV lookup for %s failed: %w", p.srvName, err)
+		} else {
+			discovered = srvTargetsToURLs(records, p.srvScheme)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Keep previously discovered servers if the lookup failed
+	if lookupErr != nil && len(p.servers) > 0 {
+		return lookupErr
+	}
+
+	previous := ""
+	if len(p.servers) > 0 {
+		previous = p.servers[p.current]
+	}
+
+	seen := make(map[string]bool)
+	servers := make([]string, 0, len(p.static)+len(discovered))
+	for _, u := range append(append([]string{}, p.static...), discovered...) {
+		if !seen[u] {
+			seen[u] = true
+			servers = append(servers, u)
+		}
+	}
+	p.servers = servers
+	p.current = 0
+	for i, u := range servers {
+		if u == previous {
+			p.current = i
+			break
+		}
+	}
+
+	return lookupErr
+}
+
+// srvTargetsToURLs orders SRV records by priority (then weight) and converts them to base URLs
+func srvTargetsToURLs(records []*net.SRV, scheme string) []string {
+	sorted := append([]*net.SRV(nil), records...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority < sorted[j].Priority
+		}
+		return sorted[i].Weight > sorted[j].Weight
+	})
+
+	urls := make([]string, 0, len(sorted))
+	for _, record := range sorted {
+		host := strings.TrimSuffix(record.Target, ".")
+		urls = append(urls, fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, strconv.Itoa(int(record.Port)))))
+	}
+	return urls
+}
+
+// Current returns the primary server URL
+func (p *ServerPool) Current() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.servers[p.current]
+}
+
+// Servers returns the servers in failover order, starting with the current primary
+func (p *ServerPool) Servers() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ordered := make([]string, 0, len(p.servers))
+	for i := 0; i < len(p.servers); i++ {
+		ordered = append(ordered, p.servers[(p.current+i)%len(p.servers)])
+	}
+	return ordered
+}
+
+// Failover moves the primary past a server that just failed
+// No-op if another caller already failed over away from it
+func (p *ServerPool) Failover(failed string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.servers) < 2 || p.servers[p.current] != failed {
+		return
+	}
+	p.current = (p.current + 1) % len(p.servers)
+	LogWarnWithData("Failing over to next load balancer server", map[string]interface{}{
+		"failed": failed,
+		"server": p.servers[p.current],
+	})
+}
+
+// FailBack switches to the highest-priority server that passes the health check
+// Returns true if the primary changed
+func (p *ServerPool) FailBack(healthy func(serverURL string) bool) bool {
+	p.mu.Lock()
+	candidates := append([]string(nil), p.servers[:p.current]...)
+	p.mu.Unlock()
+
+	for i, candidate := range candidates {
+		if !healthy(candidate) {
+			continue
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if i >= p.current || p.servers[i] != candidate {
+			return false
+		}
+		LogInfoWithData("Failing back to higher-priority load balancer server", map[string]interface{}{
+			"from":   p.servers[p.current],
+			"server": candidate,
+		})
+		p.current = i
+		return true
+	}
+	return false
+}
+
+// checkServerHealth reports whether a server answers /health with 200
+func (c *MetricsCollector) checkServerHealth(serverURL string) bool {
+	resp, err := c.httpClient.Get(serverURL + "/health")
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == 200
+}
+
+// maintainServerPool refreshes SRV discovery and fails back to preferred servers
+func (c *MetricsCollector) maintainServerPool(interval time.Duration) {
+	if c.servers == nil {
+		return
+	}
+	if interval <= 0 {
+		interval = 60 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := c.servers.Refresh(); err != nil {
+			LogWarn(fmt.Sprintf("Server discovery refresh failed: %v", err))
+		}
+		c.servers.FailBack(c.checkServerHealth)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakeLBServer records the agent requests it receives
+type fakeLBServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string
+	status   int
+}
+
+func newFakeLBServer(t *testing.T, status int) *fakeLBServer {
+	fake := &fakeLBServer{status: status}
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		fake.requests = append(fake.requests, r.URL.Path)
+		status := fake.status
+		fake.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+func (f *fakeLBServer) paths() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+// TestSendToServer_FailsOverOnError verifies a down or failing server is skipped and the next one becomes primary
+func TestSendToServer_FailsOverOnError(t *testing.T) {
+	failing := newFakeLBServer(t, http.StatusBadGateway)
+	healthy := newFakeLBServer(t, http.StatusOK)
+
+	pool, err := NewServerPool([]string{"http://127.0.0.1:1", failing.URL, healthy.URL}, "", "")
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+	collector := &MetricsCollector{httpClient: &http.Client{}, servers: pool}
+
+	resp, serverURL, err := collector.sendToServer("POST", "/stats", []byte(`{}`))
+	if err != nil {
+		t.Fatalf("Expected failover to succeed, got %v", err)
+	}
+	resp.Body.Close()
+
+	if serverURL != healthy.URL {
+		t.Errorf("Expected response from %s, got %s", healthy.URL, serverURL)
+	}
+	if pool.Current() != healthy.URL {
+		t.Errorf("Expected %s to become primary, got %s", healthy.URL, pool.Current())
+	}
+	if len(failing.paths()) != 1 {
+		t.Errorf("Expected failing server to be tried once, got %v", failing.paths())
+	}
+}
+
+// TestSendToServer_SingleServerReturnsErrorResponse verifies single-server mode still surfaces the server's status
+func TestSendToServer_SingleServerReturnsErrorResponse(t *testing.T) {
+	failing := newFakeLBServer(t, http.StatusServiceUnavailable)
+	collector := &MetricsCollector{httpClient: &http.Client{}, config: Config{ServerURL: failing.URL}}
+
+	resp, _, err := collector.sendToServer("POST", "/stats", []byte(`{}`))
+	if err != nil {
+		t.Fatalf("Expected the error response, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", resp.StatusCode)
+	}
+}
+
+// TestEnsureRegistered_AfterFailover verifies the agent re-registers with a new primary
+func TestEnsureRegistered_AfterFailover(t *testing.T) {
+	primary := newFakeLBServer(t, http.StatusOK)
+	secondary := newFakeLBServer(t, http.StatusOK)
+
+	pool, err := NewServerPool([]string{primary.URL, secondary.URL}, "", "")
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+	collector := &MetricsCollector{
+		httpClient:    &http.Client{},
+		servers:       pool,
+		config:        Config{SkipGeolocation: true, DiskPath: "/"},
+		gpuCollector:  &GPUCollector{},
+		registeredURL: primary.URL,
+	}
+
+	if err := collector.ensureRegistered(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(secondary.paths()) != 0 {
+		t.Fatalf("Expected no re-registration while primary is unchanged, got %v", secondary.paths())
+	}
+
+	pool.Failover(primary.URL)
+	if err := collector.ensureRegistered(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	paths := secondary.paths()
+	if len(paths) != 1 || paths[0] != "/register" {
+		t.Errorf("Expected registration with the new primary, got %v", paths)
+	}
+	if collector.registeredURL != secondary.URL {
+		t.Errorf("Expected registeredURL %s, got %s", secondary.URL, collector.registeredURL)
+	}
+}
+
+// TestServerPool_FailBack verifies the pool returns to a healthy higher-priority server
+func TestServerPool_FailBack(t *testing.T) {
+	pool, err := NewServerPool([]string{"http://lb-1", "http://lb-2", "http://lb-3"}, "", "")
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+	pool.Failover("http://lb-1")
+	pool.Failover("http://lb-2")
+
+	if pool.FailBack(func(string) bool { return false }) {
+		t.Error("Expected no failback while preferred servers are unhealthy")
+	}
+
+	changed := pool.FailBack(func(serverURL string) bool { return serverURL == "http://lb-2" })
+	if !changed || pool.Current() != "http://lb-2" {
+		t.Errorf("Expected failback to lb-2, got %s", pool.Current())
+	}
+}
+
+// TestServerPool_SRVDiscovery verifies SRV targets are ordered by priority and weight after static servers
+func TestServerPool_SRVDiscovery(t *testing.T) {
+	original := lookupSRV
+	defer func() { lookupSRV = original }()
+
+	lookupSRV = func(name string) ([]*net.SRV, error) {
+		if name != "_opsen._tcp.example.com" {
+			t.Errorf("Unexpected SRV name %s", name)
+		}
+		return []*net.SRV{
+			{Target: "lb-b.example.com.", Port: 8443, Priority: 20, Weight: 10},
+			{Target: "lb-a.example.com.", Port: 8443, Priority: 10, Weight: 5},
+			{Target: "lb-c.example.com.", Port: 9443, Priority: 10, Weight: 50},
+		}, nil
+	}
+
+	pool, err := NewServerPool([]string{"http://static:8080"}, "_opsen._tcp.example.com", "")
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+
+	expected := []string{
+		"http://static:8080",
+		"https://lb-c.example.com:9443",
+		"https://lb-a.example.com:8443",
+		"https://lb-b.example.com:8443",
+	}
+	servers := pool.Servers()
+	if len(servers) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, servers)
+	}
+	for i := range expected {
+		if servers[i] != expected[i] {
+			t.Errorf("Position %d: expected %s, got %s", i, expected[i], servers[i])
+		}
+	}
+
+	// A failed refresh keeps the previously discovered servers
+	lookupSRV = func(string) ([]*net.SRV, error) { return nil, errors.New("dns down") }
+	if err := pool.Refresh(); err == nil {
+		t.Error("Expected refresh error")
+	}
+	if len(pool.Servers()) != len(expected) {
+		t.Errorf("Expected discovered servers to be kept, got %v", pool.Servers())
+	}
+}
+
+// TestNewServerPool_SRVFailureWithoutStatic verifies startup fails when nothing can be discovered
+func TestNewServerPool_SRVFailureWithoutStatic(t *testing.T) {
+	original := lookupSRV
+	defer func() { lookupSRV = original }()
+	lookupSRV = func(string) ([]*net.SRV, error) { return nil, errors.New("nxdomain") }
+
+	if _, err := NewServerPool(nil, "_opsen._tcp.example.com", ""); err == nil {
+		t.Error("Expected error when SRV lookup fails and no static servers are configured")
+	}
+}
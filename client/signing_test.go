@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io"
+	"strconv"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestNewServerRequest_HMAC verifies signed requests carry a verifiable signature and no key
+func TestNewServerRequest_HMAC(t *testing.T) {
+	collector := &MetricsCollector{config: Config{
+		ServerURL: "http://lb.example.com",
+		ServerKey: "secret",
+		AuthMode:  common.AuthModeHMAC,
+	}}
+
+	body := []byte(`{"client_id":"agent-1"}`)
+	req, err := collector.newServerRequest("POST", "/stats", body)
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+
+	if req.Header.Get("X-API-Key") != "" {
+		t.Error("Expected no X-API-Key header in hmac mode")
+	}
+
+	timestamp, err := strconv.ParseInt(req.Header.Get(common.SignatureTimestampHeader), 10, 64)
+	if err != nil {
+		t.Fatalf("Invalid timestamp header: %v", err)
+	}
+	sent, _ := io.ReadAll(req.Body)
+	if !common.VerifySignature("secret", timestamp, req.Header.Get(common.SignatureNonceHeader),
+		req.Method, req.URL.Path, sent, req.Header.Get(common.SignatureHeader)) {
+		t.Error("Expected request signature to verify")
+	}
+}
+
+// TestNewServerRequest_Key verifies key mode sends the X-API-Key header
+func TestNewServerRequest_Key(t *testing.T) {
+	collector := &MetricsCollector{config: Config{
+		ServerURL: "http://lb.example.com",
+		ServerKey: "secret",
+		AuthMode:  common.AuthModeKey,
+	}}
+
+	req, err := collector.newServerRequest("POST", "/register", []byte(`{}`))
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	if req.Header.Get("X-API-Key") != "secret" {
+		t.Errorf("Expected X-API-Key header, got %q", req.Header.Get("X-API-Key"))
+	}
+	if req.Header.Get(common.SignatureHeader) != "" {
+		t.Error("Expected no signature header in key mode")
+	}
+}
+
+// TestValidateAuthMode verifies unknown modes and hmac without a server key are rejected
+func TestValidateAuthMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"default", Config{ServerKey: "secret"}, false},
+		{"key", Config{ServerKey: "secret", AuthMode: common.AuthModeKey}, false},
+		{"hmac", Config{ServerKey: "secret", AuthMode: common.AuthModeHMAC}, false},
+		{"key without server key", Config{AuthMode: common.AuthModeKey}, false},
+		{"hmac without server key", Config{AuthMode: common.AuthModeHMAC}, true},
+		{"typo", Config{ServerKey: "secret", AuthMode: "hamc"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAuthMode(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateAuthMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"cyqle.in/opsen/common"
+)
+
+// procRoot is where file handle, port range and socket tables are read from
+var procRoot = "/proc"
+
+// tcpStates names the hex st column of /proc/net/tcp (include/net/tcp_states.h)
+var tcpStates = map[string]string{
+	"01": "established",
+	"02": "syn_sent",
+	"03": "syn_recv",
+	"04": "fin_wait1",
+	"05": "fin_wait2",
+	"06": "time_wait",
+	"07": "close",
+	"08": "close_wait",
+	"09": "last_ack",
+	"0A": "listen",
+	"0B": "closing",
+}
+
+// readSocketStats collects file handle usage, TCP sockets by state and ephemeral port usage
+// Returns nil if the host exposes none of it (non-Linux)
+func readSocketStats() *common.SocketStats {
+	sockets := &common.SocketStats{}
+	found := false
+
+	if fields := strings.Fields(readProcString("sys/fs/file-nr")); len(fields) == 3 {
+		// "allocated unused max"; unused has been 0 since Linux 2.6
+		allocated, errA := strconv.Atoi(fields[0])
+		maximum, errM := strconv.Atoi(fields[2])
+		if errA == nil && errM == nil {
+			sockets.OpenFDs = allocated
+			sockets.MaxFDs = maximum
+			found = true
+		}
+	}
+
+	low, high, rangeOK := readEphemeralPortRange()
+	if rangeOK {
+		sockets.EphemeralPortsTotal = high - low + 1
+	}
+
+	ports := make(map[int]bool)
+	for _, table := range []string{"net/tcp", "net/tcp6"} {
+		if readTCPTable(filepath.Join(procRoot, table), sockets, func(port int) {
+			if rangeOK && port >= low && port <= high {
+				ports[port] = true
+			}
+		}) {
+			found = true
+		}
+	}
+	sockets.EphemeralPortsUsed = len(ports)
+
+	if !found {
+		return nil
+	}
+	return sockets
+}
+
+// readEphemeralPortRange reads net.ipv4.ip_local_port_range (also used for IPv6)
+func readEphemeralPortRange() (int, int, bool) {
+	fields := strings.Fields(readProcString("sys/net/ipv4/ip_local_port_range"))
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+	low, errL := strconv.Atoi(fields[0])
+	high, errH := strconv.Atoi(fields[1])
+	if errL != nil || errH != nil || high < low {
+		return 0, 0, false
+	}
+	return low, high, true
+}
+
+// readTCPTable counts the sockets of one /proc/net/tcp-format table by state and reports the local port of
+// every socket that is not listening. Returns false if the table cannot be read
+func readTCPTable(path string, sockets *common.SocketStats, localPort func(int)) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // Header line
+	for scanner.Scan() {
+		// "sl local_address rem_address st ...", addresses as hex IP:port
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		state, ok := tcpStates[fields[3]]
+		if !ok {
+			continue
+		}
+		if sockets.TCPStates == nil {
+			sockets.TCPStates = make(map[string]int)
+		}
+		sockets.TCPStates[state]++
+		if state == "listen" {
+			continue
+		}
+		sockets.TCPConnections++
+
+		_, hexPort, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		if port, err := strconv.ParseUint(hexPort, 16, 16); err == nil {
+			localPort(int(port))
+		}
+	}
+	return scanner.Err() == nil
+}
+
+// readProcString returns a trimmed /proc file relative to procRoot, or "" if it cannot be read
+func readProcString(name string) string {
+	data, err := os.ReadFile(filepath.Join(procRoot, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestReadSocketStats verifies file handles, TCP states and ephemeral ports are read from /proc
+func TestReadSocketStats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"sys/fs/file-nr":                   "4096\t0\t8192\n",
+		"sys/net/ipv4/ip_local_port_range": "32768\t32777\n",
+		"net/tcp": "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+			"   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1 1\n" +
+			"   1: 0100007F:8000 0100007F:1F90 01 00000000:00000000 00:00000000 00000000     0        0 2 1\n" +
+			"   2: 0100007F:8001 0A000001:01BB 06 00000000:00000000 00:00000000 00000000     0        0 0 1\n" +
+			"   3: 0100007F:1F90 0100007F:8000 01 00000000:00000000 00:00000000 00000000     0        0 3 1\n",
+		"net/tcp6": "  sl  local_address                         remote_address                        st tx_queue rx_queue\n" +
+			"   0: 00000000000000000000000001000000:8001 00000000000000000000000001000000:01BB 08 00000000:00000000\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	original := procRoot
+	procRoot = dir
+	defer func() { procRoot = original }()
+
+	sockets := readSocketStats()
+	if sockets == nil {
+		t.Fatal("Expected socket stats, got nil")
+	}
+	if sockets.OpenFDs != 4096 || sockets.MaxFDs != 8192 || sockets.FDUsagePct() != 50 {
+		t.Errorf("Unexpected file handle usage: %+v", sockets)
+	}
+	if sockets.TCPStates["listen"] != 1 || sockets.TCPStates["established"] != 2 ||
+		sockets.TCPStates["time_wait"] != 1 || sockets.TCPStates["close_wait"] != 1 {
+		t.Errorf("Unexpected TCP states: %v", sockets.TCPStates)
+	}
+	if sockets.TCPConnections != 4 {
+		t.Errorf("Expected 4 non-listening sockets, got %d", sockets.TCPConnections)
+	}
+	// Ports 0x8000 and 0x8001 are in range (0x8001 is shared by IPv4 and IPv6 sockets); 8080 is not
+	if sockets.EphemeralPortsUsed != 2 || sockets.EphemeralPortsTotal != 10 || sockets.EphemeralPortUsagePct() != 20 {
+		t.Errorf("Unexpected ephemeral port usage: %+v", sockets)
+	}
+}
+
+// TestReadSocketStats_Unavailable verifies nil is returned on hosts without /proc
+func TestReadSocketStats_Unavailable(t *testing.T) {
+	original := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = original }()
+
+	if sockets := readSocketStats(); sockets != nil {
+		t.Errorf("Expected nil without /proc files, got %+v", sockets)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"cyqle.in/opsen/common"
+)
+
+// statsReplayBatch is the number of spooled reports sent per POST /stats/batch
+const statsReplayBatch = 100
+
+// errStatsRejected marks reports the server refused (4xx); they are not spooled for replay
+var errStatsRejected = errors.New("stats report rejected")
+
+// StatsSpool is a bounded on-disk queue of reports that could not be delivered
+// One JSON report per line; once full, the oldest reports are evicted. Only used by the reporting loop
+type StatsSpool struct {
+	path    string
+	max     int
+	reports []json.RawMessage
+}
+
+// OpenStatsSpool loads a spool file, or returns nil if path is empty (spooling disabled)
+// Unreadable lines (e.g. a write cut short by a crash) are skipped
+func OpenStatsSpool(path string, maxReports int) (*StatsSpool, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if maxReports <= 0 {
+		maxReports = 1000
+	}
+	spool := &StatsSpool{path: path, max: maxReports}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return spool, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) > 0 && json.Valid(line) {
+			spool.reports = append(spool.reports, json.RawMessage(append([]byte(nil), line...)))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stats spool: %w", err)
+	}
+	if over := len(spool.reports) - spool.max; over > 0 {
+		spool.reports = spool.reports[over:]
+		return spool, spool.rewrite()
+	}
+	return spool, nil
+}
+
+// Len returns the number of spooled reports
+func (s *StatsSpool) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.reports)
+}
+
+// Add spools a report, evicting the oldest one when the spool is full
+func (s *StatsSpool) Add(stats common.ResourceStats) error {
+	report, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	s.reports = append(s.reports, report)
+	if over := len(s.reports) - s.max; over > 0 {
+		s.reports = s.reports[over:]
+		return s.rewrite()
+	}
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(report, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Peek returns up to n of the oldest spooled reports
+func (s *StatsSpool) Peek(n int) []json.RawMessage {
+	return s.reports[:min(n, len(s.reports))]
+}
+
+// Drop removes the n oldest reports (after they were delivered)
+func (s *StatsSpool) Drop(n int) error {
+	s.reports = s.reports[min(n, len(s.reports)):]
+	return s.rewrite()
+}
+
+// rewrite replaces the spool file with the in-memory reports (via a temp file and rename)
+func (s *StatsSpool) rewrite() error {
+	if len(s.reports) == 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	for _, report := range s.reports {
+		w.Write(report)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// spoolOrReplay spools a report that could not be delivered, or replays the spool once reports go through again
+// Returns whether the report was delivered or spooled, i.e. its contents will reach the server
+func (c *MetricsCollector) spoolOrReplay(stats common.ResourceStats, err error) bool {
+	if c.spool == nil {
+		return err == nil
+	}
+	if err == nil {
+		if c.spool.Len() > 0 {
+			c.replaySpool()
+		}
+		return true
+	}
+	if errors.Is(err, errStatsRejected) {
+		return false
+	}
+	if err := c.spool.Add(stats); err != nil {
+		LogWarn(fmt.Sprintf("Failed to spool undelivered stats report: %v", err))
+		return false
+	}
+	return true
+}
+
+// replaySpool sends spooled reports oldest first via POST /stats/batch
+// Stops at the first connection error or 5xx and resumes after the next successful report
+func (c *MetricsCollector) replaySpool() {
+	replayed := 0
+	for c.spool.Len() > 0 {
+		reports := c.spool.Peek(statsReplayBatch)
+		body, err := json.Marshal(map[string][]json.RawMessage{"reports": reports})
+		if err != nil {
+			LogWarn(fmt.Sprintf("Failed to encode spooled stats: %v", err))
+			return
+		}
+
+		resp, _, err := c.sendToServer("POST", "/stats/batch", body)
+		if err != nil {
+			LogWarn(fmt.Sprintf("Spooled stats replay failed, will retry: %v", err))
+			return
+		}
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			replayed += len(reports)
+		case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed:
+			// Servers without /stats/batch can never take the spool
+			LogWarn(fmt.Sprintf("Server does not accept /stats/batch, discarding %d spooled stats reports", c.spool.Len()))
+			reports = c.spool.Peek(c.spool.Len())
+		case resp.StatusCode < 500:
+			LogWarn(fmt.Sprintf("Server rejected %d spooled stats reports, discarding them: %s: %s",
+				len(reports), resp.Status, bytes.TrimSpace(detail)))
+		default:
+			LogWarn(fmt.Sprintf("Spooled stats replay failed, will retry: %s", resp.Status))
+			return
+		}
+
+		if err := c.spool.Drop(len(reports)); err != nil {
+			LogWarn(fmt.Sprintf("Failed to update stats spool: %v", err))
+			return
+		}
+	}
+
+	if replayed > 0 {
+		LogInfoWithData("Replayed spooled stats reports", map[string]interface{}{
+			"reports": replayed,
+		})
+	}
+}
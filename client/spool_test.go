@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestStatsSpool_EvictsOldestAndPersists verifies the spool is bounded and survives a restart
+func TestStatsSpool_EvictsOldestAndPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spool.jsonl")
+	spool, err := OpenStatsSpool(path, 3)
+	if err != nil {
+		t.Fatalf("OpenStatsSpool failed: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		if err := spool.Add(common.ResourceStats{ClientID: "agent-1", CPUCores: i}); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	reopened, err := OpenStatsSpool(path, 3)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	if reopened.Len() != 3 {
+		t.Fatalf("Expected 3 spooled reports after eviction, got %d", reopened.Len())
+	}
+	var oldest common.ResourceStats
+	json.Unmarshal(reopened.Peek(1)[0], &oldest)
+	if oldest.CPUCores != 3 {
+		t.Errorf("Expected the two oldest reports to be evicted, oldest is #%d", oldest.CPUCores)
+	}
+
+	if err := reopened.Drop(3); err != nil {
+		t.Fatalf("Drop failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected the spool file to be removed once empty")
+	}
+
+	if disabled, _ := OpenStatsSpool("", 0); disabled != nil || disabled.Len() != 0 {
+		t.Error("Expected an empty path to disable spooling")
+	}
+}
+
+// TestSpoolOrReplay verifies undelivered reports are spooled and replayed via /stats/batch once reports succeed
+func TestSpoolOrReplay(t *testing.T) {
+	var batches []common.StatsBatch
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stats/batch" {
+			http.NotFound(w, r)
+			return
+		}
+		var batch common.StatsBatch
+		json.NewDecoder(r.Body).Decode(&batch)
+		batches = append(batches, batch)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "received", "accepted": len(batch.Reports)})
+	}))
+	defer server.Close()
+
+	spool, _ := OpenStatsSpool(filepath.Join(t.TempDir(), "spool.jsonl"), 1000)
+	collector := &MetricsCollector{
+		config:     Config{ServerURL: server.URL, ClientID: "agent-1"},
+		httpClient: &http.Client{},
+		spool:      spool,
+	}
+
+	collector.spoolOrReplay(common.ResourceStats{ClientID: "agent-1", Timestamp: time.Now()}, ErrCircuitOpen)
+	collector.spoolOrReplay(common.ResourceStats{ClientID: "agent-1", Timestamp: time.Now()}, errors.New("connection refused"))
+	collector.spoolOrReplay(common.ResourceStats{ClientID: "agent-1"}, errStatsRejected)
+	if spool.Len() != 2 {
+		t.Fatalf("Expected 2 spooled reports (rejected ones are not retried), got %d", spool.Len())
+	}
+
+	collector.spoolOrReplay(common.ResourceStats{ClientID: "agent-1"}, nil)
+	if len(batches) != 1 || len(batches[0].Reports) != 2 {
+		t.Fatalf("Expected one batch of 2 replayed reports, got %+v", batches)
+	}
+	if spool.Len() != 0 {
+		t.Errorf("Expected the spool to be empty after replay, got %d", spool.Len())
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+
+	"cyqle.in/opsen/common"
+)
+
+// gzipBody compresses a request body for Content-Encoding: gzip
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(body); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendStats reports stats, delta-encoded when possible
+// A 409 means the server lost the delta base (restart or failover), so the report is resent in full
+func (c *MetricsCollector) sendStats(stats common.ResourceStats) (*http.Response, string, error) {
+	body, fields, delta, err := c.encodeStats(stats)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, serverURL, err := c.sendToServer("POST", "/stats", body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if delta && resp.StatusCode == http.StatusConflict {
+		resp.Body.Close()
+		LogInfo("Server has no delta base for this agent, sending full stats snapshot")
+		c.deltaBase = nil
+		if body, fields, delta, err = c.encodeStats(stats); err != nil {
+			return nil, "", err
+		}
+		if resp, serverURL, err = c.sendToServer("POST", "/stats", body); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		c.statsAccepted(resp, fields, stats.Seq, delta)
+	}
+	return resp, serverURL, nil
+}
+
+// encodeStats returns the /stats body and whether it is a delta
+// Deltas are only sent once the server advertised support and accepted a full snapshot to base them on
+func (c *MetricsCollector) encodeStats(stats common.ResourceStats) ([]byte, map[string]json.RawMessage, bool, error) {
+	full, err := json.Marshal(stats)
+	if err != nil || !c.config.StatsDelta {
+		return full, nil, false, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(full, &fields); err != nil {
+		return nil, nil, false, err
+	}
+
+	if c.deltaBase == nil || !c.deltaSupported || c.deltasSinceFull+1 >= c.config.StatsFullEvery {
+		return full, fields, false, nil
+	}
+
+	changes := map[string]json.RawMessage{
+		"client_id": fields["client_id"],
+		"delta":     json.RawMessage("true"),
+	}
+	changes["base_seq"], _ = json.Marshal(c.deltaBaseSeq)
+	for key, value := range fields {
+		if !bytes.Equal(c.deltaBase[key], value) {
+			changes[key] = value
+		}
+	}
+	// Fields omitted since the base (e.g. GPUs gone) must be cleared on the server
+	for key := range c.deltaBase {
+		if _, ok := fields[key]; !ok {
+			changes[key] = json.RawMessage("null")
+		}
+	}
+
+	body, err := json.Marshal(changes)
+	return body, fields, true, err
+}
+
+// statsAccepted logs fields the server had to correct and records an accepted report as the base for the next delta
+func (c *MetricsCollector) statsAccepted(resp *http.Response, fields map[string]json.RawMessage, seq uint64, delta bool) {
+	var result common.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		result = common.StatsResponse{}
+	}
+	if len(result.FieldErrors) > 0 {
+		LogWarnWithData("Server corrected invalid stats fields", map[string]interface{}{
+			"field_errors": result.FieldErrors,
+		})
+	}
+
+	if !c.config.StatsDelta {
+		return
+	}
+	c.deltaSupported = result.StatsDelta == common.StatsDeltaSupported
+	c.deltaBase = fields
+	c.deltaBaseSeq = seq
+	if delta {
+		c.deltasSinceFull++
+	} else {
+		c.deltasSinceFull = 0
+	}
+}
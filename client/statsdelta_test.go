@@ -0,0 +1,75 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestSendStats_Delta verifies unchanged fields are dropped after a full snapshot and a 409 triggers a full resend
+func TestSendStats_Delta(t *testing.T) {
+	var reports []map[string]interface{}
+	conflict := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, "bad gzip", http.StatusBadRequest)
+				return
+			}
+			body = gz
+		}
+		var report map[string]interface{}
+		json.NewDecoder(body).Decode(&report)
+		reports = append(reports, report)
+
+		if conflict && report["delta"] == true {
+			http.Error(w, "delta base mismatch", http.StatusConflict)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "received", "stats_delta": common.StatsDeltaSupported})
+	}))
+	defer server.Close()
+
+	collector := &MetricsCollector{
+		config:     Config{ServerURL: server.URL, ClientID: "agent-1", CompressRequests: true, StatsDelta: true, StatsFullEvery: 10},
+		httpClient: &http.Client{},
+	}
+	send := func(seq uint64, memoryUsed float64) {
+		stats := common.ResourceStats{
+			ClientID: "agent-1", Seq: seq, Timestamp: time.Now(),
+			CPUUsageAvg: []float64{10, 20}, MemoryTotal: 16, MemoryUsed: memoryUsed,
+		}
+		resp, _, err := collector.sendStats(stats)
+		if err != nil {
+			t.Fatalf("sendStats failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	send(1, 4)
+	send(2, 5)
+	if len(reports) != 2 || reports[0]["delta"] != nil {
+		t.Fatalf("Expected a full first report, got %+v", reports)
+	}
+	delta := reports[1]
+	if delta["delta"] != true || delta["base_seq"] != float64(1) || delta["memory_used_gb"] != float64(5) {
+		t.Errorf("Expected delta against seq 1 with the changed field, got %+v", delta)
+	}
+	if _, ok := delta["memory_total_gb"]; ok {
+		t.Errorf("Expected unchanged fields to be omitted, got %+v", delta)
+	}
+
+	conflict = true
+	send(3, 6)
+	if len(reports) != 4 || reports[3]["delta"] != nil || reports[3]["memory_total_gb"] != float64(16) {
+		t.Errorf("Expected a full resend after 409, got %+v", reports[2:])
+	}
+}
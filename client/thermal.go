@@ -0,0 +1,241 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// sysfsRoot is where hwmon, powercap and CPU thermal_throttle files are read from
+var sysfsRoot = "/sys"
+
+// cpuHwmonDrivers are hwmon drivers that report CPU package temperatures
+var cpuHwmonDrivers = map[string]bool{
+	"coretemp":    true, // Intel
+	"k10temp":     true, // AMD
+	"zenpower":    true, // AMD (out-of-tree)
+	"cpu_thermal": true, // ARM SoCs
+}
+
+// ThermalCollector reads CPU temperatures, fans, throttle events and power draw
+// RAPL energy and throttle counters are cumulative, so each reading reports the change since the previous one
+type ThermalCollector struct {
+	lastEnergy    map[string]raplReading // RAPL package energy by powercap domain
+	lastThrottles uint64
+	haveThrottles bool
+}
+
+type raplReading struct {
+	energyUJ uint64
+	maxUJ    uint64
+	at       time.Time
+}
+
+// NewThermalCollector creates a collector; the first Read has no power or throttle deltas yet
+func NewThermalCollector() *ThermalCollector {
+	return &ThermalCollector{lastEnergy: make(map[string]raplReading)}
+}
+
+// Read collects thermal and power telemetry
+// Returns nil if the host exposes none of it (VMs, containers without /sys, non-Linux)
+// Safe to call on a nil collector
+func (t *ThermalCollector) Read() *common.ThermalStats {
+	if t == nil {
+		return nil
+	}
+
+	thermal := &common.ThermalStats{}
+	found := false
+
+	hwmons, _ := filepath.Glob(filepath.Join(sysfsRoot, "class/hwmon/hwmon*"))
+	sort.Strings(hwmons)
+	for _, dir := range hwmons {
+		name := readSysfsString(filepath.Join(dir, "name"))
+		if cpuHwmonDrivers[name] {
+			if temp, ok := readPackageTemp(dir); ok {
+				thermal.CPUPackageTempsC = append(thermal.CPUPackageTempsC, temp)
+				thermal.CPUTempC = max(thermal.CPUTempC, temp)
+				found = true
+			}
+		}
+		if name == "power_meter" {
+			if watts, ok := readHwmonPower(dir); ok {
+				thermal.ChassisPowerW += watts
+				found = true
+			}
+		}
+		fans := readHwmonFans(dir, name)
+		if len(fans) > 0 {
+			thermal.Fans = append(thermal.Fans, fans...)
+			found = true
+		}
+	}
+
+	if watts, ok := t.readRAPLPower(time.Now()); ok {
+		thermal.CPUPowerW = watts
+		found = true
+	}
+
+	if events, ok := t.readThrottleEvents(); ok {
+		thermal.CPUThrottleEvents = events
+		thermal.CPUThrottling = events > 0
+		found = true
+	}
+
+	if !found {
+		return nil
+	}
+	return thermal
+}
+
+// readPackageTemp returns the package temperature of one CPU hwmon device in Celsius
+// coretemp labels it "Package id N", k10temp "Tctl"/"Tdie"; otherwise temp1 is used
+func readPackageTemp(dir string) (float64, bool) {
+	inputs, _ := filepath.Glob(filepath.Join(dir, "temp*_input"))
+	sort.Strings(inputs)
+
+	fallback, haveFallback := 0.0, false
+	for _, input := range inputs {
+		millideg, ok := readSysfsFloat(input)
+		if !ok {
+			continue
+		}
+		label := readSysfsString(strings.TrimSuffix(input, "_input") + "_label")
+		if strings.HasPrefix(label, "Package id") || label == "Tdie" || label == "Tctl" {
+			return millideg / 1000, true
+		}
+		if !haveFallback && strings.HasSuffix(input, "temp1_input") {
+			fallback, haveFallback = millideg/1000, true
+		}
+	}
+	return fallback, haveFallback
+}
+
+// readHwmonPower returns a power meter reading in Watts (hwmon reports microwatts)
+func readHwmonPower(dir string) (float64, bool) {
+	for _, file := range []string{"power1_average", "power1_input"} {
+		if microwatts, ok := readSysfsFloat(filepath.Join(dir, file)); ok {
+			return microwatts / 1e6, true
+		}
+	}
+	return 0, false
+}
+
+// readHwmonFans returns the fans of one hwmon device
+func readHwmonFans(dir, device string) []common.FanStats {
+	inputs, _ := filepath.Glob(filepath.Join(dir, "fan*_input"))
+	sort.Strings(inputs)
+
+	var fans []common.FanStats
+	for _, input := range inputs {
+		rpm, ok := readSysfsFloat(input)
+		if !ok {
+			continue
+		}
+		prefix := strings.TrimSuffix(input, "_input")
+		name := readSysfsString(prefix + "_label")
+		if name == "" {
+			name = device + "/" + filepath.Base(prefix)
+		}
+		alarm, _ := readSysfsFloat(prefix + "_alarm")
+		fault, _ := readSysfsFloat(prefix + "_fault")
+		minRPM, _ := readSysfsFloat(prefix + "_min")
+		fans = append(fans, common.FanStats{
+			Name:   name,
+			RPM:    rpm,
+			Failed: alarm != 0 || fault != 0 || (rpm == 0 && minRPM > 0),
+		})
+	}
+	return fans
+}
+
+// readRAPLPower returns CPU package power averaged since the previous call
+// Only top-level package domains (intel-rapl:N) are summed; subdomains are already included in them
+func (t *ThermalCollector) readRAPLPower(now time.Time) (float64, bool) {
+	domains, _ := filepath.Glob(filepath.Join(sysfsRoot, "class/powercap/intel-rapl:*"))
+
+	watts, measured := 0.0, false
+	for _, dir := range domains {
+		if strings.Count(filepath.Base(dir), ":") != 1 {
+			continue
+		}
+		energy, ok := readSysfsUint(filepath.Join(dir, "energy_uj"))
+		if !ok {
+			continue
+		}
+		maxRange, _ := readSysfsUint(filepath.Join(dir, "max_energy_range_uj"))
+
+		previous, seen := t.lastEnergy[dir]
+		t.lastEnergy[dir] = raplReading{energyUJ: energy, maxUJ: maxRange, at: now}
+		elapsed := now.Sub(previous.at).Seconds()
+		if !seen || elapsed <= 0 {
+			continue
+		}
+
+		used := energy - previous.energyUJ
+		if energy < previous.energyUJ {
+			// The counter wrapped around max_energy_range_uj
+			if maxRange == 0 {
+				continue
+			}
+			used = maxRange - previous.energyUJ + energy
+		}
+		watts += float64(used) / 1e6 / elapsed
+		measured = true
+	}
+	return watts, measured
+}
+
+// readThrottleEvents returns package thermal throttle events since the previous call
+// package_throttle_count is per package but exposed on every CPU, so it is counted once per physical package
+func (t *ThermalCollector) readThrottleEvents() (uint64, bool) {
+	cpus, _ := filepath.Glob(filepath.Join(sysfsRoot, "devices/system/cpu/cpu[0-9]*"))
+
+	packages := make(map[string]uint64)
+	for _, cpu := range cpus {
+		count, ok := readSysfsUint(filepath.Join(cpu, "thermal_throttle/package_throttle_count"))
+		if !ok {
+			continue
+		}
+		pkg := readSysfsString(filepath.Join(cpu, "topology/physical_package_id"))
+		packages[pkg] = max(packages[pkg], count)
+	}
+	if len(packages) == 0 {
+		return 0, false
+	}
+
+	total := uint64(0)
+	for _, count := range packages {
+		total += count
+	}
+
+	previous, seen := t.lastThrottles, t.haveThrottles
+	t.lastThrottles, t.haveThrottles = total, true
+	if !seen || total < previous {
+		return 0, true
+	}
+	return total - previous, true
+}
+
+func readSysfsString(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func readSysfsFloat(path string) (float64, bool) {
+	value, err := strconv.ParseFloat(readSysfsString(path), 64)
+	return value, err == nil
+}
+
+func readSysfsUint(path string) (uint64, bool) {
+	value, err := strconv.ParseUint(readSysfsString(path), 10, 64)
+	return value, err == nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeSysfsFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+// TestThermalCollector_Read verifies temperatures, fans, power and throttle events are read from sysfs
+func TestThermalCollector_Read(t *testing.T) {
+	root := t.TempDir()
+	writeSysfsFiles(t, root, map[string]string{
+		"class/hwmon/hwmon0/name":           "coretemp",
+		"class/hwmon/hwmon0/temp1_input":    "71000",
+		"class/hwmon/hwmon0/temp1_label":    "Package id 0",
+		"class/hwmon/hwmon0/temp2_input":    "90000",
+		"class/hwmon/hwmon0/temp2_label":    "Core 0",
+		"class/hwmon/hwmon1/name":           "k10temp",
+		"class/hwmon/hwmon1/temp1_input":    "64500",
+		"class/hwmon/hwmon1/temp1_label":    "Tctl",
+		"class/hwmon/hwmon2/name":           "nct6775",
+		"class/hwmon/hwmon2/fan1_input":     "1200",
+		"class/hwmon/hwmon2/fan1_label":     "CPU_FAN",
+		"class/hwmon/hwmon2/fan2_input":     "0",
+		"class/hwmon/hwmon2/fan2_min":       "300",
+		"class/hwmon/hwmon3/name":           "power_meter",
+		"class/hwmon/hwmon3/power1_average": "245000000",
+
+		"class/powercap/intel-rapl:0/energy_uj":           "1000000",
+		"class/powercap/intel-rapl:0/max_energy_range_uj": "262143328850",
+		"class/powercap/intel-rapl:0:0/energy_uj":         "500000",
+
+		"devices/system/cpu/cpu0/thermal_throttle/package_throttle_count": "10",
+		"devices/system/cpu/cpu0/topology/physical_package_id":            "0",
+		"devices/system/cpu/cpu1/thermal_throttle/package_throttle_count": "10",
+		"devices/system/cpu/cpu1/topology/physical_package_id":            "0",
+	})
+
+	original := sysfsRoot
+	sysfsRoot = root
+	defer func() { sysfsRoot = original }()
+
+	collector := NewThermalCollector()
+	thermal := collector.Read()
+	if thermal == nil {
+		t.Fatal("Expected thermal stats, got nil")
+	}
+	if thermal.CPUTempC != 71.0 || len(thermal.CPUPackageTempsC) != 2 {
+		t.Errorf("Expected hottest package 71C from 2 packages, got %.1fC from %v", thermal.CPUTempC, thermal.CPUPackageTempsC)
+	}
+	if thermal.ChassisPowerW != 245.0 {
+		t.Errorf("Expected chassis power 245W, got %.1fW", thermal.ChassisPowerW)
+	}
+	if len(thermal.Fans) != 2 || thermal.Fans[0].Name != "CPU_FAN" || thermal.Fans[0].Failed {
+		t.Fatalf("Unexpected fans: %+v", thermal.Fans)
+	}
+	if thermal.Fans[1].Name != "nct6775/fan2" || !thermal.Fans[1].Failed {
+		t.Errorf("Expected stopped fan below its minimum to be failed, got %+v", thermal.Fans[1])
+	}
+	if thermal.CPUPowerW != 0 || thermal.CPUThrottling {
+		t.Errorf("Expected no power or throttle deltas on the first read, got %+v", thermal)
+	}
+
+	// 30J over the interval since the first reading, and 3 new throttle events
+	collector.lastEnergy[filepath.Join(root, "class/powercap/intel-rapl:0")] = raplReading{
+		energyUJ: 1000000, maxUJ: 262143328850, at: time.Now().Add(-10 * time.Second),
+	}
+	writeSysfsFiles(t, root, map[string]string{
+		"class/powercap/intel-rapl:0/energy_uj":                           "31000000",
+		"devices/system/cpu/cpu0/thermal_throttle/package_throttle_count": "13",
+		"devices/system/cpu/cpu1/thermal_throttle/package_throttle_count": "13",
+	})
+
+	thermal = collector.Read()
+	if thermal.CPUPowerW < 2.9 || thermal.CPUPowerW > 3.1 {
+		t.Errorf("Expected ~3W package power, got %.2fW", thermal.CPUPowerW)
+	}
+	if !thermal.CPUThrottling || thermal.CPUThrottleEvents != 3 {
+		t.Errorf("Expected 3 throttle events counted once per package, got %d", thermal.CPUThrottleEvents)
+	}
+}
+
+// TestThermalCollector_Unavailable verifies nil is returned without sensors and for a nil collector
+func TestThermalCollector_Unavailable(t *testing.T) {
+	original := sysfsRoot
+	sysfsRoot = filepath.Join(t.TempDir(), "missing")
+	defer func() { sysfsRoot = original }()
+
+	if thermal := NewThermalCollector().Read(); thermal != nil {
+		t.Errorf("Expected nil thermal stats, got %+v", thermal)
+	}
+
+	var collector *ThermalCollector
+	if thermal := collector.Read(); thermal != nil {
+		t.Errorf("Expected nil from nil collector, got %+v", thermal)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// maxConcurrentVantageDials bounds how many backends a probe measures at once
+const maxConcurrentVantageDials = 16
+
+// errVantageUnsupported means the server predates the /vantage endpoints
+var errVantageUnsupported = errors.New("server does not support vantage probes")
+
+// validateVantageProbe checks the probe-mode settings before any measurement is made
+func validateVantageProbe(cfg common.VantageProbeConfig) error {
+	if cfg.Region == "" {
+		return fmt.Errorf("vantage_probe.region is required in probe mode")
+	}
+	if cfg.Latitude == 0 && cfg.Longitude == 0 {
+		return fmt.Errorf("vantage_probe.latitude and vantage_probe.longitude are required in probe mode")
+	}
+	if cfg.IntervalSecs <= 0 || cfg.TimeoutMs <= 0 {
+		return fmt.Errorf("vantage_probe.interval_seconds and vantage_probe.timeout_ms must be positive")
+	}
+	return nil
+}
+
+// runVantageProbe measures every backend from this location and reports the latencies, immediately
+// and then every interval. The agent never registers as a backend in this mode
+func (c *MetricsCollector) runVantageProbe(cfg common.VantageProbeConfig) {
+	ticker := time.NewTicker(time.Duration(cfg.IntervalSecs) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := c.probeBackends(cfg); err != nil {
+			if errors.Is(err, errVantageUnsupported) {
+				LogFatal("Server does not support vantage probes, probe mode cannot run")
+			}
+			LogWarn(fmt.Sprintf("Vantage probe round failed: %v", err))
+		}
+		<-ticker.C
+	}
+}
+
+// probeBackends runs one measurement round: fetch targets, dial each, report the results
+func (c *MetricsCollector) probeBackends(cfg common.VantageProbeConfig) error {
+	var targets common.VantageTargetsResponse
+	if err := c.vantageRequest("GET", "/vantage/targets", nil, &targets); err != nil {
+		return err
+	}
+
+	report := common.VantageReport{
+		Region:    cfg.Region,
+		Latitude:  cfg.Latitude,
+		Longitude: cfg.Longitude,
+		Results:   measureVantageTargets(targets.Targets, time.Duration(cfg.TimeoutMs)*time.Millisecond),
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal vantage report: %w", err)
+	}
+	if err := c.vantageRequest("POST", "/vantage/report", body, nil); err != nil {
+		return err
+	}
+
+	LogInfoWithData("Vantage probe report sent", map[string]interface{}{
+		"region":   cfg.Region,
+		"backends": len(report.Results),
+	})
+	return nil
+}
+
+// vantageRequest sends a request to a /vantage endpoint and decodes the JSON response into out (if not nil)
+func (c *MetricsCollector) vantageRequest(method, path string, body []byte, out interface{}) error {
+	resp, _, err := c.sendToServer(method, path, body)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		// Older servers answer with the mux's generic 404
+		if resp.StatusCode == http.StatusMethodNotAllowed ||
+			(resp.StatusCode == http.StatusNotFound && string(bodyBytes) == "404 page not found\n") {
+			return errVantageUnsupported
+		}
+		return fmt.Errorf("%s %s failed: status=%s, body=%s", method, path, resp.Status, string(bodyBytes))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid %s response: %w", path, err)
+	}
+	return nil
+}
+
+// measureVantageTargets dials every target concurrently and returns one result per target
+func measureVantageTargets(targets []common.VantageTarget, timeout time.Duration) []common.VantageResult {
+	results := make([]common.VantageResult, len(targets))
+	sem := make(chan struct{}, maxConcurrentVantageDials)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, target common.VantageTarget) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = measureEndpointLatency(target, timeout)
+		}(i, target)
+	}
+	wg.Wait()
+	return results
+}
+
+// measureEndpointLatency times a TCP connect to a backend endpoint
+// Unreachable backends report the timeout as their latency so routing penalizes them from this region
+func measureEndpointLatency(target common.VantageTarget, timeout time.Duration) common.VantageResult {
+	result := common.VantageResult{ClientID: target.ClientID}
+
+	parsed, err := url.Parse(target.Endpoint)
+	if err != nil || parsed.Host == "" {
+		result.LatencyMs = float64(timeout.Milliseconds())
+		result.Error = fmt.Sprintf("invalid endpoint URL: %s", target.Endpoint)
+		return result
+	}
+	addr := parsed.Host
+	if parsed.Port() == "" {
+		port := "80"
+		if parsed.Scheme == "https" || parsed.Scheme == "wss" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(parsed.Hostname(), port)
+	}
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		result.LatencyMs = float64(timeout.Milliseconds())
+		result.Error = err.Error()
+		return result
+	}
+	conn.Close()
+	result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	return result
+}
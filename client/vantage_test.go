@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestProbeBackends verifies a probe round measures every target and reports unreachable ones with the timeout
+func TestProbeBackends(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	defer backend.Close()
+
+	// A closed listener gives an address that refuses connections
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	var report common.VantageReport
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/vantage/targets":
+			json.NewEncoder(w).Encode(common.VantageTargetsResponse{Targets: []common.VantageTarget{
+				{ClientID: "up", Endpoint: backend.URL},
+				{ClientID: "down", Endpoint: "http://" + closedAddr},
+			}})
+		case "/vantage/report":
+			json.NewDecoder(r.Body).Decode(&report)
+			w.Write([]byte(`{"accepted": 2}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	collector := &MetricsCollector{
+		config:     Config{ServerURL: server.URL, ClientID: "probe-1"},
+		httpClient: &http.Client{},
+	}
+	cfg := common.VantageProbeConfig{Region: "eu-west", Latitude: 53.3, Longitude: -6.3, IntervalSecs: 30, TimeoutMs: 500}
+	if err := collector.probeBackends(cfg); err != nil {
+		t.Fatalf("Expected the probe round to succeed, got %v", err)
+	}
+
+	if report.Region != "eu-west" || report.Latitude != 53.3 || len(report.Results) != 2 {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	if up := report.Results[0]; up.ClientID != "up" || up.Error != "" || up.LatencyMs >= 500 {
+		t.Errorf("Expected a measured latency for the reachable backend, got %+v", up)
+	}
+	if down := report.Results[1]; down.ClientID != "down" || down.Error == "" || down.LatencyMs != 500 {
+		t.Errorf("Expected the timeout as latency for the unreachable backend, got %+v", down)
+	}
+}
+
+// TestProbeBackends_Unsupported verifies older servers without the vantage endpoints are detected
+func TestProbeBackends_Unsupported(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	collector := &MetricsCollector{
+		config:     Config{ServerURL: server.URL, ClientID: "probe-1"},
+		httpClient: &http.Client{},
+	}
+	cfg := common.VantageProbeConfig{Region: "eu-west", Latitude: 53.3, Longitude: -6.3, IntervalSecs: 30, TimeoutMs: 500}
+	if err := collector.probeBackends(cfg); !errors.Is(err, errVantageUnsupported) {
+		t.Errorf("Expected errVantageUnsupported, got %v", err)
+	}
+}
+
+// TestValidateVantageProbe verifies probe mode requires a region and a location
+func TestValidateVantageProbe(t *testing.T) {
+	valid := common.VantageProbeConfig{Region: "eu-west", Latitude: 53.3, Longitude: -6.3, IntervalSecs: 30, TimeoutMs: 2000}
+	if err := validateVantageProbe(valid); err != nil {
+		t.Errorf("Expected a valid probe config, got %v", err)
+	}
+	noRegion := valid
+	noRegion.Region = ""
+	noLocation := valid
+	noLocation.Latitude, noLocation.Longitude = 0, 0
+	for _, cfg := range []common.VantageProbeConfig{noRegion, noLocation} {
+		if err := validateVantageProbe(cfg); err == nil {
+			t.Errorf("Expected an error for %+v", cfg)
+		}
+	}
+}
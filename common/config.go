@@ -12,7 +12,9 @@ type ServerConfig struct {
 	Port                int    `yaml:"port"`
 	Database            string `yaml:"database"`
 	StaleMinutes        int    `yaml:"stale_minutes"`
+	StaleMissedReports  int    `yaml:"stale_missed_reports"` // Backends declaring a report interval go stale after missing this many reports (default: 3); others use stale_minutes
 	CleanupIntervalSecs int    `yaml:"cleanup_interval_seconds"`
+	StartupReconcileSecs int   `yaml:"startup_reconcile_timeout_seconds"` // On start, wait up to this long for fresh stats from agents serving probe_stats_listen (default: 5, 0 disables)
 	Host                string `yaml:"host"`
 	LogLevel            string `yaml:"log_level"`
 	JSONLogging         bool   `yaml:"json_logging"`           // Enable JSON structured logging
@@ -20,16 +22,24 @@ type ServerConfig struct {
 	// Proxy configuration
 	ProxyEndpoints      []string `yaml:"proxy_endpoints"`       // Endpoint prefixes to proxy (e.g., ["/browse", "/api"])
 	ProxySSEFlushInterval int    `yaml:"proxy_sse_flush_interval_ms"` // Flush interval for SSE/streaming in ms (0 = disabled, -1 = immediate, >0 = interval)
+	ProxyRoutes         []ProxyRouteConfig `yaml:"proxy_routes"`  // Per-prefix proxy settings (prefixes are proxied even if not in proxy_endpoints)
 	TLSCertFile         string   `yaml:"tls_cert_file"`         // Path to TLS certificate file
 	TLSKeyFile          string   `yaml:"tls_key_file"`          // Path to TLS key file
 	TLSInsecureSkipVerify bool   `yaml:"tls_insecure_skip_verify"` // Skip TLS verification for backends (default: false)
+	HTTP2Enabled        bool     `yaml:"http2_enabled"`         // Negotiate HTTP/2 on the TLS listener (default: true)
+	RoutingHeaders      bool     `yaml:"routing_headers"`       // Add X-LB-Score, X-LB-Distance-Km, X-LB-Pending-Allocs and X-LB-Tier to proxied responses (default: true)
+	MetaHeaders         []string `yaml:"meta_headers"`          // Backend metadata sent to the upstream as X-LB-Meta-* headers: gpu_model, country, city, pool, tenant, service_version, labels, label:<key>
+	H2CEnabled          bool     `yaml:"h2c_enabled"`           // Accept cleartext HTTP/2 (h2c) when TLS is not configured (default: false)
 
 	// Security configuration
 	ServerKey           string   `yaml:"server_key"`            // Primary server key for client authentication (empty = no client auth)
 	APIKeys             []string `yaml:"api_keys"`              // Additional API keys for other integrations (empty = no extra keys)
+	AgentAuthMode       string   `yaml:"agent_auth_mode"`       // Agent auth for /register and /stats: "key" (X-API-Key) or "hmac" (signed with server_key) (default: key)
+	HMACMaxSkewSecs     int      `yaml:"hmac_max_skew_seconds"` // Max clock skew for signed agent requests (default: 300)
 	WhitelistedIPs      []string `yaml:"whitelisted_ips"`       // IP whitelist (empty = allow all)
 	RateLimitPerMinute  int      `yaml:"rate_limit_per_minute"` // Requests per minute per IP (0 = unlimited)
 	RateLimitBurst      int      `yaml:"rate_limit_burst"`      // Burst capacity (default: 2x rate limit)
+	RateLimitBackend    string   `yaml:"rate_limit_backend"`    // "memory" (per instance) or "redis" (shared across replicas) (default: memory)
 	MaxRequestBodyBytes int64    `yaml:"max_request_body_bytes"` // Max request body size (default: 10MB)
 	RequestTimeout      int      `yaml:"request_timeout_seconds"` // Request timeout in seconds (default: 30)
 	IdleTimeout         int      `yaml:"idle_timeout_seconds"`    // Idle timeout for keep-alive connections (default: 120)
@@ -37,15 +47,28 @@ type ServerConfig struct {
 	CORSAllowedOrigins  []string `yaml:"cors_allowed_origins"`  // CORS allowed origins
 	ReadHeaderTimeout   int      `yaml:"read_header_timeout_seconds"` // ReadHeaderTimeout prevents Slowloris attacks
 	DisableSecurityHeaders bool  `yaml:"disable_security_headers"` // Disable automatic security headers (X-Frame-Options, X-XSS-Protection, etc.)
+	DebugPprof          bool     `yaml:"debug_pprof"`           // Serve net/http/pprof under /debug/pprof/ to admin keys (default: false)
 
 	// Geolocation configuration
-	GeoIPDBPath         string `yaml:"geoip_db_path"`         // Optional: Path to MaxMind GeoLite2-City.mmdb for IP lookup
+	GeoIPDBPath         string `yaml:"geoip_db_path"`         // Optional: Path to MaxMind GeoLite2-City.mmdb (or IP2Location CSV) for IP lookup
+	GeoIP               GeoIPConfig `yaml:"geoip"`             // GeoIP provider, ASN enrichment and lookup cache
 
 	// Sticky session configuration
 	StickyHeader        string `yaml:"sticky_header"`         // Header name for sticky sessions (e.g., "X-Session-ID", "X-User-ID")
 	StickyByIP          bool   `yaml:"sticky_by_ip"`          // Use client IP for sticky sessions when header is not present (default: false)
 	StickyAffinityEnabled bool `yaml:"sticky_affinity_enabled"` // Prefer same server for different tiers (default: true)
-	PendingAllocationTimeoutSecs int `yaml:"pending_allocation_timeout_seconds"` // Time before pending allocations are cleaned up (default: 120)
+	StickyMode          string `yaml:"sticky_mode"`           // "table" (persisted assignments) or "hash" (stateless consistent hashing) (default: table)
+	StickyStore         string `yaml:"sticky_store"`          // Where sticky_mode: table keeps assignments: "sqlite" or "redis" (shared across replicas) (default: sqlite)
+	StickyTTLSecs       int    `yaml:"sticky_ttl_seconds"`    // sticky_store: redis: a sticky ID's assignments expire this long after its last request (default: 0 = never)
+	PendingAllocationTimeoutSecs int `yaml:"pending_allocation_timeout_seconds"` // Allocation lease TTL: resources are freed unless renewed within it (default: 120)
+	MaxPendingPerBackend         int `yaml:"max_pending_per_backend"`            // In-flight placements one backend may hold; more are routed elsewhere or rejected with 429 (default: 0 = unlimited)
+	MaxPendingTotal              int `yaml:"max_pending_total"`                  // In-flight placements across the fleet; new placements beyond it are rejected with 429 (default: 0 = unlimited)
+	MaxLeaseSecs        int    `yaml:"max_lease_seconds"`     // Longest a lease can be kept alive by renewals (default: 3600, 0 = no limit)
+	StickyLimits        StickyLimitsConfig `yaml:"sticky_limits"` // Per-sticky-ID session quotas (sticky_mode: table)
+	RoutingCookie       RoutingCookieConfig `yaml:"routing_cookie"` // Signed cookie returning proxied requests to their backend without sticky state
+
+	// Cost-aware scheduling
+	CostWeight          float64 `yaml:"cost_weight"`           // Score penalty per unit of hourly backend cost (0 = ignore cost)
 
 	// Tier selection configuration
 	TierFieldName       string `yaml:"tier_field_name"`       // JSON body field name for tier (default: "tier")
@@ -54,10 +77,14 @@ type ServerConfig struct {
 	// Tier specifications
 	Tiers               []TierSpec `yaml:"tiers"`             // Resource requirements for each tier
 
+	// Tenants sharing this instance (backends, tiers, sticky assignments and API keys are scoped per tenant)
+	Tenants             []TenantConfig `yaml:"tenants"`
+
 	// Database configuration
 	DBMaxOpenConns      int      `yaml:"db_max_open_conns"`     // Max open database connections
 	DBMaxIdleConns      int      `yaml:"db_max_idle_conns"`     // Max idle database connections
 	DBConnMaxLifetime   int      `yaml:"db_conn_max_lifetime"`  // Connection max lifetime in seconds
+	DBSigningKey        string   `yaml:"db_signing_key"`        // HMAC key for signing persisted stats and sticky rows (empty = rows are not signed)
 
 	// Graceful shutdown
 	ShutdownTimeout     int      `yaml:"shutdown_timeout_seconds"` // Graceful shutdown timeout (default: 30)
@@ -66,37 +93,587 @@ type ServerConfig struct {
 	HealthCheckEnabled         bool   `yaml:"health_check_enabled"`          // Enable active health checks (default: true)
 	HealthCheckIntervalSecs    int    `yaml:"health_check_interval_seconds"` // Health check interval (default: 10)
 	HealthCheckTimeoutSecs     int    `yaml:"health_check_timeout_seconds"`  // Health check timeout (default: 2)
-	HealthCheckType            string `yaml:"health_check_type"`             // "tcp" or "http" (default: tcp)
+	HealthCheckType            string `yaml:"health_check_type"`             // "tcp", "http", "http-json", "udp" or "icmp" (default: tcp)
 	HealthCheckPath            string `yaml:"health_check_path"`             // HTTP path for health checks (default: /health)
+	HealthCheckUDPPort         int    `yaml:"health_check_udp_port"`         // udp: port probed instead of the endpoint's (0 = endpoint's port)
+	HealthCheckUDPPayload      string `yaml:"health_check_udp_payload"`      // udp: datagram sent to the backend (default: empty)
+	HealthCheckUDPExpect       string `yaml:"health_check_udp_expect"`       // udp: the reply must contain this; when set, no reply fails instead of falling back to ping
 	HealthCheckUnhealthyThreshold int `yaml:"health_check_unhealthy_threshold"` // Consecutive failures before unhealthy (default: 3)
 	HealthCheckHealthyThreshold   int `yaml:"health_check_healthy_threshold"`   // Consecutive successes before healthy (default: 2)
+	HealthCheckDegradedPenalty float64 `yaml:"health_check_degraded_penalty"` // http-json: score points added while a backend reports "degraded" (default: 200)
+	HealthCheckSessionWeight   float64 `yaml:"health_check_session_weight"`   // http-json: score points per reported active session (default: 5)
+	DefaultEndpointPort        int    `yaml:"default_endpoint_port"`         // Port of agents without endpoint_url that do not report endpoint_port (default: 11000)
+	DuplicateEndpointPolicy    string `yaml:"duplicate_endpoint_policy"`     // A registration sharing a live backend's endpoint: "replace" (default), "reject" or "allow"
+
+	// CPU headroom - how many free vCPUs a backend's per-core usage amounts to (tiers may override both)
+	CoreThreshold float64 `yaml:"core_threshold"` // Usage (percent) below which a core is available (default: 80)
+	CPUHeadroom   string  `yaml:"cpu_headroom"`   // per_core (each core below the threshold is one vCPU, default) or total (unused capacity below the threshold, summed over all cores)
+
+	// Pressure stall (PSI) overload veto - backends above these thresholds are skipped (0 = disabled)
+	PSICPUVetoPct       float64 `yaml:"psi_cpu_veto_pct"`    // Max CPU "some" pressure (10s avg, percent)
+	PSIMemoryVetoPct    float64 `yaml:"psi_memory_veto_pct"` // Max memory "some" pressure (10s avg, percent)
+	PSIIOVetoPct        float64 `yaml:"psi_io_veto_pct"`     // Max I/O "some" pressure (10s avg, percent)
+
+	// Socket exhaustion veto - backends out of file descriptors or ports are skipped (0 = disabled)
+	FDVetoPct            float64 `yaml:"fd_veto_pct"`             // Max allocated file handles, percent of fs.file-max
+	EphemeralPortVetoPct float64 `yaml:"ephemeral_port_veto_pct"` // Max ephemeral port range in use, percent
+	TCPConnectionsVeto   int     `yaml:"tcp_connections_veto"`    // Max TCP sockets in any state but listen
+
+	// Thermal de-prioritization - hot or throttling CPUs get a score penalty rather than being skipped (0 = disabled)
+	ThermalThrottlePenalty float64 `yaml:"thermal_throttle_penalty"` // Score points added while a backend reports CPU thermal throttling
+	CPUTempPenaltyC        float64 `yaml:"cpu_temp_penalty_c"`       // Package temperature (Celsius) at which the penalty also applies
+
+	// GPU fault handling - backends with critical GPU faults are skipped for GPU tiers only
+	GPUCriticalXIDs     []uint64 `yaml:"gpu_critical_xids"`      // XID codes treated as critical (default: 48, 74, 79, 94, 95, 119, 120)
+	GPUFaultHoldMinutes int      `yaml:"gpu_fault_hold_minutes"` // How long a critical XID keeps a backend out of GPU tiers (default: 30)
+
+	// Outlier detection - eject backends whose proxied requests fail too often
+	OutlierDetection    OutlierDetectionConfig `yaml:"outlier_detection"`
+
+	// Proxy circuit breaker - stop placing traffic on a backend after consecutive proxy failures
+	CircuitBreaker      CircuitBreakerConfig `yaml:"circuit_breaker"`
+
+	// Per-backend cap on proxied requests in flight, which also feed the routing score
+	ProxyConcurrency    ProxyConcurrencyConfig `yaml:"proxy_concurrency"`
+
+	// Stats anomaly detection - quarantine backends reporting implausible stats
+	StatsAnomaly        StatsAnomalyConfig `yaml:"stats_anomaly"`
+
+	// Slow start - newly registered or recovered backends warm up before receiving full traffic
+	SlowStart           SlowStartConfig `yaml:"slow_start"`
+
+	// Structured HTTP access logs (separate from application logs)
+	AccessLog           AccessLogConfig `yaml:"access_log"`
+
+	// Simulation mode (--simulate N): custom fake backend profiles, merged with the built-in ones by name
+	SimulationProfiles  []SimulationProfile `yaml:"simulation_profiles"`
+
+	// Webhooks notified of server events (e.g. sticky.migrated)
+	Webhooks            []WebhookConfig `yaml:"webhooks"`
+
+	// Sticky ID hashing: sticky IDs are replaced with a keyed HMAC before they are stored in memory, the database or logs
+	StickyIDHashKey     string `yaml:"sticky_id_hash_key"` // Secret for HMAC-SHA256 sticky ID hashing (empty = store sticky IDs as sent)
+
+	// Sticky session migration (POST /sticky/{sticky_id}/migrate)
+	StickyMigrateNotifyPath string `yaml:"sticky_migrate_notify_path"` // Path on the old backend notified to checkpoint/hand off when requested (default: /opsen/migrate)
+
+	// Routing rules evaluated before scoring, in order (the first matching rule applies)
+	RoutingRules        []RoutingRuleConfig `yaml:"routing_rules"`
+
+	// Stats exporters: forward received client stats to a time-series database in addition to SQLite
+	StatsExporters      []StatsExporterConfig `yaml:"stats_exporters"`
+
+	// Shared Redis connection (used by rate_limit_backend: redis and sticky_store: redis)
+	Redis               RedisConfig `yaml:"redis"`
+
+	// Stats persistence batching: /stats is acknowledged after the in-memory update, rows are written by a background writer
+	StatsWriteBatchSize int `yaml:"stats_write_batch_size"` // Rows per transaction (default: 500, 0 = write synchronously on the request path)
+	StatsWriteFlushMs   int `yaml:"stats_write_flush_ms"`   // Max time a row waits for a full batch (default: 1000)
+	StatsWriteQueueSize int `yaml:"stats_write_queue_size"` // Buffered rows before /stats falls back to synchronous writes (default: 10000)
+
+	// Deregistered backends' records are deleted in the background, in transactions of at most this many rows (default: 500)
+	CleanupBatchSize    int `yaml:"cleanup_batch_size"`
+
+	// Capacity alerting: tier name → minimum live, healthy backends able to take it
+	// Below the minimum /health reports "degraded" and a tier.degraded webhook fires
+	MinHealthyBackends  map[string]int `yaml:"min_healthy_backends"`
+
+	// Route result caching for anonymous proxy requests (no sticky ID)
+	RouteCacheTTLMs     int `yaml:"route_cache_ttl_ms"` // Reuse a backend pick for identical requests within this window (default: 0 = disabled, e.g. 250)
+
+	// SQLite online backups (POST /admin/backup and scheduled)
+	Backup              BackupConfig `yaml:"backup"`
+
+	// Probabilistic rejection of low-priority tiers at the proxy when the fleet nears saturation
+	LoadShedding        LoadSheddingConfig `yaml:"load_shedding"`
+
+	// Capacity recommendations for an external provisioner (GET /autoscale/recommendations)
+	Autoscale           AutoscaleConfig `yaml:"autoscale"`
+
+	// Responses for routing requests rejected in maintenance mode (POST /admin/maintenance)
+	Maintenance         MaintenanceConfig `yaml:"maintenance"`
+
+	// Agent error events (POST /errors, GET /clients/{id}/errors)
+	ClientErrors        ClientErrorsConfig `yaml:"client_errors"`
+
+	// Hierarchical mode: register this load balancer as a backend of a parent opsen server
+	Parent              ParentConfig `yaml:"parent"`
+
+	// Latency measured by probe agents in other regions, used for end users near those probes
+	VantageProbes       VantageProbesConfig `yaml:"vantage_probes"`
+
+	// Layer-4 listeners for protocols that don't speak HTTP (RDP, VNC, ...), placed by the same routing engine
+	StreamProxy         []StreamListenerConfig `yaml:"stream_proxy"`
+
+	// Latency objectives for routing decisions and proxied responses, alerted on by multi-window burn rate (GET /slo)
+	SLOs                []SLOConfig `yaml:"slos"`
+
+	// Hold new registrations out of routing until approved (POST /clients/{id}/approve) or vouched for by a rule
+	RegistrationApproval RegistrationApprovalConfig `yaml:"registration_approval"`
+
+	// Time-window score adjustments per backend or pool, e.g. de-prioritize office backends during business hours
+	RoutingSchedules    []RoutingScheduleConfig `yaml:"routing_schedules"`
+}
+
+// RoutingScheduleConfig adds score_penalty to the score of its backends while the current time, read in
+// timezone, falls in one of its windows. Penalties of several active schedules add up
+type RoutingScheduleConfig struct {
+	Name         string   `yaml:"name"`          // Label for logs and GET /clients (required)
+	ClientIDs    []string `yaml:"client_ids"`    // Backends it applies to
+	Pools        []string `yaml:"pools"`         // Backend pools it applies to (client_ids or pools is required)
+	Windows      []string `yaml:"windows"`       // Cron-style "minute hour day-of-month month day-of-week", e.g. "* 9-17 * * 1-5" (required)
+	Timezone     string   `yaml:"timezone"`      // IANA time zone the windows are read in, e.g. Europe/Berlin (default: UTC)
+	ScorePenalty float64  `yaml:"score_penalty"` // Score added while active, in km-equivalent points; negative values prefer the backends (required)
+}
+
+// RegistrationApprovalConfig makes newly registered backends wait for approval before they receive traffic
+// Backends already registered when it is turned on stay approved; turning it off releases pending ones
+type RegistrationApprovalConfig struct {
+	Enabled     bool              `yaml:"enabled"`
+	AutoApprove []AutoApproveRule `yaml:"auto_approve"` // A registration matching any rule is approved at once
+}
+
+// AutoApproveRule approves registrations meeting every condition it sets (at least one is required)
+type AutoApproveRule struct {
+	Name   string            `yaml:"name"`   // Recorded as the approver, "auto:<name>" (required)
+	Tokens []string          `yaml:"tokens"` // Agent's approval_token is one of these
+	CIDRs  []string          `yaml:"cidrs"`  // Registration connected from one of these networks (X-Forwarded-For is not trusted)
+	Labels map[string]string `yaml:"labels"` // Agent registered with each label ("" matches any value); self-reported, so pair with tokens or cidrs
+}
+
+// SLOConfig is a latency objective: target_pct of requests of the given kind finish within threshold_ms
+// An alert fires while any window pair burns the error budget at least burn_rate times faster than sustainable
+type SLOConfig struct {
+	Name        string            `yaml:"name"`         // Label for metrics, webhooks and GET /slo (required)
+	Kind        string            `yaml:"kind"`         // "route" (POST /route decision time) or "proxy_ttfb" (proxied request to first backend response byte)
+	ThresholdMs float64           `yaml:"threshold_ms"` // Requests slower than this count against the objective (required)
+	TargetPct   float64           `yaml:"target_pct"`   // Share of requests that must be within threshold_ms, e.g. 99 (required, below 100)
+	Windows     []SLOWindowConfig `yaml:"windows"`      // Burn-rate alert windows (default: 5m/1h at 14.4x and 30m/6h at 6x)
+}
+
+// SLOWindowConfig pairs a short and a long window; both must burn at burn_rate or faster for the alert to fire,
+// so the long window proves the problem is significant and the short one that it is still happening
+type SLOWindowConfig struct {
+	ShortMins int     `yaml:"short_window_minutes"`
+	LongMins  int     `yaml:"long_window_minutes"`
+	BurnRate  float64 `yaml:"burn_rate"` // 1 spends exactly the whole error budget over the objective's period
+}
+
+// StreamListenerConfig is a TCP or UDP listener whose connections are spliced to a backend's backend_port
+// The tier comes from the TLS server name (sni_tiers), then the destination port (port_tiers), then tier
+type StreamListenerConfig struct {
+	Name               string            `yaml:"name"`                    // Label for logs (default: the listen address)
+	Listen             string            `yaml:"listen"`                  // Address to accept on, e.g. ":3389" (required)
+	Protocol           string            `yaml:"protocol"`                // "tcp" or "udp" (default: tcp)
+	BackendPort        int               `yaml:"backend_port"`            // Port dialed on the selected backend's endpoint host (required)
+	Tier               string            `yaml:"tier"`                    // Tier when neither SNI nor port mapping decide (default: lite)
+	SNITiers           map[string]string `yaml:"sni_tiers"`               // TLS server name → tier, read from the ClientHello without terminating TLS (tcp)
+	PortTiers          map[int]string    `yaml:"port_tiers"`              // Destination port → tier (from the PROXY protocol header, else the listener's port)
+	ProxyProtocol      bool              `yaml:"proxy_protocol"`          // Connections start with a PROXY protocol v1/v2 header from a front load balancer (tcp)
+	Tenant             string            `yaml:"tenant"`                  // Tenant whose backends and tiers serve this listener (default: the default tenant)
+	ConnectTimeoutSecs int               `yaml:"connect_timeout_seconds"` // Backend dial and SNI/PROXY header read timeout (default: 5)
+	IdleTimeoutSecs    int               `yaml:"idle_timeout_seconds"`    // Close a stream with no traffic in either direction for this long (default: 0 = never for tcp, 60 for udp)
+}
+
+// VantageProbesConfig controls how probe agents' latency reports are used for routing
+type VantageProbesConfig struct {
+	MaxAgeSecs    int     `yaml:"max_age_seconds"` // Probes that have not reported within this window are ignored (default: 300)
+	MaxDistanceKm float64 `yaml:"max_distance_km"` // Only use a probe this close to the end user (0 = the nearest probe at any distance)
+}
+
+// ClientErrorsConfig sets retention and alerting for error events reported by agents
+type ClientErrorsConfig struct {
+	RetentionHours  int    `yaml:"retention_hours"`  // Events older than this are deleted (default: 168, 0 = no age limit)
+	MaxPerClient    int    `yaml:"max_per_client"`   // Newest events kept per backend (default: 1000, 0 = no limit)
+	WebhookSeverity string `yaml:"webhook_severity"` // Lowest severity sent as client.error webhooks: warning, error, critical or none (default: error)
+}
+
+// LoadSheddingConfig configures proxy load shedding by tier priority
+type LoadSheddingConfig struct {
+	Enabled              bool    `yaml:"enabled"`
+	StartUtilizationPct  float64 `yaml:"start_utilization_pct"`     // Fleet utilization where shedding starts (default: 85)
+	FullUtilizationPct   float64 `yaml:"full_utilization_pct"`      // Utilization where every sheddable tier is fully shed (default: 98)
+	RetryAfterSecs       int     `yaml:"retry_after_secs"`          // Retry-After on shed requests (default: 30)
+	EvaluateIntervalSecs int     `yaml:"evaluate_interval_seconds"` // How often utilization is recomputed (default: 5)
+}
+
+// AutoscaleConfig configures cluster-autoscaler style scaling recommendations
+// Scale-up is recommended for a tier whose spare capacity stays below its minimum; scale-down nominates
+// idle backends while the fleet stays underutilized. Recommendations go to a provisioner webhook unless dry_run
+type AutoscaleConfig struct {
+	Enabled                 bool           `yaml:"enabled"`
+	DryRun                  bool           `yaml:"dry_run"`                    // Only publish recommendations and events, never call the provisioner (default: true)
+	EvaluateIntervalSecs    int            `yaml:"evaluate_interval_seconds"`  // How often capacity is evaluated (default: 30)
+	MinCapacitySessions     map[string]int `yaml:"min_capacity_sessions"`      // Tier name → new sessions that should still fit across the fleet
+	ScaleUpAfterMins        int            `yaml:"scale_up_after_minutes"`     // How long a tier stays below its minimum before scale-up is recommended (default: 5)
+	ScaleDownUtilizationPct float64        `yaml:"scale_down_utilization_pct"` // Fleet utilization under which idle backends are nominated for teardown (default: 20, 0 = never)
+	ScaleDownAfterMins      int            `yaml:"scale_down_after_minutes"`   // How long utilization stays under it before nominating (default: 30)
+	MinBackends             int            `yaml:"min_backends"`               // Live backends never nominated away (default: 1)
+	MaxTeardown             int            `yaml:"max_teardown"`               // Backends nominated per scale-down recommendation (default: 1)
+	CooldownMins            int            `yaml:"cooldown_minutes"`           // Minimum time between requests of the same action for the same tier (default: 10)
+	ProvisionerURL          string         `yaml:"provisioner_url"`            // Receives recommendations as JSON POSTs when dry_run is off
+	ProvisionerSecret       string         `yaml:"provisioner_secret"`         // Signs provisioner requests like webhooks (optional)
+	ProvisionerTimeoutMs    int            `yaml:"provisioner_timeout_ms"`     // Per-request timeout (default: 5000)
+}
+
+// StickyLimitsConfig caps the tier assignments one sticky ID (user) may hold at once
+type StickyLimitsConfig struct {
+	MaxAssignments int            `yaml:"max_assignments"` // Assignments a sticky ID may hold (default: 0 = unlimited)
+	Tiers          map[string]int `yaml:"tiers"`           // Requested tier → limit, overriding max_assignments (e.g. lite: 1)
+	Policy         string         `yaml:"policy"`          // At the limit: "reject" (429, default) or "evict_oldest" (least recently used assignment)
+}
+
+// RoutingCookieConfig issues a signed token naming the backend a proxied request was placed on
+// Later requests carrying it go back to that backend while it is healthy, across load balancer restarts
+type RoutingCookieConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Secret  string `yaml:"secret"`      // HMAC key; must be the same on every instance (default: server_key)
+	Name    string `yaml:"name"`        // Cookie name prefix, suffixed with the tier (default: opsen_route)
+	Header  string `yaml:"header"`      // Also return the token in this response header and accept it in this request header (optional)
+	TTLSecs int    `yaml:"ttl_seconds"` // Token lifetime, renewed as requests use it (default: 3600)
+	Secure  bool   `yaml:"secure"`      // Mark the cookie Secure even when the load balancer itself is not serving TLS
+}
+
+// ParentConfig registers this server into a parent opsen server, reporting the aggregate capacity
+// of its live, healthy backends as its own resources (e.g. regional load balancers behind a global one)
+type ParentConfig struct {
+	URL                string  `yaml:"url"`                     // Parent server URL (empty = hierarchical mode disabled)
+	ServerKey          string  `yaml:"server_key"`              // Agent key of the parent (optional)
+	AuthMode           string  `yaml:"auth_mode"`               // "key" (X-API-Key header) or "hmac" (signed requests) (default: key)
+	ClientID           string  `yaml:"client_id"`               // Backend ID at the parent (default: hostname)
+	Hostname           string  `yaml:"hostname"`                // Reported hostname (default: hostname)
+	EndpointURL        string  `yaml:"endpoint_url"`            // Where the parent sends traffic, usually this server's proxy (required)
+	Latitude           float64 `yaml:"latitude"`                // Reported location (default: centroid of the backends)
+	Longitude          float64 `yaml:"longitude"`
+	Country            string  `yaml:"country"`
+	City               string  `yaml:"city"`
+	Tenant             string  `yaml:"tenant"`                  // Tenant at the parent (optional)
+	Pool               string  `yaml:"pool"`                    // Pool at the parent, e.g. the region name (optional)
+	ReportIntervalSecs int     `yaml:"report_interval_seconds"` // How often aggregate stats are sent (default: 10)
+}
+
+// MaintenanceConfig sets the default response while maintenance mode is on
+// Each field can be overridden when maintenance is switched on
+type MaintenanceConfig struct {
+	StatusCode     int    `yaml:"status_code"`      // Default: 503
+	Message        string `yaml:"message"`          // Default: "Service is under maintenance"
+	RetryAfterSecs int    `yaml:"retry_after_secs"` // Retry-After header value (default: 300, 0 = omitted)
+}
+
+// BackupConfig configures consistent SQLite snapshots taken with the online backup API
+type BackupConfig struct {
+	Dir           string `yaml:"dir"`            // Directory backups are written to (required for scheduled backups)
+	IntervalHours int    `yaml:"interval_hours"` // Scheduled backup interval (0 = scheduled backups disabled)
+	Keep          int    `yaml:"keep"`           // Backups kept in dir; older ones are deleted (default: 7, 0 = keep all)
+}
+
+// RedisConfig configures the connection to a shared Redis instance
+type RedisConfig struct {
+	Address   string `yaml:"address"`    // host:port (default: localhost:6379)
+	Username  string `yaml:"username"`   // ACL username (optional)
+	Password  string `yaml:"password"`   // Password (optional)
+	DB        int    `yaml:"db"`         // Database number (default: 0)
+	KeyPrefix string `yaml:"key_prefix"` // Prefix for all keys written by opsen (default: opsen:)
+	TLS       bool   `yaml:"tls"`        // Connect with TLS
+}
+
+// ProxyRouteConfig holds settings for proxied paths under a prefix (the longest matching prefix wins)
+type ProxyRouteConfig struct {
+	Prefix             string   `yaml:"prefix"`                  // Path prefix (e.g. /api/events)
+	Streaming          bool     `yaml:"streaming"`               // Long-lived responses (SSE, long polling): no request timeout, flushed immediately
+	RequestTimeoutSecs int      `yaml:"request_timeout_seconds"` // Overall request timeout (0 = global request_timeout_seconds)
+	ReadTimeoutSecs    int      `yaml:"read_timeout_seconds"`    // Max time to read the request from the client, e.g. for slow uploads (0 = no limit)
+	WriteTimeoutSecs   int      `yaml:"write_timeout_seconds"`   // Max time to write the response to the client (0 = no limit)
+	IdleTimeoutSecs    int      `yaml:"idle_timeout_seconds"`    // Abort when the backend sends nothing for this long (0 = no limit)
+	MaxLifetimeSecs    int      `yaml:"max_lifetime_seconds"`    // Hard cap on request lifetime, including streaming (0 = unlimited)
+	Methods            []string `yaml:"methods"`                 // Allowed methods (empty = all; HEAD is allowed with GET); others get 405
+	Options            string   `yaml:"options"`                 // OPTIONS handling: "passthrough" (forward to backend) or "local" (answer here); default forwards unless CORS is enabled
+	Tenant             string   `yaml:"tenant"`                  // Tenant whose backends serve this prefix (default: "default")
+	StreamRequestBody  bool     `yaml:"stream_request_body"`     // Pass the request body to the backend as it arrives instead of buffering it; the tier must come from the query or header
+	MaxBodyBytes       int64    `yaml:"max_body_bytes"`          // Request body limit for this prefix (0 = global max_request_body_bytes, -1 = unlimited)
+	AllowHeaders       []string `yaml:"allow_headers"`           // Inbound headers forwarded to the backend, "*" wildcards allowed (empty = all)
+	DenyHeaders        []string `yaml:"deny_headers"`            // Inbound headers never forwarded, "*" wildcards allowed; applied after allow_headers
+	PreserveHost       bool     `yaml:"preserve_host"`           // Send the client's Host header to the backend instead of the backend's host
+	Compression        ProxyCompressionConfig `yaml:"compression"` // Compress responses the backend sent uncompressed
+}
+
+// ProxyCompressionConfig compresses proxied responses for clients that accept it, when the backend did not
+type ProxyCompressionConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Encodings    []string `yaml:"encodings"`     // gzip and/or zstd, most preferred first (default: zstd, gzip)
+	MinBytes     int64    `yaml:"min_bytes"`     // Smaller responses are sent as is (default: 1024)
+	ContentTypes []string `yaml:"content_types"` // Media types to compress, "text/*" matches a whole type (default: JSON, JavaScript, XML, SVG and text/*)
+}
+
+// TenantConfig defines a tenant: its API keys and optionally its own tier set
+type TenantConfig struct {
+	Name    string     `yaml:"name"`     // Tenant name
+	APIKeys []string   `yaml:"api_keys"` // Keys that authenticate as this tenant (agents and /route callers)
+	Tiers   []TierSpec `yaml:"tiers"`    // Tenant-specific tiers (empty = the global tiers)
+}
+
+// WebhookConfig is an HTTP endpoint that receives server events as JSON POSTs
+type WebhookConfig struct {
+	URL       string   `yaml:"url"`
+	Events    []string `yaml:"events"`     // Event names to deliver (empty = all)
+	Secret    string   `yaml:"secret"`     // Signs deliveries with HMAC-SHA256 in X-Opsen-Webhook-Signature (empty = unsigned)
+	TimeoutMs int      `yaml:"timeout_ms"` // Delivery timeout per attempt (default: 5000)
+}
+
+// RoutingRuleConfig applies an action to requests matching all of its conditions
+type RoutingRuleConfig struct {
+	Name   string            `yaml:"name"`   // Shown in logs and the X-LB-Rule response header
+	Match  RoutingRuleMatch  `yaml:"match"`  // Conditions (all must hold; empty matches every request)
+	Action RoutingRuleAction `yaml:"action"` // What to do with a matching request
+}
+
+// RoutingRuleMatch lists the conditions of a routing rule
+type RoutingRuleMatch struct {
+	Tiers      []string          `yaml:"tiers"`       // Requested tier is one of these
+	PathPrefix string            `yaml:"path_prefix"` // Request path starts with this (proxied path, or "path" in /route requests)
+	Headers    map[string]string `yaml:"headers"`     // Request header equals the value ("*" = present)
+	Countries  []string          `yaml:"countries"`   // Client country ISO code from GeoIP (requires geoip_db_path or an http provider)
+	TimeOfDay  string            `yaml:"time_of_day"` // "HH:MM-HH:MM" window, may wrap midnight (e.g. "22:00-06:00")
+	Days       []string          `yaml:"days"`        // Weekdays: mon, tue, wed, thu, fri, sat, sun
+	Timezone   string            `yaml:"timezone"`    // IANA zone for time_of_day and days (default: UTC)
+}
+
+// RoutingRuleAction is applied to requests matching a routing rule
+type RoutingRuleAction struct {
+	Tier        string  `yaml:"tier"`         // Rewrite the requested tier
+	Pool        string  `yaml:"pool"`         // Route only to backends registered with this pool
+	PreferPool  string  `yaml:"prefer_pool"`  // Prefer backends in this pool by score_bonus
+	ScoreBonus  float64 `yaml:"score_bonus"`  // Score bonus for prefer_pool and prefer_service_version backends, in km-equivalent points
+	ServiceVersion       string `yaml:"service_version"`        // Route only to backends reporting this service_version
+	PreferServiceVersion string `yaml:"prefer_service_version"` // Prefer backends reporting this service_version (score_bonus, default 1000)
+	DenyStatus  int     `yaml:"deny_status"`  // Reject the request with this HTTP status (4xx/5xx)
+	DenyMessage string  `yaml:"deny_message"` // Response body for denied requests (default: the status text)
+}
+
+// Stats exporter types
+const (
+	StatsExporterRemoteWrite = "prometheus_remote_write"
+	StatsExporterInfluxDB    = "influxdb"
+)
+
+// StatsExporterConfig is a time-series database that receives client stats
+type StatsExporterConfig struct {
+	Type              string            `yaml:"type"`                   // prometheus_remote_write or influxdb
+	URL               string            `yaml:"url"`                    // Remote-write URL, or InfluxDB write URL including org/bucket (v2) or db (v1) query params
+	Headers           map[string]string `yaml:"headers"`                // Extra request headers
+	Username          string            `yaml:"username"`               // Basic auth username (optional)
+	Password          string            `yaml:"password"`               // Basic auth password (optional)
+	BearerToken       string            `yaml:"bearer_token"`           // Sent as "Authorization: Bearer <token>" (optional)
+	Token             string            `yaml:"token"`                  // InfluxDB 2 API token, sent as "Authorization: Token <token>" (optional)
+	Labels            map[string]string `yaml:"labels"`                 // Extra labels (tags in InfluxDB) added to every series
+	FlushIntervalSecs int               `yaml:"flush_interval_seconds"` // How often buffered samples are written (default: 10)
+	MaxBufferedPoints int               `yaml:"max_buffered_points"`    // Samples kept while the endpoint is unreachable; oldest are dropped (default: 100000)
+	TimeoutMs         int               `yaml:"timeout_ms"`             // Write timeout (default: 5000)
+}
+
+// SlowStartConfig configures the warm-up window for new or recovered backends
+type SlowStartConfig struct {
+	WindowSecs   int     `yaml:"window_seconds"` // Warm-up length after registration or health recovery (0 = disabled)
+	Mode         string  `yaml:"mode"`           // "penalty" (score penalty fades out) or "ramp" (share of new placements grows 0-100%) (default: penalty)
+	ScorePenalty float64 `yaml:"score_penalty"`  // Penalty mode: score added at the start of the window, shrinking linearly to 0 (default: 100)
+}
+
+// OutlierDetectionConfig configures ejection of backends by proxied 5xx/connection-error rate
+type OutlierDetectionConfig struct {
+	Enabled          bool    `yaml:"enabled"`               // Track error rates and eject outliers (default: false)
+	WindowSecs       int     `yaml:"window_seconds"`        // Sliding window for error rates (default: 60)
+	MinRequests      int     `yaml:"min_requests"`          // Requests in the window before a backend can be ejected (default: 20)
+	ErrorRatePct     float64 `yaml:"error_rate_pct"`        // Eject above this share of failed requests (default: 50)
+	BaseEjectionSecs int     `yaml:"base_ejection_seconds"` // First ejection length, multiplied by consecutive ejections (default: 30)
+	MaxEjectionSecs  int     `yaml:"max_ejection_seconds"`  // Longest ejection (default: 300)
+	MaxEjectionPct   float64 `yaml:"max_ejection_pct"`      // Never eject more than this share of backends (default: 50)
+	ReadmitSecs      int     `yaml:"readmit_seconds"`       // Traffic ramps back from 0 to 100% over this period after an ejection (default: 30)
+}
+
+// CircuitBreakerConfig configures the per-backend proxy circuit breaker
+type CircuitBreakerConfig struct {
+	Enabled          bool `yaml:"enabled"`            // Open circuits on consecutive proxy failures (default: false)
+	MaxFailures      int  `yaml:"max_failures"`       // Consecutive failed requests (5xx or connection errors) that open the circuit (default: 5)
+	OpenSecs         int  `yaml:"open_seconds"`       // Cool-down during which the backend is skipped (default: 30)
+	HalfOpenRequests int  `yaml:"half_open_requests"` // Trial placements after the cool-down; all must succeed to close the circuit (default: 1)
+}
+
+// ProxyConcurrencyConfig caps the proxied requests each backend has in flight
+type ProxyConcurrencyConfig struct {
+	MaxInFlight    int     `yaml:"max_in_flight"`    // Proxied requests one backend may have in flight (default: 0 = unlimited)
+	Overflow       string  `yaml:"overflow"`         // At the limit: "spill" (place new requests on the next-best backend) or "queue" (wait for a slot) (default: spill)
+	QueueTimeoutMs int     `yaml:"queue_timeout_ms"` // Longest a request waits for a slot before 503 (default: 1000)
+	ScoreWeight    float64 `yaml:"score_weight"`     // Score points per request in flight on a backend (default: 5)
+}
+
+// StatsAnomalyConfig configures quarantine of backends whose reported stats cannot be right
+// (memory or disk used above total, a shrinking CPU array, timestamps from the future, values frozen across reports)
+type StatsAnomalyConfig struct {
+	Enabled          bool `yaml:"enabled"`                // Check every stats report (default: true)
+	QuarantineSecs   int  `yaml:"quarantine_seconds"`     // Backend is skipped for routing this long after its last implausible report (default: 300)
+	MaxClockSkewSecs int  `yaml:"max_clock_skew_seconds"` // Report timestamps further ahead of the server clock are implausible (default: 300)
+	FrozenReports    int  `yaml:"frozen_reports"`         // Identical consecutive reports before values count as frozen (default: 10, 0 = disabled)
+}
+
+// GeoIPConfig selects the GeoIP provider and configures ASN enrichment and lookup caching
+type GeoIPConfig struct {
+	Provider      string            `yaml:"provider"`          // "mmdb" (MaxMind), "ip2location" (CSV), or "http" (default: mmdb)
+	ASNDBPath     string            `yaml:"asn_db_path"`       // Optional ASN database: GeoLite2-ASN.mmdb (mmdb) or IP2Location ASN CSV (ip2location)
+	HTTPURL       string            `yaml:"http_url"`          // http provider: lookup URL with an {ip} placeholder
+	HTTPHeaders   map[string]string `yaml:"http_headers"`      // http provider: extra request headers (e.g. API token)
+	HTTPTimeoutMs int               `yaml:"http_timeout_ms"`   // http provider: per-lookup timeout (default: 1000)
+	CacheSize     int               `yaml:"cache_size"`        // LRU cache entries for lookups (default: 10000, 0 disables)
+	CacheTTLSecs  int               `yaml:"cache_ttl_seconds"` // Cached lookup lifetime (default: 3600, 0 = until evicted)
+	PreferSameASN bool              `yaml:"prefer_same_asn"`   // Prefer backends in the requesting client's ASN (default: false)
+	SameASNBonus  float64           `yaml:"same_asn_bonus"`    // Score bonus for a same-ASN backend, in km-equivalent points (default: 100)
+
+	// Periodic download of geoip_db_path (mmdb and ip2location providers)
+	AutoUpdate    GeoIPAutoUpdateConfig `yaml:"auto_update"`
+}
+
+// GeoIPAutoUpdateConfig configures periodic, verified downloads of the server's GeoIP database
+// At least one of sha256_url or public_key is required
+type GeoIPAutoUpdateConfig struct {
+	Enabled            bool   `yaml:"enabled"`              // Check for new databases periodically (default: false)
+	URL                string `yaml:"url"`                  // Database download URL; zstd-compressed downloads are decompressed
+	SHA256URL          string `yaml:"sha256_url"`           // Checksum file ("<hex> [filename]") for the downloaded file
+	PublicKey          string `yaml:"public_key"`           // Base64 Ed25519 key; the download must have a detached signature at <url>.sig
+	CheckIntervalHours int    `yaml:"check_interval_hours"` // How often to check for a newer database (default: 24)
+	KeepBackups        int    `yaml:"keep_backups"`         // Previous databases kept as <path>.1, <path>.2, ... (default: 2)
+}
+
+// AccessLogConfig configures where structured access log records are written
+type AccessLogConfig struct {
+	Enabled             bool   `yaml:"enabled"`                // Emit access logs (default: true)
+	Sink                string `yaml:"sink"`                   // "stdout", "file", "syslog", or "http" (default: stdout)
+	Path                string `yaml:"path"`                   // File sink: log file path
+	MaxSizeMB           int    `yaml:"max_size_mb"`            // File sink: rotate when the file exceeds this size (default: 100)
+	MaxBackups          int    `yaml:"max_backups"`            // File sink: rotated files to keep (default: 5)
+	SyslogNetwork       string `yaml:"syslog_network"`         // Syslog sink: "" for the local daemon, or "udp"/"tcp"
+	SyslogAddress       string `yaml:"syslog_address"`         // Syslog sink: remote address (host:port) when network is set
+	SyslogTag           string `yaml:"syslog_tag"`             // Syslog sink: tag (default: opsen-access)
+	HTTPURL             string `yaml:"http_url"`               // HTTP sink: endpoint receiving newline-delimited JSON batches
+	HTTPBatchSize       int    `yaml:"http_batch_size"`        // HTTP sink: max records per POST (default: 100)
+	HTTPFlushIntervalMs int    `yaml:"http_flush_interval_ms"` // HTTP sink: max time between POSTs (default: 1000)
+}
+
+// SimulationProfile describes the hardware and behaviour of a synthetic backend
+type SimulationProfile struct {
+	Name        string  `yaml:"name"`
+	CPU         int     `yaml:"cpu"`           // Number of CPU cores
+	MemoryGB    float64 `yaml:"memory_gb"`     // Total memory
+	StorageGB   float64 `yaml:"storage_gb"`    // Total disk
+	GPUs        int     `yaml:"gpus"`          // Number of GPUs (0 = none)
+	GPUMemoryGB float64 `yaml:"gpu_memory_gb"` // VRAM per GPU
+	BaseLoadPct float64 `yaml:"base_load_pct"` // Idle CPU usage per core before any sessions
+	LatencyMs   float64 `yaml:"latency_ms"`    // Mean response latency of the fake endpoint
+	JitterMs    float64 `yaml:"jitter_ms"`     // Uniform +/- jitter added to the latency
+	HourlyCost  float64 `yaml:"hourly_cost"`   // Registered hourly cost (for cost-aware routing)
 }
 
 // ClientConfig represents the client configuration
 type ClientConfig struct {
 	ServerURL       string           `yaml:"server_url"`
+	ServerURLs      []string         `yaml:"server_urls"`       // Load balancer servers in failover order (replaces server_url when set)
+	ServerSRV       string           `yaml:"server_srv"`        // DNS SRV name to discover servers (e.g. _opsen._tcp.example.com)
+	ServerSRVScheme string           `yaml:"server_srv_scheme"` // URL scheme for SRV targets (default: https)
+	ServerFailbackSecs int           `yaml:"server_failback_interval_seconds"` // How often to retry higher-priority servers and refresh SRV (default: 60)
 	ClientID        string           `yaml:"client_id"`
 	Hostname        string           `yaml:"hostname"`
 	WindowMinutes   int              `yaml:"window_minutes"`
+	ShortWindowSecs int              `yaml:"short_window_seconds"` // Also report per-core CPU averaged over this short window, for latency-sensitive tiers (default: 60, 0 disables)
 	ReportInterval  int              `yaml:"report_interval_seconds"`
 	DiskPath        string           `yaml:"disk_path"`
 	LogLevel        string           `yaml:"log_level"`
 	EndpointURL     string           `yaml:"endpoint_url"`
+	EndpointProtocol string          `yaml:"endpoint_protocol"` // Upstream protocol for endpoint_url: http1, h2c or h2 (default: http1)
+	EndpointPort    int              `yaml:"endpoint_port"`     // Port the server builds endpoints with when endpoint_url is not set (default: 11000)
+	DisableIPv6     bool             `yaml:"disable_ipv6"`      // Do not advertise an IPv6 address alongside the IPv4 one
 	Endpoints       []EndpointConfig `yaml:"endpoints"`
 	GeoIPDBPath     string           `yaml:"geoip_db_path"`
 	SkipGeolocation bool             `yaml:"skip_geolocation"`
 	InsecureTLS     bool             `yaml:"insecure_tls"`
+	CACertFile      string           `yaml:"ca_cert_file"`  // PEM bundle trusted in addition to the system roots, e.g. a corporate CA
+	Proxy           string           `yaml:"proxy"`         // Proxy for outbound calls: http://, https://, socks5:// or socks5h:// URL (default: HTTP_PROXY/HTTPS_PROXY)
+	NoProxy         string           `yaml:"no_proxy"`      // Hosts, domains and CIDRs reached directly, comma-separated (default: NO_PROXY)
 	ServerKey       string           `yaml:"server_key"`
+	AuthMode        string           `yaml:"auth_mode"` // "key" (X-API-Key header) or "hmac" (signed requests) (default: key)
+	HourlyCost      float64          `yaml:"hourly_cost"` // Cost of running this backend per hour, used for cost-aware routing
+	Tenant          string           `yaml:"tenant"`      // Tenant to register into (default: the tenant of server_key, or "default")
+	Pool            string           `yaml:"pool"`        // Backend pool the server's routing rules can target (optional)
+	ServiceVersion  string           `yaml:"service_version"` // Version of the software this backend serves, for version-pinned routing (optional)
+	Labels          map[string]string `yaml:"labels"`         // Free-form key/value tags, e.g. rack: r12 (optional)
+	ApprovalToken   string           `yaml:"approval_token"`  // Lets the server's registration_approval auto_approve tokens approve this backend (optional)
+	ReachabilityCheckSecs int        `yaml:"reachability_check_seconds"` // How often to ask the server to probe the advertised endpoint (default: 300, 0 disables)
+	CompressRequests bool            `yaml:"compress_requests"`         // Gzip request bodies sent to the server (Content-Encoding: gzip)
+	StatsDelta      bool             `yaml:"stats_delta"`               // Send only changed stats fields between full snapshots (used once the server advertises support)
+	StatsFullEvery  int              `yaml:"stats_full_snapshot_every"` // In delta mode, send a full snapshot every N reports (default: 10)
+	StatsSpoolPath  string           `yaml:"stats_spool_path"`        // File for reports missed while the server is unreachable, replayed via /stats/batch (default: empty = disabled)
+	StatsSpoolMaxReports int         `yaml:"stats_spool_max_reports"` // Spooled reports kept; the oldest are evicted (default: 1000)
+	ProbeStatsListen string          `yaml:"probe_stats_listen"`      // Serve the latest stats at GET /probe-stats on this address, so a restarted server can fetch them at once (e.g. ":9101", default: disabled)
+	ProbeStatsURL    string          `yaml:"probe_stats_url"`         // URL the server fetches them from (default: http://<local_ip>:<listen port>/probe-stats)
+	AutoUpdate      AutoUpdateConfig `yaml:"auto_update"`
+	VantageProbe    VantageProbeConfig `yaml:"vantage_probe"`
+	BandwidthTest   BandwidthTestConfig `yaml:"bandwidth_test"`
+	Inventory       InventoryConfig  `yaml:"inventory"`
+}
+
+// InventoryConfig reports the containers or VMs running on the host with stats
+type InventoryConfig struct {
+	Enabled      bool   `yaml:"enabled"`          // Enumerate workloads and include them in stats (default: false)
+	Runtime      string `yaml:"runtime"`          // docker or libvirt (default: docker)
+	DockerSocket string `yaml:"docker_socket"`    // Docker Engine API socket (default: /var/run/docker.sock)
+	LibvirtURI   string `yaml:"libvirt_uri"`      // Connection URI passed to virsh -c (default: qemu:///system)
+	RefreshSecs  int    `yaml:"refresh_seconds"`  // How often to re-enumerate; reports in between reuse the last inventory (default: 60)
+	MaxWorkloads int    `yaml:"max_workloads"`    // Workloads listed individually; the summary counts all of them (default: 50)
+}
+
+// BandwidthTestConfig measures the agent's link at registration so the server can keep
+// data-heavy tiers off thin uplinks
+type BandwidthTestConfig struct {
+	Enabled      bool   `yaml:"enabled"`         // Run the test on every registration (default: false)
+	ReferenceURL string `yaml:"reference_url"`   // Also download from this URL to measure the link to the internet at large (optional)
+	SkipServer   bool   `yaml:"skip_server"`     // Only test reference_url, not the load balancer
+	SizeMB       int    `yaml:"size_mb"`         // Data transferred in each direction (default: 4)
+	TimeoutSecs  int    `yaml:"timeout_seconds"` // Limit for each transfer (default: 15)
+}
+
+// VantageProbeConfig runs the agent as a latency probe: it measures every backend from its
+// own location instead of registering as a backend
+type VantageProbeConfig struct {
+	Enabled      bool    `yaml:"enabled"`          // Run in probe mode (also enabled by the -probe flag)
+	Region       string  `yaml:"region"`           // Region name reported with measurements (e.g. eu-west)
+	Latitude     float64 `yaml:"latitude"`         // Probe location; end users are matched to the nearest probe
+	Longitude    float64 `yaml:"longitude"`
+	IntervalSecs int     `yaml:"interval_seconds"` // How often to measure all backends (default: 30)
+	TimeoutMs    int     `yaml:"timeout_ms"`       // Connect timeout, reported as the latency of unreachable backends (default: 2000)
+}
+
+// AutoUpdateConfig configures agent self-update from a signed release manifest
+type AutoUpdateConfig struct {
+	Enabled           bool   `yaml:"enabled"`                // Poll the manifest and replace the agent binary when the channel's version changes (default: false)
+	ManifestURL       string `yaml:"manifest_url"`           // Release manifest; its signature is fetched from {manifest_url}.sig
+	Channel           string `yaml:"channel"`                // Release channel: stable or beta (default: stable)
+	PublicKey         string `yaml:"public_key"`             // Base64 Ed25519 key the manifest must be signed with
+	CheckIntervalSecs int    `yaml:"check_interval_seconds"` // How often to poll the manifest, with up to 10% jitter (default: 3600)
 }
 
 // LoadServerConfig loads server configuration from YAML file
 func LoadServerConfig(path string) (*ServerConfig, error) {
+	return LoadServerConfigProfile(path, "")
+}
+
+// LoadServerConfigProfile loads server configuration with its includes, applying the named profile(s)
+// instead of the file's own profile key when profile is set
+func LoadServerConfigProfile(path, profile string) (*ServerConfig, error) {
 	// Default configuration with standard tiers and security defaults
 	config := &ServerConfig{
 		Port:                8080,
 		Database:            "opsen.db",
 		StaleMinutes:        5,
+		StaleMissedReports:  3,
 		CleanupIntervalSecs: 60,
+		StartupReconcileSecs: 5,
 		Host:                "0.0.0.0",
 		LogLevel:            "info",
 		JSONLogging:         false,
@@ -105,20 +682,28 @@ func LoadServerConfig(path string) (*ServerConfig, error) {
 		ProxySSEFlushInterval: -1,         // Immediate flush for SSE support by default
 
 		// Security defaults
+		AgentAuthMode:       AuthModeKey,  // Bearer key in X-API-Key header
+		HMACMaxSkewSecs:     300,          // 5 minutes clock skew for signed agent requests
 		RateLimitPerMinute:  60,           // 60 requests per minute per IP
 		RateLimitBurst:      120,          // Allow burst of 120 requests
+		RateLimitBackend:    "memory",     // Per-instance token buckets
 		MaxRequestBodyBytes: 10 * 1024 * 1024, // 10MB max request body
 		RequestTimeout:      30,           // 30 second request timeout
 		IdleTimeout:         120,          // 120 second idle timeout (2 minutes)
 		ReadHeaderTimeout:   10,           // 10 second read header timeout (Slowloris protection)
 		TLSInsecureSkipVerify: false,      // Secure by default
+		HTTP2Enabled:        true,         // HTTP/2 via ALPN on TLS listeners
+		RoutingHeaders:      true,         // Placement metadata on proxied responses
 		DisableSecurityHeaders: false,     // Enable security headers by default
 
 		// Sticky session defaults
 		StickyHeader:          "",         // Disabled by default
 		StickyByIP:            false,      // Disabled by default
 		StickyAffinityEnabled: true,       // When enabled, prefer same server across tiers
+		StickyMode:            "table",    // Persisted sticky assignments
+		StickyStore:           "sqlite",   // Assignments in the server's database
 		PendingAllocationTimeoutSecs: 120, // 2 minutes default
+		MaxLeaseSecs:                 3600,
 
 		// Tier selection defaults
 		TierFieldName:         "tier",     // Default JSON field name
@@ -140,6 +725,138 @@ func LoadServerConfig(path string) (*ServerConfig, error) {
 		HealthCheckPath:               "/health",
 		HealthCheckUnhealthyThreshold: 3,
 		HealthCheckHealthyThreshold:   2,
+		HealthCheckDegradedPenalty:    200,
+		HealthCheckSessionWeight:      5,
+		DefaultEndpointPort:           11000,
+
+		// CPU headroom defaults
+		CoreThreshold: 80,
+		CPUHeadroom:   "per_core",
+
+		// GPU fault defaults (double-bit ECC, NVLink, fallen off the bus, contained/uncontained ECC, GSP errors)
+		GPUCriticalXIDs:     []uint64{48, 74, 79, 94, 95, 119, 120},
+		GPUFaultHoldMinutes: 30,
+
+		// Redis defaults
+		Redis: RedisConfig{
+			Address:   "localhost:6379",
+			KeyPrefix: "opsen:",
+		},
+
+		// GeoIP defaults (auto-update disabled unless enabled: true)
+		GeoIP: GeoIPConfig{
+			Provider:      "mmdb",
+			HTTPTimeoutMs: 1000,
+			CacheSize:     10000,
+			CacheTTLSecs:  3600,
+			SameASNBonus:  100,
+			AutoUpdate: GeoIPAutoUpdateConfig{
+				CheckIntervalHours: 24,
+				KeepBackups:        2,
+			},
+		},
+
+		StickyMigrateNotifyPath: "/opsen/migrate",
+
+		// Stats write batching defaults
+		StatsWriteBatchSize: 500,
+		StatsWriteFlushMs:   1000,
+		StatsWriteQueueSize: 10000,
+		CleanupBatchSize:    500,
+
+		Backup: BackupConfig{
+			Keep: 7,
+		},
+
+		RoutingCookie: RoutingCookieConfig{
+			Name:    "opsen_route",
+			TTLSecs: 3600,
+		},
+
+		Parent: ParentConfig{
+			AuthMode:           AuthModeKey,
+			ReportIntervalSecs: 10,
+		},
+
+		VantageProbes: VantageProbesConfig{
+			MaxAgeSecs: 300,
+		},
+
+		LoadShedding: LoadSheddingConfig{
+			StartUtilizationPct:  85,
+			FullUtilizationPct:   98,
+			RetryAfterSecs:       30,
+			EvaluateIntervalSecs: 5,
+		},
+
+		Autoscale: AutoscaleConfig{
+			DryRun:                  true,
+			EvaluateIntervalSecs:    30,
+			ScaleUpAfterMins:        5,
+			ScaleDownUtilizationPct: 20,
+			ScaleDownAfterMins:      30,
+			MinBackends:             1,
+			MaxTeardown:             1,
+			CooldownMins:            10,
+			ProvisionerTimeoutMs:    5000,
+		},
+
+		Maintenance: MaintenanceConfig{
+			StatusCode:     503,
+			Message:        "Service is under maintenance",
+			RetryAfterSecs: 300,
+		},
+
+		ClientErrors: ClientErrorsConfig{
+			RetentionHours:  168,
+			MaxPerClient:    1000,
+			WebhookSeverity: ErrorSeverityError,
+		},
+
+		SlowStart: SlowStartConfig{
+			Mode:         "penalty",
+			ScorePenalty: 100,
+		},
+
+		StatsAnomaly: StatsAnomalyConfig{
+			Enabled:          true,
+			QuarantineSecs:   300,
+			MaxClockSkewSecs: 300,
+			FrozenReports:    10,
+		},
+
+		ProxyConcurrency: ProxyConcurrencyConfig{
+			Overflow:       "spill",
+			QueueTimeoutMs: 1000,
+			ScoreWeight:    5,
+		},
+
+		CircuitBreaker: CircuitBreakerConfig{
+			MaxFailures:      5,
+			OpenSecs:         30,
+			HalfOpenRequests: 1,
+		},
+
+		OutlierDetection: OutlierDetectionConfig{
+			WindowSecs:       60,
+			MinRequests:      20,
+			ErrorRatePct:     50,
+			BaseEjectionSecs: 30,
+			MaxEjectionSecs:  300,
+			MaxEjectionPct:   50,
+			ReadmitSecs:      30,
+		},
+
+		// Access log defaults
+		AccessLog: AccessLogConfig{
+			Enabled:             true,
+			Sink:                "stdout",
+			MaxSizeMB:           100,
+			MaxBackups:          5,
+			SyslogTag:           "opsen-access",
+			HTTPBatchSize:       100,
+			HTTPFlushIntervalMs: 1000,
+		},
 
 		Tiers: []TierSpec{
 			{Name: "free", VCPU: 1, MemoryGB: 1.0, StorageGB: 0},
@@ -155,15 +872,15 @@ func LoadServerConfig(path string) (*ServerConfig, error) {
 		return config, nil
 	}
 
-	data, err := os.ReadFile(path)
+	doc, err := loadConfigDocument(path, profile)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return config, nil
-		}
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
+	}
+	if doc == nil {
+		return config, nil
 	}
 
-	if err := yaml.Unmarshal(data, config); err != nil {
+	if err := doc.Decode(config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
@@ -183,13 +900,46 @@ func LoadServerConfig(path string) (*ServerConfig, error) {
 
 // LoadClientConfig loads client configuration from YAML file
 func LoadClientConfig(path string) (*ClientConfig, error) {
+	return LoadClientConfigProfile(path, "")
+}
+
+// LoadClientConfigProfile loads client configuration with its includes, applying the named profile(s)
+// instead of the file's own profile key when profile is set
+func LoadClientConfigProfile(path, profile string) (*ClientConfig, error) {
 	// Default configuration
 	config := &ClientConfig{
 		ServerURL:      "http://localhost:8080",
 		WindowMinutes:  15,
+		ShortWindowSecs: 60,
 		ReportInterval: 60,
 		DiskPath:       "/",
 		LogLevel:       "info",
+		AuthMode:       AuthModeKey,
+		ServerSRVScheme:    "https",
+		ServerFailbackSecs: 60,
+		ReachabilityCheckSecs: 300,
+		EndpointPort:   11000,
+		StatsFullEvery: 10,
+		StatsSpoolMaxReports: 1000,
+		AutoUpdate: AutoUpdateConfig{
+			Channel:           UpdateChannelStable,
+			CheckIntervalSecs: 3600,
+		},
+		VantageProbe: VantageProbeConfig{
+			IntervalSecs: 30,
+			TimeoutMs:    2000,
+		},
+		BandwidthTest: BandwidthTestConfig{
+			SizeMB:      4,
+			TimeoutSecs: 15,
+		},
+		Inventory: InventoryConfig{
+			Runtime:      "docker",
+			DockerSocket: "/var/run/docker.sock",
+			LibvirtURI:   "qemu:///system",
+			RefreshSecs:  60,
+			MaxWorkloads: 50,
+		},
 	}
 
 	// If no config file specified or doesn't exist, return defaults
@@ -197,15 +947,15 @@ func LoadClientConfig(path string) (*ClientConfig, error) {
 		return config, nil
 	}
 
-	data, err := os.ReadFile(path)
+	doc, err := loadConfigDocument(path, profile)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return config, nil
-		}
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
+	}
+	if doc == nil {
+		return config, nil
 	}
 
-	if err := yaml.Unmarshal(data, config); err != nil {
+	if err := doc.Decode(config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
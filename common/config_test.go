@@ -478,3 +478,38 @@ func TestServerConfig_DatabaseDefaults(t *testing.T) {
 		t.Errorf("Expected DB conn max lifetime 300s, got %d", config.DBConnMaxLifetime)
 	}
 }
+
+// TestServerConfig_AccessLogPartialOverride verifies unspecified access log fields keep their defaults
+func TestServerConfig_AccessLogPartialOverride(t *testing.T) {
+	yamlContent := `
+access_log:
+  sink: file
+  path: /var/log/opsen/access.log
+`
+
+	tmpFile, err := os.CreateTemp("", "access-log-*.yml")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.WriteString(yamlContent); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	tmpFile.Close()
+
+	config, err := LoadServerConfig(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if !config.AccessLog.Enabled {
+		t.Error("Expected access log to stay enabled by default")
+	}
+	if config.AccessLog.Sink != "file" || config.AccessLog.Path != "/var/log/opsen/access.log" {
+		t.Errorf("Expected file sink at configured path, got %+v", config.AccessLog)
+	}
+	if config.AccessLog.MaxSizeMB != 100 || config.AccessLog.MaxBackups != 5 {
+		t.Errorf("Expected default rotation 100MB/5 backups, got %dMB/%d", config.AccessLog.MaxSizeMB, config.AccessLog.MaxBackups)
+	}
+}
@@ -0,0 +1,195 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Top-level keys that compose a configuration from several documents; they are removed before decoding
+const (
+	configIncludeKey  = "include"  // File or list of files (globs allowed) merged underneath this one
+	configProfilesKey = "profiles" // Profile name → overlay merged on top when the profile is active
+	configProfileKey  = "profile"  // Active profile(s), comma-separated, applied in order
+)
+
+// loadConfigDocument reads a YAML configuration with its includes and active profiles merged into one
+// mapping node. Later documents win: includes in listed order, then the file itself, then each profile.
+// Mappings merge key by key; scalars and lists are replaced as a whole. profile overrides the file's own
+// profile key. Returns nil if the file does not exist
+func loadConfigDocument(path, profile string) (*yaml.Node, error) {
+	doc, err := readConfigWithIncludes(path, nil)
+	if err != nil || doc == nil {
+		return nil, err
+	}
+
+	profiles := takeMappingKey(doc, configProfilesKey)
+	active := takeMappingKey(doc, configProfileKey)
+	if profile == "" && active != nil {
+		if active.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("%s: %s must be a profile name", path, configProfileKey)
+		}
+		profile = active.Value
+	}
+	if profile == "" {
+		return doc, nil
+	}
+
+	for _, name := range strings.Split(profile, ",") {
+		name = strings.TrimSpace(name)
+		overlay := mappingValue(profiles, name)
+		if overlay == nil {
+			return nil, fmt.Errorf("%s: unknown profile %q", path, name)
+		}
+		if overlay.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s: profile %q must be a mapping", path, name)
+		}
+		mergeConfigNodes(doc, overlay)
+	}
+	return doc, nil
+}
+
+// readConfigWithIncludes parses one file and merges it over the files it includes
+// chain holds the files being read, to reject include cycles
+func readConfigWithIncludes(path string, chain []string) (*yaml.Node, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(chain, absPath) {
+		return nil, fmt.Errorf("include cycle: %s", strings.Join(append(chain, absPath), " -> "))
+	}
+	chain = append(chain, absPath)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && len(chain) == 1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var file yaml.Node
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	doc := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if len(file.Content) > 0 {
+		doc = file.Content[0]
+	}
+	if doc.Kind != yaml.MappingNode {
+		if doc.Tag == "!!null" {
+			doc = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		} else {
+			return nil, fmt.Errorf("failed to parse config file %s: top level must be a mapping", path)
+		}
+	}
+
+	includes, err := includePaths(path, takeMappingKey(doc, configIncludeKey))
+	if err != nil {
+		return nil, err
+	}
+	if len(includes) == 0 {
+		return doc, nil
+	}
+
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, include := range includes {
+		included, err := readConfigWithIncludes(include, chain)
+		if err != nil {
+			return nil, err
+		}
+		mergeConfigNodes(merged, included)
+	}
+	mergeConfigNodes(merged, doc)
+	return merged, nil
+}
+
+// includePaths resolves an include value (one path or a list) relative to the including file
+// Globs expand in lexical order and may match nothing; plain paths must exist
+func includePaths(from string, value *yaml.Node) ([]string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	var patterns []string
+	switch value.Kind {
+	case yaml.ScalarNode:
+		patterns = []string{value.Value}
+	case yaml.SequenceNode:
+		if err := value.Decode(&patterns); err != nil {
+			return nil, fmt.Errorf("%s: %s must be a path or a list of paths", from, configIncludeKey)
+		}
+	default:
+		return nil, fmt.Errorf("%s: %s must be a path or a list of paths", from, configIncludeKey)
+	}
+
+	var paths []string
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(from), pattern)
+		}
+		if !strings.ContainsAny(pattern, "*?[") {
+			paths = append(paths, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid include pattern %q: %w", from, pattern, err)
+		}
+		slices.Sort(matches)
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// mergeConfigNodes merges overlay into base (both mappings): nested mappings merge recursively, anything
+// else replaces the base value. New keys are appended in overlay order
+func mergeConfigNodes(base, overlay *yaml.Node) {
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		key, value := overlay.Content[i], overlay.Content[i+1]
+		existing := mappingValue(base, key.Value)
+		switch {
+		case existing == nil:
+			base.Content = append(base.Content, key, value)
+		case existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			mergeConfigNodes(existing, value)
+		default:
+			*existing = *value
+		}
+	}
+}
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// takeMappingKey removes key from a mapping node and returns its value, or nil
+func takeMappingKey(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			value := mapping.Content[i+1]
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return value
+		}
+	}
+	return nil
+}
+
+// EffectiveConfigYAML renders a loaded configuration, with defaults, includes, profiles and flag overrides
+// applied, for --print-effective-config
+func EffectiveConfigYAML(config interface{}) ([]byte, error) {
+	return yaml.Marshal(config)
+}
@@ -0,0 +1,136 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfigFiles writes name → content files into a temporary directory and returns it
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// TestLoadServerConfig_Include verifies included files are merged underneath the including file
+func TestLoadServerConfig_Include(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"base.yml": `
+port: 9000
+proxy_endpoints: ["/api", "/v1"]
+access_log:
+  sink: file
+  path: /var/log/opsen/access.log
+`,
+		"conf.d/10-limits.yml": "rate_limit_per_minute: 100\n",
+		"conf.d/20-limits.yml": "rate_limit_per_minute: 200\n",
+		"site.yml": `
+include: [base.yml, "conf.d/*.yml"]
+port: 9100
+proxy_endpoints: ["/browse"]
+access_log:
+  max_size_mb: 50
+`,
+	})
+
+	config, err := LoadServerConfig(filepath.Join(dir, "site.yml"))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.Port != 9100 {
+		t.Errorf("Expected the including file to win, got port %d", config.Port)
+	}
+	if len(config.ProxyEndpoints) != 1 || config.ProxyEndpoints[0] != "/browse" {
+		t.Errorf("Expected lists to be replaced, got %v", config.ProxyEndpoints)
+	}
+	if config.AccessLog.Sink != "file" || config.AccessLog.MaxSizeMB != 50 || config.AccessLog.MaxBackups != 5 {
+		t.Errorf("Expected mappings to merge over defaults, got %+v", config.AccessLog)
+	}
+	if config.RateLimitPerMinute != 200 {
+		t.Errorf("Expected globbed includes in lexical order, got rate limit %d", config.RateLimitPerMinute)
+	}
+}
+
+// TestLoadServerConfig_Profiles verifies the file's profile is applied and the argument replaces it
+func TestLoadServerConfig_Profiles(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"base.yml": `
+database: opsen.db
+profiles:
+  eu:
+    database: /data/eu.db
+    geoip:
+      prefer_same_asn: true
+  us:
+    database: /data/us.db
+  debug:
+    log_level: debug
+`,
+		"site.yml": "include: base.yml\nprofile: eu\n",
+	})
+	path := filepath.Join(dir, "site.yml")
+
+	config, err := LoadServerConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.Database != "/data/eu.db" || !config.GeoIP.PreferSameASN || config.GeoIP.Provider != "mmdb" {
+		t.Errorf("Expected the eu profile over the defaults, got database %s and geoip %+v", config.Database, config.GeoIP)
+	}
+
+	config, err = LoadServerConfigProfile(path, "us, debug")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.Database != "/data/us.db" || config.LogLevel != "debug" || config.GeoIP.PreferSameASN {
+		t.Errorf("Expected only the us and debug profiles, got database %s, log level %s", config.Database, config.LogLevel)
+	}
+
+	if _, err := LoadServerConfigProfile(path, "apac"); err == nil || !strings.Contains(err.Error(), "apac") {
+		t.Errorf("Expected an unknown profile error, got %v", err)
+	}
+}
+
+// TestLoadConfig_IncludeErrors verifies include cycles and missing included files are reported
+func TestLoadConfig_IncludeErrors(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"a.yml":       "include: b.yml\n",
+		"b.yml":       "include: a.yml\n",
+		"missing.yml": "include: nowhere.yml\n",
+	})
+
+	if _, err := LoadClientConfig(filepath.Join(dir, "a.yml")); err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("Expected an include cycle error, got %v", err)
+	}
+	if _, err := LoadClientConfig(filepath.Join(dir, "missing.yml")); err == nil {
+		t.Error("Expected an error for a missing included file")
+	}
+}
+
+// TestLoadClientConfig_Include verifies agent configs compose the same way
+func TestLoadClientConfig_Include(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"org.yml":  "server_url: https://lb.example.com\nreport_interval_seconds: 30\nprofiles:\n  gpu:\n    report_interval_seconds: 10\n",
+		"host.yml": "include: org.yml\nclient_id: gpu-host-1\n",
+	})
+
+	config, err := LoadClientConfigProfile(filepath.Join(dir, "host.yml"), "gpu")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.ServerURL != "https://lb.example.com" || config.ClientID != "gpu-host-1" || config.ReportInterval != 10 {
+		t.Errorf("Unexpected merged config: server_url=%s client_id=%s report_interval=%d",
+			config.ServerURL, config.ClientID, config.ReportInterval)
+	}
+}
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Columns covered by row signatures (row_hmac), in signing order
+// The server signs rows with these values on insert; opsenctl verify-db reads them back in the same order
+// Stats rows sign the id SQLite assigns, so a row can't be copied or renumbered; they are signed just after insert
+var (
+	SignedStatsColumns = []string{
+		"id", "client_id", "timestamp", "cpu_cores", "cpu_usage_json",
+		"memory_total", "memory_used", "memory_avail",
+		"disk_total", "disk_used", "disk_avail", "gpu_stats_json",
+		"load_avg_1", "load_avg_5", "load_avg_15", "swap_total", "swap_used", "psi_json",
+	}
+	SignedStickyColumns = []string{"sticky_id", "tier", "client_id"}
+)
+
+// SignRow computes the hex-encoded HMAC-SHA256 of a persisted database row
+// Values are canonicalized so a row signed before insert verifies after being read back from SQLite:
+// integers and floats in shortest decimal form, times as UTC RFC 3339, text and blobs as-is, NULL as empty
+func SignRow(key, table string, values ...interface{}) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	fmt.Fprintf(mac, "%d:%s\n", len(table), table)
+	for _, v := range values {
+		s := canonicalRowValue(v)
+		fmt.Fprintf(mac, "%d:%s\n", len(s), s)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyRow checks a row signature in constant time
+func VerifyRow(key, table, signature string, values ...interface{}) bool {
+	expected := SignRow(key, table, values...)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func canonicalRowValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	case int:
+		return strconv.Itoa(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	case bool:
+		if value {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return value.UTC().Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,55 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SchemaVersion is the registration and stats payload schema this build speaks ("major.minor")
+// Minor versions only add optional fields, so older minors are accepted with those fields at their defaults
+// A new major changes the meaning of existing fields and is rejected by servers that don't know it
+const SchemaVersion = "1.1"
+
+// LegacySchemaVersion is assumed for payloads without schema_version (agents that predate versioning)
+const LegacySchemaVersion = "1.0"
+
+// ParseSchemaVersion splits a "major.minor" schema version
+func ParseSchemaVersion(version string) (int, int, error) {
+	majorText, minorText, ok := strings.Cut(version, ".")
+	if !ok {
+		minorText = "0"
+	}
+	major, err1 := strconv.Atoi(majorText)
+	minor, err2 := strconv.Atoi(minorText)
+	if err1 != nil || err2 != nil || major < 1 || minor < 0 {
+		return 0, 0, fmt.Errorf("invalid schema_version %q (expected major.minor, e.g. %s)", version, SchemaVersion)
+	}
+	return major, minor, nil
+}
+
+// NegotiateSchemaVersion returns the version both sides understand for a payload declaring version
+// Newer minors of the current major negotiate down (their extra fields are ignored); newer majors are an error
+func NegotiateSchemaVersion(version string) (string, error) {
+	if version == "" {
+		return LegacySchemaVersion, nil
+	}
+
+	major, minor, err := ParseSchemaVersion(version)
+	if err != nil {
+		return "", err
+	}
+	currentMajor, currentMinor, _ := ParseSchemaVersion(SchemaVersion)
+	if major > currentMajor {
+		return "", fmt.Errorf("schema_version %s is not supported by this server (supports %d.x up to %s); upgrade the server before the agent",
+			version, currentMajor, SchemaVersion)
+	}
+	if major < currentMajor {
+		return "", fmt.Errorf("schema_version %s is no longer supported by this server (supports %d.x); upgrade the agent",
+			version, currentMajor)
+	}
+	if minor > currentMinor {
+		return SchemaVersion, nil
+	}
+	return fmt.Sprintf("%d.%d", major, minor), nil
+}
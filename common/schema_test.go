@@ -0,0 +1,32 @@
+package common
+
+import "testing"
+
+// TestNegotiateSchemaVersion verifies version defaulting, minor negotiation and major rejection
+func TestNegotiateSchemaVersion(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected string
+		wantErr  bool
+	}{
+		{"", LegacySchemaVersion, false},
+		{"1.0", "1.0", false},
+		{"1", "1.0", false},
+		{SchemaVersion, SchemaVersion, false},
+		{"1.7", SchemaVersion, false},
+		{"2.0", "", true},
+		{"0.9", "", true},
+		{"1.x", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := NegotiateSchemaVersion(tt.version)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NegotiateSchemaVersion(%q) error = %v, wantErr %v", tt.version, err, tt.wantErr)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("NegotiateSchemaVersion(%q) = %q, expected %q", tt.version, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// Headers carrying HMAC request signatures (agent_auth_mode: hmac)
+const (
+	SignatureTimestampHeader = "X-Opsen-Timestamp"
+	SignatureNonceHeader     = "X-Opsen-Nonce"
+	SignatureHeader          = "X-Opsen-Signature"
+)
+
+// Agent authentication modes
+const (
+	AuthModeKey  = "key"  // Shared key sent in the X-API-Key header
+	AuthModeHMAC = "hmac" // HMAC-SHA256 signature over timestamp, nonce, method, path, and body
+)
+
+// SignRequest computes the hex-encoded HMAC-SHA256 signature of a request
+// The signed string is: timestamp \n nonce \n METHOD \n path \n body
+func SignRequest(secret string, timestamp int64, nonce, method, path string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{
+		strconv.FormatInt(timestamp, 10),
+		nonce,
+		strings.ToUpper(method),
+		path,
+	}, "\n")))
+	mac.Write([]byte("\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a hex-encoded signature in constant time
+func VerifySignature(secret string, timestamp int64, nonce, method, path string, body []byte, signature string) bool {
+	expected := SignRequest(secret, timestamp, nonce, method, path, body)
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(signature)))
+}
+
+// NewNonce returns a random 128-bit hex nonce
+func NewNonce() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,51 @@
+package common
+
+import "testing"
+
+// TestSignRequest_RoundTrip verifies signatures validate only for the exact request
+func TestSignRequest_RoundTrip(t *testing.T) {
+	body := []byte(`{"client_id":"abc"}`)
+	sig := SignRequest("secret", 1700000000, "nonce-1", "post", "/stats", body)
+
+	if !VerifySignature("secret", 1700000000, "nonce-1", "POST", "/stats", body, sig) {
+		t.Error("Expected signature to verify")
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		nonce     string
+		path      string
+		body      []byte
+	}{
+		{"wrong secret", "other", 1700000000, "nonce-1", "/stats", body},
+		{"wrong timestamp", "secret", 1700000001, "nonce-1", "/stats", body},
+		{"wrong nonce", "secret", 1700000000, "nonce-2", "/stats", body},
+		{"wrong path", "secret", 1700000000, "nonce-1", "/register", body},
+		{"tampered body", "secret", 1700000000, "nonce-1", "/stats", []byte(`{"client_id":"xyz"}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if VerifySignature(tt.secret, tt.timestamp, tt.nonce, "POST", tt.path, tt.body, sig) {
+				t.Error("Expected signature verification to fail")
+			}
+		})
+	}
+}
+
+// TestNewNonce verifies nonces are unique and hex-encoded
+func TestNewNonce(t *testing.T) {
+	a, err := NewNonce()
+	if err != nil {
+		t.Fatalf("Failed to generate nonce: %v", err)
+	}
+	b, _ := NewNonce()
+	if a == b {
+		t.Error("Expected distinct nonces")
+	}
+	if len(a) != 32 {
+		t.Errorf("Expected 32 hex characters, got %d", len(a))
+	}
+}
@@ -8,8 +8,31 @@ type TierSpec struct {
 	VCPU        int     `json:"vcpu" yaml:"vcpu"`
 	MemoryGB    float64 `json:"memory_gb" yaml:"memory_gb"`
 	StorageGB   int     `json:"storage_gb" yaml:"storage_gb"`
-	GPU         int     `json:"gpu,omitempty" yaml:"gpu,omitempty"`               // Number of GPUs required (optional)
+	GPU         float64 `json:"gpu,omitempty" yaml:"gpu,omitempty"`               // GPUs required (optional); below 1 shares one device (e.g. 0.25)
 	GPUMemoryGB float64 `json:"gpu_memory_gb,omitempty" yaml:"gpu_memory_gb,omitempty"` // GPU VRAM required in GB (optional)
+	MaxLatencyMs  float64 `json:"max_latency_ms,omitempty" yaml:"max_latency_ms,omitempty"`   // Reject backends whose probe latency EWMA exceeds this (0 = no limit)
+	MaxDistanceKm float64 `json:"max_distance_km,omitempty" yaml:"max_distance_km,omitempty"` // Reject backends farther than this from the client (0 = no limit)
+	AllowDegraded bool    `json:"allow_degraded,omitempty" yaml:"allow_degraded,omitempty"`   // Fall back to the best backend outside the budget when none is within it
+	Tenant      string  `json:"-" yaml:"-"`                                             // Tenant the tier was resolved for; only that tenant's backends match
+	ClientASN   uint    `json:"-" yaml:"-"`                                             // Requesting client's ASN when prefer_same_asn is on (0 = unknown)
+	VantageRegion string  `json:"-" yaml:"-"`                                            // Probe region nearest the requesting client; its latencies replace the LB's own (empty = none)
+	ExcludeClientID string `json:"-" yaml:"-"`                                         // Backend never selected for this placement (e.g. the source of a sticky migration)
+	Pool            string  `json:"-" yaml:"-"`                                        // Only backends in this pool match (set by routing rules)
+	PreferPool      string  `json:"-" yaml:"-"`                                        // Backends in this pool get PoolBonus (set by routing rules)
+	PoolBonus       float64 `json:"-" yaml:"-"`                                        // Score bonus for PreferPool backends, in km-equivalent points
+	ServiceVersion       string  `json:"-" yaml:"-"`                                   // Only backends running this service_version match (set by requests or routing rules)
+	PreferServiceVersion string  `json:"-" yaml:"-"`                                   // Backends running this service_version get ServiceVersionBonus
+	ServiceVersionBonus  float64 `json:"-" yaml:"-"`                                   // Score bonus for PreferServiceVersion backends, in km-equivalent points
+	Priority        int     `json:"priority,omitempty" yaml:"priority,omitempty"`     // Load shedding order: lower priorities are shed first, the highest never (default: 0)
+	GPUModels            []string `json:"gpu_models,omitempty" yaml:"gpu_models,omitempty"` // Only GPUs whose model name contains one of these match (e.g. "A100", case-insensitive)
+	MinComputeCapability float64  `json:"min_cc,omitempty" yaml:"min_cc,omitempty"`         // Only GPUs with at least this CUDA compute capability match (e.g. 8.0)
+	MinDiskMBps          float64  `json:"min_disk_mbps,omitempty" yaml:"min_disk_mbps,omitempty"` // Skip backends whose disk has less estimated spare throughput (0 = no limit)
+	MemoryAvailable      string   `json:"memory_available,omitempty" yaml:"memory_available,omitempty"` // Memory counted as available: used (default: total minus used), free, available (reclaimable) or commit
+	StickyPolicy         string   `json:"sticky_policy,omitempty" yaml:"sticky_policy,omitempty"`       // When the assigned backend can't take a session: prefer (move, default), strict (503) or degrade (move and flag it)
+	MinBandwidthMbps     float64  `json:"min_bandwidth_mbps,omitempty" yaml:"min_bandwidth_mbps,omitempty"` // Skip backends whose measured link is slower than this (0 = no limit; untested backends qualify)
+	CPUWindow            string   `json:"cpu_window,omitempty" yaml:"cpu_window,omitempty"`                 // CPU average routing uses: long (the agent's window_minutes, default) or short (its short_window_seconds)
+	CoreThreshold        float64  `json:"core_threshold,omitempty" yaml:"core_threshold,omitempty"`         // Overrides the server's core_threshold for this tier (percent, 0 = server's)
+	CPUHeadroom          string   `json:"cpu_headroom,omitempty" yaml:"cpu_headroom,omitempty"`             // Overrides the server's cpu_headroom for this tier: per_core or total
 }
 
 // TierSpecs maps tier names to their resource requirements
@@ -55,22 +78,185 @@ type GPUStats struct {
 	MemoryTotalGB  float64 `json:"memory_total_gb"`     // Total GPU VRAM in GB
 	TemperatureC   float64 `json:"temperature_c"`       // GPU temperature in Celsius
 	PowerDrawW     float64 `json:"power_draw_w,omitempty"` // Power draw in Watts (optional)
+
+	// Health (optional, NVML only)
+	ECCErrorsCorrected   uint64   `json:"ecc_errors_corrected,omitempty"`   // Volatile corrected ECC errors since driver load
+	ECCErrorsUncorrected uint64   `json:"ecc_errors_uncorrected,omitempty"` // Volatile uncorrected ECC errors since driver load
+	ThermalThrottling    bool     `json:"thermal_throttling,omitempty"`     // Clocks reduced due to temperature
+	PowerThrottling      bool     `json:"power_throttling,omitempty"`       // Clocks reduced due to power cap or power brake
+	RecentXIDs           []uint64 `json:"recent_xids,omitempty"`            // XID error codes seen since the previous report
+}
+
+// MemoryBreakdown splits host memory the way the kernel accounts for it (GB)
+// MemoryUsed/MemoryAvail treat all buffers and cache as free; tiers can pick a stricter definition (memory_available)
+type MemoryBreakdown struct {
+	FreeGB        float64 `json:"free_gb"`         // Memory not used for anything (MemFree)
+	BuffersGB     float64 `json:"buffers_gb"`      // Block device buffers
+	CachedGB      float64 `json:"cached_gb"`       // Page cache and reclaimable slab
+	AvailableGB   float64 `json:"available_gb"`    // Kernel estimate of memory usable without swapping (MemAvailable)
+	CommittedGB   float64 `json:"committed_gb"`    // Memory promised to processes (Committed_AS, Linux only)
+	CommitLimitGB float64 `json:"commit_limit_gb"` // Commit ceiling under strict overcommit (CommitLimit, Linux only)
+}
+
+// PressureStats holds Linux pressure stall information (PSI) averages
+// Values are the percentage of time (0-100) tasks were stalled on the resource
+type PressureStats struct {
+	CPUSomeAvg10    float64 `json:"cpu_some_avg10"`    // Some tasks stalled on CPU (10s average)
+	CPUSomeAvg60    float64 `json:"cpu_some_avg60"`    // Some tasks stalled on CPU (60s average)
+	MemorySomeAvg10 float64 `json:"memory_some_avg10"` // Some tasks stalled on memory (10s average)
+	MemoryFullAvg10 float64 `json:"memory_full_avg10"` // All tasks stalled on memory (10s average)
+	IOSomeAvg10     float64 `json:"io_some_avg10"`     // Some tasks stalled on I/O (10s average)
+	IOFullAvg10     float64 `json:"io_full_avg10"`     // All tasks stalled on I/O (10s average)
+}
+
+// SocketStats holds file descriptor and TCP socket usage (optional, Linux /proc only)
+// A backend can run out of descriptors or ephemeral ports with CPU and memory to spare
+type SocketStats struct {
+	OpenFDs             int            `json:"open_fds"`              // File handles allocated system-wide (fs/file-nr)
+	MaxFDs              int            `json:"max_fds"`               // System-wide limit (fs.file-max)
+	TCPStates           map[string]int `json:"tcp_states,omitempty"`  // TCP sockets (IPv4 and IPv6) by state, e.g. established, time_wait
+	TCPConnections      int            `json:"tcp_connections"`       // TCP sockets in any state but listen
+	EphemeralPortsUsed  int            `json:"ephemeral_ports_used"`  // Distinct local ports of the ephemeral range held by TCP sockets
+	EphemeralPortsTotal int            `json:"ephemeral_ports_total"` // Size of the range (net.ipv4.ip_local_port_range)
+}
+
+// FDUsagePct returns allocated file handles as a percentage of the limit (0 if unknown)
+func (s *SocketStats) FDUsagePct() float64 {
+	if s == nil || s.MaxFDs <= 0 {
+		return 0
+	}
+	return float64(s.OpenFDs) / float64(s.MaxFDs) * 100
+}
+
+// EphemeralPortUsagePct returns the share of the ephemeral port range in use (0 if unknown)
+func (s *SocketStats) EphemeralPortUsagePct() float64 {
+	if s == nil || s.EphemeralPortsTotal <= 0 {
+		return 0
+	}
+	return float64(s.EphemeralPortsUsed) / float64(s.EphemeralPortsTotal) * 100
+}
+
+// ThermalStats holds host thermal and power telemetry (optional, from Linux hwmon, thermal_throttle and RAPL)
+type ThermalStats struct {
+	CPUTempC          float64      `json:"cpu_temp_c,omitempty"`          // Hottest CPU package temperature in Celsius
+	CPUPackageTempsC  []float64    `json:"cpu_package_temps_c,omitempty"` // Per-package temperatures in Celsius
+	CPUThrottling     bool         `json:"cpu_throttling,omitempty"`      // Package thermal throttle events since the previous report
+	CPUThrottleEvents uint64       `json:"cpu_throttle_events,omitempty"` // Number of those events
+	CPUPowerW         float64      `json:"cpu_power_w,omitempty"`         // CPU package power (RAPL) averaged since the previous report
+	ChassisPowerW     float64      `json:"chassis_power_w,omitempty"`     // Whole-system power from a hwmon power meter (e.g. ACPI/IPMI)
+	Fans              []FanStats   `json:"fans,omitempty"`
+}
+
+// DiskIOStats is a block device's I/O activity averaged since the previous report (optional, Linux /proc/diskstats)
+type DiskIOStats struct {
+	Device     string  `json:"device"`              // Kernel device name (e.g. "nvme0n1", "sda1")
+	DiskPath   bool    `json:"disk_path,omitempty"` // Device backs the agent's disk_path (checked by min_disk_mbps)
+	ReadMBps   float64 `json:"read_mbps"`
+	WriteMBps  float64 `json:"write_mbps"`
+	ReadIOPS   float64 `json:"read_iops"`
+	WriteIOPS  float64 `json:"write_iops"`
+	QueueDepth float64 `json:"queue_depth"` // Average in-flight requests
+	UtilPct    float64 `json:"util_pct"`    // Share of time the device was busy (100 = saturated)
+}
+
+// InventoryStats summarizes the containers or VMs on a host, so operators can see what consumes its capacity
+type InventoryStats struct {
+	Runtime       string         `json:"runtime"`                   // docker or libvirt
+	Total         int            `json:"total"`                     // Workloads in any state
+	Running       int            `json:"running"`
+	VCPULimit     float64        `json:"vcpu_limit,omitempty"`      // Sum of running workloads' CPU limits
+	MemoryLimitGB float64        `json:"memory_limit_gb,omitempty"` // Sum of running workloads' memory limits
+	Unlimited     int            `json:"unlimited,omitempty"`       // Running workloads without a CPU or memory limit
+	Workloads     []WorkloadInfo `json:"workloads,omitempty"`       // Running first, capped at inventory.max_workloads
+	Truncated     bool           `json:"truncated,omitempty"`       // Workloads omitted by the cap
+	Error         string         `json:"error,omitempty"`           // Why the runtime could not be enumerated
+	CollectedAt   time.Time      `json:"collected_at"`
+}
+
+// WorkloadInfo is one container or VM of an inventory
+type WorkloadInfo struct {
+	Name     string  `json:"name"`
+	Image    string  `json:"image,omitempty"` // Container image (containers only)
+	State    string  `json:"state"`           // Runtime state, e.g. running, exited, paused, shut off
+	VCPU     float64 `json:"vcpu,omitempty"`  // CPU limit (0 = unlimited)
+	MemoryGB float64 `json:"memory_gb,omitempty"`
+}
+
+// FanStats is the reading of a single fan sensor
+type FanStats struct {
+	Name   string  `json:"name"`
+	RPM    float64 `json:"rpm"`
+	Failed bool    `json:"failed,omitempty"` // Sensor reports an alarm or a stopped fan
+}
+
+// EndpointReachability is the result of the load balancer probing an advertised endpoint back
+type EndpointReachability struct {
+	Endpoint  string    `json:"endpoint"`
+	Reachable bool      `json:"reachable"`
+	Error     string    `json:"error,omitempty"` // Dial error (e.g. refused, timed out behind NAT/firewall)
+	Hint      string    `json:"hint,omitempty"`  // Likely cause when unreachable
+	LatencyMs float64   `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// ProbeBackRequest asks the load balancer to probe a client's registered endpoints
+type ProbeBackRequest struct {
+	ClientID string `json:"client_id"`
+}
+
+// ProbeBackResponse lists the probe result for each registered endpoint
+type ProbeBackResponse struct {
+	ClientID  string                 `json:"client_id"`
+	Endpoints []EndpointReachability `json:"endpoints"`
+}
+
+// VantageTarget is a backend endpoint a vantage probe measures (GET /vantage/targets)
+type VantageTarget struct {
+	ClientID string `json:"client_id"`
+	Endpoint string `json:"endpoint"`
+}
+
+// VantageTargetsResponse lists the backends a vantage probe should measure
+type VantageTargetsResponse struct {
+	Targets []VantageTarget `json:"targets"`
+}
+
+// VantageReport carries the latencies a probe agent measured from its region (POST /vantage/report)
+type VantageReport struct {
+	Region    string          `json:"region"`
+	Latitude  float64         `json:"latitude"`
+	Longitude float64         `json:"longitude"`
+	Results   []VantageResult `json:"results"`
+}
+
+// VantageResult is one backend's latency as seen from a probe region
+type VantageResult struct {
+	ClientID  string  `json:"client_id"`
+	LatencyMs float64 `json:"latency_ms"`      // Connect time; the probe timeout when unreachable
+	Error     string  `json:"error,omitempty"` // Dial error when the backend was unreachable from the probe
 }
 
 // ResourceStats represents the current resource usage of a client machine
 type ResourceStats struct {
+	SchemaVersion string    `json:"schema_version,omitempty"` // Payload schema (see SchemaVersion; empty = LegacySchemaVersion)
 	ClientID      string    `json:"client_id"`
+	InstanceID    string    `json:"instance_id,omitempty"` // Agent process that sent the report (see ClientRegistration.InstanceID)
 	Hostname      string    `json:"hostname"`
 	Timestamp     time.Time `json:"timestamp"`
 
 	// CPU metrics (per-core averages over time window)
 	CPUCores      int       `json:"cpu_cores"`
 	CPUUsageAvg   []float64 `json:"cpu_usage_avg"` // Per-core usage percentage (0-100)
+	CPUUsageP95   []float64 `json:"cpu_usage_p95,omitempty"` // Per-core 95th percentile usage over the window
+	CPUUsageShort []float64 `json:"cpu_usage_short,omitempty"` // Per-core usage averaged over the agent's short window (tiers with cpu_window: short)
+	CPUShortWindowSecs int  `json:"cpu_short_window_seconds,omitempty"` // Length of that short window
 
 	// Memory metrics (GB)
 	MemoryTotal   float64   `json:"memory_total_gb"`
 	MemoryUsed    float64   `json:"memory_used_gb"`
+	MemoryUsedP95 float64   `json:"memory_used_p95_gb,omitempty"`
 	MemoryAvail   float64   `json:"memory_avail_gb"`
+	Memory        *MemoryBreakdown `json:"memory,omitempty"` // Kernel accounting at report time (optional)
 
 	// Disk metrics (GB)
 	DiskTotal     float64   `json:"disk_total_gb"`
@@ -80,6 +266,38 @@ type ResourceStats struct {
 	// GPU metrics (optional, empty if no GPUs available)
 	GPUs          []GPUStats `json:"gpus,omitempty"`
 
+	// Load averages (run-queue length over 1/5/15 minutes)
+	LoadAvg1      float64   `json:"load_avg_1"`
+	LoadAvg5      float64   `json:"load_avg_5"`
+	LoadAvg15     float64   `json:"load_avg_15"`
+
+	// Swap metrics (GB)
+	SwapTotal     float64   `json:"swap_total_gb"`
+	SwapUsed      float64   `json:"swap_used_gb"`
+
+	// Pressure stall information (optional, Linux 4.20+ only)
+	PSI           *PressureStats `json:"psi,omitempty"`
+
+	// CPU/chassis temperature, fans and power (optional, Linux only)
+	Thermal       *ThermalStats `json:"thermal,omitempty"`
+
+	// File descriptors, TCP sockets by state and ephemeral port usage (optional, Linux only)
+	Sockets       *SocketStats `json:"sockets,omitempty"`
+
+	// Per-device disk throughput, IOPS and queue depth since the previous report (optional, Linux only)
+	DiskIO        []DiskIOStats `json:"disk_io,omitempty"`
+
+	// Containers or VMs running on the host (optional, agent inventory)
+	Inventory     *InventoryStats `json:"inventory,omitempty"`
+
+	// Advertised endpoint reachability as seen by the load balancer (optional, latest probe-back)
+	Reachability  []EndpointReachability `json:"reachability,omitempty"`
+
+	// Delta encoding (optional): delta reports carry only fields that changed since report base_seq
+	Seq           uint64    `json:"seq,omitempty"`      // Report sequence number assigned by the agent
+	BaseSeq       uint64    `json:"base_seq,omitempty"` // Delta reports: seq of the report the changes apply to
+	Delta         bool      `json:"delta,omitempty"`    // Fields missing from the payload carry over from base_seq
+
 	// Network info
 	PublicIP      string    `json:"public_ip"`
 	Latitude      float64   `json:"latitude"`
@@ -88,18 +306,56 @@ type ResourceStats struct {
 	City          string    `json:"city"`
 }
 
+// StatsDeltaSupported is advertised in the /stats response ("stats_delta") by servers that accept delta reports
+const StatsDeltaSupported = "supported"
+
+// StatsResponse acknowledges (or refuses) a /stats report
+type StatsResponse struct {
+	Status        string            `json:"status"`                   // "received" or "rejected"
+	StatsDelta    string            `json:"stats_delta,omitempty"`    // StatsDeltaSupported when delta reports are accepted
+	SchemaVersion string            `json:"schema_version,omitempty"` // Negotiated payload schema
+	Error         string            `json:"error,omitempty"`          // Why a rejected report was refused
+	FieldErrors   []StatsFieldError `json:"field_errors,omitempty"`   // Invalid fields the server corrected or refused
+}
+
+// What the server did with an invalid stats field
+const (
+	StatsFieldClamped  = "clamped"  // Out of range; stored at the nearest valid value
+	StatsFieldDropped  = "dropped"  // Not a finite number; replaced with the previous report's value
+	StatsFieldRejected = "rejected" // Capacity the server cannot place against; the whole report was refused
+)
+
+// StatsFieldError describes one invalid field of a stats report
+type StatsFieldError struct {
+	Field  string `json:"field"`  // JSON path, e.g. cpu_usage_avg[3] or gpus[0].utilization_pct
+	Value  string `json:"value"`  // Reported value
+	Action string `json:"action"` // StatsFieldClamped, StatsFieldDropped or StatsFieldRejected
+	Reason string `json:"reason"`
+}
+
 // EndpointConfig defines a backend endpoint with path-based routing
 type EndpointConfig struct {
-	URL   string   `json:"url" yaml:"url"`
-	Paths []string `json:"paths" yaml:"paths"`
+	URL      string   `json:"url" yaml:"url"`
+	Paths    []string `json:"paths" yaml:"paths"`
+	Protocol string   `json:"protocol,omitempty" yaml:"protocol,omitempty"` // Upstream protocol the proxy uses (see EndpointProtocol*)
 }
 
+// Upstream protocols a backend endpoint can be proxied with
+const (
+	EndpointProtocolHTTP1 = "http1" // HTTP/1.1 (default)
+	EndpointProtocolH2C   = "h2c"   // Cleartext HTTP/2 with prior knowledge (http:// endpoints)
+	EndpointProtocolH2    = "h2"    // HTTP/2 over TLS (https:// endpoints)
+)
+
 // ClientRegistration is sent when a client first connects
 type ClientRegistration struct {
+	SchemaVersion string          `json:"schema_version,omitempty"` // Payload schema (see SchemaVersion; empty = LegacySchemaVersion)
 	ClientID     string           `json:"client_id"`
 	Hostname     string           `json:"hostname"`
 	PublicIP     string           `json:"public_ip"`
 	LocalIP      string           `json:"local_ip"`
+	LocalIPv6    string           `json:"local_ipv6,omitempty"`    // Global IPv6 address of a dual-stack host
+	EndpointPort int              `json:"endpoint_port,omitempty"` // Port for endpoints built from local_ip/local_ipv6 (0 = server default)
 	Latitude     float64          `json:"latitude"`
 	Longitude    float64          `json:"longitude"`
 	Country      string           `json:"country"`
@@ -109,8 +365,35 @@ type ClientRegistration struct {
 	TotalStorage float64          `json:"total_storage_gb"`
 	TotalGPUs    int              `json:"total_gpus,omitempty"`
 	GPUModels    []string         `json:"gpu_models,omitempty"`
+	GPUComputeCapabilities []float64 `json:"gpu_compute_capabilities,omitempty"` // CUDA compute capability per GPU, same order as gpu_models (e.g. 8.0)
 	EndpointURL  string           `json:"endpoint_url,omitempty"`
+	EndpointProtocol string       `json:"endpoint_protocol,omitempty"` // Upstream protocol for endpoint_url (see EndpointProtocol*)
 	Endpoints    []EndpointConfig `json:"endpoints,omitempty"`
+	HourlyCost   float64          `json:"hourly_cost,omitempty"` // Cost of running this backend per hour (any currency unit)
+	Tenant       string           `json:"tenant,omitempty"`      // Tenant the backend serves (empty = default tenant)
+	Pool         string           `json:"pool,omitempty"`        // Backend pool routing rules can target (optional)
+	InstanceID   string           `json:"instance_id,omitempty"` // Random per agent process; tells a restart apart from a second agent with the same client_id
+	ServiceVersion string         `json:"service_version,omitempty"` // Version of the software the backend serves (e.g. "2.4.1" or "green"), for blue/green routing
+	Labels       map[string]string `json:"labels,omitempty"`        // Free-form key/value tags set by the operator
+	ReportIntervalSecs int        `json:"report_interval_seconds,omitempty"` // How often the agent sends stats; it goes stale after missing stale_missed_reports of them (0 = server's stale_minutes)
+	Bandwidth    []BandwidthMeasurement `json:"bandwidth,omitempty"`   // Link tests run by the agent at registration (bandwidth_test)
+	ProbeStatsURL   string `json:"probe_stats_url,omitempty"`   // Where the server can fetch the agent's latest stats on startup (probe_stats_listen)
+	ProbeStatsToken string `json:"probe_stats_token,omitempty"` // Bearer token for probe_stats_url, random per agent process
+	ApprovalToken   string `json:"approval_token,omitempty"`    // Checked against registration_approval auto_approve tokens, never stored
+}
+
+// BandwidthTargetServer names measurements of the agent's link to the load balancer itself
+const BandwidthTargetServer = "server"
+
+// BandwidthMeasurement is the throughput and round-trip time from an agent to the load balancer
+// or a reference endpoint, measured when the agent registers
+type BandwidthMeasurement struct {
+	Target       string    `json:"target"`                  // BandwidthTargetServer or the reference URL
+	RTTMs        float64   `json:"rtt_ms,omitempty"`        // Fastest of a few small requests
+	DownloadMbps float64   `json:"download_mbps,omitempty"` // Towards the agent
+	UploadMbps   float64   `json:"upload_mbps,omitempty"`   // Away from the agent; only measured against the server
+	MeasuredAt   time.Time `json:"measured_at"`
+	Error        string    `json:"error,omitempty"` // Why the test failed (the other fields are then unset)
 }
 
 // RoutingRequest is sent from Caddy to determine which backend to use
@@ -119,20 +402,72 @@ type RoutingRequest struct {
 	ClientIP     string  `json:"client_ip"`
 	ClientLat    float64 `json:"client_lat,omitempty"`
 	ClientLon    float64 `json:"client_lon,omitempty"`
+	Path         string  `json:"path,omitempty"` // Original request path, matched by routing rules' path_prefix (optional)
+	ServiceVersion       string `json:"service_version,omitempty"`        // Only place on backends running this version (optional)
+	PreferServiceVersion string `json:"prefer_service_version,omitempty"` // Prefer backends running this version, falling back to others (optional)
 }
 
 // RoutingResponse returns the selected backend endpoint
 type RoutingResponse struct {
-	ClientID     string  `json:"client_id"`
-	Endpoint     string  `json:"endpoint"`
-	Hostname     string  `json:"hostname"`
-	Distance     float64 `json:"distance_km,omitempty"`
+	ClientID        string  `json:"client_id"`
+	Endpoint        string  `json:"endpoint"`
+	Hostname        string  `json:"hostname"`
+	Distance        float64 `json:"distance_km,omitempty"`
+	TierVersion     string  `json:"tier_version,omitempty"`     // Version of the tier set used for placement
+	SuggestedCPUSet string  `json:"suggested_cpuset,omitempty"` // Least-loaded cores assumed for the tier's vCPUs (cpuset list, e.g. "0-1,4")
+	SuggestedGPUs   string  `json:"suggested_gpus,omitempty"`   // GPU devices the session was placed on (CUDA_VISIBLE_DEVICES list, e.g. "0,2")
+	LeaseID         string  `json:"lease_id,omitempty"`         // Resource reservation for a new session; renew via POST /allocations/{id}/renew
+	LeaseTTLSecs    int     `json:"lease_ttl_secs,omitempty"`   // Seconds until the lease expires unless renewed
+	ServiceVersion  string  `json:"service_version,omitempty"`  // Software version the selected backend reported
+}
+
+// StatsBatch carries reports an agent spooled while the server was unreachable (POST /stats/batch)
+type StatsBatch struct {
+	Reports []ResourceStats `json:"reports"`
+}
+
+// Agent error event severities (ClientError.Severity)
+const (
+	ErrorSeverityWarning  = "warning"
+	ErrorSeverityError    = "error"
+	ErrorSeverityCritical = "critical"
+)
+
+// ClientError is a structured error event observed by an agent
+// Identical events are coalesced by the agent: Timestamp is the first occurrence, Count how often it happened
+type ClientError struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Source    string            `json:"source"`             // Failing subsystem (e.g. gpu_collector, disk, probe)
+	Severity  string            `json:"severity,omitempty"` // warning, error or critical (default: error)
+	Message   string            `json:"message"`
+	Count     int               `json:"count,omitempty"`   // Occurrences since the last report (default: 1)
+	Details   map[string]string `json:"details,omitempty"` // Extra context (device index, path, endpoint...)
+}
+
+// ClientErrorReport carries an agent's error events (POST /errors)
+type ClientErrorReport struct {
+	ClientID string        `json:"client_id"`
+	Errors   []ClientError `json:"errors"`
 }
 
 // HealthCheck request/response
 type HealthCheckResponse struct {
-	Status        string    `json:"status"`
-	Timestamp     time.Time `json:"timestamp"`
-	TotalClients  int       `json:"total_clients"`
-	ActiveClients int       `json:"active_clients"`
+	Status        string       `json:"status"`
+	Timestamp     time.Time    `json:"timestamp"`
+	TotalClients  int          `json:"total_clients"`
+	ActiveClients int          `json:"active_clients"`
+	DegradedTiers []TierHealth `json:"degraded_tiers,omitempty"` // Tiers below min_healthy_backends (status is "degraded")
+	Maintenance   bool         `json:"maintenance,omitempty"`    // New routing requests are rejected (status is "maintenance")
+
+	// In-flight placements against the max_pending_total / max_pending_per_backend admission caps
+	PendingAllocations     int `json:"pending_allocations"`
+	MaxPendingTotal        int `json:"max_pending_total,omitempty"`
+	BackendsAtPendingLimit int `json:"backends_at_pending_limit,omitempty"`
+}
+
+// TierHealth is a tier's count of live, healthy backends that can take it against its configured minimum
+type TierHealth struct {
+	Tier               string `json:"tier"`
+	HealthyBackends    int    `json:"healthy_backends"`
+	MinHealthyBackends int    `json:"min_healthy_backends"`
 }
@@ -0,0 +1,157 @@
+package common
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Agent self-update channels
+const (
+	UpdateChannelStable = "stable"
+	UpdateChannelBeta   = "beta"
+)
+
+// UpdateSignatureSuffix is appended to the manifest URL to fetch its detached signature
+const UpdateSignatureSuffix = ".sig"
+
+// UpdateManifest lists the current agent release per channel
+// It is published next to a detached Ed25519 signature ({manifest_url}.sig, base64) made with opsenctl sign-manifest
+type UpdateManifest struct {
+	Channels map[string]UpdateRelease `json:"channels"`
+}
+
+// UpdateRelease is one agent version with a binary per platform
+type UpdateRelease struct {
+	Version  string                  `json:"version"`
+	Binaries map[string]UpdateBinary `json:"binaries"` // Keyed by GOOS/GOARCH, e.g. "linux/amd64"
+}
+
+// UpdateBinary is a downloadable agent binary
+type UpdateBinary struct {
+	URL    string `json:"url"`    // Absolute, or relative to the manifest URL
+	SHA256 string `json:"sha256"` // Hex-encoded checksum of the binary
+}
+
+// ParseUpdatePublicKey decodes a base64 Ed25519 public key
+func ParseUpdatePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid update public key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid update public key: expected %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// SignUpdateManifest returns the base64 detached signature of a manifest
+func SignUpdateManifest(key ed25519.PrivateKey, manifest []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifest))
+}
+
+// VerifyUpdateManifest checks a base64 detached signature against the raw manifest bytes
+func VerifyUpdateManifest(key ed25519.PublicKey, manifest []byte, signature string) bool {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(key, manifest, sig)
+}
+
+// releaseVersion is a parsed semantic version ("1.4.2", "v1.5.0-beta.2"); build metadata is ignored
+type releaseVersion struct {
+	core       [3]int
+	prerelease []string
+}
+
+func parseReleaseVersion(version string) (releaseVersion, error) {
+	var v releaseVersion
+	text, _, _ := strings.Cut(strings.TrimPrefix(version, "v"), "+")
+	text, prerelease, hasPrerelease := strings.Cut(text, "-")
+	parts := strings.Split(text, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("invalid release version %q (expected MAJOR.MINOR.PATCH, e.g. 1.4.2)", version)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid release version %q (expected MAJOR.MINOR.PATCH, e.g. 1.4.2)", version)
+		}
+		v.core[i] = n
+	}
+	if hasPrerelease {
+		v.prerelease = strings.Split(prerelease, ".")
+		for _, id := range v.prerelease {
+			if id == "" {
+				return v, fmt.Errorf("invalid release version %q: empty pre-release identifier", version)
+			}
+		}
+	}
+	return v, nil
+}
+
+// ValidateReleaseVersion checks a manifest version is a semantic version
+func ValidateReleaseVersion(version string) error {
+	_, err := parseReleaseVersion(version)
+	return err
+}
+
+// CompareReleaseVersions orders two semantic versions by semver precedence: -1 if a < b, 0 if equal, 1 if a > b
+// A pre-release sorts before its release (1.5.0-beta.2 < 1.5.0)
+func CompareReleaseVersions(a, b string) (int, error) {
+	va, err := parseReleaseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := parseReleaseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range va.core {
+		if va.core[i] != vb.core[i] {
+			return compareInts(va.core[i], vb.core[i]), nil
+		}
+	}
+	switch {
+	case len(va.prerelease) == 0 && len(vb.prerelease) == 0:
+		return 0, nil
+	case len(va.prerelease) == 0:
+		return 1, nil
+	case len(vb.prerelease) == 0:
+		return -1, nil
+	}
+	for i := 0; i < len(va.prerelease) && i < len(vb.prerelease); i++ {
+		if c := comparePrereleaseIDs(va.prerelease[i], vb.prerelease[i]); c != 0 {
+			return c, nil
+		}
+	}
+	return compareInts(len(va.prerelease), len(vb.prerelease)), nil
+}
+
+// comparePrereleaseIDs compares numeric identifiers numerically; they sort before alphanumeric ones
+func comparePrereleaseIDs(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return compareInts(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,32 @@
+package common
+
+import "testing"
+
+// TestCompareReleaseVersions verifies semver precedence, including pre-releases and a "v" prefix
+func TestCompareReleaseVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.4.2", "1.4.2", 0},
+		{"v1.4.2", "1.4.2+build.7", 0},
+		{"1.10.0", "1.9.9", 1},
+		{"1.4.2", "2.0.0", -1},
+		{"1.5.0-beta.2", "1.5.0", -1},
+		{"1.5.0-beta.10", "1.5.0-beta.2", 1},
+		{"1.5.0-beta", "1.5.0-beta.1", -1},
+		{"1.5.0-1", "1.5.0-alpha", -1},
+	}
+	for _, tt := range tests {
+		got, err := CompareReleaseVersions(tt.a, tt.b)
+		if err != nil || got != tt.want {
+			t.Errorf("CompareReleaseVersions(%q, %q) = %d, %v; expected %d", tt.a, tt.b, got, err, tt.want)
+		}
+	}
+
+	for _, version := range []string{"dev", "1.4", "1.4.x", "1.4.2-", "1.4.2-beta..1"} {
+		if err := ValidateReleaseVersion(version); err == nil {
+			t.Errorf("ValidateReleaseVersion(%q): expected an error", version)
+		}
+	}
+}
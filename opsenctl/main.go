@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Version is set at build time via -ldflags
+var Version = "dev"
+
+// command is an opsenctl subcommand; run returns the process exit code
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands = []command{
+	{"verify-db", "Verify row signatures in a server database (requires db_signing_key)", runVerifyDB},
+	{"sign-manifest", "Sign an agent release manifest for auto-update (or generate a signing key)", runSignManifest},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "opsenctl %s - Opsen administration tool\n\nUsage:\n  opsenctl <command> [flags]\n\nCommands:\n", Version)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'opsenctl <command> -h' for command flags.\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "-h" || name == "--help" || name == "help" {
+		usage()
+		return
+	}
+	if name == "version" || name == "--version" {
+		fmt.Println(Version)
+		return
+	}
+
+	for _, c := range commands {
+		if c.name == name {
+			os.Exit(c.run(os.Args[2:]))
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", name)
+	usage()
+	os.Exit(2)
+}
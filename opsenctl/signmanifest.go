@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"cyqle.in/opsen/common"
+)
+
+func runSignManifest(args []string) int {
+	fs := flag.NewFlagSet("sign-manifest", flag.ContinueOnError)
+	keyFile := fs.String("key", "", "Ed25519 private key file (base64) used to sign")
+	generate := fs.String("generate-key", "", "Write a new private key to this file and print its public key")
+	raw := fs.Bool("raw", false, "Sign any file without manifest validation (e.g. a GeoIP database for geoip.auto_update)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: opsenctl sign-manifest -key <file> [-raw] <manifest.json>\n       opsenctl sign-manifest -generate-key <file>\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *generate != "" {
+		publicKey, err := generateUpdateKey(*generate)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to generate key: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Wrote private key to %s\nPublic key (auto_update.public_key): %s\n", *generate, publicKey)
+		return 0
+	}
+
+	if *keyFile == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	key, err := readUpdateKey(*keyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read key: %v\n", err)
+		return 2
+	}
+
+	manifestPath := fs.Arg(0)
+	manifest, err := os.ReadFile(manifestPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read manifest: %v\n", err)
+		return 2
+	}
+	if !*raw {
+		if err := validateManifest(manifest); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid manifest: %v\n", err)
+			return 1
+		}
+	}
+
+	sigPath := manifestPath + common.UpdateSignatureSuffix
+	if err := os.WriteFile(sigPath, []byte(common.SignUpdateManifest(key, manifest)+"\n"), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write signature: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Signed %s -> %s\n", manifestPath, sigPath)
+	return 0
+}
+
+// generateUpdateKey writes a new base64 Ed25519 private key and returns the base64 public key
+func generateUpdateKey(path string) (string, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := fmt.Fprintln(file, base64.StdEncoding.EncodeToString(privateKey)); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(publicKey), nil
+}
+
+// readUpdateKey reads a base64 Ed25519 private key (64-byte key or 32-byte seed)
+func readUpdateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("key is not base64: %w", err)
+	}
+	switch len(raw) {
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	default:
+		return nil, fmt.Errorf("expected a %d-byte key or %d-byte seed, got %d bytes", ed25519.PrivateKeySize, ed25519.SeedSize, len(raw))
+	}
+}
+
+// validateManifest catches mistakes that would make every agent reject the release
+func validateManifest(data []byte) error {
+	var manifest common.UpdateManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return err
+	}
+	if len(manifest.Channels) == 0 {
+		return fmt.Errorf("no channels")
+	}
+	for name, release := range manifest.Channels {
+		if release.Version == "" {
+			return fmt.Errorf("channel %s: version is required", name)
+		}
+		// Agents only install versions newer than their own
+		if err := common.ValidateReleaseVersion(release.Version); err != nil {
+			return fmt.Errorf("channel %s: %w", name, err)
+		}
+		if len(release.Binaries) == 0 {
+			return fmt.Errorf("channel %s: no binaries", name)
+		}
+		for platform, binary := range release.Binaries {
+			if binary.URL == "" {
+				return fmt.Errorf("channel %s, %s: url is required", name, platform)
+			}
+			if sum, err := hex.DecodeString(binary.SHA256); err != nil || len(sum) != 32 {
+				return fmt.Errorf("channel %s, %s: sha256 must be a hex SHA-256 checksum", name, platform)
+			}
+		}
+	}
+	return nil
+}
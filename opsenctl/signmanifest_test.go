@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestSignManifest verifies a generated key signs manifests that verify with the printed public key
+func TestSignManifest(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "update.key")
+	publicKey, err := generateUpdateKey(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	if _, err := generateUpdateKey(keyPath); err == nil {
+		t.Error("Expected existing key file not to be overwritten")
+	}
+
+	manifestPath := filepath.Join(dir, "manifest.json")
+	manifest := []byte(`{"channels":{"stable":{"version":"1.2.0","binaries":{"linux/amd64":{"url":"opsen-client-linux-amd64","sha256":"` +
+		strings.Repeat("ab", 32) + `"}}}}}`)
+	os.WriteFile(manifestPath, manifest, 0644)
+
+	if code := runSignManifest([]string{"-key", keyPath, manifestPath}); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+
+	signature, err := os.ReadFile(manifestPath + common.UpdateSignatureSuffix)
+	if err != nil {
+		t.Fatalf("Expected signature file: %v", err)
+	}
+	key, _ := common.ParseUpdatePublicKey(publicKey)
+	if !common.VerifyUpdateManifest(key, manifest, string(signature)) {
+		t.Error("Expected signature to verify with the generated public key")
+	}
+
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	if common.VerifyUpdateManifest(otherKey.Public().(ed25519.PublicKey), manifest, string(signature)) {
+		t.Error("Expected signature not to verify with another key")
+	}
+	if _, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature))); err != nil {
+		t.Errorf("Expected base64 signature, got %q", signature)
+	}
+}
+
+// TestSignManifest_Invalid verifies manifests agents would reject are not signed
+func TestSignManifest_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "update.key")
+	generateUpdateKey(keyPath)
+
+	manifestPath := filepath.Join(dir, "manifest.json")
+	os.WriteFile(manifestPath, []byte(`{"channels":{"stable":{"version":"1.2.0","binaries":{"linux/amd64":{"url":"x","sha256":"nope"}}}}}`), 0644)
+
+	if code := runSignManifest([]string{"-key", keyPath, manifestPath}); code == 0 {
+		t.Error("Expected invalid checksum to be rejected")
+	}
+	if _, err := os.Stat(manifestPath + common.UpdateSignatureSuffix); err == nil {
+		t.Error("Expected no signature for an invalid manifest")
+	}
+}
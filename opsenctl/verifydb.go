@@ -0,0 +1,194 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"cyqle.in/opsen/common"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// maxReportedRows caps how many invalid rows are listed per table
+const maxReportedRows = 20
+
+// signedTable describes a table whose rows carry a row_hmac signature
+type signedTable struct {
+	name    string
+	columns []string // Signed columns, in signing order
+	keys    []string // Columns identifying a row in the report
+}
+
+var signedTables = []signedTable{
+	{"stats", common.SignedStatsColumns, []string{"id"}},
+	{"sticky_assignments", common.SignedStickyColumns, []string{"sticky_id", "tier"}},
+}
+
+// tableReport summarizes verification results for one table
+type tableReport struct {
+	Table    string
+	Checked  int
+	Valid    int
+	Unsigned int
+	Invalid  int
+	Bad      []string // Identifiers of the first invalid rows
+}
+
+func runVerifyDB(args []string) int {
+	fs := flag.NewFlagSet("verify-db", flag.ContinueOnError)
+	configFile := fs.String("config", "", "Path to server YAML configuration (reads database and db_signing_key)")
+	dbPath := fs.String("db", "", "SQLite database path (overrides config)")
+	key := fs.String("key", "", "Signing key (overrides config; defaults to $OPSEN_DB_SIGNING_KEY)")
+	allowUnsigned := fs.Bool("allow-unsigned", false, "Accept unsigned rows, e.g. ones written before db_signing_key was set")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var path, signingKey string
+	if *configFile != "" {
+		config, err := common.LoadServerConfig(*configFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+			return 2
+		}
+		path, signingKey = config.Database, config.DBSigningKey
+	}
+	if *dbPath != "" {
+		path = *dbPath
+	}
+	if *key != "" {
+		signingKey = *key
+	} else if signingKey == "" {
+		signingKey = os.Getenv("OPSEN_DB_SIGNING_KEY")
+	}
+	if path == "" || signingKey == "" {
+		fmt.Fprintln(os.Stderr, "A database path and signing key are required (use -config, or -db and -key)")
+		return 2
+	}
+	if _, err := os.Stat(path); err != nil {
+		fmt.Fprintf(os.Stderr, "Database not found: %v\n", err)
+		return 2
+	}
+
+	db, err := sql.Open("sqlite3", path+"?mode=ro")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 2
+	}
+	defer db.Close()
+
+	reports, err := verifyDB(db, signingKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Verification failed: %v\n", err)
+		return 2
+	}
+
+	failed := printReports(os.Stdout, reports, *allowUnsigned)
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// verifyDB checks the row signature of every row in the signed tables
+func verifyDB(db *sql.DB, key string) ([]tableReport, error) {
+	var reports []tableReport
+	for _, table := range signedTables {
+		report, err := verifyTable(db, key, table)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", table.name, err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func verifyTable(db *sql.DB, key string, table signedTable) (tableReport, error) {
+	report := tableReport{Table: table.name}
+
+	columns := append(append(append([]string{}, table.keys...), table.columns...), "row_hmac")
+	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), table.name))
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return report, err
+		}
+		report.Checked++
+
+		signature, _ := values[len(values)-1].(string)
+		if b, ok := values[len(values)-1].([]byte); ok {
+			signature = string(b)
+		}
+		if signature == "" {
+			report.Unsigned++
+			continue
+		}
+
+		signed := values[len(table.keys) : len(values)-1]
+		if common.VerifyRow(key, table.name, signature, signed...) {
+			report.Valid++
+			continue
+		}
+
+		report.Invalid++
+		if len(report.Bad) < maxReportedRows {
+			ids := make([]string, len(table.keys))
+			for i := range table.keys {
+				ids[i] = fmt.Sprintf("%s=%v", table.keys[i], printable(values[i]))
+			}
+			report.Bad = append(report.Bad, strings.Join(ids, " "))
+		}
+	}
+	return report, rows.Err()
+}
+
+func printable(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+// printReports writes the verification summary and reports whether verification failed
+// Unsigned rows fail unless allowUnsigned is set: once signing is enabled the server signs every row it writes,
+// so only rows from before then may lack a signature
+func printReports(w io.Writer, reports []tableReport, allowUnsigned bool) bool {
+	invalid, unsigned := false, false
+	for _, r := range reports {
+		fmt.Fprintf(w, "%-20s checked=%d valid=%d unsigned=%d invalid=%d\n",
+			r.Table, r.Checked, r.Valid, r.Unsigned, r.Invalid)
+		for _, bad := range r.Bad {
+			fmt.Fprintf(w, "  invalid signature: %s\n", bad)
+		}
+		if r.Invalid > len(r.Bad) {
+			fmt.Fprintf(w, "  ... and %d more\n", r.Invalid-len(r.Bad))
+		}
+		invalid = invalid || r.Invalid > 0
+		unsigned = unsigned || (r.Unsigned > 0 && !allowUnsigned)
+	}
+
+	failed := invalid || unsigned
+	if invalid {
+		fmt.Fprintln(w, "FAILED: rows with invalid signatures were modified outside the server or signed with a different key")
+	}
+	if unsigned {
+		fmt.Fprintln(w, "FAILED: unsigned rows were inserted outside the server or predate db_signing_key (accept the latter with -allow-unsigned)")
+	}
+	if !failed {
+		fmt.Fprintln(w, "OK")
+	}
+	return failed
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const testKey = "test-signing-key"
+
+// createSignedDB builds a database with the server's signed tables and one signed row in each
+func createSignedDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "opsen.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+	CREATE TABLE stats (
+		id INTEGER PRIMARY KEY AUTOINCREMENT, client_id TEXT, timestamp TIMESTAMP, cpu_cores INTEGER,
+		cpu_usage_json TEXT, memory_total REAL, memory_used REAL, memory_avail REAL,
+		disk_total REAL, disk_used REAL, disk_avail REAL, gpu_stats_json TEXT,
+		load_avg_1 REAL DEFAULT 0, load_avg_5 REAL DEFAULT 0, load_avg_15 REAL DEFAULT 0,
+		swap_total REAL DEFAULT 0, swap_used REAL DEFAULT 0, psi_json TEXT, row_hmac TEXT
+	);
+	CREATE TABLE sticky_assignments (
+		sticky_id TEXT NOT NULL, tier TEXT NOT NULL, client_id TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, last_used TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		row_hmac TEXT, PRIMARY KEY (sticky_id, tier)
+	);`)
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	// Same Go types the server passes on insert
+	values := []interface{}{"agent-1", time.Now(), 8, []byte("[12.5,40]"),
+		16.0, 4.25, 11.75, 100.0, 20.0, 80.0, []byte("null"),
+		0.5, 0.75, 1.0, 2.0, 0.0, []byte(nil)}
+	result, err := db.Exec(`INSERT INTO stats (client_id, timestamp, cpu_cores, cpu_usage_json, memory_total,
+		memory_used, memory_avail, disk_total, disk_used, disk_avail, gpu_stats_json, load_avg_1, load_avg_5,
+		load_avg_15, swap_total, swap_used, psi_json) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		values...)
+	if err != nil {
+		t.Fatalf("Failed to insert stats: %v", err)
+	}
+	// Like the server, sign once the row has an id
+	id, _ := result.LastInsertId()
+	signature := common.SignRow(testKey, "stats", append([]interface{}{id}, values...)...)
+	if _, err := db.Exec("UPDATE stats SET row_hmac = ? WHERE id = ?", signature, id); err != nil {
+		t.Fatalf("Failed to sign stats: %v", err)
+	}
+
+	if _, err := db.Exec("INSERT INTO sticky_assignments (sticky_id, tier, client_id, row_hmac) VALUES (?, ?, ?, ?)",
+		"session-1", "lite", "agent-1", common.SignRow(testKey, "sticky_assignments", "session-1", "lite", "agent-1")); err != nil {
+		t.Fatalf("Failed to insert sticky assignment: %v", err)
+	}
+	return db
+}
+
+// TestVerifyDB_ValidRows verifies rows signed on insert still verify after reading them back from SQLite
+func TestVerifyDB_ValidRows(t *testing.T) {
+	db := createSignedDB(t)
+
+	reports, err := verifyDB(db, testKey)
+	if err != nil {
+		t.Fatalf("verifyDB failed: %v", err)
+	}
+	for _, r := range reports {
+		if r.Checked != 1 || r.Valid != 1 {
+			t.Errorf("Expected 1 valid row in %s, got %+v", r.Table, r)
+		}
+	}
+	if printReports(&bytes.Buffer{}, reports, false) {
+		t.Error("Expected verification to pass")
+	}
+}
+
+// TestVerifyDB_DetectsTampering verifies edited or copied rows and a wrong key are reported, and unsigned rows fail
+// unless -allow-unsigned is set
+func TestVerifyDB_DetectsTampering(t *testing.T) {
+	db := createSignedDB(t)
+	db.Exec("UPDATE stats SET cpu_usage_json = '[1,1]'")
+	db.Exec("UPDATE sticky_assignments SET client_id = 'attacker'")
+
+	reports, err := verifyDB(db, testKey)
+	if err != nil {
+		t.Fatalf("verifyDB failed: %v", err)
+	}
+	var out bytes.Buffer
+	if !printReports(&out, reports, false) {
+		t.Error("Expected tampered rows to fail verification")
+	}
+	if !bytes.Contains(out.Bytes(), []byte("sticky_id=session-1 tier=lite")) {
+		t.Errorf("Expected tampered sticky row to be listed, got:\n%s", out.String())
+	}
+
+	// A copy of a signed row gets a new id, which its signature doesn't cover
+	db = createSignedDB(t)
+	db.Exec(`INSERT INTO stats (client_id, timestamp, cpu_cores, cpu_usage_json, memory_total, memory_used, memory_avail,
+		disk_total, disk_used, disk_avail, gpu_stats_json, load_avg_1, load_avg_5, load_avg_15, swap_total, swap_used,
+		psi_json, row_hmac) SELECT client_id, timestamp, cpu_cores, cpu_usage_json, memory_total, memory_used, memory_avail,
+		disk_total, disk_used, disk_avail, gpu_stats_json, load_avg_1, load_avg_5, load_avg_15, swap_total, swap_used,
+		psi_json, row_hmac FROM stats`)
+	if reports, _ := verifyDB(db, testKey); reports[0].Valid != 1 || reports[0].Invalid != 1 {
+		t.Errorf("Expected the copied stats row to be invalid, got %+v", reports[0])
+	}
+
+	db = createSignedDB(t)
+	if reports, _ := verifyDB(db, "other-key"); reports[0].Invalid != 1 || reports[1].Invalid != 1 {
+		t.Errorf("Expected all rows to be invalid with the wrong key, got %+v", reports)
+	}
+
+	db.Exec("UPDATE sticky_assignments SET row_hmac = NULL")
+	db.Exec("DELETE FROM stats")
+	reports, _ = verifyDB(db, testKey)
+	if reports[1].Unsigned != 1 {
+		t.Errorf("Expected 1 unsigned sticky row, got %+v", reports[1])
+	}
+	if !printReports(&bytes.Buffer{}, reports, false) {
+		t.Error("Expected unsigned rows to fail")
+	}
+	if printReports(&bytes.Buffer{}, reports, true) {
+		t.Error("Expected unsigned rows to pass with -allow-unsigned")
+	}
+}
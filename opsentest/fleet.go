@@ -0,0 +1,171 @@
+package opsentest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// BackendIDHeader is set by Fleet backends on every response, so tests can tell which backend served a request
+const BackendIDHeader = "X-Opsen-Test-Backend"
+
+// Backend is a fake backend registered by a Fleet
+type Backend struct {
+	*MockClient
+	Server   *httptest.Server // HTTP server behind Endpoint (nil when the options named an endpoint)
+	requests atomic.Int64
+}
+
+// Requests returns how many requests reached the backend's HTTP server
+func (b *Backend) Requests() int64 {
+	return b.requests.Load()
+}
+
+// Fleet registers fake backends with a running opsen server and reports their stats over HTTP,
+// exactly like opsen-client agents do
+type Fleet struct {
+	t         testing.TB
+	ServerURL string
+	APIKey    string // Sent as X-API-Key (empty = no auth)
+	Client    *http.Client
+
+	mu       sync.Mutex
+	backends map[string]*Backend
+}
+
+// NewFleet creates an empty fleet for the server at serverURL; backends are shut down when the test ends
+func NewFleet(t testing.TB, serverURL, apiKey string) *Fleet {
+	f := &Fleet{
+		t:         t,
+		ServerURL: serverURL,
+		APIKey:    apiKey,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+		backends:  make(map[string]*Backend),
+	}
+	t.Cleanup(f.Close)
+	return f
+}
+
+// Add starts a backend, registers it and reports its initial stats
+// Unless opts.Endpoint is set, the backend is a real HTTP server answering 200 with its client ID
+func (f *Fleet) Add(opts MockClientOptions) *Backend {
+	f.t.Helper()
+
+	backend := &Backend{}
+	if opts.Endpoint == "" {
+		backend.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			backend.requests.Add(1)
+			w.Header().Set(BackendIDHeader, backend.Registration.ClientID)
+			io.WriteString(w, backend.Registration.ClientID)
+		}))
+		opts.Endpoint = backend.Server.URL
+	}
+	backend.MockClient = NewMockClient(opts)
+	backend.Registration.EndpointURL = backend.Endpoint
+
+	f.mu.Lock()
+	f.backends[backend.Registration.ClientID] = backend
+	f.mu.Unlock()
+
+	if status, body := f.post("/register", backend.Registration); status != http.StatusOK {
+		f.t.Fatalf("Failed to register %s: %d %s", backend.Registration.ClientID, status, body)
+	}
+	f.Report(backend.Registration.ClientID, nil)
+	return backend
+}
+
+// Backend returns a fleet backend by client ID (nil if unknown)
+func (f *Fleet) Backend(clientID string) *Backend {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.backends[clientID]
+}
+
+// Report sends a backend's stats to the server, after applying update (may be nil)
+func (f *Fleet) Report(clientID string, update func(*common.ResourceStats)) {
+	f.t.Helper()
+
+	backend := f.Backend(clientID)
+	if backend == nil {
+		f.t.Fatalf("Unknown fleet backend: %s", clientID)
+		return
+	}
+
+	f.mu.Lock()
+	if update != nil {
+		update(&backend.Stats)
+	}
+	backend.Stats.Timestamp = time.Now()
+	stats := backend.Stats
+	f.mu.Unlock()
+
+	if status, body := f.post("/stats", stats); status != http.StatusOK {
+		f.t.Fatalf("Failed to report stats for %s: %d %s", clientID, status, body)
+	}
+}
+
+// Route asks the server for a placement; headers carry sticky IDs, tenants, etc.
+// Returns the decoded response (zero on failure) and the HTTP status
+func (f *Fleet) Route(req common.RoutingRequest, headers map[string]string) (common.RoutingResponse, int) {
+	f.t.Helper()
+
+	var resp common.RoutingResponse
+	status, body := f.postWithHeaders("/route", req, headers)
+	if status == http.StatusOK {
+		if err := json.Unmarshal(body, &resp); err != nil {
+			f.t.Fatalf("Failed to decode routing response: %v", err)
+		}
+	}
+	return resp, status
+}
+
+// Close shuts down every backend's HTTP server
+func (f *Fleet) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, backend := range f.backends {
+		if backend.Server != nil {
+			backend.Server.Close()
+		}
+	}
+}
+
+func (f *Fleet) post(path string, payload interface{}) (int, []byte) {
+	return f.postWithHeaders(path, payload, nil)
+}
+
+func (f *Fleet) postWithHeaders(path string, payload interface{}, headers map[string]string) (int, []byte) {
+	f.t.Helper()
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		f.t.Fatalf("Failed to encode %s request: %v", path, err)
+	}
+	req, err := http.NewRequest(http.MethodPost, f.ServerURL+path, bytes.NewReader(data))
+	if err != nil {
+		f.t.Fatalf("Failed to build %s request: %v", path, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if f.APIKey != "" {
+		req.Header.Set("X-API-Key", f.APIKey)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		f.t.Fatalf("%s request failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, body
+}
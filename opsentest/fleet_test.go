@@ -0,0 +1,80 @@
+package opsentest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestNewMockClient verifies resource defaults are filled in
+func TestNewMockClient(t *testing.T) {
+	mock := NewMockClient(MockClientOptions{ClientID: "backend-1", TotalCPU: 4})
+	if len(mock.Stats.CPUUsageAvg) != 4 || mock.Stats.CPUUsageAvg[0] != 20 {
+		t.Errorf("Expected 4 cores at 20%%, got %v", mock.Stats.CPUUsageAvg)
+	}
+	if mock.Stats.MemoryAvail != 24 || mock.Stats.DiskAvail != 400 {
+		t.Errorf("Expected default memory/disk availability, got %.0f/%.0f", mock.Stats.MemoryAvail, mock.Stats.DiskAvail)
+	}
+	if mock.Registration.Hostname != "backend-1" {
+		t.Errorf("Expected hostname to default to the client ID, got %s", mock.Registration.Hostname)
+	}
+}
+
+// TestFleet verifies backends register with real endpoints and report stats with the API key
+func TestFleet(t *testing.T) {
+	var mu sync.Mutex
+	registered := map[string]common.ClientRegistration{}
+	reports := map[string]common.ResourceStats{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "test-key" {
+			http.Error(w, "Invalid API key", http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/register":
+			var reg common.ClientRegistration
+			json.NewDecoder(r.Body).Decode(&reg)
+			registered[reg.ClientID] = reg
+		case "/stats":
+			var stats common.ResourceStats
+			json.NewDecoder(r.Body).Decode(&stats)
+			reports[stats.ClientID] = stats
+		case "/route":
+			json.NewEncoder(w).Encode(common.RoutingResponse{ClientID: "backend-1", Endpoint: registered["backend-1"].EndpointURL})
+		}
+	}))
+	defer server.Close()
+
+	fleet := NewFleet(t, server.URL, "test-key")
+	backend := fleet.Add(MockClientOptions{ClientID: "backend-1"})
+	fleet.Report("backend-1", func(stats *common.ResourceStats) { stats.MemoryUsed = 30 })
+
+	if registered["backend-1"].EndpointURL != backend.Server.URL {
+		t.Errorf("Expected backend to register its own endpoint, got %+v", registered["backend-1"])
+	}
+	if reports["backend-1"].MemoryUsed != 30 {
+		t.Errorf("Expected updated stats to be reported, got %+v", reports["backend-1"])
+	}
+
+	resp, status := fleet.Route(common.RoutingRequest{Tier: "lite"}, nil)
+	if status != http.StatusOK || resp.ClientID != "backend-1" {
+		t.Fatalf("Expected routing response, got %d %+v", status, resp)
+	}
+
+	res, err := http.Get(resp.Endpoint)
+	if err != nil {
+		t.Fatalf("Backend request failed: %v", err)
+	}
+	res.Body.Close()
+	if res.Header.Get(BackendIDHeader) != "backend-1" || backend.Requests() != 1 {
+		t.Errorf("Expected backend to identify itself and count the request, got %q / %d",
+			res.Header.Get(BackendIDHeader), backend.Requests())
+	}
+}
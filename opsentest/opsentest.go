@@ -0,0 +1,153 @@
+// Package opsentest provides fixtures for testing code that routes through opsen:
+// mock backends with sensible resource defaults, the server configuration used by
+// opsen's own tests, and a Fleet of fake agents that register with a running server.
+package opsentest
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// DefaultTiers returns the tier set used by opsen's own tests
+func DefaultTiers() []common.TierSpec {
+	return []common.TierSpec{
+		{Name: "free", VCPU: 1, MemoryGB: 1.0, StorageGB: 0},
+		{Name: "lite", VCPU: 1, MemoryGB: 1.0, StorageGB: 5},
+		{Name: "pro-standard", VCPU: 2, MemoryGB: 4.0, StorageGB: 20},
+		{Name: "pro-turbo", VCPU: 4, MemoryGB: 8.0, StorageGB: 30},
+		{Name: "pro-max", VCPU: 8, MemoryGB: 16.0, StorageGB: 40},
+	}
+}
+
+// NewServerConfig returns a server configuration suitable for tests
+// Sticky sessions use X-Session-ID and health checks are TCP; modify tweaks the result (may be nil)
+func NewServerConfig(modify func(*common.ServerConfig)) *common.ServerConfig {
+	config := &common.ServerConfig{
+		Port:                         8080,
+		StaleMinutes:                 5,
+		CleanupIntervalSecs:          60,
+		StickyHeader:                 "X-Session-ID",
+		StickyAffinityEnabled:        true,
+		PendingAllocationTimeoutSecs: 120,
+		TierFieldName:                "tier",
+		TierHeader:                   "X-Tier",
+
+		HealthCheckEnabled:            true,
+		HealthCheckIntervalSecs:       10,
+		HealthCheckTimeoutSecs:        2,
+		HealthCheckType:               "tcp",
+		HealthCheckPath:               "/health",
+		HealthCheckUnhealthyThreshold: 3,
+		HealthCheckHealthyThreshold:   2,
+
+		Tiers: DefaultTiers(),
+	}
+
+	if modify != nil {
+		modify(config)
+	}
+	return config
+}
+
+// MockClientOptions describes a fake backend; zero values get defaults
+type MockClientOptions struct {
+	ClientID     string
+	Hostname     string
+	Latitude     float64
+	Longitude    float64
+	TotalCPU     int       // Default: 8
+	TotalMemory  float64   // GB, default: 32
+	TotalStorage float64   // GB, default: 500
+	TotalGPUs    int       // Number of GPUs
+	GPUModels    []string  // GPU model names
+	CPUUsageAvg  []float64 // Per-core usage (0-100), default: 20% on every core
+	MemoryUsed   float64   // GB, default: 8 (with MemoryAvail = total - used)
+	MemoryAvail  float64
+	DiskUsed     float64 // GB, default: 100 (with DiskAvail = total - used)
+	DiskAvail    float64
+	GPUs         []common.GPUStats // GPU metrics
+	LastSeen     time.Time         // Default: now
+	Endpoint     string            // Default: http://localhost:11000 (Fleet starts a real backend instead)
+	Tenant       string            // Tenant the backend registers into (empty = default)
+}
+
+// MockClient is a fake backend's registration and latest stats
+type MockClient struct {
+	Registration common.ClientRegistration
+	Stats        common.ResourceStats
+	Endpoint     string
+	LastSeen     time.Time
+}
+
+// NewMockClient builds a fake backend from options, filling in defaults
+func NewMockClient(opts MockClientOptions) *MockClient {
+	if opts.ClientID == "" {
+		opts.ClientID = fmt.Sprintf("client-%d", rand.Intn(10000))
+	}
+	if opts.Hostname == "" {
+		opts.Hostname = opts.ClientID
+	}
+	if opts.TotalCPU == 0 {
+		opts.TotalCPU = 8
+	}
+	if opts.TotalMemory == 0 {
+		opts.TotalMemory = 32.0
+	}
+	if opts.TotalStorage == 0 {
+		opts.TotalStorage = 500.0
+	}
+	if opts.LastSeen.IsZero() {
+		opts.LastSeen = time.Now()
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = "http://localhost:11000"
+	}
+
+	if len(opts.CPUUsageAvg) == 0 {
+		opts.CPUUsageAvg = make([]float64, opts.TotalCPU)
+		for i := range opts.CPUUsageAvg {
+			opts.CPUUsageAvg[i] = 20.0
+		}
+	}
+	if opts.MemoryUsed == 0 && opts.MemoryAvail == 0 {
+		opts.MemoryUsed = 8.0
+		opts.MemoryAvail = opts.TotalMemory - opts.MemoryUsed
+	}
+	if opts.DiskUsed == 0 && opts.DiskAvail == 0 {
+		opts.DiskUsed = 100.0
+		opts.DiskAvail = opts.TotalStorage - opts.DiskUsed
+	}
+
+	return &MockClient{
+		Registration: common.ClientRegistration{
+			ClientID:     opts.ClientID,
+			Hostname:     opts.Hostname,
+			Latitude:     opts.Latitude,
+			Longitude:    opts.Longitude,
+			TotalCPU:     opts.TotalCPU,
+			TotalMemory:  opts.TotalMemory,
+			TotalStorage: opts.TotalStorage,
+			TotalGPUs:    opts.TotalGPUs,
+			GPUModels:    opts.GPUModels,
+			Tenant:       opts.Tenant,
+		},
+		Stats: common.ResourceStats{
+			ClientID:    opts.ClientID,
+			Hostname:    opts.Hostname,
+			CPUCores:    opts.TotalCPU,
+			CPUUsageAvg: opts.CPUUsageAvg,
+			MemoryTotal: opts.TotalMemory,
+			MemoryUsed:  opts.MemoryUsed,
+			MemoryAvail: opts.MemoryAvail,
+			DiskTotal:   opts.TotalStorage,
+			DiskUsed:    opts.DiskUsed,
+			DiskAvail:   opts.DiskAvail,
+			GPUs:        opts.GPUs,
+		},
+		Endpoint: opts.Endpoint,
+		LastSeen: opts.LastSeen,
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/syslog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// RequestIDHeader carries the request ID to backends and back to callers
+const RequestIDHeader = "X-Request-ID"
+
+// AccessLogEntry is one structured access log record
+type AccessLogEntry struct {
+	Timestamp   string  `json:"timestamp"`
+	RequestID   string  `json:"request_id"`
+	Method      string  `json:"method"`
+	Path        string  `json:"path"`
+	ClientIP    string  `json:"client_ip"`
+	Status      int     `json:"status"`
+	Bytes       int64   `json:"bytes"`
+	DurationMs  float64 `json:"duration_ms"`
+	Tier        string  `json:"tier,omitempty"`
+	TierVersion string  `json:"tier_version,omitempty"`
+	Backend     string  `json:"backend,omitempty"`
+	UserAgent   string  `json:"user_agent,omitempty"`
+}
+
+// accessLogAnnotations collects fields only known to the handler (tier, selected backend)
+type accessLogAnnotations struct {
+	mu          sync.Mutex
+	tier        string
+	tierVersion string
+	backend     string
+}
+
+type accessLogContextKey struct{}
+
+// annotateAccessLog records the routing decision for the current request's access log entry
+func annotateAccessLog(r *http.Request, tier, tierVersion, backend string) {
+	annotations, ok := r.Context().Value(accessLogContextKey{}).(*accessLogAnnotations)
+	if !ok {
+		return
+	}
+	annotations.mu.Lock()
+	annotations.tier = tier
+	annotations.tierVersion = tierVersion
+	annotations.backend = backend
+	annotations.mu.Unlock()
+}
+
+// accessLogSink writes serialized access log records to a destination
+type accessLogSink interface {
+	Write(record []byte) error
+	Close() error
+}
+
+// AccessLogger writes structured access logs to a configured sink
+type AccessLogger struct {
+	sink accessLogSink
+}
+
+var defaultAccessLogger *AccessLogger
+
+// InitAccessLog configures the access logger used by RequestLogger
+func InitAccessLog(config common.AccessLogConfig) error {
+	logger, err := NewAccessLogger(config)
+	if err != nil {
+		return err
+	}
+	defaultAccessLogger = logger
+	return nil
+}
+
+// CloseAccessLog flushes and closes the access log sink
+func CloseAccessLog() {
+	if defaultAccessLogger != nil && defaultAccessLogger.sink != nil {
+		if err := defaultAccessLogger.sink.Close(); err != nil {
+			log.Printf("Warning: Failed to close access log: %v", err)
+		}
+	}
+}
+
+// NewAccessLogger creates an access logger for the configured sink
+// A disabled config yields a logger that drops every record
+func NewAccessLogger(config common.AccessLogConfig) (*AccessLogger, error) {
+	if !config.Enabled {
+		return &AccessLogger{}, nil
+	}
+
+	switch config.Sink {
+	case "", "stdout":
+		return &AccessLogger{sink: &writerSink{writer: os.Stdout}}, nil
+	case "file":
+		if config.Path == "" {
+			return nil, fmt.Errorf("access_log.path is required for the file sink")
+		}
+		sink, err := newRotatingFileSink(config.Path, int64(config.MaxSizeMB)*1024*1024, config.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		return &AccessLogger{sink: sink}, nil
+	case "syslog":
+		writer, err := syslog.Dial(config.SyslogNetwork, config.SyslogAddress, syslog.LOG_INFO|syslog.LOG_LOCAL0, config.SyslogTag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		return &AccessLogger{sink: &syslogSink{writer: writer}}, nil
+	case "http":
+		if config.HTTPURL == "" {
+			return nil, fmt.Errorf("access_log.http_url is required for the http sink")
+		}
+		return &AccessLogger{sink: newHTTPSink(config.HTTPURL, config.HTTPBatchSize,
+			time.Duration(config.HTTPFlushIntervalMs)*time.Millisecond)}, nil
+	default:
+		return nil, fmt.Errorf("unknown access_log.sink: %s", config.Sink)
+	}
+}
+
+// Log serializes and writes one entry
+func (a *AccessLogger) Log(entry AccessLogEntry) {
+	if a == nil || a.sink == nil {
+		return
+	}
+
+	record, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Warning: Failed to marshal access log entry: %v", err)
+		return
+	}
+	if err := a.sink.Write(record); err != nil {
+		log.Printf("Warning: Failed to write access log entry: %v", err)
+	}
+}
+
+// newRequestID returns a random 64-bit hex request ID
+func newRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// requestIDFromHeader accepts a caller-supplied request ID if it is short and printable
+func requestIDFromHeader(value string) string {
+	if value == "" || len(value) > 128 {
+		return ""
+	}
+	for _, c := range value {
+		if c < 0x21 || c > 0x7e {
+			return ""
+		}
+	}
+	return value
+}
+
+// writerSink writes newline-terminated records to an io.Writer
+type writerSink struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+func (s *writerSink) Write(record []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.writer.Write(append(record, '\n'))
+	return err
+}
+
+func (s *writerSink) Close() error {
+	return nil
+}
+
+// rotatingFileSink appends records to a file and rotates it by size (path.1, path.2, ...)
+type rotatingFileSink struct {
+	mu         sync.Mutex
+	path       string
+	maxBytes   int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func newRotatingFileSink(path string, maxBytes int64, maxBackups int) (*rotatingFileSink, error) {
+	sink := &rotatingFileSink{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (s *rotatingFileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat access log: %w", err)
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+func (s *rotatingFileSink) Write(record []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	line := append(record, '\n')
+	if s.maxBytes > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// rotate shifts path.N-1 → path.N, path → path.1, and reopens path
+// Must be called with s.mu held
+func (s *rotatingFileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+
+	if s.maxBackups <= 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return s.open()
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxBackups))
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+	if err := os.Rename(s.path, s.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return s.open()
+}
+
+func (s *rotatingFileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// syslogSink writes each record as one syslog message
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+func (s *syslogSink) Write(record []byte) error {
+	return s.writer.Info(string(record))
+}
+
+func (s *syslogSink) Close() error {
+	return s.writer.Close()
+}
+
+// accessLogDropReportInterval is how often the http sink logs how many records it dropped
+const accessLogDropReportInterval = time.Minute
+
+// httpSink batches records and POSTs them as newline-delimited JSON
+// Records are dropped (not blocked on) when the buffer is full so a slow collector cannot stall requests.
+// Drops are counted and logged as one summary per accessLogDropReportInterval, not one warning per record
+type httpSink struct {
+	url           string
+	batchSize     int
+	flushInterval time.Duration
+	client        *http.Client
+	records       chan []byte
+	done          chan struct{}
+	cancel        context.CancelFunc
+	dropped       atomic.Int64 // Records dropped since the last summary
+}
+
+func newHTTPSink(url string, batchSize int, flushInterval time.Duration) *httpSink {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	if flushInterval <= 0 {
+		flushInterval = time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sink := &httpSink{
+		url:           url,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		records:       make(chan []byte, batchSize*10),
+		done:          make(chan struct{}),
+		cancel:        cancel,
+	}
+	go sink.run(ctx)
+	return sink
+}
+
+func (s *httpSink) Write(record []byte) error {
+	select {
+	case s.records <- record:
+		return nil
+	default:
+		s.dropped.Add(1)
+		return nil
+	}
+}
+
+// reportDrops logs how many records were dropped since the last report, if any
+func (s *httpSink) reportDrops() {
+	if n := s.dropped.Swap(0); n > 0 {
+		log.Printf("Warning: Access log buffer full, dropped %d records since the last report", n)
+	}
+}
+
+func (s *httpSink) run(ctx context.Context) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+	reportTicker := time.NewTicker(accessLogDropReportInterval)
+	defer reportTicker.Stop()
+
+	batch := make([][]byte, 0, s.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.post(batch); err != nil {
+			log.Printf("Warning: Failed to ship %d access log records: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Drain whatever is buffered before exiting
+			for {
+				select {
+				case record := <-s.records:
+					batch = append(batch, record)
+					if len(batch) >= s.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					s.reportDrops()
+					return
+				}
+			}
+		case record := <-s.records:
+			batch = append(batch, record)
+			if len(batch) >= s.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-reportTicker.C:
+			s.reportDrops()
+		}
+	}
+}
+
+func (s *httpSink) post(batch [][]byte) error {
+	var body bytes.Buffer
+	for _, record := range batch {
+		body.Write(record)
+		body.WriteByte('\n')
+	}
+
+	resp, err := s.client.Post(s.url, "application/x-ndjson", &body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
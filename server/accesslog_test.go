@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// useAccessLogBuffer routes access log records into a buffer for the duration of a test
+func useAccessLogBuffer(t *testing.T) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	previous := defaultAccessLogger
+	defaultAccessLogger = &AccessLogger{sink: &writerSink{writer: buf}}
+	t.Cleanup(func() { defaultAccessLogger = previous })
+	return buf
+}
+
+// TestRequestLogger_StructuredEntry verifies status, bytes, request ID, and handler annotations are logged
+func TestRequestLogger_StructuredEntry(t *testing.T) {
+	buf := useAccessLogBuffer(t)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		annotateAccessLog(r, "pro-max", "3f2a9c1d7b4e", "backend-7")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})
+
+	req := httptest.NewRequest("POST", "/route", nil)
+	req.RemoteAddr = "1.2.3.4:12345"
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+
+	RequestLogger(handler).ServeHTTP(rec, req)
+
+	var entry AccessLogEntry
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+		t.Fatalf("Failed to parse access log entry %q: %v", buf.String(), err)
+	}
+
+	if entry.RequestID != "abc-123" {
+		t.Errorf("Expected incoming request ID to be kept, got %s", entry.RequestID)
+	}
+	if rec.Header().Get(RequestIDHeader) != "abc-123" {
+		t.Errorf("Expected request ID echoed in response, got %s", rec.Header().Get(RequestIDHeader))
+	}
+	if entry.Status != http.StatusCreated || entry.Bytes != 5 {
+		t.Errorf("Expected status 201 and 5 bytes, got %d and %d", entry.Status, entry.Bytes)
+	}
+	if entry.Tier != "pro-max" || entry.Backend != "backend-7" {
+		t.Errorf("Expected tier pro-max on backend-7, got %s on %s", entry.Tier, entry.Backend)
+	}
+	if entry.TierVersion != "3f2a9c1d7b4e" {
+		t.Errorf("Expected tier version 3f2a9c1d7b4e, got %s", entry.TierVersion)
+	}
+	if entry.ClientIP != "1.2.3.4" || entry.Method != "POST" || entry.Path != "/route" {
+		t.Errorf("Unexpected request fields: %+v", entry)
+	}
+}
+
+// TestRequestLogger_GeneratesRequestID verifies invalid incoming IDs are replaced and forwarded to the handler
+func TestRequestLogger_GeneratesRequestID(t *testing.T) {
+	useAccessLogBuffer(t)
+
+	var seen string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(RequestIDHeader)
+	})
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	req.Header.Set(RequestIDHeader, "has spaces")
+	rec := httptest.NewRecorder()
+
+	RequestLogger(handler).ServeHTTP(rec, req)
+
+	if seen == "" || seen == "has spaces" {
+		t.Errorf("Expected a generated request ID, got %q", seen)
+	}
+	if rec.Header().Get(RequestIDHeader) != seen {
+		t.Errorf("Expected response request ID %q, got %q", seen, rec.Header().Get(RequestIDHeader))
+	}
+}
+
+// TestNewAccessLogger_Disabled verifies a disabled access log drops records
+func TestNewAccessLogger_Disabled(t *testing.T) {
+	logger, err := NewAccessLogger(common.AccessLogConfig{Enabled: false, Sink: "file"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if logger.sink != nil {
+		t.Error("Expected no sink for a disabled access log")
+	}
+	logger.Log(AccessLogEntry{RequestID: "dropped"})
+}
+
+// TestNewAccessLogger_InvalidConfig verifies sink misconfiguration is reported
+func TestNewAccessLogger_InvalidConfig(t *testing.T) {
+	configs := []common.AccessLogConfig{
+		{Enabled: true, Sink: "file"},
+		{Enabled: true, Sink: "http"},
+		{Enabled: true, Sink: "kafka"},
+	}
+	for _, config := range configs {
+		if _, err := NewAccessLogger(config); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+}
+
+// TestRotatingFileSink_Rotates verifies the file rotates by size and keeps at most max_backups files
+func TestRotatingFileSink_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	sink, err := newRotatingFileSink(path, 50, 2)
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+	defer sink.Close()
+
+	record := []byte(strings.Repeat("x", 30))
+	for i := 0; i < 5; i++ {
+		if err := sink.Write(record); err != nil {
+			t.Fatalf("Write %d failed: %v", i, err)
+		}
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("Expected %s to exist: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected only 2 backups, found %s.3", path)
+	}
+}
+
+// TestHTTPSink_BatchesRecords verifies records are shipped as newline-delimited JSON and flushed on close
+func TestHTTPSink_BatchesRecords(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		mu.Lock()
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	sink := newHTTPSink(collector.URL, 2, time.Hour)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := sink.Write([]byte(`{"request_id":"` + id + `"}`)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	sink.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lines) != 3 {
+		t.Errorf("Expected 3 records shipped, got %d: %v", len(lines), lines)
+	}
+}
+
+// TestHTTPSink_SummarizesDrops verifies a full buffer drops records silently and logs one summary with the count
+func TestHTTPSink_SummarizesDrops(t *testing.T) {
+	release := make(chan struct{})
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer collector.Close()
+
+	sink := newHTTPSink(collector.URL, 1, time.Hour)
+	defer sink.Close()
+	defer close(release) // Unblock the stalled post before Close waits for it
+	logger := &AccessLogger{sink: sink}
+
+	// The first record is taken by the stalled post; the rest fill the buffer of 10 and then overflow
+	output := captureOutput(func() {
+		for i := 0; i < 50; i++ {
+			logger.Log(AccessLogEntry{RequestID: "flood"})
+		}
+	})
+	if output != "" {
+		t.Errorf("Expected no per-record warnings, got:\n%s", output)
+	}
+	dropped := sink.dropped.Load()
+	if dropped < 39 {
+		t.Fatalf("Expected at least 39 dropped records, got %d", dropped)
+	}
+
+	output = captureOutput(sink.reportDrops)
+	if strings.Count(output, "\n") != 1 || !strings.Contains(output, fmt.Sprintf("dropped %d records", dropped)) {
+		t.Errorf("Expected one summary of %d drops, got:\n%s", dropped, output)
+	}
+	if output := captureOutput(sink.reportDrops); output != "" {
+		t.Errorf("Expected no summary without new drops, got:\n%s", output)
+	}
+}
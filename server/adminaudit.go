@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxAuditPayloadBytes = 64 * 1024 // Longer request bodies are stored truncated
+	maxAuditResultBytes  = 1024      // Error responses kept as the result of a failed call
+	defaultAuditLimit    = 100       // Entries returned by GET /admin/audit without ?limit
+	maxAuditLimit        = 1000
+)
+
+// AdminAuditEntry is one state-changing admin call recorded in admin_audit
+type AdminAuditEntry struct {
+	ID               int64      `json:"id"`
+	Actor            string     `json:"actor"`
+	Method           string     `json:"method"`
+	Path             string     `json:"path"`
+	Query            string     `json:"query,omitempty"`
+	IP               string     `json:"ip"`
+	Payload          string     `json:"payload,omitempty"`
+	PayloadTruncated bool       `json:"payload_truncated,omitempty"`
+	Status           int        `json:"status"` // 0 while the call is in progress, or if the server stopped during it
+	Result           string     `json:"result,omitempty"`
+	StartedAt        time.Time  `json:"started_at"`
+	FinishedAt       *time.Time `json:"finished_at,omitempty"`
+}
+
+// auditRedacted replaces secret values in recorded payloads
+const auditRedacted = "[redacted]"
+
+// auditStringField matches a JSON string member; the closing quote is optional so truncated payloads are covered
+var auditStringField = regexp.MustCompile(`"([A-Za-z0-9_-]+)"(\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+
+// auditSecretField reports whether a JSON member holds a credential (key, secret, token, password)
+func auditSecretField(name string) bool {
+	name = strings.ToLower(strings.ReplaceAll(name, "-", "_"))
+	for _, secret := range []string{"key", "secret", "token", "password"} {
+		if name == secret || strings.HasSuffix(name, "_"+secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactAuditPayload blanks credentials in a request body before it is stored, so keys sent to
+// /admin/keys/revoke and similar calls can't be read back from GET /admin/audit
+func redactAuditPayload(payload []byte) []byte {
+	return auditStringField.ReplaceAllFunc(payload, func(field []byte) []byte {
+		match := auditStringField.FindSubmatch(field)
+		if !auditSecretField(string(match[1])) {
+			return field
+		}
+		return []byte(`"` + string(match[1]) + `"` + string(match[2]) + `"` + auditRedacted + `"`)
+	})
+}
+
+// auditResponseWriter keeps the start of an error response as the call's result
+type auditResponseWriter struct {
+	*responseWriter
+	result bytes.Buffer
+}
+
+func (aw *auditResponseWriter) Write(b []byte) (int, error) {
+	if aw.statusCode >= http.StatusBadRequest && aw.result.Len() < maxAuditResultBytes {
+		aw.result.Write(b[:min(len(b), maxAuditResultBytes-aw.result.Len())])
+	}
+	return aw.responseWriter.Write(b)
+}
+
+// AuditTrail middleware records state-changing admin calls in admin_audit before they run
+// A call that cannot be recorded is refused, so every change has an entry naming who made it
+func (s *Server) AuditTrail(next http.Handler) http.Handler {
+	return s.auditTrail(next, false)
+}
+
+// AuditAccess is AuditTrail for endpoints whose reads are sensitive too, like pprof's profiles and
+// command line: every call is recorded, whatever its method
+func (s *Server) AuditAccess(next http.Handler) http.Handler {
+	return s.auditTrail(next, true)
+}
+
+func (s *Server) auditTrail(next http.Handler, reads bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !reads && (r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The handler still reads the whole body: the recorded prefix is put back in front of the rest
+		payload, err := io.ReadAll(io.LimitReader(r.Body, maxAuditPayloadBytes+1))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to read request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(payload), r.Body), r.Body}
+		truncated := len(payload) > maxAuditPayloadBytes
+		if truncated {
+			payload = payload[:maxAuditPayloadBytes]
+		}
+		payload = redactAuditPayload(payload)
+
+		res, err := s.db.Exec(`
+			INSERT INTO admin_audit (actor, method, path, query, ip, payload, payload_truncated, status, result, started_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, 0, '', ?)
+		`, requestActor(r), r.Method, r.URL.Path, r.URL.RawQuery, getClientIP(r), string(payload), truncated, time.Now().UTC())
+		if err != nil {
+			LogWarn(fmt.Sprintf("Failed to record admin call, refusing it: %v", err))
+			http.Error(w, "Audit trail unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		id, _ := res.LastInsertId()
+
+		aw := &auditResponseWriter{responseWriter: &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}}
+		next.ServeHTTP(aw, r)
+
+		if _, err := s.db.Exec("UPDATE admin_audit SET status = ?, result = ?, finished_at = ? WHERE id = ?",
+			aw.statusCode, strings.TrimSpace(aw.result.String()), time.Now().UTC(), id); err != nil {
+			LogWarn(fmt.Sprintf("Failed to record result of admin call %d: %v", id, err))
+		}
+	})
+}
+
+// handleAdminAudit lists recorded admin calls, newest first
+// Query parameters: limit (default 100), since and until (RFC 3339), actor, path (prefix), method, failed
+func (s *Server) handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := defaultAuditLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid limit: %s", v), http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxAuditLimit)
+	}
+
+	conditions := []string{"1 = 1"}
+	args := []interface{}{}
+	for _, bound := range []struct{ param, condition string }{
+		{"since", "started_at >= ?"},
+		{"until", "started_at < ?"},
+	} {
+		if v := query.Get(bound.param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid %s (expected RFC 3339): %s", bound.param, v), http.StatusBadRequest)
+				return
+			}
+			conditions = append(conditions, bound.condition)
+			args = append(args, t.UTC())
+		}
+	}
+	if v := query.Get("actor"); v != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, v)
+	}
+	if v := query.Get("method"); v != "" {
+		conditions = append(conditions, "method = ?")
+		args = append(args, strings.ToUpper(v))
+	}
+	if v := query.Get("path"); v != "" {
+		conditions = append(conditions, "substr(path, 1, ?) = ?")
+		args = append(args, len(v), v)
+	}
+	if v := query.Get("failed"); v != "" {
+		failed, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid failed: %s", v), http.StatusBadRequest)
+			return
+		}
+		if failed {
+			conditions = append(conditions, "status >= 400")
+		} else {
+			conditions = append(conditions, "status < 400")
+		}
+	}
+	args = append(args, limit)
+
+	rows, err := s.db.Query(`
+		SELECT id, actor, method, path, query, ip, payload, payload_truncated, status, result, started_at, finished_at
+		FROM admin_audit
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY id DESC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to query audit trail: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	entries := []AdminAuditEntry{}
+	for rows.Next() {
+		var entry AdminAuditEntry
+		var finishedAt sql.NullTime
+		if err := rows.Scan(&entry.ID, &entry.Actor, &entry.Method, &entry.Path, &entry.Query, &entry.IP, &entry.Payload,
+			&entry.PayloadTruncated, &entry.Status, &entry.Result, &entry.StartedAt, &finishedAt); err != nil {
+			log.Printf("Error scanning admin audit row: %v", err)
+			continue
+		}
+		if finishedAt.Valid {
+			entry.FinishedAt = &finishedAt.Time
+		}
+		entries = append(entries, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": entries,
+		"count":   len(entries),
+	}); err != nil {
+		log.Printf("Warning: Failed to encode admin audit response: %v", err)
+	}
+}
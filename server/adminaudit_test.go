@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// auditedRequest sends a request through AuditTrail as actor and returns what the handler read
+func auditedRequest(t *testing.T, server *Server, handler http.HandlerFunc, method, target, body, actor string) string {
+	t.Helper()
+	var read string
+	h := server.AuditTrail(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		read = string(b)
+		handler(w, r)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), withActor(httptest.NewRequest(method, target, strings.NewReader(body)), actor))
+	return read
+}
+
+func queryAudit(t *testing.T, server *Server, query string) []AdminAuditEntry {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	server.handleAdminAudit(rec, httptest.NewRequest(http.MethodGet, "/admin/audit?"+query, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from /admin/audit, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Entries []AdminAuditEntry `json:"entries"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp.Entries
+}
+
+// TestAuditTrail_RecordsAdminCalls verifies changes are recorded with actor, payload and result, and reads are not
+func TestAuditTrail_RecordsAdminCalls(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	fail := func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Unknown client: edge-9", http.StatusNotFound)
+	}
+
+	if read := auditedRequest(t, server, ok, http.MethodPost, "/clients/purge?dry_run=0", `{"older_than":"1h"}`, "key:ops"); read != `{"older_than":"1h"}` {
+		t.Errorf("Expected the handler to read the full body, got %q", read)
+	}
+	auditedRequest(t, server, fail, http.MethodDelete, "/clients/edge-9", "", "key:ci")
+	auditedRequest(t, server, ok, http.MethodGet, "/clients/edge-1", "", "key:ops")
+
+	entries := queryAudit(t, server, "")
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 recorded changes (reads are not recorded), got %d", len(entries))
+	}
+	failed, purge := entries[0], entries[1]
+	if purge.Actor != "key:ops" || purge.Method != http.MethodPost || purge.Path != "/clients/purge" || purge.Query != "dry_run=0" ||
+		purge.Payload != `{"older_than":"1h"}` || purge.Status != http.StatusOK || purge.FinishedAt == nil {
+		t.Errorf("Unexpected purge entry: %+v", purge)
+	}
+	if failed.Actor != "key:ci" || failed.Status != http.StatusNotFound || failed.Result != "Unknown client: edge-9" {
+		t.Errorf("Unexpected failed entry: %+v", failed)
+	}
+
+	if got := queryAudit(t, server, "actor=key:ops"); len(got) != 1 || got[0].ID != purge.ID {
+		t.Errorf("Expected the actor filter to find the purge, got %+v", got)
+	}
+	if got := queryAudit(t, server, "path=/clients/&failed=true"); len(got) != 1 || got[0].ID != failed.ID {
+		t.Errorf("Expected path and failed filters to find the failed delete, got %+v", got)
+	}
+	if got := queryAudit(t, server, "since=2999-01-01T00:00:00Z"); len(got) != 0 {
+		t.Errorf("Expected no entries in the future, got %d", len(got))
+	}
+}
+
+// TestAuditTrail_TruncatesLargePayloads verifies oversized bodies are stored truncated but reach the handler whole
+func TestAuditTrail_TruncatesLargePayloads(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	body := strings.Repeat("x", maxAuditPayloadBytes+100)
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	if read := auditedRequest(t, server, ok, http.MethodPost, "/sticky/import", body, "key:ops"); read != body {
+		t.Errorf("Expected the handler to read %d bytes, got %d", len(body), len(read))
+	}
+	entries := queryAudit(t, server, "")
+	if len(entries) != 1 || !entries[0].PayloadTruncated || len(entries[0].Payload) != maxAuditPayloadBytes {
+		t.Errorf("Expected a truncated payload, got %+v", entries)
+	}
+}
+
+// TestAuditTrail_RefusesUnrecordedCalls verifies a change is not made when it cannot be recorded
+func TestAuditTrail_RefusesUnrecordedCalls(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+	if _, err := db.Exec("DROP TABLE admin_audit"); err != nil {
+		t.Fatalf("Failed to drop admin_audit: %v", err)
+	}
+
+	called := false
+	h := server.AuditTrail(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/clients/purge", nil))
+	if rec.Code != http.StatusServiceUnavailable || called {
+		t.Errorf("Expected 503 without running the handler, got %d (called=%v)", rec.Code, called)
+	}
+}
+
+// TestAuditTrail_RedactsSecrets verifies keys in request bodies reach the handler but not admin_audit
+func TestAuditTrail_RedactsSecrets(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	body := `{"key": "opsen_0123456789abcdef", "note": "leaked \"key\"", "webhook": {"secret":"s3cret"}, "api_key":"ci-key"`
+	if read := auditedRequest(t, server, ok, http.MethodPost, "/admin/keys/revoke", body, "key:ops"); read != body {
+		t.Errorf("Expected the handler to read the key, got %q", read)
+	}
+
+	entries := queryAudit(t, server, "")
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	want := `{"key": "[redacted]", "note": "leaked \"key\"", "webhook": {"secret":"[redacted]"}, "api_key":"[redacted]"`
+	if entries[0].Payload != want {
+		t.Errorf("Expected secrets to be redacted, got %s", entries[0].Payload)
+	}
+}
+
+// TestAuditAccess_RecordsPprofReads verifies pprof requests are recorded even though they are reads
+func TestAuditAccess_RecordsPprofReads(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	mux := http.NewServeMux()
+	registerPprofHandlers(mux, server.AuditAccess)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, withActor(httptest.NewRequest(http.MethodGet, "/debug/pprof/cmdline", nil), "key:ops"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the pprof command line, got %d", rec.Code)
+	}
+
+	entries := queryAudit(t, server, "path=/debug/pprof/")
+	if len(entries) != 1 || entries[0].Actor != "key:ops" || entries[0].Method != http.MethodGet || entries[0].Status != http.StatusOK {
+		t.Errorf("Expected the pprof read to be recorded, got %+v", entries)
+	}
+}
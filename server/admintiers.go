@@ -0,0 +1,302 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// tierOverrideSettingName is the server_settings row holding tiers set with PUT /admin/tiers
+const tierOverrideSettingName = "tiers"
+
+// tierChangeHistoryLimit is how many audit records GET /admin/tiers returns
+const tierChangeHistoryLimit = 20
+
+// tierOverride is the persisted tier set that replaces the config file's tiers
+type tierOverride struct {
+	Version   string            `json:"version"`
+	Tiers     []common.TierSpec `json:"tiers"`
+	UpdatedBy string            `json:"updated_by"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// adminTiersRequest is the payload for PUT /admin/tiers
+type adminTiersRequest struct {
+	Tiers []common.TierSpec `json:"tiers"`
+	Note  string            `json:"note"`
+}
+
+// TierChange is one audit record of a runtime tier set change
+type TierChange struct {
+	ID              int64     `json:"id"`
+	Action          string    `json:"action"` // "update" or "reset"
+	Version         string    `json:"version"`
+	PreviousVersion string    `json:"previous_version"`
+	Added           []string  `json:"added,omitempty"`
+	Removed         []string  `json:"removed,omitempty"`
+	Changed         []string  `json:"changed,omitempty"`
+	Actor           string    `json:"actor"`
+	Note            string    `json:"note,omitempty"`
+	ChangedAt       time.Time `json:"changed_at"`
+}
+
+// validateTierReferences checks that settings naming tiers still find them in a new tier set
+func validateTierReferences(config *common.ServerConfig, tiers []common.TierSpec) error {
+	candidate := *config
+	candidate.Tiers = tiers
+	if err := validateMinHealthyBackends(&candidate); err != nil {
+		return err
+	}
+	return validateAutoscale(&candidate)
+}
+
+// diffTierSets lists the tiers added to, removed from and changed between two tier sets
+func diffTierSets(previous, next map[string]common.TierSpec) (added, removed, changed []string) {
+	for _, spec := range sortedTierList(next) {
+		old, ok := previous[spec.Name]
+		if !ok {
+			added = append(added, spec.Name)
+			continue
+		}
+		oldJSON, _ := json.Marshal(old)
+		newJSON, _ := json.Marshal(spec)
+		if string(oldJSON) != string(newJSON) {
+			changed = append(changed, spec.Name)
+		}
+	}
+	for _, spec := range sortedTierList(previous) {
+		if _, ok := next[spec.Name]; !ok {
+			removed = append(removed, spec.Name)
+		}
+	}
+	return added, removed, changed
+}
+
+// configTierSpecs indexes the tiers from the config file
+func (s *Server) configTierSpecs() map[string]common.TierSpec {
+	specs := make(map[string]common.TierSpec, len(s.config.Tiers))
+	for _, tier := range s.config.Tiers {
+		specs[tier.Name] = tier
+	}
+	return specs
+}
+
+// loadTierOverride restores a tier set set with PUT /admin/tiers before a restart
+// A persisted set that no longer validates against the config is ignored in favour of the config's tiers
+func (s *Server) loadTierOverride() error {
+	var value string
+	err := s.db.QueryRow("SELECT value FROM server_settings WHERE name = ?", tierOverrideSettingName).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var override tierOverride
+	if err := json.Unmarshal([]byte(value), &override); err != nil {
+		return fmt.Errorf("invalid persisted tier set: %w", err)
+	}
+	specs, err := buildTierSpecs(override.Tiers)
+	if err == nil {
+		err = validateTierReferences(s.config, override.Tiers)
+	}
+	if err != nil {
+		return fmt.Errorf("persisted tier set %s ignored: %w", override.Version, err)
+	}
+
+	s.mu.Lock()
+	s.tierSpecs = specs
+	s.tierVersion = tierSetVersion(specs)
+	s.tierOverride = &override
+	s.mu.Unlock()
+
+	LogWarnWithData("Using tier set from the database instead of the config file", map[string]interface{}{
+		"version":    override.Version,
+		"tiers":      len(specs),
+		"updated_by": override.UpdatedBy,
+		"updated_at": override.UpdatedAt,
+	})
+	return nil
+}
+
+// handleAdminTiers shows (GET), replaces (PUT) or resets to the config file (DELETE) the current tier set
+// Changes are persisted, survive restarts and are recorded in tier_changes
+func (s *Server) handleAdminTiers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req adminTiersRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		specs, err := buildTierSpecs(req.Tiers)
+		if err == nil {
+			err = validateTierReferences(s.config, req.Tiers)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		override := &tierOverride{
+			Version:   tierSetVersion(specs),
+			Tiers:     sortedTierList(specs),
+			UpdatedBy: requestActor(r),
+			UpdatedAt: time.Now().UTC(),
+		}
+		if !s.applyTierSet(w, "update", specs, override, req.Note, override.UpdatedBy) {
+			return
+		}
+	case http.MethodDelete:
+		if !s.applyTierSet(w, "reset", s.configTierSpecs(), nil, r.URL.Query().Get("note"), requestActor(r)) {
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	history, err := s.tierChanges(tierChangeHistoryLimit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read tier changes: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.RLock()
+	response := map[string]interface{}{
+		"source":  "config",
+		"version": s.tierVersion,
+		"tiers":   sortedTierList(s.tierSpecs),
+		"history": history,
+	}
+	if s.tierOverride != nil {
+		response["source"] = "admin"
+		response["updated_by"] = s.tierOverride.UpdatedBy
+		response["updated_at"] = s.tierOverride.UpdatedAt
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Warning: Failed to encode tiers: %v", err)
+	}
+}
+
+// applyTierSet persists and then applies a new current tier set, recording the change
+// override is nil when resetting to the config file's tiers. Returns false if an error response was written
+func (s *Server) applyTierSet(w http.ResponseWriter, action string, specs map[string]common.TierSpec, override *tierOverride, note, actor string) bool {
+	version := tierSetVersion(specs)
+
+	s.mu.RLock()
+	previous, previousVersion := s.tierSpecs, s.tierVersion
+	s.mu.RUnlock()
+	added, removed, changed := diffTierSets(previous, specs)
+
+	change := TierChange{
+		Action:          action,
+		Version:         version,
+		PreviousVersion: previousVersion,
+		Added:           added,
+		Removed:         removed,
+		Changed:         changed,
+		Actor:           actor,
+		Note:            note,
+		ChangedAt:       time.Now().UTC(),
+	}
+
+	// Persist first so a restart never brings back the tiers an operator replaced
+	if err := s.persistTierSet(override, change); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to persist tier set: %v", err), http.StatusInternalServerError)
+		return false
+	}
+
+	s.mu.Lock()
+	s.tierSpecs = specs
+	s.tierVersion = version
+	s.tierOverride = override
+	s.mu.Unlock()
+	s.invalidateRoutingSnapshot()
+
+	data := map[string]interface{}{
+		"action":           action,
+		"version":          version,
+		"previous_version": previousVersion,
+		"added":            added,
+		"removed":          removed,
+		"changed":          changed,
+		"actor":            actor,
+		"note":             note,
+	}
+	LogInfoWithData("Tier set changed", data)
+	s.emit("tiers.updated", data)
+	return true
+}
+
+// persistTierSet stores (or, for nil, removes) the tier override and its audit record in one transaction
+func (s *Server) persistTierSet(override *tierOverride, change TierChange) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if override != nil {
+		value, _ := json.Marshal(override)
+		_, err = tx.Exec(`
+			INSERT OR REPLACE INTO server_settings (name, value, updated_at)
+			VALUES (?, ?, CURRENT_TIMESTAMP)
+		`, tierOverrideSettingName, string(value))
+	} else {
+		_, err = tx.Exec("DELETE FROM server_settings WHERE name = ?", tierOverrideSettingName)
+	}
+	if err != nil {
+		return err
+	}
+
+	diff, _ := json.Marshal(map[string][]string{
+		"added":   change.Added,
+		"removed": change.Removed,
+		"changed": change.Changed,
+	})
+	if _, err := tx.Exec(`
+		INSERT INTO tier_changes (action, version, previous_version, diff_json, actor, note, changed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, change.Action, change.Version, change.PreviousVersion, string(diff), change.Actor, change.Note, change.ChangedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// tierChanges returns the most recent tier set changes, newest first
+func (s *Server) tierChanges(limit int) ([]TierChange, error) {
+	rows, err := s.db.Query(`
+		SELECT id, action, version, previous_version, diff_json, actor, note, changed_at
+		FROM tier_changes ORDER BY id DESC LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []TierChange{}
+	for rows.Next() {
+		var change TierChange
+		var diffJSON string
+		if err := rows.Scan(&change.ID, &change.Action, &change.Version, &change.PreviousVersion, &diffJSON,
+			&change.Actor, &change.Note, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		var diff map[string][]string
+		if json.Unmarshal([]byte(diffJSON), &diff) == nil {
+			change.Added, change.Removed, change.Changed = diff["added"], diff["removed"], diff["changed"]
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+type adminTiersResponse struct {
+	Source    string            `json:"source"`
+	Version   string            `json:"version"`
+	Tiers     []common.TierSpec `json:"tiers"`
+	UpdatedBy string            `json:"updated_by"`
+	History   []TierChange      `json:"history"`
+}
+
+func adminTiers(t *testing.T, server *Server, method, body string) (*httptest.ResponseRecorder, adminTiersResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	server.handleAdminTiers(rec, httptest.NewRequest(method, "/admin/tiers", strings.NewReader(body)))
+	var response adminTiersResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+	}
+	return rec, response
+}
+
+// TestAdminTiers_UpdatePersistsAndAudits verifies PUT /admin/tiers applies at once, is recorded and survives a restart
+func TestAdminTiers_UpdatePersistsAndAudits(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-a", TotalCPU: 4}))
+	configVersion := server.tierVersion
+
+	if rec := routeTier(server, "pro-max"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected pro-max not to fit a 4-core backend, got %d", rec.Code)
+	}
+
+	rec, response := adminTiers(t, server, "PUT", `{"tiers": [
+		{"name": "lite", "vcpu": 1, "memory_gb": 2, "storage_gb": 10},
+		{"name": "pro-max", "vcpu": 2, "memory_gb": 8, "storage_gb": 40},
+		{"name": "burst", "vcpu": 2, "memory_gb": 4, "storage_gb": 10}
+	], "note": "shrink pro-max"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected PUT to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if response.Source != "admin" || response.Version == configVersion || len(response.Tiers) != 3 {
+		t.Fatalf("Expected the new tier set to be current, got %+v", response)
+	}
+	if len(response.History) != 1 {
+		t.Fatalf("Expected one audit record, got %+v", response.History)
+	}
+	change := response.History[0]
+	if change.Action != "update" || change.PreviousVersion != configVersion || change.Version != response.Version ||
+		change.Actor != "anonymous" || change.Note != "shrink pro-max" {
+		t.Errorf("Unexpected audit record: %+v", change)
+	}
+	if len(change.Added) != 1 || change.Added[0] != "burst" || len(change.Changed) != 2 || len(change.Removed) == 0 {
+		t.Errorf("Expected burst added, lite and pro-max changed and the rest removed, got %+v", change)
+	}
+
+	if rec := routeTier(server, "pro-max"); rec.Code != http.StatusOK {
+		t.Errorf("Expected the smaller pro-max to fit at once, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	restarted := NewTestServer(t, db)
+	if err := restarted.loadTierOverride(); err != nil {
+		t.Fatalf("Failed to load tier set: %v", err)
+	}
+	if restarted.tierVersion != response.Version || restarted.tierSpecs["pro-max"].VCPU != 2 {
+		t.Errorf("Expected the tier set to survive a restart, got version %s", restarted.tierVersion)
+	}
+}
+
+// TestAdminTiers_ResetToConfig verifies DELETE /admin/tiers restores the config file's tiers and removes the persisted set
+func TestAdminTiers_ResetToConfig(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	configVersion := server.tierVersion
+
+	if rec, _ := adminTiers(t, server, "PUT", `{"tiers": [{"name": "lite", "vcpu": 1, "memory_gb": 1, "storage_gb": 5}]}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected PUT to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec, response := adminTiers(t, server, "DELETE", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected DELETE to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if response.Source != "config" || response.Version != configVersion {
+		t.Errorf("Expected the config tiers back, got %+v", response)
+	}
+	if len(response.History) != 2 || response.History[0].Action != "reset" {
+		t.Errorf("Expected the reset to be recorded first, got %+v", response.History)
+	}
+
+	restarted := NewTestServer(t, db)
+	if err := restarted.loadTierOverride(); err != nil || restarted.tierVersion != configVersion {
+		t.Errorf("Expected no persisted tier set after reset, got version %s (%v)", restarted.tierVersion, err)
+	}
+}
+
+// TestAdminTiers_Validation verifies invalid tier sets and sets dropping referenced tiers are rejected unchanged
+func TestAdminTiers_Validation(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.MinHealthyBackends = map[string]int{"pro-max": 1}
+	})
+	version := server.tierVersion
+
+	for name, body := range map[string]string{
+		"empty":      `{"tiers": []}`,
+		"duplicate":  `{"tiers": [{"name": "pro-max", "vcpu": 1}, {"name": "pro-max", "vcpu": 2}]}`,
+		"negative":   `{"tiers": [{"name": "pro-max", "vcpu": -1}]}`,
+		"referenced": `{"tiers": [{"name": "lite", "vcpu": 1}]}`,
+		"malformed":  `{"tiers": `,
+	} {
+		if rec, _ := adminTiers(t, server, "PUT", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, rec.Code)
+		}
+	}
+	if server.tierVersion != version {
+		t.Error("Expected rejected tier sets to leave the current set unchanged")
+	}
+	if _, response := adminTiers(t, server, "GET", ""); len(response.History) != 0 {
+		t.Errorf("Expected no audit records for rejected changes, got %+v", response.History)
+	}
+}
@@ -0,0 +1,582 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runtimeKeyPrefix starts every key created through /admin/keys, so leaked keys are easy to scan for
+const runtimeKeyPrefix = "opsen_"
+
+// RuntimeAPIKey is an API key managed through /admin/keys. Only a SHA-256 hash of the key is stored;
+// the key itself is returned once, when it is created or rotated
+type RuntimeAPIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`           // First characters of the key, to recognize it
+	Tenant     string     `json:"tenant,omitempty"` // Binds requests to this tenant like a tenant api_key (empty = global)
+	CreatedAt  time.Time  `json:"created_at"`
+	CreatedBy  string     `json:"created_by"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	DisabledBy string     `json:"disabled_by,omitempty"`
+	ReplacedBy string     `json:"replaced_by,omitempty"` // ID of the key that replaced this one on rotation
+	Active     bool       `json:"active"`
+
+	hash string
+}
+
+// RevokedAPIKey is a configured key (api_keys or a tenant's api_keys) refused until it is removed from the config
+type RevokedAPIKey struct {
+	Fingerprint string    `json:"fingerprint"`
+	RevokedAt   time.Time `json:"revoked_at"`
+	RevokedBy   string    `json:"revoked_by"`
+	Note        string    `json:"note,omitempty"`
+}
+
+// APIKeyStore holds the runtime API keys and the revocation list; changes apply to the next request
+type APIKeyStore struct {
+	db *sql.DB
+
+	mu      sync.RWMutex
+	keys    map[string]*RuntimeAPIKey // Hash → key
+	revoked map[string]RevokedAPIKey  // Hash → revocation
+}
+
+// NewAPIKeyStore creates an empty store backed by db
+func NewAPIKeyStore(db *sql.DB) *APIKeyStore {
+	return &APIKeyStore{
+		db:      db,
+		keys:    make(map[string]*RuntimeAPIKey),
+		revoked: make(map[string]RevokedAPIKey),
+	}
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyFingerprint identifies a key in logs and the revocation list without revealing it
+func apiKeyFingerprint(key string) string {
+	return "sha256:" + hashAPIKey(key)[:12]
+}
+
+// active reports whether a key authenticates requests at now
+func (k *RuntimeAPIKey) active(now time.Time) bool {
+	return k.DisabledAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// view returns a copy for API responses with Active filled in
+func (k *RuntimeAPIKey) view(now time.Time) RuntimeAPIKey {
+	copied := *k
+	copied.Active = k.active(now)
+	return copied
+}
+
+// Load reads runtime keys and revocations from the database
+func (st *APIKeyStore) Load() error {
+	rows, err := st.db.Query(`
+		SELECT id, name, key_hash, prefix, tenant, created_at, created_by, expires_at, disabled_at, disabled_by, replaced_by
+		FROM api_keys
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	keys := make(map[string]*RuntimeAPIKey)
+	for rows.Next() {
+		var k RuntimeAPIKey
+		var expiresAt, disabledAt sql.NullTime
+		if err := rows.Scan(&k.ID, &k.Name, &k.hash, &k.Prefix, &k.Tenant, &k.CreatedAt, &k.CreatedBy,
+			&expiresAt, &disabledAt, &k.DisabledBy, &k.ReplacedBy); err != nil {
+			return err
+		}
+		if expiresAt.Valid {
+			k.ExpiresAt = &expiresAt.Time
+		}
+		if disabledAt.Valid {
+			k.DisabledAt = &disabledAt.Time
+		}
+		keys[k.hash] = &k
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	revocations, err := st.db.Query(`SELECT key_hash, fingerprint, revoked_at, revoked_by, note FROM api_key_revocations`)
+	if err != nil {
+		return err
+	}
+	defer revocations.Close()
+
+	revoked := make(map[string]RevokedAPIKey)
+	for revocations.Next() {
+		var hash string
+		var rk RevokedAPIKey
+		if err := revocations.Scan(&hash, &rk.Fingerprint, &rk.RevokedAt, &rk.RevokedBy, &rk.Note); err != nil {
+			return err
+		}
+		revoked[hash] = rk
+	}
+	if err := revocations.Err(); err != nil {
+		return err
+	}
+
+	st.mu.Lock()
+	st.keys = keys
+	st.revoked = revoked
+	st.mu.Unlock()
+	return nil
+}
+
+// HasActive reports whether any runtime key can authenticate; such keys turn authentication on
+func (st *APIKeyStore) HasActive() bool {
+	if st == nil {
+		return false
+	}
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	now := time.Now()
+	for _, k := range st.keys {
+		if k.active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Revoked reports whether a configured key is on the revocation list
+func (st *APIKeyStore) Revoked(key string) bool {
+	if st == nil {
+		return false
+	}
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	_, revoked := st.revoked[hashAPIKey(key)]
+	return revoked
+}
+
+// Lookup returns the runtime key matching a presented key, if any, and whether it is active
+func (st *APIKeyStore) Lookup(key string) (RuntimeAPIKey, bool, bool) {
+	if st == nil || !strings.HasPrefix(key, runtimeKeyPrefix) {
+		return RuntimeAPIKey{}, false, false
+	}
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	k, ok := st.keys[hashAPIKey(key)]
+	if !ok {
+		return RuntimeAPIKey{}, false, false
+	}
+	return *k, true, k.active(time.Now())
+}
+
+// List returns all runtime keys, oldest first, and the revocation list
+func (st *APIKeyStore) List() ([]RuntimeAPIKey, []RevokedAPIKey) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	now := time.Now()
+	keys := make([]RuntimeAPIKey, 0, len(st.keys))
+	for _, k := range st.keys {
+		keys = append(keys, k.view(now))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	revoked := make([]RevokedAPIKey, 0, len(st.revoked))
+	for _, rk := range st.revoked {
+		revoked = append(revoked, rk)
+	}
+	sort.Slice(revoked, func(i, j int) bool { return revoked[i].RevokedAt.Before(revoked[j].RevokedAt) })
+	return keys, revoked
+}
+
+// newRuntimeKey generates a key and its record
+func newRuntimeKey(name, tenant string, expiresAt *time.Time, actor string) (string, *RuntimeAPIKey, error) {
+	secret := make([]byte, 24)
+	idBytes := make([]byte, 6)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", nil, err
+	}
+	key := runtimeKeyPrefix + hex.EncodeToString(secret)
+	return key, &RuntimeAPIKey{
+		ID:        "key_" + hex.EncodeToString(idBytes),
+		Name:      name,
+		Prefix:    key[:len(runtimeKeyPrefix)+6],
+		Tenant:    tenant,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		CreatedBy: actor,
+		ExpiresAt: expiresAt,
+		hash:      hashAPIKey(key),
+	}, nil
+}
+
+// sqlExecer is satisfied by *sql.DB and *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertRuntimeKey(db sqlExecer, k *RuntimeAPIKey) error {
+	_, err := db.Exec(`
+		INSERT INTO api_keys (id, name, key_hash, prefix, tenant, created_at, created_by, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, k.ID, k.Name, k.hash, k.Prefix, k.Tenant, k.CreatedAt, k.CreatedBy, k.ExpiresAt)
+	return err
+}
+
+// Create generates and stores a new key, returning it in plain text with its record
+func (st *APIKeyStore) Create(name, tenant string, expiresAt *time.Time, actor string) (string, RuntimeAPIKey, error) {
+	key, k, err := newRuntimeKey(name, tenant, expiresAt, actor)
+	if err != nil {
+		return "", RuntimeAPIKey{}, err
+	}
+	if err := insertRuntimeKey(st.db, k); err != nil {
+		return "", RuntimeAPIKey{}, err
+	}
+
+	st.mu.Lock()
+	st.keys[k.hash] = k
+	st.mu.Unlock()
+	return key, k.view(time.Now()), nil
+}
+
+// byIDLocked returns the runtime key with an ID; caller holds st.mu
+func (st *APIKeyStore) byIDLocked(id string) *RuntimeAPIKey {
+	for _, k := range st.keys {
+		if k.ID == id {
+			return k
+		}
+	}
+	return nil
+}
+
+// Disable revokes a runtime key immediately
+func (st *APIKeyStore) Disable(id, actor string) (RuntimeAPIKey, bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	k := st.byIDLocked(id)
+	if k == nil {
+		return RuntimeAPIKey{}, false, nil
+	}
+	if k.DisabledAt == nil {
+		now := time.Now().UTC().Truncate(time.Second)
+		if _, err := st.db.Exec(`UPDATE api_keys SET disabled_at = ?, disabled_by = ? WHERE id = ?`, now, actor, id); err != nil {
+			return RuntimeAPIKey{}, true, err
+		}
+		k.DisabledAt = &now
+		k.DisabledBy = actor
+	}
+	return k.view(time.Now()), true, nil
+}
+
+// Rotate replaces a runtime key with a new one of the same name and tenant. The old key stops working
+// after grace (immediately when grace is 0), so clients can switch over without downtime
+// A key can be rotated once: the new key and the old key's replacement are written in one transaction,
+// so concurrent rotations can't leave two live successors
+func (st *APIKeyStore) Rotate(id string, grace time.Duration, expiresAt *time.Time, actor string) (string, RuntimeAPIKey, bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	old := st.byIDLocked(id)
+	if old == nil {
+		return "", RuntimeAPIKey{}, false, nil
+	}
+	if !old.active(time.Now()) {
+		return "", RuntimeAPIKey{}, true, fmt.Errorf("key %s is disabled or expired and cannot be rotated", id)
+	}
+	if old.ReplacedBy != "" {
+		return "", RuntimeAPIKey{}, true, fmt.Errorf("key %s was already rotated to %s", id, old.ReplacedBy)
+	}
+
+	key, created, err := newRuntimeKey(old.Name, old.Tenant, expiresAt, actor)
+	if err != nil {
+		return "", RuntimeAPIKey{}, true, err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	oldExpiresAt, oldDisabledAt, oldDisabledBy := old.ExpiresAt, old.DisabledAt, old.DisabledBy
+	if grace > 0 {
+		if until := now.Add(grace); oldExpiresAt == nil || until.Before(*oldExpiresAt) {
+			oldExpiresAt = &until
+		}
+	} else {
+		oldDisabledAt, oldDisabledBy = &now, actor
+	}
+
+	tx, err := st.db.Begin()
+	if err != nil {
+		return "", RuntimeAPIKey{}, true, err
+	}
+	defer tx.Rollback()
+	if err := insertRuntimeKey(tx, created); err != nil {
+		return "", RuntimeAPIKey{}, true, err
+	}
+	// Another server sharing the database may have rotated the key first
+	result, err := tx.Exec(`UPDATE api_keys SET expires_at = ?, disabled_at = ?, disabled_by = ?, replaced_by = ? WHERE id = ? AND replaced_by = ''`,
+		oldExpiresAt, oldDisabledAt, oldDisabledBy, created.ID, id)
+	if err != nil {
+		return "", RuntimeAPIKey{}, true, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n != 1 {
+		return "", RuntimeAPIKey{}, true, fmt.Errorf("key %s was already rotated", id)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", RuntimeAPIKey{}, true, err
+	}
+
+	old.ExpiresAt, old.DisabledAt, old.DisabledBy, old.ReplacedBy = oldExpiresAt, oldDisabledAt, oldDisabledBy, created.ID
+	st.keys[created.hash] = created
+	return key, created.view(time.Now()), true, nil
+}
+
+// Revoke adds a configured key to the revocation list
+func (st *APIKeyStore) Revoke(key, note, actor string) (RevokedAPIKey, error) {
+	hash := hashAPIKey(key)
+	rk := RevokedAPIKey{
+		Fingerprint: apiKeyFingerprint(key),
+		RevokedAt:   time.Now().UTC().Truncate(time.Second),
+		RevokedBy:   actor,
+		Note:        note,
+	}
+	if _, err := st.db.Exec(`
+		INSERT OR REPLACE INTO api_key_revocations (key_hash, fingerprint, revoked_at, revoked_by, note)
+		VALUES (?, ?, ?, ?, ?)
+	`, hash, rk.Fingerprint, rk.RevokedAt, rk.RevokedBy, rk.Note); err != nil {
+		return RevokedAPIKey{}, err
+	}
+	st.mu.Lock()
+	st.revoked[hash] = rk
+	st.mu.Unlock()
+	return rk, nil
+}
+
+type apiKeyActorContextKey struct{}
+
+// withActor records which API key authenticated a request
+func withActor(r *http.Request, actor string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), apiKeyActorContextKey{}, actor))
+}
+
+// requestActor names the API key that authenticated a request ("anonymous" when auth is off)
+func requestActor(r *http.Request) string {
+	if actor, ok := r.Context().Value(apiKeyActorContextKey{}).(string); ok {
+		return actor
+	}
+	return "anonymous"
+}
+
+// apiKeyRequest is the body of POST /admin/keys and POST /admin/keys/{id}/rotate
+type apiKeyRequest struct {
+	Name          string `json:"name"`
+	Tenant        string `json:"tenant,omitempty"`
+	ExpiresInSecs int    `json:"expires_in_secs,omitempty"` // Key stops working after this (0 = never)
+	GraceSecs     int    `json:"grace_secs,omitempty"`      // Rotation: seconds the old key keeps working (0 = disabled at once)
+}
+
+// apiKeyResponse returns a new key; Key is only ever shown here
+type apiKeyResponse struct {
+	RuntimeAPIKey
+	Key string `json:"key"`
+}
+
+func (req apiKeyRequest) expiresAt() *time.Time {
+	if req.ExpiresInSecs <= 0 {
+		return nil
+	}
+	t := time.Now().UTC().Truncate(time.Second).Add(time.Duration(req.ExpiresInSecs) * time.Second)
+	return &t
+}
+
+// handleAPIKeys lists runtime keys and revocations (GET) or creates a key (POST)
+func (s *Server) handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		keys, revoked := s.apiKeys.List()
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys":    keys,
+			"revoked": revoked,
+		}); err != nil {
+			log.Printf("Warning: Failed to encode API keys: %v", err)
+		}
+	case http.MethodPost:
+		var req apiKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(req.Name) == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		if req.ExpiresInSecs < 0 {
+			http.Error(w, "expires_in_secs must not be negative", http.StatusBadRequest)
+			return
+		}
+		if req.Tenant != "" && !s.knownTenant(req.Tenant) {
+			http.Error(w, fmt.Sprintf("Unknown tenant: %s", req.Tenant), http.StatusBadRequest)
+			return
+		}
+		// An unauthenticated caller's first key would turn auth on and lock out agents that send none
+		if !s.authConfigured() {
+			http.Error(w, "API keys can only be created once authentication is configured (server_key or api_keys)", http.StatusConflict)
+			return
+		}
+
+		key, created, err := s.apiKeys.Create(strings.TrimSpace(req.Name), req.Tenant, req.expiresAt(), requestActor(r))
+		if err != nil {
+			LogError(fmt.Sprintf("Failed to create API key: %v", err))
+			http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+			return
+		}
+		LogInfoWithData("API key created", map[string]interface{}{
+			"id":     created.ID,
+			"name":   created.Name,
+			"tenant": created.Tenant,
+			"actor":  requestActor(r),
+		})
+		writeAPIKey(w, http.StatusCreated, key, created)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// authConfigured reports whether requests are authenticated: a key is configured or a runtime key is active
+func (s *Server) authConfigured() bool {
+	return s.config.ServerKey != "" || len(s.config.APIKeys) > 0 || len(tenantAPIKeys(s.config.Tenants)) > 0 || s.apiKeys.HasActive()
+}
+
+// handleAPIKeyByID handles POST /admin/keys/{id}/disable, POST /admin/keys/{id}/rotate and POST /admin/keys/revoke
+func (s *Server) handleAPIKeyByID(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/admin/keys/")
+	if path == "revoke" {
+		s.handleRevokeAPIKey(w, r)
+		return
+	}
+	id, action, ok := strings.Cut(path, "/")
+	if !ok || id == "" || (action != "disable" && action != "rotate") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	actor := requestActor(r)
+
+	if action == "disable" {
+		disabled, found, err := s.apiKeys.Disable(id, actor)
+		if !found {
+			http.Error(w, fmt.Sprintf("Unknown API key: %s", id), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			LogError(fmt.Sprintf("Failed to disable API key %s: %v", id, err))
+			http.Error(w, "Failed to disable API key", http.StatusInternalServerError)
+			return
+		}
+		LogInfoWithData("API key disabled", map[string]interface{}{"id": id, "name": disabled.Name, "actor": actor})
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(disabled); err != nil {
+			log.Printf("Warning: Failed to encode API key: %v", err)
+		}
+		return
+	}
+
+	var req apiKeyRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.GraceSecs < 0 || req.ExpiresInSecs < 0 {
+		http.Error(w, "grace_secs and expires_in_secs must not be negative", http.StatusBadRequest)
+		return
+	}
+	key, created, found, err := s.apiKeys.Rotate(id, time.Duration(req.GraceSecs)*time.Second, req.expiresAt(), actor)
+	if !found {
+		http.Error(w, fmt.Sprintf("Unknown API key: %s", id), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	LogInfoWithData("API key rotated", map[string]interface{}{
+		"id":         id,
+		"new_id":     created.ID,
+		"name":       created.Name,
+		"grace_secs": req.GraceSecs,
+		"actor":      actor,
+	})
+	writeAPIKey(w, http.StatusOK, key, created)
+}
+
+// handleRevokeAPIKey adds a configured key to the revocation list: POST /admin/keys/revoke {"key": "..."}
+// Runtime keys are disabled instead; server_key cannot be revoked since agents depend on it
+func (s *Server) handleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Key  string `json:"key"`
+		Note string `json:"note,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch {
+	case req.Key == "":
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return
+	case req.Key == s.config.ServerKey:
+		http.Error(w, "server_key cannot be revoked; replace it in the configuration", http.StatusBadRequest)
+		return
+	}
+	if k, ok, _ := s.apiKeys.Lookup(req.Key); ok {
+		http.Error(w, fmt.Sprintf("Runtime key %s: use POST /admin/keys/%s/disable", k.ID, k.ID), http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := s.apiKeys.Revoke(req.Key, req.Note, requestActor(r))
+	if err != nil {
+		LogError(fmt.Sprintf("Failed to revoke API key: %v", err))
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+	LogInfoWithData("API key revoked", map[string]interface{}{
+		"fingerprint": revoked.Fingerprint,
+		"actor":       revoked.RevokedBy,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(revoked); err != nil {
+		log.Printf("Warning: Failed to encode revocation: %v", err)
+	}
+}
+
+func writeAPIKey(w http.ResponseWriter, status int, key string, record RuntimeAPIKey) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(apiKeyResponse{RuntimeAPIKey: record, Key: key}); err != nil {
+		log.Printf("Warning: Failed to encode API key: %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// newAPIKeyTestServer returns a server with a tenant and an auth middleware in front of a handler
+// that reports the caller's tenant and actor
+func newAPIKeyTestServer(t *testing.T) (*Server, func(key string) *httptest.ResponseRecorder) {
+	t.Helper()
+	db, cleanup := CreateTestDB(t)
+	t.Cleanup(cleanup)
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.ServerKey = "agent-key"
+		c.APIKeys = []string{"ci-key"}
+		c.Tenants = []common.TenantConfig{{Name: "acme"}}
+	})
+	auth := NewAPIKeyAuth(server.config.ServerKey, server.config.APIKeys)
+	auth.SetKeyStore(server.apiKeys)
+	protected := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, _ := tenantFromContext(r)
+		json.NewEncoder(w).Encode(map[string]string{"tenant": tenant, "actor": requestActor(r)})
+	}))
+
+	call := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/clients", nil)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		protected.ServeHTTP(rec, req)
+		return rec
+	}
+	return server, call
+}
+
+// adminKeyCall sends a request to the /admin/keys handlers as the server_key holder
+func adminKeyCall(server *Server, path string, body interface{}) *httptest.ResponseRecorder {
+	method := http.MethodPost
+	if body == nil {
+		method = http.MethodGet
+	}
+	data, _ := json.Marshal(body)
+	req := withActor(httptest.NewRequest(method, path, bytes.NewReader(data)), "server_key")
+	rec := httptest.NewRecorder()
+	if path == "/admin/keys" {
+		server.handleAPIKeys(rec, req)
+	} else {
+		server.handleAPIKeyByID(rec, req)
+	}
+	return rec
+}
+
+// TestAPIKeys_CreateDisable verifies runtime keys authenticate at once, bind their tenant and stop on disable
+func TestAPIKeys_CreateDisable(t *testing.T) {
+	server, call := newAPIKeyTestServer(t)
+
+	rec := adminKeyCall(server, "/admin/keys", map[string]string{"name": "dashboard", "tenant": "acme"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created apiKeyResponse
+	json.NewDecoder(rec.Body).Decode(&created)
+	if created.CreatedBy != "server_key" || created.Key == "" || !created.Active {
+		t.Fatalf("Unexpected key: %+v", created)
+	}
+
+	rec = call(created.Key)
+	var seen map[string]string
+	json.NewDecoder(rec.Body).Decode(&seen)
+	if rec.Code != http.StatusOK || seen["tenant"] != "acme" || seen["actor"] != created.ID+" (dashboard)" {
+		t.Errorf("Expected the key to act for acme, got %d %v", rec.Code, seen)
+	}
+
+	if rec := adminKeyCall(server, "/admin/keys/"+created.ID+"/disable", map[string]string{}); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 disabling the key, got %d", rec.Code)
+	}
+	if rec := call(created.Key); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a disabled key to be refused immediately, got %d", rec.Code)
+	}
+
+	// The store reloads from the database after a restart
+	restarted := NewAPIKeyStore(server.db)
+	if err := restarted.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if k, found, active := restarted.Lookup(created.Key); !found || active || k.DisabledBy != "server_key" {
+		t.Errorf("Expected the disabled key after reload, got %+v found=%v active=%v", k, found, active)
+	}
+}
+
+// TestAPIKeys_Rotate verifies rotation issues a new key and keeps the old one only for the grace period
+func TestAPIKeys_Rotate(t *testing.T) {
+	server, call := newAPIKeyTestServer(t)
+
+	var first, second, third apiKeyResponse
+	json.NewDecoder(adminKeyCall(server, "/admin/keys", map[string]string{"name": "ci"}).Body).Decode(&first)
+
+	rec := adminKeyCall(server, "/admin/keys/"+first.ID+"/rotate", map[string]int{"grace_secs": 300})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	json.NewDecoder(rec.Body).Decode(&second)
+	if second.Name != "ci" || second.Key == first.Key {
+		t.Fatalf("Expected a new key named ci, got %+v", second)
+	}
+	if call(first.Key).Code != http.StatusOK || call(second.Key).Code != http.StatusOK {
+		t.Error("Expected both keys to work during the grace period")
+	}
+
+	// Without a grace period the old key stops at once, and a replaced key can't be rotated again
+	json.NewDecoder(adminKeyCall(server, "/admin/keys/"+second.ID+"/rotate", map[string]int{}).Body).Decode(&third)
+	if call(second.Key).Code != http.StatusForbidden || call(third.Key).Code != http.StatusOK {
+		t.Error("Expected only the newest key to work after rotating without grace")
+	}
+	if rec := adminKeyCall(server, "/admin/keys/"+second.ID+"/rotate", map[string]int{}); rec.Code != http.StatusConflict {
+		t.Errorf("Expected rotating a replaced key to fail, got %d", rec.Code)
+	}
+
+	keys, _ := server.apiKeys.List()
+	replacedBy := map[string]string{}
+	for _, k := range keys {
+		replacedBy[k.ID] = k.ReplacedBy
+	}
+	if len(keys) != 3 || replacedBy[first.ID] != second.ID || replacedBy[second.ID] != third.ID {
+		t.Errorf("Expected the rotation chain in the listing, got %v", replacedBy)
+	}
+}
+
+// TestAPIKeys_RevokeConfigured verifies configured api_keys can be revoked but server_key cannot
+func TestAPIKeys_RevokeConfigured(t *testing.T) {
+	server, call := newAPIKeyTestServer(t)
+
+	if call("ci-key").Code != http.StatusOK {
+		t.Fatal("Expected the configured key to work before revocation")
+	}
+	if rec := adminKeyCall(server, "/admin/keys/revoke", map[string]string{"key": "ci-key"}); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := call("ci-key"); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a revoked key to be refused, got %d", rec.Code)
+	}
+	if rec := adminKeyCall(server, "/admin/keys/revoke", map[string]string{"key": "agent-key"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected server_key revocation to be rejected, got %d", rec.Code)
+	}
+	if call("agent-key").Code != http.StatusOK {
+		t.Error("Expected server_key to keep working")
+	}
+}
+
+// TestAPIKeys_RequireConfiguredAuth verifies an open server refuses to mint the first key
+func TestAPIKeys_RequireConfiguredAuth(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	if rec := adminKeyCall(server, "/admin/keys", map[string]string{"name": "takeover"}); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 without configured auth, got %d", rec.Code)
+	}
+	if server.apiKeys.HasActive() {
+		t.Error("Expected no runtime key to be created")
+	}
+}
+
+// TestAPIKeys_ConcurrentRotate verifies concurrent rotations of one key leave a single successor
+func TestAPIKeys_ConcurrentRotate(t *testing.T) {
+	server, _ := newAPIKeyTestServer(t)
+	var first apiKeyResponse
+	json.NewDecoder(adminKeyCall(server, "/admin/keys", map[string]string{"name": "ci"}).Body).Decode(&first)
+
+	codes := make(chan int, 8)
+	for i := 0; i < cap(codes); i++ {
+		go func() {
+			codes <- adminKeyCall(server, "/admin/keys/"+first.ID+"/rotate", map[string]int{"grace_secs": 60}).Code
+		}()
+	}
+	succeeded := 0
+	for i := 0; i < cap(codes); i++ {
+		if <-codes == http.StatusOK {
+			succeeded++
+		}
+	}
+	keys, _ := server.apiKeys.List()
+	if succeeded != 1 || len(keys) != 2 {
+		t.Errorf("Expected one rotation to succeed, got %d successes and %d keys", succeeded, len(keys))
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// autoApprovedPrefix marks approvals granted by an auto_approve rule rather than an admin
+const autoApprovedPrefix = "auto:"
+
+// validateRegistrationApproval checks that every auto-approval rule is named and sets a valid condition
+func validateRegistrationApproval(config common.RegistrationApprovalConfig) error {
+	names := make(map[string]bool, len(config.AutoApprove))
+	for i, rule := range config.AutoApprove {
+		if rule.Name == "" {
+			return fmt.Errorf("registration_approval.auto_approve[%d]: name is required", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("registration_approval.auto_approve: duplicate rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+		if len(rule.Tokens) == 0 && len(rule.CIDRs) == 0 && len(rule.Labels) == 0 {
+			return fmt.Errorf("registration_approval.auto_approve %s: set tokens, cidrs or labels", rule.Name)
+		}
+		for _, token := range rule.Tokens {
+			if token == "" {
+				return fmt.Errorf("registration_approval.auto_approve %s: tokens must not be empty", rule.Name)
+			}
+		}
+		for _, cidr := range rule.CIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return fmt.Errorf("registration_approval.auto_approve %s: invalid cidr %q", rule.Name, cidr)
+			}
+		}
+	}
+	return nil
+}
+
+// awaitingApproval reports whether a backend is held out of routing until it is approved
+func (s *Server) awaitingApproval(client *ClientState) bool {
+	return s.config.RegistrationApproval.Enabled && client.PendingApproval
+}
+
+// autoApproveRule returns the name of the first auto_approve rule a registration satisfies, or ""
+// The source address is the connection's own, since agents could set X-Forwarded-For to anything
+func (s *Server) autoApproveRule(reg common.ClientRegistration, r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+
+	for _, rule := range s.config.RegistrationApproval.AutoApprove {
+		if len(rule.Tokens) > 0 && !tokenListed(reg.ApprovalToken, rule.Tokens) {
+			continue
+		}
+		if len(rule.CIDRs) > 0 && !ipInCIDRs(ip, rule.CIDRs) {
+			continue
+		}
+		if len(rule.Labels) > 0 && !labelsMatch(reg.Labels, rule.Labels) {
+			continue
+		}
+		return rule.Name
+	}
+	return ""
+}
+
+// tokenListed compares a token against each allowed one in constant time
+func tokenListed(token string, allowed []string) bool {
+	if token == "" {
+		return false
+	}
+	listed := false
+	for _, candidate := range allowed {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+			listed = true
+		}
+	}
+	return listed
+}
+
+// ipInCIDRs reports whether ip falls in any of the networks
+func ipInCIDRs(ip net.IP, cidrs []string) bool {
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range cidrs {
+		if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// approveClient releases a pending backend into routing and records who approved it
+// Returns whether the backend exists and whether it was pending; approving an approved backend changes nothing
+func (s *Server) approveClient(clientID, approvedBy string) (found, wasPending bool, err error) {
+	s.mu.Lock()
+	client, ok := s.clientCache[clientID]
+	if !ok || !client.PendingApproval {
+		s.mu.Unlock()
+		return ok, false, nil
+	}
+	s.invalidateRoutingSnapshot()
+	client.PendingApproval = false
+	client.ApprovedBy = approvedBy
+	// Traffic starts now, so the slow-start window does too
+	s.startWarmupLocked(client, "approved")
+	data := approvalEventData(client)
+	s.mu.Unlock()
+	s.routeCache.Invalidate(clientID)
+
+	LogInfoWithData("Backend approved", data)
+	s.emit("client.approved", data)
+	_, err = s.db.Exec("UPDATE clients SET pending_approval = 0, approved_by = ? WHERE client_id = ?", approvedBy, clientID)
+	return true, true, err
+}
+
+// approvalEventData describes a backend for client.pending_approval and client.approved events (caller must hold s.mu)
+func approvalEventData(client *ClientState) map[string]interface{} {
+	data := map[string]interface{}{
+		"client_id": client.Registration.ClientID,
+		"hostname":  client.Registration.Hostname,
+		"tenant":    client.Registration.Tenant,
+		"endpoint":  client.Endpoint,
+		"public_ip": client.Registration.PublicIP,
+		"labels":    client.Registration.Labels,
+	}
+	if !client.PendingApproval {
+		data["approved_by"] = client.ApprovedBy
+	}
+	return data
+}
+
+// handleApproveClient handles POST /clients/{id}/approve: lets a backend held by registration_approval receive traffic
+func (s *Server) handleApproveClient(w http.ResponseWriter, r *http.Request, clientID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	found, wasPending, err := s.approveClient(clientID, requestActor(r))
+	if !found {
+		http.Error(w, fmt.Sprintf("Unknown client: %s", clientID), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error persisting approval of client %s: %v", clientID, err)
+	}
+
+	status := "approved"
+	if !wasPending {
+		status = "already_approved"
+	}
+	s.mu.RLock()
+	approvedBy := ""
+	if client, ok := s.clientCache[clientID]; ok {
+		approvedBy = client.ApprovedBy
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      status,
+		"client_id":   clientID,
+		"approved_by": approvedBy,
+		"timestamp":   time.Now(),
+	}); err != nil {
+		log.Printf("Warning: Failed to encode approve client response: %v", err)
+	}
+}
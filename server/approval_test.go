@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestRegistrationApproval_HoldsNewBackendsUntilApproved verifies new registrations are kept out of routing until
+// POST /clients/{id}/approve, while backends registered before stay routable and re-registrations keep their state
+func TestRegistrationApproval_HoldsNewBackendsUntilApproved(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.RegistrationApproval.Enabled = true
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "existing"}))
+
+	reg := common.ClientRegistration{ClientID: "contractor-01", EndpointURL: "http://10.0.0.9:11000"}
+	rec := postRegistration(server, reg)
+	var resp map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || resp["status"] != "pending_approval" {
+		t.Fatalf("Expected the registration to be held, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	routable := func(id string) bool {
+		server.mu.RLock()
+		defer server.mu.RUnlock()
+		return server.routable(server.clientCache[id])
+	}
+	if routable("contractor-01") || !routable("existing") {
+		t.Fatal("Expected only the held backend to be kept out of routing")
+	}
+
+	listRec := httptest.NewRecorder()
+	server.handleListClients(listRec, httptest.NewRequest(http.MethodGet, "/clients?approval=pending", nil))
+	var listed []map[string]interface{}
+	json.Unmarshal(listRec.Body.Bytes(), &listed)
+	if len(listed) != 1 || listed[0]["client_id"] != "contractor-01" || listed[0]["pending_approval"] != true {
+		t.Fatalf("Expected the held backend in ?approval=pending, got %+v", listed)
+	}
+
+	// Re-registering does not release it
+	if rec := postRegistration(server, reg); !routable("existing") || routable("contractor-01") || rec.Code != http.StatusOK {
+		t.Fatalf("Expected a re-registration to stay held, got %d", rec.Code)
+	}
+
+	approve := func(id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.handleClientByID(rec, httptest.NewRequest(http.MethodPost, "/clients/"+id+"/approve", nil))
+		return rec
+	}
+	if rec := approve("contractor-01"); rec.Code != http.StatusOK || !routable("contractor-01") {
+		t.Fatalf("Expected the approved backend to become routable, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var pending int
+	if err := db.QueryRow("SELECT pending_approval FROM clients WHERE client_id = ?", "contractor-01").Scan(&pending); err != nil || pending != 0 {
+		t.Errorf("Expected the approval to be persisted, got %d (%v)", pending, err)
+	}
+	if rec := approve("contractor-01"); rec.Code != http.StatusOK {
+		t.Errorf("Expected approving twice to succeed, got %d", rec.Code)
+	}
+	if rec := approve("unknown"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown backend, got %d", rec.Code)
+	}
+
+	rec = postRegistration(server, reg)
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp["status"] != "registered" || !routable("contractor-01") {
+		t.Errorf("Expected an approved backend to stay approved when it re-registers, got %s", rec.Body.String())
+	}
+}
+
+// TestRegistrationApproval_StaleTakeoverIsHeld verifies an agent taking over the client ID of an approved backend
+// that went stale does not inherit its approval
+func TestRegistrationApproval_StaleTakeoverIsHeld(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.RegistrationApproval.Enabled = true
+	})
+
+	reg := common.ClientRegistration{ClientID: "gpu-01", EndpointURL: "http://10.0.0.9:11000", InstanceID: "agent-1"}
+	postRegistration(server, reg)
+	rec := httptest.NewRecorder()
+	server.handleClientByID(rec, httptest.NewRequest(http.MethodPost, "/clients/gpu-01/approve", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected approval to succeed, got %d", rec.Code)
+	}
+
+	server.mu.Lock()
+	server.clientCache["gpu-01"].LastSeen = time.Now().Add(-time.Hour)
+	server.mu.Unlock()
+
+	takeover := common.ClientRegistration{ClientID: "gpu-01", EndpointURL: "http://10.0.0.66:11000", InstanceID: "agent-2"}
+	rec = postRegistration(server, takeover)
+	var resp map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || resp["status"] != "pending_approval" {
+		t.Fatalf("Expected the takeover to be held for approval, got %d: %s", rec.Code, rec.Body.String())
+	}
+	server.mu.RLock()
+	client := server.clientCache["gpu-01"]
+	held, approvedBy := client.PendingApproval, client.ApprovedBy
+	server.mu.RUnlock()
+	if !held || approvedBy != "" {
+		t.Errorf("Expected the takeover held without the old approval, got pending=%v approved_by=%q", held, approvedBy)
+	}
+}
+
+// TestRegistrationApproval_AutoApproveRules verifies a registration is approved at once when it meets every condition of a rule
+func TestRegistrationApproval_AutoApproveRules(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.RegistrationApproval = common.RegistrationApprovalConfig{
+			Enabled: true,
+			AutoApprove: []common.AutoApproveRule{
+				{Name: "fleet-token", Tokens: []string{"s3cret"}},
+				// httptest requests come from 192.0.2.1
+				{Name: "rack", CIDRs: []string{"192.0.2.0/24"}, Labels: map[string]string{"owner": "infra"}},
+			},
+		}
+	})
+
+	for _, tt := range []struct {
+		id         string
+		reg        common.ClientRegistration
+		approvedBy string
+	}{
+		{"valid-token", common.ClientRegistration{ApprovalToken: "s3cret"}, "auto:fleet-token"},
+		{"wrong-token", common.ClientRegistration{ApprovalToken: "guess"}, ""},
+		{"rack-label", common.ClientRegistration{Labels: map[string]string{"owner": "infra"}}, "auto:rack"},
+		{"other-label", common.ClientRegistration{Labels: map[string]string{"owner": "contractor"}}, ""},
+	} {
+		id := tt.id
+		tt.reg.ClientID, tt.reg.EndpointURL = id, "http://"+id+":11000"
+		if rec := postRegistration(server, tt.reg); rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", id, rec.Code, rec.Body.String())
+		}
+
+		server.mu.RLock()
+		client := server.clientCache[id]
+		pending, approvedBy, token := client.PendingApproval, client.ApprovedBy, client.Registration.ApprovalToken
+		server.mu.RUnlock()
+		if pending != (tt.approvedBy == "") || approvedBy != tt.approvedBy {
+			t.Errorf("%s: expected approved_by %q, got pending=%v approved_by=%q", id, tt.approvedBy, pending, approvedBy)
+		}
+		if token != "" {
+			t.Errorf("%s: expected the approval token not to be kept", id)
+		}
+	}
+}
+
+// TestValidateRegistrationApproval verifies rules need a unique name and at least one valid condition
+func TestValidateRegistrationApproval(t *testing.T) {
+	valid := common.AutoApproveRule{Name: "office", CIDRs: []string{"10.0.0.0/8"}}
+	if err := validateRegistrationApproval(common.RegistrationApprovalConfig{AutoApprove: []common.AutoApproveRule{valid}}); err != nil {
+		t.Errorf("Expected a valid rule, got %v", err)
+	}
+
+	for name, rules := range map[string][]common.AutoApproveRule{
+		"no name":        {{CIDRs: []string{"10.0.0.0/8"}}},
+		"no condition":   {{Name: "open"}},
+		"invalid cidr":   {{Name: "office", CIDRs: []string{"10.0.0.1"}}},
+		"empty token":    {{Name: "token", Tokens: []string{""}}},
+		"duplicate name": {valid, valid},
+	} {
+		if err := validateRegistrationApproval(common.RegistrationApprovalConfig{AutoApprove: rules}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// Autoscale recommendation actions
+const (
+	AutoscaleScaleUp   = "scale_up"   // A tier's spare capacity stayed below min_capacity_sessions
+	AutoscaleScaleDown = "scale_down" // The fleet stayed underutilized; idle backends are nominated for teardown
+)
+
+// AutoscaleRecommendation is one scaling decision, listed by GET /autoscale/recommendations and POSTed to the provisioner
+type AutoscaleRecommendation struct {
+	Action              string    `json:"action"`
+	Tenant              string    `json:"tenant,omitempty"`                // scale_up: the tenant whose tier is short
+	Tier                string    `json:"tier,omitempty"`                  // scale_up: the tier short of capacity
+	CapacitySessions    int       `json:"capacity_sessions"`               // scale_up: new sessions of the tier that fit now
+	MinCapacitySessions int       `json:"min_capacity_sessions,omitempty"` // scale_up: the configured minimum
+	DeficitSessions     int       `json:"deficit_sessions,omitempty"`      // scale_up: sessions missing to reach the minimum
+	ClientIDs           []string  `json:"client_ids,omitempty"`            // scale_down: idle backends to tear down, least loaded first
+	FleetUtilizationPct float64   `json:"fleet_utilization_pct"`
+	Since               time.Time `json:"since"`                 // When the condition started holding
+	NotifiedAt          time.Time `json:"notified_at,omitempty"` // Last autoscale event (and provisioner request unless dry_run)
+}
+
+// teardownCandidate is a live backend with no sticky sessions or pending placements
+type teardownCandidate struct {
+	ClientID string
+	Tenant   string         // Tenant the backend serves (empty = default tenant)
+	Load     float64        // Average CPU usage (percent)
+	Capacity map[string]int // Thresholded tier of its tenant → sessions it could still take, lost if it is torn down
+}
+
+// autoscaleObservation is the fleet state one evaluation decides on
+type autoscaleObservation struct {
+	Tiers        []TierUtilization   // Every tenant's tiers with a min_capacity_sessions threshold
+	Utilization  float64             // Fleet utilization (percent), as used by load shedding
+	LiveBackends int                 // Live, healthy backends
+	Idle         []teardownCandidate // Least loaded first
+}
+
+// Autoscaler turns sustained capacity shortfalls and underutilization into scaling recommendations
+// Conditions must hold for scale_up_after_minutes / scale_down_after_minutes before anything is recommended,
+// and each recommendation is sent at most once per cooldown_minutes, so short spikes never reach the provisioner
+type Autoscaler struct {
+	config common.AutoscaleConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu              sync.Mutex
+	lowSince        map[string]time.Time // Tenant|tier → start of its current shortfall
+	underusedSince  time.Time            // Start of the current underutilized period (zero while busy)
+	notified        map[string]time.Time // Action|tenant|tier → last notification
+	recommendations []AutoscaleRecommendation
+	utilization     float64
+	evaluatedAt     time.Time
+}
+
+// NewAutoscaler creates the autoscaler, or returns nil if autoscaling is disabled
+func NewAutoscaler(config common.AutoscaleConfig) *Autoscaler {
+	if !config.Enabled {
+		return nil
+	}
+	if config.ScaleUpAfterMins <= 0 {
+		config.ScaleUpAfterMins = 5
+	}
+	if config.ScaleDownAfterMins <= 0 {
+		config.ScaleDownAfterMins = 30
+	}
+	if config.MinBackends <= 0 {
+		config.MinBackends = 1
+	}
+	if config.MaxTeardown <= 0 {
+		config.MaxTeardown = 1
+	}
+	if config.CooldownMins <= 0 {
+		config.CooldownMins = 10
+	}
+	timeout := time.Duration(config.ProvisionerTimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &Autoscaler{
+		config:   config,
+		client:   &http.Client{Timeout: timeout},
+		now:      time.Now,
+		lowSince: make(map[string]time.Time),
+		notified: make(map[string]time.Time),
+	}
+}
+
+// autoscaleTierKey identifies a tenant's tier; tenants with their own tiers may reuse global tier names
+func autoscaleTierKey(tenant, tier string) string {
+	return normalizeTenant(tenant) + "|" + tier
+}
+
+// notifyKey identifies a recommendation for its cooldown
+func (rec AutoscaleRecommendation) notifyKey() string {
+	return rec.Action + "|" + rec.Tenant + "|" + rec.Tier
+}
+
+// validateAutoscale checks thresholds name configured tiers (global or a tenant's own) and that a provisioner
+// is set when dry_run is off
+func validateAutoscale(config *common.ServerConfig) error {
+	autoscale := config.Autoscale
+	if !autoscale.Enabled {
+		return nil
+	}
+	tiers := make(map[string]bool, len(config.Tiers))
+	for _, tier := range config.Tiers {
+		tiers[tier.Name] = true
+	}
+	for _, tenant := range config.Tenants {
+		for _, tier := range tenant.Tiers {
+			tiers[tier.Name] = true
+		}
+	}
+	for name, minimum := range autoscale.MinCapacitySessions {
+		if !tiers[name] {
+			return fmt.Errorf("autoscale.min_capacity_sessions: unknown tier %q", name)
+		}
+		if minimum < 1 {
+			return fmt.Errorf("autoscale.min_capacity_sessions: %s must be at least 1", name)
+		}
+	}
+	if autoscale.ScaleDownUtilizationPct < 0 || autoscale.ScaleDownUtilizationPct >= 100 {
+		return fmt.Errorf("autoscale.scale_down_utilization_pct: must be between 0 and 100 (got %g)", autoscale.ScaleDownUtilizationPct)
+	}
+	if autoscale.DryRun {
+		return nil
+	}
+	if autoscale.ProvisionerURL == "" {
+		return fmt.Errorf("autoscale: provisioner_url is required unless dry_run is set")
+	}
+	if u, err := url.Parse(autoscale.ProvisionerURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("autoscale.provisioner_url: %q is not an http(s) URL", autoscale.ProvisionerURL)
+	}
+	return nil
+}
+
+// Evaluate updates the condition timers from an observation and returns the recommendations due to be sent:
+// new ones, and ones whose last notification is older than cooldown_minutes
+func (a *Autoscaler) Evaluate(obs autoscaleObservation) []AutoscaleRecommendation {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	var recommendations []AutoscaleRecommendation
+
+	capacity := make(map[string]int, len(obs.Tiers))
+	for _, tier := range obs.Tiers {
+		key := autoscaleTierKey(tier.Tenant, tier.Name)
+		capacity[key] = tier.CapacitySessions
+		minimum := a.config.MinCapacitySessions[tier.Name]
+		if tier.CapacitySessions >= minimum {
+			delete(a.lowSince, key)
+			continue
+		}
+		since, ok := a.lowSince[key]
+		if !ok {
+			since = now
+			a.lowSince[key] = now
+		}
+		if now.Sub(since) < time.Duration(a.config.ScaleUpAfterMins)*time.Minute {
+			continue
+		}
+		recommendations = append(recommendations, AutoscaleRecommendation{
+			Action:              AutoscaleScaleUp,
+			Tenant:              normalizeTenant(tier.Tenant),
+			Tier:                tier.Name,
+			CapacitySessions:    tier.CapacitySessions,
+			MinCapacitySessions: minimum,
+			DeficitSessions:     minimum - tier.CapacitySessions,
+			FleetUtilizationPct: obs.Utilization,
+			Since:               since,
+		})
+	}
+
+	// Never tear down while any tier is short, and only after utilization stayed low
+	underused := a.config.ScaleDownUtilizationPct > 0 && obs.Utilization < a.config.ScaleDownUtilizationPct && len(a.lowSince) == 0
+	if !underused {
+		a.underusedSince = time.Time{}
+	} else {
+		if a.underusedSince.IsZero() {
+			a.underusedSince = now
+		}
+		if now.Sub(a.underusedSince) >= time.Duration(a.config.ScaleDownAfterMins)*time.Minute {
+			if nominated := a.nominateLocked(obs, capacity); len(nominated) > 0 {
+				recommendations = append(recommendations, AutoscaleRecommendation{
+					Action:              AutoscaleScaleDown,
+					ClientIDs:           nominated,
+					FleetUtilizationPct: obs.Utilization,
+					Since:               a.underusedSince,
+				})
+			}
+		}
+	}
+
+	var due []AutoscaleRecommendation
+	cooldown := time.Duration(a.config.CooldownMins) * time.Minute
+	for i := range recommendations {
+		key := recommendations[i].notifyKey()
+		if last, ok := a.notified[key]; ok && now.Sub(last) < cooldown {
+			recommendations[i].NotifiedAt = last
+			continue
+		}
+		a.notified[key] = now
+		recommendations[i].NotifiedAt = now
+		due = append(due, recommendations[i])
+	}
+
+	a.recommendations = recommendations
+	a.utilization = obs.Utilization
+	a.evaluatedAt = now
+	return due
+}
+
+// nominateLocked picks up to max_teardown idle backends, least loaded first, keeping min_backends live backends
+// and every tenant's thresholded tiers at their min_capacity_sessions without the nominated backends
+func (a *Autoscaler) nominateLocked(obs autoscaleObservation, capacity map[string]int) []string {
+	budget := min(a.config.MaxTeardown, obs.LiveBackends-a.config.MinBackends)
+	var nominated []string
+	for _, candidate := range obs.Idle {
+		if len(nominated) >= budget {
+			break
+		}
+		fits := true
+		for tier, sessions := range candidate.Capacity {
+			key := autoscaleTierKey(candidate.Tenant, tier)
+			if minimum, ok := a.config.MinCapacitySessions[tier]; ok && capacity[key]-sessions < minimum {
+				fits = false
+				break
+			}
+		}
+		if !fits {
+			continue
+		}
+		for tier, sessions := range candidate.Capacity {
+			capacity[autoscaleTierKey(candidate.Tenant, tier)] -= sessions
+		}
+		nominated = append(nominated, candidate.ClientID)
+	}
+	return nominated
+}
+
+// retry forgets a recommendation's last notification so the next evaluation sends it again
+func (a *Autoscaler) retry(rec AutoscaleRecommendation) {
+	a.mu.Lock()
+	delete(a.notified, rec.notifyKey())
+	a.mu.Unlock()
+}
+
+// request POSTs a recommendation to the provisioner, signed like webhook deliveries
+func (a *Autoscaler) request(rec AutoscaleRecommendation) error {
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, a.config.ProvisionerURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, "autoscale."+rec.Action)
+	if a.config.ProvisionerSecret != "" {
+		req.Header.Set(WebhookSignatureHeader, webhookSignature(a.config.ProvisionerSecret, body))
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("provisioner returned %s", resp.Status)
+	}
+	return nil
+}
+
+// autoscaleObservationLocked collects the fleet state for the autoscaler (caller must hold s.mu)
+// Each tenant's thresholded tiers are measured on its own backends, with the same eligibility as GET /tiers;
+// idle backends hold no sticky sessions or pending placements
+func (s *Server) autoscaleObservationLocked() autoscaleObservation {
+	obs := autoscaleObservation{Utilization: s.fleetUtilizationLocked()}
+
+	tierSets := s.tenantTierSetsLocked()
+	tenants := make([]string, 0, len(tierSets))
+	for tenant := range tierSets {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+
+	thresholded := make(map[string][]common.TierSpec, len(tierSets))
+	for _, tenant := range tenants {
+		var specs []common.TierSpec
+		for name := range s.config.Autoscale.MinCapacitySessions {
+			if spec, ok := tierSets[tenant][name]; ok {
+				spec.Tenant = tenant
+				specs = append(specs, spec)
+			}
+		}
+		sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+		thresholded[tenant] = specs
+		obs.Tiers = append(obs.Tiers, s.tierUtilizationLocked(specs, tenant)...)
+	}
+
+	busy := make(map[string]bool)
+	for _, tierMap := range s.stickyAssignments {
+		for _, clientID := range tierMap {
+			busy[clientID] = true
+		}
+	}
+	now := time.Now()
+	for clientID, allocations := range s.pendingAllocations {
+		for _, pending := range allocations {
+			if !pending.expired(now) {
+				busy[clientID] = true
+				break
+			}
+		}
+	}
+
+	for id, client := range s.clientCache {
+		if !s.routable(client) {
+			continue
+		}
+		obs.LiveBackends++
+		if busy[id] {
+			continue
+		}
+
+		tenant := normalizeTenant(client.Registration.Tenant)
+		candidate := teardownCandidate{ClientID: id, Tenant: tenant, Capacity: make(map[string]int)}
+		for _, usage := range client.Stats.CPUUsageAvg {
+			candidate.Load += usage
+		}
+		if cores := len(client.Stats.CPUUsageAvg); cores > 0 {
+			candidate.Load /= float64(cores)
+		}
+		for _, spec := range thresholded[tenant] {
+			if s.hasResourcesLocked(client, spec) {
+				candidate.Capacity[spec.Name] = s.tierCapacityLocked(client, spec)
+			}
+		}
+		obs.Idle = append(obs.Idle, candidate)
+	}
+	sort.Slice(obs.Idle, func(i, j int) bool {
+		if obs.Idle[i].Load != obs.Idle[j].Load {
+			return obs.Idle[i].Load < obs.Idle[j].Load
+		}
+		return obs.Idle[i].ClientID < obs.Idle[j].ClientID
+	})
+	return obs
+}
+
+// evaluateAutoscale runs one autoscaler evaluation and sends the recommendations that are due
+func (s *Server) evaluateAutoscale() {
+	s.mu.RLock()
+	obs := s.autoscaleObservationLocked()
+	s.mu.RUnlock()
+
+	dryRun := s.config.Autoscale.DryRun
+	for _, rec := range s.autoscaler.Evaluate(obs) {
+		data := map[string]interface{}{
+			"action":            rec.Action,
+			"fleet_utilization": fmt.Sprintf("%.1f%%", rec.FleetUtilizationPct),
+			"since":             rec.Since,
+			"dry_run":           dryRun,
+		}
+		if rec.Action == AutoscaleScaleUp {
+			data["tenant"] = rec.Tenant
+			data["tier"] = rec.Tier
+			data["capacity_sessions"] = rec.CapacitySessions
+			data["min_capacity_sessions"] = rec.MinCapacitySessions
+			data["deficit_sessions"] = rec.DeficitSessions
+			LogWarnWithData("Autoscaler recommends adding backends", data)
+		} else {
+			data["client_ids"] = rec.ClientIDs
+			LogInfoWithData("Autoscaler nominates idle backends for teardown", data)
+		}
+		s.emit("autoscale."+rec.Action, data)
+
+		if dryRun {
+			continue
+		}
+		go func(rec AutoscaleRecommendation) {
+			if err := s.autoscaler.request(rec); err != nil {
+				s.autoscaler.retry(rec)
+				LogWarnWithData("Autoscale provisioner request failed", map[string]interface{}{
+					"action": rec.Action,
+					"tenant": rec.Tenant,
+					"tier":   rec.Tier,
+					"url":    s.config.Autoscale.ProvisionerURL,
+					"error":  err.Error(),
+				})
+			}
+		}(rec)
+	}
+}
+
+// runAutoscaler evaluates scaling recommendations on an interval
+func (s *Server) runAutoscaler(ctx context.Context) {
+	interval := time.Duration(s.config.Autoscale.EvaluateIntervalSecs) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.evaluateAutoscale()
+		}
+	}
+}
+
+// handleAutoscaleRecommendations handles GET /autoscale/recommendations: the decisions of the last evaluation
+func (s *Server) handleAutoscaleRecommendations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.autoscaler == nil {
+		http.Error(w, "Autoscaling is not enabled", http.StatusNotFound)
+		return
+	}
+
+	s.autoscaler.mu.Lock()
+	recommendations := append([]AutoscaleRecommendation{}, s.autoscaler.recommendations...)
+	utilization, evaluatedAt := s.autoscaler.utilization, s.autoscaler.evaluatedAt
+	s.autoscaler.mu.Unlock()
+
+	response := map[string]interface{}{
+		"dry_run":               s.config.Autoscale.DryRun,
+		"fleet_utilization_pct": utilization,
+		"recommendations":       recommendations,
+	}
+	if !evaluatedAt.IsZero() {
+		response["evaluated_at"] = evaluatedAt
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Warning: Failed to encode autoscale recommendations: %v", err)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+func newTestAutoscaler(config common.AutoscaleConfig) (*Autoscaler, *time.Time) {
+	config.Enabled = true
+	autoscaler := NewAutoscaler(config)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	autoscaler.now = func() time.Time { return now }
+	return autoscaler, &now
+}
+
+// TestAutoscaler_ScaleUpAfterSustainedShortfall verifies scale-up is recommended only once a shortfall
+// outlasts scale_up_after_minutes, and is sent again only after the cooldown
+func TestAutoscaler_ScaleUpAfterSustainedShortfall(t *testing.T) {
+	autoscaler, now := newTestAutoscaler(common.AutoscaleConfig{
+		MinCapacitySessions: map[string]int{"pro-max": 4},
+		ScaleUpAfterMins:    5,
+		CooldownMins:        10,
+	})
+	short := autoscaleObservation{Tiers: []TierUtilization{{TierSpec: common.TierSpec{Name: "pro-max"}, CapacitySessions: 1}}, Utilization: 90}
+
+	if due := autoscaler.Evaluate(short); len(due) != 0 {
+		t.Fatalf("Expected no recommendation when the shortfall starts, got %+v", due)
+	}
+	*now = now.Add(4 * time.Minute)
+	if due := autoscaler.Evaluate(short); len(due) != 0 {
+		t.Fatalf("Expected no recommendation before scale_up_after_minutes, got %+v", due)
+	}
+
+	*now = now.Add(time.Minute)
+	due := autoscaler.Evaluate(short)
+	if len(due) != 1 {
+		t.Fatalf("Expected one scale-up recommendation, got %+v", due)
+	}
+	if rec := due[0]; rec.Action != AutoscaleScaleUp || rec.Tier != "pro-max" || rec.DeficitSessions != 3 || rec.MinCapacitySessions != 4 {
+		t.Errorf("Unexpected recommendation: %+v", rec)
+	}
+
+	*now = now.Add(time.Minute)
+	if due := autoscaler.Evaluate(short); len(due) != 0 {
+		t.Errorf("Expected the cooldown to hold back a repeat, got %+v", due)
+	}
+	if len(autoscaler.recommendations) != 1 {
+		t.Errorf("Expected the recommendation to stay listed during the cooldown, got %+v", autoscaler.recommendations)
+	}
+
+	recovered := autoscaleObservation{Tiers: []TierUtilization{{TierSpec: common.TierSpec{Name: "pro-max"}, CapacitySessions: 4}}, Utilization: 90}
+	autoscaler.Evaluate(recovered)
+	if len(autoscaler.recommendations) != 0 || len(autoscaler.lowSince) != 0 {
+		t.Errorf("Expected the recommendation to clear once capacity recovered, got %+v", autoscaler.recommendations)
+	}
+}
+
+// TestAutoscaler_NominatesIdleBackends verifies teardown nominations keep min_backends and every tier's minimum capacity
+func TestAutoscaler_NominatesIdleBackends(t *testing.T) {
+	autoscaler, now := newTestAutoscaler(common.AutoscaleConfig{
+		MinCapacitySessions:     map[string]int{"lite": 4},
+		ScaleDownUtilizationPct: 20,
+		ScaleDownAfterMins:      30,
+		MinBackends:             2,
+		MaxTeardown:             3,
+	})
+	obs := autoscaleObservation{
+		Tiers:        []TierUtilization{{TierSpec: common.TierSpec{Name: "lite"}, CapacitySessions: 10}},
+		Utilization:  5,
+		LiveBackends: 5,
+		Idle: []teardownCandidate{
+			{ClientID: "big", Load: 1, Capacity: map[string]int{"lite": 7}},
+			{ClientID: "small-a", Load: 2, Capacity: map[string]int{"lite": 2}},
+			{ClientID: "small-b", Load: 3, Capacity: map[string]int{"lite": 2}},
+			{ClientID: "small-c", Load: 4, Capacity: map[string]int{"lite": 3}},
+		},
+	}
+
+	autoscaler.Evaluate(obs)
+	*now = now.Add(29 * time.Minute)
+	if due := autoscaler.Evaluate(obs); len(due) != 0 {
+		t.Fatalf("Expected no nomination before scale_down_after_minutes, got %+v", due)
+	}
+
+	*now = now.Add(time.Minute)
+	due := autoscaler.Evaluate(obs)
+	if len(due) != 1 || due[0].Action != AutoscaleScaleDown {
+		t.Fatalf("Expected one scale-down recommendation, got %+v", due)
+	}
+	// "big" would leave lite below 4 sessions; 5 live backends minus min_backends allows 3, capacity allows 2
+	if ids := due[0].ClientIDs; len(ids) != 2 || ids[0] != "small-a" || ids[1] != "small-b" {
+		t.Errorf("Expected small-a and small-b to be nominated, got %v", ids)
+	}
+
+	obs.Utilization = 50
+	autoscaler.Evaluate(obs)
+	if len(autoscaler.recommendations) != 0 || !autoscaler.underusedSince.IsZero() {
+		t.Errorf("Expected busy fleet to reset the scale-down timer, got %+v", autoscaler.recommendations)
+	}
+}
+
+// TestAutoscale_RecommendationsEndpoint verifies a dry-run evaluation of the live fleet is listed by GET /autoscale/recommendations
+func TestAutoscale_RecommendationsEndpoint(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.Autoscale = common.AutoscaleConfig{
+			Enabled:             true,
+			DryRun:              true,
+			MinCapacitySessions: map[string]int{"pro-max": 3},
+			ScaleUpAfterMins:    5,
+		}
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-a"}))
+	events, _ := server.events.subscribe(nil, 0)
+	defer server.events.unsubscribe(events)
+
+	now := time.Now()
+	server.autoscaler.now = func() time.Time { return now }
+	server.evaluateAutoscale()
+	now = now.Add(5 * time.Minute)
+	server.evaluateAutoscale()
+
+	rec := httptest.NewRecorder()
+	server.handleAutoscaleRecommendations(rec, httptest.NewRequest("GET", "/autoscale/recommendations", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		DryRun          bool                      `json:"dry_run"`
+		Recommendations []AutoscaleRecommendation `json:"recommendations"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !resp.DryRun || len(resp.Recommendations) != 1 {
+		t.Fatalf("Expected one dry-run recommendation, got %+v", resp)
+	}
+	if r := resp.Recommendations[0]; r.Action != AutoscaleScaleUp || r.Tier != "pro-max" || r.CapacitySessions != 1 || r.DeficitSessions != 2 {
+		t.Errorf("Unexpected recommendation: %+v", r)
+	}
+
+	select {
+	case event := <-events.events:
+		if event.Event != "autoscale.scale_up" {
+			t.Errorf("Expected an autoscale.scale_up event, got %s", event.Event)
+		}
+	default:
+		t.Error("Expected an autoscale.scale_up event")
+	}
+}
+
+// TestAutoscale_TenantTiers verifies every tenant's thresholded tiers are measured on its own backends,
+// including tiers a tenant defines itself
+func TestAutoscale_TenantTiers(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.Tenants = []common.TenantConfig{
+			{Name: "team-a", Tiers: []common.TierSpec{{Name: "pro-max", VCPU: 64, MemoryGB: 512, StorageGB: 10}}},
+			{Name: "team-b"},
+		}
+		c.Autoscale = common.AutoscaleConfig{
+			Enabled:             true,
+			DryRun:              true,
+			MinCapacitySessions: map[string]int{"pro-max": 1},
+			ScaleUpAfterMins:    5,
+		}
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "default-backend"}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "a-backend", Endpoint: "http://10.0.0.2:11000", Tenant: "team-a"}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "b-backend", Endpoint: "http://10.0.0.3:11000", Tenant: "team-b"}))
+
+	server.mu.RLock()
+	obs := server.autoscaleObservationLocked()
+	server.mu.RUnlock()
+	if len(obs.Tiers) != 3 {
+		t.Fatalf("Expected pro-max measured for each of the 3 tenants, got %+v", obs.Tiers)
+	}
+
+	now := time.Now()
+	server.autoscaler.now = func() time.Time { return now }
+	server.evaluateAutoscale()
+	now = now.Add(5 * time.Minute)
+	server.evaluateAutoscale()
+
+	recommendations := server.autoscaler.recommendations
+	if len(recommendations) != 1 {
+		t.Fatalf("Expected one scale-up recommendation, got %+v", recommendations)
+	}
+	if rec := recommendations[0]; rec.Tenant != "team-a" || rec.Tier != "pro-max" || rec.CapacitySessions != 0 {
+		t.Errorf("Expected team-a's own pro-max tier to be short, got %+v", rec)
+	}
+}
+
+// TestAutoscale_ProvisionerRequest verifies recommendations are POSTed, signed, to the provisioner when dry_run is off
+func TestAutoscale_ProvisionerRequest(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	provisioner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer provisioner.Close()
+
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.Autoscale = common.AutoscaleConfig{
+			Enabled:             true,
+			MinCapacitySessions: map[string]int{"pro-max": 3},
+			ScaleUpAfterMins:    1,
+			ProvisionerURL:      provisioner.URL,
+			ProvisionerSecret:   "provisioner-secret",
+		}
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-a"}))
+
+	now := time.Now()
+	server.autoscaler.now = func() time.Time { return now }
+	server.evaluateAutoscale()
+	now = now.Add(time.Minute)
+	server.evaluateAutoscale()
+
+	select {
+	case r := <-received:
+		body := <-bodies
+		if r.Header.Get(WebhookEventHeader) != "autoscale.scale_up" {
+			t.Errorf("Expected event header autoscale.scale_up, got %q", r.Header.Get(WebhookEventHeader))
+		}
+		if r.Header.Get(WebhookSignatureHeader) != webhookSignature("provisioner-secret", body) {
+			t.Error("Expected the request to be signed with provisioner_secret")
+		}
+		var rec AutoscaleRecommendation
+		if err := json.Unmarshal(body, &rec); err != nil || rec.Tier != "pro-max" || rec.DeficitSessions != 2 {
+			t.Errorf("Unexpected provisioner body %s (%v)", body, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a provisioner request")
+	}
+}
+
+// TestValidateAutoscale verifies thresholds name configured tiers and a provisioner is required outside dry-run
+func TestValidateAutoscale(t *testing.T) {
+	config := &common.ServerConfig{Tiers: []common.TierSpec{{Name: "lite"}}}
+	config.Autoscale = common.AutoscaleConfig{Enabled: true, DryRun: true, MinCapacitySessions: map[string]int{"lite": 2}}
+	if err := validateAutoscale(config); err != nil {
+		t.Errorf("Expected a valid dry-run config, got %v", err)
+	}
+
+	config.Autoscale.MinCapacitySessions = map[string]int{"pro-turbo": 2}
+	if err := validateAutoscale(config); err == nil {
+		t.Error("Expected an unknown tier to be rejected")
+	}
+	config.Tenants = []common.TenantConfig{{Name: "team-a", Tiers: []common.TierSpec{{Name: "pro-turbo"}}}}
+	if err := validateAutoscale(config); err != nil {
+		t.Errorf("Expected a tier defined by a tenant to be accepted, got %v", err)
+	}
+
+	config.Autoscale.MinCapacitySessions = nil
+	config.Autoscale.DryRun = false
+	if err := validateAutoscale(config); err == nil {
+		t.Error("Expected a missing provisioner_url to be rejected outside dry-run")
+	}
+	config.Autoscale.ProvisionerURL = "ftp://provisioner"
+	if err := validateAutoscale(config); err == nil {
+		t.Error("Expected a non-http provisioner_url to be rejected")
+	}
+	config.Autoscale.ProvisionerURL = "https://provisioner.internal/scale"
+	if err := validateAutoscale(config); err != nil {
+		t.Errorf("Expected a valid provisioner config, got %v", err)
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"cyqle.in/opsen/common"
+)
+
+// backupStepPages is how many pages are copied per backup step
+// Writers are only blocked while a step runs, so live traffic continues during large backups
+const backupStepPages = 1024
+
+// backupFilePrefix and backupFileSuffix name backups in backup.dir: opsen-20060102T150405Z.db
+const (
+	backupFilePrefix = "opsen-"
+	backupFileSuffix = ".db"
+)
+
+// backupDatabase copies db into destPath with the SQLite online backup API and verifies the copy
+// The snapshot is written to a temp file and renamed into place, so destPath is never a partial backup
+func backupDatabase(ctx context.Context, db *sql.DB, destPath string) error {
+	tmpPath := destPath + ".partial"
+	os.Remove(tmpPath)
+	defer os.Remove(tmpPath) // No-op once renamed into place
+
+	dest, err := sql.Open("sqlite3", tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create backup: %w", err)
+	}
+	defer dest.Close()
+
+	srcConn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire database connection: %w", err)
+	}
+	defer srcConn.Close()
+
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer destConn.Close()
+
+	err = destConn.Raw(func(destDriver interface{}) error {
+		return srcConn.Raw(func(srcDriver interface{}) error {
+			destSQLite, ok1 := destDriver.(*sqlite3.SQLiteConn)
+			srcSQLite, ok2 := srcDriver.(*sqlite3.SQLiteConn)
+			if !ok1 || !ok2 {
+				return fmt.Errorf("online backup requires the sqlite3 driver")
+			}
+			return copyDatabase(ctx, destSQLite, srcSQLite)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	// A backup that fails its integrity check is worse than none: it would only be found at restore time
+	var result string
+	if err := destConn.QueryRowContext(ctx, "PRAGMA quick_check").Scan(&result); err != nil {
+		return fmt.Errorf("failed to verify backup: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("backup failed integrity check: %s", result)
+	}
+
+	destConn.Close()
+	if err := dest.Close(); err != nil {
+		return fmt.Errorf("failed to close backup: %w", err)
+	}
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		return fmt.Errorf("failed to install backup: %w", err)
+	}
+	return nil
+}
+
+// copyDatabase runs the backup in steps until every page has been copied
+// If the source changes between steps SQLite restarts the copy, so the result is always a consistent snapshot
+func copyDatabase(ctx context.Context, dest, src *sqlite3.SQLiteConn) error {
+	backup, err := dest.Backup("main", src, "main")
+	if err != nil {
+		return fmt.Errorf("failed to start backup: %w", err)
+	}
+
+	for {
+		done, err := backup.Step(backupStepPages)
+		if err != nil {
+			var sqliteErr sqlite3.Error
+			if !errors.As(err, &sqliteErr) || (sqliteErr.Code != sqlite3.ErrBusy && sqliteErr.Code != sqlite3.ErrLocked) {
+				backup.Close()
+				return fmt.Errorf("backup step failed: %w", err)
+			}
+		}
+		if done {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			backup.Close()
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if err := backup.Finish(); err != nil {
+		return fmt.Errorf("failed to finish backup: %w", err)
+	}
+	return nil
+}
+
+// createBackup writes a timestamped backup to backup.dir and prunes old ones
+func (s *Server) createBackup(ctx context.Context) (string, error) {
+	dir := s.config.Backup.Dir
+	if dir == "" {
+		return "", fmt.Errorf("backup.dir is not configured")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	name := backupFilePrefix + time.Now().UTC().Format("20060102T150405Z") + backupFileSuffix
+	path := filepath.Join(dir, name)
+	if err := backupDatabase(ctx, s.db, path); err != nil {
+		return "", err
+	}
+
+	pruneBackups(dir, s.config.Backup.Keep)
+	return path, nil
+}
+
+// pruneBackups deletes all but the newest keep backups in dir (keep <= 0 keeps everything)
+// Only files named by createBackup are considered
+func pruneBackups(dir string, keep int) []string {
+	if keep <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, backupFilePrefix) && strings.HasSuffix(name, backupFileSuffix) {
+			backups = append(backups, name)
+		}
+	}
+	if len(backups) <= keep {
+		return nil
+	}
+
+	// Timestamped names sort chronologically
+	sort.Strings(backups)
+	var removed []string
+	for _, name := range backups[:len(backups)-keep] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			LogWarn(fmt.Sprintf("Failed to remove old backup %s: %v", name, err))
+			continue
+		}
+		removed = append(removed, name)
+	}
+	return removed
+}
+
+// runScheduledBackups writes a backup every backup.interval_hours until ctx is cancelled
+func (s *Server) runScheduledBackups(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(s.config.Backup.IntervalHours) * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			path, err := s.createBackup(ctx)
+			if err != nil {
+				LogWarnWithData("Scheduled database backup failed", map[string]interface{}{
+					"dir":   s.config.Backup.Dir,
+					"error": err.Error(),
+				})
+				continue
+			}
+			LogInfoWithData("Database backup written", map[string]interface{}{
+				"path":        path,
+				"duration_ms": time.Since(start).Milliseconds(),
+			})
+		}
+	}
+}
+
+// validateBackupConfig checks backup settings at startup
+func validateBackupConfig(config common.BackupConfig) error {
+	if config.IntervalHours < 0 || config.Keep < 0 {
+		return fmt.Errorf("backup.interval_hours and backup.keep must not be negative")
+	}
+	if config.IntervalHours > 0 && config.Dir == "" {
+		return fmt.Errorf("backup.interval_hours requires backup.dir")
+	}
+	return nil
+}
+
+// handleBackup takes a consistent database snapshot (POST)
+// By default the backup is written to backup.dir; ?download=true (or no backup.dir) streams it instead
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Query().Get("download") == "true" || s.config.Backup.Dir == "" {
+		s.streamBackup(w, r)
+		return
+	}
+
+	start := time.Now()
+	path, err := s.createBackup(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Backup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	size := int64(0)
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+
+	LogInfoWithData("Database backup written", map[string]interface{}{
+		"path":        path,
+		"bytes":       size,
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "completed",
+		"path":        path,
+		"bytes":       size,
+		"duration_ms": time.Since(start).Milliseconds(),
+	}); err != nil {
+		log.Printf("Warning: Failed to encode backup response: %v", err)
+	}
+}
+
+// streamBackup snapshots the database to a temp file and sends it as the response body
+func (s *Server) streamBackup(w http.ResponseWriter, r *http.Request) {
+	tmpDir, err := os.MkdirTemp("", "opsen-backup-*")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Backup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	name := backupFilePrefix + time.Now().UTC().Format("20060102T150405Z") + backupFileSuffix
+	path := filepath.Join(tmpDir, name)
+	if err := backupDatabase(r.Context(), s.db, path); err != nil {
+		http.Error(w, fmt.Sprintf("Backup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Backup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Backup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Content-Length", fmt.Sprint(info.Size()))
+	if _, err := io.Copy(w, file); err != nil {
+		log.Printf("Warning: Failed to stream backup: %v", err)
+	}
+}
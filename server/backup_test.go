@@ -0,0 +1,107 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// countBackupRows opens a backup file and counts rows in a table
+func countBackupRows(t *testing.T, path, table string) int {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Failed to open backup: %v", err)
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+		t.Fatalf("Failed to query backup: %v", err)
+	}
+	return count
+}
+
+// TestHandleBackup_WritesToDir verifies POST /admin/backup writes a consistent snapshot and prunes old ones
+func TestHandleBackup_WritesToDir(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	dir := t.TempDir()
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.Backup = common.BackupConfig{Dir: dir, Keep: 2}
+	})
+	server.createStickyAssignment("user-1", "lite", "backend-a")
+
+	// Older backups beyond keep are pruned; unrelated files are left alone
+	for _, name := range []string{"opsen-20200101T000000Z.db", "opsen-20200102T000000Z.db", "notes.txt"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("old"), 0600)
+	}
+
+	rec := httptest.NewRecorder()
+	server.handleBackup(rec, httptest.NewRequest("POST", "/admin/backup", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected backup to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	path, _ := response["path"].(string)
+	if filepath.Dir(path) != dir || response["bytes"].(float64) <= 0 {
+		t.Fatalf("Unexpected backup response: %v", response)
+	}
+	if count := countBackupRows(t, path, "sticky_assignments"); count != 1 {
+		t.Errorf("Expected 1 sticky assignment in backup, got %d", count)
+	}
+
+	for _, name := range []string{"opsen-20200101T000000Z.db"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be pruned", name)
+		}
+	}
+	for _, name := range []string{"opsen-20200102T000000Z.db", "notes.txt", filepath.Base(path)} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s to be kept: %v", name, err)
+		}
+	}
+}
+
+// TestHandleBackup_Download verifies the snapshot is streamed when requested or no dir is configured
+func TestHandleBackup_Download(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	server.createStickyAssignment("user-1", "lite", "backend-a")
+
+	rec := httptest.NewRecorder()
+	server.handleBackup(rec, httptest.NewRequest("POST", "/admin/backup", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected backup download to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Type") != "application/vnd.sqlite3" {
+		t.Errorf("Expected sqlite content type, got %q", rec.Header().Get("Content-Type"))
+	}
+
+	path := filepath.Join(t.TempDir(), "restored.db")
+	if err := os.WriteFile(path, rec.Body.Bytes(), 0600); err != nil {
+		t.Fatalf("Failed to write download: %v", err)
+	}
+	if count := countBackupRows(t, path, "sticky_assignments"); count != 1 {
+		t.Errorf("Expected 1 sticky assignment in downloaded backup, got %d", count)
+	}
+
+	rec = httptest.NewRecorder()
+	server.handleBackup(rec, httptest.NewRequest("GET", "/admin/backup", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+
+	"cyqle.in/opsen/common"
+)
+
+// maxBandwidthTestBytes bounds a single /bandwidth download
+const maxBandwidthTestBytes = 64 << 20
+
+// bandwidthTestBlock is repeated to fill downloads; random so compression on the path can't inflate the result
+var bandwidthTestBlock = func() []byte {
+	block := make([]byte, 64<<10)
+	rand.New(rand.NewSource(1)).Read(block)
+	return block
+}()
+
+// handleBandwidth serves agent link tests: GET /bandwidth?bytes=N downloads N bytes, POST uploads a body
+// that is discarded. A GET without bytes is the round-trip probe
+func (s *Server) handleBandwidth(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		size := 0
+		if raw := r.URL.Query().Get("bytes"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 || n > maxBandwidthTestBytes {
+				http.Error(w, fmt.Sprintf("bytes must be between 0 and %d", maxBandwidthTestBytes), http.StatusBadRequest)
+				return
+			}
+			size = n
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		w.Header().Set("Cache-Control", "no-store")
+		for size > 0 {
+			chunk := bandwidthTestBlock[:min(size, len(bandwidthTestBlock))]
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			size -= len(chunk)
+		}
+
+	case http.MethodPost:
+		received, err := io.Copy(io.Discard, r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to read request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]int64{"received": received}); err != nil {
+			log.Printf("Warning: Failed to encode bandwidth response: %v", err)
+		}
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// backendBandwidthMbps returns the slowest direction a backend measured on any target at registration
+// Returns false if the agent ran no successful test
+func backendBandwidthMbps(reg common.ClientRegistration) (float64, bool) {
+	slowest, ok := 0.0, false
+	for _, m := range reg.Bandwidth {
+		if m.Error != "" {
+			continue
+		}
+		for _, mbps := range []float64{m.DownloadMbps, m.UploadMbps} {
+			if mbps > 0 && (!ok || mbps < slowest) {
+				slowest, ok = mbps, true
+			}
+		}
+	}
+	return slowest, ok
+}
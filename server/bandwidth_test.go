@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestHandleBandwidth verifies downloads return the requested size and uploads are drained
+func TestHandleBandwidth(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	rec := httptest.NewRecorder()
+	server.handleBandwidth(rec, httptest.NewRequest("GET", "/bandwidth?bytes=200000", nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() != 200000 {
+		t.Errorf("Expected 200000 bytes, got %d with status %d", rec.Body.Len(), rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	server.handleBandwidth(rec, httptest.NewRequest("POST", "/bandwidth", bytes.NewReader(make([]byte, 5000))))
+	var resp map[string]int64
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp["received"] != 5000 {
+		t.Errorf("Expected 5000 bytes received, got %v", resp)
+	}
+
+	for _, size := range []string{"-1", "abc", "999999999999"} {
+		rec = httptest.NewRecorder()
+		server.handleBandwidth(rec, httptest.NewRequest("GET", "/bandwidth?bytes="+size, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for bytes=%s, got %d", size, rec.Code)
+		}
+	}
+}
+
+// TestMinBandwidth_SkipsThinUplinks verifies data-heavy tiers skip backends whose link tested slow,
+// while untested backends still qualify
+func TestMinBandwidth_SkipsThinUplinks(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.Tiers = append(c.Tiers, common.TierSpec{Name: "media", VCPU: 1, MemoryGB: 1.0, StorageGB: 5, MinBandwidthMbps: 100})
+	})
+
+	edge := NewMockClient(MockClientOptions{ClientID: "edge", CPUUsageAvg: []float64{5, 5, 5, 5, 5, 5, 5, 5}})
+	edge.Registration.Bandwidth = []common.BandwidthMeasurement{
+		{Target: common.BandwidthTargetServer, DownloadMbps: 400, UploadMbps: 20, MeasuredAt: time.Now()},
+	}
+	core := NewMockClient(MockClientOptions{ClientID: "core", CPUUsageAvg: []float64{30, 30, 30, 30, 30, 30, 30, 30}})
+	core.Registration.Bandwidth = []common.BandwidthMeasurement{
+		{Target: common.BandwidthTargetServer, DownloadMbps: 900, UploadMbps: 800, MeasuredAt: time.Now()},
+		{Target: "https://speed.example.com/4mb", Error: "i/o timeout", MeasuredAt: time.Now()},
+	}
+	server.AddMockClient(edge)
+	server.AddMockClient(core)
+
+	AssertClientSelected(t, server.findBestClient(server.tierSpecs["media"], 0, 0), "core")
+	AssertClientSelected(t, server.findBestClient(server.tierSpecs["lite"], 0, 0), "edge")
+
+	if _, ok := backendBandwidthMbps(common.ClientRegistration{}); ok {
+		t.Error("Expected untested backends to report no bandwidth")
+	}
+}
+
+// TestBandwidth_PersistedWithRegistration verifies measurements survive a server restart
+func TestBandwidth_PersistedWithRegistration(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	reg := common.ClientRegistration{ClientID: "edge-1", EndpointURL: "http://10.0.0.1:11000",
+		Bandwidth: []common.BandwidthMeasurement{{Target: common.BandwidthTargetServer, RTTMs: 42, DownloadMbps: 80, UploadMbps: 12}}}
+	if rec := postRegistration(server, reg); rec.Code != http.StatusOK {
+		t.Fatalf("Expected registration to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	restarted := NewTestServer(t, db)
+	if err := restarted.loadClients(); err != nil {
+		t.Fatalf("Failed to load clients: %v", err)
+	}
+	restarted.mu.RLock()
+	defer restarted.mu.RUnlock()
+	if got := restarted.clientCache["edge-1"].Registration.Bandwidth; len(got) != 1 || got[0].UploadMbps != 12 || got[0].RTTMs != 42 {
+		t.Errorf("Expected the measurement to be loaded, got %+v", got)
+	}
+}
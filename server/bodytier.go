@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// bodyRoutingFields are the routing fields a proxied request body can carry
+type bodyRoutingFields struct {
+	Tier      string
+	ClientLat float64
+	ClientLon float64
+}
+
+// bodyExtractor reads routing fields from a buffered request body of one media type
+// params are the Content-Type parameters (e.g. the multipart boundary); tierField is tier_field_name
+type bodyExtractor func(body []byte, params map[string]string, tierField string) bodyRoutingFields
+
+// bodyExtractors maps media types to their extractor; support for another format is one entry here
+// Bodies of other types (protobuf, gRPC, octet streams) are not parsed: those requests route by
+// query parameter or header only, without a JSON decode attempt on binary data
+var bodyExtractors = map[string]bodyExtractor{
+	"application/json":                  extractJSONBody,
+	"application/x-www-form-urlencoded": extractFormBody,
+	"multipart/form-data":               extractMultipartBody,
+}
+
+// maxMultipartFieldBytes bounds how much of a multipart field is read when looking for routing fields
+const maxMultipartFieldBytes = 1024
+
+// extractBodyRoutingFields picks the extractor for a request's Content-Type
+// Requests without one are tried as JSON, as they always were; structured +json types use the JSON extractor
+func extractBodyRoutingFields(contentType string, body []byte, tierField string) bodyRoutingFields {
+	mediaType, params := "application/json", map[string]string(nil)
+	if contentType != "" {
+		parsed, parsedParams, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return bodyRoutingFields{}
+		}
+		mediaType, params = parsed, parsedParams
+		if strings.HasSuffix(mediaType, "+json") {
+			mediaType = "application/json"
+		}
+	}
+	extractor, ok := bodyExtractors[mediaType]
+	if !ok {
+		return bodyRoutingFields{}
+	}
+	return extractor(body, params, tierField)
+}
+
+func extractJSONBody(body []byte, _ map[string]string, tierField string) bodyRoutingFields {
+	var fields bodyRoutingFields
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err == nil {
+		fields.Tier, _ = payload[tierField].(string)
+		fields.ClientLat, _ = payload["client_lat"].(float64)
+		fields.ClientLon, _ = payload["client_lon"].(float64)
+	}
+	return fields
+}
+
+func extractFormBody(body []byte, _ map[string]string, tierField string) bodyRoutingFields {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return bodyRoutingFields{}
+	}
+	return formRoutingFields(values.Get, tierField)
+}
+
+// extractMultipartBody reads the routing fields from form fields, skipping file parts
+func extractMultipartBody(body []byte, params map[string]string, tierField string) bodyRoutingFields {
+	boundary := params["boundary"]
+	if boundary == "" {
+		return bodyRoutingFields{}
+	}
+	values := make(map[string]string)
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		name := part.FormName()
+		if part.FileName() == "" && (name == tierField || name == "client_lat" || name == "client_lon") {
+			if _, seen := values[name]; !seen {
+				value, _ := io.ReadAll(io.LimitReader(part, maxMultipartFieldBytes))
+				values[name] = string(value)
+			}
+		}
+		part.Close()
+	}
+	return formRoutingFields(func(name string) string { return values[name] }, tierField)
+}
+
+func formRoutingFields(get func(string) string, tierField string) bodyRoutingFields {
+	fields := bodyRoutingFields{Tier: get(tierField)}
+	fields.ClientLat, _ = strconv.ParseFloat(get("client_lat"), 64)
+	fields.ClientLon, _ = strconv.ParseFloat(get("client_lon"), 64)
+	return fields
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"testing"
+)
+
+// TestExtractBodyRoutingFields verifies the tier and location are read from JSON, form and multipart bodies
+// and that binary bodies are not parsed
+func TestExtractBodyRoutingFields(t *testing.T) {
+	var multipartBody bytes.Buffer
+	writer := multipart.NewWriter(&multipartBody)
+	file, _ := writer.CreateFormFile("tier", "tier.txt")
+	file.Write([]byte("from-file"))
+	writer.WriteField("tier", "pro-standard")
+	writer.WriteField("client_lat", "52.5")
+	writer.Close()
+
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+		want        bodyRoutingFields
+	}{
+		{"json", "application/json; charset=utf-8", `{"tier": "lite", "client_lat": 40.7, "client_lon": -74}`, bodyRoutingFields{"lite", 40.7, -74}},
+		{"untyped json", "", `{"tier": "lite"}`, bodyRoutingFields{Tier: "lite"}},
+		{"structured json", "application/vnd.api+json", `{"tier": "lite"}`, bodyRoutingFields{Tier: "lite"}},
+		{"form", "application/x-www-form-urlencoded", "tier=pro-standard&client_lon=13.4", bodyRoutingFields{Tier: "pro-standard", ClientLon: 13.4}},
+		{"multipart skips files", writer.FormDataContentType(), multipartBody.String(), bodyRoutingFields{Tier: "pro-standard", ClientLat: 52.5}},
+		{"protobuf", "application/x-protobuf", "\x00\x00\x00\x00\x05{\"tier\"", bodyRoutingFields{}},
+		{"grpc", "application/grpc", `{"tier": "lite"}`, bodyRoutingFields{}},
+	}
+	for _, c := range cases {
+		if got := extractBodyRoutingFields(c.contentType, []byte(c.body), "tier"); got != c.want {
+			t.Errorf("%s: expected %+v, got %+v", c.name, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+const (
+	CircuitClosed   = "closed"    // Traffic flows; consecutive failures are counted
+	CircuitOpen     = "open"      // Backend skipped by routing until the cool-down ends
+	CircuitHalfOpen = "half-open" // A few trial placements decide whether to close or open again
+)
+
+// circuitState tracks one backend's consecutive proxy failures and breaker state
+type circuitState struct {
+	state     string
+	failures  int       // Consecutive failed proxied requests
+	openedAt  time.Time // Start of the current cool-down
+	trials    int       // Trial placements admitted while half-open
+	trialAt   time.Time // Last trial placement, so lost trials don't hold the breaker half-open
+	successes int       // Successful trials while half-open
+	opens     int       // Times the circuit has opened
+}
+
+// CircuitStatus is the circuit breaker view of a backend reported by /clients
+type CircuitStatus struct {
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	OpenUntil           time.Time `json:"open_until,omitempty"`
+	Opens               int       `json:"opens,omitempty"`
+}
+
+// CircuitBreakers stop placing traffic on a backend after consecutive proxy failures (connection errors
+// or 5xx), like the agent's breaker for stats reports. Health probes run every few seconds and need
+// several failures; a dead backend trips its breaker on the next requests. After open_seconds the
+// breaker half-opens and admits half_open_requests trial placements: success closes it, a failure
+// opens it again.
+type CircuitBreakers struct {
+	mu     sync.Mutex
+	config common.CircuitBreakerConfig
+	states map[string]*circuitState
+	now    func() time.Time
+}
+
+// NewCircuitBreakers creates the per-backend breakers, or returns nil if the circuit breaker is disabled
+func NewCircuitBreakers(config common.CircuitBreakerConfig) *CircuitBreakers {
+	if !config.Enabled {
+		return nil
+	}
+	if config.MaxFailures <= 0 {
+		config.MaxFailures = 5
+	}
+	if config.OpenSecs <= 0 {
+		config.OpenSecs = 30
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	return &CircuitBreakers{
+		config: config,
+		states: make(map[string]*circuitState),
+		now:    time.Now,
+	}
+}
+
+func (b *CircuitBreakers) openDuration() time.Duration {
+	return time.Duration(b.config.OpenSecs) * time.Second
+}
+
+// advanceLocked moves an open breaker whose cool-down has ended to half-open
+func (b *CircuitBreakers) advanceLocked(clientID string, state *circuitState, now time.Time) {
+	if state.state == CircuitOpen && now.Sub(state.openedAt) >= b.openDuration() {
+		state.state = CircuitHalfOpen
+		state.trials = 0
+		state.successes = 0
+		LogInfoWithData("Circuit half-open, admitting trial requests", map[string]interface{}{
+			"client_id": clientID,
+			"trials":    b.config.HalfOpenRequests,
+		})
+	}
+}
+
+func (b *CircuitBreakers) openLocked(clientID string, state *circuitState, now time.Time) {
+	previous := state.state
+	state.state = CircuitOpen
+	state.openedAt = now
+	state.opens++
+	LogWarnWithData("Circuit opened for backend after consecutive proxy failures", map[string]interface{}{
+		"client_id":            clientID,
+		"previous":             previous,
+		"consecutive_failures": state.failures,
+		"open_seconds":         b.config.OpenSecs,
+	})
+}
+
+// Record adds a proxied request outcome and reports whether it opened the circuit
+func (b *CircuitBreakers) Record(clientID string, failed bool) bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	state, ok := b.states[clientID]
+	if !ok {
+		state = &circuitState{state: CircuitClosed}
+		b.states[clientID] = state
+	}
+	b.advanceLocked(clientID, state, now)
+
+	switch state.state {
+	case CircuitOpen:
+		// Requests already in flight when the circuit opened
+		return false
+	case CircuitHalfOpen:
+		if failed {
+			state.failures++
+			b.openLocked(clientID, state, now)
+			return true
+		}
+		state.successes++
+		if state.successes >= b.config.HalfOpenRequests {
+			state.state = CircuitClosed
+			state.failures = 0
+			LogInfoWithData("Circuit closed for backend", map[string]interface{}{
+				"client_id": clientID,
+				"trials":    state.successes,
+			})
+		}
+	default:
+		if !failed {
+			state.failures = 0
+			return false
+		}
+		state.failures++
+		if state.failures >= b.config.MaxFailures {
+			b.openLocked(clientID, state, now)
+			return true
+		}
+	}
+	return false
+}
+
+// Open reports whether a backend's circuit is open (cooling down), so routing must skip it
+func (b *CircuitBreakers) Open(clientID string) bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.states[clientID]
+	if !ok {
+		return false
+	}
+	b.advanceLocked(clientID, state, b.now())
+	return state.state == CircuitOpen
+}
+
+// Admit reports whether a backend may receive a new placement
+// A half-open breaker admits half_open_requests trials; trials without an outcome within
+// open_seconds (e.g. /route answers that were never proxied) are given up so new ones can start
+func (b *CircuitBreakers) Admit(clientID string) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.states[clientID]
+	if !ok {
+		return true
+	}
+	now := b.now()
+	b.advanceLocked(clientID, state, now)
+	switch state.state {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		if state.trials-state.successes >= b.config.HalfOpenRequests {
+			if now.Sub(state.trialAt) < b.openDuration() {
+				return false
+			}
+			state.trials = state.successes // Give up on trials that never reported
+		}
+		state.trials++
+		state.trialAt = now
+	}
+	return true
+}
+
+// Status returns the circuit breaker view of a backend
+func (b *CircuitBreakers) Status(clientID string) CircuitStatus {
+	if b == nil {
+		return CircuitStatus{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.states[clientID]
+	if !ok {
+		return CircuitStatus{State: CircuitClosed}
+	}
+	b.advanceLocked(clientID, state, b.now())
+	status := CircuitStatus{
+		State:               state.state,
+		ConsecutiveFailures: state.failures,
+		Opens:               state.opens,
+	}
+	if state.state == CircuitOpen {
+		status.OpenUntil = state.openedAt.Add(b.openDuration())
+	}
+	return status
+}
+
+// Remove forgets a deregistered backend
+func (b *CircuitBreakers) Remove(clientID string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	delete(b.states, clientID)
+	b.mu.Unlock()
+}
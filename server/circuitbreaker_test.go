@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestCircuitBreakers_OpenHalfOpenClose verifies the breaker opens on consecutive failures, admits one
+// trial after the cool-down, and closes or reopens on the trial's outcome
+func TestCircuitBreakers_OpenHalfOpenClose(t *testing.T) {
+	now := time.Now()
+	b := NewCircuitBreakers(common.CircuitBreakerConfig{Enabled: true, MaxFailures: 3, OpenSecs: 10, HalfOpenRequests: 1})
+	b.now = func() time.Time { return now }
+
+	b.Record("backend-1", true)
+	b.Record("backend-1", true)
+	b.Record("backend-1", false)
+	b.Record("backend-1", true)
+	if b.Open("backend-1") {
+		t.Fatal("Expected a success to reset the consecutive failure count")
+	}
+	b.Record("backend-1", true)
+	if !b.Record("backend-1", true) || !b.Open("backend-1") || b.Admit("backend-1") {
+		t.Fatal("Expected the third consecutive failure to open the circuit")
+	}
+
+	now = now.Add(11 * time.Second)
+	if b.Open("backend-1") || b.Status("backend-1").State != CircuitHalfOpen {
+		t.Fatalf("Expected half-open after the cool-down, got %+v", b.Status("backend-1"))
+	}
+	if !b.Admit("backend-1") || b.Admit("backend-1") {
+		t.Fatal("Expected exactly one trial to be admitted")
+	}
+	b.Record("backend-1", true)
+	if !b.Open("backend-1") || b.Status("backend-1").Opens != 2 {
+		t.Fatalf("Expected a failed trial to reopen the circuit, got %+v", b.Status("backend-1"))
+	}
+
+	now = now.Add(11 * time.Second)
+	b.Admit("backend-1")
+	b.Record("backend-1", false)
+	if status := b.Status("backend-1"); status.State != CircuitClosed || status.ConsecutiveFailures != 0 {
+		t.Errorf("Expected a successful trial to close the circuit, got %+v", status)
+	}
+}
+
+// TestCircuitBreakers_LostTrial verifies a trial that never reports doesn't keep the breaker half-open forever
+func TestCircuitBreakers_LostTrial(t *testing.T) {
+	now := time.Now()
+	b := NewCircuitBreakers(common.CircuitBreakerConfig{Enabled: true, MaxFailures: 1, OpenSecs: 10})
+	b.now = func() time.Time { return now }
+
+	b.Record("backend-1", true)
+	now = now.Add(11 * time.Second)
+	b.Admit("backend-1")
+	now = now.Add(11 * time.Second)
+	if !b.Admit("backend-1") {
+		t.Error("Expected a new trial once the previous one went unanswered for open_seconds")
+	}
+}
+
+// TestProxy_CircuitBreakerSkipsDeadBackend verifies connection failures open the circuit and routing moves on
+func TestProxy_CircuitBreakerSkipsDeadBackend(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer healthy.Close()
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	dead.Close()
+
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.CircuitBreaker = common.CircuitBreakerConfig{Enabled: true, MaxFailures: 2, OpenSecs: 30}
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{
+		ClientID:    "dead-backend",
+		Endpoint:    dead.URL,
+		CPUUsageAvg: []float64{1, 1, 1, 1, 1, 1, 1, 1},
+		MemoryAvail: 60.0,
+		DiskAvail:   100.0,
+	}))
+	server.AddMockClient(NewMockClient(MockClientOptions{
+		ClientID:    "healthy-backend",
+		Endpoint:    healthy.URL,
+		CPUUsageAvg: []float64{50, 50, 50, 50, 50, 50, 50, 50},
+		MemoryAvail: 20.0,
+		DiskAvail:   100.0,
+	}))
+
+	for i := 0; i < 2; i++ {
+		server.ClearPendingAllocations()
+		rec := httptest.NewRecorder()
+		server.handleProxy(rec, httptest.NewRequest("GET", "/api/test", nil))
+		if rec.Code != http.StatusBadGateway {
+			t.Fatalf("Expected the idle dead backend to be picked and fail, got %d", rec.Code)
+		}
+	}
+
+	server.ClearPendingAllocations()
+	rec := httptest.NewRecorder()
+	server.handleProxy(rec, httptest.NewRequest("GET", "/api/test", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the open circuit to route to the healthy backend, got %d", rec.Code)
+	}
+	if status := server.breakers.Status("dead-backend"); status.State != CircuitOpen || status.OpenUntil.IsZero() {
+		t.Errorf("Expected an open circuit in the status, got %+v", status)
+	}
+}
@@ -121,7 +121,7 @@ func TestPurgeInvalidClients(t *testing.T) {
 	}
 
 	// Run purge
-	server.purgeInvalidClients()
+	server.purgeInvalidClients(false)
 
 	// Verify invalid clients removed
 	var count int
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+const (
+	maxClientErrorsPerReport = 100  // Events accepted in one POST /errors
+	maxClientErrorMessageLen = 1024 // Longer messages are truncated
+	defaultClientErrorsLimit = 100  // Events returned by GET /clients/{id}/errors without ?limit
+	maxClientErrorsLimit     = 1000
+)
+
+// clientErrorAlertInterval limits client.error webhooks to one per backend and source in this window
+// A failing collector reports on every interval, which would otherwise flood the webhook
+const clientErrorAlertInterval = 10 * time.Minute
+
+// errorSeverityRank orders severities for the webhook threshold (unknown = 0)
+func errorSeverityRank(severity string) int {
+	switch severity {
+	case common.ErrorSeverityWarning:
+		return 1
+	case common.ErrorSeverityError:
+		return 2
+	case common.ErrorSeverityCritical:
+		return 3
+	}
+	return 0
+}
+
+// normalizeClientError fills defaults and validates one reported event
+func normalizeClientError(event common.ClientError, now time.Time) (common.ClientError, error) {
+	event.Source = strings.TrimSpace(event.Source)
+	event.Message = strings.TrimSpace(event.Message)
+	if event.Source == "" || event.Message == "" {
+		return event, fmt.Errorf("source and message are required")
+	}
+	if event.Severity == "" {
+		event.Severity = common.ErrorSeverityError
+	}
+	if errorSeverityRank(event.Severity) == 0 {
+		return event, fmt.Errorf("invalid severity %q (expected warning, error or critical)", event.Severity)
+	}
+	if event.Count <= 0 {
+		event.Count = 1
+	}
+	// Agent clocks drift; events from the future are stored as received now
+	if event.Timestamp.IsZero() || event.Timestamp.After(now) {
+		event.Timestamp = now
+	}
+	if len(event.Message) > maxClientErrorMessageLen {
+		event.Message = event.Message[:maxClientErrorMessageLen]
+	}
+	return event, nil
+}
+
+// handleErrors stores structured error events reported by an agent
+// Events at or above client_errors.webhook_severity are also sent as client.error webhooks
+func (s *Server) handleErrors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var report common.ClientErrorReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON body: %v. Expected {\"client_id\": ..., \"errors\": [...]}.", err), http.StatusBadRequest)
+		return
+	}
+	if report.ClientID == "" {
+		http.Error(w, "Missing required field: client_id", http.StatusBadRequest)
+		return
+	}
+	if len(report.Errors) > maxClientErrorsPerReport {
+		http.Error(w, fmt.Sprintf("Too many errors in report: %d (max %d)", len(report.Errors), maxClientErrorsPerReport), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	s.mu.RLock()
+	client, ok := s.clientCache[report.ClientID]
+	tenant := ""
+	if ok {
+		tenant = normalizeTenant(client.Registration.Tenant)
+	}
+	s.mu.RUnlock()
+
+	if !ok {
+		http.Error(w, fmt.Sprintf("Client not registered: %s", report.ClientID), http.StatusNotFound)
+		return
+	}
+	if keyTenant, scoped := tenantFromContext(r); scoped && keyTenant != tenant {
+		http.Error(w, fmt.Sprintf("API key cannot report errors for client: %s", report.ClientID), http.StatusForbidden)
+		return
+	}
+
+	now := time.Now().UTC()
+	accepted := make([]common.ClientError, 0, len(report.Errors))
+	rejected := 0
+	for _, event := range report.Errors {
+		event, err := normalizeClientError(event, now)
+		if err != nil {
+			rejected++
+			continue
+		}
+		accepted = append(accepted, event)
+	}
+
+	if err := s.storeClientErrors(report.ClientID, accepted); err != nil {
+		log.Printf("Error persisting client errors for %s: %v", report.ClientID, err)
+		http.Error(w, "Failed to store errors", http.StatusInternalServerError)
+		return
+	}
+	s.alertClientErrors(report.ClientID, tenant, accepted)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "ok",
+		"accepted": len(accepted),
+		"rejected": rejected,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode errors response: %v", err)
+	}
+}
+
+// storeClientErrors inserts a backend's error events in one transaction
+func (s *Server) storeClientErrors(clientID string, events []common.ClientError) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.Prepare(`
+		INSERT INTO client_errors (client_id, timestamp, source, severity, message, count, details_json)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	for _, event := range events {
+		var details interface{}
+		if len(event.Details) > 0 {
+			detailsJSON, _ := json.Marshal(event.Details)
+			details = string(detailsJSON)
+		}
+		if _, err := insert.Exec(clientID, event.Timestamp.UTC(), event.Source, event.Severity, event.Message, event.Count, details); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// alertClientErrors sends client.error webhooks for events at or above the configured severity
+func (s *Server) alertClientErrors(clientID, tenant string, events []common.ClientError) {
+	threshold := s.config.ClientErrors.WebhookSeverity
+	if threshold == "none" || s.webhooks == nil {
+		return
+	}
+	minRank := errorSeverityRank(threshold)
+	if minRank == 0 {
+		minRank = errorSeverityRank(common.ErrorSeverityError)
+	}
+
+	for _, event := range events {
+		if errorSeverityRank(event.Severity) < minRank {
+			continue
+		}
+
+		key := clientID + "\x00" + event.Source
+		s.mu.Lock()
+		last, alerted := s.clientErrorAlerts[key]
+		throttled := alerted && time.Since(last) < clientErrorAlertInterval
+		if !throttled {
+			s.clientErrorAlerts[key] = time.Now()
+		}
+		s.mu.Unlock()
+		if throttled {
+			continue
+		}
+
+		s.emit("client.error", map[string]interface{}{
+			"client_id": clientID,
+			"tenant":    tenant,
+			"source":    event.Source,
+			"severity":  event.Severity,
+			"message":   event.Message,
+			"count":     event.Count,
+			"details":   event.Details,
+			"timestamp": event.Timestamp,
+		})
+	}
+}
+
+// handleClientErrors lists a backend's stored error events, newest first
+// Query parameters: limit (default 100), since (RFC 3339), severity (minimum severity), source
+func (s *Server) handleClientErrors(w http.ResponseWriter, r *http.Request, clientID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := defaultClientErrorsLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid limit: %s", v), http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxClientErrorsLimit)
+	}
+
+	conditions := []string{"client_id = ?"}
+	args := []interface{}{clientID}
+	if v := query.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid since (expected RFC 3339): %s", v), http.StatusBadRequest)
+			return
+		}
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, since.UTC())
+	}
+	if v := query.Get("severity"); v != "" {
+		rank := errorSeverityRank(v)
+		if rank == 0 {
+			http.Error(w, fmt.Sprintf("Invalid severity: %s", v), http.StatusBadRequest)
+			return
+		}
+		severities := []string{}
+		for _, severity := range []string{common.ErrorSeverityWarning, common.ErrorSeverityError, common.ErrorSeverityCritical} {
+			if errorSeverityRank(severity) >= rank {
+				severities = append(severities, "'"+severity+"'")
+			}
+		}
+		conditions = append(conditions, "severity IN ("+strings.Join(severities, ", ")+")")
+	}
+	if v := query.Get("source"); v != "" {
+		conditions = append(conditions, "source = ?")
+		args = append(args, v)
+	}
+	args = append(args, limit)
+
+	rows, err := s.db.Query(`
+		SELECT timestamp, source, severity, message, count, details_json
+		FROM client_errors
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY timestamp DESC, id DESC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to query errors: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	events := []common.ClientError{}
+	for rows.Next() {
+		var event common.ClientError
+		var details sql.NullString
+		if err := rows.Scan(&event.Timestamp, &event.Source, &event.Severity, &event.Message, &event.Count, &details); err != nil {
+			log.Printf("Error scanning client error row: %v", err)
+			continue
+		}
+		if details.Valid && details.String != "" {
+			json.Unmarshal([]byte(details.String), &event.Details)
+		}
+		events = append(events, event)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"client_id": clientID,
+		"errors":    events,
+		"count":     len(events),
+	}); err != nil {
+		log.Printf("Warning: Failed to encode client errors response: %v", err)
+	}
+}
+
+// pruneClientErrors enforces client_errors retention by age and per-backend count
+func (s *Server) pruneClientErrors() {
+	cfg := s.config.ClientErrors
+	var removed int64
+
+	if cfg.RetentionHours > 0 {
+		cutoff := time.Now().UTC().Add(-time.Duration(cfg.RetentionHours) * time.Hour)
+		res, err := s.db.Exec("DELETE FROM client_errors WHERE timestamp < ?", cutoff)
+		if err != nil {
+			log.Printf("Warning: Failed to prune expired client errors: %v", err)
+		} else {
+			n, _ := res.RowsAffected()
+			removed += n
+		}
+	}
+
+	if cfg.MaxPerClient > 0 {
+		res, err := s.db.Exec(`
+			DELETE FROM client_errors WHERE id IN (
+				SELECT id FROM (
+					SELECT id, ROW_NUMBER() OVER (PARTITION BY client_id ORDER BY timestamp DESC, id DESC) AS rn
+					FROM client_errors
+				) WHERE rn > ?
+			)
+		`, cfg.MaxPerClient)
+		if err != nil {
+			log.Printf("Warning: Failed to trim client errors: %v", err)
+		} else {
+			n, _ := res.RowsAffected()
+			removed += n
+		}
+	}
+
+	if removed > 0 {
+		LogDebugWithData("Pruned client errors", map[string]interface{}{
+			"removed": removed,
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+func postErrors(t *testing.T, server *Server, report common.ClientErrorReport) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(report)
+	rec := httptest.NewRecorder()
+	server.handleErrors(rec, httptest.NewRequest("POST", "/errors", bytes.NewReader(body)))
+	return rec
+}
+
+func getClientErrors(t *testing.T, server *Server, path string) []common.ClientError {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	server.handleClientByID(rec, httptest.NewRequest("GET", path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected errors listing to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Errors []common.ClientError `json:"errors"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return resp.Errors
+}
+
+// TestClientErrors_StoreAndList verifies reported events are validated, stored and listed newest first
+func TestClientErrors_StoreAndList(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "edge-1"}))
+
+	now := time.Now()
+	rec := postErrors(t, server, common.ClientErrorReport{ClientID: "edge-1", Errors: []common.ClientError{
+		{Timestamp: now.Add(-2 * time.Minute), Source: "disk", Message: "read /data: input/output error", Details: map[string]string{"path": "/data"}},
+		{Timestamp: now.Add(-time.Minute), Source: "gpu_collector", Severity: common.ErrorSeverityCritical, Message: "NVML: GPU is lost", Count: 12},
+		{Source: "probe", Severity: "fatal", Message: "unknown severity"},
+		{Source: "", Message: "missing source"},
+	}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected errors to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp map[string]int
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp["accepted"] != 2 || resp["rejected"] != 2 {
+		t.Errorf("Expected 2 accepted and 2 rejected events, got %v", resp)
+	}
+
+	events := getClientErrors(t, server, "/clients/edge-1/errors")
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 stored events, got %d", len(events))
+	}
+	if events[0].Source != "gpu_collector" || events[0].Count != 12 {
+		t.Errorf("Expected the newest event first with its count, got %+v", events[0])
+	}
+	if events[1].Severity != common.ErrorSeverityError || events[1].Details["path"] != "/data" {
+		t.Errorf("Expected default severity and details to be kept, got %+v", events[1])
+	}
+
+	if critical := getClientErrors(t, server, "/clients/edge-1/errors?severity=critical"); len(critical) != 1 {
+		t.Errorf("Expected 1 critical event, got %d", len(critical))
+	}
+
+	if rec := postErrors(t, server, common.ClientErrorReport{ClientID: "unknown", Errors: []common.ClientError{{Source: "disk", Message: "x"}}}); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected unregistered clients to be rejected, got %d", rec.Code)
+	}
+}
+
+// TestClientErrors_RetentionAndCascade verifies old and excess events are pruned and removed with their backend
+func TestClientErrors_RetentionAndCascade(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.ClientErrors = common.ClientErrorsConfig{RetentionHours: 24, MaxPerClient: 2}
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "edge-1"}))
+
+	now := time.Now()
+	if err := server.storeClientErrors("edge-1", []common.ClientError{
+		{Timestamp: now.Add(-48 * time.Hour), Source: "disk", Severity: "error", Message: "expired", Count: 1},
+		{Timestamp: now.Add(-3 * time.Minute), Source: "disk", Severity: "error", Message: "oldest kept?", Count: 1},
+		{Timestamp: now.Add(-2 * time.Minute), Source: "disk", Severity: "error", Message: "second", Count: 1},
+		{Timestamp: now.Add(-1 * time.Minute), Source: "disk", Severity: "error", Message: "newest", Count: 1},
+	}); err != nil {
+		t.Fatalf("storeClientErrors failed: %v", err)
+	}
+
+	server.pruneClientErrors()
+	events := getClientErrors(t, server, "/clients/edge-1/errors")
+	if len(events) != 2 || events[0].Message != "newest" || events[1].Message != "second" {
+		t.Fatalf("Expected only the 2 newest events to be kept, got %+v", events)
+	}
+
+	result := server.deregisterClients([]string{"edge-1"}, "deleted")
+	if result.Errors != 2 {
+		t.Errorf("Expected 2 error events removed with the backend, got %d", result.Errors)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// Paginated GET /clients
+const (
+	defaultClientsPerPage = 100
+	maxClientsPerPage     = 1000
+	clientSnapshotTTL     = 5 * time.Minute // A page sequence must be read within this window
+	maxClientSnapshots    = 64              // Oldest snapshots are dropped beyond this
+	TotalCountHeader      = "X-Total-Count" // Backends matching the filters across all pages
+	ClientsSnapshotHeader = "X-Snapshot-ID" // Pass as ?snapshot= to read further pages of the same listing
+	clientSortClientID    = "client_id"
+	clientSortLoad        = "load"
+	clientSortLastSeen    = "last_seen"
+)
+
+// clientListQuery holds the filters and sort order of a GET /clients request
+type clientListQuery struct {
+	health   string // healthy, unhealthy or unknown
+	pool     string
+	labels   map[string]string // key → value; "" matches any value of the key
+	tier     *common.TierSpec  // Only backends able to take this tier now
+	gpu      string            // "true" or "false"
+	approval string            // "pending" or "approved"
+	sort     string
+	desc     bool
+
+	paginated bool
+	page      int
+	perPage   int
+	snapshot  string
+}
+
+// parseClientListQuery reads filters, sort order and page parameters
+func (s *Server) parseClientListQuery(r *http.Request) (clientListQuery, error) {
+	params := r.URL.Query()
+	q := clientListQuery{
+		health:   params.Get("health"),
+		pool:     params.Get("pool"),
+		gpu:      params.Get("gpu"),
+		approval: params.Get("approval"),
+		sort:     params.Get("sort"),
+		snapshot: params.Get("snapshot"),
+		page:     1,
+		perPage:  defaultClientsPerPage,
+	}
+
+	switch q.health {
+	case "", "healthy", "unhealthy", "unknown":
+	default:
+		return q, fmt.Errorf("invalid health %q (expected healthy, unhealthy or unknown)", q.health)
+	}
+	switch q.gpu {
+	case "", "true", "false":
+	default:
+		return q, fmt.Errorf("invalid gpu %q (expected true or false)", q.gpu)
+	}
+	switch q.approval {
+	case "", "pending", "approved":
+	default:
+		return q, fmt.Errorf("invalid approval %q (expected pending or approved)", q.approval)
+	}
+	switch q.sort {
+	case "":
+		q.sort = clientSortClientID
+	case clientSortClientID, clientSortLoad, clientSortLastSeen:
+	default:
+		return q, fmt.Errorf("invalid sort %q (expected client_id, load or last_seen)", q.sort)
+	}
+	switch order := params.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		q.desc = true
+	default:
+		return q, fmt.Errorf("invalid order %q (expected asc or desc)", order)
+	}
+
+	labels, err := parseLabelFilters(params["label"])
+	if err != nil {
+		return q, err
+	}
+	q.labels = labels
+
+	if name := params.Get("tier"); name != "" {
+		spec, _, ok := s.resolveTier(r, name)
+		if !ok {
+			return q, fmt.Errorf("unknown tier: %s", name)
+		}
+		q.tier = &spec
+	}
+
+	q.paginated = params.Has("page") || params.Has("per_page") || q.snapshot != ""
+	if value := params.Get("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return q, fmt.Errorf("invalid page %q", value)
+		}
+		q.page = page
+	}
+	if value := params.Get("per_page"); value != "" {
+		perPage, err := strconv.Atoi(value)
+		if err != nil || perPage < 1 || perPage > maxClientsPerPage {
+			return q, fmt.Errorf("invalid per_page %q (expected 1-%d)", value, maxClientsPerPage)
+		}
+		q.perPage = perPage
+	}
+	return q, nil
+}
+
+// parseLabelFilters reads label=key or label=key=value filters (nil when there are none)
+func parseLabelFilters(values []string) (map[string]string, error) {
+	var labels map[string]string
+	for _, label := range values {
+		key, value, _ := strings.Cut(label, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid label %q (expected key or key=value)", label)
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// labelsMatch reports whether a backend's labels have every filtered key (and value, when given)
+func labelsMatch(labels, filters map[string]string) bool {
+	for key, value := range filters {
+		got, ok := labels[key]
+		if !ok || (value != "" && got != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchLocked reports whether a backend passes the filters (caller must hold s.mu)
+func (q clientListQuery) matchLocked(s *Server, client *ClientState, isActive bool) bool {
+	if q.health != "" && client.HealthStatus != q.health {
+		return false
+	}
+	if q.pool != "" && client.Registration.Pool != q.pool {
+		return false
+	}
+	if !labelsMatch(client.Registration.Labels, q.labels) {
+		return false
+	}
+	if q.gpu != "" && (client.Registration.TotalGPUs > 0) != (q.gpu == "true") {
+		return false
+	}
+	if q.approval != "" && s.awaitingApproval(client) != (q.approval == "pending") {
+		return false
+	}
+	if q.tier != nil {
+		if !isActive || s.awaitingApproval(client) || (s.config.HealthCheckEnabled && client.HealthStatus == "unhealthy") {
+			return false
+		}
+		if !s.hasResourcesLocked(client, *q.tier) {
+			return false
+		}
+	}
+	return true
+}
+
+// clientListItem is a backend's /clients entry with the values it can be sorted by
+type clientListItem struct {
+	clientID string
+	load     float64
+	lastSeen time.Time
+	info     map[string]interface{}
+}
+
+// clientLoad is a backend's average per-core CPU usage
+func clientLoad(client *ClientState) float64 {
+	if len(client.Stats.CPUUsageAvg) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, usage := range client.Stats.CPUUsageAvg {
+		total += usage
+	}
+	return total / float64(len(client.Stats.CPUUsageAvg))
+}
+
+// sortClientList orders entries by the requested key; ties (and the default) go by client ID
+func sortClientList(items []clientListItem, key string, desc bool) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if desc {
+			a, b = b, a
+		}
+		switch key {
+		case clientSortLoad:
+			if a.load != b.load {
+				return a.load < b.load
+			}
+		case clientSortLastSeen:
+			if !a.lastSeen.Equal(b.lastSeen) {
+				return a.lastSeen.Before(b.lastSeen)
+			}
+		}
+		return a.clientID < b.clientID
+	})
+}
+
+// ClientSnapshots keeps paginated /clients listings so every page of a sequence comes from the same moment
+type ClientSnapshots struct {
+	mu        sync.Mutex
+	snapshots map[string]*clientSnapshot
+}
+
+type clientSnapshot struct {
+	tenant  string // Tenant of the API key that created it ("" for global keys)
+	entries []map[string]interface{}
+	created time.Time
+}
+
+// NewClientSnapshots creates an empty snapshot store
+func NewClientSnapshots() *ClientSnapshots {
+	return &ClientSnapshots{snapshots: make(map[string]*clientSnapshot)}
+}
+
+// Put stores a listing and returns its ID
+func (c *ClientSnapshots) Put(tenant string, entries []map[string]interface{}) string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	id := hex.EncodeToString(buf)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.expireLocked(now)
+	for len(c.snapshots) >= maxClientSnapshots {
+		oldest := ""
+		for key, snapshot := range c.snapshots {
+			if oldest == "" || snapshot.created.Before(c.snapshots[oldest].created) {
+				oldest = key
+			}
+		}
+		delete(c.snapshots, oldest)
+	}
+	c.snapshots[id] = &clientSnapshot{tenant: tenant, entries: entries, created: now}
+	return id
+}
+
+// Get returns a stored listing; tenant API keys only see their own snapshots
+func (c *ClientSnapshots) Get(id, tenant string, scoped bool) ([]map[string]interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expireLocked(time.Now())
+	snapshot, ok := c.snapshots[id]
+	if !ok || (scoped && snapshot.tenant != tenant) {
+		return nil, false
+	}
+	return snapshot.entries, true
+}
+
+func (c *ClientSnapshots) expireLocked(now time.Time) {
+	for id, snapshot := range c.snapshots {
+		if now.Sub(snapshot.created) > clientSnapshotTTL {
+			delete(c.snapshots, id)
+		}
+	}
+}
+
+// writeClientPage writes one page of a snapshot with its total count and a Link to the next page
+func writeClientPage(w http.ResponseWriter, r *http.Request, entries []map[string]interface{}, snapshotID string, page, perPage int) {
+	start := min((page-1)*perPage, len(entries))
+	end := min(start+perPage, len(entries))
+
+	w.Header().Set(TotalCountHeader, strconv.Itoa(len(entries)))
+	w.Header().Set(ClientsSnapshotHeader, snapshotID)
+	if end < len(entries) {
+		next := *r.URL
+		params := next.Query()
+		params.Set("snapshot", snapshotID)
+		params.Set("page", strconv.Itoa(page+1))
+		params.Set("per_page", strconv.Itoa(perPage))
+		next.RawQuery = params.Encode()
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entries[start:end]); err != nil {
+		log.Printf("Warning: Failed to encode clients list response: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// listClients calls GET /clients and returns the response and the listed client IDs
+func listClients(t *testing.T, server *Server, target string) (*httptest.ResponseRecorder, []string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	server.handleListClients(rec, httptest.NewRequest("GET", target, nil))
+	var entries []map[string]interface{}
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+			t.Fatalf("Failed to decode %s: %v", target, err)
+		}
+	}
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry["client_id"].(string))
+	}
+	return rec, ids
+}
+
+// TestListClients_Filters verifies filtering by health, pool, label, GPU presence and tier eligibility, and sorting
+func TestListClients_Filters(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	now := time.Now()
+	busy := NewMockClient(MockClientOptions{ClientID: "busy", CPUUsageAvg: []float64{90, 90, 90, 90, 90, 90, 90, 90}, LastSeen: now})
+	busy.HealthStatus = "healthy"
+	busy.Registration.Pool = "spot"
+	busy.Registration.Labels = map[string]string{"rack": "r1"}
+	idle := NewMockClient(MockClientOptions{ClientID: "idle", CPUUsageAvg: []float64{5, 5, 5, 5, 5, 5, 5, 5}, LastSeen: now.Add(-time.Second)})
+	idle.HealthStatus = "healthy"
+	idle.Registration.Labels = map[string]string{"rack": "r2"}
+	gpu := NewMockClient(MockClientOptions{ClientID: "gpu", TotalGPUs: 1, GPUModels: []string{"A100"},
+		LastSeen: now.Add(-time.Minute)})
+	server.AddMockClient(busy)
+	server.AddMockClient(idle)
+	server.AddMockClient(gpu)
+
+	cases := map[string]string{
+		"/clients":                              "busy,gpu,idle",
+		"/clients?health=healthy":               "busy,idle",
+		"/clients?pool=spot":                    "busy",
+		"/clients?label=rack":                   "busy,idle",
+		"/clients?label=rack=r2":                "idle",
+		"/clients?gpu=true":                     "gpu",
+		"/clients?gpu=false&sort=load":          "idle,busy",
+		"/clients?sort=load&order=desc":         "busy,gpu,idle",
+		"/clients?sort=last_seen&order=desc":    "busy,idle,gpu",
+		"/clients?tier=pro-standard":            "gpu,idle",
+		"/clients?tier=pro-standard&label=rack": "idle",
+	}
+	for target, expected := range cases {
+		rec, ids := listClients(t, server, target)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d: %s", target, rec.Code, rec.Body.String())
+			continue
+		}
+		if got := strings.Join(ids, ","); got != expected {
+			t.Errorf("%s: expected %s, got %s", target, expected, got)
+		}
+	}
+
+	for _, target := range []string{"/clients?health=sick", "/clients?sort=name", "/clients?tier=nope", "/clients?per_page=0"} {
+		if rec, _ := listClients(t, server, target); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, rec.Code)
+		}
+	}
+}
+
+// TestListClients_PaginationSnapshot verifies later pages come from the snapshot taken for the first page
+func TestListClients_PaginationSnapshot(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+	for i := 0; i < 5; i++ {
+		server.AddMockClient(NewMockClient(MockClientOptions{ClientID: fmt.Sprintf("node-%d", i)}))
+	}
+
+	rec, ids := listClients(t, server, "/clients?per_page=2")
+	if strings.Join(ids, ",") != "node-0,node-1" {
+		t.Fatalf("Expected the first page to hold node-0,node-1, got %v", ids)
+	}
+	if rec.Header().Get(TotalCountHeader) != "5" {
+		t.Errorf("Expected %s: 5, got %q", TotalCountHeader, rec.Header().Get(TotalCountHeader))
+	}
+	snapshot := rec.Header().Get(ClientsSnapshotHeader)
+	if snapshot == "" || !strings.Contains(rec.Header().Get("Link"), "snapshot="+snapshot) {
+		t.Fatalf("Expected a snapshot ID and a next link, got %q and %q", snapshot, rec.Header().Get("Link"))
+	}
+
+	// Changes after the first page do not shift later pages
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "node-00"}))
+	server.mu.Lock()
+	delete(server.clientCache, "node-3")
+	server.mu.Unlock()
+
+	rec, ids = listClients(t, server, "/clients?snapshot="+snapshot+"&page=2&per_page=2")
+	if strings.Join(ids, ",") != "node-2,node-3" {
+		t.Errorf("Expected page 2 of the snapshot to hold node-2,node-3, got %v", ids)
+	}
+	rec, ids = listClients(t, server, "/clients?snapshot="+snapshot+"&page=3&per_page=2")
+	if strings.Join(ids, ",") != "node-4" || rec.Header().Get("Link") != "" {
+		t.Errorf("Expected the last page to hold node-4 without a next link, got %v (%q)", ids, rec.Header().Get("Link"))
+	}
+
+	if rec, _ := listClients(t, server, "/clients?snapshot=unknown&page=2"); rec.Code != http.StatusGone {
+		t.Errorf("Expected 410 for an unknown snapshot, got %d", rec.Code)
+	}
+}
+
+// TestRegister_LabelsPersisted verifies backend labels survive a server restart
+func TestRegister_LabelsPersisted(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	reg := common.ClientRegistration{ClientID: "l-1", EndpointURL: "http://10.0.0.1:11000", Labels: map[string]string{"rack": "r12"}}
+	if rec := postRegistration(server, reg); rec.Code != http.StatusOK {
+		t.Fatalf("Expected registration to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	restarted := NewTestServer(t, db)
+	if err := restarted.loadClients(); err != nil {
+		t.Fatalf("Failed to load clients: %v", err)
+	}
+	if got := restarted.clientCache["l-1"].Registration.Labels["rack"]; got != "r12" {
+		t.Errorf("Expected label rack=r12 after reload, got %q", got)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// BackendCostReport summarizes cost and usage for one backend
+type BackendCostReport struct {
+	ClientID       string  `json:"client_id"`
+	Hostname       string  `json:"hostname"`
+	HourlyCost     float64 `json:"hourly_cost"`
+	CostOverridden bool    `json:"cost_overridden"`
+	RoutedSessions int64   `json:"routed_sessions"`
+	SessionHours   float64 `json:"session_hours"`
+	EstimatedCost  float64 `json:"estimated_cost"`
+}
+
+// costOverrideRequest is the payload for PUT /costs
+type costOverrideRequest struct {
+	ClientID   string   `json:"client_id"`
+	HourlyCost *float64 `json:"hourly_cost"` // null removes the override
+}
+
+// effectiveHourlyCostLocked returns the admin override if set, otherwise the registered cost
+// Must be called with s.mu held
+func (s *Server) effectiveHourlyCostLocked(clientID string, registered float64) float64 {
+	if cost, ok := s.costOverrides[clientID]; ok {
+		return cost
+	}
+	return registered
+}
+
+// loadCostOverrides loads admin-set hourly costs from the database
+func (s *Server) loadCostOverrides() error {
+	rows, err := s.db.Query("SELECT client_id, hourly_cost FROM backend_costs")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.invalidateRoutingSnapshot()
+
+	for rows.Next() {
+		var clientID string
+		var cost float64
+		if err := rows.Scan(&clientID, &cost); err != nil {
+			continue
+		}
+		s.costOverrides[clientID] = cost
+		if client, ok := s.clientCache[clientID]; ok {
+			client.HourlyCost = cost
+		}
+	}
+
+	return rows.Err()
+}
+
+// handleCosts reports per-backend costs (GET) or sets an admin cost override (PUT)
+func (s *Server) handleCosts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleCostReport(w, r)
+	case http.MethodPut, http.MethodPost:
+		s.handleSetCostOverride(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleCostReport aggregates routed sessions and session-hours per backend
+// Session-hours are derived from sticky assignments (created_at → last_used), the only
+// session lifetime the load balancer observes
+func (s *Server) handleCostReport(w http.ResponseWriter, r *http.Request) {
+	assignments, err := s.stickyStore.List("")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to query session hours: %v", err), http.StatusInternalServerError)
+		return
+	}
+	sessionHours := make(map[string]float64)
+	for _, assignment := range assignments {
+		sessionHours[assignment.ClientID] += assignment.LastUsed.Sub(assignment.CreatedAt).Hours()
+	}
+
+	s.mu.RLock()
+	reports := make([]BackendCostReport, 0, len(s.clientCache))
+	totalCost := 0.0
+	for id, client := range s.clientCache {
+		_, overridden := s.costOverrides[id]
+		report := BackendCostReport{
+			ClientID:       id,
+			Hostname:       client.Registration.Hostname,
+			HourlyCost:     client.HourlyCost,
+			CostOverridden: overridden,
+			RoutedSessions: client.RoutedSessions,
+			SessionHours:   sessionHours[id],
+		}
+		report.EstimatedCost = report.SessionHours * report.HourlyCost
+		totalCost += report.EstimatedCost
+		reports = append(reports, report)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].ClientID < reports[j].ClientID
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"backends":             reports,
+		"total_estimated_cost": totalCost,
+		"cost_weight":          s.config.CostWeight,
+		"since":                s.startedAt.Format(time.RFC3339),
+	}); err != nil {
+		log.Printf("Warning: Failed to encode cost report: %v", err)
+	}
+}
+
+// handleSetCostOverride sets or clears an admin hourly cost for a backend
+func (s *Server) handleSetCostOverride(w http.ResponseWriter, r *http.Request) {
+	var req costOverrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.ClientID == "" {
+		http.Error(w, "Missing required field: client_id", http.StatusBadRequest)
+		return
+	}
+	if req.HourlyCost != nil && *req.HourlyCost < 0 {
+		http.Error(w, "hourly_cost must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if req.HourlyCost == nil {
+		_, err = s.db.Exec("DELETE FROM backend_costs WHERE client_id = ?", req.ClientID)
+	} else {
+		_, err = s.db.Exec(`
+			INSERT OR REPLACE INTO backend_costs (client_id, hourly_cost, updated_at)
+			VALUES (?, ?, CURRENT_TIMESTAMP)
+		`, req.ClientID, *req.HourlyCost)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to persist cost override: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	s.invalidateRoutingSnapshot()
+	if req.HourlyCost == nil {
+		delete(s.costOverrides, req.ClientID)
+	} else {
+		s.costOverrides[req.ClientID] = *req.HourlyCost
+	}
+	effective := 0.0
+	if client, ok := s.clientCache[req.ClientID]; ok {
+		client.HourlyCost = s.effectiveHourlyCostLocked(req.ClientID, client.Registration.HourlyCost)
+		effective = client.HourlyCost
+	}
+	s.mu.Unlock()
+
+	LogInfoWithData("Updated backend cost override", map[string]interface{}{
+		"client_id":   req.ClientID,
+		"hourly_cost": effective,
+		"cleared":     req.HourlyCost == nil,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "updated",
+		"client_id":   req.ClientID,
+		"hourly_cost": effective,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode cost override response: %v", err)
+	}
+}
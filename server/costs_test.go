@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestCostWeight_PrefersCheaperBackend verifies cost breaks ties between equivalent backends
+func TestCostWeight_PrefersCheaperBackend(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.CostWeight = 10.0
+	})
+
+	cloud := NewMockClient(MockClientOptions{ClientID: "cloud"})
+	cloud.HourlyCost = 2.50
+	onPrem := NewMockClient(MockClientOptions{ClientID: "on-prem"})
+	onPrem.HourlyCost = 0.40
+	server.AddMockClient(cloud)
+	server.AddMockClient(onPrem)
+
+	client := server.findBestClient(server.tierSpecs["lite"], 0, 0)
+	AssertClientSelected(t, client, "on-prem")
+}
+
+// TestCostWeight_IgnoredByDefault verifies cost has no effect without a weight
+func TestCostWeight_IgnoredByDefault(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+
+	expensiveIdle := NewMockClient(MockClientOptions{ClientID: "expensive-idle", CPUUsageAvg: []float64{5, 5, 5, 5}})
+	expensiveIdle.HourlyCost = 100
+	cheapBusy := NewMockClient(MockClientOptions{ClientID: "cheap-busy", CPUUsageAvg: []float64{60, 60, 60, 60}})
+	server.AddMockClient(expensiveIdle)
+	server.AddMockClient(cheapBusy)
+
+	client := server.findBestClient(server.tierSpecs["lite"], 0, 0)
+	AssertClientSelected(t, client, "expensive-idle")
+}
+
+// TestHandleCosts_OverrideAndReport verifies admin overrides apply and appear in the report
+func TestHandleCosts_OverrideAndReport(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	client := NewMockClient(MockClientOptions{ClientID: "backend-1"})
+	client.Registration.HourlyCost = 1.0
+	client.HourlyCost = 1.0
+	server.AddMockClient(client)
+	RegisterMockClientInDB(t, db, client)
+
+	body, _ := json.Marshal(map[string]interface{}{"client_id": "backend-1", "hourly_cost": 3.0})
+	rec := httptest.NewRecorder()
+	server.handleCosts(rec, httptest.NewRequest("PUT", "/costs", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if client.HourlyCost != 3.0 {
+		t.Errorf("Expected override to apply, got hourly cost %.2f", client.HourlyCost)
+	}
+
+	// Route two sessions and record a 2-hour sticky session
+	server.addPendingAllocation("backend-1", "", "lite", server.tierSpecs["lite"], "req-1")
+	server.addPendingAllocation("backend-1", "", "lite", server.tierSpecs["lite"], "req-2")
+	if _, err := db.Exec(`INSERT INTO sticky_assignments (sticky_id, tier, client_id, created_at, last_used)
+		VALUES ('user-1', 'lite', 'backend-1', datetime('now', '-2 hours'), datetime('now'))`); err != nil {
+		t.Fatalf("Failed to insert sticky assignment: %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	server.handleCosts(rec, httptest.NewRequest("GET", "/costs", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var report struct {
+		Backends           []BackendCostReport `json:"backends"`
+		TotalEstimatedCost float64             `json:"total_estimated_cost"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if len(report.Backends) != 1 {
+		t.Fatalf("Expected 1 backend in report, got %d", len(report.Backends))
+	}
+
+	b := report.Backends[0]
+	if !b.CostOverridden || b.HourlyCost != 3.0 {
+		t.Errorf("Expected overridden cost 3.0, got %.2f (overridden=%v)", b.HourlyCost, b.CostOverridden)
+	}
+	if b.RoutedSessions != 2 {
+		t.Errorf("Expected 2 routed sessions, got %d", b.RoutedSessions)
+	}
+	if b.SessionHours < 1.99 || b.SessionHours > 2.01 {
+		t.Errorf("Expected ~2 session hours, got %.3f", b.SessionHours)
+	}
+	if b.EstimatedCost < 5.9 || b.EstimatedCost > 6.1 {
+		t.Errorf("Expected ~6.0 estimated cost, got %.3f", b.EstimatedCost)
+	}
+
+	// Overrides survive restart
+	restarted := NewTestServer(t, db)
+	if err := restarted.loadCostOverrides(); err != nil {
+		t.Fatalf("Failed to load cost overrides: %v", err)
+	}
+	if err := restarted.loadClients(); err != nil {
+		t.Fatalf("Failed to load clients: %v", err)
+	}
+	if restarted.clientCache["backend-1"].HourlyCost != 3.0 {
+		t.Errorf("Expected persisted override 3.0, got %.2f", restarted.clientCache["backend-1"].HourlyCost)
+	}
+}
+
+// TestHandleCosts_ClearOverride verifies a null cost removes the override
+func TestHandleCosts_ClearOverride(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	client := NewMockClient(MockClientOptions{ClientID: "backend-1"})
+	client.Registration.HourlyCost = 1.5
+	server.AddMockClient(client)
+
+	for _, payload := range []string{`{"client_id":"backend-1","hourly_cost":9}`, `{"client_id":"backend-1","hourly_cost":null}`} {
+		rec := httptest.NewRecorder()
+		server.handleCosts(rec, httptest.NewRequest("PUT", "/costs", bytes.NewReader([]byte(payload))))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+	}
+
+	if client.HourlyCost != 1.5 {
+		t.Errorf("Expected registered cost after clearing override, got %.2f", client.HourlyCost)
+	}
+
+	rec := httptest.NewRecorder()
+	server.handleCosts(rec, httptest.NewRequest("PUT", "/costs", bytes.NewReader([]byte(`{"client_id":"backend-1","hourly_cost":-1}`))))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for negative cost, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"cyqle.in/opsen/common"
+)
+
+// How a backend's per-core usage is turned into free vCPUs (cpu_headroom)
+const (
+	CPUHeadroomPerCore = "per_core" // Each core below core_threshold counts as one free vCPU (default)
+	CPUHeadroomTotal   = "total"    // Unused capacity below core_threshold, summed over all cores, in whole vCPUs
+)
+
+// defaultCoreThreshold is the usage (percent) below which a core is available
+const defaultCoreThreshold = 80.0
+
+// CPUCapacityRule is how free vCPUs are counted for a tier, as shown by GET /tiers
+type CPUCapacityRule struct {
+	Policy        string  `json:"policy"`
+	CoreThreshold float64 `json:"core_threshold"`
+	Window        string  `json:"cpu_window"`
+	Description   string  `json:"description"`
+}
+
+// validateCPUHeadroom checks the server's core_threshold and cpu_headroom
+func validateCPUHeadroom(config *common.ServerConfig) error {
+	return checkCPUHeadroom("", config.CoreThreshold, config.CPUHeadroom)
+}
+
+// validateTierCPUHeadroom checks a tier's core_threshold and cpu_headroom overrides
+func validateTierCPUHeadroom(tier common.TierSpec) error {
+	return checkCPUHeadroom("tier "+tier.Name+": ", tier.CoreThreshold, tier.CPUHeadroom)
+}
+
+func checkCPUHeadroom(prefix string, threshold float64, policy string) error {
+	if threshold < 0 || threshold > 100 {
+		return fmt.Errorf("%score_threshold must be between 0 and 100, got %g", prefix, threshold)
+	}
+	switch policy {
+	case "", CPUHeadroomPerCore, CPUHeadroomTotal:
+		return nil
+	default:
+		return fmt.Errorf("%sunknown cpu_headroom %q (want %s or %s)", prefix, policy, CPUHeadroomPerCore, CPUHeadroomTotal)
+	}
+}
+
+// cpuCapacityRule returns the rule counting free vCPUs for a tier: its overrides, else the server's settings
+// The zero TierSpec gives the server-wide rule behind backendHeadroomLocked
+func (s *Server) cpuCapacityRule(tier common.TierSpec) CPUCapacityRule {
+	rule := CPUCapacityRule{Policy: s.config.CPUHeadroom, CoreThreshold: s.config.CoreThreshold, Window: tier.CPUWindow}
+	if tier.CPUHeadroom != "" {
+		rule.Policy = tier.CPUHeadroom
+	}
+	if tier.CoreThreshold > 0 {
+		rule.CoreThreshold = tier.CoreThreshold
+	}
+	if rule.Policy == "" {
+		rule.Policy = CPUHeadroomPerCore
+	}
+	if rule.CoreThreshold <= 0 {
+		rule.CoreThreshold = defaultCoreThreshold
+	}
+	if rule.Window == "" {
+		rule.Window = CPUWindowLong
+	}
+	return rule
+}
+
+// describe fills in the rule's description for GET /tiers
+func (r CPUCapacityRule) describe() CPUCapacityRule {
+	if r.Policy == CPUHeadroomTotal {
+		r.Description = fmt.Sprintf("Free vCPUs are the unused CPU below %g%% of every core, summed over all cores (%s average) and rounded down; busy cores offset idle ones", r.CoreThreshold, r.Window)
+	} else {
+		r.Description = fmt.Sprintf("Each core under %g%% usage (%s average) counts as one free vCPU", r.CoreThreshold, r.Window)
+	}
+	return r
+}
+
+// availableVCPU counts a backend's free vCPUs under the rule
+func (r CPUCapacityRule) availableVCPU(stats common.ResourceStats) int {
+	return availableCores(tierCPUUsage(stats, r.Window), r.CoreThreshold, r.Policy)
+}
+
+// availableCores counts free vCPUs in per-core usage (percent)
+func availableCores(usage []float64, threshold float64, policy string) int {
+	if policy == CPUHeadroomTotal {
+		spare := 0.0
+		for _, u := range usage {
+			spare += threshold - u
+		}
+		return max(0, int(math.Floor(spare/100)))
+	}
+
+	cores := 0
+	for _, u := range usage {
+		if u < threshold {
+			cores++
+		}
+	}
+	return cores
+}
+
+// withTierCPU adjusts a backend's headroom to count free cores the way tier does (CPU window, threshold and policy)
+func (s *Server) withTierCPU(headroom backendHeadroom, client *ClientState, tier common.TierSpec) backendHeadroom {
+	rule, base := s.cpuCapacityRule(tier), s.cpuCapacityRule(common.TierSpec{})
+	if rule == base {
+		return headroom
+	}
+	headroom.VCPU += rule.availableVCPU(client.Stats) - base.availableVCPU(client.Stats)
+	return headroom
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestAvailableCores verifies the per-core and total policies count free vCPUs against the threshold
+func TestAvailableCores(t *testing.T) {
+	tests := []struct {
+		name      string
+		usage     []float64
+		threshold float64
+		policy    string
+		want      int
+	}{
+		{"per-core below threshold", []float64{50, 50, 79, 80}, 80, CPUHeadroomPerCore, 3},
+		{"per-core higher threshold", []float64{50, 50, 79, 85}, 90, CPUHeadroomPerCore, 4},
+		{"total sums partial cores", []float64{50, 50, 50, 50}, 80, CPUHeadroomTotal, 1},
+		{"total offsets busy cores", []float64{10, 10, 100, 100}, 80, CPUHeadroomTotal, 1},
+		{"total never negative", []float64{100, 100}, 80, CPUHeadroomTotal, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := availableCores(tt.usage, tt.threshold, tt.policy); got != tt.want {
+				t.Errorf("Expected %d free vCPUs, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestCPUHeadroom_ServerAndTierRules verifies the server's threshold and policy apply to every tier unless it overrides them
+func TestCPUHeadroom_ServerAndTierRules(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.CoreThreshold = 90
+	})
+	// Four cores at 85%: available under a 90% threshold, not under 80%
+	warm := NewMockClient(MockClientOptions{ClientID: "warm", CPUUsageAvg: []float64{85, 85, 85, 85}})
+	server.AddMockClient(warm)
+
+	if !server.hasResources(warm, common.TierSpec{Name: "batch", VCPU: 4, MemoryGB: 1}) {
+		t.Error("Expected core_threshold 90 to count cores at 85% as available")
+	}
+	if server.hasResources(warm, common.TierSpec{Name: "strict", VCPU: 1, MemoryGB: 1, CoreThreshold: 80}) {
+		t.Error("Expected a tier with core_threshold 80 to find no free core")
+	}
+	// Total policy: 4 x 5% below the threshold is not a whole vCPU
+	if server.hasResources(warm, common.TierSpec{Name: "pooled", VCPU: 1, MemoryGB: 1, CPUHeadroom: CPUHeadroomTotal}) {
+		t.Error("Expected the total policy to find less than one vCPU of unused capacity")
+	}
+
+	rule := server.cpuCapacityRule(common.TierSpec{CPUHeadroom: CPUHeadroomTotal, CPUWindow: CPUWindowShort}).describe()
+	if rule.Policy != CPUHeadroomTotal || rule.CoreThreshold != 90 || rule.Window != CPUWindowShort || rule.Description == "" {
+		t.Errorf("Expected the tier's policy with the server's threshold, got %+v", rule)
+	}
+}
+
+// TestHandleTiers_CPUCapacity verifies GET /tiers explains how each tier's free vCPUs are counted
+func TestHandleTiers_CPUCapacity(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	rec := httptest.NewRecorder()
+	server.handleTiers(rec, httptest.NewRequest("GET", "/tiers", nil))
+	var resp struct {
+		Tiers []TierUtilization `json:"tiers"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	for _, tier := range resp.Tiers {
+		capacity := tier.CPUCapacity
+		if capacity.Policy != CPUHeadroomPerCore || capacity.CoreThreshold != 80 || !strings.Contains(capacity.Description, "80%") {
+			t.Errorf("Expected tier %s to report the default per-core rule, got %+v", tier.Name, capacity)
+		}
+	}
+}
+
+// TestValidateCPUHeadroom verifies thresholds outside 0-100 and unknown policies are rejected
+func TestValidateCPUHeadroom(t *testing.T) {
+	if err := validateCPUHeadroom(&common.ServerConfig{CoreThreshold: 80, CPUHeadroom: CPUHeadroomTotal}); err != nil {
+		t.Errorf("Expected a valid configuration, got %v", err)
+	}
+	if err := validateCPUHeadroom(&common.ServerConfig{CoreThreshold: 120}); err == nil {
+		t.Error("Expected a threshold above 100 to be rejected")
+	}
+	if err := validateTierCPUHeadroom(common.TierSpec{Name: "lite", CPUHeadroom: "average"}); err == nil {
+		t.Error("Expected an unknown tier cpu_headroom to be rejected")
+	}
+}
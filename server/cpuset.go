@@ -0,0 +1,95 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// leastLoadedCores returns the indices of all cores ordered by usage (ascending, ties by index)
+func leastLoadedCores(cpuUsageAvg []float64) []int {
+	cores := make([]int, len(cpuUsageAvg))
+	for i := range cores {
+		cores[i] = i
+	}
+	sort.SliceStable(cores, func(i, j int) bool {
+		return cpuUsageAvg[cores[i]] < cpuUsageAvg[cores[j]]
+	})
+	return cores
+}
+
+// pickCPUSetLocked chooses the tier's vcpu least-loaded cores of a client, over its CPU window, for a new workload
+// Cores already suggested to in-flight allocations are skipped while enough others remain,
+// so concurrent sessions on one backend are not pinned to the same cores
+// Must be called with s.mu held
+func (s *Server) pickCPUSetLocked(client *ClientState, tier common.TierSpec) []int {
+	usage := tierCPUUsage(client.Stats, tier.CPUWindow)
+	vcpu := tier.VCPU
+	if vcpu <= 0 || len(usage) == 0 {
+		return nil
+	}
+	if vcpu > len(usage) {
+		vcpu = len(usage)
+	}
+
+	reserved := make(map[int]bool)
+	now := time.Now()
+	for _, pending := range s.pendingAllocations[client.Registration.ClientID] {
+		if pending.expired(now) {
+			continue
+		}
+		for _, core := range pending.CPUSet {
+			reserved[core] = true
+		}
+	}
+
+	ordered := leastLoadedCores(usage)
+	if len(usage)-len(reserved) >= vcpu {
+		free := ordered[:0:0]
+		for _, core := range ordered {
+			if !reserved[core] {
+				free = append(free, core)
+			}
+		}
+		ordered = free
+	}
+
+	cpuset := append([]int(nil), ordered[:vcpu]...)
+	sort.Ints(cpuset)
+	return cpuset
+}
+
+// suggestedCPUSet returns the cores assumed for a routed request in cpuset list format (e.g. "0-2,5")
+// New sessions reuse the cores recorded with their pending allocation; sticky hits get a fresh pick
+func (s *Server) suggestedCPUSet(client *ClientState, tierSpec common.TierSpec, requestID string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, pending := range s.pendingAllocations[client.Registration.ClientID] {
+		if pending.RequestID == requestID && len(pending.CPUSet) > 0 {
+			return formatCPUSet(pending.CPUSet)
+		}
+	}
+	return formatCPUSet(s.pickCPUSetLocked(client, tierSpec))
+}
+
+// formatCPUSet renders sorted core indices as a cpuset list, collapsing consecutive runs into ranges
+func formatCPUSet(cores []int) string {
+	parts := []string{}
+	for i := 0; i < len(cores); {
+		j := i
+		for j+1 < len(cores) && cores[j+1] == cores[j]+1 {
+			j++
+		}
+		if j == i {
+			parts = append(parts, strconv.Itoa(cores[i]))
+		} else {
+			parts = append(parts, strconv.Itoa(cores[i])+"-"+strconv.Itoa(cores[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestFormatCPUSet verifies consecutive cores collapse into ranges
+func TestFormatCPUSet(t *testing.T) {
+	cases := map[string][]int{
+		"":        nil,
+		"3":       {3},
+		"0-2,5":   {0, 1, 2, 5},
+		"1,3,6-7": {1, 3, 6, 7},
+	}
+	for expected, cores := range cases {
+		if got := formatCPUSet(cores); got != expected {
+			t.Errorf("Expected %q for %v, got %q", expected, cores, got)
+		}
+	}
+}
+
+// TestPickCPUSet_AvoidsPendingCores verifies concurrent sessions on one backend get different cores
+func TestPickCPUSet_AvoidsPendingCores(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	client := NewMockClient(MockClientOptions{
+		ClientID:    "pin-client",
+		CPUUsageAvg: []float64{70, 5, 60, 10, 50, 20, 40, 30},
+		MemoryAvail: 50.0,
+		DiskAvail:   100.0,
+	})
+	server.AddMockClient(client)
+
+	tierSpec := common.TierSpec{Name: "pair", VCPU: 2, MemoryGB: 1}
+	server.addPendingAllocation("pin-client", "user-1", "pair", tierSpec, "req-1")
+	server.addPendingAllocation("pin-client", "user-2", "pair", tierSpec, "req-2")
+
+	if got := server.suggestedCPUSet(client, tierSpec, "req-1"); got != "1,3" {
+		t.Errorf("Expected first session on cores 1,3, got %q", got)
+	}
+	if got := server.suggestedCPUSet(client, tierSpec, "req-2"); got != "5,7" {
+		t.Errorf("Expected second session on the next least-loaded cores 5,7, got %q", got)
+	}
+}
+
+// TestHandleRoute_SuggestedCPUSet verifies /route returns the least-loaded cores for the tier
+func TestHandleRoute_SuggestedCPUSet(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{
+		ClientID:    "route-client",
+		CPUUsageAvg: []float64{40, 10, 30, 20, 50, 60, 70, 75},
+		MemoryAvail: 50.0,
+		DiskAvail:   100.0,
+	}))
+
+	body, _ := json.Marshal(common.RoutingRequest{Tier: "pro-standard"})
+	rec := httptest.NewRecorder()
+	server.handleRoute(rec, httptest.NewRequest("POST", "/route", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response common.RoutingResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.SuggestedCPUSet != "1,3" {
+		t.Errorf("Expected suggested_cpuset 1,3 for 2 vCPUs, got %q", response.SuggestedCPUSet)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+
+	"cyqle.in/opsen/common"
+)
+
+// CPU averages a tier can route on (cpu_window)
+const (
+	CPUWindowLong  = "long"  // Agent's window_minutes average (default)
+	CPUWindowShort = "short" // Agent's short_window_seconds average, for latency-critical tiers
+)
+
+// validateCPUWindow checks a tier's cpu_window
+func validateCPUWindow(tier common.TierSpec) error {
+	switch tier.CPUWindow {
+	case "", CPUWindowLong, CPUWindowShort:
+		return nil
+	default:
+		return fmt.Errorf("tier %s: unknown cpu_window %q (want %s or %s)", tier.Name, tier.CPUWindow, CPUWindowLong, CPUWindowShort)
+	}
+}
+
+// tierCPUUsage returns a backend's per-core CPU usage over the window a tier routes on
+// Agents that don't report a short window (or report one for a different core count) fall back to the long average
+func tierCPUUsage(stats common.ResourceStats, window string) []float64 {
+	if window == CPUWindowShort && len(stats.CPUUsageShort) > 0 && len(stats.CPUUsageShort) == len(stats.CPUUsageAvg) {
+		return stats.CPUUsageShort
+	}
+	return stats.CPUUsageAvg
+}
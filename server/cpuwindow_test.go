@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestCPUWindow_PerTier verifies short-window tiers see a load spike the long average hides, and others don't
+func TestCPUWindow_PerTier(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+
+	// Quiet over 15 minutes, but three cores busy in the last minute
+	spiky := NewMockClient(MockClientOptions{ClientID: "spiky", CPUUsageAvg: []float64{20, 20, 20, 20}})
+	spiky.Stats.CPUUsageShort = []float64{95, 95, 20, 95}
+	spiky.Stats.CPUShortWindowSecs = 60
+	legacy := NewMockClient(MockClientOptions{ClientID: "legacy", CPUUsageAvg: []float64{20, 20, 20, 20}})
+	server.AddMockClient(spiky)
+	server.AddMockClient(legacy)
+
+	long := common.TierSpec{Name: "batch", VCPU: 2, MemoryGB: 1}
+	short := common.TierSpec{Name: "realtime", VCPU: 2, MemoryGB: 1, CPUWindow: CPUWindowShort}
+
+	if !server.hasResources(spiky, long) {
+		t.Error("Expected the long-window tier to fit on the long average")
+	}
+	if server.hasResources(spiky, short) {
+		t.Error("Expected the short-window tier to skip a backend with one free core in the last minute")
+	}
+	// Agents that don't report a short window are placed on their long average
+	if !server.hasResources(legacy, short) {
+		t.Error("Expected a backend without a short window to fall back to the long average")
+	}
+
+	if server.placementScore(spiky, short, 0) <= server.placementScore(legacy, short, 0) {
+		t.Error("Expected the short-window tier to score the spiking backend worse")
+	}
+	if server.placementScore(spiky, long, 0) != server.placementScore(legacy, long, 0) {
+		t.Error("Expected the long-window tier to score both backends alike")
+	}
+
+	server.mu.RLock()
+	cpuset := server.pickCPUSetLocked(spiky, common.TierSpec{Name: "realtime", VCPU: 1, CPUWindow: CPUWindowShort})
+	server.mu.RUnlock()
+	if len(cpuset) != 1 || cpuset[0] != 2 {
+		t.Errorf("Expected the core idle in the short window, got %v", cpuset)
+	}
+}
+
+// TestValidateCPUWindow verifies unknown windows are rejected with the tier set
+func TestValidateCPUWindow(t *testing.T) {
+	if _, err := buildTierSpecs([]common.TierSpec{{Name: "ok", VCPU: 1, CPUWindow: CPUWindowShort}}); err != nil {
+		t.Errorf("Expected a known window to be accepted, got %v", err)
+	}
+	if _, err := buildTierSpecs([]common.TierSpec{{Name: "bad", VCPU: 1, CPUWindow: "5m"}}); err == nil {
+		t.Error("Expected an unknown cpu_window to be rejected")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// debugRecentGCPauses is how many of the latest GC pauses GET /debug/status lists
+const debugRecentGCPauses = 10
+
+// proxyConnections counts proxied requests in flight, for GET /debug/status
+type proxyConnections struct {
+	requests   atomic.Int64 // Plain HTTP requests
+	websockets atomic.Int64 // Upgraded connections, open until either side closes
+}
+
+// trackProxyConnection counts a proxied request until the returned func is called
+func (s *Server) trackProxyConnection(websocket bool) func() {
+	counter := &s.proxyConns.requests
+	if websocket {
+		counter = &s.proxyConns.websockets
+	}
+	counter.Add(1)
+	return func() { counter.Add(-1) }
+}
+
+// handleDebugStatus reports the server's own runtime and process health: goroutines, heap,
+// GC pauses, the database pool and open proxy connections
+func (s *Server) handleDebugStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	// PauseNs is a circular buffer; the most recent pause is at (NumGC+255)%256
+	recentPauses := []float64{}
+	for i := uint32(0); i < min(mem.NumGC, debugRecentGCPauses); i++ {
+		pause := mem.PauseNs[(mem.NumGC-1-i)%uint32(len(mem.PauseNs))]
+		recentPauses = append(recentPauses, float64(pause)/1e6)
+	}
+	gc := map[string]interface{}{
+		"count":            mem.NumGC,
+		"pause_total_ms":   float64(mem.PauseTotalNs) / 1e6,
+		"recent_pauses_ms": recentPauses,
+		"cpu_fraction":     mem.GCCPUFraction,
+		"next_heap_bytes":  mem.NextGC,
+	}
+	if mem.LastGC > 0 {
+		gc["last_at"] = time.Unix(0, int64(mem.LastGC)).UTC()
+	}
+
+	db := s.db.Stats()
+
+	response := map[string]interface{}{
+		"started_at":     s.startedAt.UTC(),
+		"uptime_seconds": int64(time.Since(s.startedAt).Seconds()),
+		"go_version":     runtime.Version(),
+		"goroutines":     runtime.NumGoroutine(),
+		"gomaxprocs":     runtime.GOMAXPROCS(0),
+		"heap": map[string]interface{}{
+			"alloc_bytes":    mem.HeapAlloc,
+			"inuse_bytes":    mem.HeapInuse,
+			"idle_bytes":     mem.HeapIdle,
+			"released_bytes": mem.HeapReleased,
+			"objects":        mem.HeapObjects,
+			"sys_bytes":      mem.Sys,
+		},
+		"gc": gc,
+		"database": map[string]interface{}{
+			"max_open":            db.MaxOpenConnections,
+			"open":                db.OpenConnections,
+			"in_use":              db.InUse,
+			"idle":                db.Idle,
+			"wait_count":          db.WaitCount,
+			"wait_ms":             db.WaitDuration.Milliseconds(),
+			"max_idle_closed":     db.MaxIdleClosed,
+			"max_lifetime_closed": db.MaxLifetimeClosed,
+		},
+		"proxy": map[string]interface{}{
+			"open_requests":   s.proxyConns.requests.Load(),
+			"open_websockets": s.proxyConns.websockets.Load(),
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Warning: Failed to encode debug status: %v", err)
+	}
+}
+
+// registerPprofHandlers serves net/http/pprof under /debug/pprof/ (debug_pprof)
+// middlewares must not include a request timeout: CPU profiles and traces run for ?seconds=
+func registerPprofHandlers(mux *http.ServeMux, middlewares ...func(http.Handler) http.Handler) {
+	mux.Handle("/debug/pprof/", ChainMiddleware(http.HandlerFunc(pprof.Index), middlewares...))
+	mux.Handle("/debug/pprof/cmdline", ChainMiddleware(http.HandlerFunc(pprof.Cmdline), middlewares...))
+	mux.Handle("/debug/pprof/profile", ChainMiddleware(http.HandlerFunc(pprof.Profile), middlewares...))
+	mux.Handle("/debug/pprof/symbol", ChainMiddleware(http.HandlerFunc(pprof.Symbol), middlewares...))
+	mux.Handle("/debug/pprof/trace", ChainMiddleware(http.HandlerFunc(pprof.Trace), middlewares...))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type debugStatusResponse struct {
+	UptimeSecs int64 `json:"uptime_seconds"`
+	Goroutines int   `json:"goroutines"`
+	Heap       struct {
+		AllocBytes uint64 `json:"alloc_bytes"`
+	} `json:"heap"`
+	GC struct {
+		Count        uint32    `json:"count"`
+		RecentPauses []float64 `json:"recent_pauses_ms"`
+	} `json:"gc"`
+	Database struct {
+		MaxOpen int `json:"max_open"`
+		Open    int `json:"open"`
+	} `json:"database"`
+	Proxy struct {
+		OpenRequests int64 `json:"open_requests"`
+	} `json:"proxy"`
+}
+
+func debugStatus(t *testing.T, server *Server) debugStatusResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	server.handleDebugStatus(rec, httptest.NewRequest("GET", "/debug/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var response debugStatusResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return response
+}
+
+// TestDebugStatus_RuntimeMetrics verifies GET /debug/status reports goroutines, heap, GC and the database pool
+func TestDebugStatus_RuntimeMetrics(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	db.SetMaxOpenConns(4)
+
+	status := debugStatus(t, server)
+	if status.Goroutines == 0 || status.Heap.AllocBytes == 0 {
+		t.Errorf("Expected goroutine and heap figures, got %+v", status)
+	}
+	if status.GC.Count > 0 && len(status.GC.RecentPauses) == 0 {
+		t.Errorf("Expected recent GC pauses after %d collections", status.GC.Count)
+	}
+	if status.Database.MaxOpen != 4 || status.Database.Open == 0 {
+		t.Errorf("Expected the database pool stats, got %+v", status.Database)
+	}
+
+	rec := httptest.NewRecorder()
+	server.handleDebugStatus(rec, httptest.NewRequest("POST", "/debug/status", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", rec.Code)
+	}
+}
+
+// TestDebugStatus_OpenProxyRequests verifies requests still being proxied are counted until they finish
+func TestDebugStatus_OpenProxyRequests(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	server.proxyEndpoints = []string{"/api"}
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-a", Endpoint: backend.URL}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.handleProxy(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/slow?tier=lite", nil))
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for debugStatus(t, server).Proxy.OpenRequests != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected one open proxy request while the backend is answering")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(release)
+	<-done
+	if open := debugStatus(t, server).Proxy.OpenRequests; open != 0 {
+		t.Errorf("Expected no open proxy requests once it finished, got %d", open)
+	}
+}
+
+// TestRegisterPprofHandlers verifies the pprof index is served behind the given middlewares
+func TestRegisterPprofHandlers(t *testing.T) {
+	mux := http.NewServeMux()
+	registerPprofHandlers(mux, NewAPIKeyAuth("server-key", nil).Middleware)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected pprof to require a key, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/debug/pprof/", nil)
+	req.Header.Set("X-API-Key", "server-key")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the pprof index, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// deregisterResult counts the records removed along with deregistered backends
+type deregisterResult struct {
+	Clients int64 `json:"clients"`
+	Stats   int64 `json:"stats"`
+	Sticky  int64 `json:"sticky_assignments"`
+	Errors  int64 `json:"errors"`
+	Pending int   `json:"pending_allocations"`
+}
+
+// removeClientStateLocked drops a backend, its pending allocations and sticky assignments from memory
+// Caller must hold s.mu (write)
+func (s *Server) removeClientStateLocked(clientID string, result *deregisterResult) {
+	delete(s.clientCache, clientID)
+	s.outliers.Remove(clientID)
+	s.breakers.Remove(clientID)
+	s.concurrency.Remove(clientID)
+	s.uploads.Remove(clientID)
+	s.routeCache.Invalidate(clientID)
+
+	result.Pending += len(s.pendingAllocations[clientID])
+	delete(s.pendingAllocations, clientID)
+	s.reservations.remove(clientID)
+
+	for key := range s.clientErrorAlerts {
+		if strings.HasPrefix(key, clientID+"\x00") {
+			delete(s.clientErrorAlerts, key)
+		}
+	}
+
+	for stickyID, tierMap := range s.stickyAssignments {
+		for tier, assigned := range tierMap {
+			if assigned == clientID {
+				delete(tierMap, tier)
+			}
+		}
+		if len(tierMap) == 0 {
+			delete(s.stickyAssignments, stickyID)
+		}
+	}
+}
+
+// deleteClientRecords synchronously removes backends with their stats, sticky assignments and errors
+func (s *Server) deleteClientRecords(clientIDs []string, result *deregisterResult) error {
+	return s.janitor.Delete(clientIDs, result)
+}
+
+// deregisterClients removes backends from memory and the database, cascading to their
+// stats, sticky assignments and pending allocations
+func (s *Server) deregisterClients(clientIDs []string, reason string) deregisterResult {
+	var result deregisterResult
+	if len(clientIDs) == 0 {
+		return result
+	}
+
+	s.mu.Lock()
+	s.invalidateRoutingSnapshot()
+	for _, id := range clientIDs {
+		s.removeClientStateLocked(id, &result)
+	}
+	s.mu.Unlock()
+	s.publishClientsRemoved(clientIDs, reason)
+
+	s.finishDeregistration(clientIDs, reason, &result)
+	return result
+}
+
+// deregisterStaleClients deregisters cached backends not seen within expiryFactor times their stale timeout
+// Selection and removal from the cache happen under one lock so a backend reporting concurrently is not lost
+// In the background the database records are left to the janitor and result only counts in-memory state
+func (s *Server) deregisterStaleClients(expiryFactor int, reason string, background bool) ([]string, deregisterResult) {
+	var result deregisterResult
+	staleIDs := []string{}
+
+	s.mu.Lock()
+	s.invalidateRoutingSnapshot()
+	for id, client := range s.clientCache {
+		if time.Since(client.LastSeen) > s.staleTimeoutFor(client)*time.Duration(expiryFactor) {
+			staleIDs = append(staleIDs, id)
+			s.removeClientStateLocked(id, &result)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(staleIDs) > 0 {
+		s.publishClientsRemoved(staleIDs, reason)
+		if background {
+			s.scheduleDeregistration(staleIDs, reason, result)
+		} else {
+			s.finishDeregistration(staleIDs, reason, &result)
+		}
+	}
+	return staleIDs, result
+}
+
+// finishDeregistration deletes the database records of backends already removed from memory
+func (s *Server) finishDeregistration(clientIDs []string, reason string, result *deregisterResult) {
+	start := time.Now()
+	if err := s.deleteClientRecords(clientIDs, result); err != nil {
+		LogError(fmt.Sprintf("Failed to delete client records (%s): %v", reason, err))
+	}
+	logDeregistration(clientIDs, reason, *result, time.Since(start))
+}
+
+// scheduleDeregistration hands the database records of backends already removed from memory to the janitor,
+// deleting them inline only when its queue is full
+func (s *Server) scheduleDeregistration(clientIDs []string, reason string, result deregisterResult) {
+	if !s.janitor.Enqueue(clientIDs, reason, result) {
+		s.finishDeregistration(clientIDs, reason, &result)
+	}
+}
+
+// publishClientsRemoved reports backends dropped from memory on /events
+func (s *Server) publishClientsRemoved(clientIDs []string, reason string) {
+	s.events.Publish("clients.removed", map[string]interface{}{
+		"client_ids": clientIDs,
+		"reason":     reason,
+	})
+}
+
+// purgeInvalidClients deregisters database clients with missing or very old timestamps
+// In the background it returns the number of clients queued for the janitor
+func (s *Server) purgeInvalidClients(background bool) int64 {
+	rows, err := s.db.Query(`
+		SELECT client_id FROM clients
+		WHERE last_seen IS NULL
+		   OR last_seen = ''
+		   OR last_seen < datetime('now', '-30 days')
+	`)
+	if err != nil {
+		log.Printf("Error purging invalid clients: %v", err)
+		return 0
+	}
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	if len(ids) == 0 {
+		return 0
+	}
+
+	if background {
+		var result deregisterResult
+		s.mu.Lock()
+		s.invalidateRoutingSnapshot()
+		for _, id := range ids {
+			s.removeClientStateLocked(id, &result)
+		}
+		s.mu.Unlock()
+		s.publishClientsRemoved(ids, "invalid")
+		s.scheduleDeregistration(ids, "invalid", result)
+		return int64(len(ids))
+	}
+
+	result := s.deregisterClients(ids, "invalid")
+	log.Printf("Purged %d invalid/old clients from database", result.Clients)
+	return result.Clients
+}
+
+// handleClientByID handles DELETE /clients/{id}: explicit removal of a backend and its records
+// GET /clients/{id}/errors lists the backend's reported error events; POST /clients/{id}/approve releases a held backend
+func (s *Server) handleClientByID(w http.ResponseWriter, r *http.Request) {
+	clientID := strings.TrimPrefix(r.URL.Path, "/clients/")
+	if id, ok := strings.CutSuffix(clientID, "/errors"); ok && id != "" && !strings.Contains(id, "/") {
+		s.handleClientErrors(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(clientID, "/approve"); ok && id != "" && !strings.Contains(id, "/") {
+		s.handleApproveClient(w, r, id)
+		return
+	}
+	if clientID == "" || strings.Contains(clientID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.RLock()
+	_, cached := s.clientCache[clientID]
+	s.mu.RUnlock()
+
+	if !cached {
+		var exists int
+		err := s.db.QueryRow("SELECT 1 FROM clients WHERE client_id = ?", clientID).Scan(&exists)
+		if err == sql.ErrNoRows {
+			http.Error(w, fmt.Sprintf("Unknown client: %s", clientID), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to look up client: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	result := s.deregisterClients([]string{clientID}, "deleted")
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "deleted",
+		"client_id": clientID,
+		"removed":   result,
+		"timestamp": time.Now(),
+	}); err != nil {
+		log.Printf("Warning: Failed to encode delete client response: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// countRows returns the number of rows in table for a client
+func countRows(t *testing.T, server *Server, table, clientID string) int {
+	t.Helper()
+	var count int
+	if err := server.db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE client_id = ?", clientID).Scan(&count); err != nil {
+		t.Fatalf("Failed to count %s rows: %v", table, err)
+	}
+	return count
+}
+
+// TestDeregisterClients_Cascade verifies stats, sticky assignments and pending allocations go with the backend
+func TestDeregisterClients_Cascade(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	doomed := NewMockClient(MockClientOptions{ClientID: "doomed"})
+	survivor := NewMockClient(MockClientOptions{ClientID: "survivor"})
+	for _, client := range []*ClientState{doomed, survivor} {
+		server.AddMockClient(client)
+		RegisterMockClientInDB(t, db, client)
+	}
+
+	server.createStickyAssignment("user-1", "lite", "doomed")
+	server.createStickyAssignment("user-1", "pro-standard", "survivor")
+	server.createStickyAssignment("user-2", "lite", "doomed")
+	server.addPendingAllocation("doomed", "user-3", "lite", server.tierSpecs["lite"], "req-1")
+
+	result := server.deregisterClients([]string{"doomed"}, "test")
+	if result.Clients != 1 || result.Stats != 1 || result.Sticky != 2 || result.Pending != 1 {
+		t.Errorf("Expected 1 client, 1 stats row, 2 sticky rows and 1 pending allocation removed, got %+v", result)
+	}
+
+	for _, table := range []string{"clients", "stats", "sticky_assignments"} {
+		if n := countRows(t, server, table, "doomed"); n != 0 {
+			t.Errorf("Expected no %s rows for doomed, got %d", table, n)
+		}
+	}
+	if n := countRows(t, server, "sticky_assignments", "survivor"); n != 1 {
+		t.Errorf("Expected survivor's sticky row to remain, got %d", n)
+	}
+
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	if _, exists := server.clientCache["doomed"]; exists {
+		t.Error("Expected doomed to be removed from cache")
+	}
+	if len(server.pendingAllocations["doomed"]) != 0 {
+		t.Error("Expected doomed's pending allocations to be released")
+	}
+	if _, exists := server.stickyAssignments["user-2"]; exists {
+		t.Error("Expected user-2's only assignment to be removed")
+	}
+	if got := server.stickyAssignments["user-1"]["pro-standard"]; got != "survivor" {
+		t.Errorf("Expected user-1 pro-standard to stay on survivor, got %q", got)
+	}
+}
+
+// TestHandleClientByID_Delete verifies DELETE /clients/{id} removes a backend and rejects unknown ones
+func TestHandleClientByID_Delete(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	client := NewMockClient(MockClientOptions{ClientID: "backend-1"})
+	client.LastSeen = time.Now()
+	server.AddMockClient(client)
+	RegisterMockClientInDB(t, db, client)
+
+	rec := httptest.NewRecorder()
+	server.handleClientByID(rec, httptest.NewRequest("GET", "/clients/backend-1", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	server.handleClientByID(rec, httptest.NewRequest("DELETE", "/clients/backend-1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if n := countRows(t, server, "clients", "backend-1"); n != 0 {
+		t.Errorf("Expected client row to be deleted, got %d", n)
+	}
+
+	rec = httptest.NewRecorder()
+	server.handleClientByID(rec, httptest.NewRequest("DELETE", "/clients/backend-1", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for already deleted client, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import "cyqle.in/opsen/common"
+
+// diskIdleUtilPct is the busy share below which a disk's capacity can't be estimated; such disks always qualify
+const diskIdleUtilPct = 1.0
+
+// spareDiskMBps estimates the extra throughput a backend's disk can take
+// Capacity is extrapolated from the current throughput and busy share: a disk moving 100 MB/s at
+// 25% utilization has about 300 MB/s to spare. The device backing disk_path is used, else the busiest one
+// Returns false if the backend reports no disk I/O (older or non-Linux agents) or its disk is idle
+func spareDiskMBps(devices []common.DiskIOStats) (float64, bool) {
+	var dev *common.DiskIOStats
+	for i := range devices {
+		if devices[i].DiskPath {
+			dev = &devices[i]
+			break
+		}
+		if dev == nil || devices[i].UtilPct > dev.UtilPct {
+			dev = &devices[i]
+		}
+	}
+	if dev == nil || dev.UtilPct < diskIdleUtilPct {
+		return 0, false
+	}
+	if dev.UtilPct >= 100 {
+		return 0, true
+	}
+	throughput := dev.ReadMBps + dev.WriteMBps
+	return throughput * (100 - dev.UtilPct) / dev.UtilPct, true
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestMinDiskMBps_SkipsSaturatedDisks verifies I/O-heavy tiers avoid backends with busy disks despite free space
+func TestMinDiskMBps_SkipsSaturatedDisks(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.Tiers = append(c.Tiers, common.TierSpec{Name: "db", VCPU: 1, MemoryGB: 1.0, StorageGB: 10, MinDiskMBps: 100})
+	})
+
+	newBackend := func(id string, diskIO []common.DiskIOStats) *ClientState {
+		client := NewMockClient(MockClientOptions{ClientID: id})
+		client.Stats.DiskIO = diskIO
+		server.AddMockClient(client)
+		return client
+	}
+
+	// 200 MB/s at 95% busy leaves ~10 MB/s; the busier scratch disk is ignored when disk_path's device is known
+	saturated := newBackend("saturated", []common.DiskIOStats{{Device: "nvme0n1", DiskPath: true, ReadMBps: 150, WriteMBps: 50, UtilPct: 95}})
+	spare := newBackend("spare", []common.DiskIOStats{
+		{Device: "sda", DiskPath: true, ReadMBps: 40, WriteMBps: 10, UtilPct: 20},
+		{Device: "sdb", ReadMBps: 300, UtilPct: 99},
+	})
+	idle := newBackend("idle", []common.DiskIOStats{{Device: "sda", DiskPath: true, UtilPct: 0}})
+	legacy := newBackend("legacy", nil)
+
+	tests := []struct {
+		client *ClientState
+		want   bool
+	}{
+		{saturated, false},
+		{spare, true},
+		{idle, true},
+		{legacy, true},
+	}
+	for _, tt := range tests {
+		if got := server.hasResources(tt.client, server.tierSpecs["db"]); got != tt.want {
+			t.Errorf("hasResources(%s, db) = %v, want %v", tt.client.Registration.ClientID, got, tt.want)
+		}
+	}
+	if !server.hasResources(saturated, server.tierSpecs["lite"]) {
+		t.Error("Expected tiers without min_disk_mbps to ignore disk saturation")
+	}
+}
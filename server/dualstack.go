@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// defaultBackendPort is assumed for agents without endpoint_url when neither the agent nor default_endpoint_port sets one
+const defaultBackendPort = 11000
+
+// Address families recorded per backend by health checks
+const (
+	AddressFamilyIPv4 = "ipv4"
+	AddressFamilyIPv6 = "ipv6"
+)
+
+// endpointPort returns the port to build a backend's endpoint with
+func (s *Server) endpointPort(reg common.ClientRegistration) int {
+	if reg.EndpointPort > 0 {
+		return reg.EndpointPort
+	}
+	if s.config.DefaultEndpointPort > 0 {
+		return s.config.DefaultEndpointPort
+	}
+	return defaultBackendPort
+}
+
+// autoEndpoints builds the endpoints of an agent that did not set endpoint_url, one per advertised address
+// IPv4 comes first so single-stack load balancers keep their previous behavior; public_ip is only used
+// when the agent reported no usable local address
+func autoEndpoints(reg common.ClientRegistration, port int) []string {
+	var v4, v6 []string
+	add := func(addr string) {
+		ip := net.ParseIP(addr)
+		if ip == nil || ip.IsUnspecified() {
+			return
+		}
+		endpoint := "http://" + net.JoinHostPort(ip.String(), strconv.Itoa(port))
+		if ip.To4() != nil {
+			if !slices.Contains(v4, endpoint) {
+				v4 = append(v4, endpoint)
+			}
+		} else if !slices.Contains(v6, endpoint) {
+			v6 = append(v6, endpoint)
+		}
+	}
+
+	add(reg.LocalIP)
+	add(reg.LocalIPv6)
+	if len(v4)+len(v6) == 0 {
+		add(reg.PublicIP)
+	}
+	if len(v4)+len(v6) == 0 {
+		// Not an IP literal (a hostname, or "unknown"); use it as before
+		host := reg.LocalIP
+		if host == "" {
+			host = reg.PublicIP
+		}
+		return []string{"http://" + net.JoinHostPort(host, strconv.Itoa(port))}
+	}
+	return append(v4, v6...)
+}
+
+// endpointFamily returns the address family of an endpoint's host, or "" for hostnames
+func endpointFamily(endpoint string) string {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	ip := net.ParseIP(parsed.Hostname())
+	switch {
+	case ip == nil:
+		return ""
+	case ip.To4() != nil:
+		return AddressFamilyIPv4
+	default:
+		return AddressFamilyIPv6
+	}
+}
+
+// probeEndpoint runs the configured health check type against one endpoint
+// Only http-json probes return the backend's health report
+func (s *Server) probeEndpoint(endpoint string, timeout time.Duration) (bool, time.Duration, *BackendHealthReport) {
+	switch s.config.HealthCheckType {
+	case HealthCheckTypeHTTPJSON:
+		return s.probeHTTPJSON(endpoint, s.config.HealthCheckPath, timeout)
+	case "http":
+		ok, latency := s.probeHTTP(endpoint, s.config.HealthCheckPath, timeout)
+		return ok, latency, nil
+	case HealthCheckTypeUDP:
+		ok, latency := s.probeUDP(endpoint, timeout)
+		return ok, latency, nil
+	case HealthCheckTypeICMP:
+		ok, latency := s.probeICMP(endpoint, timeout)
+		return ok, latency, nil
+	case "tcp":
+		fallthrough
+	default:
+		ok, latency := s.probeTCP(endpoint, timeout)
+		return ok, latency, nil
+	}
+}
+
+// recordWorkingEndpoint stores the address family a health check reached and, when the backend
+// only answered on another family, routes to that address from now on
+func (s *Server) recordWorkingEndpoint(client *ClientState, probed, reached string) {
+	s.mu.Lock()
+	s.invalidateRoutingSnapshot()
+	client.AddressFamily = endpointFamily(reached)
+	// A re-registration may have replaced the endpoint while the probe was in flight
+	switched := reached != probed && client.Endpoint == probed
+	if switched {
+		client.Endpoint = reached
+	}
+	clientID := client.Registration.ClientID
+	candidates := client.EndpointCandidates
+	s.mu.Unlock()
+
+	if !switched {
+		return
+	}
+	s.routeCache.Invalidate(clientID)
+
+	LogInfoWithData("Backend endpoint switched address family", map[string]interface{}{
+		"client_id": clientID,
+		"previous":  probed,
+		"endpoint":  reached,
+		"family":    endpointFamily(reached),
+	})
+
+	candidatesJSON, _ := json.Marshal(candidates)
+	if _, err := s.db.Exec("UPDATE clients SET endpoint = ?, endpoint_candidates = ? WHERE client_id = ?",
+		reached, string(candidatesJSON), clientID); err != nil {
+		log.Printf("Warning: Failed to persist endpoint for %s: %v", clientID, err)
+	}
+}
+
+// validateEndpointPort rejects ports outside the TCP range (0 = use the default)
+func validateEndpointPort(port int) error {
+	if port < 0 || port > 65535 {
+		return fmt.Errorf("invalid endpoint_port: %d (expected 1-65535)", port)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"slices"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestAutoEndpoints verifies endpoints are built per address family with IPv6 hosts bracketed
+func TestAutoEndpoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		reg      common.ClientRegistration
+		port     int
+		expected []string
+	}{
+		{
+			name:     "dual stack, IPv4 first",
+			reg:      common.ClientRegistration{LocalIP: "10.0.0.5", LocalIPv6: "2001:db8::5"},
+			port:     12000,
+			expected: []string{"http://10.0.0.5:12000", "http://[2001:db8::5]:12000"},
+		},
+		{
+			name:     "IPv6 only",
+			reg:      common.ClientRegistration{LocalIPv6: "2001:db8::5", PublicIP: "unknown"},
+			port:     11000,
+			expected: []string{"http://[2001:db8::5]:11000"},
+		},
+		{
+			name:     "IPv6 address in local_ip",
+			reg:      common.ClientRegistration{LocalIP: "2001:db8::7"},
+			port:     11000,
+			expected: []string{"http://[2001:db8::7]:11000"},
+		},
+		{
+			name:     "public IP when no local address",
+			reg:      common.ClientRegistration{PublicIP: "203.0.113.10"},
+			port:     11000,
+			expected: []string{"http://203.0.113.10:11000"},
+		},
+		{
+			name:     "hostname kept as is",
+			reg:      common.ClientRegistration{LocalIP: "gpu-01.internal"},
+			port:     11000,
+			expected: []string{"http://gpu-01.internal:11000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := autoEndpoints(tt.reg, tt.port)
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestRegister_DualStackEndpoint verifies registration uses the reported port and keeps both families
+func TestRegister_DualStackEndpoint(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.DefaultEndpointPort = 9000
+	})
+
+	reg := common.ClientRegistration{ClientID: "dual", LocalIP: "10.0.0.5", LocalIPv6: "2001:db8::5", EndpointPort: 12000}
+	if rec := postRegistration(server, reg); rec.Code != http.StatusOK {
+		t.Fatalf("Expected registration to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	legacy := common.ClientRegistration{ClientID: "legacy", LocalIP: "10.0.0.6"}
+	if rec := postRegistration(server, legacy); rec.Code != http.StatusOK {
+		t.Fatalf("Expected registration to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	server.mu.RLock()
+	dual, old := server.clientCache["dual"], server.clientCache["legacy"]
+	server.mu.RUnlock()
+
+	if dual.Endpoint != "http://10.0.0.5:12000" {
+		t.Errorf("Expected the IPv4 endpoint first, got %s", dual.Endpoint)
+	}
+	if !slices.Contains(dual.EndpointCandidates, "http://[2001:db8::5]:12000") {
+		t.Errorf("Expected an IPv6 candidate, got %v", dual.EndpointCandidates)
+	}
+	if old.Endpoint != "http://10.0.0.6:9000" {
+		t.Errorf("Expected default_endpoint_port for agents without endpoint_port, got %s", old.Endpoint)
+	}
+
+	reg.EndpointPort = 70000
+	if rec := postRegistration(server, reg); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an out-of-range port, got %d", rec.Code)
+	}
+}
+
+// TestProbeClient_FallsBackToOtherFamily verifies a backend unreachable on IPv4 is switched to its IPv6 endpoint
+func TestProbeClient_FallsBackToOtherFamily(t *testing.T) {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	// A port nothing listens on stands in for the unreachable IPv4 address
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve a port: %v", err)
+	}
+	v4 := "http://" + closed.Addr().String()
+	closed.Close()
+	v6 := "http://" + listener.Addr().String()
+
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.HealthCheckTimeoutSecs = 1
+		c.HealthCheckHealthyThreshold = 1
+	})
+	client := NewMockClient(MockClientOptions{ClientID: "dual", Endpoint: v4})
+	client.EndpointCandidates = []string{v4, v6}
+	server.AddMockClient(client)
+
+	server.probeClient(client)
+
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	if client.Endpoint != v6 {
+		t.Errorf("Expected endpoint to switch to %s, got %s", v6, client.Endpoint)
+	}
+	if client.AddressFamily != AddressFamilyIPv6 {
+		t.Errorf("Expected address family ipv6, got %q", client.AddressFamily)
+	}
+	if client.HealthStatus != "healthy" {
+		t.Errorf("Expected backend healthy via IPv6, got %s", client.HealthStatus)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// errCodeDuplicateEndpoint is sent in X-LB-Error-Code when a registration is refused because a live backend
+// already advertises the same endpoint
+const errCodeDuplicateEndpoint = "duplicate_endpoint"
+
+const (
+	DuplicateEndpointPolicyReplace = "replace" // Deregister the live backends already using the endpoint (default)
+	DuplicateEndpointPolicyReject  = "reject"  // Refuse the new registration with 409; the first backend keeps the endpoint
+	DuplicateEndpointPolicyAllow   = "allow"   // Register alongside them and warn
+)
+
+// endpointConflictAlertInterval limits client.endpoint_conflict events to one per endpoint in this window
+// Rejected agents retry every report interval, and allowed ones re-register, which would otherwise flood the webhook
+const endpointConflictAlertInterval = 10 * time.Minute
+
+// validateDuplicateEndpointPolicy checks duplicate_endpoint_policy
+func validateDuplicateEndpointPolicy(policy string) error {
+	switch policy {
+	case "", DuplicateEndpointPolicyReplace, DuplicateEndpointPolicyReject, DuplicateEndpointPolicyAllow:
+		return nil
+	}
+	return fmt.Errorf("duplicate_endpoint_policy: unknown policy %q (want %s, %s or %s)", policy,
+		DuplicateEndpointPolicyReplace, DuplicateEndpointPolicyReject, DuplicateEndpointPolicyAllow)
+}
+
+// duplicateEndpointPolicy returns the configured policy, defaulting to replace
+func (s *Server) duplicateEndpointPolicy() string {
+	if s.config.DuplicateEndpointPolicy == "" {
+		return DuplicateEndpointPolicyReplace
+	}
+	return s.config.DuplicateEndpointPolicy
+}
+
+// endpointPeersLocked returns the other backends of a registration's tenant advertising the same endpoint,
+// split into stale ones (an agent that came back under a new client_id; always replaced) and live ones,
+// which the duplicate endpoint policy decides about. Endpoints are only compared within a tenant so one
+// tenant cannot evict another's backends. Caller must hold s.mu
+func (s *Server) endpointPeersLocked(reg common.ClientRegistration, endpoint string) (stale, live []string) {
+	for id, client := range s.clientCache {
+		if id == reg.ClientID || client.Endpoint != endpoint || normalizeTenant(client.Registration.Tenant) != reg.Tenant {
+			continue
+		}
+		if s.isStale(client) {
+			stale = append(stale, id)
+		} else {
+			live = append(live, id)
+		}
+	}
+	sort.Strings(stale)
+	sort.Strings(live)
+	return stale, live
+}
+
+// endpointConflictLocked describes a registration sharing its endpoint with live backends and reports
+// whether operators should be alerted again for this endpoint. Caller must hold s.mu
+func (s *Server) endpointConflictLocked(reg common.ClientRegistration, endpoint string, live []string, policy string) (map[string]interface{}, bool) {
+	action := map[string]string{
+		DuplicateEndpointPolicyReplace: "replaced",
+		DuplicateEndpointPolicyReject:  "rejected",
+		DuplicateEndpointPolicyAllow:   "allowed",
+	}[policy]
+	data := map[string]interface{}{
+		"client_id":              reg.ClientID,
+		"tenant":                 reg.Tenant,
+		"endpoint":               endpoint,
+		"conflicting_client_ids": live,
+		"policy":                 policy,
+		"action":                 action,
+	}
+
+	key := reg.Tenant + "|" + endpoint
+	last, alerted := s.endpointConflictAlerts[key]
+	if alerted && time.Since(last) < endpointConflictAlertInterval {
+		return data, false
+	}
+	s.endpointConflictAlerts[key] = time.Now()
+	return data, true
+}
+
+// reportEndpointConflict alerts operators to a replaced or allowed endpoint conflict
+// Replaced backends are logged as they are removed
+func (s *Server) reportEndpointConflict(data map[string]interface{}, notify bool) {
+	if data["action"] == "allowed" {
+		LogWarnWithData("Registered backend sharing its endpoint with live backends; check the agents' endpoint_url", data)
+	}
+	if notify {
+		s.emit("client.endpoint_conflict", data)
+	}
+}
+
+// rejectDuplicateEndpoint answers a registration for an endpoint held by a live backend with 409 and alerts operators
+// The first backend keeps the endpoint until it goes stale or is removed with DELETE /clients/{id}
+func (s *Server) rejectDuplicateEndpoint(w http.ResponseWriter, data map[string]interface{}, notify bool) {
+	LogWarnWithData("Rejected registration for an endpoint already used by a live backend", data)
+	if notify {
+		s.emit("client.endpoint_conflict", data)
+	}
+
+	w.Header().Set(LBErrorCodeHeader, errCodeDuplicateEndpoint)
+	http.Error(w, fmt.Sprintf("Endpoint %s is already registered by live backend(s) %v; give each agent its own endpoint_url",
+		data["endpoint"], data["conflicting_client_ids"]), http.StatusConflict)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// registerSharedEndpoint registers two backends advertising the same endpoint under the given policy
+func registerSharedEndpoint(t *testing.T, policy string) (*Server, *httptest.ResponseRecorder) {
+	t.Helper()
+	db, cleanup := CreateTestDB(t)
+	t.Cleanup(cleanup)
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.DuplicateEndpointPolicy = policy
+	})
+	server.staleTimeout = 5 * time.Minute
+	if rec := postRegistration(server, common.ClientRegistration{ClientID: "svc-a", EndpointURL: "http://10.0.0.1:11000"}); rec.Code != http.StatusOK {
+		t.Fatalf("Expected first registration to succeed, got %d", rec.Code)
+	}
+	return server, postRegistration(server, common.ClientRegistration{ClientID: "svc-b", EndpointURL: "http://10.0.0.1:11000"})
+}
+
+// TestDuplicateEndpoint_Policies verifies each policy's outcome and that every conflict is recorded as an event
+func TestDuplicateEndpoint_Policies(t *testing.T) {
+	cases := []struct {
+		policy     string
+		wantCode   int
+		wantClient []string
+		action     string
+	}{
+		{"", http.StatusOK, []string{"svc-b"}, "replaced"},
+		{DuplicateEndpointPolicyReject, http.StatusConflict, []string{"svc-a"}, "rejected"},
+		{DuplicateEndpointPolicyAllow, http.StatusOK, []string{"svc-a", "svc-b"}, "allowed"},
+	}
+	for _, c := range cases {
+		server, rec := registerSharedEndpoint(t, c.policy)
+		if rec.Code != c.wantCode {
+			t.Errorf("%q: expected %d, got %d", c.policy, c.wantCode, rec.Code)
+		}
+		if c.wantCode == http.StatusConflict && rec.Header().Get(LBErrorCodeHeader) != errCodeDuplicateEndpoint {
+			t.Errorf("%q: expected error code %s", c.policy, errCodeDuplicateEndpoint)
+		}
+
+		server.mu.RLock()
+		registered := len(server.clientCache)
+		for _, id := range c.wantClient {
+			if _, ok := server.clientCache[id]; !ok {
+				t.Errorf("%q: expected %s to be registered", c.policy, id)
+			}
+		}
+		server.mu.RUnlock()
+		if registered != len(c.wantClient) {
+			t.Errorf("%q: expected %d backends, got %d", c.policy, len(c.wantClient), registered)
+		}
+
+		// Event 1 is svc-a's registration, so replaying after it covers the conflict
+		_, replay := server.events.subscribe([]string{"client.endpoint_conflict"}, 1)
+		if len(replay) != 1 || replay[0].Data["action"] != c.action || replay[0].Data["client_id"] != "svc-b" {
+			t.Errorf("%q: expected one %s conflict event, got %+v", c.policy, c.action, replay)
+		}
+	}
+}
+
+// TestDuplicateEndpoint_StalePeerReplaced verifies a stale backend on the endpoint is replaced even under reject
+func TestDuplicateEndpoint_StalePeerReplaced(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.DuplicateEndpointPolicy = DuplicateEndpointPolicyReject
+	})
+	server.staleTimeout = 5 * time.Minute
+	postRegistration(server, common.ClientRegistration{ClientID: "svc-a", EndpointURL: "http://10.0.0.1:11000"})
+	server.mu.Lock()
+	server.clientCache["svc-a"].LastSeen = time.Now().Add(-time.Hour)
+	server.mu.Unlock()
+
+	if rec := postRegistration(server, common.ClientRegistration{ClientID: "svc-b", EndpointURL: "http://10.0.0.1:11000"}); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the registration to replace a stale backend, got %d", rec.Code)
+	}
+	server.mu.RLock()
+	_, kept := server.clientCache["svc-a"]
+	server.mu.RUnlock()
+	if kept {
+		t.Error("Expected the stale backend to be removed")
+	}
+	if _, replay := server.events.subscribe([]string{"client.endpoint_conflict"}, 1); len(replay) != 0 {
+		t.Errorf("Expected no conflict event for a stale backend, got %+v", replay)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// errCodeDuplicateClientID is sent in X-LB-Error-Code when a second live agent claims a registered client_id
+const errCodeDuplicateClientID = "duplicate_client_id"
+
+// duplicateIDAlertInterval limits client.duplicate_id webhooks to one per client ID in this window
+// The rejected agent retries every report interval, which would otherwise flood the webhook
+const duplicateIDAlertInterval = 10 * time.Minute
+
+// clientIDConflictLocked reports whether a registration from endpoint collides with a live agent
+// already holding the client ID. The same agent process moving endpoints and an agent restarting
+// on its own endpoint are not conflicts; a stale holder is replaced as before. Caller must hold s.mu
+func (s *Server) clientIDConflictLocked(existing *ClientState, endpoint, instanceID string) bool {
+	if existing == nil || s.isStale(existing) {
+		return false
+	}
+	if existing.Endpoint == endpoint {
+		return false
+	}
+	held := existing.Registration.InstanceID
+	return held == "" || instanceID == "" || held != instanceID
+}
+
+// duplicateIDConflictLocked describes a rejected registration and reports whether operators
+// should be alerted again for this client ID. Caller must hold s.mu
+func (s *Server) duplicateIDConflictLocked(existing *ClientState, reg common.ClientRegistration, endpoint string) (map[string]interface{}, bool) {
+	data := map[string]interface{}{
+		"client_id":            reg.ClientID,
+		"tenant":               reg.Tenant,
+		"existing_endpoint":    existing.Endpoint,
+		"existing_instance_id": existing.Registration.InstanceID,
+		"rejected_endpoint":    endpoint,
+		"rejected_instance_id": reg.InstanceID,
+	}
+
+	last, alerted := s.duplicateIDAlerts[reg.ClientID]
+	if alerted && time.Since(last) < duplicateIDAlertInterval {
+		return data, false
+	}
+	s.duplicateIDAlerts[reg.ClientID] = time.Now()
+	return data, true
+}
+
+// rejectDuplicateClientID answers a conflicting registration with 409 and alerts operators
+// The first agent keeps the client ID until it goes stale or is removed with DELETE /clients/{id}
+func (s *Server) rejectDuplicateClientID(w http.ResponseWriter, data map[string]interface{}, notify bool) {
+	LogWarnWithData("Rejected duplicate client ID from a second live agent", data)
+	if notify {
+		s.emit("client.duplicate_id", data)
+	}
+
+	w.Header().Set(LBErrorCodeHeader, errCodeDuplicateClientID)
+	http.Error(w, fmt.Sprintf("Client ID %s is already registered by a live agent at %s; give each agent a unique client_id",
+		data["client_id"], data["existing_endpoint"]), http.StatusConflict)
+}
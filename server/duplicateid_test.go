@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+func postRegistration(server *Server, reg common.ClientRegistration) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(reg)
+	rec := httptest.NewRecorder()
+	server.handleRegister(rec, httptest.NewRequest("POST", "/register", bytes.NewReader(body)))
+	return rec
+}
+
+// TestDuplicateClientID_SecondLiveAgentRejected verifies the first agent keeps a client ID claimed from another endpoint
+func TestDuplicateClientID_SecondLiveAgentRejected(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	server.staleTimeout = 5 * time.Minute
+
+	first := common.ClientRegistration{ClientID: "gpu-01", EndpointURL: "http://10.0.0.1:11000", InstanceID: "instance-a"}
+	if rec := postRegistration(server, first); rec.Code != http.StatusOK {
+		t.Fatalf("Expected first registration to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	second := common.ClientRegistration{ClientID: "gpu-01", EndpointURL: "http://10.0.0.2:11000", InstanceID: "instance-b"}
+	rec := postRegistration(server, second)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("Expected 409 for a second live agent, got %d", rec.Code)
+	}
+	if code := rec.Header().Get(LBErrorCodeHeader); code != errCodeDuplicateClientID {
+		t.Errorf("Expected error code %s, got %q", errCodeDuplicateClientID, code)
+	}
+
+	server.mu.RLock()
+	endpoint := server.clientCache["gpu-01"].Endpoint
+	_, alerted := server.duplicateIDAlerts["gpu-01"]
+	server.mu.RUnlock()
+	if endpoint != first.EndpointURL {
+		t.Errorf("Expected the first agent's endpoint to be kept, got %s", endpoint)
+	}
+	if !alerted {
+		t.Error("Expected the conflict to be recorded for alerting")
+	}
+
+	// Stats from the rejected agent must not overwrite the first agent's report
+	body, _ := json.Marshal(common.ResourceStats{ClientID: "gpu-01", InstanceID: "instance-b", Timestamp: time.Now(), CPUCores: 2})
+	statsRec := httptest.NewRecorder()
+	server.handleStats(statsRec, httptest.NewRequest("POST", "/stats", bytes.NewReader(body)))
+	if statsRec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for stats from the rejected agent, got %d", statsRec.Code)
+	}
+}
+
+// TestDuplicateClientID_AllowedTransitions verifies restarts, endpoint moves and stale holders are not conflicts
+func TestDuplicateClientID_AllowedTransitions(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	server.staleTimeout = 5 * time.Minute
+
+	register := func(endpoint, instanceID string) {
+		t.Helper()
+		reg := common.ClientRegistration{ClientID: "gpu-01", EndpointURL: endpoint, InstanceID: instanceID}
+		if rec := postRegistration(server, reg); rec.Code != http.StatusOK {
+			t.Fatalf("Expected registration from %s (%s) to succeed, got %d: %s", endpoint, instanceID, rec.Code, rec.Body.String())
+		}
+	}
+
+	register("http://10.0.0.1:11000", "instance-a")
+	// Agent restarted on the same endpoint
+	register("http://10.0.0.1:11000", "instance-b")
+	// Same agent process moved to a new address
+	register("http://10.0.0.2:11000", "instance-b")
+
+	// Holder went stale: the new agent takes over
+	server.mu.Lock()
+	server.clientCache["gpu-01"].LastSeen = time.Now().Add(-10 * time.Minute)
+	server.mu.Unlock()
+	register("http://10.0.0.3:11000", "instance-c")
+}
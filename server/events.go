@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	eventHistorySize      = 512              // Recent events kept for reconnecting subscribers (Last-Event-ID)
+	eventSubscriberBuffer = 256              // Events queued per subscriber before it is disconnected
+	eventKeepAlive        = 15 * time.Second // Comment sent on idle streams so proxies keep them open
+)
+
+// StreamEvent is one event on GET /events
+type StreamEvent struct {
+	ID        uint64                 `json:"id"`
+	Event     string                 `json:"event"`
+	Timestamp time.Time              `json:"timestamp"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+type eventSubscriber struct {
+	types  []string
+	events chan StreamEvent
+}
+
+// EventHub fans server events out to /events subscribers
+// Publishing never blocks: a subscriber that falls behind is disconnected and resumes from the history
+type EventHub struct {
+	mu          sync.Mutex
+	nextID      uint64
+	history     []StreamEvent // Ring of the last eventHistorySize events
+	subscribers map[*eventSubscriber]struct{}
+}
+
+// NewEventHub creates an empty hub
+func NewEventHub() *EventHub {
+	return &EventHub{subscribers: make(map[*eventSubscriber]struct{})}
+}
+
+// Publish records an event and delivers it to matching subscribers
+func (h *EventHub) Publish(event string, data map[string]interface{}) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	e := StreamEvent{ID: h.nextID, Event: event, Timestamp: time.Now().UTC(), Data: data}
+	if len(h.history) < eventHistorySize {
+		h.history = append(h.history, e)
+	} else {
+		h.history[(h.nextID-1)%eventHistorySize] = e
+	}
+
+	for sub := range h.subscribers {
+		if !eventTypeMatches(sub.types, event) {
+			continue
+		}
+		select {
+		case sub.events <- e:
+		default:
+			delete(h.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// subscribe registers a subscriber and returns the retained events after lastID it should replay first
+func (h *EventHub) subscribe(types []string, lastID uint64) (*eventSubscriber, []StreamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &eventSubscriber{types: types, events: make(chan StreamEvent, eventSubscriberBuffer)}
+	h.subscribers[sub] = struct{}{}
+
+	var replay []StreamEvent
+	if lastID > 0 && lastID < h.nextID {
+		start := uint64(0)
+		if h.nextID > uint64(len(h.history)) {
+			start = h.nextID - uint64(len(h.history))
+		}
+		for id := max(lastID, start) + 1; id <= h.nextID; id++ {
+			e := h.history[(id-1)%eventHistorySize]
+			if eventTypeMatches(types, e.Event) {
+				replay = append(replay, e)
+			}
+		}
+	}
+	return sub, replay
+}
+
+func (h *EventHub) unsubscribe(sub *eventSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// eventTypeMatches reports whether event passes a ?types= filter: exact names or "prefix.*" (empty = all)
+func eventTypeMatches(types []string, event string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if t == event || t == "*" || (strings.HasSuffix(t, ".*") && strings.HasPrefix(event, t[:len(t)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// emit publishes an event on /events and delivers it to subscribed webhooks
+func (s *Server) emit(event string, data map[string]interface{}) {
+	s.events.Publish(event, data)
+	s.webhooks.Emit(event, data)
+}
+
+// handleEvents streams server events as Server-Sent Events
+// GET /events?types=client.registered,client.* ; Last-Event-ID resumes after a reconnect
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var types []string
+	for _, t := range strings.Split(r.URL.Query().Get("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	var lastID uint64
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastID = id
+	}
+
+	sub, replay := s.events.subscribe(types, lastID)
+	defer s.events.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	for _, e := range replay {
+		if !writeStreamEvent(w, e) {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, open := <-sub.events:
+			if !open {
+				return // Fell behind; the client reconnects and replays from Last-Event-ID
+			}
+			if !writeStreamEvent(w, e) {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeStreamEvent writes one SSE frame; the data line is the whole event as JSON
+func writeStreamEvent(w http.ResponseWriter, e StreamEvent) bool {
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Warning: Failed to encode event %s: %v", e.Event, err)
+		return true
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Event, body)
+	return err == nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readStreamEvent reads the next SSE frame, skipping keep-alive comments
+func readStreamEvent(t *testing.T, r *bufio.Reader) StreamEvent {
+	t.Helper()
+	var event StreamEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Stream ended: %v", err)
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Fatalf("Invalid event data %q: %v", data, err)
+			}
+		}
+		if line == "\n" && event.ID != 0 {
+			return event
+		}
+	}
+}
+
+// TestEvents_StreamFiltered verifies /events streams matching events as they happen
+func TestEvents_StreamFiltered(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+	server.config.HealthCheckEnabled = true
+	server.config.HealthCheckUnhealthyThreshold = 1
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "a"}))
+
+	ts := httptest.NewServer(http.HandlerFunc(server.handleEvents))
+	defer ts.Close()
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"?types=client.*", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %s", ct)
+	}
+
+	server.events.Publish("route.failed", map[string]interface{}{"tier": "lite"})
+	server.updateHealthStatus(server.clientCache["a"], false, time.Millisecond)
+
+	event := readStreamEvent(t, bufio.NewReader(resp.Body))
+	if event.Event != "client.health" || event.Data["client_id"] != "a" || event.Data["current"] != "unhealthy" {
+		t.Errorf("Expected a's health transition (route.failed filtered out), got %+v", event)
+	}
+}
+
+// TestEvents_Replay verifies Last-Event-ID replays retained events after the given ID
+func TestEvents_Replay(t *testing.T) {
+	hub := NewEventHub()
+	for i := 0; i < eventHistorySize+10; i++ {
+		hub.Publish("allocation.expired", nil)
+		hub.Publish("client.registered", nil)
+	}
+
+	_, replay := hub.subscribe([]string{"client.registered"}, hub.nextID-4)
+	if len(replay) != 2 || replay[0].ID != hub.nextID-2 || replay[1].ID != hub.nextID {
+		t.Errorf("Expected the last two registrations, got %+v", replay)
+	}
+
+	// IDs older than the history replay from the oldest retained event
+	_, replay = hub.subscribe(nil, 1)
+	if len(replay) != eventHistorySize || replay[0].ID != hub.nextID-eventHistorySize+1 {
+		t.Errorf("Expected the whole history, got %d events", len(replay))
+	}
+}
+
+// TestEventTypeMatches verifies exact names, prefix wildcards and the empty filter
+func TestEventTypeMatches(t *testing.T) {
+	cases := []struct {
+		types []string
+		event string
+		want  bool
+	}{
+		{nil, "client.health", true},
+		{[]string{"client.health"}, "client.health", true},
+		{[]string{"client.*"}, "clients.removed", false},
+		{[]string{"client.*"}, "client.registered", true},
+		{[]string{"route.failed"}, "client.health", false},
+	}
+	for _, c := range cases {
+		if got := eventTypeMatches(c.types, c.event); got != c.want {
+			t.Errorf("eventTypeMatches(%v, %s) = %v, want %v", c.types, c.event, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+	"cyqle.in/opsen/opsentest"
+)
+
+// TestFleet_RoutesAgainstServer verifies the public opsentest fleet drives the real agent and routing handlers
+func TestFleet_RoutesAgainstServer(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", server.handleRegister)
+	mux.HandleFunc("/stats", server.handleStats)
+	mux.HandleFunc("/route", server.handleRoute)
+	lb := httptest.NewServer(mux)
+	defer lb.Close()
+
+	fleet := opsentest.NewFleet(t, lb.URL, "")
+	fleet.Add(opsentest.MockClientOptions{ClientID: "busy", CPUUsageAvg: []float64{70, 70, 70, 70, 70, 70, 70, 70}})
+	idle := fleet.Add(opsentest.MockClientOptions{ClientID: "idle"})
+
+	resp, status := fleet.Route(common.RoutingRequest{Tier: "lite", ClientIP: "1.2.3.4"}, nil)
+	if status != http.StatusOK || resp.ClientID != "idle" || resp.Endpoint != idle.Server.URL {
+		t.Errorf("Expected the idle fleet backend, got %d %+v", status, resp)
+	}
+
+	// Load shifts: the idle backend fills up and the other one frees
+	fleet.Report("idle", func(stats *common.ResourceStats) {
+		for i := range stats.CPUUsageAvg {
+			stats.CPUUsageAvg[i] = 95
+		}
+	})
+	fleet.Report("busy", func(stats *common.ResourceStats) {
+		for i := range stats.CPUUsageAvg {
+			stats.CPUUsageAvg[i] = 10
+		}
+	})
+	server.ClearPendingAllocations()
+
+	resp, status = fleet.Route(common.RoutingRequest{Tier: "lite", ClientIP: "1.2.3.4"}, nil)
+	if status != http.StatusOK || resp.ClientID != "busy" {
+		t.Errorf("Expected placement to follow reported load, got %d %+v", status, resp)
+	}
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"container/list"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+
+	"cyqle.in/opsen/common"
+)
+
+// GeoIP provider names for geoip.provider
+const (
+	geoProviderMMDB        = "mmdb"
+	geoProviderIP2Location = "ip2location"
+	geoProviderHTTP        = "http"
+)
+
+// errGeoNotFound is returned when an address is not covered by the database
+var errGeoNotFound = errors.New("address not found")
+
+// GeoInfo is the location and network of an IP address
+type GeoInfo struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Country   string  `json:"country,omitempty"`
+	City      string  `json:"city,omitempty"`
+	ASN       uint    `json:"asn,omitempty"`
+	ASNOrg    string  `json:"asn_org,omitempty"`
+}
+
+// GeoProvider resolves IP addresses to a location and, when the source has it, an ASN
+type GeoProvider interface {
+	Lookup(ip net.IP) (GeoInfo, error)
+	Close() error
+}
+
+// NewGeoProvider creates the configured provider wrapped in an LRU cache
+// Returns nil if no GeoIP source is configured
+func NewGeoProvider(config common.GeoIPConfig, dbPath string) (GeoProvider, error) {
+	var provider GeoProvider
+	switch config.Provider {
+	case "", geoProviderMMDB:
+		if dbPath == "" && config.ASNDBPath == "" {
+			return nil, nil
+		}
+		provider = &mmdbGeoProvider{cityPath: dbPath, asnPath: config.ASNDBPath}
+	case geoProviderIP2Location:
+		if dbPath == "" {
+			return nil, fmt.Errorf("geoip.provider ip2location requires geoip_db_path")
+		}
+		p, err := newIP2LocationGeoProvider(dbPath, config.ASNDBPath)
+		if err != nil {
+			return nil, err
+		}
+		provider = p
+	case geoProviderHTTP:
+		if !strings.Contains(config.HTTPURL, "{ip}") {
+			return nil, fmt.Errorf("geoip.provider http requires geoip.http_url with an {ip} placeholder")
+		}
+		timeout := time.Duration(config.HTTPTimeoutMs) * time.Millisecond
+		if timeout <= 0 {
+			timeout = time.Second
+		}
+		provider = &httpGeoProvider{
+			urlTemplate: config.HTTPURL,
+			headers:     config.HTTPHeaders,
+			client:      &http.Client{Timeout: timeout},
+		}
+	default:
+		return nil, fmt.Errorf("invalid geoip.provider: %s (expected mmdb, ip2location, or http)", config.Provider)
+	}
+
+	if config.CacheSize > 0 {
+		provider = newCachedGeoProvider(provider, config.CacheSize, time.Duration(config.CacheTTLSecs)*time.Second)
+	}
+	return provider, nil
+}
+
+// mmdbGeoProvider looks up MaxMind City (and optionally ASN) databases
+// Databases are opened on first use and kept open; a missing file is retried on the next lookup
+type mmdbGeoProvider struct {
+	mu       sync.Mutex
+	cityPath string
+	asnPath  string
+	city     *geoip2.Reader
+	asn      *geoip2.Reader
+}
+
+func (p *mmdbGeoProvider) readers() (*geoip2.Reader, *geoip2.Reader, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.city == nil && p.cityPath != "" {
+		db, err := geoip2.Open(p.cityPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open GeoIP database at %s: %w", p.cityPath, err)
+		}
+		p.city = db
+	}
+	if p.asn == nil && p.asnPath != "" {
+		db, err := geoip2.Open(p.asnPath)
+		if err != nil {
+			// ASN enrichment is optional; locations still work without it
+			log.Printf("Warning: Failed to open ASN database at %s: %v", p.asnPath, err)
+		} else {
+			p.asn = db
+		}
+	}
+	return p.city, p.asn, nil
+}
+
+func (p *mmdbGeoProvider) Lookup(ip net.IP) (GeoInfo, error) {
+	city, asn, err := p.readers()
+	if err != nil {
+		return GeoInfo{}, err
+	}
+
+	var info GeoInfo
+	if city != nil {
+		record, err := city.City(ip)
+		if err != nil {
+			return GeoInfo{}, err
+		}
+		info.Latitude = record.Location.Latitude
+		info.Longitude = record.Location.Longitude
+		info.Country = record.Country.IsoCode
+		info.City = record.City.Names["en"]
+	}
+	if asn != nil {
+		if record, err := asn.ASN(ip); err == nil {
+			info.ASN = record.AutonomousSystemNumber
+			info.ASNOrg = record.AutonomousSystemOrganization
+		}
+	}
+	return info, nil
+}
+
+func (p *mmdbGeoProvider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.city != nil {
+		p.city.Close()
+		p.city = nil
+	}
+	if p.asn != nil {
+		p.asn.Close()
+		p.asn = nil
+	}
+	return nil
+}
+
+// ip2lRange is one address range of an IP2Location CSV database
+type ip2lRange struct {
+	from, to netip.Addr
+	info     GeoInfo
+}
+
+// ip2LocationGeoProvider serves lookups from IP2Location CSV databases loaded into memory
+// Location CSVs are DB1-DB11 layouts (ip_from, ip_to, country_code, country_name, region, city, latitude, longitude, ...);
+// the ASN CSV is the IP2Location ASN layout (ip_from, ip_to, cidr, asn, as)
+type ip2LocationGeoProvider struct {
+	locations []ip2lRange
+	asns      []ip2lRange
+}
+
+func newIP2LocationGeoProvider(locationPath, asnPath string) (*ip2LocationGeoProvider, error) {
+	// Intern repeated country/city names to keep multi-million-row databases compact
+	names := make(map[string]string)
+	intern := func(s string) string {
+		if v, ok := names[s]; ok {
+			return v
+		}
+		names[s] = s
+		return s
+	}
+
+	locations, err := loadIP2LocationCSV(locationPath, func(fields []string) GeoInfo {
+		var info GeoInfo
+		if len(fields) > 2 && fields[2] != "-" {
+			info.Country = intern(fields[2])
+		}
+		if len(fields) > 5 && fields[5] != "-" {
+			info.City = intern(fields[5])
+		}
+		if len(fields) > 7 {
+			info.Latitude, _ = strconv.ParseFloat(fields[6], 64)
+			info.Longitude, _ = strconv.ParseFloat(fields[7], 64)
+		}
+		return info
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	provider := &ip2LocationGeoProvider{locations: locations}
+	if asnPath != "" {
+		provider.asns, err = loadIP2LocationCSV(asnPath, func(fields []string) GeoInfo {
+			var info GeoInfo
+			if len(fields) > 4 {
+				asn, _ := strconv.ParseUint(fields[3], 10, 32)
+				info.ASN = uint(asn)
+				if fields[4] != "-" {
+					info.ASNOrg = intern(fields[4])
+				}
+			}
+			return info
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return provider, nil
+}
+
+// loadIP2LocationCSV reads an IP2Location CSV into ranges sorted by start address
+func loadIP2LocationCSV(path string, parse func(fields []string) GeoInfo) ([]ip2lRange, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open IP2Location database: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	var ranges []ip2lRange
+	for line := 1; ; line++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if len(fields) < 2 {
+			continue
+		}
+		from, errFrom := parseIP2LocationNumber(fields[0])
+		to, errTo := parseIP2LocationNumber(fields[1])
+		if errFrom != nil || errTo != nil {
+			// Header row or comment
+			continue
+		}
+		ranges = append(ranges, ip2lRange{from: from, to: to, info: parse(fields)})
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].from.Less(ranges[j].from)
+	})
+	return ranges, nil
+}
+
+// parseIP2LocationNumber converts IP2Location's decimal address notation to an address
+// Values below 2^32 are IPv4; IPv6 files store IPv4 as IPv4-mapped addresses
+func parseIP2LocationNumber(s string) (netip.Addr, error) {
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok || n.Sign() < 0 || n.BitLen() > 128 {
+		return netip.Addr{}, fmt.Errorf("invalid address number: %s", s)
+	}
+	if n.BitLen() <= 32 {
+		var b [4]byte
+		n.FillBytes(b[:])
+		return netip.AddrFrom4(b), nil
+	}
+	var b [16]byte
+	n.FillBytes(b[:])
+	return netip.AddrFrom16(b).Unmap(), nil
+}
+
+// findIP2LocationRange returns the range containing addr
+func findIP2LocationRange(ranges []ip2lRange, addr netip.Addr) (GeoInfo, bool) {
+	i := sort.Search(len(ranges), func(i int) bool {
+		return addr.Less(ranges[i].from)
+	})
+	if i == 0 {
+		return GeoInfo{}, false
+	}
+	r := ranges[i-1]
+	if addr.Compare(r.to) > 0 {
+		return GeoInfo{}, false
+	}
+	return r.info, true
+}
+
+func (p *ip2LocationGeoProvider) Lookup(ip net.IP) (GeoInfo, error) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return GeoInfo{}, fmt.Errorf("invalid IP address: %s", ip)
+	}
+	addr = addr.Unmap()
+
+	info, found := findIP2LocationRange(p.locations, addr)
+	if !found {
+		return GeoInfo{}, errGeoNotFound
+	}
+	if asn, ok := findIP2LocationRange(p.asns, addr); ok {
+		info.ASN = asn.ASN
+		info.ASNOrg = asn.ASNOrg
+	}
+	return info, nil
+}
+
+func (p *ip2LocationGeoProvider) Close() error {
+	return nil
+}
+
+// httpGeoProvider queries an HTTP lookup service returning JSON
+// Accepted fields: latitude/lat, longitude/lon, country/country_code, city, asn (number or "AS123"), asn_org/org
+type httpGeoProvider struct {
+	urlTemplate string
+	headers     map[string]string
+	client      *http.Client
+}
+
+type httpGeoResponse struct {
+	Latitude    *float64    `json:"latitude"`
+	Lat         *float64    `json:"lat"`
+	Longitude   *float64    `json:"longitude"`
+	Lon         *float64    `json:"lon"`
+	Country     string      `json:"country"`
+	CountryCode string      `json:"country_code"`
+	City        string      `json:"city"`
+	ASN         interface{} `json:"asn"`
+	ASNOrg      string      `json:"asn_org"`
+	Org         string      `json:"org"`
+}
+
+func (p *httpGeoProvider) Lookup(ip net.IP) (GeoInfo, error) {
+	lookupURL := strings.ReplaceAll(p.urlTemplate, "{ip}", url.PathEscape(ip.String()))
+	req, err := http.NewRequest(http.MethodGet, lookupURL, nil)
+	if err != nil {
+		return GeoInfo{}, err
+	}
+	for name, value := range p.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return GeoInfo{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return GeoInfo{}, errGeoNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return GeoInfo{}, fmt.Errorf("GeoIP service returned %s", resp.Status)
+	}
+
+	var body httpGeoResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return GeoInfo{}, fmt.Errorf("invalid GeoIP service response: %w", err)
+	}
+
+	info := GeoInfo{
+		Country: firstNonEmpty(body.CountryCode, body.Country),
+		City:    body.City,
+		ASN:     parseASN(body.ASN),
+		ASNOrg:  firstNonEmpty(body.ASNOrg, body.Org),
+	}
+	if body.Latitude != nil {
+		info.Latitude = *body.Latitude
+	} else if body.Lat != nil {
+		info.Latitude = *body.Lat
+	}
+	if body.Longitude != nil {
+		info.Longitude = *body.Longitude
+	} else if body.Lon != nil {
+		info.Longitude = *body.Lon
+	}
+	return info, nil
+}
+
+func (p *httpGeoProvider) Close() error {
+	return nil
+}
+
+// parseASN accepts an ASN as a JSON number or a string such as "15169" or "AS15169 Google LLC"
+func parseASN(v interface{}) uint {
+	switch asn := v.(type) {
+	case float64:
+		if asn > 0 {
+			return uint(asn)
+		}
+	case string:
+		fields := strings.Fields(strings.TrimPrefix(strings.ToUpper(asn), "AS"))
+		if len(fields) > 0 {
+			n, _ := strconv.ParseUint(fields[0], 10, 32)
+			return uint(n)
+		}
+	}
+	return 0
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+type geoCacheEntry struct {
+	ip      string
+	info    GeoInfo
+	expires time.Time
+}
+
+// cachedGeoProvider keeps recent successful lookups in an LRU so hot client IPs
+// do not hit the database (or lookup service) on every request
+type cachedGeoProvider struct {
+	provider GeoProvider
+	size     int
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	order   *list.List // Front = most recently used
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+func newCachedGeoProvider(provider GeoProvider, size int, ttl time.Duration) *cachedGeoProvider {
+	return &cachedGeoProvider{
+		provider: provider,
+		size:     size,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+func (c *cachedGeoProvider) Lookup(ip net.IP) (GeoInfo, error) {
+	key := ip.String()
+
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*geoCacheEntry)
+		if entry.expires.IsZero() || c.now().Before(entry.expires) {
+			c.order.MoveToFront(elem)
+			c.mu.Unlock()
+			return entry.info, nil
+		}
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+
+	info, err := c.provider.Lookup(ip)
+	if err != nil {
+		return info, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &geoCacheEntry{ip: key, info: info}
+	if c.ttl > 0 {
+		entry.expires = c.now().Add(c.ttl)
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return info, nil
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*geoCacheEntry).ip)
+	}
+	return info, nil
+}
+
+func (c *cachedGeoProvider) Close() error {
+	return c.provider.Close()
+}
+
+// geoProvider returns the server's GeoIP provider, creating it from configuration on first use
+func (s *Server) geoProvider() GeoProvider {
+	s.geoOnce.Do(func() {
+		s.geoMu.Lock()
+		defer s.geoMu.Unlock()
+		if s.geo != nil {
+			return
+		}
+		var config common.GeoIPConfig
+		if s.config != nil {
+			config = s.config.GeoIP
+		}
+		provider, err := NewGeoProvider(config, s.geoIPDBPath)
+		if err != nil {
+			log.Printf("Warning: Failed to initialize GeoIP provider: %v", err)
+			return
+		}
+		s.geo = provider
+	})
+
+	s.geoMu.RLock()
+	defer s.geoMu.RUnlock()
+	return s.geo
+}
+
+// lookupIP resolves an IP address with the configured GeoIP provider
+func (s *Server) lookupIP(ipAddr string) (GeoInfo, bool) {
+	provider := s.geoProvider()
+	if provider == nil {
+		log.Printf("GeoIP database not configured (geoip_db_path is empty)")
+		return GeoInfo{}, false
+	}
+
+	ip := net.ParseIP(ipAddr)
+	if ip == nil {
+		log.Printf("Warning: Invalid IP address: %s", ipAddr)
+		return GeoInfo{}, false
+	}
+
+	info, err := provider.Lookup(ip)
+	if err != nil {
+		log.Printf("Warning: Failed to lookup IP %s: %v", ipAddr, err)
+		return GeoInfo{}, false
+	}
+
+	log.Printf("GeoIP lookup successful for %s: %.4f, %.4f (%s, %s, AS%d)",
+		ipAddr, info.Latitude, info.Longitude, info.City, info.Country, info.ASN)
+	return info, true
+}
+
+// backendASN resolves a registering backend's ASN from its public IP or endpoint address
+// Private and unparseable addresses are skipped (they have no ASN)
+func (s *Server) backendASN(reg common.ClientRegistration, endpoint string) (uint, string) {
+	if s.geoProvider() == nil {
+		return 0, ""
+	}
+
+	candidates := []string{reg.PublicIP}
+	if parsed, err := url.Parse(endpoint); err == nil {
+		candidates = append(candidates, parsed.Hostname())
+	}
+	for _, candidate := range candidates {
+		ip := net.ParseIP(candidate)
+		if ip == nil || ip.IsPrivate() || ip.IsLoopback() || !ip.IsGlobalUnicast() {
+			continue
+		}
+		if info, ok := s.lookupIP(candidate); ok && info.ASN != 0 {
+			return info.ASN, info.ASNOrg
+		}
+	}
+	return 0, ""
+}
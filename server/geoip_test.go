@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// countingGeoProvider counts lookups reaching the underlying provider
+type countingGeoProvider struct {
+	lookups int
+}
+
+func (p *countingGeoProvider) Lookup(ip net.IP) (GeoInfo, error) {
+	p.lookups++
+	return GeoInfo{City: ip.String()}, nil
+}
+
+func (p *countingGeoProvider) Close() error { return nil }
+
+// TestCachedGeoProvider_LRU verifies repeated IPs are served from cache, with LRU eviction and TTL expiry
+func TestCachedGeoProvider_LRU(t *testing.T) {
+	inner := &countingGeoProvider{}
+	cache := newCachedGeoProvider(inner, 2, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	a, b, c := net.ParseIP("1.1.1.1"), net.ParseIP("2.2.2.2"), net.ParseIP("3.3.3.3")
+	cache.Lookup(a)
+	cache.Lookup(b)
+	cache.Lookup(a) // Hit, a becomes most recently used
+	if inner.lookups != 2 {
+		t.Errorf("Expected 2 provider lookups, got %d", inner.lookups)
+	}
+
+	cache.Lookup(c) // Evicts b
+	cache.Lookup(a)
+	if inner.lookups != 3 {
+		t.Errorf("Expected a to stay cached after evicting b, got %d lookups", inner.lookups)
+	}
+	cache.Lookup(b)
+	if inner.lookups != 4 {
+		t.Errorf("Expected b to be evicted, got %d lookups", inner.lookups)
+	}
+
+	now = now.Add(2 * time.Minute)
+	cache.Lookup(b)
+	if inner.lookups != 5 {
+		t.Errorf("Expected expired entry to be looked up again, got %d lookups", inner.lookups)
+	}
+}
+
+// TestIP2LocationGeoProvider verifies CSV range lookups with ASN enrichment
+func TestIP2LocationGeoProvider(t *testing.T) {
+	dir := t.TempDir()
+	locationPath := filepath.Join(dir, "IP2LOCATION-LITE-DB5.CSV")
+	asnPath := filepath.Join(dir, "IP2LOCATION-LITE-ASN.CSV")
+	// 8.8.8.0 - 8.8.8.255 = 134744064 - 134744319
+	os.WriteFile(locationPath, []byte(
+		`"0","134744063","-","-","-","-","0.000000","0.000000"`+"\n"+
+			`"134744064","134744319","US","United States of America","California","Mountain View","37.405992","-122.078515"`+"\n"), 0644)
+	os.WriteFile(asnPath, []byte(`"134744064","134744319","8.8.8.0/24","15169","Google LLC"`+"\n"), 0644)
+
+	provider, err := NewGeoProvider(common.GeoIPConfig{Provider: geoProviderIP2Location, ASNDBPath: asnPath}, locationPath)
+	if err != nil {
+		t.Fatalf("Failed to load IP2Location CSV: %v", err)
+	}
+
+	info, err := provider.Lookup(net.ParseIP("8.8.8.8"))
+	if err != nil {
+		t.Fatalf("Expected 8.8.8.8 to resolve, got %v", err)
+	}
+	if info.City != "Mountain View" || info.Country != "US" || info.ASN != 15169 || info.ASNOrg != "Google LLC" {
+		t.Errorf("Unexpected lookup result: %+v", info)
+	}
+	if _, err := provider.Lookup(net.ParseIP("9.9.9.9")); err == nil {
+		t.Error("Expected address outside all ranges to fail")
+	}
+}
+
+// TestHTTPGeoProvider verifies the HTTP provider maps common response fields
+func TestHTTPGeoProvider(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/lookup/203.0.113.7" || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"lat": 52.52, "lon": 13.40, "country": "DE", "city": "Berlin", "asn": "AS3320 Deutsche Telekom AG",
+		})
+	}))
+	defer service.Close()
+
+	provider, err := NewGeoProvider(common.GeoIPConfig{
+		Provider:    geoProviderHTTP,
+		HTTPURL:     service.URL + "/lookup/{ip}",
+		HTTPHeaders: map[string]string{"Authorization": "Bearer token"},
+	}, "")
+	if err != nil {
+		t.Fatalf("Failed to create HTTP provider: %v", err)
+	}
+
+	info, err := provider.Lookup(net.ParseIP("203.0.113.7"))
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if info.Latitude != 52.52 || info.City != "Berlin" || info.ASN != 3320 {
+		t.Errorf("Unexpected lookup result: %+v", info)
+	}
+
+	if _, err := NewGeoProvider(common.GeoIPConfig{Provider: geoProviderHTTP, HTTPURL: service.URL}, ""); err == nil {
+		t.Error("Expected http_url without {ip} placeholder to be rejected")
+	}
+}
+
+// TestFindBestClient_PreferSameASN verifies a same-ASN backend wins over an otherwise better one
+func TestFindBestClient_PreferSameASN(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.GeoIP = common.GeoIPConfig{PreferSameASN: true, SameASNBonus: 100}
+	})
+	idle := NewMockClient(MockClientOptions{ClientID: "idle", CPUUsageAvg: []float64{5, 5, 5, 5, 5, 5, 5, 5}})
+	sameASN := NewMockClient(MockClientOptions{ClientID: "same-asn", CPUUsageAvg: []float64{40, 40, 40, 40, 40, 40, 40, 40}})
+	sameASN.ASN = 64500
+	server.AddMockClient(idle)
+	server.AddMockClient(sameASN)
+
+	tier := server.tierSpecs["lite"]
+	if selected := server.findBestClient(tier, 0, 0); selected.Registration.ClientID != "idle" {
+		t.Errorf("Expected least-loaded backend without an ASN match, got %s", selected.Registration.ClientID)
+	}
+
+	tier.ClientASN = 64500
+	if selected := server.findBestClient(tier, 0, 0); selected.Registration.ClientID != "same-asn" {
+		t.Errorf("Expected same-ASN backend to be preferred, got %s", selected.Registration.ClientID)
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/oschwald/geoip2-golang"
+
+	"cyqle.in/opsen/common"
+)
+
+// geoIPMaxDownloadBytes caps a database download (GeoLite2-City is ~70MB uncompressed)
+const geoIPMaxDownloadBytes = 1 << 30
+
+// geoReloadGrace is how long a replaced provider stays open for lookups that already hold it
+const geoReloadGrace = 30 * time.Second
+
+// zstdMagic starts every zstd frame
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// GeoIPUpdater periodically downloads the server's GeoIP database, verifies it and swaps it in
+// Downloads are written next to geoip_db_path and renamed over it, so readers never see a partial file
+type GeoIPUpdater struct {
+	config    common.GeoIPAutoUpdateConfig
+	provider  string
+	dbPath    string
+	publicKey ed25519.PublicKey
+	client    *http.Client
+	reload    func() error
+}
+
+// NewGeoIPUpdater validates geoip.auto_update, or returns nil if it is disabled
+// reload is called after a new database has been installed
+func NewGeoIPUpdater(config common.GeoIPConfig, dbPath string, reload func() error) (*GeoIPUpdater, error) {
+	if !config.AutoUpdate.Enabled {
+		return nil, nil
+	}
+	if config.Provider == geoProviderHTTP {
+		return nil, fmt.Errorf("geoip.auto_update requires a file-based provider (mmdb or ip2location)")
+	}
+	if dbPath == "" {
+		return nil, fmt.Errorf("geoip.auto_update requires geoip_db_path")
+	}
+	if config.AutoUpdate.URL == "" {
+		return nil, fmt.Errorf("geoip.auto_update.url is required")
+	}
+	if config.AutoUpdate.SHA256URL == "" && config.AutoUpdate.PublicKey == "" {
+		return nil, fmt.Errorf("geoip.auto_update requires sha256_url or public_key to verify downloads")
+	}
+
+	u := &GeoIPUpdater{
+		config:   config.AutoUpdate,
+		provider: config.Provider,
+		dbPath:   dbPath,
+		client:   &http.Client{Timeout: 10 * time.Minute},
+		reload:   reload,
+	}
+	if config.AutoUpdate.PublicKey != "" {
+		key, err := common.ParseUpdatePublicKey(config.AutoUpdate.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		u.publicKey = key
+	}
+	return u, nil
+}
+
+// interval returns the configured check interval (default: 24h)
+func (u *GeoIPUpdater) interval() time.Duration {
+	if u.config.CheckIntervalHours <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(u.config.CheckIntervalHours) * time.Hour
+}
+
+// Stale reports whether the database is missing or older than one check interval
+func (u *GeoIPUpdater) Stale() bool {
+	info, err := os.Stat(u.dbPath)
+	return err != nil || time.Since(info.ModTime()) > u.interval()
+}
+
+// Run checks for a new database every interval until ctx is cancelled
+// A stale database is updated right away
+func (u *GeoIPUpdater) Run(ctx context.Context) {
+	if u.Stale() {
+		u.updateAndLog()
+	}
+
+	ticker := time.NewTicker(u.interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			u.updateAndLog()
+		}
+	}
+}
+
+func (u *GeoIPUpdater) updateAndLog() {
+	if _, err := u.Update(); err != nil {
+		LogWarnWithData("GeoIP database update failed", map[string]interface{}{
+			"url":   u.config.URL,
+			"error": err.Error(),
+		})
+	}
+}
+
+// Update downloads the database if it changed, verifies and installs it, then reloads the provider
+// Returns false when the server reported the current database as unmodified
+func (u *GeoIPUpdater) Update() (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, u.config.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	if info, err := os.Stat(u.dbPath); err == nil {
+		req.Header.Set("If-Modified-Since", info.ModTime().UTC().Format(http.TimeFormat))
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to download database: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("download failed with status %d", resp.StatusCode)
+	}
+
+	downloadPath, sum, size, err := u.download(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(downloadPath)
+
+	if err := u.verify(downloadPath, sum); err != nil {
+		return false, err
+	}
+
+	tmpPath, compressed, err := u.decompress(downloadPath)
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmpPath) // No-op once renamed into place
+
+	if err := validateGeoIPDatabase(u.provider, tmpPath); err != nil {
+		return false, fmt.Errorf("downloaded database is invalid: %w", err)
+	}
+
+	// Keep the upstream modification time so If-Modified-Since matches on the next check
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		os.Chtimes(tmpPath, modified, modified)
+	}
+
+	if err := u.install(tmpPath); err != nil {
+		return false, err
+	}
+	if u.reload != nil {
+		if err := u.reload(); err != nil {
+			return true, fmt.Errorf("database installed but reload failed: %w", err)
+		}
+	}
+
+	LogInfoWithData("GeoIP database updated", map[string]interface{}{
+		"path":       u.dbPath,
+		"url":        u.config.URL,
+		"bytes":      size,
+		"compressed": compressed,
+	})
+	return true, nil
+}
+
+// download streams the response body into a temp file in the database directory, hashing it on the way
+// Returns the file's path, SHA-256 and size
+func (u *GeoIPUpdater) download(body io.Reader) (string, []byte, int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(u.dbPath), filepath.Base(u.dbPath)+".download-*")
+	if err != nil {
+		return "", nil, 0, fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), io.LimitReader(body, geoIPMaxDownloadBytes+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size > geoIPMaxDownloadBytes {
+		err = fmt.Errorf("database exceeds %d bytes", geoIPMaxDownloadBytes)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", nil, 0, fmt.Errorf("failed to download database: %w", err)
+	}
+	return tmp.Name(), hasher.Sum(nil), size, nil
+}
+
+// verify checks a downloaded file against the published checksum and/or detached signature
+func (u *GeoIPUpdater) verify(path string, sum []byte) error {
+	if u.config.SHA256URL != "" {
+		published, err := u.fetchText(u.config.SHA256URL)
+		if err != nil {
+			return fmt.Errorf("failed to fetch checksum: %w", err)
+		}
+		fields := strings.Fields(published)
+		if len(fields) == 0 || !strings.EqualFold(fields[0], hex.EncodeToString(sum)) {
+			return fmt.Errorf("checksum mismatch for %s", u.config.URL)
+		}
+	}
+	if u.publicKey != nil {
+		signature, err := u.fetchText(u.config.URL + common.UpdateSignatureSuffix)
+		if err != nil {
+			return fmt.Errorf("failed to fetch signature: %w", err)
+		}
+		// Ed25519 signs the whole file rather than a digest, so it is read back here
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read download: %w", err)
+		}
+		if !common.VerifyUpdateManifest(u.publicKey, data, signature) {
+			return fmt.Errorf("invalid signature for %s", u.config.URL)
+		}
+	}
+	return nil
+}
+
+func (u *GeoIPUpdater) fetchText(url string) (string, error) {
+	resp, err := u.client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d from %s", resp.StatusCode, url)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return string(body), err
+}
+
+// decompress returns a verified download ready to install: the file itself, or a zstd-compressed one
+// decompressed into a new temp file next to it. compressed reports which
+func (u *GeoIPUpdater) decompress(downloadPath string) (string, bool, error) {
+	src, err := os.Open(downloadPath)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read download: %w", err)
+	}
+	defer src.Close()
+
+	magic := make([]byte, len(zstdMagic))
+	if _, err := io.ReadFull(src, magic); err != nil || !bytes.Equal(magic, zstdMagic) {
+		return downloadPath, false, nil
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return "", false, fmt.Errorf("failed to read download: %w", err)
+	}
+	decoder, err := zstd.NewReader(src, zstd.WithDecoderMaxMemory(geoIPMaxDownloadBytes))
+	if err != nil {
+		return "", false, fmt.Errorf("failed to decompress database: %w", err)
+	}
+	defer decoder.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(u.dbPath), filepath.Base(u.dbPath)+".download-*")
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	_, err = io.Copy(tmp, io.LimitReader(decoder, geoIPMaxDownloadBytes))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", false, fmt.Errorf("failed to write database: %w", err)
+	}
+	return tmp.Name(), true, nil
+}
+
+// install rotates the current database into numbered backups and renames the new one into place
+func (u *GeoIPUpdater) install(tmpPath string) error {
+	if keep := u.config.KeepBackups; keep > 0 {
+		for i := keep; i > 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", u.dbPath, i-1), fmt.Sprintf("%s.%d", u.dbPath, i))
+		}
+		backup := u.dbPath + ".1"
+		os.Remove(backup)
+		// A hard link keeps the current path valid until the rename below replaces it
+		if err := os.Link(u.dbPath, backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+			LogWarn(fmt.Sprintf("Failed to back up GeoIP database to %s: %v", backup, err))
+		}
+	}
+
+	if err := os.Rename(tmpPath, u.dbPath); err != nil {
+		return fmt.Errorf("failed to install database: %w", err)
+	}
+	return nil
+}
+
+// validateGeoIPDatabase opens a downloaded database with the configured provider's parser
+func validateGeoIPDatabase(provider, path string) error {
+	if provider == geoProviderIP2Location {
+		_, err := newIP2LocationGeoProvider(path, "")
+		return err
+	}
+	db, err := geoip2.Open(path)
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// reloadGeoProvider swaps in a provider built from the current database files
+// The old provider is closed after a grace period so in-flight lookups can finish
+func (s *Server) reloadGeoProvider() error {
+	provider, err := NewGeoProvider(s.config.GeoIP, s.geoIPDBPath)
+	if err != nil {
+		return err
+	}
+
+	s.geoProvider() // Make sure first-use initialization can't overwrite the new provider
+	s.geoMu.Lock()
+	old := s.geo
+	s.geo = provider
+	s.geoMu.Unlock()
+
+	if old != nil {
+		time.AfterFunc(geoReloadGrace, func() { old.Close() })
+	}
+	return nil
+}
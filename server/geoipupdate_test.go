@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestGeoIPUpdater verifies zstd downloads are verified, installed with a backup, reloaded, and skipped when unmodified,
+// and that rejected downloads leave no temp files behind
+func TestGeoIPUpdater(t *testing.T) {
+	csv := func(city string) []byte {
+		return []byte(`"134744064","134744319","US","United States of America","California","` + city + `","37.405992","-122.078515"` + "\n")
+	}
+	encoder, _ := zstd.NewWriter(nil)
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	var published []byte
+	modified := time.Now().Add(-time.Hour).Truncate(time.Second)
+	publish := func(data []byte) {
+		published = encoder.EncodeAll(data, nil)
+		modified = modified.Add(time.Minute)
+	}
+	checksum := ""
+	mux := http.NewServeMux()
+	mux.HandleFunc("/db.csv.zst", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "db.csv.zst", modified, bytes.NewReader(published))
+	})
+	mux.HandleFunc("/db.csv.zst.sha256", func(w http.ResponseWriter, r *http.Request) {
+		if checksum != "" {
+			w.Write([]byte(checksum + "  db.csv.zst\n"))
+			return
+		}
+		sum := sha256.Sum256(published)
+		w.Write([]byte(hex.EncodeToString(sum[:]) + "  db.csv.zst\n"))
+	})
+	mux.HandleFunc("/db.csv.zst.sig", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(common.SignUpdateManifest(privateKey, published)))
+	})
+	source := httptest.NewServer(mux)
+	defer source.Close()
+
+	dbPath := filepath.Join(t.TempDir(), "IP2LOCATION-LITE-DB5.CSV")
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.GeoIPDBPath = dbPath
+		c.GeoIP = common.GeoIPConfig{
+			Provider: geoProviderIP2Location,
+			AutoUpdate: common.GeoIPAutoUpdateConfig{
+				Enabled:     true,
+				URL:         source.URL + "/db.csv.zst",
+				SHA256URL:   source.URL + "/db.csv.zst.sha256",
+				PublicKey:   base64.StdEncoding.EncodeToString(publicKey),
+				KeepBackups: 1,
+			},
+		}
+	})
+	server.geoIPDBPath = dbPath
+
+	updater, err := NewGeoIPUpdater(server.config.GeoIP, dbPath, server.reloadGeoProvider)
+	if err != nil {
+		t.Fatalf("Failed to create updater: %v", err)
+	}
+
+	publish(csv("Mountain View"))
+	if updated, err := updater.Update(); !updated || err != nil {
+		t.Fatalf("Expected initial download to install, got updated=%v err=%v", updated, err)
+	}
+	if info, _ := server.geoProvider().Lookup(net.ParseIP("8.8.8.8")); info.City != "Mountain View" {
+		t.Errorf("Expected installed database to be used, got %+v", info)
+	}
+
+	if updated, err := updater.Update(); updated || err != nil {
+		t.Errorf("Expected unmodified database to be skipped, got updated=%v err=%v", updated, err)
+	}
+
+	publish(csv("Sunnyvale"))
+	if updated, err := updater.Update(); !updated || err != nil {
+		t.Fatalf("Expected new database to install, got updated=%v err=%v", updated, err)
+	}
+	if info, _ := server.geoProvider().Lookup(net.ParseIP("8.8.8.8")); info.City != "Sunnyvale" {
+		t.Errorf("Expected provider to be reloaded, got %+v", info)
+	}
+	if backup, err := os.ReadFile(dbPath + ".1"); err != nil || !bytes.Contains(backup, []byte("Mountain View")) {
+		t.Errorf("Expected previous database kept as backup, got %q (%v)", backup, err)
+	}
+
+	publish(csv("Tampered"))
+	checksum = hex.EncodeToString(make([]byte, sha256.Size))
+	if _, err := updater.Update(); err == nil {
+		t.Error("Expected checksum mismatch to be rejected")
+	}
+	if current, _ := os.ReadFile(dbPath); !bytes.Contains(current, []byte("Sunnyvale")) {
+		t.Errorf("Expected rejected download to leave the database untouched, got %q", current)
+	}
+	if leftovers, _ := filepath.Glob(dbPath + ".download-*"); len(leftovers) != 0 {
+		t.Errorf("Expected downloads to be cleaned up, found %v", leftovers)
+	}
+
+	if _, err := NewGeoIPUpdater(common.GeoIPConfig{AutoUpdate: common.GeoIPAutoUpdateConfig{Enabled: true, URL: source.URL}}, dbPath, nil); err == nil {
+		t.Error("Expected auto-update without checksum or signature to be rejected")
+	}
+}
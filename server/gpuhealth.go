@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// GPUFault returns why a backend is excluded from GPU tiers, or "" if its GPUs are healthy
+// Uncorrected ECC errors count until the driver resets them; critical XIDs count for the hold period
+func (c *ClientState) GPUFault(now time.Time) string {
+	if c.GPUECCFault != "" {
+		return c.GPUECCFault
+	}
+	if c.GPUXIDFault != "" && now.Before(c.GPUXIDFaultUntil) {
+		return c.GPUXIDFault
+	}
+	return ""
+}
+
+// updateGPUFaultLocked re-evaluates a backend's GPU faults from a new stats report
+// Must be called with s.mu held
+func (s *Server) updateGPUFaultLocked(client *ClientState, gpus []common.GPUStats, now time.Time) {
+	wasFaulted := client.GPUFault(now)
+
+	client.GPUECCFault = ""
+	for _, gpu := range gpus {
+		if gpu.ECCErrorsUncorrected > 0 {
+			client.GPUECCFault = fmt.Sprintf("GPU %d: %d uncorrected ECC errors", gpu.DeviceID, gpu.ECCErrorsUncorrected)
+			break
+		}
+	}
+
+	for _, gpu := range gpus {
+		for _, xid := range gpu.RecentXIDs {
+			if !s.isCriticalXID(xid) {
+				continue
+			}
+			client.GPUXIDFault = fmt.Sprintf("GPU %d: XID %d", gpu.DeviceID, xid)
+			client.GPUXIDFaultUntil = now.Add(time.Duration(s.config.GPUFaultHoldMinutes) * time.Minute)
+		}
+	}
+
+	fault := client.GPUFault(now)
+	if fault != "" && wasFaulted == "" {
+		LogWarnWithData("Backend excluded from GPU tiers due to GPU fault", map[string]interface{}{
+			"client_id": client.Registration.ClientID,
+			"fault":     fault,
+		})
+	} else if fault == "" && wasFaulted != "" {
+		LogInfoWithData("Backend GPU fault cleared", map[string]interface{}{
+			"client_id": client.Registration.ClientID,
+			"fault":     wasFaulted,
+		})
+	}
+}
+
+// isCriticalXID reports whether an XID code is configured as a critical GPU fault
+func (s *Server) isCriticalXID(xid uint64) bool {
+	for _, critical := range s.config.GPUCriticalXIDs {
+		if xid == critical {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// newGPUFaultTestServer creates a server with a GPU tier and one GPU backend
+func newGPUFaultTestServer(t *testing.T) (*Server, *ClientState) {
+	db, cleanup := CreateTestDB(t)
+	t.Cleanup(cleanup)
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.Tiers = append(c.Tiers, common.TierSpec{Name: "gpu", VCPU: 1, MemoryGB: 1.0, GPU: 1})
+		c.GPUCriticalXIDs = []uint64{48, 79}
+		c.GPUFaultHoldMinutes = 30
+	})
+
+	client := NewMockClient(MockClientOptions{
+		ClientID:  "gpu-backend",
+		TotalGPUs: 1,
+		GPUs:      []common.GPUStats{{DeviceID: 0, MemoryTotalGB: 24}},
+	})
+	server.AddMockClient(client)
+	return server, client
+}
+
+// TestGPUFault_UncorrectedECC verifies uncorrected ECC errors exclude a backend from GPU tiers only
+func TestGPUFault_UncorrectedECC(t *testing.T) {
+	server, client := newGPUFaultTestServer(t)
+
+	server.mu.Lock()
+	server.updateGPUFaultLocked(client, []common.GPUStats{{DeviceID: 0, ECCErrorsUncorrected: 3}}, time.Now())
+	server.mu.Unlock()
+
+	if server.hasResources(client, server.tierSpecs["gpu"]) {
+		t.Error("Expected GPU tier to skip a backend with uncorrected ECC errors")
+	}
+	if !server.hasResources(client, server.tierSpecs["lite"]) {
+		t.Error("Expected CPU tier to keep using the backend")
+	}
+
+	// The fault clears once the driver resets the counters
+	server.mu.Lock()
+	server.updateGPUFaultLocked(client, []common.GPUStats{{DeviceID: 0}}, time.Now())
+	server.mu.Unlock()
+	if !server.hasResources(client, server.tierSpecs["gpu"]) {
+		t.Error("Expected GPU tier to use the backend after the ECC fault cleared")
+	}
+}
+
+// TestGPUFault_CriticalXIDHold verifies critical XIDs exclude a backend for the hold period and others are ignored
+func TestGPUFault_CriticalXIDHold(t *testing.T) {
+	server, client := newGPUFaultTestServer(t)
+	now := time.Now()
+
+	server.mu.Lock()
+	server.updateGPUFaultLocked(client, []common.GPUStats{{DeviceID: 0, RecentXIDs: []uint64{13}}}, now)
+	server.mu.Unlock()
+	if fault := client.GPUFault(now); fault != "" {
+		t.Errorf("Expected non-critical XID to be ignored, got %q", fault)
+	}
+
+	server.mu.Lock()
+	server.updateGPUFaultLocked(client, []common.GPUStats{{DeviceID: 0, RecentXIDs: []uint64{79}}}, now)
+	// A later clean report does not clear the XID fault
+	server.updateGPUFaultLocked(client, []common.GPUStats{{DeviceID: 0}}, now.Add(time.Minute))
+	server.mu.Unlock()
+
+	if fault := client.GPUFault(now.Add(29 * time.Minute)); fault != "GPU 0: XID 79" {
+		t.Errorf("Expected XID 79 fault during the hold period, got %q", fault)
+	}
+	if fault := client.GPUFault(now.Add(31 * time.Minute)); fault != "" {
+		t.Errorf("Expected XID fault to expire after the hold period, got %q", fault)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"cyqle.in/opsen/common"
+)
+
+// validateGPURequirements checks a tier's gpu_models and min_cc settings
+func validateGPURequirements(tier common.TierSpec) error {
+	if tier.MinComputeCapability < 0 {
+		return fmt.Errorf("tier %s: min_cc must not be negative", tier.Name)
+	}
+	if (len(tier.GPUModels) > 0 || tier.MinComputeCapability > 0) && tier.GPU == 0 {
+		return fmt.Errorf("tier %s: gpu_models and min_cc require gpu > 0", tier.Name)
+	}
+	for _, model := range tier.GPUModels {
+		if strings.TrimSpace(model) == "" {
+			return fmt.Errorf("tier %s: gpu_models must not contain empty names", tier.Name)
+		}
+	}
+	return nil
+}
+
+// gpuRequirementsMet reports whether a backend has at least tier.GPU GPUs of an allowed model and architecture
+// Backends that didn't report compute capabilities (older agents) never satisfy min_cc
+func gpuRequirementsMet(reg common.ClientRegistration, tier common.TierSpec) bool {
+	if len(tier.GPUModels) == 0 && tier.MinComputeCapability == 0 {
+		return true
+	}
+
+	matching := 0
+	for i, model := range reg.GPUModels {
+		if !gpuModelAllowed(model, tier.GPUModels) {
+			continue
+		}
+		if tier.MinComputeCapability > 0 {
+			// Compute capabilities are reported with one decimal (e.g. 8.6); compare with a small tolerance
+			if i >= len(reg.GPUComputeCapabilities) || reg.GPUComputeCapabilities[i]+0.001 < tier.MinComputeCapability {
+				continue
+			}
+		}
+		matching++
+	}
+	return float64(matching) >= tier.GPU
+}
+
+// gpuModelAllowed matches a reported model name ("NVIDIA A100-SXM4-80GB") against a tier's model list ("A100")
+func gpuModelAllowed(model string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	model = strings.ToLower(model)
+	for _, want := range allowed {
+		if strings.Contains(model, strings.ToLower(strings.TrimSpace(want))) {
+			return true
+		}
+	}
+	return false
+}
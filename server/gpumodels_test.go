@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestGPURequirements_ModelAndComputeCapability verifies GPU tiers only match allowed models and architectures
+func TestGPURequirements_ModelAndComputeCapability(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.Tiers = append(c.Tiers,
+			common.TierSpec{Name: "inference", VCPU: 1, MemoryGB: 1.0, GPU: 1, GPUModels: []string{"A100", "H100"}},
+			common.TierSpec{Name: "ampere", VCPU: 1, MemoryGB: 1.0, GPU: 1, MinComputeCapability: 8.0},
+			common.TierSpec{Name: "any-gpu", VCPU: 1, MemoryGB: 1.0, GPU: 1},
+		)
+	})
+
+	newGPUBackend := func(id, model string, caps []float64) *ClientState {
+		client := NewMockClient(MockClientOptions{
+			ClientID:  id,
+			TotalGPUs: 1,
+			GPUModels: []string{model},
+			GPUs:      []common.GPUStats{{DeviceID: 0, Name: model, MemoryTotalGB: 80}},
+		})
+		client.Registration.GPUComputeCapabilities = caps
+		server.AddMockClient(client)
+		return client
+	}
+
+	a100 := newGPUBackend("a100", "NVIDIA A100-SXM4-80GB", []float64{8.0})
+	gtx := newGPUBackend("gtx", "NVIDIA GeForce GTX 1080 Ti", []float64{6.1})
+	legacy := newGPUBackend("legacy", "NVIDIA RTX A6000", nil) // Agent predates compute capability reporting
+
+	tests := []struct {
+		client *ClientState
+		tier   string
+		want   bool
+	}{
+		{a100, "inference", true},
+		{a100, "ampere", true},
+		{gtx, "inference", false},
+		{gtx, "ampere", false},
+		{gtx, "any-gpu", true},
+		{legacy, "ampere", false},
+		{legacy, "any-gpu", true},
+	}
+	for _, tt := range tests {
+		if got := server.hasResources(tt.client, server.tierSpecs[tt.tier]); got != tt.want {
+			t.Errorf("hasResources(%s, %s) = %v, want %v", tt.client.Registration.ClientID, tt.tier, got, tt.want)
+		}
+	}
+}
+
+// TestGPURequirements_CountsMatchingGPUs verifies multi-GPU tiers need enough GPUs of an allowed model
+func TestGPURequirements_CountsMatchingGPUs(t *testing.T) {
+	reg := common.ClientRegistration{
+		GPUModels:              []string{"NVIDIA H100 80GB HBM3", "NVIDIA GeForce GTX 1080"},
+		GPUComputeCapabilities: []float64{9.0, 6.1},
+	}
+	if !gpuRequirementsMet(reg, common.TierSpec{GPU: 1, GPUModels: []string{"h100"}}) {
+		t.Error("Expected a single H100 to satisfy a 1-GPU tier (case-insensitive match)")
+	}
+	if gpuRequirementsMet(reg, common.TierSpec{GPU: 2, MinComputeCapability: 8.0}) {
+		t.Error("Expected a 2-GPU tier to reject a backend with only one GPU meeting min_cc")
+	}
+}
+
+// TestGPURequirements_Validation verifies invalid gpu_models and min_cc settings are rejected
+func TestGPURequirements_Validation(t *testing.T) {
+	invalid := []common.TierSpec{
+		{Name: "neg", GPU: 1, MinComputeCapability: -1},
+		{Name: "cpu", MinComputeCapability: 8.0},
+		{Name: "blank", GPU: 1, GPUModels: []string{" "}},
+	}
+	for _, tier := range invalid {
+		if _, err := buildTierSpecs([]common.TierSpec{tier}); err == nil {
+			t.Errorf("Expected tier %s to be rejected", tier.Name)
+		}
+	}
+	if _, err := buildTierSpecs([]common.TierSpec{{Name: "ok", GPU: 1, GPUModels: []string{"A100"}, MinComputeCapability: 8.0}}); err != nil {
+		t.Errorf("Expected valid GPU requirements, got %v", err)
+	}
+}
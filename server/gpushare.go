@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"cyqle.in/opsen/common"
+)
+
+// gpuShareEpsilon absorbs float rounding when fractional shares add up to a whole device (e.g. 3 × 1/3)
+const gpuShareEpsilon = 1e-9
+
+// gpuDeviceLoad is what in-flight allocations hold on one GPU device
+type gpuDeviceLoad struct {
+	Share    float64 // Fraction of the device (1 = taken whole)
+	MemoryGB float64 // VRAM held by fractional sessions on this device
+}
+
+// pendingReservation is what a backend's in-flight allocations hold: resource totals plus per-device GPU shares
+type pendingReservation struct {
+	common.TierSpec
+	GPUDevices   map[int]gpuDeviceLoad // Device index → load (nil if no GPU allocations are pending)
+	unplacedGPUs float64               // Devices held by allocations recorded without devices
+	allocations  int                   // Unexpired allocations counted (for max_pending_per_backend)
+}
+
+// fractionalGPU reports whether a tier shares one device (0 < gpu < 1) instead of taking whole GPUs
+func fractionalGPU(tier common.TierSpec) bool {
+	return tier.GPU > 0 && tier.GPU < 1
+}
+
+// validateGPUShare checks that a tier asks for a fraction of one GPU or a whole number of GPUs
+func validateGPUShare(tier common.TierSpec) error {
+	if tier.GPU > 1 && tier.GPU != math.Trunc(tier.GPU) {
+		return fmt.Errorf("tier %s: gpu must be a fraction of one GPU (below 1) or a whole number of GPUs, got %g", tier.Name, tier.GPU)
+	}
+	return nil
+}
+
+// addGPULoad records an allocation's GPU devices in a reservation
+func (p *pendingReservation) addGPULoad(allocation PendingAllocation) {
+	if allocation.TierSpec.GPU <= 0 {
+		return
+	}
+	if len(allocation.GPUSet) == 0 {
+		p.unplacedGPUs += math.Ceil(allocation.TierSpec.GPU)
+		return
+	}
+	if p.GPUDevices == nil {
+		p.GPUDevices = make(map[int]gpuDeviceLoad)
+	}
+	for _, device := range allocation.GPUSet {
+		load := p.GPUDevices[device]
+		if fractionalGPU(allocation.TierSpec) {
+			load.Share += allocation.TierSpec.GPU
+			load.MemoryGB += allocation.TierSpec.GPUMemoryGB
+		} else {
+			load.Share = 1
+		}
+		p.GPUDevices[device] = load
+	}
+}
+
+// busyGPUDevices counts devices no whole-GPU session can take: any share pending on them, or allocations
+// recorded without devices, which count as their GPU requirement
+func busyGPUDevices(pending pendingReservation) float64 {
+	busy := 0.0
+	for _, load := range pending.GPUDevices {
+		if load.Share > 0 {
+			busy++
+		}
+	}
+	return busy + pending.unplacedGPUs
+}
+
+// usableGPUDevices returns how many of a backend's devices placement may use, indexed from 0
+// Admin GPU reservations and max_gpus ceilings take devices from the end of the list
+func usableGPUDevices(client *ClientState, headroom backendHeadroom) int {
+	devices := max(client.Registration.TotalGPUs, len(client.Stats.GPUs))
+	return max(min(devices, headroom.GPUs), 0)
+}
+
+// gpuDeviceAllowed reports whether device i matches a tier's gpu_models and min_cc
+func gpuDeviceAllowed(client *ClientState, tier common.TierSpec, i int) bool {
+	if i < len(client.Registration.GPUModels) && !gpuModelAllowed(client.Registration.GPUModels[i], tier.GPUModels) {
+		return false
+	}
+	return tier.MinComputeCapability == 0 ||
+		(i < len(client.Registration.GPUComputeCapabilities) && client.Registration.GPUComputeCapabilities[i]+0.001 >= tier.MinComputeCapability)
+}
+
+// gpuDeviceFits reports whether a fractional session fits on device i: the device is allowed, its share
+// leaves room, and its free VRAM (minus pending sessions on it) covers gpu_memory_gb
+func gpuDeviceFits(client *ClientState, tier common.TierSpec, i int, load gpuDeviceLoad) bool {
+	if !gpuDeviceAllowed(client, tier, i) {
+		return false
+	}
+	if load.Share+tier.GPU > 1+gpuShareEpsilon {
+		return false
+	}
+	if tier.GPUMemoryGB > 0 && i < len(client.Stats.GPUs) {
+		gpu := client.Stats.GPUs[i]
+		if gpu.MemoryTotalGB-gpu.MemoryUsedGB-load.MemoryGB < tier.GPUMemoryGB {
+			return false
+		}
+	}
+	return true
+}
+
+// gpuSharesAvailable counts the fractional sessions of a tier a backend's devices can still take
+func gpuSharesAvailable(client *ClientState, tier common.TierSpec, headroom backendHeadroom, pending pendingReservation) int {
+	sessions := 0
+	for i := 0; i < usableGPUDevices(client, headroom); i++ {
+		load := pending.GPUDevices[i]
+		for gpuDeviceFits(client, tier, i, load) {
+			sessions++
+			load.Share += tier.GPU
+			load.MemoryGB += tier.GPUMemoryGB
+		}
+	}
+	return sessions
+}
+
+// pickGPUSetLocked chooses the devices for a new GPU session. A fractional session goes to the fitting device
+// with the largest share already taken, packing sessions so whole devices stay free; whole-GPU sessions get
+// devices with nothing pending, lowest index first. Returns nil when no devices fit
+// Must be called with s.mu held
+func (s *Server) pickGPUSetLocked(client *ClientState, tier common.TierSpec) []int {
+	if tier.GPU <= 0 {
+		return nil
+	}
+	return pickGPUSet(client, tier, s.backendHeadroomLocked(client), s.pendingReservationLocked(client.Registration.ClientID))
+}
+
+// pickGPUSet chooses a new GPU session's devices given a backend's headroom and pending reservations
+func pickGPUSet(client *ClientState, tier common.TierSpec, headroom backendHeadroom, pending pendingReservation) []int {
+	devices := usableGPUDevices(client, headroom)
+
+	if fractionalGPU(tier) {
+		best := -1
+		for i := 0; i < devices; i++ {
+			if !gpuDeviceFits(client, tier, i, pending.GPUDevices[i]) {
+				continue
+			}
+			if best < 0 || pending.GPUDevices[i].Share > pending.GPUDevices[best].Share {
+				best = i
+			}
+		}
+		if best < 0 {
+			return nil
+		}
+		return []int{best}
+	}
+
+	gpuset := []int{}
+	for i := 0; i < devices && len(gpuset) < int(tier.GPU); i++ {
+		if pending.GPUDevices[i].Share > 0 || !gpuDeviceAllowed(client, tier, i) {
+			continue
+		}
+		gpuset = append(gpuset, i)
+	}
+	if len(gpuset) < int(tier.GPU) {
+		return nil
+	}
+	return gpuset
+}
+
+// suggestedGPUs returns the devices assumed for a routed request as a CUDA_VISIBLE_DEVICES list (e.g. "0,2")
+// New sessions reuse the devices recorded with their pending allocation; sticky hits get a fresh pick
+func (s *Server) suggestedGPUs(client *ClientState, tierSpec common.TierSpec, requestID string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, pending := range s.pendingAllocations[client.Registration.ClientID] {
+		if pending.RequestID == requestID && len(pending.GPUSet) > 0 {
+			return formatGPUSet(pending.GPUSet)
+		}
+	}
+	return formatGPUSet(s.pickGPUSetLocked(client, tierSpec))
+}
+
+func formatGPUSet(devices []int) string {
+	parts := make([]string, len(devices))
+	for i, device := range devices {
+		parts[i] = strconv.Itoa(device)
+	}
+	return strings.Join(parts, ",")
+}
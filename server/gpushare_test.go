@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// newGPUShareServer returns a server with one backend carrying two L4 GPUs with the given stats
+func newGPUShareServer(t *testing.T, gpus []common.GPUStats) (*Server, *ClientState) {
+	t.Helper()
+	db, cleanup := CreateTestDB(t)
+	t.Cleanup(cleanup)
+
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{
+		ClientID:    "gpu-host",
+		TotalCPU:    32,
+		CPUUsageAvg: make([]float64, 32),
+		TotalGPUs:   len(gpus),
+		GPUModels:   []string{"L4", "L4"},
+		GPUs:        gpus,
+	}))
+	return server, server.clientCache["gpu-host"]
+}
+
+// TestGPUShare_PacksOneDevice verifies four quarter-GPU sessions share a device before the next is used,
+// and that devices holding shares are not handed to whole-GPU tiers
+func TestGPUShare_PacksOneDevice(t *testing.T) {
+	server, client := newGPUShareServer(t, []common.GPUStats{
+		{DeviceID: 0, MemoryTotalGB: 24},
+		{DeviceID: 1, MemoryTotalGB: 24},
+	})
+	lite := common.TierSpec{Name: "lite-inference", VCPU: 1, MemoryGB: 1, GPU: 0.25, GPUMemoryGB: 5}
+	whole := common.TierSpec{Name: "train", VCPU: 1, MemoryGB: 1, GPU: 1}
+
+	if got := server.tierCapacityLocked(client, lite); got != 8 {
+		t.Errorf("Expected capacity for 8 quarter-GPU sessions, got %d", got)
+	}
+
+	for i := 0; i < 4; i++ {
+		server.addPendingAllocation("gpu-host", "", "lite-inference", lite, "req-"+string(rune('a'+i)))
+	}
+	for _, allocation := range server.pendingAllocations["gpu-host"] {
+		if len(allocation.GPUSet) != 1 || allocation.GPUSet[0] != 0 {
+			t.Fatalf("Expected every share on device 0, got %v", allocation.GPUSet)
+		}
+	}
+	if !server.hasResources(client, whole) {
+		t.Error("Expected device 1 to remain free for a whole-GPU session")
+	}
+
+	server.addPendingAllocation("gpu-host", "", "lite-inference", lite, "req-e")
+	if gpus := server.suggestedGPUs(client, lite, "req-e"); gpus != "1" {
+		t.Errorf("Expected the fifth share on device 1, got %q", gpus)
+	}
+	if server.hasResources(client, whole) {
+		t.Error("Expected no whole GPU once both devices hold shares")
+	}
+}
+
+// TestGPUShare_PerDeviceVRAM verifies a fractional session needs its VRAM on one device, not summed across devices
+func TestGPUShare_PerDeviceVRAM(t *testing.T) {
+	server, client := newGPUShareServer(t, []common.GPUStats{
+		{DeviceID: 0, MemoryTotalGB: 24, MemoryUsedGB: 18},
+		{DeviceID: 1, MemoryTotalGB: 24, MemoryUsedGB: 18},
+	})
+
+	if server.hasResources(client, common.TierSpec{Name: "lite", GPU: 0.5, GPUMemoryGB: 8}) {
+		t.Error("Expected 6GB free per device not to fit an 8GB share, though 12GB are free in total")
+	}
+	if !server.hasResources(client, common.TierSpec{Name: "lite", GPU: 0.5, GPUMemoryGB: 6}) {
+		t.Error("Expected a 6GB share to fit")
+	}
+}
+
+// TestValidateGPUShare verifies gpu is a fraction below 1 or a whole number of GPUs
+func TestValidateGPUShare(t *testing.T) {
+	for _, gpu := range []float64{0.25, 0.5, 1, 2} {
+		if err := validateGPUShare(common.TierSpec{Name: "t", GPU: gpu}); err != nil {
+			t.Errorf("Expected gpu %g to be valid, got %v", gpu, err)
+		}
+	}
+	if err := validateGPUShare(common.TierSpec{Name: "t", GPU: 1.5}); err == nil {
+		t.Error("Expected gpu 1.5 to be rejected")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"hash/fnv"
+	"sort"
+
+	"cyqle.in/opsen/common"
+)
+
+// Sticky modes
+const (
+	StickyModeTable = "table" // Persist sticky_id+tier → client_id assignments (default)
+	StickyModeHash  = "hash"  // Derive backend from sticky_id via rendezvous hashing (stateless)
+)
+
+// isHashStickyMode reports whether sticky routing uses consistent hashing instead of the assignments table
+func (s *Server) isHashStickyMode() bool {
+	return s.config.StickyMode == StickyModeHash
+}
+
+// stickyHashKey builds the hash key for a sticky ID
+// With affinity enabled all tiers of a sticky ID hash identically, so they land on the same backend
+func (s *Server) stickyHashKey(stickyID, tier string) string {
+	if s.stickyAffinityEnabled {
+		return stickyID
+	}
+	return stickyID + "|" + tier
+}
+
+// findClientByHash selects a backend using rendezvous (highest random weight) hashing
+// Candidates are healthy, non-stale backends with capacity for the tier. Picking the highest
+// weight among them is equivalent to walking the key's preference order until a backend fits,
+// so topology changes only move keys whose preferred backend disappeared or filled up.
+func (s *Server) findClientByHash(key string, tier common.TierSpec) *ClientState {
+	snapshot := s.routingSnapshot()
+
+	// Candidates within the latency budget, then outside it (allow_degraded only), in preference order
+	var candidates, degraded []scoredBackend
+	for _, backend := range snapshot.backends {
+		if !s.fitsSnapshot(backend, tier) {
+			continue
+		}
+
+		candidate := scoredBackend{client: backend.client, weight: rendezvousWeight(key, backend.client.Registration.ClientID)}
+
+		// Hash placement has no client location, so only max_latency_ms applies
+		if !withinLatencyBudget(backend.client, tier, 0) {
+			if tier.AllowDegraded {
+				degraded = append(degraded, candidate)
+			}
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	for _, list := range [][]scoredBackend{candidates, degraded} {
+		sortByWeight(list)
+		if client := s.firstLiveFit(list, tier, false); client != nil {
+			return client
+		}
+	}
+	return nil
+}
+
+// hashReserveAttempts bounds how often a hash placement moves on after its pick filled up concurrently
+const hashReserveAttempts = 3
+
+// reserveByHash picks the backend for key with findClientByHash and reserves resources on it. The fit is
+// checked again under the write lock: a concurrent placement may have filled the backend since the snapshot
+// was read, and the key then moves to its next preferred backend. Returns nil if nothing fits or the
+// pending allocation caps refuse the placement
+func (s *Server) reserveByHash(key, stickyID, tier string, tierSpec common.TierSpec, requestID string) *ClientState {
+	for attempt := 0; attempt < hashReserveAttempts; attempt++ {
+		client := s.findClientByHash(key, tierSpec)
+		if client == nil {
+			return nil
+		}
+
+		s.mu.Lock()
+		if live, ok := s.clientCache[client.Registration.ClientID]; !ok || live != client || !s.hasResourcesLocked(client, tierSpec) {
+			s.mu.Unlock()
+			continue
+		}
+		admitted := s.admitPendingAllocationLocked(client.Registration.ClientID, stickyID, tier, tierSpec, requestID)
+		s.mu.Unlock()
+		if !admitted {
+			return nil
+		}
+		return client
+	}
+	return nil
+}
+
+// sortByWeight orders hash candidates by descending weight, ties by client ID
+func sortByWeight(candidates []scoredBackend) {
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].weight != candidates[j].weight {
+			return candidates[i].weight > candidates[j].weight
+		}
+		return candidates[i].client.Registration.ClientID < candidates[j].client.Registration.ClientID
+	})
+}
+
+// rendezvousWeight computes the HRW weight of a backend for a key
+func rendezvousWeight(key, clientID string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write([]byte(clientID))
+	return mix64(h.Sum64())
+}
+
+// mix64 applies a 64-bit finalizer so similar inputs spread evenly (FNV alone clusters on short keys)
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
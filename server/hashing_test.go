@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+func newHashModeServer(t *testing.T, affinity bool) (*Server, func()) {
+	t.Helper()
+	db, cleanup := CreateTestDB(t)
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.StickyMode = StickyModeHash
+		c.StickyAffinityEnabled = affinity
+	})
+	for i := 0; i < 5; i++ {
+		server.AddMockClient(NewMockClient(MockClientOptions{ClientID: fmt.Sprintf("backend-%d", i)}))
+	}
+	return server, cleanup
+}
+
+// TestHashMode_SameStickyIDSameBackend verifies a sticky ID consistently maps to one backend
+func TestHashMode_SameStickyIDSameBackend(t *testing.T) {
+	server, cleanup := newHashModeServer(t, true)
+	defer cleanup()
+
+	first := server.selectClientWithStickiness("user-42", "lite", server.tierSpecs["lite"], 0, 0, "req-1")
+	if first == nil {
+		t.Fatal("Expected a backend to be selected")
+	}
+
+	for i := 0; i < 10; i++ {
+		server.ClearPendingAllocations()
+		client := server.selectClientWithStickiness("user-42", "lite", server.tierSpecs["lite"], 0, 0, fmt.Sprintf("req-%d", i))
+		AssertClientSelected(t, client, first.Registration.ClientID)
+	}
+}
+
+// TestHashMode_NoAssignmentState verifies hash mode never writes sticky assignments
+func TestHashMode_NoAssignmentState(t *testing.T) {
+	server, cleanup := newHashModeServer(t, true)
+	defer cleanup()
+
+	server.selectClientWithStickiness("user-1", "lite", server.tierSpecs["lite"], 0, 0, "req-1")
+
+	if len(server.stickyAssignments) != 0 {
+		t.Errorf("Expected no in-memory sticky assignments, got %d", len(server.stickyAssignments))
+	}
+
+	var count int
+	if err := server.db.QueryRow("SELECT COUNT(*) FROM sticky_assignments").Scan(&count); err != nil {
+		t.Fatalf("Failed to query sticky assignments: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected no persisted sticky assignments, got %d", count)
+	}
+
+	if server.CountPendingAllocations() != 1 {
+		t.Errorf("Expected resources to still be reserved, got %d pending allocations", server.CountPendingAllocations())
+	}
+}
+
+// TestHashMode_MinimalDisruption verifies removing a backend only moves keys that were on it
+func TestHashMode_MinimalDisruption(t *testing.T) {
+	server, cleanup := newHashModeServer(t, true)
+	defer cleanup()
+
+	before := make(map[string]string)
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		before[key] = server.findClientByHash(key, server.tierSpecs["lite"]).Registration.ClientID
+	}
+
+	server.mu.Lock()
+	delete(server.clientCache, "backend-2")
+	server.mu.Unlock()
+
+	for key, previous := range before {
+		current := server.findClientByHash(key, server.tierSpecs["lite"]).Registration.ClientID
+		if previous != "backend-2" && current != previous {
+			t.Errorf("Key %s moved from %s to %s although its backend is still present", key, previous, current)
+		}
+	}
+}
+
+// TestHashMode_SkipsFullBackend verifies keys fall through to the next preferred backend
+func TestHashMode_SkipsFullBackend(t *testing.T) {
+	server, cleanup := newHashModeServer(t, true)
+	defer cleanup()
+
+	preferred := server.findClientByHash("user-7", server.tierSpecs["pro-max"])
+	if preferred == nil {
+		t.Fatal("Expected a preferred backend")
+	}
+
+	server.mu.Lock()
+	preferred.Stats.MemoryAvail = 0.5
+	server.mu.Unlock()
+
+	fallback := server.findClientByHash("user-7", server.tierSpecs["pro-max"])
+	if fallback == nil || fallback.Registration.ClientID == preferred.Registration.ClientID {
+		t.Error("Expected a different backend when the preferred one lacks capacity")
+	}
+}
+
+// TestHashMode_ConcurrentPlacementsDoNotOvercommit verifies concurrent hash placements reserve no more
+// sessions than the backend fits, since each fit is confirmed under the lock that reserves it
+func TestHashMode_ConcurrentPlacementsDoNotOvercommit(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.StickyMode = StickyModeHash
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{
+		ClientID:    "limited-backend",
+		CPUUsageAvg: []float64{10, 10, 10, 10, 90, 90, 90, 90}, // 4 cores available
+		MemoryAvail: 10.0,
+	}))
+	tierSpec := server.tierSpecs["lite"] // 1 vCPU, 1 GB
+
+	var wg sync.WaitGroup
+	var placed atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stickyID := fmt.Sprintf("user-%d", i)
+			if server.reserveByHash(server.stickyHashKey(stickyID, "lite"), stickyID, "lite", tierSpec, fmt.Sprintf("req-%d", i)) != nil {
+				placed.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if placed.Load() != 4 {
+		t.Errorf("Expected exactly 4 placements on 4 free cores, got %d", placed.Load())
+	}
+}
+
+// TestHashMode_TierKeying verifies affinity controls whether tiers share a hash key
+func TestHashMode_TierKeying(t *testing.T) {
+	withAffinity, cleanup := newHashModeServer(t, true)
+	defer cleanup()
+	if withAffinity.stickyHashKey("user", "lite") != withAffinity.stickyHashKey("user", "pro-max") {
+		t.Error("Expected identical hash keys across tiers with affinity enabled")
+	}
+
+	withoutAffinity, cleanup2 := newHashModeServer(t, false)
+	defer cleanup2()
+	if withoutAffinity.stickyHashKey("user", "lite") == withoutAffinity.stickyHashKey("user", "pro-max") {
+		t.Error("Expected per-tier hash keys with affinity disabled")
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HealthCheckTypeHTTPJSON parses the backend's own health document instead of trusting the status code alone
+const HealthCheckTypeHTTPJSON = "http-json"
+
+// maxHealthBodyBytes bounds how much of a health response is parsed
+const maxHealthBodyBytes = 64 << 10
+
+// Normalized health states reported by backends
+const (
+	BackendStatusHealthy   = "healthy"
+	BackendStatusDegraded  = "degraded"
+	BackendStatusUnhealthy = "unhealthy"
+)
+
+// BackendHealthReport is what a backend's health endpoint reported on the last successful http-json probe
+type BackendHealthReport struct {
+	Status         string    `json:"status"`                 // healthy or degraded (unhealthy reports fail the probe)
+	ActiveSessions int       `json:"active_sessions"`        // Sessions the backend says it is serving
+	MaxSessions    int       `json:"max_sessions,omitempty"` // Session capacity, when reported (0 = not reported)
+	ReportedAt     time.Time `json:"reported_at"`
+}
+
+// healthDocument is the JSON a backend health endpoint returns, e.g. {"status":"degraded","active_sessions":12}
+type healthDocument struct {
+	Status         string `json:"status"`
+	ActiveSessions int    `json:"active_sessions"`
+	MaxSessions    int    `json:"max_sessions"`
+}
+
+// normalizeBackendStatus maps common health vocabularies onto healthy, degraded and unhealthy
+// Unknown or missing values return "" and the HTTP status code decides
+func normalizeBackendStatus(status string) string {
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case "ok", "healthy", "up", "pass", "green":
+		return BackendStatusHealthy
+	case "degraded", "warn", "warning", "yellow":
+		return BackendStatusDegraded
+	case "unhealthy", "down", "fail", "error", "critical", "red":
+		return BackendStatusUnhealthy
+	default:
+		return ""
+	}
+}
+
+// probeHTTPJSON performs an HTTP health check and parses the backend's health document
+// A 2xx/3xx response is healthy unless the document reports an unhealthy status; unparseable bodies
+// still count as up, without a report
+func (s *Server) probeHTTPJSON(endpoint, path string, timeout time.Duration) (bool, time.Duration, *BackendHealthReport) {
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: s.config.TLSInsecureSkipVerify,
+			},
+		},
+	}
+
+	start := time.Now()
+	resp, err := client.Get(fmt.Sprintf("%s%s", endpoint, path))
+	if err != nil {
+		return false, time.Since(start), nil
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHealthBodyBytes))
+	latency := time.Since(start)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return false, latency, nil
+	}
+
+	var doc healthDocument
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return true, latency, nil
+	}
+
+	status := normalizeBackendStatus(doc.Status)
+	switch status {
+	case BackendStatusUnhealthy:
+		return false, latency, nil
+	case "":
+		status = BackendStatusHealthy
+	}
+	return true, latency, &BackendHealthReport{
+		Status:         status,
+		ActiveSessions: max(doc.ActiveSessions, 0),
+		MaxSessions:    max(doc.MaxSessions, 0),
+		ReportedAt:     time.Now(),
+	}
+}
+
+// recordHealthReport stores the latest health document (nil after a failed probe)
+func (s *Server) recordHealthReport(client *ClientState, report *BackendHealthReport) {
+	s.mu.Lock()
+	s.invalidateRoutingSnapshot()
+	previous := client.HealthReport
+	client.HealthReport = report
+	s.mu.Unlock()
+
+	if report != nil && (previous == nil || previous.Status != report.Status) {
+		LogInfoWithData("Backend reported health status", map[string]interface{}{
+			"client_id":       client.Registration.ClientID,
+			"status":          report.Status,
+			"active_sessions": report.ActiveSessions,
+			"max_sessions":    report.MaxSessions,
+		})
+	}
+}
+
+// healthReportPenalty returns the score points for a backend's self-reported degradation and load
+func (s *Server) healthReportPenalty(client *ClientState) float64 {
+	report := client.HealthReport
+	if report == nil {
+		return 0
+	}
+	penalty := float64(report.ActiveSessions) * s.config.HealthCheckSessionWeight
+	if report.Status == BackendStatusDegraded {
+		penalty += s.config.HealthCheckDegradedPenalty
+	}
+	return penalty
+}
+
+// sessionsFullLocked reports whether a backend's reported sessions and pending placements reach its reported max_sessions
+// Caller must hold s.mu (read or write)
+func (s *Server) sessionsFullLocked(client *ClientState) bool {
+	if client.HealthReport == nil || client.HealthReport.MaxSessions == 0 {
+		return false
+	}
+	pending := 0
+	now := time.Now()
+	for _, allocation := range s.pendingAllocations[client.Registration.ClientID] {
+		if !allocation.expired(now) {
+			pending++
+		}
+	}
+	return sessionsFull(client, pending)
+}
+
+// sessionsFull reports whether a backend's reported sessions plus pending placements reach its reported max_sessions
+func sessionsFull(client *ClientState, pending int) bool {
+	report := client.HealthReport
+	return report != nil && report.MaxSessions > 0 && report.ActiveSessions+pending >= report.MaxSessions
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// newHealthJSONBackend serves body on /health with status code
+func newHealthJSONBackend(t *testing.T, code int, body string) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+// TestProbeHTTPJSON verifies backend health documents decide the probe result and are kept for routing
+func TestProbeHTTPJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     int
+		body     string
+		success  bool
+		expected *BackendHealthReport
+	}{
+		{"healthy", 200, `{"status":"ok","active_sessions":3}`, true, &BackendHealthReport{Status: BackendStatusHealthy, ActiveSessions: 3}},
+		{"degraded", 200, `{"status":"degraded","active_sessions":12,"max_sessions":20}`, true, &BackendHealthReport{Status: BackendStatusDegraded, ActiveSessions: 12, MaxSessions: 20}},
+		{"reported down", 200, `{"status":"down"}`, false, nil},
+		{"unknown status", 200, `{"status":"starting","active_sessions":1}`, true, &BackendHealthReport{Status: BackendStatusHealthy, ActiveSessions: 1}},
+		{"not json", 200, `OK`, true, nil},
+		{"server error", 503, `{"status":"degraded"}`, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, cleanup := CreateTestDB(t)
+			defer cleanup()
+
+			server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+				c.HealthCheckType = HealthCheckTypeHTTPJSON
+			})
+			backend := newHealthJSONBackend(t, tt.code, tt.body)
+			client := NewMockClient(MockClientOptions{ClientID: "backend-1", Endpoint: backend.URL})
+			server.AddMockClient(client)
+
+			server.probeClient(client)
+
+			if got := client.ConsecutiveSuccesses == 1; got != tt.success {
+				t.Errorf("Expected probe success %v, got successes=%d failures=%d", tt.success, client.ConsecutiveSuccesses, client.ConsecutiveFailures)
+			}
+			report := client.HealthReport
+			if tt.expected == nil {
+				if report != nil {
+					t.Errorf("Expected no health report, got %+v", report)
+				}
+				return
+			}
+			if report == nil {
+				t.Fatal("Expected a health report")
+			}
+			if report.Status != tt.expected.Status || report.ActiveSessions != tt.expected.ActiveSessions || report.MaxSessions != tt.expected.MaxSessions {
+				t.Errorf("Expected %+v, got %+v", tt.expected, report)
+			}
+		})
+	}
+}
+
+// TestHealthReport_Routing verifies degraded states and session counts steer placement
+func TestHealthReport_Routing(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.HealthCheckType = HealthCheckTypeHTTPJSON
+		c.HealthCheckDegradedPenalty = 200
+		c.HealthCheckSessionWeight = 5
+	})
+
+	// The degraded backend is otherwise the better pick
+	degraded := NewMockClient(MockClientOptions{ClientID: "degraded", Endpoint: newHealthJSONBackend(t, 200, `{"status":"degraded","active_sessions":2}`).URL,
+		CPUUsageAvg: []float64{5, 5, 5, 5, 5, 5, 5, 5}})
+	busy := NewMockClient(MockClientOptions{ClientID: "busy", Endpoint: newHealthJSONBackend(t, 200, `{"status":"ok","active_sessions":10}`).URL,
+		CPUUsageAvg: []float64{20, 20, 20, 20, 20, 20, 20, 20}})
+	full := NewMockClient(MockClientOptions{ClientID: "full", Endpoint: newHealthJSONBackend(t, 200, `{"status":"ok","active_sessions":4,"max_sessions":4}`).URL,
+		CPUUsageAvg: []float64{1, 1, 1, 1, 1, 1, 1, 1}})
+	for _, client := range []*ClientState{degraded, busy, full} {
+		server.AddMockClient(client)
+	}
+	server.performHealthChecks()
+
+	tier := server.tierSpecs["lite"]
+	if server.hasResources(full, tier) {
+		t.Error("Expected a backend at its reported max_sessions to take no new sessions")
+	}
+	if got := server.findBestClient(tier, 0, 0); got == nil || got.Registration.ClientID != "busy" {
+		t.Errorf("Expected busy to outrank the degraded backend, got %v", got)
+	}
+
+	// Session counts also weigh in: 60 more sessions outweigh the degraded penalty
+	server.mu.Lock()
+	busy.HealthReport.ActiveSessions = 70
+	server.mu.Unlock()
+	if got := server.findBestClient(tier, 0, 0); got == nil || got.Registration.ClientID != "degraded" {
+		t.Errorf("Expected degraded to win against a much busier backend, got %v", got)
+	}
+}
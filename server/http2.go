@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"cyqle.in/opsen/common"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// h2ReadIdleTimeout is how long a pooled HTTP/2 upstream connection may be silent before it is pinged
+const h2ReadIdleTimeout = 30 * time.Second
+
+// newH2Transport returns the shared transport for HTTP/2 over TLS backends
+// HTTP/2 multiplexes requests over one connection per backend, so unlike the per-request
+// HTTP/1.1 transports it is kept for the life of the server
+func newH2Transport(insecureSkipVerify bool) *http2.Transport {
+	return &http2.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: insecureSkipVerify,
+		},
+		ReadIdleTimeout: h2ReadIdleTimeout,
+	}
+}
+
+// newH2CTransport returns the shared transport for cleartext HTTP/2 (prior knowledge) backends
+func newH2CTransport() *http2.Transport {
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+		ReadIdleTimeout: h2ReadIdleTimeout,
+	}
+}
+
+// validateEndpointProtocol checks an endpoint's upstream protocol against its URL scheme
+func validateEndpointProtocol(protocol, endpointURL string) error {
+	switch protocol {
+	case "", common.EndpointProtocolHTTP1:
+		return nil
+	case common.EndpointProtocolH2C:
+		if !strings.HasPrefix(endpointURL, "http://") {
+			return fmt.Errorf("protocol h2c requires an http:// endpoint: %s", endpointURL)
+		}
+		return nil
+	case common.EndpointProtocolH2:
+		if !strings.HasPrefix(endpointURL, "https://") {
+			return fmt.Errorf("protocol h2 requires an https:// endpoint: %s", endpointURL)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown endpoint protocol: %s (expected http1, h2c or h2)", protocol)
+	}
+}
+
+// endpointProtocol returns the upstream protocol a backend registered for one of its endpoints
+func (c *ClientState) endpointProtocol(endpointURL string) string {
+	for _, ep := range c.Endpoints {
+		if ep.URL == endpointURL {
+			return ep.Protocol
+		}
+	}
+	return c.Registration.EndpointProtocol
+}
+
+// isGRPCRequest reports whether a request is gRPC (application/grpc, application/grpc+proto, ...)
+func isGRPCRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// upstreamProtocol picks the protocol to proxy a request with: the endpoint's configured protocol,
+// or HTTP/2 matching the URL scheme for gRPC requests to endpoints without one (gRPC requires HTTP/2)
+func upstreamProtocol(configured, endpointURL string, grpc bool) string {
+	if configured != "" && configured != common.EndpointProtocolHTTP1 {
+		return configured
+	}
+	if grpc && configured == "" {
+		if strings.HasPrefix(endpointURL, "https://") {
+			return common.EndpointProtocolH2
+		}
+		return common.EndpointProtocolH2C
+	}
+	return common.EndpointProtocolHTTP1
+}
+
+// proxyTransport returns the transport for an upstream protocol
+// HTTP/1.1 transports are built per request so routes can set a response header timeout;
+// HTTP/2 transports are shared and rely on the idle-timeout body wrapper instead
+func (s *Server) proxyTransport(protocol string, headerTimeout time.Duration) http.RoundTripper {
+	switch protocol {
+	case common.EndpointProtocolH2:
+		return s.h2Transport
+	case common.EndpointProtocolH2C:
+		return s.h2cTransport
+	}
+	return &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: s.config.TLSInsecureSkipVerify,
+		},
+		ResponseHeaderTimeout: headerTimeout,
+	}
+}
+
+// publicHandler adds cleartext HTTP/2 (h2c) to the listener's handler when h2c_enabled is set
+// and TLS is not configured (TLS listeners negotiate HTTP/2 via ALPN instead)
+func publicHandler(handler http.Handler, config *common.ServerConfig, tlsEnabled bool) http.Handler {
+	if !config.H2CEnabled || tlsEnabled {
+		return handler
+	}
+	return h2c.NewHandler(handler, &http2.Server{
+		IdleTimeout: time.Duration(config.IdleTimeout) * time.Second,
+	})
+}
+
+// configureHTTP2 turns off HTTP/2 on the TLS listener when http2_enabled is false
+// (net/http negotiates it by default)
+func configureHTTP2(srv *http.Server, config *common.ServerConfig) {
+	if !config.HTTP2Enabled {
+		srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// TestProxy_HTTP2Upstream verifies h2c end to end: an h2c client reaches the proxy over HTTP/2,
+// the backend is reached over HTTP/2 (configured, or inferred for gRPC) and trailers pass through
+func TestProxy_HTTP2Upstream(t *testing.T) {
+	tests := []struct {
+		name        string
+		protocol    string
+		contentType string
+	}{
+		{"configured h2c", common.EndpointProtocolH2C, "application/json"},
+		{"gRPC without configured protocol", "", "application/grpc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var backendProto int
+			backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				backendProto = r.ProtoMajor
+				body, _ := io.ReadAll(r.Body)
+				w.Header().Set("Trailer", "Grpc-Status")
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write(body)
+				w.Header().Set("Grpc-Status", "0")
+			}), &http2.Server{}))
+			defer backend.Close()
+
+			db, cleanup := CreateTestDB(t)
+			defer cleanup()
+			server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+				c.H2CEnabled = true
+			})
+			client := NewMockClient(MockClientOptions{ClientID: "grpc-backend", Endpoint: backend.URL})
+			client.Registration.EndpointProtocol = tt.protocol
+			server.AddMockClient(client)
+
+			front := httptest.NewServer(publicHandler(http.HandlerFunc(server.handleProxy), server.config, false))
+			defer front.Close()
+
+			req, _ := http.NewRequest("POST", front.URL+"/svc.Echo/Say", bytes.NewReader([]byte("payload")))
+			req.Header.Set("Content-Type", tt.contentType)
+			resp, err := (&http.Client{Transport: newH2CTransport()}).Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.ProtoMajor != 2 {
+				t.Errorf("Expected HTTP/2 to the proxy, got HTTP/%d", resp.ProtoMajor)
+			}
+			if backendProto != 2 {
+				t.Errorf("Expected HTTP/2 to the backend, got HTTP/%d", backendProto)
+			}
+			if string(body) != "payload" {
+				t.Errorf("Expected echoed body, got %q", body)
+			}
+			if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+				t.Errorf("Expected Grpc-Status trailer 0, got %q", got)
+			}
+		})
+	}
+}
+
+// TestValidateEndpointProtocol verifies protocols must match the endpoint scheme
+func TestValidateEndpointProtocol(t *testing.T) {
+	tests := []struct {
+		protocol string
+		url      string
+		valid    bool
+	}{
+		{"", "http://10.0.0.1:8000", true},
+		{"http1", "https://10.0.0.1:8000", true},
+		{"h2c", "http://10.0.0.1:9000", true},
+		{"h2c", "https://10.0.0.1:9000", false},
+		{"h2", "https://10.0.0.1:9443", true},
+		{"h2", "http://10.0.0.1:9443", false},
+		{"quic", "https://10.0.0.1:9443", false},
+	}
+
+	for _, tt := range tests {
+		if err := validateEndpointProtocol(tt.protocol, tt.url); (err == nil) != tt.valid {
+			t.Errorf("validateEndpointProtocol(%q, %q): expected valid=%v, got %v", tt.protocol, tt.url, tt.valid, err)
+		}
+	}
+}
+
+// TestConfigureHTTP2 verifies http2_enabled: false keeps the TLS listener on HTTP/1.1
+func TestConfigureHTTP2(t *testing.T) {
+	srv := &http.Server{}
+	configureHTTP2(srv, &common.ServerConfig{HTTP2Enabled: true})
+	if srv.TLSNextProto != nil {
+		t.Error("Expected default HTTP/2 negotiation to be left in place")
+	}
+
+	configureHTTP2(srv, &common.ServerConfig{HTTP2Enabled: false})
+	if srv.TLSNextProto == nil || len(srv.TLSNextProto) != 0 {
+		t.Error("Expected an empty TLSNextProto map to disable HTTP/2")
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Health check types for backends whose services don't speak TCP or HTTP
+const (
+	HealthCheckTypeUDP  = "udp"
+	HealthCheckTypeICMP = "icmp"
+)
+
+// ICMP protocol numbers, for parsing replies
+const (
+	protocolICMP   = 1
+	protocolICMPv6 = 58
+)
+
+// icmpSocket is one address family's echo socket
+// Datagram ("ping") sockets need no privileges; the kernel sets the echo ID and only delivers our replies.
+// Raw sockets need root or CAP_NET_RAW and see every echo reply on the host, so replies are matched by ID
+type icmpSocket struct {
+	conn       *icmp.PacketConn
+	privileged bool
+	protocol   int
+	echoType   icmp.Type
+	replyType  icmp.Type
+}
+
+// icmpWaiter is an echo request awaiting its reply
+type icmpWaiter struct {
+	peer  net.IP
+	reply chan struct{}
+}
+
+// ICMPPinger sends echo requests for icmp health checks and the udp fallback
+// Sockets are opened once at startup and the server never changes its privileges: raw sockets
+// need root or CAP_NET_RAW, which the shipped unit grants to the unprivileged opsen user
+type ICMPPinger struct {
+	v4, v6 *icmpSocket // nil if the family is unavailable
+	id     int
+
+	mu      sync.Mutex
+	seq     uint16
+	waiting map[uint16]*icmpWaiter
+}
+
+// NewICMPPinger opens echo sockets for IPv4 and IPv6, preferring unprivileged datagram sockets
+// (Linux allows them for groups in net.ipv4.ping_group_range) over raw ones
+func NewICMPPinger() (*ICMPPinger, error) {
+	p := &ICMPPinger{
+		id:      os.Getpid() & 0xffff,
+		waiting: make(map[uint16]*icmpWaiter),
+	}
+	var errs []error
+	var err error
+	if p.v4, err = openICMPSocket("udp4", "ip4:icmp", "0.0.0.0", protocolICMP, ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply); err != nil {
+		errs = append(errs, fmt.Errorf("IPv4: %w", err))
+	}
+	if p.v6, err = openICMPSocket("udp6", "ip6:ipv6-icmp", "::", protocolICMPv6, ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply); err != nil {
+		errs = append(errs, fmt.Errorf("IPv6: %w", err))
+	}
+	if p.v4 == nil && p.v6 == nil {
+		return nil, fmt.Errorf("no ICMP socket available (allow unprivileged ping with sysctl net.ipv4.ping_group_range, or grant CAP_NET_RAW): %w", errors.Join(errs...))
+	}
+
+	for _, socket := range []*icmpSocket{p.v4, p.v6} {
+		if socket != nil {
+			go p.readReplies(socket)
+		}
+	}
+	return p, nil
+}
+
+// openICMPSocket tries an unprivileged datagram socket, then a raw one
+func openICMPSocket(datagramNetwork, rawNetwork, address string, protocol int, echoType, replyType icmp.Type) (*icmpSocket, error) {
+	socket := &icmpSocket{protocol: protocol, echoType: echoType, replyType: replyType}
+	conn, err := icmp.ListenPacket(datagramNetwork, address)
+	if err != nil {
+		var rawErr error
+		if conn, rawErr = icmp.ListenPacket(rawNetwork, address); rawErr != nil {
+			return nil, errors.Join(err, rawErr)
+		}
+		socket.privileged = true
+	}
+	socket.conn = conn
+	return socket, nil
+}
+
+// Mode describes the sockets in use, for logs
+func (p *ICMPPinger) Mode() string {
+	for _, socket := range []*icmpSocket{p.v4, p.v6} {
+		if socket != nil && socket.privileged {
+			return "raw"
+		}
+	}
+	return "unprivileged"
+}
+
+// Ping sends one echo request to host and waits for its reply
+func (p *ICMPPinger) Ping(host string, timeout time.Duration) (bool, time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil || len(addrs) == 0 {
+			return false, 0
+		}
+		ip = addrs[0].IP
+	}
+	socket := p.v6
+	if ip.To4() != nil {
+		ip, socket = ip.To4(), p.v4
+	}
+	if socket == nil {
+		return false, 0
+	}
+
+	waiter := &icmpWaiter{peer: ip, reply: make(chan struct{}, 1)}
+	p.mu.Lock()
+	p.seq++
+	seq := p.seq
+	p.waiting[seq] = waiter
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.waiting, seq)
+		p.mu.Unlock()
+	}()
+
+	message, err := (&icmp.Message{
+		Type: socket.echoType,
+		Body: &icmp.Echo{ID: p.id, Seq: int(seq), Data: []byte("opsen-health")},
+	}).Marshal(nil) // The kernel fills in the ICMPv6 checksum
+	if err != nil {
+		return false, 0
+	}
+	var dst net.Addr = &net.IPAddr{IP: ip}
+	if !socket.privileged {
+		dst = &net.UDPAddr{IP: ip}
+	}
+
+	start := time.Now()
+	if _, err := socket.conn.WriteTo(message, dst); err != nil {
+		return false, time.Since(start)
+	}
+	select {
+	case <-waiter.reply:
+		return true, time.Since(start)
+	case <-ctx.Done():
+		return false, time.Since(start)
+	}
+}
+
+// readReplies hands echo replies to the requests waiting for them until the socket is closed
+func (p *ICMPPinger) readReplies(socket *icmpSocket) {
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := socket.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		message, err := icmp.ParseMessage(socket.protocol, buf[:n])
+		if err != nil || message.Type != socket.replyType {
+			continue
+		}
+		echo, ok := message.Body.(*icmp.Echo)
+		// Raw sockets also receive replies to other processes' pings
+		if !ok || (socket.privileged && echo.ID != p.id) {
+			continue
+		}
+
+		var peerIP net.IP
+		switch addr := peer.(type) {
+		case *net.IPAddr:
+			peerIP = addr.IP
+		case *net.UDPAddr:
+			peerIP = addr.IP
+		}
+		p.mu.Lock()
+		waiter, ok := p.waiting[uint16(echo.Seq)]
+		p.mu.Unlock()
+		if ok && waiter.peer.Equal(peerIP) {
+			select {
+			case waiter.reply <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// Close closes the sockets
+func (p *ICMPPinger) Close() {
+	for _, socket := range []*icmpSocket{p.v4, p.v6} {
+		if socket != nil {
+			socket.conn.Close()
+		}
+	}
+}
+
+// probeICMP pings the host of a backend's endpoint
+func (s *Server) probeICMP(endpoint string, timeout time.Duration) (bool, time.Duration) {
+	if s.pinger == nil {
+		return false, 0
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		LogWarn(fmt.Sprintf("Failed to parse endpoint for health check: %s", endpoint))
+		return false, 0
+	}
+	return s.pinger.Ping(parsed.Hostname(), timeout)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// janitorQueueSize is the number of deregistrations waiting for deletion before callers delete synchronously
+const janitorQueueSize = 256
+
+// janitorIDsPerQuery bounds the client IDs bound into one DELETE, well below SQLite's variable limit
+const janitorIDsPerQuery = 200
+
+// clientRecordTables are cleared of a deregistered backend's rows, in order; clients goes last
+// so an interrupted delete leaves the backend to be found and purged again
+var clientRecordTables = []string{"stats", "sticky_assignments", "client_errors", "clients"}
+
+type janitorJob struct {
+	clientIDs []string
+	reason    string
+	result    deregisterResult // In-memory counts (pending allocations)
+}
+
+// Janitor deletes the database records of deregistered backends from a dedicated goroutine
+// Rows go in LIMIT-ed passes of one short transaction each, so a mass expiry never holds the
+// database long enough to stall /register, /stats or the cleanup ticker
+type Janitor struct {
+	db          *sql.DB
+	batchSize   int
+	statsWriter *StatsWriter
+	isLive      func(clientID string) bool // Reports backends that re-registered while queued
+	queue       chan janitorJob
+	flushReq    chan chan struct{}
+	done        chan struct{}
+
+	mu     sync.RWMutex // Held for reading while sending to queue, so Close can't close it mid-send
+	closed bool
+}
+
+// NewJanitor starts the deletion goroutine; batchSize is the maximum rows deleted per transaction
+func NewJanitor(db *sql.DB, batchSize int, statsWriter *StatsWriter, isLive func(clientID string) bool) *Janitor {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	j := &Janitor{
+		db:          db,
+		batchSize:   batchSize,
+		statsWriter: statsWriter,
+		isLive:      isLive,
+		queue:       make(chan janitorJob, janitorQueueSize),
+		flushReq:    make(chan chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go j.run()
+	return j
+}
+
+// Enqueue schedules the records of backends already removed from memory for deletion
+// Returns false if the janitor is closed or its queue is full; the caller then deletes synchronously
+func (j *Janitor) Enqueue(clientIDs []string, reason string, result deregisterResult) bool {
+	if len(clientIDs) == 0 {
+		return true
+	}
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if j.closed {
+		return false
+	}
+	select {
+	case j.queue <- janitorJob{clientIDs: clientIDs, reason: reason, result: result}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Flush waits until every queued deregistration has been deleted
+func (j *Janitor) Flush() {
+	ack := make(chan struct{})
+	select {
+	case j.flushReq <- ack:
+		<-ack
+	case <-j.done:
+	}
+}
+
+// Close stops accepting work and waits until everything queued has been deleted
+func (j *Janitor) Close() {
+	j.mu.Lock()
+	if !j.closed {
+		j.closed = true
+		close(j.queue)
+	}
+	j.mu.Unlock()
+	<-j.done
+}
+
+func (j *Janitor) run() {
+	defer close(j.done)
+	for {
+		select {
+		case job, ok := <-j.queue:
+			if !ok {
+				return
+			}
+			j.process(job)
+		case ack := <-j.flushReq:
+			j.drain()
+			close(ack)
+		}
+	}
+}
+
+// drain processes jobs already in the queue without blocking
+func (j *Janitor) drain() {
+	for {
+		select {
+		case job, ok := <-j.queue:
+			if !ok {
+				return
+			}
+			j.process(job)
+		default:
+			return
+		}
+	}
+}
+
+// process deletes a queued deregistration, skipping backends that registered again since
+// (their rows, including new sticky assignments, belong to the live backend now)
+func (j *Janitor) process(job janitorJob) {
+	clientIDs := j.withoutLive(job.clientIDs)
+	if len(clientIDs) == 0 {
+		return
+	}
+
+	start := time.Now()
+	if err := j.Delete(clientIDs, &job.result); err != nil {
+		LogError(fmt.Sprintf("Failed to delete client records (%s): %v", job.reason, err))
+	}
+	logDeregistration(clientIDs, job.reason, job.result, time.Since(start))
+}
+
+// withoutLive drops backends that registered again since they were removed from memory
+func (j *Janitor) withoutLive(clientIDs []string) []string {
+	gone := make([]string, 0, len(clientIDs))
+	for _, id := range clientIDs {
+		if !j.isLive(id) {
+			gone = append(gone, id)
+		}
+	}
+	return gone
+}
+
+// Delete removes backends' records now and adds the deleted row counts to result
+// Backends are checked again right before each delete, since flushing and earlier chunks take time
+// during which one may re-register
+func (j *Janitor) Delete(clientIDs []string, result *deregisterResult) error {
+	if len(clientIDs) == 0 {
+		return nil
+	}
+
+	// Buffered stats rows would otherwise be inserted after the delete
+	j.statsWriter.Flush()
+
+	for start := 0; start < len(clientIDs); start += janitorIDsPerQuery {
+		chunk := j.withoutLive(clientIDs[start:min(start+janitorIDsPerQuery, len(clientIDs))])
+		if len(chunk) == 0 {
+			continue
+		}
+		if err := j.deleteChunk(chunk, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteChunk clears each record table of a bounded list of backends
+func (j *Janitor) deleteChunk(clientIDs []string, result *deregisterResult) error {
+	where := "client_id IN (" + strings.TrimSuffix(strings.Repeat("?,", len(clientIDs)), ",") + ")"
+	args := make([]interface{}, 0, len(clientIDs)+1)
+	for _, id := range clientIDs {
+		args = append(args, id)
+	}
+
+	for _, table := range clientRecordTables {
+		n, err := j.deleteInBatches(table, where, args)
+		if err != nil {
+			return fmt.Errorf("delete %s: %w", table, err)
+		}
+		switch table {
+		case "stats":
+			result.Stats += n
+		case "sticky_assignments":
+			result.Sticky += n
+		case "client_errors":
+			result.Errors += n
+		case "clients":
+			result.Clients += n
+		}
+	}
+	return nil
+}
+
+// deleteInBatches deletes matching rows in passes of at most batchSize rows, one transaction per pass
+func (j *Janitor) deleteInBatches(table, where string, args []interface{}) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE rowid IN (SELECT rowid FROM %s WHERE %s LIMIT ?)", table, table, where)
+	args = append(args[:len(args):len(args)], j.batchSize)
+
+	var total int64
+	for {
+		tx, err := j.db.Begin()
+		if err != nil {
+			return total, err
+		}
+		res, err := tx.Exec(query, args...)
+		if err != nil {
+			tx.Rollback()
+			return total, err
+		}
+		if err := tx.Commit(); err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < int64(j.batchSize) {
+			return total, nil
+		}
+	}
+}
+
+// logDeregistration reports what a deregistration removed
+func logDeregistration(clientIDs []string, reason string, result deregisterResult, elapsed time.Duration) {
+	LogInfoWithData("Deregistered clients", map[string]interface{}{
+		"reason":              reason,
+		"client_ids":          clientIDs,
+		"stats":               result.Stats,
+		"sticky_assignments":  result.Sticky,
+		"errors":              result.Errors,
+		"pending_allocations": result.Pending,
+		"duration_ms":         elapsed.Milliseconds(),
+	})
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// insertStatsRows adds n minimal stats rows for a client
+func insertStatsRows(t *testing.T, server *Server, clientID string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := server.db.Exec("INSERT INTO stats (client_id, timestamp, cpu_cores) VALUES (?, ?, 8)",
+			clientID, time.Now().Add(-time.Duration(i)*time.Minute).Format("2006-01-02 15:04:05")); err != nil {
+			t.Fatalf("Failed to insert stats row: %v", err)
+		}
+	}
+}
+
+// TestJanitor_BatchedDelete verifies records larger than one batch are deleted completely and only for the given backends
+func TestJanitor_BatchedDelete(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.CleanupBatchSize = 7
+	})
+	doomed := NewMockClient(MockClientOptions{ClientID: "doomed"})
+	survivor := NewMockClient(MockClientOptions{ClientID: "survivor"})
+	for _, client := range []*ClientState{doomed, survivor} {
+		RegisterMockClientInDB(t, db, client)
+	}
+	insertStatsRows(t, server, "doomed", 49)
+	insertStatsRows(t, server, "survivor", 5)
+
+	var result deregisterResult
+	if err := server.deleteClientRecords([]string{"doomed"}, &result); err != nil {
+		t.Fatalf("Failed to delete records: %v", err)
+	}
+	if result.Clients != 1 || result.Stats != 50 {
+		t.Errorf("Expected 1 client and 50 stats rows removed, got %+v", result)
+	}
+	if n := countRows(t, server, "stats", "doomed"); n != 0 {
+		t.Errorf("Expected no stats rows for doomed, got %d", n)
+	}
+	if n := countRows(t, server, "stats", "survivor"); n != 6 {
+		t.Errorf("Expected survivor's 6 stats rows to remain, got %d", n)
+	}
+}
+
+// TestJanitor_BackgroundStaleExpiry verifies expired backends leave routing at once and their records are deleted by the janitor
+func TestJanitor_BackgroundStaleExpiry(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.CleanupBatchSize = 10
+	})
+	stale := []string{}
+	for i := 0; i < 25; i++ {
+		client := NewMockClient(MockClientOptions{ClientID: fmt.Sprintf("stale-%d", i), LastSeen: time.Now().Add(-time.Hour)})
+		server.AddMockClient(client)
+		RegisterMockClientInDB(t, db, client)
+		stale = append(stale, client.Registration.ClientID)
+	}
+	server.createStickyAssignment("user-1", "lite", "stale-3")
+
+	ids, result := server.deregisterStaleClients(1, "stale", true)
+	if len(ids) != len(stale) {
+		t.Fatalf("Expected %d stale backends, got %d", len(stale), len(ids))
+	}
+	if result.Clients != 0 {
+		t.Errorf("Expected database counts to be left to the janitor, got %+v", result)
+	}
+	server.mu.RLock()
+	cached := len(server.clientCache)
+	server.mu.RUnlock()
+	if cached != 0 {
+		t.Errorf("Expected stale backends to leave the cache immediately, %d remain", cached)
+	}
+
+	server.janitor.Flush()
+	for _, id := range stale {
+		for _, table := range []string{"clients", "stats", "sticky_assignments"} {
+			if n := countRows(t, server, table, id); n != 0 {
+				t.Errorf("Expected no %s rows for %s, got %d", table, id, n)
+			}
+		}
+	}
+}
+
+// TestJanitor_SkipsReregisteredBackend verifies a backend that returns before its deletion runs keeps its records
+func TestJanitor_SkipsReregisteredBackend(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	client := NewMockClient(MockClientOptions{ClientID: "flapping"})
+	RegisterMockClientInDB(t, db, client)
+
+	// Removed from memory, then registered again before the queued deletion runs
+	server.AddMockClient(client)
+	if !server.janitor.Enqueue([]string{"flapping"}, "stale", deregisterResult{}) {
+		t.Fatal("Expected the deletion to be queued")
+	}
+	server.janitor.Flush()
+
+	if n := countRows(t, server, "clients", "flapping"); n != 1 {
+		t.Errorf("Expected the re-registered backend's clients row to remain, got %d", n)
+	}
+	if n := countRows(t, server, "stats", "flapping"); n != 1 {
+		t.Errorf("Expected the re-registered backend's stats to remain, got %d", n)
+	}
+}
+
+// TestJanitor_DeleteSkipsLiveBackend verifies the liveness check is repeated right before rows are deleted,
+// so a backend re-registering while its deletion waits on the stats flush keeps its records
+func TestJanitor_DeleteSkipsLiveBackend(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	client := NewMockClient(MockClientOptions{ClientID: "flapping"})
+	RegisterMockClientInDB(t, db, client)
+	server.AddMockClient(client)
+
+	var result deregisterResult
+	if err := server.deleteClientRecords([]string{"flapping"}, &result); err != nil {
+		t.Fatalf("Failed to delete records: %v", err)
+	}
+	if result.Clients != 0 || countRows(t, server, "clients", "flapping") != 1 {
+		t.Errorf("Expected the live backend's records to remain, got %+v", result)
+	}
+}
+
+// TestJanitor_EnqueueAfterClose verifies deregistrations outliving shutdown fall back to synchronous deletes instead of panicking
+func TestJanitor_EnqueueAfterClose(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	janitor := NewJanitor(db, 0, nil, func(string) bool { return false })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			janitor.Enqueue([]string{"gone"}, "stale", deregisterResult{})
+		}
+	}()
+	janitor.Close()
+	<-done
+
+	if janitor.Enqueue([]string{"gone"}, "stale", deregisterResult{}) {
+		t.Error("Expected a closed janitor to refuse work")
+	}
+	janitor.Close() // A second Close is harmless
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"cyqle.in/opsen/common"
+)
+
+// LBErrorCodeHeader carries a machine-readable reason when no backend could be placed
+const LBErrorCodeHeader = "X-LB-Error-Code"
+
+// Placement failure codes
+const (
+	errCodeNoCapacity    = "no_capacity"
+	errCodeLatencyBudget = "latency_budget_exceeded"
+)
+
+// hasLatencyBudget reports whether a tier limits backend latency or distance
+func hasLatencyBudget(tier common.TierSpec) bool {
+	return tier.MaxLatencyMs > 0 || tier.MaxDistanceKm > 0
+}
+
+// withinLatencyBudget checks a backend against the tier's max_latency_ms and max_distance_km
+// Unknown values (no probe yet, or no geolocation for either side) never violate the budget
+func withinLatencyBudget(client *ClientState, tier common.TierSpec, distanceKm float64) bool {
+	if tier.MaxLatencyMs > 0 && backendLatency(client, tier) > tier.MaxLatencyMs {
+		return false
+	}
+	if tier.MaxDistanceKm > 0 && distanceKm > tier.MaxDistanceKm {
+		return false
+	}
+	return true
+}
+
+// backendDistance returns the distance in km between the requesting client and a backend
+// Returns 0 when either side has no geolocation
+func backendDistance(client *ClientState, clientLat, clientLon float64) float64 {
+	if clientLat == 0 || clientLon == 0 ||
+		client.Registration.Latitude == 0 || client.Registration.Longitude == 0 {
+		return 0
+	}
+	return haversineDistance(clientLat, clientLon, client.Registration.Latitude, client.Registration.Longitude)
+}
+
+// latencyBudgetExceeded reports whether some backend had capacity for the tier but was outside its latency budget
+// Used after a failed placement to tell budget rejections apart from plain capacity exhaustion
+func (s *Server) latencyBudgetExceeded(tier common.TierSpec, clientLat, clientLon float64) bool {
+	if !hasLatencyBudget(tier) {
+		return false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, client := range s.clientCache {
+		if s.isStale(client) || s.awaitingApproval(client) {
+			continue
+		}
+		if s.config.HealthCheckEnabled && client.HealthStatus == "unhealthy" {
+			continue
+		}
+		if !s.hasResourcesLocked(client, tier) {
+			continue
+		}
+		if !withinLatencyBudget(client, tier, backendDistance(client, clientLat, clientLon)) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNoBackend reports a failed placement with 503 and an X-LB-Error-Code
+func (s *Server) writeNoBackend(w http.ResponseWriter, tier common.TierSpec, clientLat, clientLon float64, message string) {
+	if s.pendingLimitReached(tier) {
+		s.writePendingLimit(w, tier)
+		return
+	}
+	if s.latencyBudgetExceeded(tier, clientLat, clientLon) {
+		s.publishRouteFailed(tier, errCodeLatencyBudget)
+		w.Header().Set(LBErrorCodeHeader, errCodeLatencyBudget)
+		http.Error(w, fmt.Sprintf("No available backends within the latency budget of tier %s (max_latency_ms=%g, max_distance_km=%g)",
+			tier.Name, tier.MaxLatencyMs, tier.MaxDistanceKm), http.StatusServiceUnavailable)
+		return
+	}
+	s.publishRouteFailed(tier, errCodeNoCapacity)
+	w.Header().Set(LBErrorCodeHeader, errCodeNoCapacity)
+	http.Error(w, message, http.StatusServiceUnavailable)
+}
+
+// publishRouteFailed reports a placement that found no backend on /events
+func (s *Server) publishRouteFailed(tier common.TierSpec, code string) {
+	s.events.Publish("route.failed", map[string]interface{}{
+		"tier":       tier.Name,
+		"tenant":     tier.Tenant,
+		"error_code": code,
+	})
+}
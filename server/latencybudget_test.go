@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestFindBestClient_LatencyBudget verifies backends over max_latency_ms are rejected unless allow_degraded is set
+func TestFindBestClient_LatencyBudget(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	slow := NewMockClient(MockClientOptions{ClientID: "slow", CPUUsageAvg: []float64{5, 5, 5, 5, 5, 5, 5, 5}})
+	slow.LatencyMs = 900
+	fast := NewMockClient(MockClientOptions{ClientID: "fast", CPUUsageAvg: []float64{60, 60, 60, 60, 60, 60, 60, 60}})
+	fast.LatencyMs = 20
+	server.AddMockClient(slow)
+	server.AddMockClient(fast)
+
+	tier := server.tierSpecs["lite"]
+	tier.MaxLatencyMs = 200
+	if selected := server.findBestClient(tier, 0, 0); selected == nil || selected.Registration.ClientID != "fast" {
+		t.Errorf("Expected backend within the latency budget, got %v", selected)
+	}
+
+	server.mu.Lock()
+	delete(server.clientCache, "fast")
+	server.mu.Unlock()
+	if selected := server.findBestClient(tier, 0, 0); selected != nil {
+		t.Errorf("Expected no placement when only a slow backend remains, got %s", selected.Registration.ClientID)
+	}
+
+	tier.AllowDegraded = true
+	if selected := server.findBestClient(tier, 0, 0); selected == nil || selected.Registration.ClientID != "slow" {
+		t.Errorf("Expected degraded placement with allow_degraded, got %v", selected)
+	}
+}
+
+// TestFindBestClient_DistanceBudget verifies backends beyond max_distance_km are rejected
+func TestFindBestClient_DistanceBudget(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	// Client in Berlin; one backend in Frankfurt (~420 km), one in New York
+	near := NewMockClient(MockClientOptions{ClientID: "frankfurt", CPUUsageAvg: []float64{70, 70, 70, 70, 70, 70, 70, 70}})
+	near.Registration.Latitude, near.Registration.Longitude = 50.11, 8.68
+	far := NewMockClient(MockClientOptions{ClientID: "new-york"})
+	far.Registration.Latitude, far.Registration.Longitude = 40.71, -74.00
+	server.AddMockClient(near)
+	server.AddMockClient(far)
+
+	tier := server.tierSpecs["lite"]
+	tier.MaxDistanceKm = 1000
+	if selected := server.findBestClient(tier, 52.52, 13.40); selected == nil || selected.Registration.ClientID != "frankfurt" {
+		t.Errorf("Expected backend within max_distance_km, got %v", selected)
+	}
+}
+
+// TestHandleRoute_LatencyBudgetExceeded verifies budget rejections get a distinct error code
+func TestHandleRoute_LatencyBudgetExceeded(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		for i := range c.Tiers {
+			c.Tiers[i].MaxLatencyMs = 200
+		}
+	})
+
+	slow := NewMockClient(MockClientOptions{ClientID: "slow"})
+	slow.LatencyMs = 900
+	server.AddMockClient(slow)
+
+	body, _ := json.Marshal(common.RoutingRequest{Tier: "lite", ClientIP: "1.2.3.4"})
+	rec := httptest.NewRecorder()
+	server.handleRoute(rec, httptest.NewRequest("POST", "/route", bytes.NewReader(body)))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503, got %d", rec.Code)
+	}
+	if code := rec.Header().Get(LBErrorCodeHeader); code != errCodeLatencyBudget {
+		t.Errorf("Expected %s, got %q", errCodeLatencyBudget, code)
+	}
+
+	server.mu.Lock()
+	delete(server.clientCache, "slow")
+	server.mu.Unlock()
+	rec = httptest.NewRecorder()
+	server.handleRoute(rec, httptest.NewRequest("POST", "/route", bytes.NewReader(body)))
+	if code := rec.Header().Get(LBErrorCodeHeader); code != errCodeNoCapacity {
+		t.Errorf("Expected %s without any backend, got %q", errCodeNoCapacity, code)
+	}
+}
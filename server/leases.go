@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	LBLeaseIDHeader  = "X-LB-Lease-ID"       // Allocation lease of a new session, sent to the backend for renewal
+	LBLeaseTTLHeader = "X-LB-Lease-TTL-Secs" // Seconds until that lease expires unless renewed
+)
+
+// errCodeLeaseNotFound is sent in X-LB-Error-Code when a lease is unknown, released or already expired
+const errCodeLeaseNotFound = "lease_not_found"
+
+// defaultLeaseTTL applies when pending_allocation_timeout_seconds is not set
+const defaultLeaseTTL = 2 * time.Minute
+
+func newLeaseID() string {
+	return uuid.New().String()
+}
+
+// expired reports whether the allocation's lease ran out; expired leases reserve nothing
+func (a PendingAllocation) expired(now time.Time) bool {
+	return now.After(a.ExpiresAt)
+}
+
+// leaseTTL is how long an allocation reserves resources without being renewed
+func (s *Server) leaseTTL() time.Duration {
+	if s.config.PendingAllocationTimeoutSecs <= 0 {
+		return defaultLeaseTTL
+	}
+	return time.Duration(s.config.PendingAllocationTimeoutSecs) * time.Second
+}
+
+// leaseTTLSecs returns the whole seconds left on a lease (at least 1 while it is live)
+func leaseTTLSecs(lease PendingAllocation, now time.Time) int {
+	remaining := lease.ExpiresAt.Sub(now)
+	if remaining <= 0 {
+		return 0
+	}
+	return max(int(remaining/time.Second), 1)
+}
+
+// liveAllocationCountLocked counts a backend's allocations whose lease has not expired
+// Caller must hold s.mu
+func (s *Server) liveAllocationCountLocked(clientID string, now time.Time) int {
+	count := 0
+	for _, pending := range s.pendingAllocations[clientID] {
+		if !pending.expired(now) {
+			count++
+		}
+	}
+	return count
+}
+
+// requestLease returns the allocation a routed request created on client
+// Sticky hits reuse an existing session and create no lease
+func (s *Server) requestLease(client *ClientState, requestID string) (PendingAllocation, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, pending := range s.pendingAllocations[client.Registration.ClientID] {
+		if pending.RequestID == requestID {
+			return pending, true
+		}
+	}
+	return PendingAllocation{}, false
+}
+
+// releasePlacement undoes a placement whose request was turned away before reaching the backend: the
+// allocation the request reserved is dropped, and so is the sticky assignment if the request created it
+func (s *Server) releasePlacement(client *ClientState, requestID, stickyID, tier string, outcome stickyOutcome) {
+	clientID := client.Registration.ClientID
+	s.mu.Lock()
+	for i, pending := range s.pendingAllocations[clientID] {
+		if pending.RequestID == requestID {
+			s.removeLeaseLocked(clientID, i)
+			if client.RoutedSessions > 0 {
+				client.RoutedSessions--
+			}
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if outcome.Created {
+		s.removeStickyAssignment(stickyID, tier)
+	}
+}
+
+// findLeaseLocked locates a live lease by ID. Caller must hold s.mu
+func (s *Server) findLeaseLocked(leaseID string, now time.Time) (string, int, bool) {
+	for clientID, allocations := range s.pendingAllocations {
+		for i, pending := range allocations {
+			if pending.LeaseID == leaseID && !pending.expired(now) {
+				return clientID, i, true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// removeLeaseLocked drops one allocation. Caller must hold s.mu (write)
+func (s *Server) removeLeaseLocked(clientID string, index int) {
+	allocations := s.pendingAllocations[clientID]
+	allocations = append(allocations[:index:index], allocations[index+1:]...)
+	if len(allocations) == 0 {
+		delete(s.pendingAllocations, clientID)
+	} else {
+		s.pendingAllocations[clientID] = allocations
+	}
+	s.reindexReservationsLocked(clientID)
+}
+
+// handleAllocationByID handles allocation leases returned by /route and the proxy:
+// POST /allocations/{id}/renew keeps a starting session's resources reserved for another TTL,
+// DELETE /allocations/{id} releases them once the session is up (or abandoned)
+func (s *Server) handleAllocationByID(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/allocations/")
+	leaseID, renew := strings.CutSuffix(path, "/renew")
+	if leaseID == "" || strings.Contains(leaseID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if (renew && r.Method != http.MethodPost) || (!renew && r.Method != http.MethodDelete) {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	keyTenant, scoped := tenantFromContext(r)
+	now := time.Now()
+
+	s.mu.Lock()
+	clientID, index, ok := s.findLeaseLocked(leaseID, now)
+	// Tenant keys cannot see other tenants' leases
+	if ok && scoped && normalizeTenant(s.pendingAllocations[clientID][index].TierSpec.Tenant) != keyTenant {
+		ok = false
+	}
+	if !ok {
+		s.mu.Unlock()
+		w.Header().Set(LBErrorCodeHeader, errCodeLeaseNotFound)
+		http.Error(w, fmt.Sprintf("Lease not found or expired: %s", leaseID), http.StatusNotFound)
+		return
+	}
+
+	lease := s.pendingAllocations[clientID][index]
+	status := "released"
+	if renew {
+		expiresAt := now.Add(s.leaseTTL())
+		if s.config.MaxLeaseSecs > 0 {
+			if limit := lease.Timestamp.Add(time.Duration(s.config.MaxLeaseSecs) * time.Second); expiresAt.After(limit) {
+				expiresAt = limit
+			}
+		}
+		if expiresAt.After(lease.ExpiresAt) {
+			lease.ExpiresAt = expiresAt
+		}
+		s.pendingAllocations[clientID][index] = lease
+		s.reindexReservationsLocked(clientID)
+		status = "renewed"
+	} else {
+		s.removeLeaseLocked(clientID, index)
+	}
+	s.mu.Unlock()
+
+	if !renew {
+		// Freed capacity changes which backend anonymous requests should get
+		s.routeCache.Invalidate(clientID)
+	}
+
+	LogDebugWithData("Allocation lease "+status, map[string]interface{}{
+		"lease_id":   leaseID,
+		"client_id":  clientID,
+		"tier":       lease.Tier,
+		"expires_at": lease.ExpiresAt,
+	})
+
+	response := map[string]interface{}{
+		"status":    status,
+		"lease_id":  leaseID,
+		"client_id": clientID,
+		"tier":      lease.Tier,
+	}
+	if renew {
+		response["expires_at"] = lease.ExpiresAt
+		response["ttl_secs"] = leaseTTLSecs(lease, now)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Warning: Failed to encode allocation lease response: %v", err)
+	}
+}
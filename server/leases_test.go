@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+func routeForLease(t *testing.T, server *Server) common.RoutingResponse {
+	t.Helper()
+	body, _ := json.Marshal(common.RoutingRequest{Tier: "lite", ClientIP: "1.2.3.4"})
+	rec := httptest.NewRecorder()
+	server.handleRoute(rec, httptest.NewRequest("POST", "/route", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected route to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp common.RoutingResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return resp
+}
+
+func leaseRequest(server *Server, method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	server.handleAllocationByID(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+// TestAllocationLeases_RenewAndRelease verifies routed sessions get a lease that can be renewed up to max_lease_seconds and released
+func TestAllocationLeases_RenewAndRelease(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.PendingAllocationTimeoutSecs = 60
+		c.MaxLeaseSecs = 90
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend"}))
+
+	resp := routeForLease(t, server)
+	if resp.LeaseID == "" || resp.LeaseTTLSecs < 59 || resp.LeaseTTLSecs > 60 {
+		t.Fatalf("Expected a lease with a 60s TTL, got %q (%ds)", resp.LeaseID, resp.LeaseTTLSecs)
+	}
+
+	// Renewals extend the lease by one TTL but never past max_lease_seconds from its creation
+	rec := leaseRequest(server, "POST", "/allocations/"+resp.LeaseID+"/renew")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected renewal to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	server.mu.RLock()
+	lease := server.pendingAllocations["backend"][0]
+	server.mu.RUnlock()
+	if limit := lease.Timestamp.Add(90 * time.Second); lease.ExpiresAt.After(limit) || lease.ExpiresAt.Before(limit.Add(-30*time.Second)) {
+		t.Errorf("Expected renewal to be capped near %v, got %v", limit, lease.ExpiresAt)
+	}
+
+	if rec := leaseRequest(server, "DELETE", "/allocations/"+resp.LeaseID); rec.Code != http.StatusOK {
+		t.Fatalf("Expected release to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	server.mu.RLock()
+	remaining := len(server.pendingAllocations["backend"])
+	server.mu.RUnlock()
+	if remaining != 0 {
+		t.Errorf("Expected release to free the allocation, %d left", remaining)
+	}
+
+	rec = leaseRequest(server, "POST", "/allocations/"+resp.LeaseID+"/renew")
+	if rec.Code != http.StatusNotFound || rec.Header().Get(LBErrorCodeHeader) != errCodeLeaseNotFound {
+		t.Errorf("Expected a released lease to be gone, got %d (%s)", rec.Code, rec.Header().Get(LBErrorCodeHeader))
+	}
+}
+
+// TestAllocationLeases_ExpiryFreesResourcesImmediately verifies an expired lease stops reserving before cleanup runs
+func TestAllocationLeases_ExpiryFreesResourcesImmediately(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend"}))
+
+	resp := routeForLease(t, server)
+	server.mu.RLock()
+	reserved := server.pendingReservationLocked("backend")
+	server.mu.RUnlock()
+	if reserved.VCPU == 0 {
+		t.Fatal("Expected the new lease to reserve resources")
+	}
+
+	server.mu.Lock()
+	server.pendingAllocations["backend"][0].ExpiresAt = time.Now().Add(-time.Second)
+	reserved = server.pendingReservationLocked("backend")
+	server.mu.Unlock()
+	if reserved.VCPU != 0 || reserved.MemoryGB != 0 {
+		t.Errorf("Expected an expired lease to reserve nothing, got %+v", reserved)
+	}
+
+	if rec := leaseRequest(server, "POST", "/allocations/"+resp.LeaseID+"/renew"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected an expired lease not to be renewable, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// errCodeLoadShed is sent in X-LB-Error-Code for proxy requests rejected by load shedding
+const errCodeLoadShed = "load_shed"
+
+// LoadShedder probabilistically rejects low-priority tiers at the proxy while the fleet is near saturation
+// Between start_utilization_pct and full_utilization_pct the overload ramps from 0 to 1; it is split
+// evenly across the sheddable priority levels, so the lowest level is shed completely before the next
+// one starts. The highest configured priority is never shed
+type LoadShedder struct {
+	config common.LoadSheddingConfig
+	rand   func() float64
+
+	mu          sync.Mutex
+	utilization float64           // Fleet utilization at the last evaluation (percent)
+	overload    float64           // 0 = below start, 1 = at or above full
+	levels      []int             // Sheddable priorities, ascending
+	shed        map[shedKey]int64 // Tenant's tier → requests rejected since start
+}
+
+// shedKey identifies a tenant's tier; tenants with their own tiers may reuse tier names
+type shedKey struct {
+	tenant string
+	tier   string
+}
+
+// shedKeyFor returns the counter key for a resolved tier
+func shedKeyFor(tier common.TierSpec) shedKey {
+	return shedKey{tenant: normalizeTenant(tier.Tenant), tier: tier.Name}
+}
+
+// NewLoadShedder creates a shedder, or returns nil if load shedding is disabled
+func NewLoadShedder(config common.LoadSheddingConfig) *LoadShedder {
+	if !config.Enabled {
+		return nil
+	}
+	return &LoadShedder{
+		config: config,
+		rand:   rand.Float64,
+		shed:   make(map[shedKey]int64),
+	}
+}
+
+// validateLoadShedding checks the utilization thresholds when load shedding is enabled
+func validateLoadShedding(config common.LoadSheddingConfig) error {
+	if !config.Enabled {
+		return nil
+	}
+	if config.StartUtilizationPct <= 0 || config.FullUtilizationPct > 100 || config.FullUtilizationPct <= config.StartUtilizationPct {
+		return fmt.Errorf("load_shedding: need 0 < start_utilization_pct < full_utilization_pct <= 100 (got %g and %g)",
+			config.StartUtilizationPct, config.FullUtilizationPct)
+	}
+	return nil
+}
+
+// Update sets the fleet utilization and the tier priorities in use
+// Returns whether shedding is active afterwards
+func (l *LoadShedder) Update(utilization float64, priorities []int) bool {
+	if l == nil {
+		return false
+	}
+
+	distinct := make(map[int]bool)
+	for _, p := range priorities {
+		distinct[p] = true
+	}
+	levels := make([]int, 0, len(distinct))
+	for p := range distinct {
+		levels = append(levels, p)
+	}
+	sort.Ints(levels)
+	if len(levels) > 0 {
+		levels = levels[:len(levels)-1] // The most important tiers are always served
+	}
+
+	overload := (utilization - l.config.StartUtilizationPct) / (l.config.FullUtilizationPct - l.config.StartUtilizationPct)
+	overload = min(max(overload, 0), 1)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.utilization = utilization
+	l.overload = overload
+	l.levels = levels
+	return overload > 0 && len(levels) > 0
+}
+
+// Probability returns the share of new requests shed for tiers of the given priority
+func (l *LoadShedder) Probability(priority int) float64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.probabilityLocked(priority)
+}
+
+func (l *LoadShedder) probabilityLocked(priority int) float64 {
+	level := sort.SearchInts(l.levels, priority)
+	if level == len(l.levels) || l.levels[level] != priority {
+		return 0
+	}
+	return min(max(l.overload*float64(len(l.levels))-float64(level), 0), 1)
+}
+
+// Shed decides whether to reject a new request for tier and counts rejections
+func (l *LoadShedder) Shed(tier common.TierSpec) bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	p := l.probabilityLocked(tier.Priority)
+	if p <= 0 || l.rand() >= p {
+		return false
+	}
+	l.shed[shedKeyFor(tier)]++
+	return true
+}
+
+// reject answers a shed request with 503 and Retry-After
+func (l *LoadShedder) reject(w http.ResponseWriter, tier common.TierSpec) {
+	if l.config.RetryAfterSecs > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(l.config.RetryAfterSecs))
+	}
+	w.Header().Set(LBErrorCodeHeader, errCodeLoadShed)
+	http.Error(w, fmt.Sprintf("Service overloaded, tier %s is temporarily limited", tier.Name), http.StatusServiceUnavailable)
+}
+
+// points renders the current shedding state for the stats exporters
+func (l *LoadShedder) points(tiers []common.TierSpec, ts time.Time) []statsPoint {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	points := []statsPoint{{"opsen_load_shedding", "fleet_utilization_percent", nil, l.utilization, ts}}
+	for _, tier := range tiers {
+		labels := []statsLabel{{"tier", tier.Name}, {"tenant", normalizeTenant(tier.Tenant)}}
+		points = append(points,
+			statsPoint{"opsen_load_shedding", "probability", labels, l.probabilityLocked(tier.Priority), ts},
+			statsPoint{"opsen_load_shedding", "rejected_total", labels, float64(l.shed[shedKeyFor(tier)]), ts},
+		)
+	}
+	return points
+}
+
+// fleetUtilizationLocked returns the busiest of aggregate CPU, memory and GPU utilization
+// across live, healthy backends, in percent (caller must hold s.mu)
+func (s *Server) fleetUtilizationLocked() float64 {
+	var cpuSum, memUsed, memTotal, gpuSum float64
+	var cores, gpus int
+	for _, client := range s.clientCache {
+		if s.isStale(client) || s.awaitingApproval(client) {
+			continue
+		}
+		if s.config.HealthCheckEnabled && client.HealthStatus == "unhealthy" {
+			continue
+		}
+		for _, usage := range client.Stats.CPUUsageAvg {
+			cpuSum += usage
+			cores++
+		}
+		memUsed += client.Stats.MemoryUsed
+		memTotal += client.Stats.MemoryTotal
+		for _, gpu := range client.Stats.GPUs {
+			gpuSum += gpu.UtilizationPct
+			gpus++
+		}
+	}
+
+	utilization := 0.0
+	if cores > 0 {
+		utilization = cpuSum / float64(cores)
+	}
+	if memTotal > 0 {
+		utilization = max(utilization, memUsed/memTotal*100)
+	}
+	if gpus > 0 {
+		utilization = max(utilization, gpuSum/float64(gpus))
+	}
+	return utilization
+}
+
+// allTierSpecsLocked returns every tenant's tiers, resolved for that tenant (caller must hold s.mu)
+// Tenants without their own tiers get the global tiers, so their shed counts are reported separately
+func (s *Server) allTierSpecsLocked() []common.TierSpec {
+	tierSets := s.tenantTierSetsLocked()
+	tenants := make([]string, 0, len(tierSets))
+	for tenant := range tierSets {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+
+	var tiers []common.TierSpec
+	for _, tenant := range tenants {
+		for _, spec := range sortedTierList(tierSets[tenant]) {
+			spec.Tenant = tenant
+			tiers = append(tiers, spec)
+		}
+	}
+	return tiers
+}
+
+// evaluateLoadShedding recomputes fleet utilization and the shedding rates
+func (s *Server) evaluateLoadShedding() {
+	s.mu.RLock()
+	utilization := s.fleetUtilizationLocked()
+	tiers := s.allTierSpecsLocked()
+	s.mu.RUnlock()
+
+	priorities := make([]int, 0, len(tiers))
+	for _, tier := range tiers {
+		priorities = append(priorities, tier.Priority)
+	}
+
+	active := s.shedder.Update(utilization, priorities)
+	s.mu.Lock()
+	changed := active != s.shedding
+	s.shedding = active
+	s.mu.Unlock()
+
+	if changed {
+		data := map[string]interface{}{
+			"fleet_utilization": fmt.Sprintf("%.1f%%", utilization),
+			"start_pct":         s.config.LoadShedding.StartUtilizationPct,
+			"full_pct":          s.config.LoadShedding.FullUtilizationPct,
+		}
+		if active {
+			LogWarnWithData("Load shedding started for low-priority tiers", data)
+		} else {
+			LogInfoWithData("Load shedding stopped", data)
+		}
+	}
+
+	s.exporters.ExportPoints(s.shedder.points(tiers, time.Now()))
+}
+
+// runLoadShedding re-evaluates shedding rates on an interval
+func (s *Server) runLoadShedding(ctx context.Context) {
+	interval := time.Duration(s.config.LoadShedding.EvaluateIntervalSecs) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.evaluateLoadShedding()
+		}
+	}
+}
+
+// hasStickyAssignment reports whether a sticky session is already placed for tier
+// Established sessions are not shed; shedding only turns away new work
+func (s *Server) hasStickyAssignment(stickyID, tier string) bool {
+	if stickyID == "" {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.stickyAssignments[stickyID][tier]
+	return ok
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestLoadShedder_ShedsLowestPriorityFirst verifies the overload ramp is spent on the lowest priority before the next
+func TestLoadShedder_ShedsLowestPriorityFirst(t *testing.T) {
+	shedder := NewLoadShedder(common.LoadSheddingConfig{Enabled: true, StartUtilizationPct: 80, FullUtilizationPct: 100})
+	priorities := []int{0, 0, 5, 10}
+
+	if shedder.Update(70, priorities) {
+		t.Error("Expected no shedding below the start threshold")
+	}
+
+	// Halfway up the ramp: two sheddable levels (0 and 5), so level 0 is fully shed and level 5 not yet
+	if !shedder.Update(90, priorities) {
+		t.Fatal("Expected shedding to be active")
+	}
+	if p := shedder.Probability(0); p != 1 {
+		t.Errorf("Expected priority 0 to be fully shed, got %.2f", p)
+	}
+	if p := shedder.Probability(5); p != 0 {
+		t.Errorf("Expected priority 5 not to be shed yet, got %.2f", p)
+	}
+
+	shedder.Update(95, priorities)
+	if p := shedder.Probability(5); p < 0.49 || p > 0.51 {
+		t.Errorf("Expected priority 5 to be half shed, got %.2f", p)
+	}
+	shedder.Update(120, priorities)
+	if p := shedder.Probability(10); p != 0 {
+		t.Errorf("Expected the highest priority never to be shed, got %.2f", p)
+	}
+
+	var disabled *LoadShedder
+	if disabled.Shed(common.TierSpec{Name: "free"}) {
+		t.Error("Expected a nil shedder never to shed")
+	}
+}
+
+// TestLoadShedding_ProxyRejectsWithRetryAfter verifies shed proxy requests get 503, Retry-After and are counted
+func TestLoadShedding_ProxyRejectsWithRetryAfter(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.LoadShedding = common.LoadSheddingConfig{Enabled: true, StartUtilizationPct: 50, FullUtilizationPct: 90, RetryAfterSecs: 15}
+		c.Tiers = []common.TierSpec{{Name: "free", VCPU: 1, MemoryGB: 1}, {Name: "pro", VCPU: 1, MemoryGB: 1, Priority: 10}}
+	})
+	server.tierSpecs = map[string]common.TierSpec{}
+	for _, tier := range server.config.Tiers {
+		server.tierSpecs[tier.Name] = tier
+	}
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "busy", CPUUsageAvg: []float64{95, 95, 95, 95}}))
+
+	server.evaluateLoadShedding()
+	if !server.shedding {
+		t.Fatal("Expected shedding to be active on a saturated fleet")
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/session?tier=free", nil)
+	server.handleProxy(rec, req)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "15" ||
+		rec.Header().Get(LBErrorCodeHeader) != errCodeLoadShed {
+		t.Errorf("Expected a shed 503 with Retry-After, got %d %v", rec.Code, rec.Header())
+	}
+	if count := server.shedder.shed[shedKey{tenant: DefaultTenant, tier: "free"}]; count != 1 {
+		t.Errorf("Expected the rejection to be counted, got %d", count)
+	}
+	if server.shedder.Shed(server.tierSpecs["pro"]) {
+		t.Error("Expected the highest-priority tier to be served")
+	}
+}
+
+// TestLoadShedder_CountsPerTenantTier verifies tenants sharing a tier name get separate shed counters
+func TestLoadShedder_CountsPerTenantTier(t *testing.T) {
+	shedder := NewLoadShedder(common.LoadSheddingConfig{Enabled: true, StartUtilizationPct: 50, FullUtilizationPct: 90})
+	shedder.Update(100, []int{0, 10})
+
+	defaultFree := common.TierSpec{Name: "free"}
+	teamFree := common.TierSpec{Name: "free", Tenant: "team-a"}
+	shedder.Shed(defaultFree)
+	shedder.Shed(teamFree)
+	shedder.Shed(teamFree)
+
+	rejected := make(map[string]float64)
+	for _, point := range shedder.points([]common.TierSpec{defaultFree, teamFree}, time.Now()) {
+		if point.field != "rejected_total" {
+			continue
+		}
+		for _, label := range point.labels {
+			if label.name == "tenant" {
+				rejected[label.value] = point.value
+			}
+		}
+	}
+	if rejected[DefaultTenant] != 1 || rejected["team-a"] != 2 {
+		t.Errorf("Expected 1 default and 2 team-a rejections, got %v", rejected)
+	}
+}
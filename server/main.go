@@ -6,6 +6,7 @@ import (
 	"crypto/tls"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -17,14 +18,17 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
-	"github.com/oschwald/geoip2-golang"
+	"github.com/redis/go-redis/v9"
 	"cyqle.in/opsen/common"
+	"golang.org/x/net/http2"
 )
 
 type Server struct {
@@ -32,6 +36,7 @@ type Server struct {
 	mu                    sync.RWMutex
 	clientCache           map[string]*ClientState
 	stickyAssignments     map[string]map[string]string // sticky_id → (tier → client_id)
+	stickyStore           StickyStore                  // Persists stickyAssignments (sticky_store)
 	pendingAllocations    map[string][]PendingAllocation // client_id → pending allocations
 	stickyHeader          string                        // Header name to use for stickiness
 	stickyByIP            bool                          // Use client IP for stickiness when header is not present
@@ -40,8 +45,50 @@ type Server struct {
 	cleanupInterval       time.Duration
 	proxyEndpoints        []string                   // Endpoint prefixes to proxy
 	geoIPDBPath           string
+	geo                   GeoProvider // GeoIP/ASN lookups (created on first use when nil)
+	geoOnce               sync.Once
+	geoMu                 sync.RWMutex // Guards geo when auto-update swaps the database
 	tierSpecs             map[string]common.TierSpec // Tier name -> resource requirements
+	tierVersion           string                     // Content hash of tierSpecs
+	nextTierSpecs         map[string]common.TierSpec // Staged tier set for X-Tier-Version: next (nil if none)
+	nextTierVersion       string                     // Content hash of nextTierSpecs
+	tierOverride          *tierOverride              // Tier set from PUT /admin/tiers replacing the config's tiers (nil if none)
+	tenantTierSpecs       map[string]map[string]common.TierSpec // Tenant -> its own tier set (tenants without tiers use tierSpecs)
+	tenantTierVersions    map[string]string                     // Tenant -> content hash of its tier set
 	config                *common.ServerConfig        // Full server configuration
+	costOverrides         map[string]float64          // client_id → admin-set hourly cost
+	resourceOverrides     map[string]BackendResourceOverride // client_id → admin-set reservations and capacity ceilings
+	outliers              *OutlierDetector            // Proxied error-rate ejection (nil if disabled)
+	breakers              *CircuitBreakers            // Per-backend proxy circuit breakers (nil if disabled)
+	concurrency           *ProxyConcurrency           // Per-backend proxied requests in flight (nil if unlimited)
+	uploads               *UploadMeter                // Throughput of streamed uploads per backend (nil if no route streams request bodies)
+	webhooks              *WebhookDispatcher          // Event delivery to configured webhooks (nil if none)
+	events                *EventHub                   // Live event stream for GET /events
+	apiKeys               *APIKeyStore                // API keys created at runtime and revoked configured keys
+	exporters             *StatsExporters             // Client stats forwarding to time-series databases (nil if none)
+	statsWriter           *StatsWriter                // Batched stats persistence (nil = synchronous writes)
+	janitor               *Janitor                    // Background deletion of deregistered backends' records
+	routingRules          []*routingRule              // Compiled routing_rules, evaluated in order before scoring
+	routeCache            *RouteCache                 // Short-lived picks for anonymous proxy requests (nil if disabled)
+	clientSnapshots       *ClientSnapshots            // Listings behind paginated GET /clients
+	routing               routingSnapshots            // Copy-on-write fleet view scored by placements without s.mu
+	reservations          *reservationIndex           // Per-backend pending reservation totals read by the scoring loop without s.mu
+	belowMinHealthy       map[string]bool             // Tiers last seen below min_healthy_backends (for transition alerts)
+	maintenance           MaintenanceState            // Server-wide maintenance switch (persisted in server_settings)
+	shedder               *LoadShedder                // Proxy load shedding for low-priority tiers (nil if disabled)
+	slos                  *SLOTracker                 // Latency objectives and burn-rate alerts (nil if none configured)
+	schedules             *RoutingSchedules           // Time-window score adjustments (nil if none configured)
+	pinger                *ICMPPinger                 // Echo sockets for icmp and udp health checks (nil unless those types are used)
+	shedding              bool                        // Load shedding was active at the last evaluation
+	autoscaler            *Autoscaler                 // Scaling recommendations for an external provisioner (nil if disabled)
+	duplicateIDAlerts     map[string]time.Time        // client_id → last client.duplicate_id alert
+	endpointConflictAlerts map[string]time.Time       // tenant|endpoint → last client.endpoint_conflict alert
+	clientErrorAlerts     map[string]time.Time        // client_id + source → last client.error alert
+	vantageProbes         map[string]*VantageProbe    // Probe region → location of the probe agent reporting from it
+	h2Transport           *http2.Transport            // Shared upstream transport for h2 endpoints
+	h2cTransport          *http2.Transport            // Shared upstream transport for h2c endpoints
+	proxyConns            proxyConnections            // Proxied requests in flight (GET /debug/status)
+	startedAt             time.Time                   // Server start time (for usage reports)
 }
 
 type ClientState struct {
@@ -50,12 +97,38 @@ type ClientState struct {
 	LastSeen     time.Time
 	Endpoint     string
 	Endpoints    []common.EndpointConfig
+	EndpointCandidates []string // Auto-built endpoints of a dual-stack agent (IPv4 first); health checks fall back between them
+	AddressFamily      string   // Family the last successful health check reached ("ipv4" or "ipv6"; empty for hostnames or until probed)
 
 	HealthStatus         string
 	LatencyMs            float64
 	LastHealthCheck      time.Time
 	ConsecutiveFailures  int
 	ConsecutiveSuccesses int
+	HealthReport         *BackendHealthReport // Backend's own health document (health_check_type: http-json; nil if none)
+	VantageLatencies     map[string]VantageLatency // Probe region → latency measured from there
+
+	HourlyCost     float64 // Effective hourly cost (admin override or registered value)
+	ASN            uint    // Backend network's autonomous system (0 if unknown)
+	ASNOrg         string  // Organization owning the ASN
+	RoutedSessions int64   // New sessions routed to this backend since server start
+
+	GPUECCFault      string    // Uncorrected ECC fault from the latest report (empty if none)
+	GPUXIDFault      string    // Most recent critical XID fault
+	GPUXIDFaultUntil time.Time // GPU tiers skip this backend until then
+
+	WarmingSince time.Time // Start of the slow-start window (zero = warm)
+
+	StatsAnomaly      string    // Why the latest implausible stats report was flagged
+	StatsAnomalyUntil time.Time // Routing skips this backend until then
+	frozenReports     int       // Consecutive reports repeating the previous measurements
+
+	BadStatsReports int                      // Reports with invalid fields since server start
+	BadStatsAt      time.Time                // When the latest one arrived
+	BadStatsErrors  []common.StatsFieldError // What was wrong with it
+
+	PendingApproval bool   // Held out of routing until approved (registration_approval)
+	ApprovedBy      string // Admin actor, or "auto:<rule>", that approved it (empty if never held)
 }
 
 // matchWildcard checks if a path matches a wildcard pattern
@@ -204,6 +277,10 @@ type PendingAllocation struct {
 	TierSpec  common.TierSpec    // Resource requirements
 	Timestamp time.Time          // When allocation was made
 	RequestID string             // Unique request identifier (for logging)
+	CPUSet    []int              // Least-loaded cores suggested for pinning
+	GPUSet    []int              // GPU devices the session was placed on (one device for fractional tiers)
+	LeaseID   string             // Returned to the consumer for renewal and release
+	ExpiresAt time.Time          // Resources are freed after this unless the lease is renewed
 }
 
 func main() {
@@ -213,10 +290,17 @@ func main() {
 	staleMinutes := flag.Int("stale", 0, "Client stale timeout (minutes)")
 	cleanupInterval := flag.Int("cleanup-interval", 0, "Cleanup interval (seconds)")
 	host := flag.String("host", "", "Host to bind to")
+	simulate := flag.Int("simulate", 0, "Spawn N in-process fake backends for capacity planning (uses an in-memory database unless -db is set)")
+	simulateProfiles := flag.String("simulate-profiles", "", "Comma-separated simulation profiles assigned round-robin (built-in: small,medium,large,gpu)")
+	simulateRPS := flag.Float64("simulate-rps", 0, "Synthetic /route requests per second in simulation mode (0 = no traffic)")
+	simulateSessionSecs := flag.Int("simulate-session-seconds", 300, "How long a simulated session occupies its backend")
+	simulateSeed := flag.Int64("simulate-seed", 0, "Random seed for simulation mode (0 = time-based)")
+	profile := flag.String("profile", "", "Configuration profile(s) to apply, comma-separated (overrides the file's profile key)")
+	printEffectiveConfig := flag.Bool("print-effective-config", false, "Print the merged configuration (includes, profile and flags applied) and exit")
 	flag.Parse()
 
 	// Load configuration from YAML file
-	yamlConfig, err := common.LoadServerConfig(*configFile)
+	yamlConfig, err := common.LoadServerConfigProfile(*configFile, *profile)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
@@ -238,10 +322,30 @@ func main() {
 		yamlConfig.Host = *host
 	}
 
+	// Simulation mode must never write fake backends into a real database by accident
+	if *simulate > 0 && *dbPath == "" {
+		yamlConfig.Database = "file:opsen-sim?mode=memory&cache=shared"
+	}
+
+	if *printEffectiveConfig {
+		out, err := common.EffectiveConfigYAML(yamlConfig)
+		if err != nil {
+			log.Fatalf("Failed to render config: %v", err)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+
 	// Initialize logger
 	InitLogger(yamlConfig.LogLevel, yamlConfig.JSONLogging, "lb-server")
 	LogInfo("Load balancer server initializing...")
 
+	// Initialize access log (independent of application log level and format)
+	if err := InitAccessLog(yamlConfig.AccessLog); err != nil {
+		LogFatal(fmt.Sprintf("Failed to initialize access log: %v", err))
+	}
+	defer CloseAccessLog()
+
 	// Initialize database with connection pooling
 	db, err := initDatabase(yamlConfig.Database)
 	if err != nil {
@@ -259,32 +363,142 @@ func main() {
 		"conn_max_lifetime": yamlConfig.DBConnMaxLifetime,
 	})
 
-	// Build tier specs map from config
-	tierSpecs := make(map[string]common.TierSpec)
-	for _, tier := range yamlConfig.Tiers {
-		tierSpecs[tier.Name] = tier
+	if err := validateProxyRoutes(yamlConfig.ProxyRoutes); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validateTenants(yamlConfig); err != nil {
+		LogFatal(err.Error())
+	}
+	if _, err := compileRoutingRules(yamlConfig.RoutingRules); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validateBackupConfig(yamlConfig.Backup); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validateMinHealthyBackends(yamlConfig); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validateLoadShedding(yamlConfig.LoadShedding); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validateSLOs(yamlConfig.SLOs); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validateRegistrationApproval(yamlConfig.RegistrationApproval); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validateRoutingSchedules(yamlConfig.RoutingSchedules); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validateAutoscale(yamlConfig); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validateStickyLimits(yamlConfig.StickyLimits); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validateStickyStore(yamlConfig); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validatePendingLimits(yamlConfig); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validateProxyConcurrency(yamlConfig.ProxyConcurrency); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validateCPUHeadroom(yamlConfig); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validateParentConfig(yamlConfig.Parent); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validateStreamProxy(yamlConfig.StreamProxy); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validateRoutingCookie(yamlConfig); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validateDuplicateEndpointPolicy(yamlConfig.DuplicateEndpointPolicy); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validateMetaHeaders(yamlConfig.MetaHeaders); err != nil {
+		LogFatal(err.Error())
+	}
+	if err := validateAgentAuthMode(yamlConfig); err != nil {
+		LogFatal(err.Error())
 	}
 
-	server := &Server{
-		db:                    db,
-		clientCache:           make(map[string]*ClientState),
-		stickyAssignments:     make(map[string]map[string]string),
-		pendingAllocations:    make(map[string][]PendingAllocation),
-		stickyHeader:          yamlConfig.StickyHeader,
-		stickyByIP:            yamlConfig.StickyByIP,
-		stickyAffinityEnabled: yamlConfig.StickyAffinityEnabled,
-		staleTimeout:          time.Duration(yamlConfig.StaleMinutes) * time.Minute,
-		cleanupInterval:       time.Duration(yamlConfig.CleanupIntervalSecs) * time.Second,
-		proxyEndpoints:        yamlConfig.ProxyEndpoints,
-		geoIPDBPath:           yamlConfig.GeoIPDBPath,
-		tierSpecs:             tierSpecs,
-		config:                yamlConfig,
+	server := NewServer(db, yamlConfig)
+
+	exporters, err := NewStatsExporters(yamlConfig.StatsExporters)
+	if err != nil {
+		LogFatal(fmt.Sprintf("Failed to initialize stats exporters: %v", err))
+	}
+	server.exporters = exporters
+	for _, exporter := range yamlConfig.StatsExporters {
+		LogInfoWithData("Stats exporter configured", map[string]interface{}{
+			"type": exporter.Type,
+			"url":  exporter.URL,
+		})
+	}
+
+	geoUpdater, err := NewGeoIPUpdater(yamlConfig.GeoIP, yamlConfig.GeoIPDBPath, server.reloadGeoProvider)
+	if err != nil {
+		LogFatal(fmt.Sprintf("Invalid GeoIP auto-update configuration: %v", err))
+	}
+	if geoUpdater != nil {
+		// Fetch a missing database before the provider needs it
+		if _, statErr := os.Stat(yamlConfig.GeoIPDBPath); statErr != nil {
+			if _, err := geoUpdater.Update(); err != nil {
+				LogWarn(fmt.Sprintf("Initial GeoIP database download failed: %v", err))
+			}
+		}
+	}
+
+	geo, err := NewGeoProvider(yamlConfig.GeoIP, yamlConfig.GeoIPDBPath)
+	if err != nil {
+		LogFatal(fmt.Sprintf("Failed to initialize GeoIP provider: %v", err))
+	}
+	server.geo = geo
+	if geo != nil {
+		// Close whichever provider is current at exit (auto-update may have replaced this one)
+		defer func() { server.geoProvider().Close() }()
+		LogInfoWithData("GeoIP provider configured", map[string]interface{}{
+			"provider":        yamlConfig.GeoIP.Provider,
+			"asn_enrichment":  yamlConfig.GeoIP.ASNDBPath != "" || yamlConfig.GeoIP.Provider == geoProviderHTTP,
+			"cache_size":      yamlConfig.GeoIP.CacheSize,
+			"prefer_same_asn": yamlConfig.GeoIP.PreferSameASN,
+		})
+	}
+
+	// icmp checks and the udp fallback share echo sockets opened now, while the process may still hold
+	// CAP_NET_RAW; datagram ping sockets are used when the kernel allows them
+	if yamlConfig.HealthCheckEnabled && (yamlConfig.HealthCheckType == HealthCheckTypeICMP || yamlConfig.HealthCheckType == HealthCheckTypeUDP) {
+		pinger, err := NewICMPPinger()
+		switch {
+		case err == nil:
+			server.pinger = pinger
+			defer pinger.Close()
+			LogInfoWithData("ICMP ping enabled for health checks", map[string]interface{}{
+				"type":    yamlConfig.HealthCheckType,
+				"sockets": pinger.Mode(),
+			})
+		case yamlConfig.HealthCheckType == HealthCheckTypeICMP:
+			LogFatal(fmt.Sprintf("icmp health checks need ICMP sockets (run with CAP_NET_RAW, e.g. AmbientCapabilities=CAP_NET_RAW under systemd): %v", err))
+		default:
+			LogWarn(fmt.Sprintf("UDP health checks will not fall back to ping for silent services: %v", err))
+		}
+	}
+
+	// Tiers edited with PUT /admin/tiers replace the config file's tiers
+	if err := server.loadTierOverride(); err != nil {
+		LogWarn(fmt.Sprintf("Failed to load tier set: %v", err))
 	}
 
 	LogInfoWithData("Loaded tier specifications", map[string]interface{}{
-		"count": len(tierSpecs),
+		"count":   len(server.tierSpecs),
+		"version": server.tierVersion,
 	})
-	for name, spec := range tierSpecs {
+	for name, spec := range server.tierSpecs {
 		LogInfoWithData(fmt.Sprintf("Tier: %s", name), map[string]interface{}{
 			"vcpu":       spec.VCPU,
 			"memory_gb":  spec.MemoryGB,
@@ -299,15 +513,78 @@ func main() {
 		"header":           yamlConfig.StickyHeader,
 		"by_ip":            yamlConfig.StickyByIP,
 		"affinity_enabled": yamlConfig.StickyAffinityEnabled,
+		"mode":             yamlConfig.StickyMode,
+		"store":            yamlConfig.StickyStore,
 	})
 
+	// Shared Redis connection for rate limiting and sticky assignments across replicas
+	var redisClient *redis.Client
+	if yamlConfig.RateLimitBackend == "redis" || yamlConfig.StickyStore == StickyStoreRedis {
+		redisClient = newRedisClient(yamlConfig.Redis)
+		defer redisClient.Close()
+	}
+
+	if yamlConfig.StickyStore == StickyStoreRedis {
+		stickyStore := NewRedisStickyStore(redisClient, yamlConfig.Redis.KeyPrefix, time.Duration(yamlConfig.StickyTTLSecs)*time.Second)
+		pingCtx, pingCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := stickyStore.Ping(pingCtx); err != nil {
+			LogWarn(fmt.Sprintf("Redis sticky store not reachable at %s (sticky assignments are kept in memory until it is): %v",
+				yamlConfig.Redis.Address, err))
+		}
+		pingCancel()
+		server.stickyStore = stickyStore
+	}
+
 	// Load existing clients from database
 	if err := server.loadClients(); err != nil {
 		LogWarn(fmt.Sprintf("Failed to load clients from database: %v", err))
 	}
 
-	// Load sticky assignments if sticky sessions enabled
-	if stickyEnabled {
+	// Load admin cost overrides (applied on top of registered costs)
+	if err := server.loadCostOverrides(); err != nil {
+		LogWarn(fmt.Sprintf("Failed to load cost overrides: %v", err))
+	}
+
+	// Load admin resource reservations and capacity overrides (applied on top of reported stats)
+	if err := server.loadResourceOverrides(); err != nil {
+		LogWarn(fmt.Sprintf("Failed to load resource overrides: %v", err))
+	}
+
+	// Stored stats may be hours old; fetch current ones from agents that serve them before routing
+	if yamlConfig.StartupReconcileSecs > 0 {
+		server.reconcileFleet(context.Background(), time.Duration(yamlConfig.StartupReconcileSecs)*time.Second)
+	}
+
+	// Runtime API keys and revocations take effect before the first request
+	if err := server.apiKeys.Load(); err != nil {
+		LogWarn(fmt.Sprintf("Failed to load API keys: %v", err))
+	}
+
+	// Maintenance mode survives restarts
+	if err := server.loadMaintenanceState(); err != nil {
+		LogWarn(fmt.Sprintf("Failed to load maintenance state: %v", err))
+	}
+
+	// Default-tenant assignments used to be stored under the bare sticky ID
+	if moved, err := server.migrateStickyKeys(); err != nil {
+		LogWarn(fmt.Sprintf("Failed to migrate sticky assignment keys: %v", err))
+	} else if moved > 0 {
+		LogInfoWithData("Moved sticky assignments to tenant-scoped keys", map[string]interface{}{
+			"count": moved,
+		})
+	}
+
+	// Assignments stored before sticky_id_hash_key was set hold raw IDs; drop them rather than keep the PII
+	if removed, err := server.purgeUnhashedStickyAssignments(); err != nil {
+		LogWarn(fmt.Sprintf("Failed to purge unhashed sticky assignments: %v", err))
+	} else if removed > 0 {
+		LogInfoWithData("Purged sticky assignments stored with raw sticky IDs", map[string]interface{}{
+			"count": removed,
+		})
+	}
+
+	// Load sticky assignments if sticky sessions enabled (hash mode keeps no assignment state)
+	if stickyEnabled && !server.isHashStickyMode() {
 		if err := server.loadStickyAssignments(); err != nil {
 			LogWarn(fmt.Sprintf("Failed to load sticky assignments: %v", err))
 		}
@@ -323,22 +600,100 @@ func main() {
 	// Start health check goroutine
 	go server.runHealthChecks(ctx)
 
+	// Alert when tiers drop below their minimum healthy backends
+	if len(yamlConfig.MinHealthyBackends) > 0 {
+		go server.monitorMinHealthyBackends(ctx)
+	}
+
+	// Shed low-priority tiers at the proxy when the fleet nears saturation
+	if server.shedder != nil {
+		go server.runLoadShedding(ctx)
+	}
+
+	// Alert when routing or proxy latency burns its SLO error budget too fast
+	if server.slos != nil {
+		go server.runSLOAlerts(ctx)
+	}
+
+	// Recommend adding backends to short tiers and tearing down idle ones
+	if server.autoscaler != nil {
+		go server.runAutoscaler(ctx)
+	}
+
+	// Hierarchical mode: report this fleet's capacity to a parent server
+	if parent := NewParentReporter(server, yamlConfig.Parent); parent != nil {
+		go parent.Run(ctx)
+		LogInfoWithData("Reporting fleet capacity to parent server", map[string]interface{}{
+			"parent":       yamlConfig.Parent.URL,
+			"endpoint_url": yamlConfig.Parent.EndpointURL,
+		})
+	}
+
+	// Start scheduled database backups
+	if yamlConfig.Backup.IntervalHours > 0 {
+		go server.runScheduledBackups(ctx)
+		LogInfoWithData("Scheduled database backups enabled", map[string]interface{}{
+			"dir":            yamlConfig.Backup.Dir,
+			"interval_hours": yamlConfig.Backup.IntervalHours,
+			"keep":           yamlConfig.Backup.Keep,
+		})
+	}
+
+	// Start GeoIP database auto-update
+	if geoUpdater != nil {
+		go geoUpdater.Run(ctx)
+		LogInfoWithData("GeoIP auto-update enabled", map[string]interface{}{
+			"url":            yamlConfig.GeoIP.AutoUpdate.URL,
+			"interval_hours": yamlConfig.GeoIP.AutoUpdate.CheckIntervalHours,
+			"keep_backups":   yamlConfig.GeoIP.AutoUpdate.KeepBackups,
+		})
+	}
+
+	// Layer-4 listeners for non-HTTP protocols
+	streamProxy, err := NewStreamProxy(server, yamlConfig.StreamProxy)
+	if err != nil {
+		LogFatal(fmt.Sprintf("Failed to start stream proxy: %v", err))
+	}
+	if streamProxy != nil {
+		streamProxy.Run()
+	}
+
 	// Initialize middlewares
-	var rateLimiter *RateLimiter
+	var rateLimit func(http.Handler) http.Handler
 	if yamlConfig.RateLimitPerMinute > 0 {
-		rateLimiter = NewRateLimiter(yamlConfig.RateLimitPerMinute, yamlConfig.RateLimitBurst)
+		switch yamlConfig.RateLimitBackend {
+		case "redis":
+			redisLimiter := NewRedisRateLimiter(redisClient, yamlConfig.Redis.KeyPrefix,
+				yamlConfig.RateLimitPerMinute, yamlConfig.RateLimitBurst)
+			pingCtx, pingCancel := context.WithTimeout(ctx, 5*time.Second)
+			if err := redisLimiter.Ping(pingCtx); err != nil {
+				LogWarn(fmt.Sprintf("Redis rate limiter not reachable at %s (falling back to per-instance limits until it is): %v",
+					yamlConfig.Redis.Address, err))
+			}
+			pingCancel()
+			rateLimit = redisLimiter.Middleware
+		case "", "memory":
+			rateLimit = NewRateLimiter(yamlConfig.RateLimitPerMinute, yamlConfig.RateLimitBurst).Middleware
+		default:
+			LogFatal(fmt.Sprintf("Invalid rate_limit_backend: %s (expected memory or redis)", yamlConfig.RateLimitBackend))
+		}
 	}
 	apiKeyAuth := NewAPIKeyAuth(yamlConfig.ServerKey, yamlConfig.APIKeys)
+	apiKeyAuth.SetTenantKeys(tenantAPIKeys(yamlConfig.Tenants))
+	apiKeyAuth.SetKeyStore(server.apiKeys)
 	ipWhitelist := NewIPWhitelist(yamlConfig.WhitelistedIPs)
 	inputValidator := &InputValidator{}
 
 	LogInfoWithData("Security configuration", map[string]interface{}{
 		"server_key_enabled":   yamlConfig.ServerKey != "",
+		"agent_auth_mode":      yamlConfig.AgentAuthMode,
 		"api_keys_enabled":     len(yamlConfig.APIKeys) > 0,
+		"tenants":              len(yamlConfig.Tenants),
 		"ip_whitelist_enabled": len(yamlConfig.WhitelistedIPs) > 0,
 		"rate_limit_enabled":   yamlConfig.RateLimitPerMinute > 0,
 		"rate_limit_per_min":   yamlConfig.RateLimitPerMinute,
 		"rate_limit_burst":     yamlConfig.RateLimitBurst,
+		"rate_limit_backend":   yamlConfig.RateLimitBackend,
 		"max_request_bytes":    yamlConfig.MaxRequestBodyBytes,
 		"request_timeout":      yamlConfig.RequestTimeout,
 		"cors_enabled":         yamlConfig.EnableCORS,
@@ -351,30 +706,63 @@ func main() {
 	LogInfo("Registering load balancer management endpoints:")
 	LogInfo("  - /register (client registration)")
 	LogInfo("  - /stats (metrics reporting)")
+	LogInfo("  - /errors (agent error events)")
 	LogInfo("  - /route (routing decisions)")
+	LogInfo("  - /simulate (what-if placement of a hypothetical batch)")
 	LogInfo("  - /health (health checks)")
 	LogInfo("  - /clients (list active clients)")
 	LogInfo("  - /clients/purge (purge stale clients)")
+	LogInfo("  - /clients/{id}/approve (release a backend held for approval)")
+	LogInfo("  - /allocations/{id}/renew (allocation lease renewal)")
+	LogInfo("  - /costs (backend cost report and overrides)")
+	LogInfo("  - /admin/backup (database snapshot)")
+	LogInfo("  - /admin/audit (admin action audit trail)")
+	LogInfo("  - /sticky (sticky assignment search and removal)")
+	LogInfo("  - /admin/maintenance (maintenance mode switch)")
+	LogInfo("  - /admin/tiers (live tier set edits)")
+	LogInfo("  - /admin/keys (runtime API keys, rotation and revocation)")
+	LogInfo("  - /events (live event stream, SSE)")
+	LogInfo("  - /autoscale/recommendations (scaling recommendations)")
+	LogInfo("  - /slo (latency SLO burn rates and alert state)")
+	LogInfo("  - /debug/status (runtime and process self-metrics)")
 
 	// Management endpoint middlewares (require auth if configured)
-	managementMiddlewares := []func(http.Handler) http.Handler{
-		PanicRecovery,
-	}
-	if !yamlConfig.DisableSecurityHeaders {
-		managementMiddlewares = append(managementMiddlewares, SecurityHeaders)
-	}
-	managementMiddlewares = append(managementMiddlewares,
-		RequestLogger,
-		RequestSizeLimit(yamlConfig.MaxRequestBodyBytes),
-		Timeout(time.Duration(yamlConfig.RequestTimeout) * time.Second),
-		inputValidator.Middleware,
-		apiKeyAuth.Middleware,
-		ipWhitelist.Middleware,
-	)
-	if rateLimiter != nil {
-		managementMiddlewares = append(managementMiddlewares, rateLimiter.Middleware)
+	buildManagementMiddlewares := func(auth func(http.Handler) http.Handler, timeout time.Duration) []func(http.Handler) http.Handler {
+		middlewares := []func(http.Handler) http.Handler{
+			PanicRecovery,
+		}
+		if !yamlConfig.DisableSecurityHeaders {
+			middlewares = append(middlewares, SecurityHeaders)
+		}
+		middlewares = append(middlewares,
+			RequestLogger,
+			RequestSizeLimit(yamlConfig.MaxRequestBodyBytes),
+			Timeout(timeout),
+			inputValidator.Middleware,
+			auth,
+			ipWhitelist.Middleware,
+		)
+		if rateLimit != nil {
+			middlewares = append(middlewares, rateLimit)
+		}
+		return middlewares
+	}
+	requestTimeout := time.Duration(yamlConfig.RequestTimeout) * time.Second
+	managementMiddlewares := buildManagementMiddlewares(apiKeyAuth.Middleware, requestTimeout)
+
+	// Agent endpoint middlewares (/register, /stats, /stats/batch) - signed requests replace bearer keys in hmac mode
+	agentMiddlewares := managementMiddlewares
+	if yamlConfig.AgentAuthMode == common.AuthModeHMAC {
+		hmacAuth := NewHMACAuth(yamlConfig.ServerKey, time.Duration(yamlConfig.HMACMaxSkewSecs)*time.Second)
+		agentMiddlewares = buildManagementMiddlewares(hmacAuth.Middleware, requestTimeout)
+		LogInfoWithData("Agent HMAC request signing enabled", map[string]interface{}{
+			"max_skew_seconds": yamlConfig.HMACMaxSkewSecs,
+		})
 	}
 
+	// Agents may gzip request bodies (compress_requests); decoded after auth so signatures cover the wire bytes
+	agentMiddlewares = append(agentMiddlewares[:len(agentMiddlewares):len(agentMiddlewares)], DecompressRequest(yamlConfig.MaxRequestBodyBytes))
+
 	// Proxy endpoint middlewares (NO auth - these are for end users)
 	proxyMiddlewares := []func(http.Handler) http.Handler{
 		PanicRecovery,
@@ -384,30 +772,75 @@ func main() {
 	}
 	proxyMiddlewares = append(proxyMiddlewares,
 		RequestLogger,
-		RequestSizeLimit(yamlConfig.MaxRequestBodyBytes),
-		Timeout(time.Duration(yamlConfig.RequestTimeout) * time.Second),
+		RequestSizeLimitFunc(server.proxyMaxBodyBytes),
+		TimeoutFunc(server.proxyRequestTimeout),
 	)
-	if rateLimiter != nil {
-		proxyMiddlewares = append(proxyMiddlewares, rateLimiter.Middleware)
+	if rateLimit != nil {
+		proxyMiddlewares = append(proxyMiddlewares, rateLimit)
 	}
 
 	// Add CORS if enabled
 	if yamlConfig.EnableCORS {
 		corsConfig := CORSConfig{
 			AllowedOrigins: yamlConfig.CORSAllowedOrigins,
-			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 			AllowedHeaders: []string{"Content-Type", "X-API-Key", "Authorization"},
 		}
 		managementMiddlewares = append([]func(http.Handler) http.Handler{CORS(corsConfig)}, managementMiddlewares...)
-		proxyMiddlewares = append([]func(http.Handler) http.Handler{CORS(corsConfig)}, proxyMiddlewares...)
-	}
-
-	mux.Handle("/register", ChainMiddleware(http.HandlerFunc(server.handleRegister), managementMiddlewares...))
-	mux.Handle("/stats", ChainMiddleware(http.HandlerFunc(server.handleStats), managementMiddlewares...))
+		agentMiddlewares = append([]func(http.Handler) http.Handler{CORS(corsConfig)}, agentMiddlewares...)
+
+		// Proxy routes with options: passthrough let the backend answer its own preflights
+		proxyCORSConfig := corsConfig
+		proxyCORSConfig.PassthroughPreflight = server.optionsPassthrough
+		proxyMiddlewares = append([]func(http.Handler) http.Handler{CORS(proxyCORSConfig)}, proxyMiddlewares...)
+	}
+
+	// Instance-wide admin endpoints are closed to tenant API keys; changes are recorded in admin_audit
+	// with the key that made them before they run
+	adminMiddlewares := append(managementMiddlewares[:len(managementMiddlewares):len(managementMiddlewares)], GlobalKeyOnly, server.AuditTrail)
+	// Profiles run longer than request_timeout_seconds, so pprof gets the admin chain without the timeout,
+	// and its reads are audited as well since they expose memory contents and the command line
+	pprofMiddlewares := append(buildManagementMiddlewares(apiKeyAuth.Middleware, 0), GlobalKeyOnly, server.AuditAccess)
+
+	mux.Handle("/register", ChainMiddleware(http.HandlerFunc(server.handleRegister), agentMiddlewares...))
+	mux.Handle("/stats", ChainMiddleware(http.HandlerFunc(server.handleStats), agentMiddlewares...))
+	mux.Handle("/stats/batch", ChainMiddleware(http.HandlerFunc(server.handleStatsBatch), agentMiddlewares...))
+	mux.Handle("/probe-back", ChainMiddleware(http.HandlerFunc(server.handleProbeBack), agentMiddlewares...))
+	mux.Handle("/errors", ChainMiddleware(http.HandlerFunc(server.handleErrors), agentMiddlewares...))
+	mux.Handle("/vantage/targets", ChainMiddleware(http.HandlerFunc(server.handleVantageTargets), agentMiddlewares...))
+	mux.Handle("/vantage/report", ChainMiddleware(http.HandlerFunc(server.handleVantageReport), agentMiddlewares...))
+	mux.Handle("/bandwidth", ChainMiddleware(http.HandlerFunc(server.handleBandwidth), agentMiddlewares...))
 	mux.Handle("/route", ChainMiddleware(http.HandlerFunc(server.handleRoute), managementMiddlewares...))
 	mux.Handle("/clients", ChainMiddleware(http.HandlerFunc(server.handleListClients), managementMiddlewares...))
-	mux.Handle("/clients/purge", ChainMiddleware(http.HandlerFunc(server.handlePurgeStaleClients), managementMiddlewares...))
-	mux.Handle("/clients/purge-pending", ChainMiddleware(http.HandlerFunc(server.handlePurgePendingAllocations), managementMiddlewares...))
+	mux.Handle("/clients/purge", ChainMiddleware(http.HandlerFunc(server.handlePurgeStaleClients), adminMiddlewares...))
+	mux.Handle("/clients/", ChainMiddleware(http.HandlerFunc(server.handleClientByID), adminMiddlewares...))
+	mux.Handle("/clients/purge-pending", ChainMiddleware(http.HandlerFunc(server.handlePurgePendingAllocations), adminMiddlewares...))
+	mux.Handle("/allocations/", ChainMiddleware(http.HandlerFunc(server.handleAllocationByID), managementMiddlewares...))
+	mux.Handle("/costs", ChainMiddleware(http.HandlerFunc(server.handleCosts), adminMiddlewares...))
+	mux.Handle("/reservations", ChainMiddleware(http.HandlerFunc(server.handleReservations), adminMiddlewares...))
+	mux.Handle("/tiers", ChainMiddleware(http.HandlerFunc(server.handleTiers), managementMiddlewares...))
+	mux.Handle("/simulate", ChainMiddleware(http.HandlerFunc(server.handleSimulate), managementMiddlewares...))
+	mux.Handle("/tiers/next", ChainMiddleware(http.HandlerFunc(server.handleNextTiers), adminMiddlewares...))
+	mux.Handle("/tiers/promote", ChainMiddleware(http.HandlerFunc(server.handlePromoteTiers), adminMiddlewares...))
+	mux.Handle("/admin/maintenance", ChainMiddleware(http.HandlerFunc(server.handleMaintenance), adminMiddlewares...))
+	mux.Handle("/admin/tiers", ChainMiddleware(http.HandlerFunc(server.handleAdminTiers), adminMiddlewares...))
+	mux.Handle("/admin/backup", ChainMiddleware(http.HandlerFunc(server.handleBackup), adminMiddlewares...))
+	mux.Handle("/admin/audit", ChainMiddleware(http.HandlerFunc(server.handleAdminAudit), adminMiddlewares...))
+	mux.Handle("/sticky", ChainMiddleware(http.HandlerFunc(server.handleStickyList), adminMiddlewares...))
+	mux.Handle("/sticky/export", ChainMiddleware(http.HandlerFunc(server.handleStickyExport), adminMiddlewares...))
+	mux.Handle("/sticky/import", ChainMiddleware(http.HandlerFunc(server.handleStickyImport), adminMiddlewares...))
+	mux.Handle("/sticky/", ChainMiddleware(http.HandlerFunc(server.handleStickyByID), adminMiddlewares...))
+	mux.Handle("/admin/keys", ChainMiddleware(http.HandlerFunc(server.handleAPIKeys), adminMiddlewares...))
+	mux.Handle("/admin/keys/", ChainMiddleware(http.HandlerFunc(server.handleAPIKeyByID), adminMiddlewares...))
+	mux.Handle("/events", ChainMiddleware(http.HandlerFunc(server.handleEvents), adminMiddlewares...))
+	mux.Handle("/autoscale/recommendations", ChainMiddleware(http.HandlerFunc(server.handleAutoscaleRecommendations), adminMiddlewares...))
+	mux.Handle("/slo", ChainMiddleware(http.HandlerFunc(server.handleSLO), adminMiddlewares...))
+	mux.Handle("/debug/status", ChainMiddleware(http.HandlerFunc(server.handleDebugStatus), adminMiddlewares...))
+
+	if yamlConfig.DebugPprof {
+		registerPprofHandlers(mux, pprofMiddlewares...)
+		LogWarn("debug_pprof enabled: profiling endpoints are served under /debug/pprof/ (admin keys only)")
+	}
 
 	// Health check - minimal middleware (no auth, no rate limiting)
 	healthMiddlewares := []func(http.Handler) http.Handler{
@@ -441,18 +874,22 @@ func main() {
 	addr := fmt.Sprintf("%s:%d", yamlConfig.Host, yamlConfig.Port)
 
 	// Create HTTP server with security timeouts
+	tlsEnabled := yamlConfig.TLSCertFile != "" && yamlConfig.TLSKeyFile != ""
 	httpServer := &http.Server{
 		Addr:              addr,
-		Handler:           mux,
+		Handler:           publicHandler(mux, yamlConfig, tlsEnabled),
 		ReadTimeout:       time.Duration(yamlConfig.RequestTimeout) * time.Second,
 		WriteTimeout:      0, // Disabled for SSE/long-lived connections support
 		IdleTimeout:       time.Duration(yamlConfig.IdleTimeout) * time.Second,
 		ReadHeaderTimeout: time.Duration(yamlConfig.ReadHeaderTimeout) * time.Second,
 		MaxHeaderBytes:    1 << 20, // 1MB
 	}
+	configureHTTP2(httpServer, yamlConfig)
 
 	// Handle graceful shutdown
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 		<-sigChan
@@ -467,7 +904,12 @@ func main() {
 			LogError(fmt.Sprintf("Server shutdown error: %v", err))
 		}
 
+		streamProxy.Close()
 		cancel() // Cancel cleanup goroutine context
+		server.janitor.Close()     // Finish queued deletions before the database is closed
+		server.statsWriter.Close() // Flush buffered stats before the database is closed
+		server.webhooks.Close()
+		server.exporters.Close()
 		LogInfo("Server stopped")
 	}()
 
@@ -476,9 +918,56 @@ func main() {
 		"database":         yamlConfig.Database,
 		"stale_timeout":    fmt.Sprintf("%dm", yamlConfig.StaleMinutes),
 		"cleanup_interval": fmt.Sprintf("%ds", yamlConfig.CleanupIntervalSecs),
-		"tls_enabled":      yamlConfig.TLSCertFile != "" && yamlConfig.TLSKeyFile != "",
+		"tls_enabled":      tlsEnabled,
+		"http2":            (tlsEnabled && yamlConfig.HTTP2Enabled) || (!tlsEnabled && yamlConfig.H2CEnabled),
 	})
 
+	// Spawn fake backends and traffic once the listener is up
+	if *simulate > 0 {
+		profiles, err := resolveSimulationProfiles(*simulateProfiles, yamlConfig.SimulationProfiles)
+		if err != nil {
+			LogFatal(fmt.Sprintf("Invalid simulation profiles: %v", err))
+		}
+
+		scheme := "http"
+		if yamlConfig.TLSCertFile != "" && yamlConfig.TLSKeyFile != "" {
+			scheme = "https"
+		}
+		simHost := yamlConfig.Host
+		if simHost == "" || simHost == "0.0.0.0" || simHost == "::" {
+			simHost = "127.0.0.1"
+		}
+
+		if yamlConfig.RateLimitPerMinute > 0 && *simulateRPS*60 > float64(yamlConfig.RateLimitPerMinute) {
+			LogWarn(fmt.Sprintf("Simulated traffic (%.1f rps) exceeds rate_limit_per_minute (%d) - expect throttled requests",
+				*simulateRPS, yamlConfig.RateLimitPerMinute))
+		}
+
+		simulator := NewSimulator(SimulationOptions{
+			Backends:        *simulate,
+			Profiles:        profiles,
+			TrafficRPS:      *simulateRPS,
+			SessionDuration: time.Duration(*simulateSessionSecs) * time.Second,
+			Seed:            *simulateSeed,
+			ServerURL:       fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(simHost, strconv.Itoa(yamlConfig.Port))),
+			ServerKey:       yamlConfig.ServerKey,
+			AuthMode:        yamlConfig.AgentAuthMode,
+			StickyHeader:    yamlConfig.StickyHeader,
+			InsecureTLS:     true,
+		}, yamlConfig.Tiers)
+		defer simulator.Stop()
+
+		go func() {
+			if err := simulator.waitForServer(ctx, 30*time.Second); err != nil {
+				LogError(fmt.Sprintf("Simulation not started: %v", err))
+				return
+			}
+			if err := simulator.Start(ctx); err != nil {
+				LogError(fmt.Sprintf("Simulation not started: %v", err))
+			}
+		}()
+	}
+
 	// Start server with TLS if configured
 	if yamlConfig.TLSCertFile != "" && yamlConfig.TLSKeyFile != "" {
 		LogInfo(fmt.Sprintf("Starting HTTPS server with TLS cert: %s", yamlConfig.TLSCertFile))
@@ -491,6 +980,83 @@ func main() {
 			LogFatal(fmt.Sprintf("Server error: %v", err))
 		}
 	}
+
+	// Serving stops as soon as shutdown begins; wait for buffered stats and deliveries to drain
+	<-shutdownDone
+}
+
+// NewServer creates a server instance from configuration
+func NewServer(db *sql.DB, config *common.ServerConfig) *Server {
+	// Build tier specs map from config
+	tierSpecs := make(map[string]common.TierSpec)
+	for _, tier := range config.Tiers {
+		tierSpecs[tier.Name] = tier
+	}
+	tenantTierSpecs, tenantTierVersions := buildTenantTiers(config.Tenants)
+
+	// Rules are validated at startup; an invalid set here disables rules rather than routing wrongly
+	routingRules, err := compileRoutingRules(config.RoutingRules)
+	if err != nil {
+		LogWarn(fmt.Sprintf("Routing rules disabled: %v", err))
+	}
+
+	statsWriter := NewStatsWriter(db, config.DBSigningKey, config.StatsWriteBatchSize, config.StatsWriteFlushMs, config.StatsWriteQueueSize)
+
+	server := &Server{
+		db:                    db,
+		clientCache:           make(map[string]*ClientState),
+		stickyAssignments:     make(map[string]map[string]string),
+		stickyStore:           NewSQLiteStickyStore(db, config.DBSigningKey),
+		pendingAllocations:    make(map[string][]PendingAllocation),
+		reservations:          newReservationIndex(),
+		costOverrides:         make(map[string]float64),
+		resourceOverrides:     make(map[string]BackendResourceOverride),
+		stickyHeader:          config.StickyHeader,
+		stickyByIP:            config.StickyByIP,
+		stickyAffinityEnabled: config.StickyAffinityEnabled,
+		staleTimeout:          time.Duration(config.StaleMinutes) * time.Minute,
+		cleanupInterval:       time.Duration(config.CleanupIntervalSecs) * time.Second,
+		proxyEndpoints:        proxyPrefixes(config),
+		geoIPDBPath:           config.GeoIPDBPath,
+		tierSpecs:             tierSpecs,
+		tierVersion:           tierSetVersion(tierSpecs),
+		tenantTierSpecs:       tenantTierSpecs,
+		tenantTierVersions:    tenantTierVersions,
+		outliers:              NewOutlierDetector(config.OutlierDetection),
+		breakers:              NewCircuitBreakers(config.CircuitBreaker),
+		concurrency:           NewProxyConcurrency(config.ProxyConcurrency),
+		uploads:               NewUploadMeter(config.ProxyRoutes),
+		webhooks:              NewWebhookDispatcher(config.Webhooks),
+		events:                NewEventHub(),
+		apiKeys:               NewAPIKeyStore(db),
+		statsWriter:           statsWriter,
+		routingRules:          routingRules,
+		routeCache:            NewRouteCache(config.RouteCacheTTLMs),
+		clientSnapshots:       NewClientSnapshots(),
+		belowMinHealthy:       make(map[string]bool),
+		shedder:               NewLoadShedder(config.LoadShedding),
+		slos:                  NewSLOTracker(config.SLOs),
+		schedules:             NewRoutingSchedules(config.RoutingSchedules),
+		autoscaler:            NewAutoscaler(config.Autoscale),
+		duplicateIDAlerts:     make(map[string]time.Time),
+		endpointConflictAlerts: make(map[string]time.Time),
+		clientErrorAlerts:     make(map[string]time.Time),
+		vantageProbes:         make(map[string]*VantageProbe),
+		h2Transport:           newH2Transport(config.TLSInsecureSkipVerify),
+		h2cTransport:          newH2CTransport(),
+		config:                config,
+		startedAt:             time.Now(),
+	}
+	server.janitor = NewJanitor(db, config.CleanupBatchSize, statsWriter, server.isClientLive)
+	return server
+}
+
+// isClientLive reports whether a backend is registered (in the cache)
+func (s *Server) isClientLive(clientID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.clientCache[clientID]
+	return ok
 }
 
 func initDatabase(dbPath string) (*sql.DB, error) {
@@ -515,6 +1081,7 @@ func initDatabase(dbPath string) (*sql.DB, error) {
 		total_gpus INTEGER DEFAULT 0,
 		gpu_models TEXT,
 		endpoint TEXT,
+		hourly_cost REAL DEFAULT 0,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		last_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
@@ -532,6 +1099,12 @@ func initDatabase(dbPath string) (*sql.DB, error) {
 		disk_used REAL,
 		disk_avail REAL,
 		gpu_stats_json TEXT,
+		load_avg_1 REAL DEFAULT 0,
+		load_avg_5 REAL DEFAULT 0,
+		load_avg_15 REAL DEFAULT 0,
+		swap_total REAL DEFAULT 0,
+		swap_used REAL DEFAULT 0,
+		psi_json TEXT,
 		FOREIGN KEY (client_id) REFERENCES clients(client_id)
 	);
 
@@ -545,21 +1118,188 @@ func initDatabase(dbPath string) (*sql.DB, error) {
 		FOREIGN KEY (client_id) REFERENCES clients(client_id)
 	);
 
+	CREATE TABLE IF NOT EXISTS backend_costs (
+		client_id TEXT PRIMARY KEY,
+		hourly_cost REAL NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS backend_resource_overrides (
+		client_id TEXT PRIMARY KEY,
+		reserved_vcpu INTEGER NOT NULL DEFAULT 0,
+		reserved_memory_gb REAL NOT NULL DEFAULT 0,
+		reserved_storage_gb REAL NOT NULL DEFAULT 0,
+		reserved_gpus INTEGER NOT NULL DEFAULT 0,
+		reserved_gpu_memory_gb REAL NOT NULL DEFAULT 0,
+		max_vcpu INTEGER NOT NULL DEFAULT 0,
+		max_memory_gb REAL NOT NULL DEFAULT 0,
+		max_storage_gb REAL NOT NULL DEFAULT 0,
+		max_gpus INTEGER NOT NULL DEFAULT 0,
+		max_gpu_memory_gb REAL NOT NULL DEFAULT 0,
+		note TEXT,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS server_settings (
+		name TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS tier_changes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		action TEXT NOT NULL,
+		version TEXT NOT NULL,
+		previous_version TEXT NOT NULL,
+		diff_json TEXT NOT NULL,
+		actor TEXT NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		changed_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS client_errors (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		client_id TEXT NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		source TEXT NOT NULL,
+		severity TEXT NOT NULL,
+		message TEXT NOT NULL,
+		count INTEGER NOT NULL DEFAULT 1,
+		details_json TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		key_hash TEXT NOT NULL UNIQUE,
+		prefix TEXT NOT NULL,
+		tenant TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		created_by TEXT NOT NULL DEFAULT '',
+		expires_at TIMESTAMP,
+		disabled_at TIMESTAMP,
+		disabled_by TEXT NOT NULL DEFAULT '',
+		replaced_by TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE TABLE IF NOT EXISTS api_key_revocations (
+		key_hash TEXT PRIMARY KEY,
+		fingerprint TEXT NOT NULL,
+		revoked_at TIMESTAMP NOT NULL,
+		revoked_by TEXT NOT NULL DEFAULT '',
+		note TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE TABLE IF NOT EXISTS admin_audit (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		actor TEXT NOT NULL,
+		method TEXT NOT NULL,
+		path TEXT NOT NULL,
+		query TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		payload TEXT NOT NULL DEFAULT '',
+		payload_truncated BOOLEAN NOT NULL DEFAULT 0,
+		status INTEGER NOT NULL DEFAULT 0,
+		result TEXT NOT NULL DEFAULT '',
+		started_at TIMESTAMP NOT NULL,
+		finished_at TIMESTAMP
+	);
+
 	CREATE INDEX IF NOT EXISTS idx_stats_client_time ON stats(client_id, timestamp DESC);
 	CREATE INDEX IF NOT EXISTS idx_clients_last_seen ON clients(last_seen);
 	CREATE INDEX IF NOT EXISTS idx_sticky_last_used ON sticky_assignments(last_used);
 	CREATE INDEX IF NOT EXISTS idx_sticky_client ON sticky_assignments(client_id);
 	CREATE INDEX IF NOT EXISTS idx_sticky_id ON sticky_assignments(sticky_id);
+	CREATE INDEX IF NOT EXISTS idx_client_errors_client_time ON client_errors(client_id, timestamp DESC);
+	CREATE INDEX IF NOT EXISTS idx_admin_audit_actor ON admin_audit(actor, id DESC);
 	`
 
-	_, err = db.Exec(schema)
-	return db, err
+	if _, err = db.Exec(schema); err != nil {
+		return db, err
+	}
+
+	return db, migrateDatabase(db)
+}
+
+// schemaMigrations lists columns added after the initial schema
+// Databases created by older versions get them via ALTER TABLE on startup
+var schemaMigrations = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"stats", "load_avg_1", "REAL DEFAULT 0"},
+	{"stats", "load_avg_5", "REAL DEFAULT 0"},
+	{"stats", "load_avg_15", "REAL DEFAULT 0"},
+	{"stats", "swap_total", "REAL DEFAULT 0"},
+	{"stats", "swap_used", "REAL DEFAULT 0"},
+	{"stats", "psi_json", "TEXT"},
+	{"clients", "hourly_cost", "REAL DEFAULT 0"},
+	{"clients", "tenant", "TEXT DEFAULT ''"},
+	{"clients", "asn", "INTEGER DEFAULT 0"},
+	{"clients", "asn_org", "TEXT DEFAULT ''"},
+	{"stats", "row_hmac", "TEXT"},
+	{"sticky_assignments", "row_hmac", "TEXT"},
+	{"clients", "pool", "TEXT DEFAULT ''"},
+	{"clients", "schema_version", "TEXT DEFAULT ''"},
+	{"clients", "gpu_compute_caps", "TEXT"},
+	{"clients", "endpoint_candidates", "TEXT"},
+	{"clients", "service_version", "TEXT DEFAULT ''"},
+	{"clients", "labels", "TEXT"},
+	{"clients", "report_interval_secs", "INTEGER DEFAULT 0"},
+	{"clients", "bandwidth", "TEXT"},
+	{"clients", "probe_stats_url", "TEXT DEFAULT ''"},
+	{"clients", "probe_stats_token", "TEXT DEFAULT ''"},
+	{"clients", "pending_approval", "INTEGER DEFAULT 0"},
+	{"clients", "approved_by", "TEXT DEFAULT ''"},
+}
+
+// migrateDatabase adds any missing columns listed in schemaMigrations
+func migrateDatabase(db *sql.DB) error {
+	for _, m := range schemaMigrations {
+		exists, err := columnExists(db, m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", m.table, m.column, err)
+		}
+	}
+	return nil
+}
+
+// columnExists checks whether a table already has the given column
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
 }
 
 func (s *Server) loadClients() error {
 	rows, err := s.db.Query(`
 		SELECT client_id, hostname, public_ip, local_ip, latitude, longitude, country, city,
-		       total_cpu, total_memory, total_storage, total_gpus, gpu_models, endpoint, last_seen
+		       total_cpu, total_memory, total_storage, total_gpus, gpu_models, endpoint, last_seen,
+		       hourly_cost, tenant, asn, asn_org, pool, schema_version, gpu_compute_caps, endpoint_candidates,
+		       service_version, labels, report_interval_secs, bandwidth, probe_stats_url, probe_stats_token,
+		       pending_approval, approved_by
 		FROM clients
 	`)
 	if err != nil {
@@ -569,12 +1309,19 @@ func (s *Server) loadClients() error {
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.invalidateRoutingSnapshot()
 
 	for rows.Next() {
 		var state ClientState
 		var lastSeen string
 		var localIP sql.NullString
 		var gpuModelsJSON sql.NullString
+		var gpuCapsJSON sql.NullString
+		var candidatesJSON sql.NullString
+		var labelsJSON sql.NullString
+		var bandwidthJSON sql.NullString
+		var pendingApproval sql.NullInt64
+		var approvedBy sql.NullString
 
 		err := rows.Scan(
 			&state.Registration.ClientID,
@@ -592,6 +1339,22 @@ func (s *Server) loadClients() error {
 			&gpuModelsJSON,
 			&state.Endpoint,
 			&lastSeen,
+			&state.Registration.HourlyCost,
+			&state.Registration.Tenant,
+			&state.ASN,
+			&state.ASNOrg,
+			&state.Registration.Pool,
+			&state.Registration.SchemaVersion,
+			&gpuCapsJSON,
+			&candidatesJSON,
+			&state.Registration.ServiceVersion,
+			&labelsJSON,
+			&state.Registration.ReportIntervalSecs,
+			&bandwidthJSON,
+			&state.Registration.ProbeStatsURL,
+			&state.Registration.ProbeStatsToken,
+			&pendingApproval,
+			&approvedBy,
 		)
 		if err != nil {
 			log.Printf("Error scanning client row: %v", err)
@@ -607,8 +1370,32 @@ func (s *Server) loadClients() error {
 				log.Printf("Warning: Failed to parse GPU models JSON for client %s: %v", state.Registration.ClientID, err)
 			}
 		}
+		if gpuCapsJSON.Valid && gpuCapsJSON.String != "" {
+			if err := json.Unmarshal([]byte(gpuCapsJSON.String), &state.Registration.GPUComputeCapabilities); err != nil {
+				log.Printf("Warning: Failed to parse GPU compute capabilities JSON for client %s: %v", state.Registration.ClientID, err)
+			}
+		}
+		if candidatesJSON.Valid && candidatesJSON.String != "" {
+			if err := json.Unmarshal([]byte(candidatesJSON.String), &state.EndpointCandidates); err != nil {
+				log.Printf("Warning: Failed to parse endpoint candidates JSON for client %s: %v", state.Registration.ClientID, err)
+			}
+		}
+		if labelsJSON.Valid && labelsJSON.String != "" {
+			if err := json.Unmarshal([]byte(labelsJSON.String), &state.Registration.Labels); err != nil {
+				log.Printf("Warning: Failed to parse labels JSON for client %s: %v", state.Registration.ClientID, err)
+			}
+		}
+		if bandwidthJSON.Valid && bandwidthJSON.String != "" {
+			if err := json.Unmarshal([]byte(bandwidthJSON.String), &state.Registration.Bandwidth); err != nil {
+				log.Printf("Warning: Failed to parse bandwidth JSON for client %s: %v", state.Registration.ClientID, err)
+			}
+		}
 
+		state.PendingApproval = pendingApproval.Int64 != 0
+		state.ApprovedBy = approvedBy.String
+		state.Registration.Tenant = normalizeTenant(state.Registration.Tenant)
 		state.LastSeen, _ = time.Parse("2006-01-02 15:04:05", lastSeen)
+		state.HourlyCost = s.effectiveHourlyCostLocked(state.Registration.ClientID, state.Registration.HourlyCost)
 		s.clientCache[state.Registration.ClientID] = &state
 	}
 
@@ -628,73 +1415,229 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Older agents are accepted with newer fields at their defaults; an unknown major would be misread
+	schemaVersion, err := common.NegotiateSchemaVersion(reg.SchemaVersion)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reg.SchemaVersion = schemaVersion
+
+	// Tenant API keys register into their own tenant only
+	keyTenant, scoped := tenantFromContext(r)
+	if scoped {
+		if reg.Tenant != "" && reg.Tenant != keyTenant {
+			http.Error(w, fmt.Sprintf("API key cannot register into tenant: %s", reg.Tenant), http.StatusForbidden)
+			return
+		}
+		reg.Tenant = keyTenant
+	}
+	reg.Tenant = normalizeTenant(reg.Tenant)
+	if !s.knownTenant(reg.Tenant) {
+		http.Error(w, fmt.Sprintf("Unknown tenant: %s", reg.Tenant), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateEndpointPort(reg.EndpointPort); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if reg.ReportIntervalSecs < 0 {
+		http.Error(w, "report_interval_seconds must not be negative", http.StatusBadRequest)
+		return
+	}
+	if err := validateProbeStatsURL(reg.ProbeStatsURL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var endpoint string
 	var endpoints []common.EndpointConfig
+	var candidates []string
 
 	if len(reg.Endpoints) > 0 {
 		endpoints = reg.Endpoints
 		endpoint = reg.Endpoints[0].URL
 	} else if reg.EndpointURL != "" {
 		endpoint = reg.EndpointURL
-	} else if reg.LocalIP != "" {
-		endpoint = fmt.Sprintf("http://%s:11000", reg.LocalIP)
 	} else {
-		endpoint = fmt.Sprintf("http://%s:11000", reg.PublicIP)
+		candidates = autoEndpoints(reg, s.endpointPort(reg))
+		endpoint = candidates[0]
 	}
 
+	// Upstream protocols must match their endpoint's scheme
+	if len(endpoints) == 0 {
+		if err := validateEndpointProtocol(reg.EndpointProtocol, endpoint); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	for _, ep := range endpoints {
+		if err := validateEndpointProtocol(ep.Protocol, ep.URL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Backend ASN for same-network routing preference
+	asn, asnOrg := s.backendASN(reg, endpoint)
+
+	// The approval token only vouches for this registration; it is not kept with the backend
+	autoApprovedBy := ""
+	if s.config.RegistrationApproval.Enabled {
+		if rule := s.autoApproveRule(reg, r); rule != "" {
+			autoApprovedBy = autoApprovedPrefix + rule
+		}
+	}
+	reg.ApprovalToken = ""
+
 	s.mu.Lock()
-	duplicateIDs := []string{}
-	for id, client := range s.clientCache {
-		if id != reg.ClientID && client.Endpoint == endpoint {
-			duplicateIDs = append(duplicateIDs, id)
+	s.invalidateRoutingSnapshot()
+	existing, known := s.clientCache[reg.ClientID]
+	if known && scoped && normalizeTenant(existing.Registration.Tenant) != reg.Tenant {
+		s.mu.Unlock()
+		http.Error(w, fmt.Sprintf("Client ID already registered to another tenant: %s", reg.ClientID), http.StatusConflict)
+		return
+	}
+
+	// A re-registering dual-stack backend keeps the address family its health checks found working
+	if known && len(candidates) > 1 && slices.Contains(candidates, existing.Endpoint) {
+		endpoint = existing.Endpoint
+	}
+
+	// Two live agents sharing a client_id would overwrite each other; the first one keeps it
+	if known && s.clientIDConflictLocked(existing, endpoint, reg.InstanceID) {
+		data, notify := s.duplicateIDConflictLocked(existing, reg, endpoint)
+		s.mu.Unlock()
+		s.rejectDuplicateClientID(w, data, notify)
+		return
+	}
+
+	// Backends sharing the endpoint: stale ones are replaced, live ones are handled by duplicate_endpoint_policy
+	duplicateIDs, livePeers := s.endpointPeersLocked(reg, endpoint)
+	var endpointConflict map[string]interface{}
+	var notifyConflict bool
+	if len(livePeers) > 0 {
+		policy := s.duplicateEndpointPolicy()
+		endpointConflict, notifyConflict = s.endpointConflictLocked(reg, endpoint, livePeers, policy)
+		switch policy {
+		case DuplicateEndpointPolicyReject:
+			s.mu.Unlock()
+			s.rejectDuplicateEndpoint(w, endpointConflict, notifyConflict)
+			return
+		case DuplicateEndpointPolicyReplace:
+			duplicateIDs = append(duplicateIDs, livePeers...)
 		}
 	}
 
+	var duplicateResult deregisterResult
 	for _, id := range duplicateIDs {
-		delete(s.clientCache, id)
+		s.removeClientStateLocked(id, &duplicateResult)
 		log.Printf("Removed duplicate client: %s (same endpoint=%s)", id, endpoint)
 	}
 
-	s.clientCache[reg.ClientID] = &ClientState{
+	client := &ClientState{
 		Registration: reg,
 		LastSeen:     time.Now(),
 		Endpoint:     endpoint,
 		Endpoints:    endpoints,
+		EndpointCandidates: candidates,
 		HealthStatus: "unknown",
+		HourlyCost:   s.effectiveHourlyCostLocked(reg.ClientID, reg.HourlyCost),
+		ASN:          asn,
+		ASNOrg:       asnOrg,
 	}
+
+	// With registration_approval, new backends wait for an admin unless a rule vouches for them.
+	// A re-registration keeps its state only from the agent that held it (same endpoint and instance);
+	// anything else taking over a stale client ID is held again
+	sameAgent := known && existing.Endpoint == endpoint && existing.Registration.InstanceID == reg.InstanceID
+	if sameAgent {
+		client.PendingApproval, client.ApprovedBy = existing.PendingApproval, existing.ApprovedBy
+	} else {
+		client.PendingApproval = s.config.RegistrationApproval.Enabled
+	}
+	var approvalEvent, approvalMessage string
+	switch {
+	case client.PendingApproval && autoApprovedBy != "":
+		client.PendingApproval, client.ApprovedBy = false, autoApprovedBy
+		approvalEvent, approvalMessage = "client.approved", "Registration auto-approved"
+	case client.PendingApproval && !sameAgent:
+		approvalEvent, approvalMessage = "client.pending_approval", "Registration held for approval"
+	}
+	var approvalData map[string]interface{}
+	if approvalEvent != "" {
+		approvalData = approvalEventData(client)
+	}
+
+	// New backends (or ones returning after going stale) start cold; a live agent re-registering keeps its warm-up state
+	registration := "new"
+	switch {
+	case !known:
+		s.startWarmupLocked(client, "registered")
+	case s.isStale(existing):
+		s.startWarmupLocked(client, "returned after going stale")
+		registration = "returned"
+	default:
+		client.WarmingSince = existing.WarmingSince
+		registration = "refreshed"
+	}
+	s.clientCache[reg.ClientID] = client
 	s.mu.Unlock()
+	s.routeCache.Invalidate(reg.ClientID)
+	s.events.Publish("client.registered", map[string]interface{}{
+		"client_id":    reg.ClientID,
+		"hostname":     reg.Hostname,
+		"endpoint":     endpoint,
+		"tenant":       reg.Tenant,
+		"registration": registration,
+	})
+	if approvalEvent != "" {
+		LogInfoWithData(approvalMessage, approvalData)
+		s.emit(approvalEvent, approvalData)
+	}
 
-	// Remove duplicates from database
+	if endpointConflict != nil {
+		s.reportEndpointConflict(endpointConflict, notifyConflict)
+	}
+
+	// Remove duplicates and their stats/sticky rows from database in the background
 	if len(duplicateIDs) > 0 {
-		for _, id := range duplicateIDs {
-			if _, err := s.db.Exec("DELETE FROM clients WHERE client_id = ?", id); err != nil {
-				log.Printf("Warning: Failed to delete duplicate client: %v", err)
-			}
-			if _, err := s.db.Exec("DELETE FROM stats WHERE client_id = ?", id); err != nil {
-				log.Printf("Warning: Failed to delete duplicate client stats: %v", err)
-			}
-		}
+		s.publishClientsRemoved(duplicateIDs, "duplicate endpoint")
 	}
+	s.scheduleDeregistration(duplicateIDs, "duplicate endpoint", duplicateResult)
 
 	// Persist to database
 	gpuModelsJSON, _ := json.Marshal(reg.GPUModels)
-	_, err := s.db.Exec(`
+	gpuCapsJSON, _ := json.Marshal(reg.GPUComputeCapabilities)
+	candidatesJSON, _ := json.Marshal(candidates)
+	labelsJSON, _ := json.Marshal(reg.Labels)
+	bandwidthJSON, _ := json.Marshal(reg.Bandwidth)
+	_, err = s.db.Exec(`
 		INSERT OR REPLACE INTO clients
 		(client_id, hostname, public_ip, local_ip, latitude, longitude, country, city,
-		 total_cpu, total_memory, total_storage, total_gpus, gpu_models, endpoint, last_seen)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		 total_cpu, total_memory, total_storage, total_gpus, gpu_models, endpoint, hourly_cost, tenant, asn, asn_org, pool,
+		 schema_version, gpu_compute_caps, endpoint_candidates, service_version, labels, report_interval_secs, bandwidth,
+		 probe_stats_url, probe_stats_token, pending_approval, approved_by, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
 	`, reg.ClientID, reg.Hostname, reg.PublicIP, reg.LocalIP, reg.Latitude, reg.Longitude,
 		reg.Country, reg.City, reg.TotalCPU, reg.TotalMemory, reg.TotalStorage,
-		reg.TotalGPUs, gpuModelsJSON, endpoint)
+		reg.TotalGPUs, gpuModelsJSON, endpoint, reg.HourlyCost, reg.Tenant, asn, asnOrg, reg.Pool, reg.SchemaVersion, gpuCapsJSON,
+		string(candidatesJSON), reg.ServiceVersion, string(labelsJSON), reg.ReportIntervalSecs, string(bandwidthJSON),
+		reg.ProbeStatsURL, reg.ProbeStatsToken, client.PendingApproval, client.ApprovedBy)
 
 	if err != nil {
 		log.Printf("Error persisting client registration: %v", err)
 	}
 
-	log.Printf("Client registered: %s (%s) PublicIP=%s LocalIP=%s (endpoint: %s)",
-		reg.ClientID, reg.Hostname, reg.PublicIP, reg.LocalIP, endpoint)
+	log.Printf("Client registered: %s (%s) PublicIP=%s LocalIP=%s (endpoint: %s, tenant: %s)",
+		reg.ClientID, reg.Hostname, reg.PublicIP, reg.LocalIP, endpoint, reg.Tenant)
+	status := "registered"
+	if s.awaitingApproval(client) {
+		status = "pending_approval"
+	}
 	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(map[string]string{"status": "registered"}); err != nil {
+	if err := json.NewEncoder(w).Encode(map[string]string{"status": status, "schema_version": reg.SchemaVersion}); err != nil {
 		log.Printf("Warning: Failed to encode registration response: %v", err)
 	}
 }
@@ -705,8 +1648,14 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
 	var stats common.ResourceStats
-	if err := json.NewDecoder(r.Body).Decode(&stats); err != nil {
+	if err := json.Unmarshal(body, &stats); err != nil {
 		http.Error(w, fmt.Sprintf("Invalid JSON body: %v. Expected ResourceStats format.", err), http.StatusBadRequest)
 		return
 	}
@@ -718,44 +1667,113 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.mu.Lock()
-	if client, ok := s.clientCache[stats.ClientID]; ok {
-		client.Stats = stats
-		client.LastSeen = time.Now()
+	s.invalidateRoutingSnapshot()
+	client, ok := s.clientCache[stats.ClientID]
+	if keyTenant, scoped := tenantFromContext(r); scoped && ok && normalizeTenant(client.Registration.Tenant) != keyTenant {
+		s.mu.Unlock()
+		http.Error(w, fmt.Sprintf("API key cannot report stats for client: %s", stats.ClientID), http.StatusForbidden)
+		return
+	}
+	if ok && stats.InstanceID != "" && client.Registration.InstanceID != "" && stats.InstanceID != client.Registration.InstanceID {
+		// Reports from an agent whose registration was rejected would overwrite the first agent's stats
+		s.mu.Unlock()
+		w.Header().Set(LBErrorCodeHeader, errCodeDuplicateClientID)
+		http.Error(w, fmt.Sprintf("Client ID %s is registered by another agent instance", stats.ClientID), http.StatusConflict)
+		return
+	}
+	if stats.Delta {
+		// Delta reports only apply on top of the exact report they were computed against
+		if !ok || client.Stats.Seq == 0 || stats.BaseSeq != client.Stats.Seq {
+			s.mu.Unlock()
+			http.Error(w, "Stats delta base mismatch, send a full snapshot", http.StatusConflict)
+			return
+		}
+		merged, err := mergeStatsDelta(client.Stats, body)
+		if err != nil {
+			s.mu.Unlock()
+			http.Error(w, fmt.Sprintf("Invalid stats delta: %v", err), http.StatusBadRequest)
+			return
+		}
+		stats = merged
 	}
-	s.mu.Unlock()
-
-	// Persist to database
-	cpuJSON, _ := json.Marshal(stats.CPUUsageAvg)
-	gpuJSON, _ := json.Marshal(stats.GPUs)
-	_, err := s.db.Exec(`
-		INSERT INTO stats
-		(client_id, timestamp, cpu_cores, cpu_usage_json, memory_total, memory_used,
-		 memory_avail, disk_total, disk_used, disk_avail, gpu_stats_json)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, stats.ClientID, stats.Timestamp, stats.CPUCores, cpuJSON,
-		stats.MemoryTotal, stats.MemoryUsed, stats.MemoryAvail,
-		stats.DiskTotal, stats.DiskUsed, stats.DiskAvail, gpuJSON)
 
+	// Deltas carry the schema version of their base, so it is checked on the merged report
+	schemaVersion, err := common.NegotiateSchemaVersion(stats.SchemaVersion)
 	if err != nil {
-		log.Printf("Error persisting stats: %v", err)
+		s.mu.Unlock()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	stats.SchemaVersion = schemaVersion
 
-	// Update last_seen in clients table
-	if _, err := s.db.Exec("UPDATE clients SET last_seen = CURRENT_TIMESTAMP WHERE client_id = ?", stats.ClientID); err != nil {
-		log.Printf("Warning: Failed to update client last_seen: %v", err)
+	// Invalid fields are corrected (or the report refused) before anything is stored; anomaly
+	// detection still sees what the agent sent
+	raw := stats
+	fieldErrors, rejected := s.checkStatsLocked(client, &stats, time.Now())
+	if rejected {
+		s.mu.Unlock()
+		writeStatsRejected(w, fieldErrors)
+		return
 	}
 
+	tenant := ""
+	if ok {
+		s.checkStatsAnomalyLocked(client, raw, time.Now())
+		client.Stats = stats
+		client.LastSeen = time.Now()
+		s.updateGPUFaultLocked(client, stats.GPUs, client.LastSeen)
+		tenant = client.Registration.Tenant
+	}
+	s.mu.Unlock()
+	s.routeCache.Invalidate(stats.ClientID)
+
+	// Forward to configured time-series databases (buffered, never blocks the agent)
+	s.exporters.Export(stats, tenant)
+	s.persistStats(stats)
+
 	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(map[string]string{"status": "received"}); err != nil {
+	if err := json.NewEncoder(w).Encode(common.StatsResponse{
+		Status:        "received",
+		StatsDelta:    common.StatsDeltaSupported,
+		SchemaVersion: stats.SchemaVersion,
+		FieldErrors:   fieldErrors,
+	}); err != nil {
 		log.Printf("Warning: Failed to encode stats response: %v", err)
 	}
 }
 
+// persistStats stores a stats report, batched by the stats writer when enabled
+func (s *Server) persistStats(stats common.ResourceStats) {
+	cpuJSON, _ := json.Marshal(stats.CPUUsageAvg)
+	gpuJSON, _ := json.Marshal(stats.GPUs)
+	var psiJSON []byte
+	if stats.PSI != nil {
+		psiJSON, _ = json.Marshal(stats.PSI)
+	}
+	row := []interface{}{stats.ClientID, stats.Timestamp, stats.CPUCores, cpuJSON,
+		stats.MemoryTotal, stats.MemoryUsed, stats.MemoryAvail,
+		stats.DiskTotal, stats.DiskUsed, stats.DiskAvail, gpuJSON,
+		stats.LoadAvg1, stats.LoadAvg5, stats.LoadAvg15,
+		stats.SwapTotal, stats.SwapUsed, psiJSON}
+
+	// Batched writes are acknowledged now; without batching (or with a full queue) write inline
+	if !s.statsWriter.Enqueue(stats.ClientID, row) {
+		// One transaction also updates last_seen and, when signing, signs the row with its id
+		if err := writeStatsBatch(s.db, s.dbSigningKey(), []statsWrite{{clientID: stats.ClientID, values: row}}); err != nil {
+			log.Printf("Error persisting stats: %v", err)
+		}
+	}
+}
+
 func (s *Server) handleRoute(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if s.rejectInMaintenance(w) {
+		return
+	}
 
 	var req common.RoutingRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -763,48 +1781,89 @@ func (s *Server) handleRoute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get tier spec from configured tiers
-	tierSpec, ok := s.tierSpecs[req.Tier]
+	if tenant := requestTenant(r); !s.knownTenant(tenant) {
+		http.Error(w, fmt.Sprintf("Unknown tenant: %s", tenant), http.StatusBadRequest)
+		return
+	}
+
+	// Routing rules can deny the request or rewrite its tier before placement
+	rule := s.matchRoutingRule(r, req.Tier, req.Path, req.ClientIP)
+	s.setRuleHeader(w, rule)
+	if rule.deny(w) {
+		return
+	}
+	req.Tier = rule.rewriteTier(req.Tier)
+
+	// Get tier spec from the current (or staged) tier set
+	tierSpec, tierVersion, ok := s.resolveTier(r, req.Tier)
 	if !ok {
 		http.Error(w, fmt.Sprintf("Unknown tier: %s", req.Tier), http.StatusBadRequest)
 		return
 	}
-
-	// Extract sticky ID from configured header or client IP
-	stickyID := ""
-	if s.stickyHeader != "" {
-		stickyID = r.Header.Get(s.stickyHeader)
+	// Version pins and preferences come from the request body, or the headers proxies would send
+	pinVersion, preferVersion := requestServiceVersions(r)
+	if req.ServiceVersion != "" {
+		pinVersion = req.ServiceVersion
 	}
-	// If no header value and sticky_by_ip enabled, use client IP
-	if stickyID == "" && s.stickyByIP {
-		stickyID = getClientIP(r)
+	if req.PreferServiceVersion != "" {
+		preferVersion = req.PreferServiceVersion
 	}
+	applyRequestServiceVersion(&tierSpec, pinVersion, preferVersion)
+	rule.apply(&tierSpec)
+
+	// Extract sticky ID from configured header or client IP (hashed when sticky_id_hash_key is set)
+	stickyID := s.requestStickyID(r)
 
 	// Resolve client coordinates
 	clientLat := req.ClientLat
 	clientLon := req.ClientLon
 
-	// If coordinates not provided, lookup IP location
-	if clientLat == 0 && clientLon == 0 && req.ClientIP != "" {
-		log.Printf("Client coordinates not provided, attempting GeoIP lookup for IP: %s", req.ClientIP)
-		clientLat, clientLon = s.lookupIPLocation(req.ClientIP)
-		if clientLat != 0 || clientLon != 0 {
-			log.Printf("Resolved IP %s to location: %.4f, %.4f", req.ClientIP, clientLat, clientLon)
-		} else {
-			log.Printf("GeoIP lookup failed for %s (returned 0,0) - distance will not be factored into routing", req.ClientIP)
+	// If coordinates not provided, lookup IP location (the same lookup yields the ASN)
+	needsLocation := clientLat == 0 && clientLon == 0
+	if req.ClientIP != "" && (needsLocation || s.config.GeoIP.PreferSameASN) {
+		if needsLocation {
+			log.Printf("Client coordinates not provided, attempting GeoIP lookup for IP: %s", req.ClientIP)
 		}
+		info, _ := s.lookupIP(req.ClientIP)
+		if needsLocation {
+			clientLat, clientLon = info.Latitude, info.Longitude
+			if clientLat != 0 || clientLon != 0 {
+				log.Printf("Resolved IP %s to location: %.4f, %.4f", req.ClientIP, clientLat, clientLon)
+			} else {
+				log.Printf("GeoIP lookup failed for %s (returned 0,0) - distance will not be factored into routing", req.ClientIP)
+			}
+		}
+		if s.config.GeoIP.PreferSameASN {
+			tierSpec.ClientASN = info.ASN
+		}
+	}
+
+	// Latency from the end user's nearest probe region replaces the load balancer's own measurements
+	s.applyVantageRegion(&tierSpec, clientLat, clientLon, req.ClientIP)
+
+	// Read shared sticky assignments once for the limit check and placement below
+	s.syncRequestStickyAssignments(stickyID, tierSpec)
+
+	// A new session must fit within the sticky ID's session limit
+	if !s.enforceStickyLimit(w, stickyID, req.Tier, tierSpec) {
+		return
 	}
 
 	// Generate unique request ID for resource tracking
 	requestID := fmt.Sprintf("%d-%s", time.Now().UnixNano(), stickyID)
 
 	// Select client with stickiness support and resource reservation
-	client := s.selectClientWithStickiness(stickyID, req.Tier, tierSpec, clientLat, clientLon, requestID)
+	client, outcome := s.selectClientWithStickyPolicy(stickyID, req.Tier, tierSpec, clientLat, clientLon, requestID)
+	if !writeStickyOutcome(w, tierSpec, outcome) {
+		return
+	}
 	if client == nil {
-		http.Error(w, "No available clients with sufficient resources", http.StatusServiceUnavailable)
+		s.writeNoBackend(w, tierSpec, clientLat, clientLon, "No available clients with sufficient resources")
 		return
 	}
 
+	annotateAccessLog(r, req.Tier, tierVersion, client.Registration.ClientID)
+
 	distance := 0.0
 	if clientLat != 0 && clientLon != 0 &&
 	   client.Registration.Latitude != 0 && client.Registration.Longitude != 0 {
@@ -815,89 +1874,104 @@ func (s *Server) handleRoute(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := common.RoutingResponse{
-		ClientID: client.Registration.ClientID,
-		Endpoint: client.Endpoint,
-		Hostname: client.Registration.Hostname,
-		Distance: distance,
+		ClientID:        client.Registration.ClientID,
+		Endpoint:        client.Endpoint,
+		Hostname:        client.Registration.Hostname,
+		Distance:        distance,
+		TierVersion:     tierVersion,
+		SuggestedCPUSet: s.suggestedCPUSet(client, tierSpec, requestID),
+		SuggestedGPUs:   s.suggestedGPUs(client, tierSpec, requestID),
+		ServiceVersion:  client.Registration.ServiceVersion,
+	}
+	if lease, ok := s.requestLease(client, requestID); ok {
+		response.LeaseID = lease.LeaseID
+		response.LeaseTTLSecs = leaseTTLSecs(lease, time.Now())
 	}
 
 	LogInfoWithData("Routed request", map[string]interface{}{
-		"tier":      req.Tier,
-		"client_id": client.Registration.ClientID,
-		"hostname":  client.Registration.Hostname,
-		"distance":  fmt.Sprintf("%.0f km", distance),
-		"sticky_id": stickyID,
+		"tier":         req.Tier,
+		"tier_version": tierVersion,
+		"tenant":       tierSpec.Tenant,
+		"client_id":    client.Registration.ClientID,
+		"hostname":     client.Registration.Hostname,
+		"distance":     fmt.Sprintf("%.0f km", distance),
+		"sticky_id":    stickyID,
+		"cpuset":       response.SuggestedCPUSet,
+		"gpus":         response.SuggestedGPUs,
+		"lease_id":     response.LeaseID,
 	})
 
+	s.observeSLO(sloKindRoute, start)
+
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(TierVersionHeader, tierVersion)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Printf("Warning: Failed to encode routing response: %v", err)
 	}
 }
 
+// findBestClient scores the routing snapshot and returns the best backend that still fits live
 func (s *Server) findBestClient(tier common.TierSpec, clientLat, clientLon float64) *ClientState {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	snapshot := s.routingSnapshot()
+	now := time.Now()
 
-	var bestClient *ClientState
-	bestScore := math.Inf(1)
+	// Backends ready for placement, then warming backends held back by the slow-start ramp (used only
+	// when nothing else fits), then backends outside the tier's latency budget (used only with allow_degraded)
+	var ready, warming, degraded []scoredBackend
 
-	for _, client := range s.clientCache {
-		// Skip stale clients
-		if time.Since(client.LastSeen) > s.staleTimeout {
+	for _, backend := range snapshot.backends {
+		client := backend.client
+		if tier.ExcludeClientID != "" && client.Registration.ClientID == tier.ExcludeClientID {
 			continue
 		}
 
-		// Skip unhealthy clients (if health checks enabled)
-		if s.config.HealthCheckEnabled && client.HealthStatus == "unhealthy" {
-			continue
-		}
-
-		// Check if client has sufficient resources (lock already held)
-		if !s.hasResourcesLocked(client, tier) {
+		// Skip stale, unhealthy and full backends (indexed pending reservations included; the winner is confirmed live)
+		if !s.fitsSnapshot(backend, tier) {
 			continue
 		}
 
 		// Calculate score (lower is better)
-		// Score = distance_km + (cpu_usage_penalty * 100) + (memory_usage_penalty * 100)
-		distance := 0.0
 		// Only calculate distance if both client and backend have valid geolocation
-		if clientLat != 0 && clientLon != 0 &&
-		   client.Registration.Latitude != 0 && client.Registration.Longitude != 0 {
-			distance = haversineDistance(
-				clientLat, clientLon,
-				client.Registration.Latitude, client.Registration.Longitude,
-			)
-		}
-
-		// Calculate CPU usage for the cores that would be allocated
-		// Use the N least-loaded cores (where N = tier.VCPU)
-		avgCPU := s.calculateAllocatedCoresUsage(client.Stats.CPUUsageAvg, tier.VCPU)
-
-		memoryUsagePct := (client.Stats.MemoryUsed / client.Stats.MemoryTotal) * 100
-
-		// Calculate GPU utilization if tier requires GPUs
-		gpuUtilPct := 0.0
-		if tier.GPU > 0 && len(client.Stats.GPUs) > 0 {
-			totalUtil := 0.0
-			for _, gpu := range client.Stats.GPUs {
-				totalUtil += gpu.UtilizationPct
+		distance := backendDistance(client, clientLat, clientLon)
+		score := s.placementScore(client, tier, distance)
+
+		// Backends outside the latency budget never win over one within it
+		if !withinLatencyBudget(client, tier, distance) {
+			if tier.AllowDegraded {
+				degraded = append(degraded, scoredBackend{client: client, score: score})
 			}
-			gpuUtilPct = totalUtil / float64(len(client.Stats.GPUs))
+			continue
 		}
 
-		// Weighted score: distance (km) + CPU penalty + memory penalty + GPU penalty + latency
-		// GPU gets higher weight (1.5) as GPU workloads are more sensitive to contention
-		// Latency adds milliseconds directly to score (e.g., 50ms latency = +50 to score)
-		score := distance + (avgCPU * 1.0) + (memoryUsagePct * 1.0) + (gpuUtilPct * 1.5) + client.LatencyMs
+		// Warming backends take a fading score penalty, or only a growing share of placements in ramp mode
+		warmup := s.warmupProgress(client, now)
+		score += s.warmupPenalty(warmup)
+		if !s.warmupAdmit(warmup) {
+			warming = append(warming, scoredBackend{client: client, score: score})
+			continue
+		}
 
-		if score < bestScore {
-			bestScore = score
-			bestClient = client
+		ready = append(ready, scoredBackend{client: client, score: score})
+	}
+
+	for _, candidates := range [][]scoredBackend{ready, warming} {
+		sortCandidates(candidates)
+		if client := s.firstLiveFit(candidates, tier, true); client != nil {
+			return client
 		}
 	}
 
-	return bestClient
+	sortCandidates(degraded)
+	if degradedClient := s.firstLiveFit(degraded, tier, true); degradedClient != nil {
+		LogWarnWithData("No backend within latency budget, placing degraded", map[string]interface{}{
+			"tier":       tier.Name,
+			"client_id":  degradedClient.Registration.ClientID,
+			"latency_ms": fmt.Sprintf("%.1f", backendLatency(degradedClient, tier)),
+		})
+		return degradedClient
+	}
+
+	return nil
 }
 
 func (s *Server) hasResources(client *ClientState, tier common.TierSpec) bool {
@@ -908,68 +1982,124 @@ func (s *Server) hasResources(client *ClientState, tier common.TierSpec) bool {
 
 // hasResourcesLocked checks resource availability with lock already held
 func (s *Server) hasResourcesLocked(client *ClientState, tier common.TierSpec) bool {
-	// Calculate pending resource reservations for this client
-	pendingList := s.pendingAllocations[client.Registration.ClientID]
+	// Backends reporting max_sessions on their health endpoint take no more sessions than that
+	if s.sessionsFullLocked(client) {
+		return false
+	}
+
+	// Start from reported availability after admin reservations and capacity overrides,
+	// with memory counted the way the tier defines "available", minus pending reservations
+	return s.fitsTier(client, tier, s.tierHeadroomLocked(client, tier), s.pendingReservationLocked(client.Registration.ClientID))
+}
 
-	// Sum up pending allocations
-	var pendingVCPU int
-	var pendingMemoryGB float64
-	var pendingStorageGB int
-	var pendingGPUs int
-	var pendingGPUMemoryGB float64
+// fitsTier checks a backend against a tier given its headroom and the resources reserved by pending allocations
+// Reads nothing guarded by s.mu, so the routing snapshot can call it without the lock
+func (s *Server) fitsTier(client *ClientState, tier common.TierSpec, headroom backendHeadroom, pending pendingReservation) bool {
+	// Routing never crosses tenants
+	if normalizeTenant(client.Registration.Tenant) != normalizeTenant(tier.Tenant) {
+		return false
+	}
 
-	for _, pending := range pendingList {
-		pendingVCPU += pending.TierSpec.VCPU
-		pendingMemoryGB += pending.TierSpec.MemoryGB
-		pendingStorageGB += pending.TierSpec.StorageGB
-		pendingGPUs += pending.TierSpec.GPU
-		pendingGPUMemoryGB += pending.TierSpec.GPUMemoryGB
+	// Routing rules can pin a placement to one backend pool
+	if tier.Pool != "" && client.Registration.Pool != tier.Pool {
+		return false
 	}
 
-	// Count available CPU cores (cores with <80% usage)
-	availableCores := 0
-	for _, usage := range client.Stats.CPUUsageAvg {
-		if usage < 80.0 {
-			availableCores++
-		}
+	// Blue/green rollouts can pin placements to one backend software version
+	if !serviceVersionAllowed(client, tier) {
+		return false
+	}
+
+	pendingVCPU := pending.VCPU
+	pendingMemoryGB := pending.MemoryGB
+	pendingStorageGB := pending.StorageGB
+	pendingGPUMemoryGB := pending.GPUMemoryGB
+
+	// Veto backends under sustained pressure stalls (hidden by per-core usage averages)
+	if s.isUnderPressure(client) {
+		return false
 	}
 
-	// Subtract pending CPU allocations
-	availableCores -= pendingVCPU
+	// Veto backends out of file descriptors or ports: they have CPU to spare but cannot accept connections
+	if s.isSocketExhausted(client) {
+		return false
+	}
+
+	// Skip backends ejected for failing proxied requests, or whose circuit is open
+	if s.outliers.Ejected(client.Registration.ClientID) || s.breakers.Open(client.Registration.ClientID) {
+		return false
+	}
 
-	// Check CPU availability
+	// Bogus stats would otherwise win the score; skip the backend until its reports look sane again
+	if client.StatsQuarantine(time.Now()) != "" {
+		return false
+	}
+
+	// A backend holding max_pending_per_backend in-flight placements takes no more until some complete
+	if s.config.MaxPendingPerBackend > 0 && pending.allocations >= s.config.MaxPendingPerBackend {
+		return false
+	}
+
+	// Check CPU availability (cores with <80% usage, minus pending CPU allocations)
+	availableCores := headroom.VCPU - pendingVCPU
 	if availableCores < tier.VCPU {
 		return false
 	}
 
 	// Check memory availability (account for pending allocations)
-	availableMemory := client.Stats.MemoryAvail - pendingMemoryGB
+	availableMemory := headroom.MemoryGB - pendingMemoryGB
 	if availableMemory < tier.MemoryGB {
 		return false
 	}
 
 	// Check disk availability (account for pending allocations)
-	availableDisk := client.Stats.DiskAvail - float64(pendingStorageGB)
+	availableDisk := headroom.StorageGB - float64(pendingStorageGB)
 	if availableDisk < float64(tier.StorageGB) {
 		return false
 	}
 
+	// I/O-heavy tiers skip backends whose disk is saturated even when space is free
+	if tier.MinDiskMBps > 0 {
+		if spare, ok := spareDiskMBps(client.Stats.DiskIO); ok && spare < tier.MinDiskMBps {
+			return false
+		}
+	}
+
+	// Data-heavy tiers skip backends whose link measured slow at registration (untested backends qualify)
+	if tier.MinBandwidthMbps > 0 {
+		if mbps, ok := backendBandwidthMbps(client.Registration); ok && mbps < tier.MinBandwidthMbps {
+			return false
+		}
+	}
+
 	// Check GPU availability if tier requires GPUs
 	if tier.GPU > 0 {
-		// Check GPU count
-		availableGPUs := client.Registration.TotalGPUs - pendingGPUs
-		if availableGPUs < tier.GPU {
+		// Skip backends with critical GPU faults (CPU tiers are unaffected)
+		if client.GPUFault(time.Now()) != "" {
 			return false
 		}
 
-		// Check GPU memory if specified
-		if tier.GPUMemoryGB > 0 && len(client.Stats.GPUs) > 0 {
-			totalAvailableVRAM := 0.0
-			for _, gpu := range client.Stats.GPUs {
-				availableVRAM := gpu.MemoryTotalGB - gpu.MemoryUsedGB
-				totalAvailableVRAM += availableVRAM
+		// Tiers can require specific GPU models or architectures, not just enough VRAM
+		if !gpuRequirementsMet(client.Registration, tier) {
+			return false
+		}
+
+		// Fractional tiers need one device with enough share and VRAM left; shares are never split across devices
+		if fractionalGPU(tier) {
+			if gpuSharesAvailable(client, tier, headroom, pending) == 0 {
+				return false
+			}
+		} else {
+			// Whole GPUs: devices holding any pending share are not free
+			availableGPUs := float64(headroom.GPUs) - busyGPUDevices(pending)
+			if availableGPUs < tier.GPU {
+				return false
 			}
-			totalAvailableVRAM -= pendingGPUMemoryGB
+		}
+
+		// Check GPU memory if specified (admin VRAM reservations and ceilings apply to fractional tiers too)
+		if tier.GPUMemoryGB > 0 && len(client.Stats.GPUs) > 0 {
+			totalAvailableVRAM := headroom.GPUMemoryGB - pendingGPUMemoryGB
 
 			if totalAvailableVRAM < tier.GPUMemoryGB {
 				return false
@@ -980,6 +2110,119 @@ func (s *Server) hasResourcesLocked(client *ClientState, tier common.TierSpec) b
 	return true
 }
 
+// placementScore scores a backend for a tier (lower is better), before any warm-up penalty
+// Score = distance_km + CPU usage % + memory usage % + 1.5 * GPU utilization % + latency_ms + cost penalty - same-ASN bonus
+func (s *Server) placementScore(client *ClientState, tier common.TierSpec, distance float64) float64 {
+	// Calculate CPU usage for the cores that would be allocated
+	// Use the N least-loaded cores (where N = tier.VCPU), over the CPU window the tier routes on
+	avgCPU := s.calculateAllocatedCoresUsage(tierCPUUsage(client.Stats, tier.CPUWindow), tier.VCPU)
+
+	memoryUsagePct := (client.Stats.MemoryUsed / client.Stats.MemoryTotal) * 100
+
+	// Calculate GPU utilization if tier requires GPUs
+	gpuUtilPct := 0.0
+	if tier.GPU > 0 && len(client.Stats.GPUs) > 0 {
+		totalUtil := 0.0
+		for _, gpu := range client.Stats.GPUs {
+			totalUtil += gpu.UtilizationPct
+		}
+		gpuUtilPct = totalUtil / float64(len(client.Stats.GPUs))
+	}
+
+	// Weighted score: distance (km) + CPU penalty + memory penalty + GPU penalty + latency
+	// GPU gets higher weight (1.5) as GPU workloads are more sensitive to contention
+	// Latency adds milliseconds directly to score (e.g., 50ms latency = +50 to score)
+	// Latency is taken from the end user's nearest probe region when one has measured this backend
+	score := distance + (avgCPU * 1.0) + (memoryUsagePct * 1.0) + (gpuUtilPct * 1.5) + backendLatency(client, tier)
+
+	// Cost penalty prefers cheaper backends when performance is otherwise equivalent
+	score += client.HourlyCost * s.config.CostWeight
+
+	// Proxied requests in flight show load the latest stats report can't have seen yet
+	score += s.concurrency.ScorePenalty(client.Registration.ClientID)
+
+	// Same-network bonus keeps traffic inside the client's ASN when prefer_same_asn is on
+	if tier.ClientASN != 0 && client.ASN == tier.ClientASN {
+		score -= s.config.GeoIP.SameASNBonus
+	}
+
+	// Hot or throttling CPUs deliver less than their usage suggests
+	if s.isThermallyThrottled(client) {
+		score += s.config.ThermalThrottlePenalty
+	}
+
+	// Routing rules can prefer a backend pool without excluding the others
+	if tier.PreferPool != "" && client.Registration.Pool == tier.PreferPool {
+		score -= tier.PoolBonus
+	}
+
+	// Requests and rules can prefer a backend software version without excluding the others
+	score -= serviceVersionBonus(client, tier)
+
+	// Backends reporting degradation or many sessions on their own health endpoint (http-json) rank lower
+	score += s.healthReportPenalty(client)
+
+	// Time-window schedules shift a backend's weight, e.g. office backends during business hours
+	score += s.schedules.Penalty(client, time.Now())
+
+	return score
+}
+
+// pendingReservationLocked sums the resources reserved by a client's pending allocations
+func (s *Server) pendingReservationLocked(clientID string) pendingReservation {
+	total, _ := reservationTotals(s.pendingAllocations[clientID], time.Now())
+	return total
+}
+
+// isUnderPressure reports whether a client's PSI exceeds any configured veto threshold
+func (s *Server) isUnderPressure(client *ClientState) bool {
+	psi := client.Stats.PSI
+	if psi == nil {
+		return false
+	}
+
+	if s.config.PSICPUVetoPct > 0 && psi.CPUSomeAvg10 >= s.config.PSICPUVetoPct {
+		return true
+	}
+	if s.config.PSIMemoryVetoPct > 0 && psi.MemorySomeAvg10 >= s.config.PSIMemoryVetoPct {
+		return true
+	}
+	if s.config.PSIIOVetoPct > 0 && psi.IOSomeAvg10 >= s.config.PSIIOVetoPct {
+		return true
+	}
+	return false
+}
+
+// isSocketExhausted reports whether a client's file descriptor, ephemeral port or TCP socket usage
+// exceeds a configured veto threshold
+func (s *Server) isSocketExhausted(client *ClientState) bool {
+	sockets := client.Stats.Sockets
+	if sockets == nil {
+		return false
+	}
+
+	if s.config.FDVetoPct > 0 && sockets.FDUsagePct() >= s.config.FDVetoPct {
+		return true
+	}
+	if s.config.EphemeralPortVetoPct > 0 && sockets.EphemeralPortUsagePct() >= s.config.EphemeralPortVetoPct {
+		return true
+	}
+	return s.config.TCPConnectionsVeto > 0 && sockets.TCPConnections >= s.config.TCPConnectionsVeto
+}
+
+// isThermallyThrottled reports whether a client's CPUs are throttling or above the temperature threshold
+func (s *Server) isThermallyThrottled(client *ClientState) bool {
+	thermal := client.Stats.Thermal
+	if thermal == nil || s.config.ThermalThrottlePenalty <= 0 {
+		return false
+	}
+
+	if thermal.CPUThrottling {
+		return true
+	}
+	return s.config.CPUTempPenaltyC > 0 && thermal.CPUTempC >= s.config.CPUTempPenaltyC
+}
+
 // calculateAllocatedCoresUsage calculates the average CPU usage of the N least-loaded cores
 // This represents the actual load the new session would experience
 func (s *Server) calculateAllocatedCoresUsage(cpuUsageAvg []float64, vcpuRequired int) float64 {
@@ -996,23 +2239,11 @@ func (s *Server) calculateAllocatedCoresUsage(cpuUsageAvg []float64, vcpuRequire
 		return sum / float64(len(cpuUsageAvg))
 	}
 
-	// Copy and sort cores by usage (ascending)
-	sortedCores := make([]float64, len(cpuUsageAvg))
-	copy(sortedCores, cpuUsageAvg)
-
-	// Simple bubble sort (efficient for small arrays)
-	for i := 0; i < len(sortedCores); i++ {
-		for j := i + 1; j < len(sortedCores); j++ {
-			if sortedCores[i] > sortedCores[j] {
-				sortedCores[i], sortedCores[j] = sortedCores[j], sortedCores[i]
-			}
-		}
-	}
-
 	// Calculate average of the N least-loaded cores
+	sortedCores := leastLoadedCores(cpuUsageAvg)
 	sum := 0.0
 	for i := 0; i < vcpuRequired; i++ {
-		sum += sortedCores[i]
+		sum += cpuUsageAvg[sortedCores[i]]
 	}
 
 	return sum / float64(vcpuRequired)
@@ -1023,7 +2254,7 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	totalClients := len(s.clientCache)
 	activeClients := 0
 	for _, client := range s.clientCache {
-		if time.Since(client.LastSeen) <= s.staleTimeout {
+		if !s.isStale(client) {
 			activeClients++
 		}
 	}
@@ -1034,6 +2265,16 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		Timestamp:     time.Now(),
 		TotalClients:  totalClients,
 		ActiveClients: activeClients,
+		DegradedTiers: s.degradedTiers(),
+	}
+	s.setPendingCounts(&response)
+	// Still 200: the load balancer itself works, but some tiers are short of capacity
+	if len(response.DegradedTiers) > 0 {
+		response.Status = "degraded"
+	}
+	if s.inMaintenance() {
+		response.Status = "maintenance"
+		response.Maintenance = true
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1046,15 +2287,45 @@ func (s *Server) handleListClients(w http.ResponseWriter, r *http.Request) {
 	// Check for active_only query parameter
 	activeOnly := r.URL.Query().Get("active_only") == "true"
 
+	// Tenant API keys only see their own backends; global keys may filter with ?tenant=
+	tenantFilter, scoped := tenantFromContext(r)
+	if !scoped {
+		tenantFilter = r.URL.Query().Get("tenant")
+	}
+
+	query, err := s.parseClientListQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Later pages of a paginated listing come from the snapshot taken for its first page
+	if query.snapshot != "" {
+		entries, ok := s.clientSnapshots.Get(query.snapshot, tenantFilter, scoped)
+		if !ok {
+			http.Error(w, "Unknown or expired snapshot, start again from page 1", http.StatusGone)
+			return
+		}
+		writeClientPage(w, r, entries, query.snapshot, query.page, query.perPage)
+		return
+	}
+
 	s.mu.RLock()
-	clients := make([]map[string]interface{}, 0, len(s.clientCache))
+	items := make([]clientListItem, 0, len(s.clientCache))
 	for _, client := range s.clientCache {
-		isActive := time.Since(client.LastSeen) <= s.staleTimeout
+		if tenantFilter != "" && normalizeTenant(client.Registration.Tenant) != tenantFilter {
+			continue
+		}
+
+		isActive := !s.isStale(client)
 
 		// Skip inactive clients if active_only is set
 		if activeOnly && !isActive {
 			continue
 		}
+		if !query.matchLocked(s, client, isActive) {
+			continue
+		}
 
 		// Format per-core CPU usage
 		cpuUsage := make([]string, len(client.Stats.CPUUsageAvg))
@@ -1075,11 +2346,21 @@ func (s *Server) handleListClients(w http.ResponseWriter, r *http.Request) {
 			if gpu.PowerDrawW > 0 {
 				gpuInfo["power_draw"] = fmt.Sprintf("%.0fW", gpu.PowerDrawW)
 			}
+			if gpu.ECCErrorsCorrected > 0 || gpu.ECCErrorsUncorrected > 0 {
+				gpuInfo["ecc_errors"] = fmt.Sprintf("%d corrected, %d uncorrected", gpu.ECCErrorsCorrected, gpu.ECCErrorsUncorrected)
+			}
+			if gpu.ThermalThrottling || gpu.PowerThrottling {
+				gpuInfo["throttling"] = map[string]bool{"thermal": gpu.ThermalThrottling, "power": gpu.PowerThrottling}
+			}
+			if len(gpu.RecentXIDs) > 0 {
+				gpuInfo["recent_xids"] = gpu.RecentXIDs
+			}
 			gpuStats = append(gpuStats, gpuInfo)
 		}
 
 		clientInfo := map[string]interface{}{
 			"client_id":        client.Registration.ClientID,
+			"tenant":           normalizeTenant(client.Registration.Tenant),
 			"hostname":         client.Registration.Hostname,
 			"endpoint":         client.Endpoint,
 			"location":         fmt.Sprintf("%s, %s", client.Registration.City, client.Registration.Country),
@@ -1092,6 +2373,102 @@ func (s *Server) handleListClients(w http.ResponseWriter, r *http.Request) {
 			"health_status":    client.HealthStatus,
 			"latency_ms":       fmt.Sprintf("%.1f", client.LatencyMs),
 			"last_health_check": client.LastHealthCheck.Format(time.RFC3339),
+			"load_avg":         fmt.Sprintf("%.2f/%.2f/%.2f", client.Stats.LoadAvg1, client.Stats.LoadAvg5, client.Stats.LoadAvg15),
+			"swap_gb":          fmt.Sprintf("%.1f/%.1f", client.Stats.SwapUsed, client.Stats.SwapTotal),
+		}
+
+		if client.HealthReport != nil {
+			clientInfo["health_report"] = client.HealthReport
+		}
+
+		if client.HourlyCost > 0 {
+			clientInfo["hourly_cost"] = client.HourlyCost
+		}
+
+		if client.Registration.Pool != "" {
+			clientInfo["pool"] = client.Registration.Pool
+		}
+
+		if client.Registration.ServiceVersion != "" {
+			clientInfo["service_version"] = client.Registration.ServiceVersion
+		}
+
+		if len(client.Registration.Labels) > 0 {
+			clientInfo["labels"] = client.Registration.Labels
+		}
+
+		if client.Registration.ReportIntervalSecs > 0 {
+			clientInfo["report_interval_seconds"] = client.Registration.ReportIntervalSecs
+		}
+		clientInfo["stale_after"] = s.staleTimeoutFor(client).String()
+
+		if len(client.Registration.Bandwidth) > 0 {
+			clientInfo["bandwidth"] = client.Registration.Bandwidth
+		}
+
+		if len(client.VantageLatencies) > 0 {
+			vantage := make(map[string]interface{}, len(client.VantageLatencies))
+			for region, measured := range client.VantageLatencies {
+				entry := map[string]interface{}{
+					"latency_ms":  fmt.Sprintf("%.1f", measured.LatencyMs),
+					"measured_at": measured.MeasuredAt.Format(time.RFC3339),
+				}
+				if measured.Error != "" {
+					entry["error"] = measured.Error
+				}
+				vantage[region] = entry
+			}
+			clientInfo["vantage_latency"] = vantage
+		}
+
+		if client.AddressFamily != "" {
+			clientInfo["address_family"] = client.AddressFamily
+		}
+		if len(client.EndpointCandidates) > 1 {
+			clientInfo["endpoint_candidates"] = client.EndpointCandidates
+		}
+
+		// Negotiated payload schema (registrations stored before versioning count as legacy)
+		clientInfo["schema_version"] = client.Registration.SchemaVersion
+		if client.Registration.SchemaVersion == "" {
+			clientInfo["schema_version"] = common.LegacySchemaVersion
+		}
+
+		if client.ASN != 0 {
+			clientInfo["asn"] = client.ASN
+			clientInfo["asn_org"] = client.ASNOrg
+		}
+
+		// Add pressure stall info if the backend reports it
+		if client.Stats.PSI != nil {
+			clientInfo["psi"] = client.Stats.PSI
+		}
+
+		// Add CPU temperature, fan and power telemetry if the backend reports it
+		if client.Stats.Memory != nil {
+			clientInfo["memory_breakdown"] = client.Stats.Memory
+		}
+
+		if client.Stats.Thermal != nil {
+			clientInfo["thermal"] = client.Stats.Thermal
+		}
+
+		// Add file descriptor and socket usage if the backend reports it
+		if client.Stats.Sockets != nil {
+			clientInfo["sockets"] = client.Stats.Sockets
+			if s.isSocketExhausted(client) {
+				clientInfo["socket_exhausted"] = true
+			}
+		}
+
+		// Add disk throughput, IOPS and queue depth if the backend reports it
+		if len(client.Stats.DiskIO) > 0 {
+			clientInfo["disk_io"] = client.Stats.DiskIO
+		}
+
+		// Add the containers or VMs consuming the host's capacity if the agent enumerates them
+		if client.Stats.Inventory != nil {
+			clientInfo["inventory"] = client.Stats.Inventory
 		}
 
 		// Add GPU fields if client has GPUs
@@ -1101,74 +2478,85 @@ func (s *Server) handleListClients(w http.ResponseWriter, r *http.Request) {
 			if len(gpuStats) > 0 {
 				clientInfo["gpu_stats"] = gpuStats
 			}
+			if fault := client.GPUFault(time.Now()); fault != "" {
+				clientInfo["gpu_fault"] = fault
+			}
 		}
 
-		clients = append(clients, clientInfo)
-	}
-	s.mu.RUnlock()
+		if s.outliers != nil {
+			clientInfo["outlier"] = s.outliers.Status(client.Registration.ClientID)
+		}
+		if s.breakers != nil {
+			clientInfo["circuit"] = s.breakers.Status(client.Registration.ClientID)
+		}
+		if s.concurrency != nil {
+			clientInfo["concurrency"] = s.concurrency.Status(client.Registration.ClientID)
+		}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(clients); err != nil {
-		log.Printf("Warning: Failed to encode clients list response: %v", err)
-	}
-}
+		if uploads, ok := s.uploads.Status(client.Registration.ClientID); ok {
+			clientInfo["uploads"] = uploads
+		}
 
-func (s *Server) handlePurgeStaleClients(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+		if reason := client.StatsQuarantine(time.Now()); reason != "" {
+			clientInfo["stats_anomaly"] = reason
+			clientInfo["stats_quarantined_until"] = client.StatsAnomalyUntil.Format(time.RFC3339)
+		}
 
-	s.mu.Lock()
-	purged := 0
-	staleIDs := []string{}
+		if client.BadStatsReports > 0 {
+			clientInfo["bad_stats"] = map[string]interface{}{
+				"reports":      client.BadStatsReports,
+				"last_at":      client.BadStatsAt.Format(time.RFC3339),
+				"field_errors": client.BadStatsErrors,
+			}
+		}
 
-	// Find and remove stale clients from cache
-	for id, client := range s.clientCache {
-		if time.Since(client.LastSeen) > s.staleTimeout {
-			staleIDs = append(staleIDs, id)
-			delete(s.clientCache, id)
-			purged++
+		if warmup := s.warmupStatus(client, time.Now()); warmup != "" {
+			clientInfo["warming_up"] = warmup
 		}
-	}
-	s.mu.Unlock()
 
-	// Remove from database
-	for _, id := range staleIDs {
-		if _, err := s.db.Exec("DELETE FROM clients WHERE client_id = ?", id); err != nil {
-			log.Printf("Warning: Failed to delete stale client: %v", err)
+		if schedules := s.schedules.Active(client, time.Now()); len(schedules) > 0 {
+			clientInfo["active_schedules"] = schedules
 		}
-		if _, err := s.db.Exec("DELETE FROM stats WHERE client_id = ?", id); err != nil {
-			log.Printf("Warning: Failed to delete stale client stats: %v", err)
+
+		if s.awaitingApproval(client) {
+			clientInfo["pending_approval"] = true
+		} else if client.ApprovedBy != "" {
+			clientInfo["approved_by"] = client.ApprovedBy
 		}
-	}
 
-	// Also purge invalid/old clients
-	result, err := s.db.Exec(`
-		DELETE FROM clients
-		WHERE last_seen IS NULL
-		   OR last_seen = ''
-		   OR last_seen < datetime('now', '-30 days')
-	`)
+		// Reported by the agent from its latest probe-back, distinct from health checks
+		if len(client.Stats.Reachability) > 0 {
+			clientInfo["reachability"] = client.Stats.Reachability
+			clientInfo["endpoint_unreachable"] = endpointUnreachable(client)
+		}
 
-	dbPurged := int64(0)
-	if err == nil {
-		dbPurged, _ = result.RowsAffected()
+		items = append(items, clientListItem{
+			clientID: client.Registration.ClientID,
+			load:     clientLoad(client),
+			lastSeen: client.LastSeen,
+			info:     clientInfo,
+		})
 	}
+	s.mu.RUnlock()
 
-	totalPurged := purged + int(dbPurged)
+	sortClientList(items, query.sort, query.desc)
+	clients := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		clients[i] = item.info
+	}
 
-	log.Printf("Purged %d stale clients (%d from cache, %d from database)", totalPurged, purged, dbPurged)
+	if query.paginated {
+		snapshotTenant := ""
+		if scoped {
+			snapshotTenant = tenantFilter
+		}
+		writeClientPage(w, r, clients, s.clientSnapshots.Put(snapshotTenant, clients), query.page, query.perPage)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":        "success",
-		"purged":        totalPurged,
-		"cache_purged":  purged,
-		"db_purged":     dbPurged,
-		"timestamp":     time.Now(),
-	}); err != nil {
-		log.Printf("Warning: Failed to encode purge response: %v", err)
+	if err := json.NewEncoder(w).Encode(clients); err != nil {
+		log.Printf("Warning: Failed to encode clients list response: %v", err)
 	}
 }
 
@@ -1184,11 +2572,13 @@ func (s *Server) handlePurgePendingAllocations(w http.ResponseWriter, r *http.Re
 		totalRemoved += len(allocations)
 		delete(s.pendingAllocations, clientID)
 	}
+	s.reservations.reset()
 	s.mu.Unlock()
 
 	LogInfoWithData("Manually purged all pending allocations", map[string]interface{}{
 		"removed": totalRemoved,
 	})
+	s.events.Publish("allocations.purged", map[string]interface{}{"removed": totalRemoved})
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]interface{}{
@@ -1207,6 +2597,7 @@ func (s *Server) cleanupStaleClients(ctx context.Context) {
 	LogInfoWithData("Cleanup goroutine started", map[string]interface{}{
 		"interval":         s.cleanupInterval.String(),
 		"stale_threshold":  (s.staleTimeout * 3).String(),
+		"stale_missed_reports": s.config.StaleMissedReports,
 	})
 
 	for {
@@ -1215,57 +2606,20 @@ func (s *Server) cleanupStaleClients(ctx context.Context) {
 			LogInfo("Cleanup goroutine stopping...")
 			return
 		case <-ticker.C:
-			s.mu.Lock()
-			staleIDs := []string{}
-			for id, client := range s.clientCache {
-				// Remove from cache if stale for 3x the timeout period
-				if time.Since(client.LastSeen) > s.staleTimeout*3 {
-					staleIDs = append(staleIDs, id)
-					delete(s.clientCache, id)
-				}
-			}
-			s.mu.Unlock()
-
-			// Also remove from database
-			if len(staleIDs) > 0 {
-				for _, id := range staleIDs {
-					if _, err := s.db.Exec("DELETE FROM clients WHERE client_id = ?", id); err != nil {
-						log.Printf("Warning: Failed to delete stale client: %v", err)
-					}
-					if _, err := s.db.Exec("DELETE FROM stats WHERE client_id = ?", id); err != nil {
-						log.Printf("Warning: Failed to delete stale client stats: %v", err)
-					}
-					LogInfoWithData("Purged stale client from database", map[string]interface{}{
-						"client_id": id,
-					})
-				}
-			}
+			// Remove clients stale for 3x their timeout period from cache and database,
+			// cascading to stats, sticky assignments and pending allocations
+			// Their database records are deleted by the janitor so a mass expiry doesn't delay the next tick
+			s.deregisterStaleClients(3, "stale", true)
 
 			// Purge clients with invalid timestamps (zero value)
-			s.purgeInvalidClients()
+			s.purgeInvalidClients(true)
 
 			// Cleanup stale pending allocations
 			s.cleanupStalePendingAllocations()
-		}
-	}
-}
-
-func (s *Server) purgeInvalidClients() {
-	// Remove clients with zero timestamp or very old data
-	result, err := s.db.Exec(`
-		DELETE FROM clients
-		WHERE last_seen IS NULL
-		   OR last_seen = ''
-		   OR last_seen < datetime('now', '-30 days')
-	`)
-	if err != nil {
-		log.Printf("Error purging invalid clients: %v", err)
-		return
-	}
 
-	affected, _ := result.RowsAffected()
-	if affected > 0 {
-		log.Printf("Purged %d invalid/old clients from database", affected)
+			// Enforce agent error event retention
+			s.pruneClientErrors()
+		}
 	}
 }
 
@@ -1293,14 +2647,42 @@ func (s *Server) handleProxyOrNotFound(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
 	isWebSocket := strings.ToLower(r.Header.Get("Upgrade")) == "websocket" &&
 		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+	defer s.trackProxyConnection(isWebSocket)()
+
+	// New requests are turned away during maintenance; ones already proxied run to completion
+	if s.rejectInMaintenance(w) {
+		return
+	}
+
+	// Enforce per-prefix method filters before selecting a backend
+	route := s.proxyRouteFor(r.URL.Path)
+	if handleProxyMethod(w, r, route) {
+		return
+	}
+
+	// Apply per-prefix read/write deadlines and lifetime cap before reading the body
+	r, cancelRoute := applyProxyRouteLimits(w, r, route)
+	defer cancelRoute()
+
+	// The proxy route decides the tenant; end users cannot pick one with X-Tenant
+	routeTenant := ""
+	if route != nil {
+		routeTenant = route.Tenant
+	}
+	r = withTenant(r, routeTenant)
 
 	var bodyBytes []byte
 	var tier string
 	var clientLat, clientLon float64
 
-	if !isWebSocket {
+	// Streamed uploads go to the backend unread, so the tier cannot come from the body
+	streamBody := route != nil && route.StreamRequestBody && !isWebSocket && r.Method != http.MethodHead
+
+	// HEAD requests carry no body, so there is nothing to buffer
+	if !isWebSocket && r.Method != http.MethodHead && !streamBody {
 		var err error
 		bodyBytes, err = io.ReadAll(r.Body)
 		if err != nil {
@@ -1309,13 +2691,10 @@ func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
 		}
 		defer r.Body.Close()
 
+		// JSON, form and multipart bodies can carry the tier and client location
 		if len(bodyBytes) > 0 {
-			var payload map[string]interface{}
-			if err := json.Unmarshal(bodyBytes, &payload); err == nil {
-				tier, _ = payload[s.config.TierFieldName].(string)
-				clientLat, _ = payload["client_lat"].(float64)
-				clientLon, _ = payload["client_lon"].(float64)
-			}
+			fields := extractBodyRoutingFields(r.Header.Get("Content-Type"), bodyBytes, s.config.TierFieldName)
+			tier, clientLat, clientLon = fields.Tier, fields.ClientLat, fields.ClientLon
 		}
 	} else {
 		tier = r.URL.Query().Get(s.config.TierFieldName)
@@ -1324,13 +2703,7 @@ func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	stickyID := ""
-	if s.stickyHeader != "" {
-		stickyID = r.Header.Get(s.stickyHeader)
-	}
-	if stickyID == "" && s.stickyByIP {
-		stickyID = getClientIP(r)
-	}
+	stickyID := s.requestStickyID(r)
 
 	// Extract client IP from headers or connection
 	clientIP := r.Header.Get("X-Forwarded-For")
@@ -1356,23 +2729,96 @@ func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
 		tier = "lite"
 	}
 
-	// Get tier spec from configured tiers
-	tierSpec, ok := s.tierSpecs[tier]
+	// Routing rules can deny the request or rewrite its tier before placement
+	rule := s.matchRoutingRule(r, tier, r.URL.Path, getClientIP(r))
+	s.setRuleHeader(w, rule)
+	if rule.deny(w) {
+		return
+	}
+	tier = rule.rewriteTier(tier)
+
+	// Get tier spec from the current (or staged) tier set
+	tierSpec, tierVersion, ok := s.resolveTier(r, tier)
 	if !ok {
 		http.Error(w, fmt.Sprintf("Unknown tier: %s", tier), http.StatusBadRequest)
 		return
 	}
+	pinVersion, preferVersion := requestServiceVersions(r)
+	applyRequestServiceVersion(&tierSpec, pinVersion, preferVersion)
+	rule.apply(&tierSpec)
+
+	// Same-network preference needs the end user's ASN
+	if s.config.GeoIP.PreferSameASN {
+		if info, ok := s.lookupIP(getClientIP(r)); ok {
+			tierSpec.ClientASN = info.ASN
+		}
+	}
+
+	// Latency from the end user's nearest probe region replaces the load balancer's own measurements
+	s.applyVantageRegion(&tierSpec, clientLat, clientLon, getClientIP(r))
+
+	// A valid routing cookie returns the request to its backend without consulting sticky state
+	cookieClient, cookie := s.routingCookieClient(r, tier, tierSpec)
+
+	// Otherwise read shared sticky assignments once for shedding, the limit check and placement below
+	if cookieClient == nil {
+		s.syncRequestStickyAssignments(stickyID, tierSpec)
+	}
+
+	// Near saturation, new sessions of low-priority tiers are turned away before backends overload
+	if cookieClient == nil && s.shedder != nil && !s.hasStickyAssignment(tenantStickyID(tierSpec.Tenant, stickyID), tier) && s.shedder.Shed(tierSpec) {
+		s.shedder.reject(w, tierSpec)
+		return
+	}
+
+	// A new session must fit within the sticky ID's session limit
+	if cookieClient == nil && !s.enforceStickyLimit(w, stickyID, tier, tierSpec) {
+		return
+	}
 
 	// Generate unique request ID for resource tracking
 	requestID := fmt.Sprintf("%d-%s", time.Now().UnixNano(), stickyID)
 
 	// Select client with stickiness support and resource reservation
-	client := s.selectClientWithStickiness(stickyID, tier, tierSpec, clientLat, clientLon, requestID)
+	// Anonymous requests can reuse a pick made for an identical request moments ago
+	// Requests carrying a routing cookie are already placed and reserve nothing
+	client := cookieClient
+	var outcome stickyOutcome
+	if client == nil && stickyID == "" && s.routeCache != nil {
+		key := routeCacheKey(tierSpec, tierVersion, rule, clientLat, clientLon)
+		client = s.selectAnonymousClient(key, tier, tierSpec, clientLat, clientLon, requestID)
+	} else if client == nil {
+		client, outcome = s.selectClientWithStickyPolicy(stickyID, tier, tierSpec, clientLat, clientLon, requestID)
+	}
+	if !writeStickyOutcome(w, tierSpec, outcome) {
+		return
+	}
 	if client == nil {
-		http.Error(w, "No available backends with sufficient resources", http.StatusServiceUnavailable)
+		s.writeNoBackend(w, tierSpec, clientLat, clientLon, "No available backends with sufficient resources")
 		return
 	}
 
+	// A backend at max_in_flight takes no more requests until one finishes; wait briefly for a slot
+	if !isLongLivedStream(r, isWebSocket) {
+		release, ok := s.concurrency.Acquire(r.Context(), client.Registration.ClientID)
+		if !ok {
+			s.releasePlacement(client, requestID, tenantStickyID(tierSpec.Tenant, stickyID), tier, outcome)
+			s.publishRouteFailed(tierSpec, errCodeBackendBusy)
+			s.concurrency.writeBackendBusy(w, client)
+			return
+		}
+		defer release()
+	}
+
+	annotateAccessLog(r, tier, tierVersion, client.Registration.ClientID)
+	w.Header().Set(TierVersionHeader, tierVersion)
+	s.setRoutingHeaders(w, client, tierSpec, clientLat, clientLon)
+	s.setRoutingCookie(w, r, tier, tierSpec, client, cookie)
+
+	cpuset := s.suggestedCPUSet(client, tierSpec, requestID)
+	gpus := s.suggestedGPUs(client, tierSpec, requestID)
+	lease, hasLease := s.requestLease(client, requestID)
+
 	selectedEndpoint := client.SelectEndpoint(r.URL.Path)
 	targetURL, err := url.Parse(selectedEndpoint)
 	if err != nil {
@@ -1381,47 +2827,115 @@ func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Record the outcome for outlier detection; wrap the body when the route has an idle timeout
+	var idleTimeout time.Duration
+	flushInterval := time.Duration(s.config.ProxySSEFlushInterval) * time.Millisecond
+	if route != nil {
+		if route.Streaming {
+			flushInterval = -1
+		}
+		if route.IdleTimeoutSecs > 0 {
+			idleTimeout = time.Duration(route.IdleTimeoutSecs) * time.Second
+		}
+	}
+
+	// gRPC needs HTTP/2 upstream and immediate flushing; trailers (grpc-status) are passed through by the proxy
+	grpc := isGRPCRequest(r)
+	if grpc {
+		flushInterval = -1
+	}
+	protocol := upstreamProtocol(client.endpointProtocol(selectedEndpoint), selectedEndpoint, grpc)
+	transport := s.proxyTransport(protocol, idleTimeout)
+	modifyResponse := func(resp *http.Response) error {
+		s.observeSLO(sloKindProxyTTFB, start)
+		s.recordProxyOutcome(client.Registration.ClientID, resp.StatusCode >= 500)
+		if idleTimeout > 0 {
+			resp.Body = newIdleTimeoutBody(resp.Body, idleTimeout, cancelRoute)
+		}
+		return compressProxyResponse(resp, r, route)
+	}
+
 	// Create reverse proxy with SSE support
 	proxy := &httputil.ReverseProxy{
 		Director: func(req *http.Request) {
 			req.URL.Scheme = targetURL.Scheme
 			req.URL.Host = targetURL.Host
 			req.Host = targetURL.Host
+			if route != nil && route.PreserveHost {
+				req.Host = r.Host
+			}
 			req.URL.Path = r.URL.Path        // Preserve original path
 			req.URL.RawQuery = r.URL.RawQuery // Preserve query parameters
 
 			// Restore the original request body
-			req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-			req.ContentLength = int64(len(bodyBytes))
+			if r.Method == http.MethodHead {
+				req.Body = http.NoBody
+				req.ContentLength = 0
+			} else if streamBody {
+				if req.Body != nil && req.Body != http.NoBody {
+					req.Body = newMeteredUploadBody(req.Body, func(bytes int64, elapsed time.Duration) {
+						s.recordUpload(client, bytes, elapsed)
+					})
+				}
+			} else {
+				req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+				req.ContentLength = int64(len(bodyBytes))
+			}
+
+			// Drop hop-by-hop and spoofed headers, then apply the route's header lists
+			filterProxyRequestHeaders(req.Header, route)
+			req.Header.Set("Forwarded", forwardedHeader(r))
+			setXForwardedHeaders(req.Header, r)
 
 			// Add headers to track routing
 			req.Header.Set("X-LB-Client-ID", client.Registration.ClientID)
 			req.Header.Set("X-LB-Hostname", client.Registration.Hostname)
 			req.Header.Set("X-Forwarded-For", clientIP)
+			s.setMetaHeaders(req.Header, client)
+			if cpuset != "" {
+				req.Header.Set("X-LB-Suggested-CPUSet", cpuset)
+			}
+			if gpus != "" {
+				req.Header.Set("X-LB-Suggested-GPUs", gpus)
+			}
+			// The backend renews the lease while the new session starts up
+			if hasLease {
+				req.Header.Set(LBLeaseIDHeader, lease.LeaseID)
+				req.Header.Set(LBLeaseTTLHeader, strconv.Itoa(leaseTTLSecs(lease, time.Now())))
+			}
 		},
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: s.config.TLSInsecureSkipVerify,
-			},
-		},
+		Transport: transport,
 		// ModifyResponse: ReverseProxy automatically forwards all headers from backend
-		// We don't need to manually copy them here
-		ModifyResponse: nil,
+		// We only record the outcome, wrap the body for idle timeouts and compress per route
+		ModifyResponse: modifyResponse,
 		// ErrorHandler handles backend connection errors gracefully
 		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			// Route max lifetime reached before the backend responded
+			if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+				log.Printf("Proxy lifetime exceeded for %s %s", r.Method, r.URL.Path)
+				http.Error(w, "Gateway Timeout", http.StatusGatewayTimeout)
+				return
+			}
 			// Check if error is due to client disconnect (context canceled)
 			if r.Context().Err() != nil {
 				// Client disconnected - log but don't send response
 				log.Printf("Client disconnected during proxy: %s %s", r.Method, r.URL.Path)
 				return
 			}
+			// A streamed upload ran past the route's max_body_bytes
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
 			// Backend error - log and return 502
 			log.Printf("Proxy error for %s %s: %v", r.Method, r.URL.Path, err)
+			s.recordProxyOutcome(client.Registration.ClientID, true)
 			http.Error(w, "Bad Gateway", http.StatusBadGateway)
 		},
 		// FlushInterval enables SSE/streaming support
 		// -1 = flush immediately (best for SSE), 0 = no flush, >0 = flush at interval
-		FlushInterval: time.Duration(s.config.ProxySSEFlushInterval) * time.Millisecond,
+		FlushInterval: flushInterval,
 	}
 
 	distance := 0.0
@@ -1440,6 +2954,7 @@ func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
 		"distance":   fmt.Sprintf("%.0f km", distance),
 		"sticky_id":  stickyID,
 		"client_id":  client.Registration.ClientID,
+		"protocol":   protocol,
 	})
 
 	// Proxy the request
@@ -1468,65 +2983,35 @@ func haversineDistance(lat1, lon1, lat2, lon2 float64) float64 {
 // lookupIPLocation performs GeoIP lookup for an IP address
 // Returns latitude, longitude, or 0,0 if lookup fails or DB not configured
 func (s *Server) lookupIPLocation(ipAddr string) (float64, float64) {
-	// If no GeoIP database configured, return 0,0
-	if s.geoIPDBPath == "" {
-		log.Printf("GeoIP database not configured (geoip_db_path is empty)")
-		return 0, 0
-	}
-
-	db, err := geoip2.Open(s.geoIPDBPath)
-	if err != nil {
-		log.Printf("Warning: Failed to open GeoIP database at %s: %v", s.geoIPDBPath, err)
-		return 0, 0
-	}
-	defer db.Close()
-
-	ip := net.ParseIP(ipAddr)
-	if ip == nil {
-		log.Printf("Warning: Invalid IP address: %s", ipAddr)
-		return 0, 0
-	}
-
-	record, err := db.City(ip)
-	if err != nil {
-		log.Printf("Warning: Failed to lookup IP %s in database: %v", ipAddr, err)
+	info, ok := s.lookupIP(ipAddr)
+	if !ok {
 		return 0, 0
 	}
-
-	log.Printf("GeoIP database lookup successful for %s: %.4f, %.4f (%s, %s)",
-		ipAddr, record.Location.Latitude, record.Location.Longitude,
-		record.City.Names["en"], record.Country.IsoCode)
-
-	return record.Location.Latitude, record.Location.Longitude
+	return info.Latitude, info.Longitude
 }
 
-// loadStickyAssignments loads sticky session mappings from database on startup
+// loadStickyAssignments loads sticky session mappings from the sticky store on startup
 func (s *Server) loadStickyAssignments() error {
-	rows, err := s.db.Query("SELECT sticky_id, tier, client_id FROM sticky_assignments")
+	stored, err := s.stickyStore.List("")
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
-
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	count := 0
-	for rows.Next() {
-		var stickyID, tier, clientID string
-		if err := rows.Scan(&stickyID, &tier, &clientID); err != nil {
-			continue
-		}
 
-		if s.stickyAssignments[stickyID] == nil {
-			s.stickyAssignments[stickyID] = make(map[string]string)
+	assignments := make(map[string]map[string]string)
+	for _, assignment := range stored {
+		if assignments[assignment.StickyID] == nil {
+			assignments[assignment.StickyID] = make(map[string]string)
 		}
-		s.stickyAssignments[stickyID][tier] = clientID
-		count++
+		assignments[assignment.StickyID][assignment.Tier] = assignment.ClientID
 	}
 
+	// Swap in the loaded assignments at once so concurrent lookups never see a partial map
+	s.mu.Lock()
+	s.stickyAssignments = assignments
+	s.mu.Unlock()
+
 	LogInfoWithData("Loaded sticky assignments", map[string]interface{}{
-		"count":  count,
+		"count":  len(stored),
 		"header": s.stickyHeader,
 	})
 	return nil
@@ -1537,26 +3022,45 @@ func (s *Server) loadStickyAssignments() error {
 // Sticky ID can come from a header (stickyHeader) or client IP (stickyByIP)
 func (s *Server) selectClientWithStickiness(stickyID, tier string, tierSpec common.TierSpec,
 	clientLat, clientLon float64, requestID string) *ClientState {
+	client, _ := s.selectClientWithStickyPolicy(stickyID, tier, tierSpec, clientLat, clientLon, requestID)
+	return client
+}
+
+// selectClientWithStickyPolicy is selectClientWithStickiness that also reports what the tier's sticky_policy
+// did with an existing assignment whose backend could not take the request
+func (s *Server) selectClientWithStickyPolicy(stickyID, tier string, tierSpec common.TierSpec,
+	clientLat, clientLon float64, requestID string) (*ClientState, stickyOutcome) {
+
+	// Identical sticky IDs from different tenants must not share assignments
+	stickyID = tenantStickyID(tierSpec.Tenant, stickyID)
 
 	// If no sticky sessions configured or no sticky ID provided, use standard routing
 	if (s.stickyHeader == "" && !s.stickyByIP) || stickyID == "" {
 		client := s.findBestClient(tierSpec, clientLat, clientLon)
-		if client != nil {
-			// Reserve resources even for non-sticky requests to prevent race conditions
-			s.addPendingAllocation(client.Registration.ClientID, stickyID, tier, tierSpec, requestID)
+		// Reserve resources even for non-sticky requests to prevent race conditions
+		if client != nil && !s.admitPendingAllocation(client.Registration.ClientID, stickyID, tier, tierSpec, requestID) {
+			return nil, stickyOutcome{}
 		}
-		return client
+		return client, stickyOutcome{}
+	}
+
+	// Consistent-hash mode: derive the backend from the sticky ID without touching the assignments table
+	if s.isHashStickyMode() {
+		return s.reserveByHash(s.stickyHashKey(stickyID, tier), stickyID, tier, tierSpec, requestID), stickyOutcome{}
 	}
 
 	// Try to use existing assignment for this sticky_id + tier
-	client := s.findStickyAssignment(stickyID, tier, tierSpec)
+	client, outcome := s.findStickyAssignment(stickyID, tier, tierSpec)
 	if client != nil {
 		LogInfoWithData("Using sticky assignment", map[string]interface{}{
 			"sticky_id": stickyID,
 			"tier":      tier,
 			"client_id": client.Registration.ClientID,
 		})
-		return client
+		return client, outcome
+	}
+	if outcome.Held {
+		return nil, outcome
 	}
 
 	// No assignment or backend unavailable/overloaded
@@ -1583,11 +3087,17 @@ func (s *Server) selectClientWithStickiness(stickyID, tier string, tierSpec comm
 				// Assigned client disappeared, clear assignment and retry would be ideal,
 				// but for now just return nil to avoid routing to a dead client
 				s.removeStickyAssignment(stickyID, tier)
-				return nil
+				return nil, outcome
 			}
 		}
 
-		s.addPendingAllocation(selectedClient.Registration.ClientID, stickyID, tier, tierSpec, requestID)
+		// Over the pending allocation caps the session is not placed, so it keeps no assignment either
+		if !s.admitPendingAllocation(selectedClient.Registration.ClientID, stickyID, tier, tierSpec, requestID) {
+			s.removeStickyAssignment(stickyID, tier)
+			return nil, outcome
+		}
+		outcome.Relocated = outcome.Reason != "" && tierSpec.StickyPolicy == StickyPolicyDegrade
+		outcome.Created = assignedClientID == selectedClient.Registration.ClientID
 
 		LogInfoWithData("Created sticky assignment", map[string]interface{}{
 			"sticky_id": stickyID,
@@ -1596,60 +3106,78 @@ func (s *Server) selectClientWithStickiness(stickyID, tier string, tierSpec comm
 		})
 	}
 
-	return selectedClient
+	return selectedClient, outcome
 }
 
 // findStickyAssignment checks if sticky_id+tier has an assigned backend with capacity
-func (s *Server) findStickyAssignment(stickyID, tier string, tierSpec common.TierSpec) *ClientState {
+// When it has not, the outcome names the reason and whether the tier's sticky_policy kept the assignment
+// Only memory is consulted: request handlers read shared assignments through first (syncRequestStickyAssignments)
+func (s *Server) findStickyAssignment(stickyID, tier string, tierSpec common.TierSpec) (*ClientState, stickyOutcome) {
 	s.mu.RLock()
 	tierMap, exists := s.stickyAssignments[stickyID]
 	if !exists {
 		s.mu.RUnlock()
-		return nil
+		return nil, stickyOutcome{}
 	}
 
 	clientID, exists := tierMap[tier]
 	s.mu.RUnlock()
 
 	if !exists {
-		return nil
+		return nil, stickyOutcome{}
 	}
 
 	s.mu.RLock()
 	client, exists := s.clientCache[clientID]
 	s.mu.RUnlock()
 
-	if !exists || time.Since(client.LastSeen) > s.staleTimeout {
+	if !exists || s.isStale(client) {
 		// Backend offline/stale
 		s.removeStickyAssignment(stickyID, tier)
 		LogWarn(fmt.Sprintf("Sticky assignment stale: sticky_id=%s tier=%s client=%s",
 			stickyID, tier, clientID))
-		return nil
+		return nil, stickyOutcome{Reason: stickyReasonOffline, ClientID: clientID}
 	}
 
 	// Check if backend is unhealthy
 	if s.config.HealthCheckEnabled && client.HealthStatus == "unhealthy" {
+		if holdStickyAssignment(stickyID, tierSpec, clientID, stickyReasonUnhealthy) {
+			return nil, stickyOutcome{Reason: stickyReasonUnhealthy, ClientID: clientID, Held: true}
+		}
 		LogWarn(fmt.Sprintf("Sticky assignment backend unhealthy, will reassign: sticky_id=%s tier=%s client=%s",
 			stickyID, tier, clientID))
 		s.removeStickyAssignment(stickyID, tier)
-		return nil
+		return nil, stickyOutcome{Reason: stickyReasonUnhealthy, ClientID: clientID}
 	}
 
 	// Check if backend still has resources
 	if !s.hasResources(client, tierSpec) {
+		if holdStickyAssignment(stickyID, tierSpec, clientID, stickyReasonOverloaded) {
+			return nil, stickyOutcome{Reason: stickyReasonOverloaded, ClientID: clientID, Held: true}
+		}
 		LogWarn(fmt.Sprintf("Sticky assignment backend overloaded, will reassign: sticky_id=%s tier=%s client=%s",
 			stickyID, tier, clientID))
 		s.removeStickyAssignment(stickyID, tier)
-		return nil
+		return nil, stickyOutcome{Reason: stickyReasonOverloaded, ClientID: clientID}
+	}
+
+	// Reassign sessions whose backend drifted out of the tier's latency budget
+	if !tierSpec.AllowDegraded && !withinLatencyBudget(client, tierSpec, 0) {
+		if holdStickyAssignment(stickyID, tierSpec, clientID, stickyReasonLatency) {
+			return nil, stickyOutcome{Reason: stickyReasonLatency, ClientID: clientID, Held: true}
+		}
+		LogWarn(fmt.Sprintf("Sticky assignment backend exceeds latency budget, will reassign: sticky_id=%s tier=%s client=%s latency=%.1fms",
+			stickyID, tier, clientID, client.LatencyMs))
+		s.removeStickyAssignment(stickyID, tier)
+		return nil, stickyOutcome{Reason: stickyReasonLatency, ClientID: clientID}
 	}
 
 	// Update last_used timestamp
-	if _, err := s.db.Exec(`UPDATE sticky_assignments SET last_used = CURRENT_TIMESTAMP
-                WHERE sticky_id = ? AND tier = ?`, stickyID, tier); err != nil {
+	if err := s.stickyStore.Touch(stickyID, tier); err != nil {
 		log.Printf("Warning: Failed to update sticky assignment timestamp: %v", err)
 	}
 
-	return client
+	return client, stickyOutcome{}
 }
 
 // findBestClientWithAffinity prefers servers where sticky_id already has sessions
@@ -1670,9 +3198,10 @@ func (s *Server) findBestClientWithAffinity(stickyID string, tierSpec common.Tie
 			s.mu.RUnlock()
 
 			if exists &&
-				time.Since(client.LastSeen) <= s.staleTimeout &&
+				!s.isStale(client) &&
 				(!s.config.HealthCheckEnabled || client.HealthStatus != "unhealthy") &&
-				s.hasResources(client, tierSpec) {
+				s.hasResources(client, tierSpec) &&
+				withinLatencyBudget(client, tierSpec, backendDistance(client, clientLat, clientLon)) {
 				LogInfoWithData("Using affinity server", map[string]interface{}{
 					"sticky_id":      stickyID,
 					"existing_tier":  existingTier,
@@ -1706,6 +3235,18 @@ func (s *Server) createStickyAssignment(stickyID, tier, clientID string) string
 		}
 	}
 
+	// With a shared store, replicas placing the same new session at once must agree on one backend
+	if s.stickyStore.Shared() {
+		s.mu.Unlock()
+		holder, err := s.stickyStore.Claim(StickyAssignment{StickyID: stickyID, Tier: tier, ClientID: clientID})
+		if err != nil || holder == "" {
+			LogError(fmt.Sprintf("Failed to save sticky assignment: %v", err))
+			holder = clientID
+		}
+		s.setStickyAssignment(stickyID, tier, holder)
+		return holder
+	}
+
 	// Create new assignment
 	if s.stickyAssignments[stickyID] == nil {
 		s.stickyAssignments[stickyID] = make(map[string]string)
@@ -1713,18 +3254,23 @@ func (s *Server) createStickyAssignment(stickyID, tier, clientID string) string
 	s.stickyAssignments[stickyID][tier] = clientID
 	s.mu.Unlock()
 
-	_, err := s.db.Exec(`
-		INSERT OR REPLACE INTO sticky_assignments (sticky_id, tier, client_id, last_used)
-		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
-	`, stickyID, tier, clientID)
-
-	if err != nil {
+	if err := s.stickyStore.Set(StickyAssignment{StickyID: stickyID, Tier: tier, ClientID: clientID}); err != nil {
 		LogError(fmt.Sprintf("Failed to save sticky assignment: %v", err))
 	}
 
 	return clientID
 }
 
+// setStickyAssignment records a sticky_id+tier → backend mapping in memory
+func (s *Server) setStickyAssignment(stickyID, tier, clientID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stickyAssignments[stickyID] == nil {
+		s.stickyAssignments[stickyID] = make(map[string]string)
+	}
+	s.stickyAssignments[stickyID][tier] = clientID
+}
+
 // removeStickyAssignment clears a sticky_id+tier assignment
 func (s *Server) removeStickyAssignment(stickyID, tier string) {
 	s.mu.Lock()
@@ -1736,7 +3282,7 @@ func (s *Server) removeStickyAssignment(stickyID, tier string) {
 	}
 	s.mu.Unlock()
 
-	if _, err := s.db.Exec("DELETE FROM sticky_assignments WHERE sticky_id = ? AND tier = ?", stickyID, tier); err != nil {
+	if err := s.stickyStore.Delete(stickyID, tier); err != nil {
 		log.Printf("Warning: Failed to delete sticky assignment: %v", err)
 	}
 }
@@ -1752,16 +3298,32 @@ func (s *Server) addPendingAllocation(clientID, stickyID, tier string, tierSpec
 	if stickyID != "" && tier != "" {
 		s.removePendingAllocationForStickyTierLocked(clientID, stickyID, tier)
 	}
+	s.addPendingAllocationLocked(clientID, stickyID, tier, tierSpec, requestID)
+}
 
+// addPendingAllocationLocked records a new pending allocation (caller must hold s.mu)
+func (s *Server) addPendingAllocationLocked(clientID, stickyID, tier string, tierSpec common.TierSpec, requestID string) {
+	now := time.Now()
 	allocation := PendingAllocation{
 		StickyID:  stickyID,
 		Tier:      tier,
 		TierSpec:  tierSpec,
-		Timestamp: time.Now(),
+		Timestamp: now,
 		RequestID: requestID,
+		LeaseID:   newLeaseID(),
+		ExpiresAt: now.Add(s.leaseTTL()),
+	}
+	if client, ok := s.clientCache[clientID]; ok {
+		allocation.CPUSet = s.pickCPUSetLocked(client, tierSpec)
+		allocation.GPUSet = s.pickGPUSetLocked(client, tierSpec)
 	}
 
 	s.pendingAllocations[clientID] = append(s.pendingAllocations[clientID], allocation)
+	s.reindexReservationsLocked(clientID)
+
+	if client, ok := s.clientCache[clientID]; ok {
+		client.RoutedSessions++
+	}
 
 	LogInfoWithData("Added pending allocation", map[string]interface{}{
 		"client_id":  clientID,
@@ -1770,6 +3332,7 @@ func (s *Server) addPendingAllocation(clientID, stickyID, tier string, tierSpec
 		"vcpu":       tierSpec.VCPU,
 		"memory_gb":  tierSpec.MemoryGB,
 		"request_id": requestID,
+		"lease_id":   allocation.LeaseID,
 	})
 }
 
@@ -1797,28 +3360,35 @@ func (s *Server) removePendingAllocationForStickyTierLocked(clientID, stickyID,
 		if len(filtered) == 0 {
 			delete(s.pendingAllocations, clientID)
 		}
+		s.reindexReservationsLocked(clientID)
 	}
 }
 
-// cleanupStalePendingAllocations removes allocations older than a threshold
+// cleanupStalePendingAllocations removes allocations whose lease expired
+// Expired leases already stopped reserving resources; this only frees the memory
 // Called periodically by cleanup goroutine
 func (s *Server) cleanupStalePendingAllocations() {
-	// Use configured timeout (default: 2 minutes)
-	threshold := time.Duration(s.config.PendingAllocationTimeoutSecs) * time.Second
-
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	now := time.Now()
 	totalRemoved := 0
 	for clientID, allocations := range s.pendingAllocations {
 		filtered := make([]PendingAllocation, 0, len(allocations))
 		removed := 0
 
 		for _, alloc := range allocations {
-			if time.Since(alloc.Timestamp) > threshold {
+			if alloc.expired(now) {
 				removed++
-				LogWarn(fmt.Sprintf("Removing stale pending allocation: client=%s sticky_id=%s tier=%s age=%s",
-					clientID, alloc.StickyID, alloc.Tier, time.Since(alloc.Timestamp)))
+				LogWarn(fmt.Sprintf("Removing expired allocation lease: client=%s sticky_id=%s tier=%s lease=%s age=%s",
+					clientID, alloc.StickyID, alloc.Tier, alloc.LeaseID, now.Sub(alloc.Timestamp)))
+				s.events.Publish("allocation.expired", map[string]interface{}{
+					"client_id":   clientID,
+					"sticky_id":   alloc.StickyID,
+					"tier":        alloc.Tier,
+					"lease_id":    alloc.LeaseID,
+					"age_seconds": int(now.Sub(alloc.Timestamp).Seconds()),
+				})
 				continue
 			}
 			filtered = append(filtered, alloc)
@@ -1831,6 +3401,7 @@ func (s *Server) cleanupStalePendingAllocations() {
 			} else {
 				s.pendingAllocations[clientID] = filtered
 			}
+			s.reindexReservationsLocked(clientID)
 		}
 	}
 
@@ -1891,21 +3462,33 @@ func (s *Server) performHealthChecks() {
 }
 
 // probeClient performs a single health check probe
+// Dual-stack backends that fail on their current address are retried on their other address family
 func (s *Server) probeClient(client *ClientState) {
 	timeout := time.Duration(s.config.HealthCheckTimeoutSecs) * time.Second
 
-	var success bool
-	var latency time.Duration
+	s.mu.RLock()
+	endpoint := client.Endpoint
+	candidates := client.EndpointCandidates
+	s.mu.RUnlock()
 
-	switch s.config.HealthCheckType {
-	case "http":
-		success, latency = s.probeHTTP(client.Endpoint, s.config.HealthCheckPath, timeout)
-	case "tcp":
-		fallthrough
-	default:
-		success, latency = s.probeTCP(client.Endpoint, timeout)
+	success, latency, report := s.probeEndpoint(endpoint, timeout)
+	reached := endpoint
+	if !success {
+		for _, candidate := range candidates {
+			if candidate == endpoint {
+				continue
+			}
+			if ok, candidateLatency, candidateReport := s.probeEndpoint(candidate, timeout); ok {
+				success, latency, report, reached = true, candidateLatency, candidateReport, candidate
+				break
+			}
+		}
 	}
 
+	if success {
+		s.recordWorkingEndpoint(client, endpoint, reached)
+	}
+	s.recordHealthReport(client, report)
 	s.updateHealthStatus(client, success, latency)
 }
 
@@ -1963,8 +3546,10 @@ func (s *Server) probeHTTP(endpoint, path string, timeout time.Duration) (bool,
 func (s *Server) updateHealthStatus(client *ClientState, success bool, latency time.Duration) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.invalidateRoutingSnapshot()
 
 	client.LastHealthCheck = time.Now()
+	s.routeCache.Invalidate(client.Registration.ClientID) // Latency and status both feed placement scores
 	latencyMs := float64(latency.Nanoseconds()) / 1000000.0 // Convert nanoseconds to milliseconds (float)
 
 	// Update latency using exponential weighted moving average (EWMA)
@@ -1985,6 +3570,9 @@ func (s *Server) updateHealthStatus(client *ClientState, success bool, latency t
 		// Become healthy after threshold consecutive successes
 		if client.ConsecutiveSuccesses >= s.config.HealthCheckHealthyThreshold {
 			client.HealthStatus = "healthy"
+			if previousStatus == "unhealthy" {
+				s.startWarmupLocked(client, "recovered")
+			}
 		}
 	} else {
 		client.ConsecutiveFailures++
@@ -2010,6 +3598,12 @@ func (s *Server) updateHealthStatus(client *ClientState, success bool, latency t
 			"failures":       client.ConsecutiveFailures,
 			"successes":      client.ConsecutiveSuccesses,
 		})
+		s.events.Publish("client.health", map[string]interface{}{
+			"client_id":  client.Registration.ClientID,
+			"previous":   previousStatus,
+			"current":    client.HealthStatus,
+			"latency_ms": client.LatencyMs,
+		})
 	}
 }
 
@@ -2023,9 +3617,9 @@ func (s *Server) removeStickyAssignmentsForClientLocked(clientID string) {
 				delete(tierMap, tier)
 				removed++
 
-				// Clean up database (in background, capture loop variables)
+				// Clean up the store (in background, capture loop variables)
 				go func(sid, t string) {
-					if _, err := s.db.Exec("DELETE FROM sticky_assignments WHERE sticky_id = ? AND tier = ?", sid, t); err != nil {
+					if err := s.stickyStore.Delete(sid, t); err != nil {
 						log.Printf("Warning: Failed to delete sticky assignment in background: %v", err)
 					}
 				}(stickyID, tier)
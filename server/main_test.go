@@ -214,7 +214,7 @@ func TestStickySession_FallbackOnOverload(t *testing.T) {
 
 	// Verify sticky assignment was updated
 	server.mu.RLock()
-	tierMap := server.stickyAssignments[stickyID]
+	tierMap := server.stickyAssignments[tenantStickyID(DefaultTenant, stickyID)]
 	assignedID := tierMap[tier]
 	server.mu.RUnlock()
 
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// errCodeMaintenance is sent in X-LB-Error-Code for routing requests rejected during maintenance
+const errCodeMaintenance = "maintenance"
+
+// maintenanceSettingName is the server_settings row holding the persisted maintenance state
+const maintenanceSettingName = "maintenance"
+
+// MaintenanceState is the server-wide maintenance switch (POST /admin/maintenance)
+// While enabled, new /route and proxy requests are rejected; management reads, agent
+// registration/stats and requests already being proxied are unaffected
+type MaintenanceState struct {
+	Enabled        bool      `json:"enabled"`
+	StatusCode     int       `json:"status_code,omitempty"`      // Overrides maintenance.status_code
+	Message        string    `json:"message,omitempty"`          // Overrides maintenance.message
+	RetryAfterSecs int       `json:"retry_after_secs,omitempty"` // Overrides maintenance.retry_after_secs
+	Reason         string    `json:"reason,omitempty"`           // Operator note, shown in GET and logs only
+	Since          time.Time `json:"since,omitempty"`
+}
+
+// maintenanceResponseLocked returns the status, message and Retry-After for rejected requests,
+// falling back to the maintenance config for fields the switch didn't set (caller must hold s.mu)
+func (s *Server) maintenanceResponseLocked() (int, string, int) {
+	state := s.maintenance
+	status, message, retryAfter := state.StatusCode, state.Message, state.RetryAfterSecs
+	if status == 0 {
+		status = s.config.Maintenance.StatusCode
+	}
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	if message == "" {
+		message = s.config.Maintenance.Message
+	}
+	if message == "" {
+		message = "Service is under maintenance"
+	}
+	if retryAfter == 0 {
+		retryAfter = s.config.Maintenance.RetryAfterSecs
+	}
+	return status, message, retryAfter
+}
+
+// rejectInMaintenance answers a new routing request while maintenance mode is on
+// Returns true if the request was rejected
+func (s *Server) rejectInMaintenance(w http.ResponseWriter) bool {
+	s.mu.RLock()
+	if !s.maintenance.Enabled {
+		s.mu.RUnlock()
+		return false
+	}
+	status, message, retryAfter := s.maintenanceResponseLocked()
+	s.mu.RUnlock()
+
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+	w.Header().Set(LBErrorCodeHeader, errCodeMaintenance)
+	http.Error(w, message, status)
+	return true
+}
+
+// inMaintenance reports whether maintenance mode is on
+func (s *Server) inMaintenance() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.maintenance.Enabled
+}
+
+// loadMaintenanceState restores the maintenance switch persisted before a restart
+func (s *Server) loadMaintenanceState() error {
+	var value string
+	err := s.db.QueryRow("SELECT value FROM server_settings WHERE name = ?", maintenanceSettingName).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state MaintenanceState
+	if err := json.Unmarshal([]byte(value), &state); err != nil {
+		return fmt.Errorf("invalid persisted maintenance state: %w", err)
+	}
+
+	s.mu.Lock()
+	s.maintenance = state
+	s.mu.Unlock()
+
+	if state.Enabled {
+		LogWarnWithData("Maintenance mode is on (restored from database)", map[string]interface{}{
+			"since":  state.Since,
+			"reason": state.Reason,
+		})
+	}
+	return nil
+}
+
+// handleMaintenance shows (GET) or switches (POST) server-wide maintenance mode
+func (s *Server) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if !s.setMaintenance(w, r) {
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.RLock()
+	state := s.maintenance
+	status, message, retryAfter := s.maintenanceResponseLocked()
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":          state.Enabled,
+		"since":            state.Since,
+		"reason":           state.Reason,
+		"status_code":      status,
+		"message":          message,
+		"retry_after_secs": retryAfter,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode maintenance response: %v", err)
+	}
+}
+
+// setMaintenance applies and persists a POST /admin/maintenance request
+// Returns false if an error response was written
+func (s *Server) setMaintenance(w http.ResponseWriter, r *http.Request) bool {
+	var state MaintenanceState
+	if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if state.StatusCode != 0 && (state.StatusCode < 400 || state.StatusCode > 599) {
+		http.Error(w, "status_code must be a 4xx or 5xx status", http.StatusBadRequest)
+		return false
+	}
+	if state.RetryAfterSecs < 0 {
+		http.Error(w, "retry_after_secs must not be negative", http.StatusBadRequest)
+		return false
+	}
+
+	s.mu.RLock()
+	previous := s.maintenance
+	s.mu.RUnlock()
+	switch {
+	case !state.Enabled:
+		state = MaintenanceState{}
+	case previous.Enabled:
+		state.Since = previous.Since
+	default:
+		state.Since = time.Now().UTC()
+	}
+
+	// Persist first so a restart never silently reopens (or closes) the load balancer
+	value, _ := json.Marshal(state)
+	if _, err := s.db.Exec(`
+		INSERT OR REPLACE INTO server_settings (name, value, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+	`, maintenanceSettingName, string(value)); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to persist maintenance state: %v", err), http.StatusInternalServerError)
+		return false
+	}
+
+	s.mu.Lock()
+	s.maintenance = state
+	s.mu.Unlock()
+
+	if state.Enabled != previous.Enabled {
+		data := map[string]interface{}{
+			"enabled": state.Enabled,
+			"reason":  state.Reason,
+		}
+		if state.Enabled {
+			LogWarnWithData("Maintenance mode enabled, rejecting new routing requests", data)
+		} else {
+			LogInfoWithData("Maintenance mode disabled", data)
+		}
+		s.emit("server.maintenance", data)
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+func postMaintenance(t *testing.T, server *Server, body string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	server.handleMaintenance(rec, httptest.NewRequest("POST", "/admin/maintenance", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected maintenance switch to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestMaintenanceMode_RejectsRoutingAndPersists verifies routing is rejected with Retry-After and the switch survives a restart
+func TestMaintenanceMode_RejectsRoutingAndPersists(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.Maintenance = common.MaintenanceConfig{StatusCode: 503, Message: "Down for upgrade", RetryAfterSecs: 120}
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend"}))
+
+	postMaintenance(t, server, `{"enabled": true, "reason": "db migration"}`)
+
+	route := func(s *Server) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(common.RoutingRequest{Tier: "lite"})
+		rec := httptest.NewRecorder()
+		s.handleRoute(rec, httptest.NewRequest("POST", "/route", bytes.NewReader(body)))
+		return rec
+	}
+
+	rec := route(server)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 in maintenance, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "120" || rec.Header().Get(LBErrorCodeHeader) != errCodeMaintenance {
+		t.Errorf("Expected Retry-After and error code headers, got %v", rec.Header())
+	}
+	if !strings.Contains(rec.Body.String(), "Down for upgrade") {
+		t.Errorf("Expected the configured message, got %q", rec.Body.String())
+	}
+
+	// Management reads keep working and report the mode
+	if health := getHealth(t, server); !health.Maintenance || health.Status != "maintenance" {
+		t.Errorf("Expected /health to report maintenance, got %+v", health)
+	}
+
+	restarted := NewTestServer(t, db)
+	restarted.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend"}))
+	if err := restarted.loadMaintenanceState(); err != nil {
+		t.Fatalf("Failed to load maintenance state: %v", err)
+	}
+	if !restarted.inMaintenance() {
+		t.Fatal("Expected maintenance mode to survive a restart")
+	}
+
+	postMaintenance(t, restarted, `{"enabled": false}`)
+	if rec := route(restarted); rec.Code != http.StatusOK {
+		t.Errorf("Expected routing to resume after maintenance, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestMaintenanceMode_PerSwitchOverrides verifies the switch can override the configured status and message
+func TestMaintenanceMode_PerSwitchOverrides(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	postMaintenance(t, server, `{"enabled": true, "status_code": 429, "message": "Try the EU region", "retry_after_secs": 30}`)
+
+	rec := httptest.NewRecorder()
+	server.handleProxy(rec, httptest.NewRequest("GET", "/api/session", nil))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "30" {
+		t.Errorf("Expected the overridden 429 with Retry-After 30, got %d %v", rec.Code, rec.Header())
+	}
+
+	bad := httptest.NewRecorder()
+	server.handleMaintenance(bad, httptest.NewRequest("POST", "/admin/maintenance", strings.NewReader(`{"enabled": true, "status_code": 200}`)))
+	if bad.Code != http.StatusBadRequest {
+		t.Errorf("Expected a non-error status_code to be rejected, got %d", bad.Code)
+	}
+}
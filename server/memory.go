@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	"cyqle.in/opsen/common"
+)
+
+// Definitions of available memory a tier can place against (memory_available)
+const (
+	MemoryAvailableUsed      = "used"      // Total minus used, buffers and cache count as free (default)
+	MemoryAvailableFree      = "free"      // Strictly unused memory, cache counts as taken
+	MemoryAvailableKernel    = "available" // Kernel estimate of reclaimable memory (MemAvailable)
+	MemoryAvailableCommitted = "commit"    // Commit limit minus committed memory, for hosts without overcommit
+)
+
+// validateMemoryAvailable checks a tier's memory_available definition
+func validateMemoryAvailable(tier common.TierSpec) error {
+	switch tier.MemoryAvailable {
+	case "", MemoryAvailableUsed, MemoryAvailableFree, MemoryAvailableKernel, MemoryAvailableCommitted:
+		return nil
+	default:
+		return fmt.Errorf("tier %s: unknown memory_available %q (want %s, %s, %s or %s)", tier.Name, tier.MemoryAvailable,
+			MemoryAvailableUsed, MemoryAvailableFree, MemoryAvailableKernel, MemoryAvailableCommitted)
+	}
+}
+
+// memoryAvailableGB returns a backend's available memory under a tier's definition
+// Agents that don't report a breakdown (or the commit figures) fall back to memory_avail_gb
+func memoryAvailableGB(stats common.ResourceStats, definition string) float64 {
+	breakdown := stats.Memory
+	if breakdown == nil {
+		return stats.MemoryAvail
+	}
+	switch definition {
+	case MemoryAvailableFree:
+		return breakdown.FreeGB
+	case MemoryAvailableKernel:
+		return breakdown.AvailableGB
+	case MemoryAvailableCommitted:
+		if breakdown.CommitLimitGB > 0 {
+			return breakdown.CommitLimitGB - breakdown.CommittedGB
+		}
+	}
+	return stats.MemoryAvail
+}
+
+// tierHeadroomLocked returns a backend's headroom with memory and CPU counted the way tier defines them
+// Must be called with s.mu held
+func (s *Server) tierHeadroomLocked(client *ClientState, tier common.TierSpec) backendHeadroom {
+	return s.withTierCPU(withTierMemory(s.backendHeadroomLocked(client), client, tier), client, tier)
+}
+
+// withTierMemory adjusts a backend's headroom to count memory the way tier defines "available"
+func withTierMemory(headroom backendHeadroom, client *ClientState, tier common.TierSpec) backendHeadroom {
+	headroom.MemoryGB += memoryAvailableGB(client.Stats, tier.MemoryAvailable) - client.Stats.MemoryAvail
+	return headroom
+}
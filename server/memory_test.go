@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestMemoryAvailable_PerTier verifies each tier places against its own definition of available memory
+func TestMemoryAvailable_PerTier(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+
+	// 16 GB host: 10 GB used with cache counted as free, most of the rest is page cache
+	cached := NewMockClient(MockClientOptions{ClientID: "cached", TotalMemory: 16, MemoryUsed: 10, MemoryAvail: 6})
+	cached.Stats.Memory = &common.MemoryBreakdown{
+		FreeGB:        0.5,
+		BuffersGB:     0.5,
+		CachedGB:      5,
+		AvailableGB:   4,
+		CommittedGB:   15.5,
+		CommitLimitGB: 16,
+	}
+	legacy := NewMockClient(MockClientOptions{ClientID: "legacy", TotalMemory: 16, MemoryUsed: 10, MemoryAvail: 6})
+	server.AddMockClient(cached)
+	server.AddMockClient(legacy)
+
+	tests := []struct {
+		definition string
+		fits       bool
+	}{
+		{"", true},
+		{MemoryAvailableUsed, true},
+		{MemoryAvailableFree, false},
+		{MemoryAvailableKernel, true},
+		{MemoryAvailableCommitted, false},
+	}
+	for _, tt := range tests {
+		tier := common.TierSpec{Name: "mem", VCPU: 1, MemoryGB: 2, MemoryAvailable: tt.definition}
+		if got := server.hasResources(cached, tier); got != tt.fits {
+			t.Errorf("memory_available %q: expected fit %v, got %v", tt.definition, tt.fits, got)
+		}
+		// Agents without a breakdown keep memory_avail_gb under every definition
+		if !server.hasResources(legacy, tier) {
+			t.Errorf("memory_available %q: expected a backend without a breakdown to use memory_avail_gb", tt.definition)
+		}
+	}
+
+	server.mu.RLock()
+	capacity := server.tierCapacityLocked(cached, common.TierSpec{Name: "mem", MemoryGB: 1, MemoryAvailable: MemoryAvailableKernel})
+	server.mu.RUnlock()
+	if capacity != 4 {
+		t.Errorf("Expected tier capacity to use the kernel estimate (4 sessions), got %d", capacity)
+	}
+}
+
+// TestValidateMemoryAvailable verifies unknown definitions are rejected with the tier set
+func TestValidateMemoryAvailable(t *testing.T) {
+	if _, err := buildTierSpecs([]common.TierSpec{{Name: "ok", MemoryGB: 1, MemoryAvailable: MemoryAvailableFree}}); err != nil {
+		t.Errorf("Expected a known definition to be accepted, got %v", err)
+	}
+	if _, err := buildTierSpecs([]common.TierSpec{{Name: "bad", MemoryGB: 1, MemoryAvailable: "cached"}}); err == nil {
+		t.Error("Expected an unknown memory_available to be rejected")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// LBMetaHeaderPrefix starts the backend metadata headers set on proxied requests (meta_headers)
+const LBMetaHeaderPrefix = "X-LB-Meta-"
+
+const (
+	metaFieldLabels = "labels" // Every label of the backend, one header each
+	metaLabelPrefix = "label:" // One label by key, e.g. label:region
+)
+
+// metaHeaderFields maps meta_headers fields to the header suffix they are sent as
+var metaHeaderFields = map[string]string{
+	"gpu_model":       "GPU-Model",
+	"country":         "Country",
+	"city":            "City",
+	"pool":            "Pool",
+	"tenant":          "Tenant",
+	"service_version": "Service-Version",
+}
+
+// validateMetaHeaders checks meta_headers: known fields, labels, or label:<key> with a key usable in a header name
+func validateMetaHeaders(fields []string) error {
+	for _, field := range fields {
+		if _, ok := metaHeaderFields[field]; ok || field == metaFieldLabels {
+			continue
+		}
+		key, ok := strings.CutPrefix(field, metaLabelPrefix)
+		if !ok {
+			return fmt.Errorf("meta_headers: unknown field %q (want gpu_model, country, city, pool, tenant, service_version, labels or label:<key>)", field)
+		}
+		if !httpguts.ValidHeaderFieldName(key) {
+			return fmt.Errorf("meta_headers: label key %q cannot be used in a header name", key)
+		}
+	}
+	return nil
+}
+
+// backendMetaHeaders returns the configured metadata of a backend as header name → value
+// Fields the backend doesn't report, and values that can't be sent in a header, are left out
+func backendMetaHeaders(client *ClientState, fields []string) map[string]string {
+	reg := client.Registration
+	headers := make(map[string]string)
+	addLabel := func(key string) {
+		if value, ok := reg.Labels[key]; ok && httpguts.ValidHeaderFieldName(key) {
+			headers[LBMetaHeaderPrefix+http.CanonicalHeaderKey(key)] = value
+		}
+	}
+
+	for _, field := range fields {
+		var value string
+		switch field {
+		case metaFieldLabels:
+			keys := make([]string, 0, len(reg.Labels))
+			for key := range reg.Labels {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				addLabel(key)
+			}
+			continue
+		case "gpu_model":
+			value = strings.Join(distinctGPUModels(reg.GPUModels), ",")
+		case "country":
+			value = reg.Country
+		case "city":
+			value = reg.City
+		case "pool":
+			value = reg.Pool
+		case "tenant":
+			value = normalizeTenant(reg.Tenant)
+		case "service_version":
+			value = reg.ServiceVersion
+		default:
+			if key, ok := strings.CutPrefix(field, metaLabelPrefix); ok {
+				addLabel(key)
+			}
+			continue
+		}
+		if value != "" {
+			headers[LBMetaHeaderPrefix+metaHeaderFields[field]] = value
+		}
+	}
+
+	for name, value := range headers {
+		if !httpguts.ValidHeaderFieldValue(value) {
+			delete(headers, name)
+		}
+	}
+	return headers
+}
+
+// distinctGPUModels lists a backend's GPU models once each, in device order
+func distinctGPUModels(models []string) []string {
+	distinct := []string{}
+	for _, model := range models {
+		if model != "" && !slices.Contains(distinct, model) {
+			distinct = append(distinct, model)
+		}
+	}
+	return distinct
+}
+
+// setMetaHeaders adds the selected backend's metadata to a proxied request (meta_headers)
+func (s *Server) setMetaHeaders(header http.Header, client *ClientState) {
+	for name, value := range backendMetaHeaders(client, s.config.MetaHeaders) {
+		header.Set(name, value)
+	}
+}
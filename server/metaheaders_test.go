@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestBackendMetaHeaders verifies configured fields and labels become X-LB-Meta-* headers
+func TestBackendMetaHeaders(t *testing.T) {
+	client := NewMockClient(MockClientOptions{ClientID: "gpu-1", GPUModels: []string{"L4", "L4", "A100"}})
+	client.Registration.Country = "DE"
+	client.Registration.Labels = map[string]string{"region": "eu-central", "rack": "r12", "bad": "line\nbreak"}
+
+	headers := backendMetaHeaders(client, []string{"gpu_model", "country", "city", "label:region", "label:missing"})
+	want := map[string]string{
+		"X-LB-Meta-GPU-Model": "L4,A100",
+		"X-LB-Meta-Country":   "DE",
+		"X-LB-Meta-Region":    "eu-central",
+	}
+	if len(headers) != len(want) {
+		t.Errorf("Expected %v, got %v", want, headers)
+	}
+	for name, value := range want {
+		if headers[name] != value {
+			t.Errorf("Expected %s: %s, got %q", name, value, headers[name])
+		}
+	}
+
+	all := backendMetaHeaders(client, []string{"labels"})
+	if all["X-LB-Meta-Rack"] != "r12" || all["X-LB-Meta-Region"] != "eu-central" || len(all) != 2 {
+		t.Errorf("Expected every label with a valid value, got %v", all)
+	}
+
+	if err := validateMetaHeaders([]string{"gpu_model", "labels", "label:region"}); err != nil {
+		t.Errorf("Expected valid fields, got %v", err)
+	}
+	for _, bad := range []string{"hostname", "label:has space"} {
+		if err := validateMetaHeaders([]string{bad}); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+// TestProxy_MetaHeaders verifies the upstream receives the selected backend's metadata and not inbound copies
+func TestProxy_MetaHeaders(t *testing.T) {
+	var received http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer backend.Close()
+
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.MetaHeaders = []string{"gpu_model", "label:region"}
+	})
+	client := NewMockClient(MockClientOptions{ClientID: "meta-backend", Endpoint: backend.URL})
+	client.Registration.Labels = map[string]string{"region": "us-east"}
+	server.AddMockClient(client)
+
+	req := httptest.NewRequest("GET", "/api/test", nil)
+	req.Header.Set("X-LB-Meta-GPU-Model", "H100")
+	rec := httptest.NewRecorder()
+	server.handleProxy(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if received.Get("X-LB-Meta-Region") != "us-east" {
+		t.Errorf("Expected the backend's region label, got %v", received)
+	}
+	if got := received.Get("X-LB-Meta-GPU-Model"); got != "" {
+		t.Errorf("Expected the spoofed GPU model to be dropped for a backend without GPUs, got %q", got)
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"bufio"
+	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -44,11 +46,55 @@ func RequestSizeLimit(maxBytes int64) func(http.Handler) http.Handler {
 	}
 }
 
-// timeoutWriter wraps http.ResponseWriter to prevent concurrent writes after timeout
+// RequestSizeLimitFunc limits request body size per request (e.g. per proxy route); a limit <= 0 means unlimited
+func RequestSizeLimitFunc(limitFor func(r *http.Request) int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if maxBytes := limitFor(r); maxBytes > 0 {
+				r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DecompressRequest middleware decodes gzip request bodies (Content-Encoding: gzip)
+// The decompressed body is capped at maxBytes as well, so a small compressed payload can't expand without bound
+func DecompressRequest(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+			case "", "identity":
+				next.ServeHTTP(w, r)
+				return
+			case "gzip":
+			default:
+				http.Error(w, "Unsupported Content-Encoding (only gzip is accepted)", http.StatusUnsupportedMediaType)
+				return
+			}
+
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, "Invalid gzip request body", http.StatusBadRequest)
+				return
+			}
+			defer gz.Close()
+
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			r.Body = http.MaxBytesReader(w, gz, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// timeoutWriter drops the handler's response once the request deadline has passed, so a late
+// handler can't send a partial or stale response after the middleware answered 408
+// The handler runs on the request goroutine, so no locking is needed
 type timeoutWriter struct {
-	w          http.ResponseWriter
-	mu         sync.Mutex
-	timedOut   bool
+	w           http.ResponseWriter
+	ctx         context.Context
 	wroteHeader bool
 }
 
@@ -57,9 +103,7 @@ func (tw *timeoutWriter) Header() http.Header {
 }
 
 func (tw *timeoutWriter) Write(b []byte) (int, error) {
-	tw.mu.Lock()
-	defer tw.mu.Unlock()
-	if tw.timedOut {
+	if tw.expired() {
 		return 0, http.ErrHandlerTimeout
 	}
 	tw.wroteHeader = true
@@ -68,33 +112,43 @@ func (tw *timeoutWriter) Write(b []byte) (int, error) {
 
 // Flush implements http.Flusher for SSE support
 func (tw *timeoutWriter) Flush() {
-	tw.mu.Lock()
-	defer tw.mu.Unlock()
-	if !tw.timedOut {
-		if flusher, ok := tw.w.(http.Flusher); ok {
-			flusher.Flush()
-		}
+	if tw.expired() {
+		return
+	}
+	if flusher, ok := tw.w.(http.Flusher); ok {
+		tw.wroteHeader = true
+		flusher.Flush()
 	}
 }
 
 func (tw *timeoutWriter) WriteHeader(code int) {
-	tw.mu.Lock()
-	defer tw.mu.Unlock()
-	if tw.timedOut || tw.wroteHeader {
+	if tw.wroteHeader || tw.expired() {
 		return
 	}
 	tw.wroteHeader = true
 	tw.w.WriteHeader(code)
 }
 
-func (tw *timeoutWriter) setTimedOut() {
-	tw.mu.Lock()
-	defer tw.mu.Unlock()
-	tw.timedOut = true
+// Unwrap lets http.ResponseController reach the underlying connection
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
+
+// expired reports whether the request deadline has passed
+func (tw *timeoutWriter) expired() bool {
+	return tw.ctx.Err() == context.DeadlineExceeded
 }
 
 // Timeout middleware enforces request timeout
 func Timeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return TimeoutFunc(func(*http.Request) time.Duration { return timeout })
+}
+
+// TimeoutFunc enforces a per-request timeout chosen by timeoutFor (0 = no timeout)
+// The handler runs on the request goroutine with a context deadline: backend calls and other
+// context-aware work abort when it passes, the connection's write deadline stops a response still
+// being written, and a handler that returns late gets 408 instead of its own response
+func TimeoutFunc(timeoutFor func(r *http.Request) time.Duration) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Skip timeout for SSE/EventSource connections
@@ -115,53 +169,48 @@ func Timeout(timeout time.Duration) func(http.Handler) http.Handler {
 				return
 			}
 
+			timeout := timeoutFor(r)
+			if timeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			ctx, cancel := context.WithTimeout(r.Context(), timeout)
 			defer cancel()
 
-			r = r.WithContext(ctx)
+			// Writes to a slow or stalled client fail at the deadline instead of blocking the handler
+			// The deadline is cleared afterwards so it doesn't carry over to the next request on the connection
+			deadline, _ := ctx.Deadline()
+			rc := http.NewResponseController(w)
+			if err := rc.SetWriteDeadline(deadline); err == nil {
+				defer rc.SetWriteDeadline(time.Time{})
+			} else if !errors.Is(err, http.ErrNotSupported) {
+				log.Printf("Warning: Failed to set write deadline for %s: %v", r.URL.Path, err)
+			}
 
-			tw := &timeoutWriter{w: w}
-			done := make(chan struct{})
-			panicChan := make(chan interface{}, 1)
+			tw := &timeoutWriter{w: w, ctx: ctx}
+			defer func() {
+				if err := recover(); err != nil {
+					// http.ErrAbortHandler is intentional - re-panic to let http.Server handle it
+					if err == http.ErrAbortHandler {
+						panic(err)
+					}
 
-			go func() {
-				defer func() {
-					if err := recover(); err != nil {
-						panicChan <- err
+					stack := debug.Stack()
+					log.Printf("PANIC in timed handler: %v\n%s", err, stack)
+					// Only write error if handler hasn't already written headers
+					if !tw.wroteHeader {
+						tw.wroteHeader = true
+						http.Error(w, "Internal server error", http.StatusInternalServerError)
 					}
-				}()
-				next.ServeHTTP(tw, r)
-				close(done)
+				}
 			}()
 
-			select {
-			case <-done:
-				return
-			case err := <-panicChan:
-				// http.ErrAbortHandler is intentional - re-panic to let http.Server handle it
-				if err == http.ErrAbortHandler {
-					panic(err)
-				}
+			next.ServeHTTP(tw, r.WithContext(ctx))
 
-				stack := debug.Stack()
-				log.Printf("PANIC in timeout goroutine: %v\n%s", err, stack)
-				tw.setTimedOut()
-				// Only write error if handler hasn't already written headers
-				tw.mu.Lock()
-				alreadyWrote := tw.wroteHeader
-				tw.mu.Unlock()
-				if !alreadyWrote {
-					http.Error(w, "Internal server error", http.StatusInternalServerError)
-				}
-			case <-ctx.Done():
-				tw.setTimedOut()
-				// Only write timeout error if handler hasn't already written headers
-				tw.mu.Lock()
-				alreadyWrote := tw.wroteHeader
-				tw.mu.Unlock()
-				if !alreadyWrote && ctx.Err() == context.DeadlineExceeded {
-					http.Error(w, "Request timeout", http.StatusRequestTimeout)
-				}
+			// Only write timeout error if handler hasn't already written headers
+			if !tw.wroteHeader && tw.expired() {
+				http.Error(w, "Request timeout", http.StatusRequestTimeout)
 			}
 		})
 	}
@@ -264,10 +313,15 @@ func (tb *TokenBucket) Take() bool {
 }
 
 func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return rateLimitMiddleware(rl, next)
+}
+
+// rateLimitMiddleware rejects requests from IPs the limiter does not allow
+func rateLimitMiddleware(limiter interface{ Allow(ip string) bool }, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ip := getClientIP(r)
 
-		if !rl.Allow(ip) {
+		if !limiter.Allow(ip) {
 			log.Printf("Rate limit exceeded for IP: %s (path: %s)", ip, r.URL.Path)
 			http.Error(w, "Rate limit exceeded. Please try again later.", http.StatusTooManyRequests)
 			return
@@ -279,10 +333,14 @@ func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 
 // APIKeyAuth middleware validates API key in X-API-Key header
 // Supports both a primary server_key (for clients) and additional api_keys (for other integrations)
+// Tenant API keys authenticate like api_keys but bind the request to their tenant
+// Keys created at runtime (/admin/keys) and the revocation list are consulted on every request
 type APIKeyAuth struct {
-	serverKey string
-	apiKeys   map[string]bool
-	enabled   bool
+	serverKey  string
+	apiKeys    map[string]bool
+	tenantKeys map[string]string // API key -> tenant
+	store      *APIKeyStore      // Runtime keys and revoked configured keys (nil = none)
+	enabled    bool
 }
 
 func NewAPIKeyAuth(serverKey string, apiKeys []string) *APIKeyAuth {
@@ -303,10 +361,23 @@ func NewAPIKeyAuth(serverKey string, apiKeys []string) *APIKeyAuth {
 	}
 }
 
+// SetTenantKeys registers tenant-scoped API keys (enables auth if any are configured)
+func (a *APIKeyAuth) SetTenantKeys(tenantKeys map[string]string) {
+	a.tenantKeys = tenantKeys
+	if len(tenantKeys) > 0 {
+		a.enabled = true
+	}
+}
+
+// SetKeyStore attaches runtime API keys; an active runtime key enables auth
+func (a *APIKeyAuth) SetKeyStore(store *APIKeyStore) {
+	a.store = store
+}
+
 func (a *APIKeyAuth) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Skip auth if not enabled
-		if !a.enabled {
+		if !a.enabled && !a.store.HasActive() {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -320,12 +391,40 @@ func (a *APIKeyAuth) Middleware(next http.Handler) http.Handler {
 
 		// Check server_key first (primary authentication for clients)
 		if a.serverKey != "" && apiKey == a.serverKey {
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, withActor(r, "server_key"))
+			return
+		}
+
+		// Configured keys on the revocation list are refused until removed from the config
+		if a.store.Revoked(apiKey) {
+			log.Printf("Revoked API key %s from IP: %s (path: %s)", apiKeyFingerprint(apiKey), getClientIP(r), r.URL.Path)
+			http.Error(w, "API key revoked", http.StatusForbidden)
 			return
 		}
 
 		// Check additional api_keys (for other integrations)
 		if a.apiKeys[apiKey] {
+			next.ServeHTTP(w, withActor(r, "api_key:"+apiKeyFingerprint(apiKey)))
+			return
+		}
+
+		// Tenant keys only see and route within their tenant
+		if tenant, ok := a.tenantKeys[apiKey]; ok {
+			next.ServeHTTP(w, withActor(withTenant(r, tenant), "tenant_key:"+apiKeyFingerprint(apiKey)))
+			return
+		}
+
+		// Runtime keys, bound to their tenant if they have one
+		if key, found, active := a.store.Lookup(apiKey); found {
+			if !active {
+				log.Printf("Disabled API key %s from IP: %s (path: %s)", key.ID, getClientIP(r), r.URL.Path)
+				http.Error(w, "API key revoked", http.StatusForbidden)
+				return
+			}
+			r = withActor(r, key.ID+" ("+key.Name+")")
+			if key.Tenant != "" {
+				r = withTenant(r, key.Tenant)
+			}
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -406,29 +505,64 @@ func getClientIP(r *http.Request) string {
 	return ip
 }
 
-// RequestLogger logs HTTP requests with details
+// RequestLogger writes a structured access log entry for each request
+// Assigns a request ID (or keeps a valid incoming X-Request-ID) and echoes it in the response
 func RequestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
-		// Wrap response writer to capture status code
+		requestID := requestIDFromHeader(r.Header.Get(RequestIDHeader))
+		if requestID == "" {
+			requestID = newRequestID()
+			r.Header.Set(RequestIDHeader, requestID)
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		// Handlers fill in tier and selected backend via annotateAccessLog
+		annotations := &accessLogAnnotations{}
+		r = r.WithContext(context.WithValue(r.Context(), accessLogContextKey{}, annotations))
+
+		// Wrap response writer to capture status code and bytes written
 		rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 
 		next.ServeHTTP(rw, r)
 
 		duration := time.Since(start)
-		log.Printf("%s %s from %s - %d (%s)",
-			r.Method,
-			r.URL.Path,
-			getClientIP(r),
-			rw.statusCode,
-			duration)
+		if defaultAccessLogger == nil {
+			log.Printf("%s %s from %s - %d (%s)",
+				r.Method,
+				r.URL.Path,
+				getClientIP(r),
+				rw.statusCode,
+				duration)
+			return
+		}
+
+		annotations.mu.Lock()
+		tier, tierVersion, backend := annotations.tier, annotations.tierVersion, annotations.backend
+		annotations.mu.Unlock()
+
+		defaultAccessLogger.Log(AccessLogEntry{
+			Timestamp:   start.UTC().Format(time.RFC3339Nano),
+			RequestID:   requestID,
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			ClientIP:    getClientIP(r),
+			Status:      rw.statusCode,
+			Bytes:       rw.bytes,
+			DurationMs:  float64(duration.Microseconds()) / 1000,
+			Tier:        tier,
+			TierVersion: tierVersion,
+			Backend:     backend,
+			UserAgent:   r.UserAgent(),
+		})
 	})
 }
 
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int64
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -436,6 +570,12 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
 // Flush implements http.Flusher for SSE support
 func (rw *responseWriter) Flush() {
 	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
@@ -451,6 +591,11 @@ func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return nil, nil, fmt.Errorf("responseWriter does not support hijacking")
 }
 
+// Unwrap lets http.ResponseController reach the underlying connection
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // ChainMiddleware chains multiple middleware functions
 func ChainMiddleware(handler http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
 	for i := len(middlewares) - 1; i >= 0; i-- {
@@ -478,15 +623,22 @@ func HealthCheckBypass(healthPaths []string, next http.Handler) http.Handler {
 
 // CORSConfig stores CORS configuration
 type CORSConfig struct {
-	AllowedOrigins []string
-	AllowedMethods []string
-	AllowedHeaders []string
+	AllowedOrigins       []string
+	AllowedMethods       []string
+	AllowedHeaders       []string
+	PassthroughPreflight func(*http.Request) bool // Optional: OPTIONS requests it accepts are passed to the next handler
 }
 
 // CORS middleware handles Cross-Origin Resource Sharing
 func CORS(config CORSConfig) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Preflights the backend answers itself get no CORS headers from here
+			if r.Method == http.MethodOptions && config.PassthroughPreflight != nil && config.PassthroughPreflight(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			origin := r.Header.Get("Origin")
 
 			// Check if origin is allowed
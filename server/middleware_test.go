@@ -150,6 +150,54 @@ func TestTimeoutWithPanic(t *testing.T) {
 	}
 }
 
+// TestTimeout_ContextDeadline verifies a handler waiting on the request context is answered with 408
+// and its late writes are dropped
+func TestTimeout_ContextDeadline(t *testing.T) {
+	writeErr := make(chan error, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		_, err := w.Write([]byte("late response"))
+		writeErr <- err
+	})
+
+	rec := httptest.NewRecorder()
+	Timeout(20*time.Millisecond)(handler).ServeHTTP(rec, httptest.NewRequest("GET", "/test", nil))
+
+	if rec.Code != http.StatusRequestTimeout {
+		t.Errorf("Expected 408, got %d", rec.Code)
+	}
+	if err := <-writeErr; err != http.ErrHandlerTimeout {
+		t.Errorf("Expected the late write to fail with ErrHandlerTimeout, got %v", err)
+	}
+	if strings.Contains(rec.Body.String(), "late response") {
+		t.Error("Expected the late response to be dropped")
+	}
+}
+
+// TestTimeout_KeepAlive verifies the write deadline of one request does not carry over to the next on the same connection
+func TestTimeout_KeepAlive(t *testing.T) {
+	backend := httptest.NewServer(Timeout(50 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})))
+	defer backend.Close()
+
+	client := backend.Client()
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(backend.URL)
+		if err != nil {
+			t.Fatalf("Request %d failed: %v", i+1, err)
+		}
+		body := new(bytes.Buffer)
+		body.ReadFrom(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || body.String() != "ok" {
+			t.Fatalf("Request %d: expected 200 ok, got %d %q", i+1, resp.StatusCode, body.String())
+		}
+		// Outlast the first request's deadline before reusing the connection
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
 // TestTimeoutWithHeaderRace verifies no "superfluous WriteHeader" error
 // when handler writes headers simultaneously with timeout
 func TestTimeoutWithHeaderRace(t *testing.T) {
@@ -807,6 +855,38 @@ func TestCORS_Wildcard(t *testing.T) {
 	}
 }
 
+// TestCORS_PassthroughPreflight verifies selected preflights reach the next handler untouched
+func TestCORS_PassthroughPreflight(t *testing.T) {
+	config := CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET"},
+		AllowedHeaders: []string{"Content-Type"},
+		PassthroughPreflight: func(r *http.Request) bool {
+			return r.URL.Path == "/backend-cors"
+		},
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wrapped := CORS(config)(handler)
+
+	rec := httptest.NewRecorder()
+	wrapped.ServeHTTP(rec, httptest.NewRequest("OPTIONS", "/backend-cors", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected passthrough preflight to reach handler, got %d", rec.Code)
+	}
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("Expected no local CORS headers on passthrough preflight")
+	}
+
+	rec = httptest.NewRecorder()
+	wrapped.ServeHTTP(rec, httptest.NewRequest("OPTIONS", "/other", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected local preflight answer 204, got %d", rec.Code)
+	}
+}
+
 // TestHealthCheckBypass verifies health check bypass middleware
 func TestHealthCheckBypass(t *testing.T) {
 	healthPaths := []string{"/health", "/healthz", "/ping"}
@@ -1247,3 +1327,17 @@ func TestTimeoutSkipsWebSocket(t *testing.T) {
 	}
 }
 
+// BenchmarkTimeout measures the per-request overhead of the timeout middleware
+func BenchmarkTimeout(b *testing.B) {
+	handler := Timeout(30 * time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	req := httptest.NewRequest("GET", "/test", nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
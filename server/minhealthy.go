@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// minHealthyCheckInterval is how often min_healthy_backends thresholds are evaluated for alerts and metrics
+const minHealthyCheckInterval = 10 * time.Second
+
+// validateMinHealthyBackends checks that thresholds name configured tiers and are positive
+func validateMinHealthyBackends(config *common.ServerConfig) error {
+	tiers := make(map[string]bool, len(config.Tiers))
+	for _, tier := range config.Tiers {
+		tiers[tier.Name] = true
+	}
+	for name, minimum := range config.MinHealthyBackends {
+		if !tiers[name] {
+			return fmt.Errorf("min_healthy_backends: unknown tier %q", name)
+		}
+		if minimum < 1 {
+			return fmt.Errorf("min_healthy_backends: %s must be at least 1", name)
+		}
+	}
+	return nil
+}
+
+// tierHealthLocked counts live, healthy backends that can take each thresholded tier (caller must hold s.mu)
+// Uses the same eligibility as GET /tiers, so a backend that is full counts as unavailable
+func (s *Server) tierHealthLocked() []common.TierHealth {
+	if len(s.config.MinHealthyBackends) == 0 {
+		return nil
+	}
+
+	var specs []common.TierSpec
+	for name := range s.config.MinHealthyBackends {
+		if spec, ok := s.tierSpecs[name]; ok {
+			specs = append(specs, spec)
+		}
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+
+	health := make([]common.TierHealth, 0, len(specs))
+	for _, usage := range s.tierUtilizationLocked(specs, DefaultTenant) {
+		health = append(health, common.TierHealth{
+			Tier:               usage.Name,
+			HealthyBackends:    usage.EligibleBackends,
+			MinHealthyBackends: s.config.MinHealthyBackends[usage.Name],
+		})
+	}
+	return health
+}
+
+// degradedTiers returns the tiers currently below their min_healthy_backends threshold
+func (s *Server) degradedTiers() []common.TierHealth {
+	s.mu.RLock()
+	health := s.tierHealthLocked()
+	s.mu.RUnlock()
+
+	var degraded []common.TierHealth
+	for _, tier := range health {
+		if tier.HealthyBackends < tier.MinHealthyBackends {
+			degraded = append(degraded, tier)
+		}
+	}
+	return degraded
+}
+
+// monitorMinHealthyBackends exports per-tier healthy counts and alerts when a tier crosses its threshold
+func (s *Server) monitorMinHealthyBackends(ctx context.Context) {
+	ticker := time.NewTicker(minHealthyCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkMinHealthyBackends()
+		}
+	}
+}
+
+// checkMinHealthyBackends evaluates every threshold once; webhooks fire only on transitions
+func (s *Server) checkMinHealthyBackends() {
+	s.mu.Lock()
+	health := s.tierHealthLocked()
+	var changed []common.TierHealth
+	for _, tier := range health {
+		below := tier.HealthyBackends < tier.MinHealthyBackends
+		if below != s.belowMinHealthy[tier.Tier] {
+			s.belowMinHealthy[tier.Tier] = below
+			changed = append(changed, tier)
+		}
+	}
+	s.mu.Unlock()
+
+	s.exporters.ExportPoints(tierHealthPoints(health, time.Now()))
+
+	for _, tier := range changed {
+		data := map[string]interface{}{
+			"tier":                 tier.Tier,
+			"healthy_backends":     tier.HealthyBackends,
+			"min_healthy_backends": tier.MinHealthyBackends,
+		}
+		if tier.HealthyBackends < tier.MinHealthyBackends {
+			LogWarnWithData("Tier below minimum healthy backends", data)
+			s.emit("tier.degraded", data)
+		} else {
+			LogInfoWithData("Tier back at minimum healthy backends", data)
+			s.emit("tier.recovered", data)
+		}
+	}
+}
+
+// tierHealthPoints renders per-tier healthy backend counts for the stats exporters
+func tierHealthPoints(health []common.TierHealth, ts time.Time) []statsPoint {
+	points := make([]statsPoint, 0, len(health)*3)
+	for _, tier := range health {
+		labels := []statsLabel{{"tier", tier.Tier}, {"tenant", DefaultTenant}}
+		degraded := 0.0
+		if tier.HealthyBackends < tier.MinHealthyBackends {
+			degraded = 1
+		}
+		points = append(points,
+			statsPoint{"opsen_tier", "healthy_backends", labels, float64(tier.HealthyBackends), ts},
+			statsPoint{"opsen_tier", "min_healthy_backends", labels, float64(tier.MinHealthyBackends), ts},
+			statsPoint{"opsen_tier", "degraded", labels, degraded, ts},
+		)
+	}
+	return points
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+func getHealth(t *testing.T, server *Server) common.HealthCheckResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	server.handleHealth(rec, httptest.NewRequest("GET", "/health", nil))
+	var resp common.HealthCheckResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode health response: %v", err)
+	}
+	return resp
+}
+
+// TestMinHealthyBackends_DegradedAndRecovered verifies /health and alert state follow a tier's healthy backend count
+func TestMinHealthyBackends_DegradedAndRecovered(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.MinHealthyBackends = map[string]int{"lite": 2}
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-a"}))
+
+	health := getHealth(t, server)
+	if health.Status != "degraded" || len(health.DegradedTiers) != 1 {
+		t.Fatalf("Expected lite to be degraded with one backend, got %+v", health)
+	}
+	if tier := health.DegradedTiers[0]; tier.Tier != "lite" || tier.HealthyBackends != 1 || tier.MinHealthyBackends != 2 {
+		t.Errorf("Unexpected degraded tier: %+v", tier)
+	}
+
+	server.checkMinHealthyBackends()
+	if !server.belowMinHealthy["lite"] {
+		t.Error("Expected lite to be recorded below its minimum")
+	}
+
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-b"}))
+	if health := getHealth(t, server); health.Status != "ok" || len(health.DegradedTiers) != 0 {
+		t.Errorf("Expected ok with two backends, got %+v", health)
+	}
+	server.checkMinHealthyBackends()
+	if server.belowMinHealthy["lite"] {
+		t.Error("Expected lite to be recorded as recovered")
+	}
+}
+
+// TestValidateMinHealthyBackends verifies thresholds must name a configured tier and be positive
+func TestValidateMinHealthyBackends(t *testing.T) {
+	config := &common.ServerConfig{Tiers: []common.TierSpec{{Name: "lite"}}}
+
+	config.MinHealthyBackends = map[string]int{"lite": 3}
+	if err := validateMinHealthyBackends(config); err != nil {
+		t.Errorf("Expected valid thresholds, got %v", err)
+	}
+	config.MinHealthyBackends = map[string]int{"pro-turbo": 3}
+	if err := validateMinHealthyBackends(config); err == nil {
+		t.Error("Expected an unknown tier to be rejected")
+	}
+	config.MinHealthyBackends = map[string]int{"lite": 0}
+	if err := validateMinHealthyBackends(config); err == nil {
+		t.Error("Expected a threshold below 1 to be rejected")
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// outlierBuckets is the number of slices the error-rate window is divided into
+const outlierBuckets = 10
+
+type outlierBucket struct {
+	start    time.Time
+	requests int
+	errors   int
+}
+
+// outlierState tracks one backend's recent proxied outcomes and ejection history
+type outlierState struct {
+	buckets      [outlierBuckets]outlierBucket
+	ejectedUntil time.Time // Backend receives no new traffic until then
+	readmitUntil time.Time // Traffic ramps back up until then
+	ejections    int       // Consecutive ejections (multiplies the ejection length)
+}
+
+// OutlierStatus is the outlier view of a backend reported by /clients
+type OutlierStatus struct {
+	Requests     int       `json:"requests"`
+	ErrorRatePct float64   `json:"error_rate_pct"`
+	Ejected      bool      `json:"ejected"`
+	EjectedUntil time.Time `json:"ejected_until,omitempty"`
+	Readmitting  bool      `json:"readmitting,omitempty"`
+	Ejections    int       `json:"ejections,omitempty"`
+}
+
+// OutlierDetector ejects backends whose proxied requests fail (5xx or connection errors) too often
+// within a sliding window, similar to Envoy outlier detection. Health probes often pass while the
+// application is half-broken; this catches it from real traffic.
+type OutlierDetector struct {
+	mu     sync.Mutex
+	config common.OutlierDetectionConfig
+	states map[string]*outlierState
+	now    func() time.Time
+	rand   func() float64
+}
+
+// NewOutlierDetector creates a detector, or returns nil if outlier detection is disabled
+func NewOutlierDetector(config common.OutlierDetectionConfig) *OutlierDetector {
+	if !config.Enabled {
+		return nil
+	}
+	if config.WindowSecs <= 0 {
+		config.WindowSecs = 60
+	}
+	return &OutlierDetector{
+		config: config,
+		states: make(map[string]*outlierState),
+		now:    time.Now,
+		rand:   rand.Float64,
+	}
+}
+
+func (d *OutlierDetector) bucketWidth() time.Duration {
+	return time.Duration(d.config.WindowSecs) * time.Second / outlierBuckets
+}
+
+// windowCountsLocked sums requests and errors within the window
+func (d *OutlierDetector) windowCountsLocked(state *outlierState, now time.Time) (requests, errors int) {
+	cutoff := now.Add(-time.Duration(d.config.WindowSecs) * time.Second)
+	for _, bucket := range state.buckets {
+		if bucket.start.After(cutoff) {
+			requests += bucket.requests
+			errors += bucket.errors
+		}
+	}
+	return requests, errors
+}
+
+// Record adds a proxied request outcome and ejects the backend if its error rate is too high
+// totalBackends bounds how many backends may be ejected at once
+func (d *OutlierDetector) Record(clientID string, failed bool, totalBackends int) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	state, ok := d.states[clientID]
+	if !ok {
+		state = &outlierState{}
+		d.states[clientID] = state
+	}
+	if now.Before(state.ejectedUntil) {
+		// Requests already in flight when the backend was ejected
+		return
+	}
+
+	width := d.bucketWidth()
+	start := now.Truncate(width)
+	bucket := &state.buckets[(start.UnixNano()/int64(width))%outlierBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = outlierBucket{start: start}
+	}
+	bucket.requests++
+	if failed {
+		bucket.errors++
+	}
+
+	requests, errors := d.windowCountsLocked(state, now)
+	if requests < d.config.MinRequests || requests == 0 {
+		return
+	}
+	errorRate := float64(errors) / float64(requests) * 100
+	if errorRate < d.config.ErrorRatePct {
+		return
+	}
+
+	if !d.canEjectLocked(now, totalBackends) {
+		LogWarnWithData("Outlier ejection skipped: too many backends already ejected", map[string]interface{}{
+			"client_id":      clientID,
+			"error_rate_pct": errorRate,
+		})
+		return
+	}
+
+	// Consecutive ejections grow the ejection length; a backend that stayed healthy
+	// for a full max ejection period after re-admission starts over
+	if !state.readmitUntil.IsZero() &&
+		now.Sub(state.readmitUntil) > time.Duration(d.config.MaxEjectionSecs)*time.Second {
+		state.ejections = 0
+	}
+	state.ejections++
+
+	duration := time.Duration(d.config.BaseEjectionSecs*state.ejections) * time.Second
+	if maxDuration := time.Duration(d.config.MaxEjectionSecs) * time.Second; maxDuration > 0 && duration > maxDuration {
+		duration = maxDuration
+	}
+	state.ejectedUntil = now.Add(duration)
+	state.readmitUntil = state.ejectedUntil.Add(time.Duration(d.config.ReadmitSecs) * time.Second)
+	state.buckets = [outlierBuckets]outlierBucket{}
+
+	LogWarnWithData("Ejected backend with high error rate", map[string]interface{}{
+		"client_id":      clientID,
+		"error_rate_pct": errorRate,
+		"requests":       requests,
+		"ejection":       duration.String(),
+		"ejections":      state.ejections,
+	})
+}
+
+// canEjectLocked reports whether another backend may be ejected without exceeding max_ejection_pct
+func (d *OutlierDetector) canEjectLocked(now time.Time, totalBackends int) bool {
+	if totalBackends <= 0 {
+		return false
+	}
+	ejected := 0
+	for _, state := range d.states {
+		if now.Before(state.ejectedUntil) {
+			ejected++
+		}
+	}
+	return float64(ejected+1)/float64(totalBackends)*100 <= d.config.MaxEjectionPct
+}
+
+// Ejected reports whether a backend is currently ejected
+func (d *OutlierDetector) Ejected(clientID string) bool {
+	if d == nil {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, ok := d.states[clientID]
+	return ok && d.now().Before(state.ejectedUntil)
+}
+
+// Admit reports whether a backend may receive a new placement
+// Ejected backends are skipped; after an ejection the admitted share ramps up linearly over readmit_seconds
+func (d *OutlierDetector) Admit(clientID string) bool {
+	if d == nil {
+		return true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, ok := d.states[clientID]
+	if !ok {
+		return true
+	}
+	now := d.now()
+	if now.Before(state.ejectedUntil) {
+		return false
+	}
+	if now.Before(state.readmitUntil) {
+		ramp := state.readmitUntil.Sub(state.ejectedUntil)
+		progress := float64(now.Sub(state.ejectedUntil)) / float64(ramp)
+		return d.rand() < progress
+	}
+	return true
+}
+
+// Status returns the outlier view of a backend
+func (d *OutlierDetector) Status(clientID string) OutlierStatus {
+	if d == nil {
+		return OutlierStatus{}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, ok := d.states[clientID]
+	if !ok {
+		return OutlierStatus{}
+	}
+	now := d.now()
+	requests, errors := d.windowCountsLocked(state, now)
+	status := OutlierStatus{
+		Requests:    requests,
+		Ejected:     now.Before(state.ejectedUntil),
+		Readmitting: !now.Before(state.ejectedUntil) && now.Before(state.readmitUntil),
+		Ejections:   state.ejections,
+	}
+	if requests > 0 {
+		status.ErrorRatePct = float64(errors) / float64(requests) * 100
+	}
+	if status.Ejected {
+		status.EjectedUntil = state.ejectedUntil
+	}
+	return status
+}
+
+// Remove forgets a deregistered backend
+func (d *OutlierDetector) Remove(clientID string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	delete(d.states, clientID)
+	d.mu.Unlock()
+}
+
+// recordProxyOutcome feeds a proxied request result to the circuit breaker and outlier detection
+func (s *Server) recordProxyOutcome(clientID string, failed bool) {
+	if s.breakers.Record(clientID, failed) {
+		s.routeCache.Invalidate(clientID) // Cached anonymous picks must not keep sending traffic to it
+	}
+	if s.outliers == nil {
+		return
+	}
+	s.mu.RLock()
+	totalBackends := len(s.clientCache)
+	s.mu.RUnlock()
+	s.outliers.Record(clientID, failed, totalBackends)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// newTestOutlierDetector creates an enabled detector with a controllable clock
+func newTestOutlierDetector(now *time.Time) *OutlierDetector {
+	d := NewOutlierDetector(common.OutlierDetectionConfig{
+		Enabled:          true,
+		WindowSecs:       60,
+		MinRequests:      10,
+		ErrorRatePct:     50,
+		BaseEjectionSecs: 30,
+		MaxEjectionSecs:  300,
+		MaxEjectionPct:   50,
+		ReadmitSecs:      20,
+	})
+	d.now = func() time.Time { return *now }
+	return d
+}
+
+// TestOutlierDetector_EjectAndReadmit verifies ejection on high error rates, the readmission ramp and growing ejections
+func TestOutlierDetector_EjectAndReadmit(t *testing.T) {
+	now := time.Now()
+	d := newTestOutlierDetector(&now)
+	d.rand = func() float64 { return 0.5 }
+
+	for i := 0; i < 5; i++ {
+		d.Record("backend-1", false, 4)
+	}
+	for i := 0; i < 4; i++ {
+		d.Record("backend-1", true, 4)
+	}
+	if d.Ejected("backend-1") {
+		t.Fatal("Expected no ejection below min_requests")
+	}
+
+	d.Record("backend-1", true, 4)
+	if !d.Ejected("backend-1") || d.Admit("backend-1") {
+		t.Fatal("Expected backend to be ejected at 50% errors over 10 requests")
+	}
+
+	// Readmission ramps from 0 to 100% over 20s (rand fixed at 0.5)
+	now = now.Add(35 * time.Second)
+	if d.Ejected("backend-1") || d.Admit("backend-1") {
+		t.Error("Expected backend out of ejection but not yet admitted at 25% of the ramp")
+	}
+	now = now.Add(10 * time.Second)
+	if !d.Admit("backend-1") {
+		t.Error("Expected backend admitted at 75% of the ramp")
+	}
+	if status := d.Status("backend-1"); !status.Readmitting || status.Ejections != 1 {
+		t.Errorf("Expected readmitting status after one ejection, got %+v", status)
+	}
+
+	// A second ejection lasts twice as long
+	for i := 0; i < 10; i++ {
+		d.Record("backend-1", true, 4)
+	}
+	ejectedAt := now
+	if status := d.Status("backend-1"); !status.Ejected || status.EjectedUntil.Sub(ejectedAt) != 60*time.Second {
+		t.Errorf("Expected a 60s second ejection, got %+v", status)
+	}
+}
+
+// TestOutlierDetector_MaxEjectionPct verifies ejections stop once the share of ejected backends is reached
+func TestOutlierDetector_MaxEjectionPct(t *testing.T) {
+	now := time.Now()
+	d := newTestOutlierDetector(&now)
+
+	for _, id := range []string{"backend-1", "backend-2"} {
+		for i := 0; i < 10; i++ {
+			d.Record(id, true, 2)
+		}
+	}
+
+	if !d.Ejected("backend-1") {
+		t.Error("Expected first failing backend to be ejected")
+	}
+	if d.Ejected("backend-2") {
+		t.Error("Expected second backend to stay in rotation at max_ejection_pct 50")
+	}
+}
+
+// TestProxy_OutlierEjection verifies proxied 5xx responses eject a backend from routing
+func TestProxy_OutlierEjection(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+	defer backend.Close()
+
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.OutlierDetection = common.OutlierDetectionConfig{
+			Enabled:          true,
+			WindowSecs:       60,
+			MinRequests:      3,
+			ErrorRatePct:     50,
+			BaseEjectionSecs: 30,
+			MaxEjectionPct:   100,
+		}
+	})
+	client := NewMockClient(MockClientOptions{
+		ClientID:    "broken-backend",
+		Endpoint:    backend.URL,
+		CPUUsageAvg: []float64{10, 10, 10, 10, 10, 10, 10, 10},
+		MemoryAvail: 50.0,
+		DiskAvail:   100.0,
+	})
+	server.AddMockClient(client)
+
+	for i := 0; i < 3; i++ {
+		server.ClearPendingAllocations()
+		rec := httptest.NewRecorder()
+		server.handleProxy(rec, httptest.NewRequest("GET", "/api/test", nil))
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected backend 500 to be passed through, got %d", rec.Code)
+		}
+	}
+
+	server.ClearPendingAllocations()
+	rec := httptest.NewRecorder()
+	server.handleProxy(rec, httptest.NewRequest("GET", "/api/test", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 once the only backend is ejected, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cyqle.in/opsen/common"
+	"github.com/google/uuid"
+)
+
+// validateParentConfig checks hierarchical mode settings at startup
+func validateParentConfig(config common.ParentConfig) error {
+	if config.URL == "" {
+		return nil
+	}
+	if config.EndpointURL == "" {
+		return fmt.Errorf("parent: endpoint_url is required so the parent can reach this server")
+	}
+	switch config.AuthMode {
+	case "", common.AuthModeKey, common.AuthModeHMAC:
+	default:
+		return fmt.Errorf("parent: unknown auth_mode %q (want %s or %s)", config.AuthMode, common.AuthModeKey, common.AuthModeHMAC)
+	}
+	if config.ReportIntervalSecs < 0 {
+		return fmt.Errorf("parent: report_interval_seconds must be >= 0")
+	}
+	return nil
+}
+
+// ParentReporter registers this server as a backend of a parent opsen server and reports
+// the aggregate capacity of its fleet as that backend's resources
+type ParentReporter struct {
+	server     *Server
+	config     common.ParentConfig
+	instanceID string
+	httpClient *http.Client
+	registered string // Capacity signature of the last accepted registration (empty = not registered)
+}
+
+// NewParentReporter returns nil when no parent is configured
+func NewParentReporter(server *Server, config common.ParentConfig) *ParentReporter {
+	if config.URL == "" {
+		return nil
+	}
+	hostname, _ := os.Hostname()
+	if config.ClientID == "" {
+		config.ClientID = hostname
+	}
+	if config.Hostname == "" {
+		config.Hostname = hostname
+	}
+	config.URL = strings.TrimSuffix(config.URL, "/")
+	return &ParentReporter{
+		server:     server,
+		config:     config,
+		instanceID: uuid.New().String(),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Run reports to the parent on an interval until ctx is cancelled
+func (p *ParentReporter) Run(ctx context.Context) {
+	interval := time.Duration(p.config.ReportIntervalSecs) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Report(); err != nil {
+			LogWarnWithData("Failed to report to parent server", map[string]interface{}{
+				"parent": p.config.URL,
+				"error":  err.Error(),
+			})
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Report registers with the parent when the fleet's capacity changed (or after a rejected report),
+// then sends the current aggregate stats
+func (p *ParentReporter) Report() error {
+	registration, stats := p.aggregate(time.Now())
+
+	signature := fmt.Sprintf("%d/%.2f/%.2f/%d/%s/%.4f,%.4f", registration.TotalCPU, registration.TotalMemory,
+		registration.TotalStorage, registration.TotalGPUs, strings.Join(registration.GPUModels, ","),
+		registration.Latitude, registration.Longitude)
+	if signature != p.registered {
+		body, _ := json.Marshal(registration)
+		if err := p.post("/register", body); err != nil {
+			return err
+		}
+		p.registered = signature
+		LogInfoWithData("Registered with parent server", map[string]interface{}{
+			"parent":    p.config.URL,
+			"client_id": registration.ClientID,
+			"total_cpu": registration.TotalCPU,
+			"memory_gb": registration.TotalMemory,
+			"gpus":      registration.TotalGPUs,
+		})
+	}
+
+	body, _ := json.Marshal(stats)
+	if err := p.post("/stats", body); err != nil {
+		// The parent may have forgotten or replaced this backend; register again next time
+		p.registered = ""
+		return err
+	}
+	return nil
+}
+
+// aggregate sums the registrations and latest stats of live, healthy backends
+// CPU cores and GPUs are reported side by side, so per-core and per-GPU placement at the parent
+// sees the fleet's individual cores rather than an average
+func (p *ParentReporter) aggregate(now time.Time) (common.ClientRegistration, common.ResourceStats) {
+	registration := common.ClientRegistration{
+		SchemaVersion:      common.SchemaVersion,
+		ClientID:           p.config.ClientID,
+		Hostname:           p.config.Hostname,
+		EndpointURL:        p.config.EndpointURL,
+		Latitude:           p.config.Latitude,
+		Longitude:          p.config.Longitude,
+		Country:            p.config.Country,
+		City:               p.config.City,
+		Tenant:             p.config.Tenant,
+		Pool:               p.config.Pool,
+		InstanceID:         p.instanceID,
+		ReportIntervalSecs: p.config.ReportIntervalSecs,
+	}
+	stats := common.ResourceStats{
+		SchemaVersion: common.SchemaVersion,
+		ClientID:      p.config.ClientID,
+		InstanceID:    p.instanceID,
+		Hostname:      p.config.Hostname,
+		Timestamp:     now,
+		CPUUsageAvg:   []float64{},
+	}
+
+	s := p.server
+	var latSum, lonSum float64
+	located := 0
+
+	s.mu.RLock()
+	for _, client := range s.clientCache {
+		if now.Sub(client.LastSeen) > s.staleTimeoutFor(client) || s.awaitingApproval(client) {
+			continue
+		}
+		if s.config.HealthCheckEnabled && client.HealthStatus == "unhealthy" {
+			continue
+		}
+
+		reg := client.Registration
+		registration.TotalCPU += reg.TotalCPU
+		registration.TotalMemory += reg.TotalMemory
+		registration.TotalStorage += reg.TotalStorage
+		registration.TotalGPUs += reg.TotalGPUs
+		registration.GPUModels = append(registration.GPUModels, reg.GPUModels...)
+		registration.GPUComputeCapabilities = append(registration.GPUComputeCapabilities, reg.GPUComputeCapabilities...)
+		registration.HourlyCost += client.HourlyCost
+		if reg.Latitude != 0 || reg.Longitude != 0 {
+			latSum += reg.Latitude
+			lonSum += reg.Longitude
+			located++
+		}
+
+		st := client.Stats
+		stats.CPUCores += st.CPUCores
+		stats.CPUUsageAvg = append(stats.CPUUsageAvg, st.CPUUsageAvg...)
+		stats.MemoryTotal += st.MemoryTotal
+		stats.MemoryUsed += st.MemoryUsed
+		stats.MemoryAvail += st.MemoryAvail
+		stats.DiskTotal += st.DiskTotal
+		stats.DiskUsed += st.DiskUsed
+		stats.DiskAvail += st.DiskAvail
+		stats.LoadAvg1 += st.LoadAvg1
+		stats.LoadAvg5 += st.LoadAvg5
+		stats.LoadAvg15 += st.LoadAvg15
+		stats.SwapTotal += st.SwapTotal
+		stats.SwapUsed += st.SwapUsed
+		for _, gpu := range st.GPUs {
+			gpu.DeviceID = len(stats.GPUs)
+			gpu.RecentXIDs = nil
+			stats.GPUs = append(stats.GPUs, gpu)
+		}
+	}
+	s.mu.RUnlock()
+
+	if registration.Latitude == 0 && registration.Longitude == 0 && located > 0 {
+		registration.Latitude = latSum / float64(located)
+		registration.Longitude = lonSum / float64(located)
+	}
+	return registration, stats
+}
+
+// post sends an agent request to the parent, authenticated like an agent would
+func (p *ParentReporter) post(path string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, p.config.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if p.config.ServerKey != "" {
+		if p.config.AuthMode == common.AuthModeHMAC {
+			nonce, err := common.NewNonce()
+			if err != nil {
+				return fmt.Errorf("failed to generate nonce: %w", err)
+			}
+			timestamp := time.Now().Unix()
+			req.Header.Set(common.SignatureTimestampHeader, strconv.FormatInt(timestamp, 10))
+			req.Header.Set(common.SignatureNonceHeader, nonce)
+			req.Header.Set(common.SignatureHeader, common.SignRequest(p.config.ServerKey, timestamp, nonce, http.MethodPost, req.URL.Path, body))
+		} else {
+			req.Header.Set("X-API-Key", p.config.ServerKey)
+		}
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s failed: %s: %s", path, resp.Status, strings.TrimSpace(string(bodyBytes)))
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestParentReporter_AggregatesFleet verifies a regional server registers into a parent with the summed
+// capacity of its live backends and re-registers when that capacity changes
+func TestParentReporter_AggregatesFleet(t *testing.T) {
+	parentDB, cleanupParent := CreateTestDB(t)
+	defer cleanupParent()
+	parent := NewTestServer(t, parentDB)
+
+	registrations := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
+		registrations++
+		parent.handleRegister(w, r)
+	})
+	mux.HandleFunc("/stats", parent.handleStats)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	regional := NewTestServer(t, db)
+	regional.AddMockClient(NewMockClient(MockClientOptions{ClientID: "a", Latitude: 50, Longitude: 8}))
+	regional.AddMockClient(NewMockClient(MockClientOptions{ClientID: "b", Latitude: 52, Longitude: 10,
+		TotalGPUs: 1, GPUModels: []string{"A100"}, GPUs: []common.GPUStats{{DeviceID: 0, Name: "A100", MemoryTotalGB: 80}}}))
+	regional.AddMockClient(NewMockClient(MockClientOptions{ClientID: "stale", LastSeen: time.Now().Add(-time.Hour)}))
+
+	reporter := NewParentReporter(regional, common.ParentConfig{
+		URL:         ts.URL,
+		ClientID:    "eu-west",
+		EndpointURL: "http://eu-west.example.com",
+	})
+	if err := reporter.Report(); err != nil {
+		t.Fatalf("Report failed: %v", err)
+	}
+
+	parent.mu.RLock()
+	backend, ok := parent.clientCache["eu-west"]
+	parent.mu.RUnlock()
+	if !ok {
+		t.Fatal("Expected the regional server to be registered at the parent")
+	}
+	if backend.Registration.TotalCPU != 16 || backend.Registration.TotalMemory != 64 || backend.Registration.TotalGPUs != 1 {
+		t.Errorf("Expected 16 CPUs, 64 GB and 1 GPU from the live backends, got %d, %.0f GB, %d",
+			backend.Registration.TotalCPU, backend.Registration.TotalMemory, backend.Registration.TotalGPUs)
+	}
+	if backend.Registration.Latitude != 51 || backend.Registration.Longitude != 9 {
+		t.Errorf("Expected the backends' centroid (51, 9), got (%.1f, %.1f)", backend.Registration.Latitude, backend.Registration.Longitude)
+	}
+	if len(backend.Stats.CPUUsageAvg) != 16 || backend.Stats.MemoryAvail != 48 || len(backend.Stats.GPUs) != 1 {
+		t.Errorf("Expected 16 cores, 48 GB available and 1 GPU in stats, got %d, %.0f GB, %d",
+			len(backend.Stats.CPUUsageAvg), backend.Stats.MemoryAvail, len(backend.Stats.GPUs))
+	}
+
+	// Unchanged capacity only sends stats
+	if err := reporter.Report(); err != nil {
+		t.Fatalf("Report failed: %v", err)
+	}
+	if registrations != 1 {
+		t.Errorf("Expected 1 registration while capacity is unchanged, got %d", registrations)
+	}
+
+	regional.AddMockClient(NewMockClient(MockClientOptions{ClientID: "c", Latitude: 51, Longitude: 9}))
+	if err := reporter.Report(); err != nil {
+		t.Fatalf("Report failed: %v", err)
+	}
+	if registrations != 2 {
+		t.Errorf("Expected a new registration after a backend joined, got %d registrations", registrations)
+	}
+	parent.mu.RLock()
+	totalCPU := parent.clientCache["eu-west"].Registration.TotalCPU
+	parent.mu.RUnlock()
+	if totalCPU != 24 {
+		t.Errorf("Expected 24 CPUs after a backend joined, got %d", totalCPU)
+	}
+}
+
+// TestValidateParentConfig verifies hierarchical mode requires an endpoint the parent can route to
+func TestValidateParentConfig(t *testing.T) {
+	if err := validateParentConfig(common.ParentConfig{}); err != nil {
+		t.Errorf("Expected no parent to be valid, got %v", err)
+	}
+	if err := validateParentConfig(common.ParentConfig{URL: "http://global:8080"}); err == nil {
+		t.Error("Expected an error without endpoint_url")
+	}
+	if err := validateParentConfig(common.ParentConfig{URL: "http://global:8080", EndpointURL: "http://eu:8080", AuthMode: "token"}); err == nil {
+		t.Error("Expected an error for an unknown auth_mode")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// errCodePendingLimit is sent in X-LB-Error-Code when a placement is refused by the pending allocation caps
+const errCodePendingLimit = "pending_limit"
+
+// validatePendingLimits checks max_pending_per_backend and max_pending_total
+func validatePendingLimits(config *common.ServerConfig) error {
+	if config.MaxPendingPerBackend < 0 {
+		return fmt.Errorf("max_pending_per_backend must be >= 0")
+	}
+	if config.MaxPendingTotal < 0 {
+		return fmt.Errorf("max_pending_total must be >= 0")
+	}
+	return nil
+}
+
+// pendingCountsLocked returns the unexpired pending allocations across the fleet and how many backends
+// are at max_pending_per_backend (caller must hold s.mu)
+func (s *Server) pendingCountsLocked(now time.Time) (total, backendsAtLimit int) {
+	for _, allocations := range s.pendingAllocations {
+		held := 0
+		for _, pending := range allocations {
+			if !pending.expired(now) {
+				held++
+			}
+		}
+		total += held
+		if s.config.MaxPendingPerBackend > 0 && held >= s.config.MaxPendingPerBackend {
+			backendsAtLimit++
+		}
+	}
+	return total, backendsAtLimit
+}
+
+// admitPendingAllocation reserves resources like addPendingAllocation, unless the reservation would exceed
+// max_pending_total or the backend's max_pending_per_backend. The caps are checked and the reservation made
+// under one lock, so a stampede of concurrent placements cannot overshoot them; a refused placement changes nothing
+func (s *Server) admitPendingAllocation(clientID, stickyID, tier string, tierSpec common.TierSpec, requestID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.admitPendingAllocationLocked(clientID, stickyID, tier, tierSpec, requestID)
+}
+
+// admitPendingAllocationLocked is admitPendingAllocation for callers already holding s.mu (write)
+func (s *Server) admitPendingAllocationLocked(clientID, stickyID, tier string, tierSpec common.TierSpec, requestID string) bool {
+	// A repeated sticky_id+tier placement replaces its previous allocation, so that one does not count
+	replaces := stickyID != "" && tier != ""
+
+	if s.config.MaxPendingTotal > 0 || s.config.MaxPendingPerBackend > 0 {
+		now := time.Now()
+		total, _ := s.pendingCountsLocked(now)
+		held, _ := reservationTotals(s.pendingAllocations[clientID], now)
+		if replaces {
+			replaced := s.pendingForStickyTierLocked(clientID, stickyID, tier, now)
+			total -= replaced
+			held.allocations -= replaced
+		}
+		if (s.config.MaxPendingTotal > 0 && total >= s.config.MaxPendingTotal) ||
+			(s.config.MaxPendingPerBackend > 0 && held.allocations >= s.config.MaxPendingPerBackend) {
+			LogWarnWithData("Placement refused by pending allocation limits", map[string]interface{}{
+				"client_id":               clientID,
+				"tier":                    tier,
+				"pending_total":           total,
+				"pending_on_backend":      held.allocations,
+				"max_pending_total":       s.config.MaxPendingTotal,
+				"max_pending_per_backend": s.config.MaxPendingPerBackend,
+			})
+			return false
+		}
+	}
+
+	if replaces {
+		s.removePendingAllocationForStickyTierLocked(clientID, stickyID, tier)
+	}
+	s.addPendingAllocationLocked(clientID, stickyID, tier, tierSpec, requestID)
+	return true
+}
+
+// pendingForStickyTierLocked counts a backend's unexpired allocations for a sticky_id+tier (caller must hold s.mu)
+func (s *Server) pendingForStickyTierLocked(clientID, stickyID, tier string, now time.Time) int {
+	count := 0
+	for _, pending := range s.pendingAllocations[clientID] {
+		if pending.StickyID == stickyID && pending.Tier == tier && !pending.expired(now) {
+			count++
+		}
+	}
+	return count
+}
+
+// pendingLimitReached reports whether a failed placement was refused by the pending allocation caps rather
+// than by capacity: the fleet is at max_pending_total, or a backend that would fit is at max_pending_per_backend
+func (s *Server) pendingLimitReached(tier common.TierSpec) bool {
+	if s.config.MaxPendingTotal <= 0 && s.config.MaxPendingPerBackend <= 0 {
+		return false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	total, _ := s.pendingCountsLocked(time.Now())
+	if s.config.MaxPendingTotal > 0 && total >= s.config.MaxPendingTotal {
+		return true
+	}
+	if s.config.MaxPendingPerBackend <= 0 {
+		return false
+	}
+	for _, client := range s.clientCache {
+		if !s.routable(client) || s.sessionsFullLocked(client) {
+			continue
+		}
+		pending := s.pendingReservationLocked(client.Registration.ClientID)
+		if pending.allocations < s.config.MaxPendingPerBackend {
+			continue
+		}
+		pending.allocations = 0
+		if s.fitsTier(client, tier, s.tierHeadroomLocked(client, tier), pending) {
+			return true
+		}
+	}
+	return false
+}
+
+// writePendingLimit answers a placement refused by the pending allocation caps with 429
+// In-flight placements complete or expire within seconds, so clients should retry shortly
+func (s *Server) writePendingLimit(w http.ResponseWriter, tier common.TierSpec) {
+	s.publishRouteFailed(tier, errCodePendingLimit)
+	w.Header().Set("Retry-After", "1")
+	w.Header().Set(LBErrorCodeHeader, errCodePendingLimit)
+	http.Error(w, fmt.Sprintf("Too many placements in flight for tier %s, retry shortly", tier.Name), http.StatusTooManyRequests)
+}
+
+// setPendingCounts adds the pending allocation counts to a /health response
+func (s *Server) setPendingCounts(response *common.HealthCheckResponse) {
+	s.mu.RLock()
+	total, atLimit := s.pendingCountsLocked(time.Now())
+	s.mu.RUnlock()
+
+	response.PendingAllocations = total
+	response.MaxPendingTotal = s.config.MaxPendingTotal
+	response.BackendsAtPendingLimit = atLimit
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+func routeTier(server *Server, tier string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(common.RoutingRequest{Tier: tier})
+	rec := httptest.NewRecorder()
+	server.handleRoute(rec, httptest.NewRequest("POST", "/route", bytes.NewReader(body)))
+	return rec
+}
+
+// TestPendingLimits_PerBackend verifies a backend at max_pending_per_backend is skipped, and that
+// placements are rejected with 429 once every backend that fits is at its cap
+func TestPendingLimits_PerBackend(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.MaxPendingPerBackend = 1
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-a"}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-b"}))
+
+	placed := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		rec := routeTier(server, "lite")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected placement %d to succeed, got %d: %s", i+1, rec.Code, rec.Body.String())
+		}
+		var response common.RoutingResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		placed[response.ClientID] = true
+	}
+	if len(placed) != 2 {
+		t.Errorf("Expected the second placement to go to the other backend, got %v", placed)
+	}
+
+	rec := routeTier(server, "lite")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get(LBErrorCodeHeader) != errCodePendingLimit {
+		t.Fatalf("Expected 429 %s, got %d %q: %s", errCodePendingLimit, rec.Code, rec.Header().Get(LBErrorCodeHeader), rec.Body.String())
+	}
+
+	health := getHealth(t, server)
+	if health.PendingAllocations != 2 || health.BackendsAtPendingLimit != 2 {
+		t.Errorf("Expected 2 pending allocations and 2 backends at the limit in /health, got %+v", health)
+	}
+
+	server.ClearPendingAllocations()
+	if rec := routeTier(server, "lite"); rec.Code != http.StatusOK {
+		t.Errorf("Expected placements to resume once allocations completed, got %d", rec.Code)
+	}
+}
+
+// TestPendingLimits_Total verifies max_pending_total caps in-flight placements fleet-wide, even under a stampede
+func TestPendingLimits_Total(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.MaxPendingTotal = 3
+	})
+	for _, id := range []string{"backend-a", "backend-b", "backend-c", "backend-d"} {
+		server.AddMockClient(NewMockClient(MockClientOptions{ClientID: id, TotalCPU: 32, TotalMemory: 128, MemoryAvail: 120}))
+	}
+
+	var mu sync.Mutex
+	codes := make(map[int]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := routeTier(server, "free")
+			mu.Lock()
+			codes[rec.Code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if codes[http.StatusOK] != 3 || codes[http.StatusTooManyRequests] != 17 {
+		t.Errorf("Expected 3 placements and 17 rejections, got %v", codes)
+	}
+
+	health := getHealth(t, server)
+	if health.PendingAllocations != 3 || health.MaxPendingTotal != 3 {
+		t.Errorf("Expected 3 of 3 pending allocations in /health, got %+v", health)
+	}
+}
+
+// TestPendingLimits_NoCapacityUnaffected verifies capacity exhaustion is still reported as 503 no_capacity
+func TestPendingLimits_NoCapacityUnaffected(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.MaxPendingPerBackend = 5
+		c.MaxPendingTotal = 10
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-a", TotalCPU: 2}))
+
+	rec := routeTier(server, "pro-max")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get(LBErrorCodeHeader) != errCodeNoCapacity {
+		t.Errorf("Expected 503 %s, got %d %q", errCodeNoCapacity, rec.Code, rec.Header().Get(LBErrorCodeHeader))
+	}
+}
+
+// TestPendingLimits_RefusalKeepsReplacedAllocation verifies a repeated sticky placement at the cap replaces its own
+// allocation, and a refused placement leaves existing allocations untouched
+func TestPendingLimits_RefusalKeepsReplacedAllocation(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.MaxPendingPerBackend = 1
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-a"}))
+	tier := server.config.Tiers[0]
+
+	if !server.admitPendingAllocation("backend-a", "default:user-1", tier.Name, tier, "req-1") {
+		t.Fatal("Expected the first placement to be admitted")
+	}
+	if !server.admitPendingAllocation("backend-a", "default:user-1", tier.Name, tier, "req-2") {
+		t.Error("Expected a repeated placement to replace its own allocation at the cap")
+	}
+	if server.admitPendingAllocation("backend-a", "default:user-2", tier.Name, tier, "req-3") {
+		t.Error("Expected another session to be refused at the cap")
+	}
+
+	server.mu.RLock()
+	allocations := server.pendingAllocations["backend-a"]
+	server.mu.RUnlock()
+	if len(allocations) != 1 || allocations[0].RequestID != "req-2" {
+		t.Errorf("Expected only user-1's latest allocation to remain, got %+v", allocations)
+	}
+}
+
+// TestValidatePendingLimits verifies negative caps are rejected
+func TestValidatePendingLimits(t *testing.T) {
+	if err := validatePendingLimits(&common.ServerConfig{MaxPendingPerBackend: 2, MaxPendingTotal: 50}); err != nil {
+		t.Errorf("Expected valid limits, got %v", err)
+	}
+	if err := validatePendingLimits(&common.ServerConfig{MaxPendingPerBackend: -1}); err == nil {
+		t.Error("Expected a negative max_pending_per_backend to be rejected")
+	}
+	if err := validatePendingLimits(&common.ServerConfig{MaxPendingTotal: -1}); err == nil {
+		t.Error("Expected a negative max_pending_total to be rejected")
+	}
+}
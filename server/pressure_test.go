@@ -0,0 +1,109 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestPSIVeto_SkipsPressuredBackend verifies backends over the PSI threshold are not selected
+func TestPSIVeto_SkipsPressuredBackend(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.PSICPUVetoPct = 20.0
+	})
+
+	// Idle-looking backend with a long run queue
+	pressured := NewMockClient(MockClientOptions{ClientID: "pressured", CPUUsageAvg: []float64{5, 5, 5, 5}})
+	pressured.Stats.PSI = &common.PressureStats{CPUSomeAvg10: 45.0}
+	server.AddMockClient(pressured)
+
+	// Busier backend without stalls
+	calm := NewMockClient(MockClientOptions{ClientID: "calm", CPUUsageAvg: []float64{50, 50, 50, 50}})
+	calm.Stats.PSI = &common.PressureStats{CPUSomeAvg10: 1.0}
+	server.AddMockClient(calm)
+
+	client := server.findBestClient(server.tierSpecs["lite"], 0, 0)
+	AssertClientSelected(t, client, "calm")
+}
+
+// TestPSIVeto_DisabledByDefault verifies PSI is ignored without thresholds
+func TestPSIVeto_DisabledByDefault(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+
+	client := NewMockClient(MockClientOptions{ClientID: "pressured"})
+	client.Stats.PSI = &common.PressureStats{CPUSomeAvg10: 90.0, MemorySomeAvg10: 90.0, IOSomeAvg10: 90.0}
+	server.AddMockClient(client)
+
+	if !server.hasResources(client, server.tierSpecs["lite"]) {
+		t.Error("Expected PSI to be ignored when no veto thresholds are configured")
+	}
+}
+
+// TestPSIVeto_MemoryAndIO verifies memory and I/O thresholds are applied independently
+func TestPSIVeto_MemoryAndIO(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.PSIMemoryVetoPct = 10.0
+		c.PSIIOVetoPct = 30.0
+	})
+
+	client := NewMockClient(MockClientOptions{ClientID: "backend"})
+	client.Stats.PSI = &common.PressureStats{MemorySomeAvg10: 15.0}
+	if !server.isUnderPressure(client) {
+		t.Error("Expected memory pressure to veto backend")
+	}
+
+	client.Stats.PSI = &common.PressureStats{IOSomeAvg10: 25.0}
+	if server.isUnderPressure(client) {
+		t.Error("Expected I/O pressure below threshold to be allowed")
+	}
+}
+
+// TestMigrateDatabase_AddsMissingColumns verifies older databases get new stats columns
+func TestMigrateDatabase_AddsMissingColumns(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "test-migrate-*.db")
+	if err != nil {
+		t.Fatalf("Failed to create temp db: %v", err)
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	// Create a stats table using the original schema
+	oldDB, err := sql.Open("sqlite3", tmpFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+	if _, err := oldDB.Exec(`CREATE TABLE stats (
+		id INTEGER PRIMARY KEY AUTOINCREMENT, client_id TEXT, timestamp TIMESTAMP,
+		cpu_cores INTEGER, cpu_usage_json TEXT, memory_total REAL, memory_used REAL,
+		memory_avail REAL, disk_total REAL, disk_used REAL, disk_avail REAL, gpu_stats_json TEXT)`); err != nil {
+		t.Fatalf("Failed to create legacy table: %v", err)
+	}
+	oldDB.Close()
+
+	db, err := initDatabase(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	defer db.Close()
+
+	for _, column := range []string{"load_avg_1", "swap_used", "psi_json"} {
+		exists, err := columnExists(db, "stats", column)
+		if err != nil {
+			t.Fatalf("Failed to inspect schema: %v", err)
+		}
+		if !exists {
+			t.Errorf("Expected column %s to be added by migration", column)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"cyqle.in/opsen/common"
+)
+
+// Response encodings the proxy can apply
+const (
+	encodingGzip = "gzip"
+	encodingZstd = "zstd"
+)
+
+// defaultCompressionMinBytes is the smallest response compressed when min_bytes is not set
+const defaultCompressionMinBytes = 1024
+
+// defaultCompressionEncodings are offered when a route lists none, most preferred first
+var defaultCompressionEncodings = []string{encodingZstd, encodingGzip}
+
+// defaultCompressibleTypes are compressed when a route lists no content_types
+var defaultCompressibleTypes = []string{
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+	"text/*",
+}
+
+// streamingContentTypes deliver data as it is produced. They are only compressed when a route lists them
+// explicitly in content_types, and then every chunk is flushed through the encoder as it arrives
+var streamingContentTypes = map[string]bool{
+	"text/event-stream":    true,
+	"application/x-ndjson": true,
+}
+
+// Encoders are reused across responses; a zstd encoder in particular allocates its tables up front
+var (
+	zstdEncoders = sync.Pool{New: func() interface{} {
+		zw, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithLowerEncoderMem(true))
+		return zw
+	}}
+	gzipEncoders = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+)
+
+// validateProxyCompression checks a route's encodings and size threshold
+func validateProxyCompression(route common.ProxyRouteConfig) error {
+	config := route.Compression
+	if !config.Enabled {
+		return nil
+	}
+	for _, encoding := range config.Encodings {
+		if encoding != encodingGzip && encoding != encodingZstd {
+			return fmt.Errorf("proxy_routes %s: unknown compression encoding %q (expected gzip or zstd)", route.Prefix, encoding)
+		}
+	}
+	if config.MinBytes < 0 {
+		return fmt.Errorf("proxy_routes %s: compression min_bytes must not be negative", route.Prefix)
+	}
+	return nil
+}
+
+// negotiateEncoding picks the first of offered that Accept-Encoding allows, or "" for none
+// An encoding is acceptable if listed (or matched by "*") with a non-zero q-value
+func negotiateEncoding(acceptEncoding string, offered []string) string {
+	accepted := make(map[string]bool)
+	wildcard, wildcardSet := false, false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		ok := true
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			q, err := strconv.ParseFloat(value, 64)
+			ok = err == nil && q > 0
+		}
+		if name == "*" {
+			wildcard, wildcardSet = ok, true
+			continue
+		}
+		accepted[name] = ok
+	}
+
+	for _, encoding := range offered {
+		if ok, listed := accepted[encoding]; listed {
+			if ok {
+				return encoding
+			}
+		} else if wildcardSet && wildcard {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// compressibleType reports whether a Content-Type matches one of the allowed media types, and whether it
+// is a streaming type. Streaming types only match when listed exactly, never through a wildcard like text/*
+func compressibleType(contentType string, allowed []string) (bool, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false, false
+	}
+	if streamingContentTypes[mediaType] {
+		for _, pattern := range allowed {
+			if strings.ToLower(pattern) == mediaType {
+				return true, true
+			}
+		}
+		return false, true
+	}
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true, false
+			}
+		} else if mediaType == pattern {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// compressProxyResponse compresses a backend response in place when the route enables it, the client
+// accepts one of its encodings, and the response is uncompressed, compressible and at least min_bytes long
+// Streaming routes are never compressed, since the encoder would hold back data until its buffer fills
+func compressProxyResponse(resp *http.Response, r *http.Request, route *common.ProxyRouteConfig) error {
+	if route == nil || !route.Compression.Enabled || route.Streaming {
+		return nil
+	}
+	config := route.Compression
+	contentTypes := config.ContentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = defaultCompressibleTypes
+	}
+	compressible, streaming := compressibleType(resp.Header.Get("Content-Type"), contentTypes)
+	if r.Method == http.MethodHead || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified ||
+		resp.StatusCode == http.StatusPartialContent || resp.Header.Get("Content-Encoding") != "" ||
+		strings.Contains(strings.ToLower(resp.Header.Get("Cache-Control")), "no-transform") || !compressible {
+		return nil
+	}
+
+	// The response would differ by Accept-Encoding whether or not this client gets it compressed
+	resp.Header.Add("Vary", "Accept-Encoding")
+
+	encodings := config.Encodings
+	if len(encodings) == 0 {
+		encodings = defaultCompressionEncodings
+	}
+	encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), encodings)
+	if encoding == "" {
+		return nil
+	}
+
+	minBytes := config.MinBytes
+	if minBytes == 0 {
+		minBytes = defaultCompressionMinBytes
+	}
+	if resp.ContentLength >= 0 && resp.ContentLength < minBytes {
+		return nil
+	}
+	// Streams are compressed from the first event: waiting for min_bytes would hold events back
+	if resp.ContentLength < 0 && minBytes > 0 && !streaming {
+		// Unknown length: read up to the threshold to find out whether the body is long enough
+		head := make([]byte, minBytes)
+		n, err := io.ReadFull(resp.Body, head)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			resp.Body = readCloser{bytes.NewReader(head[:n]), resp.Body}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+	}
+
+	resp.Body = newCompressedBody(resp.Body, encoding, streaming)
+	resp.Header.Set("Content-Encoding", encoding)
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	// The compressed bytes differ from the backend's, so its strong validator no longer applies
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		resp.Header.Set("ETag", "W/"+etag)
+	}
+	return nil
+}
+
+// readCloser reads from one reader and closes another
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// compressedBody streams src through an encoder as it is read
+type compressedBody struct {
+	*io.PipeReader
+	src io.ReadCloser
+}
+
+// flushingEncoder is a pooled gzip or zstd encoder
+type flushingEncoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// newCompressedBody starts encoding src; closing the body stops the encoder and closes src
+// With flush, each chunk read from src is flushed through the encoder so streamed events aren't held back
+func newCompressedBody(src io.ReadCloser, encoding string, flush bool) *compressedBody {
+	pr, pw := io.Pipe()
+	pool := &gzipEncoders
+	if encoding == encodingZstd {
+		pool = &zstdEncoders
+	}
+	encoder := pool.Get().(flushingEncoder)
+	encoder.Reset(pw)
+
+	go func() {
+		var err error
+		if flush {
+			err = copyFlushing(encoder, src)
+		} else {
+			_, err = io.Copy(encoder, src)
+		}
+		if closeErr := encoder.Close(); err == nil {
+			err = closeErr
+		}
+		pw.CloseWithError(err)
+		// Detach from the pipe so the pooled encoder doesn't keep the response alive
+		encoder.Reset(nil)
+		pool.Put(encoder)
+	}()
+	return &compressedBody{PipeReader: pr, src: src}
+}
+
+// copyFlushing copies src to the encoder, flushing after every chunk
+func copyFlushing(encoder flushingEncoder, src io.Reader) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := encoder.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if ferr := encoder.Flush(); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (b *compressedBody) Close() error {
+	b.PipeReader.Close()
+	return b.src.Close()
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestProxyCompression_CompressesEligibleResponses verifies uncompressed, compressible responses over the
+// threshold are encoded as the client prefers, and everything else passes through untouched
+func TestProxyCompression_CompressesEligibleResponses(t *testing.T) {
+	large := strings.Repeat(`{"id": 1, "status": "ok"},`, 200)
+	proxyServer := newProxyRouteTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/small":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"ok": true}`))
+		case "/api/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(large))
+		case "/api/encoded":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "br")
+			w.Write([]byte(large))
+		default:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Header().Set("ETag", `"v1"`)
+			w.(http.Flusher).Flush() // Unknown length: the proxy peeks at the body to apply the threshold
+			w.Write([]byte(large))
+		}
+	}, []common.ProxyRouteConfig{{Prefix: "/api", Compression: common.ProxyCompressionConfig{Enabled: true}}})
+
+	get := func(path, acceptEncoding string) (*http.Response, string) {
+		req, _ := http.NewRequest(http.MethodGet, proxyServer.URL+path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding) // Set explicitly so the client does not decode
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request to %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		var body io.Reader = resp.Body
+		switch resp.Header.Get("Content-Encoding") {
+		case "gzip":
+			zr, err := gzip.NewReader(resp.Body)
+			if err != nil {
+				t.Fatalf("%s: invalid gzip body: %v", path, err)
+			}
+			body = zr
+		case "zstd":
+			zr, err := zstd.NewReader(resp.Body)
+			if err != nil {
+				t.Fatalf("%s: invalid zstd body: %v", path, err)
+			}
+			defer zr.Close()
+			body = zr
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatalf("%s: failed to read body: %v", path, err)
+		}
+		return resp, string(data)
+	}
+
+	for _, tt := range []struct{ acceptEncoding, want string }{
+		{"gzip, deflate, br, zstd", "zstd"},
+		{"gzip", "gzip"},
+		{"zstd;q=0, *", "gzip"},
+		{"", ""},
+	} {
+		resp, body := get("/api/items", tt.acceptEncoding)
+		if got := resp.Header.Get("Content-Encoding"); got != tt.want {
+			t.Errorf("Accept-Encoding %q: expected encoding %q, got %q", tt.acceptEncoding, tt.want, got)
+		}
+		if body != large {
+			t.Errorf("Accept-Encoding %q: body changed (%d bytes)", tt.acceptEncoding, len(body))
+		}
+		if resp.Header.Get("Vary") != "Accept-Encoding" {
+			t.Errorf("Accept-Encoding %q: expected Vary: Accept-Encoding, got %q", tt.acceptEncoding, resp.Header.Get("Vary"))
+		}
+		if tt.want != "" && resp.Header.Get("ETag") != `W/"v1"` {
+			t.Errorf("Expected a weak ETag on compressed responses, got %q", resp.Header.Get("ETag"))
+		}
+	}
+
+	for path, want := range map[string]string{"/api/small": "", "/api/image": "", "/api/encoded": "br"} {
+		if resp, _ := get(path, "gzip, zstd"); resp.Header.Get("Content-Encoding") != want {
+			t.Errorf("%s: expected encoding %q, got %q", path, want, resp.Header.Get("Content-Encoding"))
+		}
+	}
+}
+
+// TestValidateProxyCompression verifies only gzip and zstd are accepted and min_bytes is not negative
+func TestValidateProxyCompression(t *testing.T) {
+	route := common.ProxyRouteConfig{Prefix: "/api", Compression: common.ProxyCompressionConfig{Enabled: true, Encodings: []string{"gzip", "zstd"}}}
+	if err := validateProxyRoutes([]common.ProxyRouteConfig{route}); err != nil {
+		t.Errorf("Expected a valid route, got %v", err)
+	}
+	route.Compression.Encodings = []string{"br"}
+	if err := validateProxyRoutes([]common.ProxyRouteConfig{route}); err == nil {
+		t.Error("Expected br to be rejected")
+	}
+	route.Compression.Encodings, route.Compression.MinBytes = nil, -1
+	if err := validateProxyRoutes([]common.ProxyRouteConfig{route}); err == nil {
+		t.Error("Expected a negative min_bytes to be rejected")
+	}
+}
+
+// TestProxyCompression_EventStreams verifies SSE passes through uncompressed unless listed, and listed
+// streams are flushed through the encoder so each event arrives before the stream ends
+func TestProxyCompression_EventStreams(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	backend := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+	}
+
+	firstEvent := func(routes []common.ProxyRouteConfig) (string, string) {
+		proxyServer := newProxyRouteTestServer(t, backend, routes)
+		req, _ := http.NewRequest(http.MethodGet, proxyServer.URL+"/events", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var body io.Reader = resp.Body
+		if resp.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(resp.Body)
+			if err != nil {
+				t.Fatalf("Invalid gzip stream: %v", err)
+			}
+			body = zr
+		}
+		line := make([]byte, len("data: first\n"))
+		if _, err := io.ReadFull(body, line); err != nil {
+			t.Fatalf("Expected the first event while the stream is open: %v", err)
+		}
+		return resp.Header.Get("Content-Encoding"), string(line)
+	}
+
+	defaults := []common.ProxyRouteConfig{{Prefix: "/events", Compression: common.ProxyCompressionConfig{Enabled: true}}}
+	if encoding, event := firstEvent(defaults); encoding != "" || event != "data: first\n" {
+		t.Errorf("Expected SSE not to be compressed through text/*, got %q %q", encoding, event)
+	}
+
+	listed := []common.ProxyRouteConfig{{Prefix: "/events", Compression: common.ProxyCompressionConfig{
+		Enabled: true, Encodings: []string{"gzip"}, ContentTypes: []string{"text/event-stream"},
+	}}}
+	if encoding, event := firstEvent(listed); encoding != "gzip" || event != "data: first\n" {
+		t.Errorf("Expected a listed event stream to be compressed and flushed per event, got %q %q", encoding, event)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// errCodeBackendBusy is sent in X-LB-Error-Code when a proxied request found no free slot on its backend
+const errCodeBackendBusy = "backend_busy"
+
+// What placement does with a backend at max_in_flight (proxy_concurrency.overflow)
+const (
+	ConcurrencyOverflowSpill = "spill" // New placements go to the next-best backend (default)
+	ConcurrencyOverflowQueue = "queue" // Placement ignores the limit; the request waits for a slot on its backend
+)
+
+// ProxyConcurrency caps the proxied requests each backend has in flight. Stats reports lag real
+// concurrency by the report interval; in-flight counts are current, so they also feed the score.
+// Requests bound to a backend (sticky sessions, routing cookies) or placed on one that filled up
+// meanwhile wait up to queue_timeout_ms for a slot. WebSocket and SSE streams are not counted
+type ProxyConcurrency struct {
+	config common.ProxyConcurrencyConfig
+
+	mu       sync.Mutex
+	inFlight map[string]int           // client_id → proxied requests in flight
+	freed    map[string]chan struct{} // client_id → closed (and replaced) when a slot frees, waking queued requests
+	rejected map[string]int64         // client_id → requests that found no slot in time
+}
+
+// BackendConcurrency is the proxy concurrency view of a backend reported by /clients
+type BackendConcurrency struct {
+	InFlight    int   `json:"in_flight"`
+	MaxInFlight int   `json:"max_in_flight"`
+	Rejected    int64 `json:"rejected,omitempty"`
+}
+
+// NewProxyConcurrency creates the limiter, or returns nil if max_in_flight is not set
+func NewProxyConcurrency(config common.ProxyConcurrencyConfig) *ProxyConcurrency {
+	if config.MaxInFlight <= 0 {
+		return nil
+	}
+	if config.Overflow == "" {
+		config.Overflow = ConcurrencyOverflowSpill
+	}
+	if config.QueueTimeoutMs <= 0 {
+		config.QueueTimeoutMs = 1000
+	}
+	return &ProxyConcurrency{
+		config:   config,
+		inFlight: make(map[string]int),
+		freed:    make(map[string]chan struct{}),
+		rejected: make(map[string]int64),
+	}
+}
+
+// validateProxyConcurrency checks the proxy_concurrency settings
+func validateProxyConcurrency(config common.ProxyConcurrencyConfig) error {
+	if config.MaxInFlight < 0 || config.QueueTimeoutMs < 0 || config.ScoreWeight < 0 {
+		return fmt.Errorf("proxy_concurrency: max_in_flight, queue_timeout_ms and score_weight must not be negative")
+	}
+	switch config.Overflow {
+	case "", ConcurrencyOverflowSpill, ConcurrencyOverflowQueue:
+		return nil
+	default:
+		return fmt.Errorf("proxy_concurrency: unknown overflow %q (want %s or %s)", config.Overflow,
+			ConcurrencyOverflowSpill, ConcurrencyOverflowQueue)
+	}
+}
+
+// Full reports whether placement should skip a backend: it is at max_in_flight and overflow is spill
+func (c *ProxyConcurrency) Full(clientID string) bool {
+	if c == nil || c.config.Overflow != ConcurrencyOverflowSpill {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.inFlight[clientID] >= c.config.MaxInFlight
+}
+
+// ScorePenalty returns the score points a backend's in-flight requests add
+func (c *ProxyConcurrency) ScorePenalty(clientID string) float64 {
+	if c == nil || c.config.ScoreWeight <= 0 {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return float64(c.inFlight[clientID]) * c.config.ScoreWeight
+}
+
+// Acquire takes a slot on a backend, waiting up to queue_timeout_ms (or until ctx ends) for one to free
+// Returns the func releasing the slot, or false if none freed in time
+func (c *ProxyConcurrency) Acquire(ctx context.Context, clientID string) (func(), bool) {
+	if c == nil {
+		return func() {}, true
+	}
+
+	timer := time.NewTimer(time.Duration(c.config.QueueTimeoutMs) * time.Millisecond)
+	defer timer.Stop()
+	for {
+		c.mu.Lock()
+		if c.inFlight[clientID] < c.config.MaxInFlight {
+			c.inFlight[clientID]++
+			c.mu.Unlock()
+			var once sync.Once
+			return func() { once.Do(func() { c.release(clientID) }) }, true
+		}
+		freed, ok := c.freed[clientID]
+		if !ok {
+			freed = make(chan struct{})
+			c.freed[clientID] = freed
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-timer.C:
+			c.reject(clientID)
+			return nil, false
+		case <-ctx.Done():
+			c.reject(clientID)
+			return nil, false
+		}
+	}
+}
+
+func (c *ProxyConcurrency) release(clientID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inFlight[clientID]--; c.inFlight[clientID] <= 0 {
+		delete(c.inFlight, clientID)
+	}
+	if freed, ok := c.freed[clientID]; ok {
+		close(freed)
+		delete(c.freed, clientID)
+	}
+}
+
+func (c *ProxyConcurrency) reject(clientID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rejected[clientID]++
+}
+
+// Status returns a backend's in-flight count for /clients
+func (c *ProxyConcurrency) Status(clientID string) BackendConcurrency {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return BackendConcurrency{
+		InFlight:    c.inFlight[clientID],
+		MaxInFlight: c.config.MaxInFlight,
+		Rejected:    c.rejected[clientID],
+	}
+}
+
+// Remove drops a deregistered backend's counters
+func (c *ProxyConcurrency) Remove(clientID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.rejected, clientID)
+}
+
+// writeBackendBusy answers a proxied request whose backend had no free slot within queue_timeout_ms
+func (c *ProxyConcurrency) writeBackendBusy(w http.ResponseWriter, client *ClientState) {
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, c.config.QueueTimeoutMs/1000)))
+	w.Header().Set(LBErrorCodeHeader, errCodeBackendBusy)
+	http.Error(w, fmt.Sprintf("Backend %s is at its limit of %d requests in flight, retry shortly",
+		client.Registration.ClientID, c.config.MaxInFlight), http.StatusServiceUnavailable)
+}
+
+// isLongLivedStream reports whether a proxied request holds its connection open indefinitely (WebSocket or SSE)
+// Such streams would pin concurrency slots for their lifetime, so they are not counted
+func isLongLivedStream(r *http.Request, isWebSocket bool) bool {
+	return isWebSocket || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
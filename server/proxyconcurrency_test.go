@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestProxyConcurrency_SpillsToNextBest verifies a backend at max_in_flight gets no new placements until a request finishes
+func TestProxyConcurrency_SpillsToNextBest(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slow.Close()
+	var spilled atomic.Int32
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		spilled.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fast.Close()
+
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.ProxyConcurrency = common.ProxyConcurrencyConfig{MaxInFlight: 1}
+	})
+	server.proxyEndpoints = []string{"/api"}
+	// The idle backend scores best, so it takes the first request
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "idle", Endpoint: slow.URL, CPUUsageAvg: []float64{5, 5, 5, 5}}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "busy", Endpoint: fast.URL, CPUUsageAvg: []float64{60, 60, 60, 60}}))
+
+	proxy := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.handleProxy(rec, httptest.NewRequest("GET", "/api/run?tier=lite", nil))
+		return rec
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- proxy() }()
+	deadline := time.Now().Add(2 * time.Second)
+	for server.concurrency.Status("idle").InFlight != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the first request in flight on the idle backend")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if rec := proxy(); rec.Code != http.StatusOK || spilled.Load() != 1 {
+		t.Errorf("Expected the second request to spill to the busy backend, got %d (%d spilled)", rec.Code, spilled.Load())
+	}
+	if status := server.concurrency.Status("idle"); status.InFlight != 1 || status.Rejected != 0 {
+		t.Errorf("Expected the idle backend to keep only its first request, got %+v", status)
+	}
+
+	close(release)
+	if rec := <-done; rec.Code != http.StatusOK {
+		t.Errorf("Expected the first request to complete, got %d", rec.Code)
+	}
+	if inFlight := server.concurrency.Status("idle").InFlight; inFlight != 0 {
+		t.Errorf("Expected the slot to be released, got %d in flight", inFlight)
+	}
+}
+
+// TestProxyConcurrency_RejectedRequestReservesNothing verifies a request turned away for a busy backend gives back
+// the allocation and the sticky assignment its placement created
+func TestProxyConcurrency_RejectedRequestReservesNothing(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slow.Close()
+
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.ProxyConcurrency = common.ProxyConcurrencyConfig{MaxInFlight: 1, Overflow: ConcurrencyOverflowQueue, QueueTimeoutMs: 20}
+	})
+	server.proxyEndpoints = []string{"/api"}
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "only", Endpoint: slow.URL}))
+
+	proxy := func(sessionID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/run?tier=lite", nil)
+		req.Header.Set("X-Session-ID", sessionID)
+		rec := httptest.NewRecorder()
+		server.handleProxy(rec, req)
+		return rec
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- proxy("user-1") }()
+	deadline := time.Now().Add(2 * time.Second)
+	for server.concurrency.Status("only").InFlight != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the first request in flight")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if rec := proxy("user-2"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 while the backend is busy, got %d", rec.Code)
+	}
+	server.mu.RLock()
+	pending := len(server.pendingAllocations["only"])
+	_, assigned := server.stickyAssignments[tenantStickyID(DefaultTenant, "user-2")]
+	server.mu.RUnlock()
+	if pending != 1 || assigned {
+		t.Errorf("Expected only the first request's allocation and no assignment for the rejected one, got %d allocations (assigned=%v)", pending, assigned)
+	}
+	if stored, _ := server.stickyStore.Get(tenantStickyID(DefaultTenant, "user-2"), "lite"); stored != nil {
+		t.Errorf("Expected no stored assignment for the rejected session, got %+v", stored)
+	}
+
+	close(release)
+	<-done
+}
+
+// TestProxyConcurrency_Queue verifies requests wait for a slot up to queue_timeout_ms, then are rejected
+func TestProxyConcurrency_Queue(t *testing.T) {
+	limiter := NewProxyConcurrency(common.ProxyConcurrencyConfig{
+		MaxInFlight: 1, Overflow: ConcurrencyOverflowQueue, QueueTimeoutMs: 50, ScoreWeight: 5,
+	})
+	ctx := context.Background()
+
+	release, ok := limiter.Acquire(ctx, "backend-a")
+	if !ok {
+		t.Fatal("Expected the first request to get a slot")
+	}
+	if limiter.Full("backend-a") {
+		t.Error("Expected queue mode not to veto placement")
+	}
+	if penalty := limiter.ScorePenalty("backend-a"); penalty != 5 {
+		t.Errorf("Expected a score penalty of 5 for one request in flight, got %.1f", penalty)
+	}
+
+	if _, ok := limiter.Acquire(ctx, "backend-a"); ok {
+		t.Fatal("Expected a request to time out while the slot is held")
+	}
+	if rejected := limiter.Status("backend-a").Rejected; rejected != 1 {
+		t.Errorf("Expected one rejected request, got %d", rejected)
+	}
+
+	// A queued request takes the slot as soon as it frees
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+		release() // Releasing twice frees one slot only
+	}()
+	second, ok := limiter.Acquire(ctx, "backend-a")
+	if !ok {
+		t.Fatal("Expected the queued request to get the freed slot")
+	}
+	if inFlight := limiter.Status("backend-a").InFlight; inFlight != 1 {
+		t.Errorf("Expected one request in flight, got %d", inFlight)
+	}
+	second()
+}
+
+// TestProxyConcurrency_Disabled verifies a nil limiter admits everything and adds no score
+func TestProxyConcurrency_Disabled(t *testing.T) {
+	limiter := NewProxyConcurrency(common.ProxyConcurrencyConfig{ScoreWeight: 5})
+	if limiter != nil {
+		t.Fatal("Expected no limiter without max_in_flight")
+	}
+	if release, ok := limiter.Acquire(context.Background(), "backend-a"); !ok {
+		t.Error("Expected a nil limiter to admit requests")
+	} else {
+		release()
+	}
+	if limiter.Full("backend-a") || limiter.ScorePenalty("backend-a") != 0 {
+		t.Error("Expected a nil limiter never to veto or penalize")
+	}
+}
+
+// TestValidateProxyConcurrency verifies negative settings and unknown overflow modes are rejected
+func TestValidateProxyConcurrency(t *testing.T) {
+	if err := validateProxyConcurrency(common.ProxyConcurrencyConfig{MaxInFlight: 10, Overflow: ConcurrencyOverflowQueue}); err != nil {
+		t.Errorf("Expected a valid config, got %v", err)
+	}
+	if err := validateProxyConcurrency(common.ProxyConcurrencyConfig{MaxInFlight: -1}); err == nil {
+		t.Error("Expected a negative max_in_flight to be rejected")
+	}
+	if err := validateProxyConcurrency(common.ProxyConcurrencyConfig{MaxInFlight: 10, Overflow: "drop"}); err == nil {
+		t.Error("Expected an unknown overflow to be rejected")
+	}
+}
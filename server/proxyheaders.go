@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"cyqle.in/opsen/common"
+)
+
+// hopByHopHeaders apply to a single connection and are never forwarded (RFC 9110 section 7.6.1)
+var hopByHopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// alwaysForwardedHeaders describe the request body or trace it, and pass allow_headers regardless of the list
+var alwaysForwardedHeaders = []string{"Content-Type", "Content-Length", "Content-Encoding", RequestIDHeader}
+
+// lbHeaderPrefix marks headers the load balancer sets for backends; inbound copies are dropped
+const lbHeaderPrefix = "x-lb-"
+
+// validateProxyHeaderLists checks a route's allow_headers and deny_headers
+func validateProxyHeaderLists(route common.ProxyRouteConfig) error {
+	for _, list := range [][]string{route.AllowHeaders, route.DenyHeaders} {
+		for _, name := range list {
+			if strings.TrimSpace(name) == "" {
+				return fmt.Errorf("proxy_routes %s: empty header name in allow_headers or deny_headers", route.Prefix)
+			}
+		}
+	}
+	return nil
+}
+
+// filterProxyRequestHeaders removes the inbound headers a backend must not see: hop-by-hop headers
+// (keeping the WebSocket upgrade handshake), spoofed X-LB-* headers, an untrusted Forwarded header,
+// and whatever the route's allow_headers and deny_headers exclude
+func filterProxyRequestHeaders(header http.Header, route *common.ProxyRouteConfig) {
+	upgrade := isUpgradeRequest(header)
+
+	// Headers named in Connection are hop-by-hop too
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" && !(upgrade && strings.EqualFold(name, "Upgrade")) {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		if upgrade && (name == "Connection" || name == "Upgrade") {
+			continue
+		}
+		header.Del(name)
+	}
+	if upgrade {
+		header.Set("Connection", "Upgrade")
+	}
+
+	header.Del("Forwarded")
+	for name := range header {
+		if strings.HasPrefix(strings.ToLower(name), lbHeaderPrefix) {
+			header.Del(name)
+		}
+	}
+
+	if route == nil {
+		return
+	}
+	for name := range header {
+		if headerListed(name, route.DenyHeaders) {
+			header.Del(name)
+			continue
+		}
+		if len(route.AllowHeaders) == 0 || headerListed(name, alwaysForwardedHeaders) {
+			continue
+		}
+		if upgrade && (name == "Connection" || name == "Upgrade" || strings.HasPrefix(name, "Sec-Websocket-")) {
+			continue
+		}
+		if !headerListed(name, route.AllowHeaders) {
+			header.Del(name)
+		}
+	}
+}
+
+// isUpgradeRequest reports whether a request asks to switch protocols (e.g. WebSocket)
+func isUpgradeRequest(header http.Header) bool {
+	if header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "Upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// headerListed matches a header name against a list of names and "*" wildcards, case-insensitively
+func headerListed(name string, list []string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range list {
+		if matchWildcard(name, strings.ToLower(strings.TrimSpace(pattern))) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedHeader builds the RFC 7239 Forwarded element for a request as the load balancer received it
+func forwardedHeader(r *http.Request) string {
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	parts := []string{"for=" + forwardedNode(getClientIP(r))}
+	if r.Host != "" {
+		parts = append(parts, "host="+forwardedValue(r.Host))
+	}
+	parts = append(parts, "proto="+proto)
+	return strings.Join(parts, ";")
+}
+
+// setXForwardedHeaders replaces inbound X-Forwarded-Proto, -Host and -Port with how the load balancer
+// was reached, so backends can build absolute URLs
+func setXForwardedHeaders(header http.Header, r *http.Request) {
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	header.Set("X-Forwarded-Proto", proto)
+	if r.Host != "" {
+		header.Set("X-Forwarded-Host", r.Host)
+	} else {
+		header.Del("X-Forwarded-Host")
+	}
+	header.Set("X-Forwarded-Port", forwardedPort(r, proto))
+}
+
+// forwardedPort is the port the client addressed: from Host, else the scheme default (clients omit default ports)
+func forwardedPort(r *http.Request, proto string) string {
+	if _, port, err := net.SplitHostPort(r.Host); err == nil && port != "" {
+		return port
+	}
+	if proto == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// forwardedNode formats a node identifier; IPv6 addresses are bracketed and quoted
+func forwardedNode(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return `"[` + ip + `]"`
+	}
+	return forwardedValue(ip)
+}
+
+// forwardedValue returns value as a token, or as a quoted string when it has other characters
+func forwardedValue(value string) string {
+	for _, c := range value {
+		if !isTokenChar(c) {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+		}
+	}
+	return value
+}
+
+// isTokenChar reports whether c may appear in an HTTP token (RFC 9110 tchar)
+func isTokenChar(c rune) bool {
+	if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", c)
+}
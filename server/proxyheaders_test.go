@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestProxy_HeaderLists verifies the proxy drops spoofed and hop-by-hop headers and applies per-prefix allow/deny lists
+func TestProxy_HeaderLists(t *testing.T) {
+	var received http.Header
+	proxyServer := newProxyRouteTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}, []common.ProxyRouteConfig{
+		{Prefix: "/api", DenyHeaders: []string{"Cookie", "X-Internal-*"}},
+		{Prefix: "/strict", AllowHeaders: []string{"Authorization", "X-App-*"}},
+	})
+
+	send := func(path string, headers map[string]string) {
+		t.Helper()
+		req, _ := http.NewRequest("POST", proxyServer.URL+path+"?tier=lite", nil)
+		req.Header.Set("Content-Type", "application/json")
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200 for %s, got %d", path, resp.StatusCode)
+		}
+	}
+
+	send("/api/users", map[string]string{
+		"X-LB-Client-ID":    "spoofed",
+		"X-LB-Trusted-User": "admin",
+		"Forwarded":         "for=6.6.6.6",
+		"Cookie":            "session=secret",
+		"X-Internal-Token":  "secret",
+		"Connection":        "X-Hop",
+		"X-Hop":             "1",
+		"X-Custom":          "kept",
+	})
+	if got := received.Get("X-LB-Client-ID"); got != "route-backend" {
+		t.Errorf("Expected the proxy's own X-LB-Client-ID, got %q", got)
+	}
+	for _, name := range []string{"X-LB-Trusted-User", "Cookie", "X-Internal-Token", "X-Hop"} {
+		if received.Get(name) != "" {
+			t.Errorf("Expected %s to be dropped, got %q", name, received.Get(name))
+		}
+	}
+	if received.Get("X-Custom") != "kept" {
+		t.Errorf("Expected unlisted headers to pass without allow_headers")
+	}
+	if got := received.Get("Forwarded"); got == "" || got == "for=6.6.6.6" || len(received.Values("Forwarded")) != 1 {
+		t.Errorf("Expected a single Forwarded header set by the proxy, got %v", received.Values("Forwarded"))
+	}
+
+	send("/strict/data", map[string]string{
+		"Authorization": "Bearer token",
+		"X-App-Version": "3",
+		"X-Custom":      "dropped",
+	})
+	if received.Get("Authorization") == "" || received.Get("X-App-Version") != "3" {
+		t.Errorf("Expected allowed headers to pass, got %v", received)
+	}
+	if received.Get("X-Custom") != "" {
+		t.Errorf("Expected headers outside allow_headers to be dropped")
+	}
+	if received.Get("Content-Type") != "application/json" || received.Get("X-LB-Client-ID") == "" {
+		t.Errorf("Expected body headers and the proxy's own headers to pass allow_headers, got %v", received)
+	}
+}
+
+// TestForwardedHeader verifies Forwarded elements follow RFC 7239 quoting
+func TestForwardedHeader(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://app.example.com:8080/x", nil)
+	r.RemoteAddr = "192.0.2.60:5000"
+	if got := forwardedHeader(r); got != `for=192.0.2.60;host="app.example.com:8080";proto=http` {
+		t.Errorf("Unexpected Forwarded header: %s", got)
+	}
+
+	r.RemoteAddr = "[2001:db8::1]:5000"
+	r.Host = "app.example.com"
+	if got := forwardedHeader(r); got != `for="[2001:db8::1]";host=app.example.com;proto=http` {
+		t.Errorf("Unexpected Forwarded header for IPv6: %s", got)
+	}
+}
+
+// TestFilterProxyRequestHeaders_KeepsUpgrade verifies WebSocket handshakes survive hop-by-hop stripping and allow lists
+func TestFilterProxyRequestHeaders_KeepsUpgrade(t *testing.T) {
+	header := http.Header{}
+	header.Set("Connection", "keep-alive, Upgrade")
+	header.Set("Upgrade", "websocket")
+	header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	header.Set("Keep-Alive", "timeout=5")
+
+	filterProxyRequestHeaders(header, &common.ProxyRouteConfig{Prefix: "/ws", AllowHeaders: []string{"Authorization"}})
+	if header.Get("Upgrade") != "websocket" || header.Get("Connection") != "Upgrade" || header.Get("Sec-WebSocket-Key") == "" {
+		t.Errorf("Expected the upgrade handshake to be kept, got %v", header)
+	}
+	if header.Get("Keep-Alive") != "" {
+		t.Errorf("Expected Keep-Alive to be dropped")
+	}
+}
+
+// TestProxy_XForwardedHeadersAndPreserveHost verifies backends learn the original scheme, host and port,
+// and receive the client's Host only on routes with preserve_host
+func TestProxy_XForwardedHeadersAndPreserveHost(t *testing.T) {
+	var received http.Header
+	var receivedHost string
+	proxyServer := newProxyRouteTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		received, receivedHost = r.Header.Clone(), r.Host
+		w.WriteHeader(http.StatusOK)
+	}, []common.ProxyRouteConfig{
+		{Prefix: "/api"},
+		{Prefix: "/site", PreserveHost: true},
+	})
+
+	send := func(path, host string) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", proxyServer.URL+path+"?tier=lite", nil)
+		req.Host = host
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("X-Forwarded-Host", "evil.example.com")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200 for %s, got %d", path, resp.StatusCode)
+		}
+	}
+
+	send("/api/users", "app.example.com:8443")
+	if got := received.Get("X-Forwarded-Proto"); got != "http" {
+		t.Errorf("Expected the proxy's X-Forwarded-Proto, got %q", got)
+	}
+	if received.Get("X-Forwarded-Host") != "app.example.com:8443" || received.Get("X-Forwarded-Port") != "8443" {
+		t.Errorf("Expected the original host and port, got host=%q port=%q", received.Get("X-Forwarded-Host"), received.Get("X-Forwarded-Port"))
+	}
+	if receivedHost == "app.example.com:8443" {
+		t.Errorf("Expected the backend's host without preserve_host, got %q", receivedHost)
+	}
+
+	send("/site/page", "app.example.com")
+	if receivedHost != "app.example.com" {
+		t.Errorf("Expected preserve_host to keep the client's Host, got %q", receivedHost)
+	}
+	if got := received.Get("X-Forwarded-Port"); got != "80" {
+		t.Errorf("Expected the default port for a Host without one, got %q", got)
+	}
+}
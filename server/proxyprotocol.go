@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// proxyProtocolV2Signature starts every binary (v2) PROXY protocol header
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	proxyProtocolV1MaxLen    = 107  // Longest valid v1 line, including CRLF
+	proxyProtocolV2Authority = 0x02 // PP2_TYPE_AUTHORITY TLV: the host name the client asked for (usually its SNI)
+)
+
+// proxyHeader is what a front load balancer told us about a connection
+// Fields are empty for LOCAL (health check) and UNKNOWN connections
+type proxyHeader struct {
+	Source    net.IP // End user's address
+	DestPort  int    // Port the end user connected to on the front load balancer
+	Authority string // Server name from a v2 authority TLV
+}
+
+// readProxyHeader consumes a PROXY protocol v1 or v2 header from the start of a connection
+func readProxyHeader(r *bufio.Reader) (proxyHeader, error) {
+	start, err := r.Peek(len(proxyProtocolV2Signature))
+	if err != nil {
+		return proxyHeader{}, fmt.Errorf("reading PROXY protocol header: %w", err)
+	}
+	switch {
+	case bytes.Equal(start, proxyProtocolV2Signature):
+		return readProxyHeaderV2(r)
+	case bytes.HasPrefix(start, []byte("PROXY ")):
+		return readProxyHeaderV1(r)
+	default:
+		return proxyHeader{}, fmt.Errorf("connection does not start with a PROXY protocol header")
+	}
+}
+
+// readProxyHeaderV1 parses "PROXY TCP4|TCP6 <src> <dst> <sport> <dport>\r\n" or "PROXY UNKNOWN ...\r\n"
+func readProxyHeaderV1(r *bufio.Reader) (proxyHeader, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil || len(line) > proxyProtocolV1MaxLen || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return proxyHeader{}, fmt.Errorf("invalid PROXY protocol v1 header")
+	}
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return proxyHeader{}, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return proxyHeader{}, fmt.Errorf("invalid PROXY protocol v1 header: %q", strings.TrimSpace(string(line)))
+	}
+
+	source := net.ParseIP(fields[2])
+	destPort, err := strconv.ParseUint(fields[5], 10, 16)
+	if source == nil || net.ParseIP(fields[3]) == nil || err != nil {
+		return proxyHeader{}, fmt.Errorf("invalid PROXY protocol v1 header: %q", strings.TrimSpace(string(line)))
+	}
+	return proxyHeader{Source: source, DestPort: int(destPort)}, nil
+}
+
+// readProxyHeaderV2 parses the binary header: signature, version/command, family, length, addresses, TLVs
+func readProxyHeaderV2(r *bufio.Reader) (proxyHeader, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return proxyHeader{}, fmt.Errorf("reading PROXY protocol v2 header: %w", err)
+	}
+	if fixed[12]>>4 != 2 {
+		return proxyHeader{}, fmt.Errorf("unsupported PROXY protocol version %d", fixed[12]>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(fixed[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return proxyHeader{}, fmt.Errorf("reading PROXY protocol v2 header: %w", err)
+	}
+
+	// LOCAL: the front load balancer's own connection (e.g. a health check), not a proxied one
+	if fixed[12]&0x0f == 0 {
+		return proxyHeader{}, nil
+	}
+
+	var header proxyHeader
+	addressLen := 0
+	switch fixed[13] >> 4 {
+	case 1: // AF_INET: 4-byte addresses, then ports
+		addressLen = 12
+	case 2: // AF_INET6: 16-byte addresses, then ports
+		addressLen = 36
+	default: // Unspecified or unix addresses: nothing usable, and the TLVs cannot be located reliably
+		return header, nil
+	}
+	if len(payload) < addressLen {
+		return proxyHeader{}, fmt.Errorf("truncated PROXY protocol v2 addresses")
+	}
+	ipLen := (addressLen - 4) / 2
+	header.Source = net.IP(payload[:ipLen])
+	header.DestPort = int(binary.BigEndian.Uint16(payload[addressLen-2 : addressLen]))
+
+	for tlvs := payload[addressLen:]; len(tlvs) >= 3; {
+		length := int(binary.BigEndian.Uint16(tlvs[1:3]))
+		if 3+length > len(tlvs) {
+			break
+		}
+		if tlvs[0] == proxyProtocolV2Authority {
+			header.Authority = string(tlvs[3 : 3+length])
+		}
+		tlvs = tlvs[3+length:]
+	}
+	return header, nil
+}
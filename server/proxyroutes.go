@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// proxyPrefixes returns the configured proxy endpoints plus any proxy_routes prefixes not already listed
+func proxyPrefixes(config *common.ServerConfig) []string {
+	prefixes := append([]string{}, config.ProxyEndpoints...)
+	for _, route := range config.ProxyRoutes {
+		if route.Prefix == "" || slices.Contains(prefixes, route.Prefix) {
+			continue
+		}
+		prefixes = append(prefixes, route.Prefix)
+	}
+	return prefixes
+}
+
+// proxyRouteFor returns the per-prefix settings for a path (longest prefix wins), or nil
+func (s *Server) proxyRouteFor(path string) *common.ProxyRouteConfig {
+	var best *common.ProxyRouteConfig
+	for i := range s.config.ProxyRoutes {
+		route := &s.config.ProxyRoutes[i]
+		if route.Prefix == "" || !strings.HasPrefix(path, route.Prefix) {
+			continue
+		}
+		if best == nil || len(route.Prefix) > len(best.Prefix) {
+			best = route
+		}
+	}
+	return best
+}
+
+// proxyRequestTimeout returns the request timeout for a proxied path (0 = none)
+func (s *Server) proxyRequestTimeout(r *http.Request) time.Duration {
+	route := s.proxyRouteFor(r.URL.Path)
+	if route != nil {
+		if route.Streaming {
+			return 0
+		}
+		if route.RequestTimeoutSecs > 0 {
+			return time.Duration(route.RequestTimeoutSecs) * time.Second
+		}
+	}
+	return time.Duration(s.config.RequestTimeout) * time.Second
+}
+
+// applyProxyRouteLimits sets connection deadlines and the lifetime cap for a proxied request
+// The returned request carries a cancellable context (used by the idle timeout); cancel must be
+// called when the request ends
+func applyProxyRouteLimits(w http.ResponseWriter, r *http.Request, route *common.ProxyRouteConfig) (*http.Request, context.CancelFunc) {
+	if route == nil {
+		return r, func() {}
+	}
+
+	rc := http.NewResponseController(w)
+	now := time.Now()
+	if route.ReadTimeoutSecs > 0 {
+		if err := rc.SetReadDeadline(now.Add(time.Duration(route.ReadTimeoutSecs) * time.Second)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			log.Printf("Warning: Failed to set read deadline for %s: %v", r.URL.Path, err)
+		}
+	}
+	if route.WriteTimeoutSecs > 0 {
+		if err := rc.SetWriteDeadline(now.Add(time.Duration(route.WriteTimeoutSecs) * time.Second)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			log.Printf("Warning: Failed to set write deadline for %s: %v", r.URL.Path, err)
+		}
+	}
+
+	if route.MaxLifetimeSecs <= 0 {
+		ctx, cancel := context.WithCancel(r.Context())
+		return r.WithContext(ctx), cancel
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(route.MaxLifetimeSecs)*time.Second)
+	return r.WithContext(ctx), cancel
+}
+
+// idleTimeoutBody aborts a backend response that stops sending data for longer than the idle timeout
+type idleTimeoutBody struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	once    sync.Once
+}
+
+// newIdleTimeoutBody wraps a response body; cancel is called if no data arrives within timeout
+func newIdleTimeoutBody(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *idleTimeoutBody {
+	b := &idleTimeoutBody{body: body, timeout: timeout}
+	b.timer = time.AfterFunc(timeout, func() {
+		log.Printf("Backend idle for %v, closing proxied response", timeout)
+		cancel()
+	})
+	return b
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.once.Do(func() { b.timer.Stop() })
+	return b.body.Close()
+}
+
+// Proxy route OPTIONS handling modes
+const (
+	proxyOptionsPassthrough = "passthrough" // Forward OPTIONS to the backend
+	proxyOptionsLocal       = "local"       // Answer OPTIONS at the load balancer
+)
+
+// validateProxyRoutes checks per-prefix settings at startup
+func validateProxyRoutes(routes []common.ProxyRouteConfig) error {
+	for _, route := range routes {
+		if route.Prefix == "" {
+			return fmt.Errorf("proxy_routes entry without prefix")
+		}
+		switch route.Options {
+		case "", proxyOptionsPassthrough, proxyOptionsLocal:
+		default:
+			return fmt.Errorf("proxy_routes %s: invalid options %q (expected passthrough or local)", route.Prefix, route.Options)
+		}
+		if route.MaxBodyBytes < -1 {
+			return fmt.Errorf("proxy_routes %s: invalid max_body_bytes %d (expected -1 for unlimited, 0 for the global limit, or a positive size)", route.Prefix, route.MaxBodyBytes)
+		}
+		if err := validateProxyHeaderLists(route); err != nil {
+			return err
+		}
+		if err := validateProxyCompression(route); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// routeAllowsMethod reports whether a route accepts a method (HEAD is implied by GET)
+func routeAllowsMethod(route *common.ProxyRouteConfig, method string) bool {
+	if route == nil || len(route.Methods) == 0 {
+		return true
+	}
+	for _, allowed := range route.Methods {
+		if strings.EqualFold(allowed, method) ||
+			(method == http.MethodHead && strings.EqualFold(allowed, http.MethodGet)) {
+			return true
+		}
+	}
+	return false
+}
+
+// routeAllowHeader builds the Allow header value for a route with a method list
+func routeAllowHeader(route *common.ProxyRouteConfig) string {
+	methods := []string{}
+	for _, method := range route.Methods {
+		methods = append(methods, strings.ToUpper(method))
+	}
+	if slices.Contains(methods, http.MethodGet) && !slices.Contains(methods, http.MethodHead) {
+		methods = append(methods, http.MethodHead)
+	}
+	if !slices.Contains(methods, http.MethodOptions) {
+		methods = append(methods, http.MethodOptions)
+	}
+	return strings.Join(methods, ", ")
+}
+
+// optionsPassthrough reports whether an OPTIONS request should reach the backend rather than get
+// a local CORS preflight answer
+func (s *Server) optionsPassthrough(r *http.Request) bool {
+	route := s.proxyRouteFor(r.URL.Path)
+	return route != nil && route.Options == proxyOptionsPassthrough
+}
+
+// handleProxyMethod answers OPTIONS locally or rejects methods a route does not allow
+// Returns true if the request was handled and must not be proxied
+func handleProxyMethod(w http.ResponseWriter, r *http.Request, route *common.ProxyRouteConfig) bool {
+	if route == nil {
+		return false
+	}
+
+	if r.Method == http.MethodOptions {
+		if route.Options == proxyOptionsPassthrough ||
+			(route.Options == "" && routeAllowsMethod(route, http.MethodOptions)) {
+			return false
+		}
+		if len(route.Methods) > 0 {
+			w.Header().Set("Allow", routeAllowHeader(route))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+
+	if !routeAllowsMethod(route, r.Method) {
+		w.Header().Set("Allow", routeAllowHeader(route))
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return true
+	}
+	return false
+}
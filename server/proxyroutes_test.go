@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// newProxyRouteTestServer creates a proxy server with one backend and the given per-prefix routes
+func newProxyRouteTestServer(t *testing.T, backend http.HandlerFunc, routes []common.ProxyRouteConfig) *httptest.Server {
+	t.Helper()
+	backendServer := httptest.NewServer(backend)
+	t.Cleanup(backendServer.Close)
+
+	db, cleanup := CreateTestDB(t)
+	t.Cleanup(cleanup)
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.ProxyRoutes = routes
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{
+		ClientID:    "route-backend",
+		Endpoint:    backendServer.URL,
+		CPUUsageAvg: []float64{10, 10, 10, 10, 10, 10, 10, 10},
+		MemoryAvail: 50.0,
+		DiskAvail:   100.0,
+	}))
+
+	proxyServer := httptest.NewServer(http.HandlerFunc(server.handleProxyOrNotFound))
+	t.Cleanup(proxyServer.Close)
+	return proxyServer
+}
+
+// TestProxyRouteFor_LongestPrefix verifies the most specific route wins and route prefixes are proxied
+func TestProxyRouteFor_LongestPrefix(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.ProxyEndpoints = []string{"/api"}
+		c.RequestTimeout = 30
+		c.ProxyRoutes = []common.ProxyRouteConfig{
+			{Prefix: "/api", RequestTimeoutSecs: 60},
+			{Prefix: "/api/events", Streaming: true},
+			{Prefix: "/upload", ReadTimeoutSecs: 600},
+		}
+	})
+
+	if route := server.proxyRouteFor("/api/events/stream"); route == nil || route.Prefix != "/api/events" {
+		t.Errorf("Expected /api/events route, got %+v", route)
+	}
+	if route := server.proxyRouteFor("/api/users"); route == nil || route.Prefix != "/api" {
+		t.Errorf("Expected /api route, got %+v", route)
+	}
+	if route := server.proxyRouteFor("/other"); route != nil {
+		t.Errorf("Expected no route for /other, got %+v", route)
+	}
+
+	prefixes := proxyPrefixes(server.config)
+	if len(prefixes) != 3 || prefixes[2] != "/upload" {
+		t.Errorf("Expected route prefixes appended to proxy endpoints, got %v", prefixes)
+	}
+
+	cases := map[string]time.Duration{
+		"/api/users":         60 * time.Second,
+		"/api/events/stream": 0,
+		"/upload/file":       30 * time.Second,
+		"/other":             30 * time.Second,
+	}
+	for path, expected := range cases {
+		if got := server.proxyRequestTimeout(httptest.NewRequest("GET", path, nil)); got != expected {
+			t.Errorf("Expected timeout %v for %s, got %v", expected, path, got)
+		}
+	}
+}
+
+// TestProxyRoute_MaxLifetime verifies a slow backend is cut off at the route's max lifetime
+func TestProxyRoute_MaxLifetime(t *testing.T) {
+	proxyServer := newProxyRouteTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+			w.Write([]byte("too late"))
+		}
+	}, []common.ProxyRouteConfig{{Prefix: "/slow", MaxLifetimeSecs: 1}})
+
+	start := time.Now()
+	resp, err := http.Get(proxyServer.URL + "/slow/job")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("Expected 504 after max lifetime, got %d", resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected request to end after ~1s, took %v", elapsed)
+	}
+}
+
+// TestProxyRoute_IdleTimeout verifies a stalled streaming response is closed after the idle timeout
+func TestProxyRoute_IdleTimeout(t *testing.T) {
+	proxyServer := newProxyRouteTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		// Stall without sending anything else
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}, []common.ProxyRouteConfig{{Prefix: "/events", Streaming: true, IdleTimeoutSecs: 1}})
+
+	start := time.Now()
+	resp, err := http.Get(proxyServer.URL + "/events")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "data: first\n\n" {
+		t.Errorf("Expected first event before idle close, got %q", body)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected stream to close after ~1s idle, took %v", elapsed)
+	}
+}
+
+// TestProxyRoute_MethodFilter verifies disallowed methods get 405, HEAD follows GET and OPTIONS is answered locally
+func TestProxyRoute_MethodFilter(t *testing.T) {
+	var backendMethods []string
+	proxyServer := newProxyRouteTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		backendMethods = append(backendMethods, r.Method)
+		w.Write([]byte("ok"))
+	}, []common.ProxyRouteConfig{{Prefix: "/files", Methods: []string{"get"}, Options: "local"}})
+
+	doRequest := func(method string) *http.Response {
+		req, _ := http.NewRequest(method, proxyServer.URL+"/files/report.pdf", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s request failed: %v", method, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := doRequest("POST")
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", resp.StatusCode)
+	}
+	if allow := resp.Header.Get("Allow"); allow != "GET, HEAD, OPTIONS" {
+		t.Errorf("Expected Allow: GET, HEAD, OPTIONS, got %q", allow)
+	}
+
+	if resp := doRequest("HEAD"); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected HEAD to be proxied, got %d", resp.StatusCode)
+	}
+
+	resp = doRequest("OPTIONS")
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Allow") == "" {
+		t.Errorf("Expected local 204 with Allow for OPTIONS, got %d (Allow=%q)", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+
+	if len(backendMethods) != 1 || backendMethods[0] != "HEAD" {
+		t.Errorf("Expected only HEAD to reach the backend, got %v", backendMethods)
+	}
+}
+
+// TestProxyRoute_OptionsPassthrough verifies OPTIONS reaches the backend when configured
+func TestProxyRoute_OptionsPassthrough(t *testing.T) {
+	proxyServer := newProxyRouteTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend-Method", r.Method)
+		w.WriteHeader(http.StatusOK)
+	}, []common.ProxyRouteConfig{{Prefix: "/api", Methods: []string{"POST"}, Options: "passthrough"}})
+
+	req, _ := http.NewRequest("OPTIONS", proxyServer.URL+"/api/items", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.Header.Get("X-Backend-Method") != "OPTIONS" {
+		t.Errorf("Expected OPTIONS to be answered by the backend, got status %d", resp.StatusCode)
+	}
+
+	if err := validateProxyRoutes([]common.ProxyRouteConfig{{Prefix: "/api", Options: "bogus"}}); err == nil {
+		t.Error("Expected invalid options mode to be rejected")
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// invalidClientAge is how long a database record may go unseen before purges treat it as invalid
+const invalidClientAge = 30 * 24 * time.Hour
+
+// purgeFilter narrows which stale or invalid backends POST /clients/purge removes; it never adds live ones
+type purgeFilter struct {
+	olderThan time.Duration // Not seen for at least this long (0 = any stale backend)
+	pool      string
+	labels    map[string]string // key → value; "" matches any value of the key
+	health    string            // healthy, unhealthy or unknown
+}
+
+// PurgeCandidate is a backend a purge removes (or, in a dry run, would remove) and why
+type PurgeCandidate struct {
+	ClientID     string     `json:"client_id"`
+	Hostname     string     `json:"hostname,omitempty"`
+	Pool         string     `json:"pool,omitempty"`
+	HealthStatus string     `json:"health_status"`
+	LastSeen     *time.Time `json:"last_seen,omitempty"` // Missing for database records without a timestamp
+	Reason       string     `json:"reason"`
+}
+
+// parsePurgeFilter reads older_than, pool, label and health
+func parsePurgeFilter(params url.Values) (purgeFilter, error) {
+	f := purgeFilter{pool: params.Get("pool"), health: params.Get("health")}
+	switch f.health {
+	case "", "healthy", "unhealthy", "unknown":
+	default:
+		return f, fmt.Errorf("invalid health %q (expected healthy, unhealthy or unknown)", f.health)
+	}
+	if value := params.Get("older_than"); value != "" {
+		olderThan, err := time.ParseDuration(value)
+		if err != nil || olderThan <= 0 {
+			return f, fmt.Errorf("invalid older_than %q (expected a duration such as 2h)", value)
+		}
+		f.olderThan = olderThan
+	}
+	labels, err := parseLabelFilters(params["label"])
+	if err != nil {
+		return f, err
+	}
+	f.labels = labels
+	return f, nil
+}
+
+// match reports whether a backend passes the filters; lastSeen is nil when it is unknown
+func (f purgeFilter) match(pool string, labels map[string]string, health string, lastSeen *time.Time, now time.Time) bool {
+	if f.pool != "" && pool != f.pool {
+		return false
+	}
+	if f.health != "" && health != f.health {
+		return false
+	}
+	if f.olderThan > 0 && lastSeen != nil && now.Sub(*lastSeen) < f.olderThan {
+		return false
+	}
+	return labelsMatch(labels, f.labels)
+}
+
+// staleCandidatesLocked lists cached backends past their stale timeout that pass the filters
+// Caller must hold s.mu
+func (s *Server) staleCandidatesLocked(f purgeFilter, now time.Time) []PurgeCandidate {
+	candidates := []PurgeCandidate{}
+	for id, client := range s.clientCache {
+		timeout := s.staleTimeoutFor(client)
+		unseen := now.Sub(client.LastSeen)
+		lastSeen := client.LastSeen
+		if unseen <= timeout || !f.match(client.Registration.Pool, client.Registration.Labels, client.HealthStatus, &lastSeen, now) {
+			continue
+		}
+		candidates = append(candidates, PurgeCandidate{
+			ClientID:     id,
+			Hostname:     client.Registration.Hostname,
+			Pool:         client.Registration.Pool,
+			HealthStatus: client.HealthStatus,
+			LastSeen:     &lastSeen,
+			Reason:       fmt.Sprintf("stale: no report for %s (stale after %s)", unseen.Round(time.Second), timeout),
+		})
+	}
+	return candidates
+}
+
+// invalidCandidates lists database records without a timestamp or unseen for over 30 days that pass
+// the filters, except those in skip. Records of backends still cached are filtered by their live state
+func (s *Server) invalidCandidates(f purgeFilter, now time.Time, skip map[string]bool) ([]PurgeCandidate, error) {
+	rows, err := s.db.Query(`
+		SELECT client_id, COALESCE(hostname, ''), COALESCE(pool, ''), labels, COALESCE(last_seen, '')
+		FROM clients
+		WHERE last_seen IS NULL
+		   OR last_seen = ''
+		   OR last_seen < datetime('now', '-30 days')
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type record struct {
+		candidate PurgeCandidate
+		labels    map[string]string
+	}
+	var records []record
+	for rows.Next() {
+		var rec record
+		var labelsJSON *string
+		var lastSeen string
+		if err := rows.Scan(&rec.candidate.ClientID, &rec.candidate.Hostname, &rec.candidate.Pool, &labelsJSON, &lastSeen); err != nil {
+			log.Printf("Error scanning client row: %v", err)
+			continue
+		}
+		if skip[rec.candidate.ClientID] {
+			continue
+		}
+		if labelsJSON != nil && *labelsJSON != "" {
+			json.Unmarshal([]byte(*labelsJSON), &rec.labels)
+		}
+		rec.candidate.Reason = "invalid: no last_seen recorded"
+		if t, ok := parseDBTimestamp(lastSeen); ok {
+			rec.candidate.LastSeen = &t
+			rec.candidate.Reason = fmt.Sprintf("invalid: last seen over %d days ago", int(invalidClientAge.Hours()/24))
+		}
+		records = append(records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	candidates := []PurgeCandidate{}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, rec := range records {
+		c := rec.candidate
+		c.HealthStatus = "unknown"
+		labels := rec.labels
+		if client, ok := s.clientCache[c.ClientID]; ok {
+			c.Pool, c.HealthStatus, labels = client.Registration.Pool, client.HealthStatus, client.Registration.Labels
+		}
+		if f.match(c.Pool, labels, c.HealthStatus, c.LastSeen, now) {
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates, nil
+}
+
+// parseDBTimestamp reads a timestamp stored as text in any of the SQLite driver's formats
+func parseDBTimestamp(value string) (time.Time, bool) {
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.Parse(layout, value); err == nil && !t.IsZero() {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// handlePurgeStaleClients handles POST/DELETE /clients/purge: removes stale backends and invalid
+// database records, narrowed by older_than, pool, label and health
+// With dry_run=true nothing is removed and the response lists what would be, with reasons
+func (s *Server) handlePurgeStaleClients(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	filter, err := parsePurgeFilter(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dryRun := false
+	if value := params.Get("dry_run"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid dry_run: %s", value), http.StatusBadRequest)
+			return
+		}
+	}
+	now := time.Now()
+
+	// Stale backends are selected and removed from the cache under one lock, so one reporting
+	// concurrently is not lost; their stats, sticky assignments and pending allocations go with them
+	var result deregisterResult
+	s.mu.Lock()
+	stale := s.staleCandidatesLocked(filter, now)
+	staleIDs := make([]string, 0, len(stale))
+	skip := make(map[string]bool, len(stale))
+	for _, c := range stale {
+		staleIDs = append(staleIDs, c.ClientID)
+		skip[c.ClientID] = true
+	}
+	if !dryRun && len(staleIDs) > 0 {
+		s.invalidateRoutingSnapshot()
+		for _, id := range staleIDs {
+			s.removeClientStateLocked(id, &result)
+		}
+	}
+	s.mu.Unlock()
+
+	invalid, err := s.invalidCandidates(filter, now, skip)
+	if err != nil {
+		log.Printf("Error purging invalid clients: %v", err)
+	}
+	candidates := append(stale, invalid...)
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].ClientID < candidates[j].ClientID })
+
+	if dryRun {
+		LogInfoWithData("Purge dry run", map[string]interface{}{
+			"would_purge": len(candidates),
+			"actor":       requestActor(r),
+		})
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":      "dry_run",
+			"dry_run":     true,
+			"would_purge": len(candidates),
+			"clients":     candidates,
+			"timestamp":   now,
+		}); err != nil {
+			log.Printf("Warning: Failed to encode purge response: %v", err)
+		}
+		return
+	}
+
+	if len(staleIDs) > 0 {
+		s.publishClientsRemoved(staleIDs, "purged")
+		s.finishDeregistration(staleIDs, "purged", &result)
+	}
+	invalidIDs := make([]string, 0, len(invalid))
+	for _, c := range invalid {
+		invalidIDs = append(invalidIDs, c.ClientID)
+	}
+	dbPurged := s.deregisterClients(invalidIDs, "invalid").Clients
+
+	totalPurged := len(staleIDs) + int(dbPurged)
+	log.Printf("Purged %d stale clients (%d from cache, %d from database)", totalPurged, len(staleIDs), dbPurged)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":       "success",
+		"purged":       totalPurged,
+		"cache_purged": len(staleIDs),
+		"db_purged":    dbPurged,
+		"removed":      result,
+		"clients":      candidates,
+		"timestamp":    now,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode purge response: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type purgeResponse struct {
+	Status     string           `json:"status"`
+	Purged     int              `json:"purged"`
+	WouldPurge int              `json:"would_purge"`
+	Clients    []PurgeCandidate `json:"clients"`
+}
+
+func postPurge(t *testing.T, server *Server, query string) (int, purgeResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	server.handlePurgeStaleClients(rec, httptest.NewRequest(http.MethodPost, "/clients/purge?"+query, nil))
+	var resp purgeResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+	}
+	return rec.Code, resp
+}
+
+func candidateIDs(candidates []PurgeCandidate) string {
+	ids := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		ids = append(ids, c.ClientID)
+	}
+	return strings.Join(ids, ",")
+}
+
+// addPurgeFleet adds a live backend and three stale ones in different pools, labels and health
+func addPurgeFleet(server *Server) {
+	for _, b := range []struct {
+		id, pool, health, env string
+		unseen                time.Duration
+	}{
+		{"live", "gpu", "healthy", "prod", 0},
+		{"stale-gpu", "gpu", "unhealthy", "prod", 10 * time.Minute},
+		{"stale-cpu", "cpu", "unhealthy", "staging", 10 * time.Minute},
+		{"stale-old", "cpu", "unknown", "prod", 3 * time.Hour},
+	} {
+		client := NewMockClient(MockClientOptions{ClientID: b.id})
+		client.Registration.Pool = b.pool
+		client.Registration.Labels = map[string]string{"env": b.env}
+		client.HealthStatus = b.health
+		client.LastSeen = time.Now().Add(-b.unseen)
+		server.AddMockClient(client)
+	}
+}
+
+// TestPurge_DryRunListsReasonsWithoutRemoving verifies a dry run reports stale backends with reasons and keeps them
+func TestPurge_DryRunListsReasonsWithoutRemoving(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+	addPurgeFleet(server)
+
+	code, resp := postPurge(t, server, "dry_run=true")
+	if code != http.StatusOK || resp.Status != "dry_run" || resp.WouldPurge != 3 {
+		t.Fatalf("Expected a dry run listing 3 backends, got %d %+v", code, resp)
+	}
+	if got := candidateIDs(resp.Clients); got != "stale-cpu,stale-gpu,stale-old" {
+		t.Errorf("Unexpected candidates: %s", got)
+	}
+	for _, c := range resp.Clients {
+		if !strings.HasPrefix(c.Reason, "stale: no report for ") || c.LastSeen == nil {
+			t.Errorf("Expected a stale reason for %s, got %+v", c.ClientID, c)
+		}
+	}
+
+	server.mu.RLock()
+	remaining := len(server.clientCache)
+	server.mu.RUnlock()
+	if remaining != 4 {
+		t.Errorf("Expected a dry run to remove nothing, %d backends left", remaining)
+	}
+}
+
+// TestPurge_Filters verifies older_than, pool, label and health narrow the purge and never reach live backends
+func TestPurge_Filters(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+	addPurgeFleet(server)
+
+	for _, tt := range []struct{ query, want string }{
+		{"pool=gpu", "stale-gpu"},
+		{"label=env=prod", "stale-gpu,stale-old"},
+		{"label=env", "stale-cpu,stale-gpu,stale-old"},
+		{"health=unhealthy&pool=cpu", "stale-cpu"},
+		{"older_than=1h", "stale-old"},
+		{"health=healthy", ""},
+	} {
+		if _, resp := postPurge(t, server, "dry_run=1&"+tt.query); candidateIDs(resp.Clients) != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.query, tt.want, candidateIDs(resp.Clients))
+		}
+	}
+
+	for _, query := range []string{"older_than=soon", "health=sick", "label==x", "dry_run=maybe"} {
+		if code, _ := postPurge(t, server, query); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, code)
+		}
+	}
+
+	code, resp := postPurge(t, server, "label=env=prod")
+	if code != http.StatusOK || resp.Purged != 2 || candidateIDs(resp.Clients) != "stale-gpu,stale-old" {
+		t.Fatalf("Expected the filtered purge to remove 2 backends, got %d %+v", code, resp)
+	}
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	for _, id := range []string{"live", "stale-cpu"} {
+		if _, ok := server.clientCache[id]; !ok {
+			t.Errorf("Expected %s to survive the filtered purge", id)
+		}
+	}
+}
+
+// TestPurge_InvalidDatabaseRecords verifies records without a usable last_seen are listed with their reason
+func TestPurge_InvalidDatabaseRecords(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	if _, err := db.Exec(`INSERT INTO clients (client_id, hostname, pool, last_seen) VALUES
+		('ancient', 'h1', 'cpu', datetime('now', '-40 days')), ('blank', 'h2', 'gpu', '')`); err != nil {
+		t.Fatalf("Failed to insert clients: %v", err)
+	}
+
+	_, resp := postPurge(t, server, "dry_run=true")
+	if got := candidateIDs(resp.Clients); got != "ancient,blank" {
+		t.Fatalf("Expected both invalid records, got %s", got)
+	}
+	if resp.Clients[0].Reason != "invalid: last seen over 30 days ago" || resp.Clients[1].Reason != "invalid: no last_seen recorded" {
+		t.Errorf("Unexpected reasons: %+v", resp.Clients)
+	}
+
+	if _, resp := postPurge(t, server, "pool=gpu"); resp.Purged != 1 {
+		t.Errorf("Expected the pool filter to purge one record, got %+v", resp)
+	}
+	var remaining int
+	db.QueryRow("SELECT COUNT(*) FROM clients").Scan(&remaining)
+	if remaining != 1 {
+		t.Errorf("Expected one record left, got %d", remaining)
+	}
+}
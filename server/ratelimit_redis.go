@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"cyqle.in/opsen/common"
+)
+
+// redisTokenBucketScript atomically refills and takes one token from a per-key bucket
+// KEYS[1] = bucket key, ARGV = rate (tokens/sec), capacity, now (ms)
+// Returns 1 if the request is allowed, 0 otherwise
+var redisTokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+
+local elapsed = math.max(0, now - ts) / 1000
+tokens = math.min(capacity, tokens + elapsed * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate * 1000) + 1000)
+return allowed
+`)
+
+// newRedisClient creates a Redis client from configuration
+func newRedisClient(config common.RedisConfig) *redis.Client {
+	options := &redis.Options{
+		Addr:     config.Address,
+		Username: config.Username,
+		Password: config.Password,
+		DB:       config.DB,
+	}
+	if config.TLS {
+		options.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return redis.NewClient(options)
+}
+
+// RedisRateLimiter implements token bucket rate limiting per IP shared by all replicas
+// If Redis is unreachable, requests are limited by a per-instance fallback bucket instead
+type RedisRateLimiter struct {
+	client    *redis.Client
+	keyPrefix string
+	rate      float64 // Tokens per second
+	burst     int
+	timeout   time.Duration
+	now       func() time.Time
+
+	fallback     *RateLimiter
+	warnMu       sync.Mutex
+	lastWarnedAt time.Time
+}
+
+// NewRedisRateLimiter creates a Redis-backed rate limiter
+func NewRedisRateLimiter(client *redis.Client, keyPrefix string, requestsPerMinute, burst int) *RedisRateLimiter {
+	return &RedisRateLimiter{
+		client:    client,
+		keyPrefix: keyPrefix,
+		rate:      float64(requestsPerMinute) / 60.0,
+		burst:     burst,
+		timeout:   200 * time.Millisecond,
+		now:       time.Now,
+		fallback:  NewRateLimiter(requestsPerMinute, burst),
+	}
+}
+
+// Ping checks that Redis is reachable
+func (rl *RedisRateLimiter) Ping(ctx context.Context) error {
+	return rl.client.Ping(ctx).Err()
+}
+
+// Allow takes a token from the shared bucket for an IP
+func (rl *RedisRateLimiter) Allow(ip string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), rl.timeout)
+	defer cancel()
+
+	allowed, err := redisTokenBucketScript.Run(ctx, rl.client,
+		[]string{rl.keyPrefix + "ratelimit:" + ip},
+		rl.rate, rl.burst, rl.now().UnixMilli()).Int()
+	if err != nil {
+		rl.warnFallback(err)
+		return rl.fallback.Allow(ip)
+	}
+	return allowed == 1
+}
+
+// warnFallback logs Redis failures at most once per minute
+func (rl *RedisRateLimiter) warnFallback(err error) {
+	rl.warnMu.Lock()
+	defer rl.warnMu.Unlock()
+	if time.Since(rl.lastWarnedAt) < time.Minute {
+		return
+	}
+	rl.lastWarnedAt = time.Now()
+	LogWarn(fmt.Sprintf("Redis rate limiter unavailable, using per-instance limits: %v", err))
+}
+
+func (rl *RedisRateLimiter) Middleware(next http.Handler) http.Handler {
+	return rateLimitMiddleware(rl, next)
+}
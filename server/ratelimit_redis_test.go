@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"cyqle.in/opsen/common"
+)
+
+// newTestRedisLimiters creates two limiters (simulating two LB replicas) sharing one Redis
+func newTestRedisLimiters(t *testing.T, requestsPerMinute, burst int) (*miniredis.Miniredis, *RedisRateLimiter, *RedisRateLimiter) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+
+	newLimiter := func() *RedisRateLimiter {
+		client := newRedisClient(common.RedisConfig{Address: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+		return NewRedisRateLimiter(client, "opsen:", requestsPerMinute, burst)
+	}
+	return mr, newLimiter(), newLimiter()
+}
+
+// TestRedisRateLimiter_SharedAcrossReplicas verifies replicas draw from one bucket per IP
+func TestRedisRateLimiter_SharedAcrossReplicas(t *testing.T) {
+	_, replicaA, replicaB := newTestRedisLimiters(t, 60, 4)
+
+	allowed := 0
+	for i := 0; i < 4; i++ {
+		if replicaA.Allow("1.2.3.4") {
+			allowed++
+		}
+		if replicaB.Allow("1.2.3.4") {
+			allowed++
+		}
+	}
+	if allowed != 4 {
+		t.Errorf("Expected burst of 4 shared across replicas, got %d allowed", allowed)
+	}
+
+	if !replicaB.Allow("5.6.7.8") {
+		t.Error("Expected a different IP to have its own bucket")
+	}
+}
+
+// TestRedisRateLimiter_Refill verifies tokens refill over time
+func TestRedisRateLimiter_Refill(t *testing.T) {
+	_, limiter, _ := newTestRedisLimiters(t, 60, 1)
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	if !limiter.Allow("1.2.3.4") {
+		t.Fatal("Expected first request to be allowed")
+	}
+	if limiter.Allow("1.2.3.4") {
+		t.Fatal("Expected second request to be limited")
+	}
+
+	// 60 requests/minute = 1 token per second
+	now = now.Add(1100 * time.Millisecond)
+	if !limiter.Allow("1.2.3.4") {
+		t.Error("Expected a token after one second")
+	}
+}
+
+// TestRedisRateLimiter_FallbackWhenUnavailable verifies per-instance limits apply while Redis is down
+func TestRedisRateLimiter_FallbackWhenUnavailable(t *testing.T) {
+	mr, limiter, _ := newTestRedisLimiters(t, 60, 2)
+	mr.Close()
+
+	if !limiter.Allow("1.2.3.4") || !limiter.Allow("1.2.3.4") {
+		t.Error("Expected fallback bucket to allow the burst")
+	}
+	if limiter.Allow("1.2.3.4") {
+		t.Error("Expected fallback bucket to enforce the limit")
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"syscall"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// defaultProbeBackTimeout bounds each probe-back dial when no health check timeout is configured
+const defaultProbeBackTimeout = 5 * time.Second
+
+// handleProbeBack probes a client's registered endpoints from the load balancer so the agent
+// can tell whether its advertised endpoint is reachable from outside (NAT, firewall, wrong address)
+// Only registered endpoints are probed; callers cannot make the server dial arbitrary addresses
+func (s *Server) handleProbeBack(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req common.ProbeBackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.ClientID == "" {
+		http.Error(w, "Missing required field: client_id", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.RLock()
+	client, ok := s.clientCache[req.ClientID]
+	var endpoints []string
+	var tenant string
+	if ok {
+		endpoints = clientEndpointURLs(client)
+		tenant = normalizeTenant(client.Registration.Tenant)
+	}
+	s.mu.RUnlock()
+
+	if !ok {
+		http.Error(w, fmt.Sprintf("Client not registered: %s", req.ClientID), http.StatusNotFound)
+		return
+	}
+	if keyTenant, scoped := tenantFromContext(r); scoped && keyTenant != tenant {
+		http.Error(w, fmt.Sprintf("API key cannot probe client: %s", req.ClientID), http.StatusForbidden)
+		return
+	}
+
+	timeout := time.Duration(s.config.HealthCheckTimeoutSecs) * time.Second
+	if timeout <= 0 {
+		timeout = defaultProbeBackTimeout
+	}
+
+	response := common.ProbeBackResponse{ClientID: req.ClientID}
+	for _, endpoint := range endpoints {
+		result := probeReachability(endpoint, timeout)
+		if !result.Reachable {
+			LogWarnWithData("Advertised endpoint unreachable from load balancer", map[string]interface{}{
+				"client_id": req.ClientID,
+				"endpoint":  endpoint,
+				"error":     result.Error,
+				"hint":      result.Hint,
+			})
+		}
+		response.Endpoints = append(response.Endpoints, result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Warning: Failed to encode probe-back response: %v", err)
+	}
+}
+
+// clientEndpointURLs returns the distinct endpoint URLs a client advertised
+// Dual-stack agents' endpoints on every address family are included
+func clientEndpointURLs(client *ClientState) []string {
+	urls := []string{client.Endpoint}
+	for _, candidate := range client.EndpointCandidates {
+		if !slices.Contains(urls, candidate) {
+			urls = append(urls, candidate)
+		}
+	}
+	for _, endpoint := range client.Endpoints {
+		seen := false
+		for _, existing := range urls {
+			if existing == endpoint.URL {
+				seen = true
+				break
+			}
+		}
+		if !seen && endpoint.URL != "" {
+			urls = append(urls, endpoint.URL)
+		}
+	}
+	return urls
+}
+
+// probeReachability dials an endpoint and explains the likely cause when it cannot be reached
+func probeReachability(endpoint string, timeout time.Duration) common.EndpointReachability {
+	result := common.EndpointReachability{
+		Endpoint:  endpoint,
+		CheckedAt: time.Now(),
+	}
+
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Host == "" {
+		result.Error = fmt.Sprintf("invalid endpoint URL: %s", endpoint)
+		result.Hint = "set endpoint_url to a full URL such as http://203.0.113.10:11000"
+		return result
+	}
+
+	addr := parsed.Host
+	if parsed.Port() == "" {
+		port := "80"
+		if parsed.Scheme == "https" || parsed.Scheme == "wss" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(parsed.Hostname(), port)
+	}
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		result.Error = err.Error()
+		result.Hint = reachabilityHint(parsed.Hostname(), err)
+		return result
+	}
+	conn.Close()
+
+	result.Reachable = true
+	return result
+}
+
+// reachabilityHint maps a dial error to the most likely misconfiguration
+func reachabilityHint(host string, err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return "hostname does not resolve from the load balancer"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		if ip := net.ParseIP(host); ip != nil && (ip.IsPrivate() || ip.IsLoopback()) {
+			return "connection refused on a private/loopback address; set endpoint_url to an address the load balancer can reach"
+		}
+		return "connection refused; nothing is listening on the advertised port or it is not forwarded"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		if ip := net.ParseIP(host); ip != nil && (ip.IsPrivate() || ip.IsLoopback()) {
+			return "timed out on a private address; the backend is likely behind NAT, set endpoint_url to its public address"
+		}
+		return "timed out; a firewall or NAT is likely dropping inbound connections"
+	default:
+		return "load balancer could not connect to the advertised endpoint"
+	}
+}
+
+// endpointUnreachable reports whether the client's latest probe-back found an unreachable endpoint
+func endpointUnreachable(client *ClientState) bool {
+	for _, result := range client.Stats.Reachability {
+		if !result.Reachable {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestHandleProbeBack verifies registered endpoints are probed and unreachable ones explained
+func TestHandleProbeBack(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	// Grab a free port and close it so connections are refused
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedURL := "http://" + listener.Addr().String()
+	listener.Close()
+
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	client := NewMockClient(MockClientOptions{ClientID: "agent-1", Endpoint: backend.URL})
+	client.Endpoints = []common.EndpointConfig{{URL: backend.URL}, {URL: closedURL}}
+	server.AddMockClient(client)
+
+	body, _ := json.Marshal(common.ProbeBackRequest{ClientID: "agent-1"})
+	rec := httptest.NewRecorder()
+	server.handleProbeBack(rec, httptest.NewRequest("POST", "/probe-back", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp common.ProbeBackResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Endpoints) != 2 {
+		t.Fatalf("Expected 2 distinct endpoints probed, got %+v", resp.Endpoints)
+	}
+	if !resp.Endpoints[0].Reachable {
+		t.Errorf("Expected listening endpoint to be reachable, got %+v", resp.Endpoints[0])
+	}
+	if resp.Endpoints[1].Reachable || !strings.Contains(resp.Endpoints[1].Hint, "refused") {
+		t.Errorf("Expected closed port to be unreachable with a refused hint, got %+v", resp.Endpoints[1])
+	}
+
+	body, _ = json.Marshal(common.ProbeBackRequest{ClientID: "unknown"})
+	rec = httptest.NewRecorder()
+	server.handleProbeBack(rec, httptest.NewRequest("POST", "/probe-back", bytes.NewReader(body)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown client, got %d", rec.Code)
+	}
+}
+
+// TestListClients_EndpointUnreachable verifies reported reachability is surfaced in /clients
+func TestListClients_EndpointUnreachable(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	client := NewMockClient(MockClientOptions{ClientID: "agent-1"})
+	client.Stats.Reachability = []common.EndpointReachability{
+		{Endpoint: client.Endpoint, Reachable: false, Error: "i/o timeout"},
+	}
+	server.AddMockClient(client)
+
+	rec := httptest.NewRecorder()
+	server.handleListClients(rec, httptest.NewRequest("GET", "/clients", nil))
+
+	var clients []map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&clients); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(clients) != 1 || clients[0]["endpoint_unreachable"] != true {
+		t.Errorf("Expected endpoint_unreachable: true, got %+v", clients)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// reconcileConcurrency bounds how many agents are probed at once on startup
+const reconcileConcurrency = 16
+
+// maxProbeStatsBytes bounds a probed stats report, which is far smaller in practice
+const maxProbeStatsBytes = 1 << 20
+
+// validateProbeStatsURL checks the probe_stats_url an agent registers with
+func validateProbeStatsURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid probe_stats_url: %q", raw)
+	}
+	return nil
+}
+
+// reconcileFleet fetches fresh stats from every loaded backend that serves them (probe_stats_listen),
+// so routing after a restart starts from current load instead of the last report stored before it.
+// Backends that do not answer within timeout keep their stored state until they next report
+func (s *Server) reconcileFleet(ctx context.Context, timeout time.Duration) {
+	type probeTarget struct {
+		clientID string
+		url      string
+		token    string
+	}
+
+	s.mu.RLock()
+	var targets []probeTarget
+	skipped := 0
+	for id, client := range s.clientCache {
+		if client.Registration.ProbeStatsURL == "" {
+			skipped++
+			continue
+		}
+		targets = append(targets, probeTarget{id, client.Registration.ProbeStatsURL, client.Registration.ProbeStatsToken})
+	}
+	s.mu.RUnlock()
+	if len(targets) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: s.config.TLSInsecureSkipVerify,
+			},
+		},
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reconciled, failed := 0, 0
+	sem := make(chan struct{}, reconcileConcurrency)
+	for _, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			stats, err := probeStats(ctx, httpClient, target.url, target.token)
+			if err == nil && stats.ClientID != target.clientID {
+				err = fmt.Errorf("agent reported client_id %q", stats.ClientID)
+			}
+			if err == nil {
+				err = s.applyProbedStats(stats)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+				LogWarnWithData("Failed to fetch startup stats from backend", map[string]interface{}{
+					"client_id": target.clientID,
+					"url":       target.url,
+					"error":     err.Error(),
+				})
+				return
+			}
+			reconciled++
+		}()
+	}
+	wg.Wait()
+
+	LogInfoWithData("Startup fleet reconciliation finished", map[string]interface{}{
+		"reconciled": reconciled,
+		"failed":     failed,
+		"skipped":    skipped,
+	})
+}
+
+// probeStats fetches an agent's latest stats report from its probe_stats_url
+func probeStats(ctx context.Context, httpClient *http.Client, probeURL, token string) (common.ResourceStats, error) {
+	var stats common.ResourceStats
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL, nil)
+	if err != nil {
+		return stats, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return stats, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return stats, fmt.Errorf("agent returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxProbeStatsBytes)).Decode(&stats); err != nil {
+		return stats, fmt.Errorf("invalid stats: %w", err)
+	}
+	return stats, nil
+}
+
+// applyProbedStats stores a probed report the way POST /stats stores a full snapshot
+func (s *Server) applyProbedStats(stats common.ResourceStats) error {
+	stats.Delta, stats.BaseSeq = false, 0
+	schemaVersion, err := common.NegotiateSchemaVersion(stats.SchemaVersion)
+	if err != nil {
+		return err
+	}
+	stats.SchemaVersion = schemaVersion
+
+	s.mu.Lock()
+	s.invalidateRoutingSnapshot()
+	client, ok := s.clientCache[stats.ClientID]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("client deregistered")
+	}
+	raw := stats
+	now := time.Now()
+	if fieldErrors, rejected := s.checkStatsLocked(client, &stats, now); rejected {
+		s.mu.Unlock()
+		return fmt.Errorf("stats rejected: %d invalid fields", len(fieldErrors))
+	}
+	s.checkStatsAnomalyLocked(client, raw, now)
+	client.Stats = stats
+	client.LastSeen = now
+	s.updateGPUFaultLocked(client, stats.GPUs, now)
+	tenant := client.Registration.Tenant
+	s.mu.Unlock()
+	s.routeCache.Invalidate(stats.ClientID)
+
+	s.exporters.Export(stats, tenant)
+	s.persistStats(stats)
+	return nil
+}
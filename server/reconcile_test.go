@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// fakeProbeAgent serves stats at /probe-stats to requests carrying token
+func fakeProbeAgent(t *testing.T, token string, stats common.ResourceStats) *httptest.Server {
+	t.Helper()
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(stats)
+	}))
+	t.Cleanup(agent.Close)
+	return agent
+}
+
+// TestReconcileFleet_FetchesStatsAfterRestart verifies a restarted server replaces stored state with stats fetched from the agent
+func TestReconcileFleet_FetchesStatsAfterRestart(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	fresh := NewMockClient(MockClientOptions{ClientID: "edge-1", CPUUsageAvg: []float64{10, 10, 10, 10}}).Stats
+	agent := fakeProbeAgent(t, "secret", fresh)
+	reg := common.ClientRegistration{ClientID: "edge-1", EndpointURL: "http://10.0.0.1:11000",
+		ProbeStatsURL: agent.URL + "/probe-stats", ProbeStatsToken: "secret"}
+	if rec := postRegistration(server, reg); rec.Code != http.StatusOK {
+		t.Fatalf("Expected registration to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	restarted := NewTestServer(t, db)
+	if err := restarted.loadClients(); err != nil {
+		t.Fatalf("Failed to load clients: %v", err)
+	}
+	restarted.reconcileFleet(context.Background(), 5*time.Second)
+
+	restarted.mu.RLock()
+	defer restarted.mu.RUnlock()
+	client := restarted.clientCache["edge-1"]
+	if len(client.Stats.CPUUsageAvg) != 4 || client.Stats.CPUUsageAvg[0] != 10 {
+		t.Errorf("Expected the probed stats to be applied, got %+v", client.Stats)
+	}
+	if time.Since(client.LastSeen) > time.Minute {
+		t.Errorf("Expected the backend to be marked seen, last seen %v", client.LastSeen)
+	}
+}
+
+// TestReconcileFleet_KeepsStateOnFailure verifies refused or mismatched probes leave the stored state alone
+func TestReconcileFleet_KeepsStateOnFailure(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	stale := time.Now().Add(-3 * time.Hour)
+	for _, tc := range []struct {
+		id, token string
+		reported  string
+	}{
+		{"wrong-token", "other", "wrong-token"},
+		{"wrong-client", "secret", "someone-else"},
+		{"no-probe", "", ""},
+	} {
+		client := NewMockClient(MockClientOptions{ClientID: tc.id})
+		client.LastSeen = stale
+		if tc.token != "" {
+			agent := fakeProbeAgent(t, "secret", common.ResourceStats{ClientID: tc.reported, CPUCores: 64})
+			client.Registration.ProbeStatsURL = agent.URL + "/probe-stats"
+			client.Registration.ProbeStatsToken = tc.token
+		}
+		server.AddMockClient(client)
+	}
+
+	server.reconcileFleet(context.Background(), 5*time.Second)
+
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	for id, client := range server.clientCache {
+		if client.Stats.CPUCores == 64 || !client.LastSeen.Equal(stale) {
+			t.Errorf("Expected %s to keep its stored state, got %d cores seen %v", id, client.Stats.CPUCores, client.LastSeen)
+		}
+	}
+}
+
+// TestRegister_RejectsInvalidProbeStatsURL verifies agents cannot register a probe URL the server cannot fetch
+func TestRegister_RejectsInvalidProbeStatsURL(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	reg := common.ClientRegistration{ClientID: "edge-1", EndpointURL: "http://10.0.0.1:11000", ProbeStatsURL: "file:///etc/passwd"}
+	if rec := postRegistration(server, reg); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a non-HTTP probe_stats_url, got %d", rec.Code)
+	}
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"cyqle.in/opsen/common"
@@ -213,3 +215,76 @@ func TestHandleRegister_EndpointSelection(t *testing.T) {
 		}
 	})
 }
+
+// TestHandleRegister_SchemaVersion verifies legacy agents are accepted and unknown future majors rejected
+func TestHandleRegister_SchemaVersion(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+
+	tests := []struct {
+		name           string
+		version        string
+		expectedStatus int
+		negotiated     string
+	}{
+		{"legacy agent without version", "", http.StatusOK, common.LegacySchemaVersion},
+		{"current version", common.SchemaVersion, http.StatusOK, common.SchemaVersion},
+		{"newer minor negotiates down", "1.9", http.StatusOK, common.SchemaVersion},
+		{"future major", "2.0", http.StatusBadRequest, ""},
+		{"malformed", "latest", http.StatusBadRequest, ""},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := common.ClientRegistration{
+				SchemaVersion: tt.version,
+				ClientID:      fmt.Sprintf("schema-client-%d", i),
+				Hostname:      "worker",
+				PublicIP:      fmt.Sprintf("1.2.3.%d", i+1),
+				TotalCPU:      4,
+			}
+			body, _ := json.Marshal(reg)
+			rec := httptest.NewRecorder()
+			server.handleRegister(rec, httptest.NewRequest("POST", "/register", bytes.NewReader(body)))
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				if !strings.Contains(rec.Body.String(), "schema_version") {
+					t.Errorf("Expected error to name schema_version, got %q", rec.Body.String())
+				}
+				return
+			}
+
+			var response map[string]string
+			json.Unmarshal(rec.Body.Bytes(), &response)
+			if response["schema_version"] != tt.negotiated {
+				t.Errorf("Expected negotiated version %s, got %s", tt.negotiated, response["schema_version"])
+			}
+
+			rec = httptest.NewRecorder()
+			server.handleListClients(rec, httptest.NewRequest("GET", "/clients", nil))
+			if !strings.Contains(rec.Body.String(), fmt.Sprintf(`"schema_version":"%s"`, tt.negotiated)) {
+				t.Errorf("Expected /clients to show schema_version %s", tt.negotiated)
+			}
+		})
+	}
+}
+
+// TestHandleStats_RejectsFutureSchemaMajor verifies stats from an unknown future major are rejected
+func TestHandleStats_RejectsFutureSchemaMajor(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend"}))
+
+	body, _ := json.Marshal(common.ResourceStats{SchemaVersion: "2.0", ClientID: "backend", CPUCores: 4})
+	rec := httptest.NewRecorder()
+	server.handleStats(rec, httptest.NewRequest("POST", "/stats", bytes.NewReader(body)))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "upgrade the server") {
+		t.Errorf("Expected 400 asking to upgrade the server, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
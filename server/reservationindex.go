@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// reservationIndex keeps each backend's pending reservation totals, recomputed whenever that backend's
+// allocations change, so the scoring loop can check availability after reservations in O(1) per
+// candidate without s.mu. Backends full because of in-flight placements are then dropped before they
+// are scored, instead of being scored and rejected one by one when the winner is confirmed live.
+// The live confirmation in firstLiveFit stays authoritative; the index only narrows the candidates.
+type reservationIndex struct {
+	mu      sync.RWMutex
+	entries map[string]reservationEntry
+}
+
+type reservationEntry struct {
+	total      pendingReservation // Immutable once stored; GPUDevices is never written after indexing
+	validUntil time.Time          // Earliest lease expiry: past it the totals over-count and are not used
+}
+
+func newReservationIndex() *reservationIndex {
+	return &reservationIndex{entries: make(map[string]reservationEntry)}
+}
+
+// get returns a backend's indexed reservation totals, or empty totals when nothing is pending or a lease has
+// expired since indexing (the next cleanup pass reindexes it; until then the live check on the winner applies)
+func (x *reservationIndex) get(clientID string, now time.Time) pendingReservation {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	entry, ok := x.entries[clientID]
+	if !ok || now.After(entry.validUntil) {
+		return pendingReservation{}
+	}
+	return entry.total
+}
+
+func (x *reservationIndex) set(clientID string, entry reservationEntry) {
+	x.mu.Lock()
+	x.entries[clientID] = entry
+	x.mu.Unlock()
+}
+
+func (x *reservationIndex) remove(clientID string) {
+	x.mu.Lock()
+	delete(x.entries, clientID)
+	x.mu.Unlock()
+}
+
+func (x *reservationIndex) reset() {
+	x.mu.Lock()
+	x.entries = make(map[string]reservationEntry)
+	x.mu.Unlock()
+}
+
+// reservationTotals sums the unexpired allocations of one backend and returns when the first of them expires
+func reservationTotals(allocations []PendingAllocation, now time.Time) (pendingReservation, time.Time) {
+	var total pendingReservation
+	var validUntil time.Time
+	for _, pending := range allocations {
+		// Expired leases stop reserving immediately, not at the next cleanup pass
+		if pending.expired(now) {
+			continue
+		}
+		total.VCPU += pending.TierSpec.VCPU
+		total.MemoryGB += pending.TierSpec.MemoryGB
+		total.StorageGB += pending.TierSpec.StorageGB
+		total.GPU += pending.TierSpec.GPU
+		total.GPUMemoryGB += pending.TierSpec.GPUMemoryGB
+		total.addGPULoad(pending)
+		total.allocations++
+		if validUntil.IsZero() || pending.ExpiresAt.Before(validUntil) {
+			validUntil = pending.ExpiresAt
+		}
+	}
+	return total, validUntil
+}
+
+// reindexReservationsLocked refreshes a backend's indexed totals after its allocations changed
+// Caller must hold s.mu (write)
+func (s *Server) reindexReservationsLocked(clientID string) {
+	allocations := s.pendingAllocations[clientID]
+	if len(allocations) == 0 {
+		s.reservations.remove(clientID)
+		return
+	}
+	total, validUntil := reservationTotals(allocations, time.Now())
+	s.reservations.set(clientID, reservationEntry{total: total, validUntil: validUntil})
+}
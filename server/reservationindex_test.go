@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestReservationIndex_TracksAllocations verifies the index follows placements, releases and lease expiry
+func TestReservationIndex_TracksAllocations(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "a", TotalCPU: 4, CPUUsageAvg: []float64{5, 5, 5, 5}}))
+
+	tier := server.tierSpecs["pro-standard"]
+	server.addPendingAllocation("a", "s1", "pro-standard", tier, "req-1")
+	server.addPendingAllocation("a", "s2", "pro-standard", tier, "req-2")
+	if got := server.reservations.get("a", time.Now()).VCPU; got != 2*tier.VCPU {
+		t.Fatalf("Expected %d vCPU indexed, got %d", 2*tier.VCPU, got)
+	}
+
+	// A sticky ID placing again replaces its own allocation instead of adding one
+	server.addPendingAllocation("a", "s1", "pro-standard", tier, "req-3")
+	if got := server.reservations.get("a", time.Now()).VCPU; got != 2*tier.VCPU {
+		t.Errorf("Expected the replaced allocation not to be counted twice, got %d", got)
+	}
+
+	server.mu.Lock()
+	server.removeLeaseLocked("a", 0)
+	server.mu.Unlock()
+	if got := server.reservations.get("a", time.Now()).VCPU; got != tier.VCPU {
+		t.Errorf("Expected a released lease to leave %d vCPU, got %d", tier.VCPU, got)
+	}
+
+	// Once a lease in the entry has expired the totals over-count, so they are not used
+	if got := server.reservations.get("a", time.Now().Add(time.Hour)); got.VCPU != 0 {
+		t.Errorf("Expected no totals past the lease expiry, got %+v", got)
+	}
+}
+
+// TestRoutingSnapshot_SkipsReservedBackends verifies backends filled by pending allocations are filtered
+// before scoring, so placement falls through to the next backend without a live check on each
+func TestRoutingSnapshot_SkipsReservedBackends(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "a", TotalCPU: 2, CPUUsageAvg: []float64{5, 5}}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "b", TotalCPU: 2, CPUUsageAvg: []float64{50, 50}}))
+
+	tier := server.tierSpecs["pro-standard"]
+	for i := 0; i < 2/tier.VCPU; i++ {
+		server.addPendingAllocation("a", "", "pro-standard", tier, fmt.Sprintf("req-%d", i))
+	}
+
+	for _, backend := range server.routingSnapshot().backends {
+		fits := server.fitsSnapshot(backend, tier)
+		if id := backend.client.Registration.ClientID; fits != (id == "b") {
+			t.Errorf("Expected only b to fit after a's reservations, %s fits=%v", id, fits)
+		}
+	}
+	AssertClientSelected(t, server.findBestClient(tier, 0, 0), "b")
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// BackendResourceOverride reserves headroom on a backend and clamps the capacity its agent reports
+// Used for hosts running unmanaged workloads the agent can't attribute; zero values leave a resource untouched
+type BackendResourceOverride struct {
+	ClientID string `json:"client_id"`
+
+	// Headroom always kept free, subtracted from reported availability
+	ReservedVCPU        int     `json:"reserved_vcpu,omitempty"`
+	ReservedMemoryGB    float64 `json:"reserved_memory_gb,omitempty"`
+	ReservedStorageGB   float64 `json:"reserved_storage_gb,omitempty"`
+	ReservedGPUs        int     `json:"reserved_gpus,omitempty"`
+	ReservedGPUMemoryGB float64 `json:"reserved_gpu_memory_gb,omitempty"`
+
+	// Capacity ceilings: totals above these are treated as unavailable
+	MaxVCPU        int     `json:"max_vcpu,omitempty"`
+	MaxMemoryGB    float64 `json:"max_memory_gb,omitempty"`
+	MaxStorageGB   float64 `json:"max_storage_gb,omitempty"`
+	MaxGPUs        int     `json:"max_gpus,omitempty"`
+	MaxGPUMemoryGB float64 `json:"max_gpu_memory_gb,omitempty"`
+
+	Note      string    `json:"note,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// empty reports whether the override reserves or clamps nothing
+func (o BackendResourceOverride) empty() bool {
+	return o.ReservedVCPU == 0 && o.ReservedMemoryGB == 0 && o.ReservedStorageGB == 0 &&
+		o.ReservedGPUs == 0 && o.ReservedGPUMemoryGB == 0 &&
+		o.MaxVCPU == 0 && o.MaxMemoryGB == 0 && o.MaxStorageGB == 0 &&
+		o.MaxGPUs == 0 && o.MaxGPUMemoryGB == 0
+}
+
+func (o BackendResourceOverride) validate() error {
+	if o.ClientID == "" {
+		return fmt.Errorf("Missing required field: client_id")
+	}
+	if o.ReservedVCPU < 0 || o.ReservedMemoryGB < 0 || o.ReservedStorageGB < 0 ||
+		o.ReservedGPUs < 0 || o.ReservedGPUMemoryGB < 0 ||
+		o.MaxVCPU < 0 || o.MaxMemoryGB < 0 || o.MaxStorageGB < 0 ||
+		o.MaxGPUs < 0 || o.MaxGPUMemoryGB < 0 {
+		return fmt.Errorf("Reservations and capacity overrides must not be negative")
+	}
+	return nil
+}
+
+// backendHeadroom is what a backend can still host before pending allocations are subtracted
+type backendHeadroom struct {
+	VCPU        int     `json:"vcpu"`
+	MemoryGB    float64 `json:"memory_gb"`
+	StorageGB   float64 `json:"storage_gb"`
+	GPUs        int     `json:"gpus"`
+	GPUMemoryGB float64 `json:"gpu_memory_gb"`
+}
+
+// backendHeadroomLocked returns reported availability after admin capacity overrides and reservations
+// Must be called with s.mu held
+func (s *Server) backendHeadroomLocked(client *ClientState) backendHeadroom {
+	var h backendHeadroom
+
+	// Count free vCPUs under the server's core_threshold and cpu_headroom (tiers may count differently, see withTierCPU)
+	h.VCPU = s.cpuCapacityRule(common.TierSpec{}).availableVCPU(client.Stats)
+	h.MemoryGB = client.Stats.MemoryAvail
+	h.StorageGB = client.Stats.DiskAvail
+	h.GPUs = client.Registration.TotalGPUs
+	totalVRAM := 0.0
+	for _, gpu := range client.Stats.GPUs {
+		totalVRAM += gpu.MemoryTotalGB
+		h.GPUMemoryGB += gpu.MemoryTotalGB - gpu.MemoryUsedGB
+	}
+
+	override, ok := s.resourceOverrides[client.Registration.ClientID]
+	if !ok {
+		return h
+	}
+
+	// Capacity above a ceiling counts as used, so it comes out of what is available
+	if cores := len(client.Stats.CPUUsageAvg); override.MaxVCPU > 0 && cores > override.MaxVCPU {
+		h.VCPU -= cores - override.MaxVCPU
+	}
+	if override.MaxMemoryGB > 0 && client.Stats.MemoryTotal > override.MaxMemoryGB {
+		h.MemoryGB -= client.Stats.MemoryTotal - override.MaxMemoryGB
+	}
+	if override.MaxStorageGB > 0 && client.Stats.DiskTotal > override.MaxStorageGB {
+		h.StorageGB -= client.Stats.DiskTotal - override.MaxStorageGB
+	}
+	if override.MaxGPUs > 0 && h.GPUs > override.MaxGPUs {
+		h.GPUs = override.MaxGPUs
+	}
+	if override.MaxGPUMemoryGB > 0 && totalVRAM > override.MaxGPUMemoryGB {
+		h.GPUMemoryGB -= totalVRAM - override.MaxGPUMemoryGB
+	}
+
+	h.VCPU -= override.ReservedVCPU
+	h.MemoryGB -= override.ReservedMemoryGB
+	h.StorageGB -= override.ReservedStorageGB
+	h.GPUs -= override.ReservedGPUs
+	h.GPUMemoryGB -= override.ReservedGPUMemoryGB
+
+	return h
+}
+
+// loadResourceOverrides loads admin-set reservations and capacity overrides from the database
+func (s *Server) loadResourceOverrides() error {
+	rows, err := s.db.Query(`
+		SELECT client_id, reserved_vcpu, reserved_memory_gb, reserved_storage_gb, reserved_gpus, reserved_gpu_memory_gb,
+			max_vcpu, max_memory_gb, max_storage_gb, max_gpus, max_gpu_memory_gb, note, updated_at
+		FROM backend_resource_overrides
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.invalidateRoutingSnapshot()
+
+	for rows.Next() {
+		var o BackendResourceOverride
+		var note sql.NullString
+		if err := rows.Scan(&o.ClientID, &o.ReservedVCPU, &o.ReservedMemoryGB, &o.ReservedStorageGB,
+			&o.ReservedGPUs, &o.ReservedGPUMemoryGB, &o.MaxVCPU, &o.MaxMemoryGB, &o.MaxStorageGB,
+			&o.MaxGPUs, &o.MaxGPUMemoryGB, &note, &o.UpdatedAt); err != nil {
+			continue
+		}
+		o.Note = note.String
+		s.resourceOverrides[o.ClientID] = o
+	}
+
+	return rows.Err()
+}
+
+// handleReservations lists (GET), sets (PUT) or clears (DELETE ?client_id=) per-backend resource overrides
+func (s *Server) handleReservations(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleListReservations(w, r)
+	case http.MethodPut, http.MethodPost:
+		s.handleSetReservation(w, r)
+	case http.MethodDelete:
+		s.handleDeleteReservation(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// reservationStatus pairs an override with the headroom it currently leaves on the backend
+type reservationStatus struct {
+	BackendResourceOverride
+	Registered bool             `json:"registered"`
+	Headroom   *backendHeadroom `json:"headroom,omitempty"`
+}
+
+func (s *Server) handleListReservations(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	reservations := make([]reservationStatus, 0, len(s.resourceOverrides))
+	for id, override := range s.resourceOverrides {
+		status := reservationStatus{BackendResourceOverride: override}
+		if client, ok := s.clientCache[id]; ok {
+			headroom := s.backendHeadroomLocked(client)
+			status.Registered = true
+			status.Headroom = &headroom
+		}
+		reservations = append(reservations, status)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(reservations, func(i, j int) bool {
+		return reservations[i].ClientID < reservations[j].ClientID
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"reservations": reservations,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode reservations: %v", err)
+	}
+}
+
+// handleSetReservation replaces the override for a backend; an override with no values clears it
+func (s *Server) handleSetReservation(w http.ResponseWriter, r *http.Request) {
+	var req BackendResourceOverride
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.empty() {
+		s.clearReservation(w, req.ClientID)
+		return
+	}
+
+	req.UpdatedAt = time.Now().UTC()
+	_, err := s.db.Exec(`
+		INSERT OR REPLACE INTO backend_resource_overrides (
+			client_id, reserved_vcpu, reserved_memory_gb, reserved_storage_gb, reserved_gpus, reserved_gpu_memory_gb,
+			max_vcpu, max_memory_gb, max_storage_gb, max_gpus, max_gpu_memory_gb, note, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, req.ClientID, req.ReservedVCPU, req.ReservedMemoryGB, req.ReservedStorageGB, req.ReservedGPUs, req.ReservedGPUMemoryGB,
+		req.MaxVCPU, req.MaxMemoryGB, req.MaxStorageGB, req.MaxGPUs, req.MaxGPUMemoryGB, req.Note, req.UpdatedAt)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to persist reservation: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	s.invalidateRoutingSnapshot()
+	s.resourceOverrides[req.ClientID] = req
+	status := reservationStatus{BackendResourceOverride: req}
+	if client, ok := s.clientCache[req.ClientID]; ok {
+		headroom := s.backendHeadroomLocked(client)
+		status.Registered = true
+		status.Headroom = &headroom
+	}
+	s.mu.Unlock()
+
+	LogInfoWithData("Updated backend resource override", map[string]interface{}{
+		"client_id":          req.ClientID,
+		"reserved_vcpu":      req.ReservedVCPU,
+		"reserved_memory_gb": req.ReservedMemoryGB,
+		"max_vcpu":           req.MaxVCPU,
+		"max_memory_gb":      req.MaxMemoryGB,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Printf("Warning: Failed to encode reservation response: %v", err)
+	}
+}
+
+func (s *Server) handleDeleteReservation(w http.ResponseWriter, r *http.Request) {
+	clientID := r.URL.Query().Get("client_id")
+	if clientID == "" {
+		http.Error(w, "Missing required parameter: client_id", http.StatusBadRequest)
+		return
+	}
+	s.clearReservation(w, clientID)
+}
+
+// clearReservation removes a backend's override so its reported resources apply unchanged
+func (s *Server) clearReservation(w http.ResponseWriter, clientID string) {
+	if _, err := s.db.Exec("DELETE FROM backend_resource_overrides WHERE client_id = ?", clientID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to clear reservation: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	s.invalidateRoutingSnapshot()
+	delete(s.resourceOverrides, clientID)
+	s.mu.Unlock()
+
+	LogInfoWithData("Cleared backend resource override", map[string]interface{}{
+		"client_id": clientID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "cleared",
+		"client_id": clientID,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode reservation response: %v", err)
+	}
+}
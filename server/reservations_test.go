@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestHandleReservations verifies reservations and capacity overrides are persisted and applied to placement
+func TestHandleReservations(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	// 8 idle cores, 32GB total with 24GB available
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-1"}))
+	client := server.clientCache["backend-1"]
+	tier := common.TierSpec{Name: "custom", VCPU: 4, MemoryGB: 8}
+
+	put := func(override BackendResourceOverride) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(override)
+		rec := httptest.NewRecorder()
+		server.handleReservations(rec, httptest.NewRequest("PUT", "/reservations", bytes.NewReader(body)))
+		return rec
+	}
+
+	if rec := put(BackendResourceOverride{ClientID: "backend-1", ReservedVCPU: 4, ReservedMemoryGB: 8}); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !server.hasResources(client, tier) {
+		t.Error("Expected 4 cores / 8GB to fit after reserving 4 cores / 8GB")
+	}
+	if server.hasResources(client, common.TierSpec{Name: "big", VCPU: 5}) {
+		t.Error("Expected reserved cores to be unavailable")
+	}
+
+	// Clamp memory to 16GB: 24GB available - 16GB above the ceiling - 8GB reserved leaves nothing
+	put(BackendResourceOverride{ClientID: "backend-1", ReservedMemoryGB: 8, MaxMemoryGB: 16})
+	if server.hasResources(client, tier) {
+		t.Error("Expected memory ceiling and reservation to leave no room")
+	}
+
+	if rec := put(BackendResourceOverride{ClientID: "backend-1", ReservedVCPU: -1}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a negative reservation, got %d", rec.Code)
+	}
+
+	// Overrides survive restart
+	restarted := NewTestServer(t, db)
+	if err := restarted.loadResourceOverrides(); err != nil {
+		t.Fatalf("Failed to load resource overrides: %v", err)
+	}
+	if override := restarted.resourceOverrides["backend-1"]; override.MaxMemoryGB != 16 || override.ReservedMemoryGB != 8 {
+		t.Errorf("Expected persisted override, got %+v", override)
+	}
+
+	rec := httptest.NewRecorder()
+	server.handleReservations(rec, httptest.NewRequest("GET", "/reservations", nil))
+	var list struct {
+		Reservations []reservationStatus `json:"reservations"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode reservations: %v", err)
+	}
+	if len(list.Reservations) != 1 || list.Reservations[0].Headroom == nil || list.Reservations[0].Headroom.MemoryGB != 0 {
+		t.Errorf("Expected one reservation with 0GB memory headroom, got %+v", list.Reservations)
+	}
+
+	rec = httptest.NewRecorder()
+	server.handleReservations(rec, httptest.NewRequest("DELETE", "/reservations?client_id=backend-1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 on delete, got %d", rec.Code)
+	}
+	if !server.hasResources(client, tier) {
+		t.Error("Expected reported resources to apply after clearing the override")
+	}
+}
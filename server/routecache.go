@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// routeCacheMaxEntries bounds the cache; expired entries are swept when it fills up
+const routeCacheMaxEntries = 4096
+
+type routeCacheEntry struct {
+	clientID string
+	expires  time.Time
+}
+
+// RouteCache remembers the backend picked for anonymous proxy requests for a short TTL
+// Bursts of identical requests (same tenant, tier, rule and coarse location) skip the scoring loop;
+// a cached pick is still re-checked for liveness, health, capacity and admission before it is used
+type RouteCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]routeCacheEntry
+}
+
+// NewRouteCache creates a cache with the given TTL, or returns nil if ttlMs is 0 (disabled)
+func NewRouteCache(ttlMs int) *RouteCache {
+	if ttlMs <= 0 {
+		return nil
+	}
+	return &RouteCache{
+		ttl:     time.Duration(ttlMs) * time.Millisecond,
+		entries: make(map[string]routeCacheEntry),
+	}
+}
+
+// routeCacheKey identifies requests that would be scored identically
+// Locations are rounded to whole degrees (roughly 100 km), well below what changes a placement
+func routeCacheKey(tierSpec common.TierSpec, tierVersion string, rule *routingRule, clientLat, clientLon float64) string {
+	ruleName := ""
+	if rule != nil {
+		ruleName = rule.Name
+	}
+	return fmt.Sprintf("%s|%s|%s|%s|%d|%s|%s|%s|%.0f,%.0f", normalizeTenant(tierSpec.Tenant), tierSpec.Name, tierVersion,
+		ruleName, tierSpec.ClientASN, tierSpec.ServiceVersion, tierSpec.PreferServiceVersion, tierSpec.VantageRegion,
+		math.Round(clientLat), math.Round(clientLon))
+}
+
+// Get returns the cached backend for key, if it hasn't expired
+func (c *RouteCache) Get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return "", false
+	}
+	return entry.clientID, true
+}
+
+// Put caches the backend selected for key
+func (c *RouteCache) Put(key, clientID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= routeCacheMaxEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= routeCacheMaxEntries {
+			return
+		}
+	}
+	c.entries[key] = routeCacheEntry{clientID: clientID, expires: now.Add(c.ttl)}
+}
+
+// Invalidate drops every entry pointing at clientID (called on stats, health and membership changes)
+// Safe to call with s.mu held; the cache never takes the server lock
+func (c *RouteCache) Invalidate(clientID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, entry := range c.entries {
+		if entry.clientID == clientID {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// cachedRouteClient returns the cached backend for key if it can still take the request
+// Outlier re-admission ramps and half-open circuit trials apply as they do to a scored pick,
+// so a cached entry never sends a backend more than its share
+func (s *Server) cachedRouteClient(key string, tierSpec common.TierSpec) *ClientState {
+	clientID, ok := s.routeCache.Get(key)
+	if !ok {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	client, exists := s.clientCache[clientID]
+	if !exists || s.isStale(client) ||
+		(s.config.HealthCheckEnabled && client.HealthStatus == "unhealthy") ||
+		!s.hasResourcesLocked(client, tierSpec) {
+		return nil
+	}
+	if !s.outliers.Admit(clientID) || !s.breakers.Admit(clientID) {
+		return nil
+	}
+	return client
+}
+
+// selectAnonymousClient picks a backend for a proxy request without a sticky ID, using the route cache
+func (s *Server) selectAnonymousClient(key, tier string, tierSpec common.TierSpec, clientLat, clientLon float64, requestID string) *ClientState {
+	if client := s.cachedRouteClient(key, tierSpec); client != nil {
+		if !s.admitPendingAllocation(client.Registration.ClientID, "", tier, tierSpec, requestID) {
+			return nil
+		}
+		return client
+	}
+
+	client := s.selectClientWithStickiness("", tier, tierSpec, clientLat, clientLon, requestID)
+	if client != nil {
+		s.routeCache.Put(key, client.Registration.ClientID)
+	}
+	return client
+}
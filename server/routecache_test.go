@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestRouteCache_ReusesPickUntilInvalidated verifies identical anonymous requests skip scoring until the backend changes
+func TestRouteCache_ReusesPickUntilInvalidated(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.RouteCacheTTLMs = 60000
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-a", CPUUsageAvg: []float64{10, 10, 10, 10}}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-b", CPUUsageAvg: []float64{50, 50, 50, 50}}))
+
+	tierSpec := server.tierSpecs["lite"]
+	key := routeCacheKey(tierSpec, server.tierVersion, nil, 40.2, -3.7)
+	if client := server.selectAnonymousClient(key, "lite", tierSpec, 40.2, -3.7, "req-1"); client == nil || client.Registration.ClientID != "backend-a" {
+		t.Fatalf("Expected backend-a to be selected, got %v", client)
+	}
+
+	// backend-b becomes the better choice without a report from backend-a: the cached pick is reused
+	server.mu.Lock()
+	server.clientCache["backend-b"].Stats.CPUUsageAvg = []float64{1, 1, 1, 1}
+	server.clientCache["backend-a"].Stats.CPUUsageAvg = []float64{60, 60, 60, 60}
+	server.mu.Unlock()
+	server.invalidateRoutingSnapshot()
+
+	nearby := routeCacheKey(tierSpec, server.tierVersion, nil, 40.4, -3.6)
+	if nearby != key {
+		t.Fatalf("Expected nearby locations to share a cache key: %s vs %s", key, nearby)
+	}
+	if client := server.selectAnonymousClient(nearby, "lite", tierSpec, 40.4, -3.6, "req-2"); client.Registration.ClientID != "backend-a" {
+		t.Errorf("Expected the cached backend-a, got %s", client.Registration.ClientID)
+	}
+
+	// Stats, health and membership changes for the cached backend force a rescore
+	server.routeCache.Invalidate("backend-a")
+	if client := server.selectAnonymousClient(key, "lite", tierSpec, 40.2, -3.7, "req-3"); client.Registration.ClientID != "backend-b" {
+		t.Errorf("Expected rescoring to pick backend-b after invalidation, got %s", client.Registration.ClientID)
+	}
+}
+
+// TestRouteCache_SkipsUnavailableBackend verifies a cached backend is not reused once it becomes unhealthy
+func TestRouteCache_SkipsUnavailableBackend(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.RouteCacheTTLMs = 60000
+		c.HealthCheckEnabled = true
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-a"}))
+	server.routeCache.Put("key", "backend-a")
+
+	server.mu.Lock()
+	server.clientCache["backend-a"].HealthStatus = "unhealthy"
+	server.mu.Unlock()
+
+	if client := server.cachedRouteClient("key", server.tierSpecs["lite"]); client != nil {
+		t.Errorf("Expected an unhealthy cached backend to be skipped, got %s", client.Registration.ClientID)
+	}
+
+	var disabled *RouteCache
+	disabled.Put("key", "backend-a")
+	if _, ok := disabled.Get("key"); ok {
+		t.Error("Expected a nil cache to never hit")
+	}
+}
+
+// TestRouteCache_SkipsOpenCircuit verifies a cached pick goes through circuit breaker admission like a scored one
+func TestRouteCache_SkipsOpenCircuit(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.RouteCacheTTLMs = 60000
+		c.CircuitBreaker = common.CircuitBreakerConfig{Enabled: true, MaxFailures: 1, OpenSecs: 10}
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-a"}))
+	server.routeCache.Put("key", "backend-a")
+
+	server.breakers.Record("backend-a", true)
+	if client := server.cachedRouteClient("key", server.tierSpecs["lite"]); client != nil {
+		t.Errorf("Expected a cached backend with an open circuit to be skipped, got %s", client.Registration.ClientID)
+	}
+}
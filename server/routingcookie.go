@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+const (
+	routingCookieVersion    = "v1"
+	defaultRoutingCookieTTL = time.Hour
+)
+
+// routingCookie is the signed placement carried by a client: backend, tier, tenant and expiry
+type routingCookie struct {
+	ClientID string `json:"c"`
+	Tier     string `json:"t"`
+	Tenant   string `json:"n,omitempty"`
+	Expires  int64  `json:"e"`
+}
+
+// validateRoutingCookie checks routing_cookie; tokens must verify on every instance and after restarts,
+// so a stable secret is required
+func validateRoutingCookie(config *common.ServerConfig) error {
+	cookie := config.RoutingCookie
+	if !cookie.Enabled {
+		return nil
+	}
+	if cookie.Secret == "" && config.ServerKey == "" {
+		return fmt.Errorf("routing_cookie: secret is required when server_key is not set")
+	}
+	if cookie.TTLSecs < 0 {
+		return fmt.Errorf("routing_cookie: ttl_seconds must be >= 0")
+	}
+	return nil
+}
+
+func (s *Server) routingCookieSecret() []byte {
+	if s.config.RoutingCookie.Secret != "" {
+		return []byte(s.config.RoutingCookie.Secret)
+	}
+	return []byte(s.config.ServerKey)
+}
+
+func (s *Server) routingCookieTTL() time.Duration {
+	if s.config.RoutingCookie.TTLSecs > 0 {
+		return time.Duration(s.config.RoutingCookie.TTLSecs) * time.Second
+	}
+	return defaultRoutingCookieTTL
+}
+
+// routingCookieName returns the cookie holding a tier's placement; characters not allowed in cookie names
+// are replaced so every tier name maps to a valid one
+func (s *Server) routingCookieName(tier string) string {
+	prefix := s.config.RoutingCookie.Name
+	if prefix == "" {
+		prefix = "opsen_route"
+	}
+	return prefix + "_" + strings.Map(func(r rune) rune {
+		if r < 0x80 && (r == '-' || r == '.' || r == '_' ||
+			('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')) {
+			return r
+		}
+		return '_'
+	}, tier)
+}
+
+// signRoutingCookie encodes a placement as "v1.<payload>.<hmac>"
+func (s *Server) signRoutingCookie(cookie routingCookie) string {
+	payload, _ := json.Marshal(cookie)
+	encoded := routingCookieVersion + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, s.routingCookieSecret())
+	mac.Write([]byte(encoded))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseRoutingCookie verifies a token's signature and expiry
+func (s *Server) parseRoutingCookie(token string, now time.Time) (routingCookie, bool) {
+	cut := strings.LastIndexByte(token, '.')
+	if cut < 0 || !strings.HasPrefix(token, routingCookieVersion+".") {
+		return routingCookie{}, false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(token[cut+1:])
+	if err != nil {
+		return routingCookie{}, false
+	}
+	mac := hmac.New(sha256.New, s.routingCookieSecret())
+	mac.Write([]byte(token[:cut]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return routingCookie{}, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(token[len(routingCookieVersion)+1 : cut])
+	if err != nil {
+		return routingCookie{}, false
+	}
+	var cookie routingCookie
+	if err := json.Unmarshal(payload, &cookie); err != nil || now.Unix() >= cookie.Expires {
+		return routingCookie{}, false
+	}
+	return cookie, true
+}
+
+// routingCookieClient returns the backend named by a request's valid routing token for tier, if that
+// backend is still routable (live, healthy, approved), not ejected and admitted by its circuit breaker.
+// Only in-memory state is consulted
+func (s *Server) routingCookieClient(r *http.Request, tier string, tierSpec common.TierSpec) (*ClientState, routingCookie) {
+	if !s.config.RoutingCookie.Enabled {
+		return nil, routingCookie{}
+	}
+
+	token := ""
+	if header := s.config.RoutingCookie.Header; header != "" {
+		token = r.Header.Get(header)
+	}
+	if token == "" {
+		if c, err := r.Cookie(s.routingCookieName(tier)); err == nil {
+			token = c.Value
+		}
+	}
+	if token == "" {
+		return nil, routingCookie{}
+	}
+
+	cookie, ok := s.parseRoutingCookie(token, time.Now())
+	if !ok || cookie.Tier != tier || normalizeTenant(cookie.Tenant) != tierSpec.Tenant {
+		return nil, routingCookie{}
+	}
+
+	// Stats and health checks update the backend under s.mu; a half-open circuit only takes its trial share
+	s.mu.RLock()
+	client, exists := s.clientCache[cookie.ClientID]
+	available := exists && s.routable(client) && normalizeTenant(client.Registration.Tenant) == tierSpec.Tenant
+	s.mu.RUnlock()
+	if !available || s.outliers.Ejected(cookie.ClientID) || !s.breakers.Admit(cookie.ClientID) {
+		LogDebugWithData("Routing cookie backend unavailable, placing again", map[string]interface{}{
+			"tier":      tier,
+			"client_id": cookie.ClientID,
+		})
+		return nil, routingCookie{}
+	}
+	return client, cookie
+}
+
+// setRoutingCookie issues a token for the backend a request was placed on. A token that still names this
+// backend is only renewed once half its lifetime has passed
+func (s *Server) setRoutingCookie(w http.ResponseWriter, r *http.Request, tier string, tierSpec common.TierSpec,
+	client *ClientState, current routingCookie) {
+	if !s.config.RoutingCookie.Enabled {
+		return
+	}
+
+	now := time.Now()
+	ttl := s.routingCookieTTL()
+	if current.ClientID == client.Registration.ClientID && time.Unix(current.Expires, 0).Sub(now) > ttl/2 {
+		return
+	}
+
+	token := s.signRoutingCookie(routingCookie{
+		ClientID: client.Registration.ClientID,
+		Tier:     tier,
+		Tenant:   tierSpec.Tenant,
+		Expires:  now.Add(ttl).Unix(),
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.routingCookieName(tier),
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   s.config.RoutingCookie.Secure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	if header := s.config.RoutingCookie.Header; header != "" {
+		w.Header().Set(header, token)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// newRoutingCookieServer returns a proxying server with backends "a" (idle) and "b" (busy) answering with their ID
+func newRoutingCookieServer(t *testing.T) *Server {
+	t.Helper()
+	db, cleanup := CreateTestDB(t)
+	t.Cleanup(cleanup)
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.RoutingCookie = common.RoutingCookieConfig{Enabled: true, Secret: "cookie-secret", Name: "opsen_route"}
+	})
+	server.proxyEndpoints = []string{"/"}
+	for id, load := range map[string]float64{"a": 5, "b": 40} {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, id)
+		}))
+		t.Cleanup(backend.Close)
+		server.AddMockClient(NewMockClient(MockClientOptions{
+			ClientID:    id,
+			Endpoint:    backend.URL,
+			CPUUsageAvg: []float64{load, load, load, load, load, load, load, load},
+		}))
+	}
+	return server
+}
+
+// proxyWithCookies sends GET /app through the proxy with the given cookies
+func proxyWithCookies(server *Server, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/app?tier=lite", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	server.handleProxy(rec, req)
+	return rec
+}
+
+// routingCookieFrom returns the routing cookie set on a response, or nil
+func routingCookieFrom(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "opsen_route_lite" {
+			return c
+		}
+	}
+	return nil
+}
+
+// TestRoutingCookie_ReturnsToBackend verifies a cookie keeps requests on their backend, also on a fresh server
+func TestRoutingCookie_ReturnsToBackend(t *testing.T) {
+	server := newRoutingCookieServer(t)
+
+	rec := proxyWithCookies(server)
+	if rec.Body.String() != "a" {
+		t.Fatalf("Expected the first request on a, got %q (%d)", rec.Body.String(), rec.Code)
+	}
+	cookie := routingCookieFrom(rec)
+	if cookie == nil || !cookie.HttpOnly {
+		t.Fatalf("Expected an HttpOnly routing cookie, got %+v", cookie)
+	}
+
+	// a is now the worse pick, but the cookie still wins and is not reissued while fresh
+	server.mu.Lock()
+	server.clientCache["a"].Stats.CPUUsageAvg = []float64{60, 60, 60, 60, 60, 60, 60, 60}
+	server.invalidateRoutingSnapshot()
+	server.mu.Unlock()
+	rec = proxyWithCookies(server, cookie)
+	if rec.Body.String() != "a" {
+		t.Errorf("Expected the cookie to route back to a, got %q", rec.Body.String())
+	}
+	if routingCookieFrom(rec) != nil {
+		t.Error("Expected a fresh cookie not to be reissued")
+	}
+
+	// A restarted load balancer has no sticky state, only the same secret
+	restarted := newRoutingCookieServer(t)
+	restarted.mu.Lock()
+	restarted.clientCache["a"].Stats.CPUUsageAvg = []float64{60, 60, 60, 60, 60, 60, 60, 60}
+	restarted.invalidateRoutingSnapshot()
+	restarted.mu.Unlock()
+	if rec := proxyWithCookies(restarted, cookie); rec.Body.String() != "a" {
+		t.Errorf("Expected the cookie to be honored after a restart, got %q", rec.Body.String())
+	}
+
+	// An unhealthy backend is left and the cookie replaced
+	server.mu.Lock()
+	server.clientCache["a"].HealthStatus = "unhealthy"
+	server.invalidateRoutingSnapshot()
+	server.mu.Unlock()
+	rec = proxyWithCookies(server, cookie)
+	if rec.Body.String() != "b" {
+		t.Errorf("Expected an unhealthy backend to be skipped, got %q", rec.Body.String())
+	}
+	if replaced := routingCookieFrom(rec); replaced == nil || replaced.Value == cookie.Value {
+		t.Error("Expected a new cookie naming b")
+	}
+}
+
+// TestRoutingCookie_Verification verifies tampered, expired and foreign-secret tokens are rejected
+func TestRoutingCookie_Verification(t *testing.T) {
+	server := newRoutingCookieServer(t)
+	now := time.Now()
+	token := server.signRoutingCookie(routingCookie{ClientID: "a", Tier: "lite", Expires: now.Add(time.Minute).Unix()})
+
+	if cookie, ok := server.parseRoutingCookie(token, now); !ok || cookie.ClientID != "a" {
+		t.Fatalf("Expected a valid token, got %+v %v", cookie, ok)
+	}
+	if _, ok := server.parseRoutingCookie(token, now.Add(2*time.Minute)); ok {
+		t.Error("Expected an expired token to be rejected")
+	}
+	forged := server.signRoutingCookie(routingCookie{ClientID: "b", Tier: "lite", Expires: now.Add(time.Minute).Unix()})
+	if _, ok := server.parseRoutingCookie(forged[:len(forged)-43]+token[len(token)-43:], now); ok {
+		t.Error("Expected a token with another payload's signature to be rejected")
+	}
+
+	server.config.RoutingCookie.Secret = "rotated"
+	if _, ok := server.parseRoutingCookie(token, now); ok {
+		t.Error("Expected a token signed with another secret to be rejected")
+	}
+}
+
+// TestRoutingCookie_RespectsApprovalAndBreaker verifies a cookie doesn't route to a held backend or past a half-open trial
+func TestRoutingCookie_RespectsApprovalAndBreaker(t *testing.T) {
+	server := newRoutingCookieServer(t)
+	cookie := routingCookieFrom(proxyWithCookies(server))
+	if cookie == nil {
+		t.Fatal("Expected a routing cookie")
+	}
+
+	// The only half-open trial is already taken
+	now := time.Now()
+	server.breakers = NewCircuitBreakers(common.CircuitBreakerConfig{Enabled: true, MaxFailures: 1, OpenSecs: 10, HalfOpenRequests: 1})
+	server.breakers.now = func() time.Time { return now }
+	server.breakers.Record("a", true)
+	now = now.Add(11 * time.Second)
+	server.breakers.Admit("a")
+	if rec := proxyWithCookies(server, cookie); rec.Body.String() != "b" {
+		t.Errorf("Expected a half-open backend not to take all cookie traffic, got %q", rec.Body.String())
+	}
+
+	server.breakers = nil
+	server.mu.Lock()
+	server.config.RegistrationApproval.Enabled = true
+	server.clientCache["a"].PendingApproval = true
+	server.invalidateRoutingSnapshot()
+	server.mu.Unlock()
+	if rec := proxyWithCookies(server, cookie); rec.Body.String() != "b" {
+		t.Errorf("Expected a backend awaiting approval to be skipped, got %q", rec.Body.String())
+	}
+}
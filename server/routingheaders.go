@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// Routing metadata headers on proxied responses (routing_headers: true)
+const (
+	LBScoreHeader        = "X-LB-Score"          // Placement score of the selected backend (lower is better)
+	LBDistanceHeader     = "X-LB-Distance-Km"    // Distance between the client and the backend (0 when unknown)
+	LBPendingAllocHeader = "X-LB-Pending-Allocs" // Pending allocations on the backend, including this request's
+	LBTierHeader         = "X-LB-Tier"           // Tier the request was placed with
+	LBRuleHeader         = "X-LB-Rule"           // Routing rule that matched the request (routing_rules)
+)
+
+// setRoutingHeaders adds placement metadata to a proxied response so clients can debug placement
+// without correlating server logs
+func (s *Server) setRoutingHeaders(w http.ResponseWriter, client *ClientState, tier common.TierSpec, clientLat, clientLon float64) {
+	if !s.config.RoutingHeaders {
+		return
+	}
+
+	distance := backendDistance(client, clientLat, clientLon)
+
+	s.mu.RLock()
+	score := s.placementScore(client, tier, distance) + s.warmupPenalty(s.warmupProgress(client, time.Now()))
+	pending := s.liveAllocationCountLocked(client.Registration.ClientID, time.Now())
+	s.mu.RUnlock()
+
+	h := w.Header()
+	h.Set(LBScoreHeader, strconv.FormatFloat(score, 'f', 1, 64))
+	h.Set(LBDistanceHeader, strconv.FormatFloat(distance, 'f', 0, 64))
+	h.Set(LBPendingAllocHeader, strconv.Itoa(pending))
+	h.Set(LBTierHeader, tier.Name)
+	if version := client.Registration.ServiceVersion; version != "" {
+		h.Set(LBServiceVersionHeader, version)
+	}
+}
+
+// setRuleHeader names the routing rule that matched, including on denied requests
+func (s *Server) setRuleHeader(w http.ResponseWriter, rule *routingRule) {
+	if rule != nil && s.config.RoutingHeaders {
+		w.Header().Set(LBRuleHeader, rule.Name)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestProxy_RoutingHeaders verifies proxied responses carry placement metadata unless disabled
+func TestProxy_RoutingHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	for _, enabled := range []bool{true, false} {
+		db, cleanup := CreateTestDB(t)
+		server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+			c.RoutingHeaders = enabled
+		})
+		server.proxyEndpoints = []string{"/api"}
+		server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-1", Endpoint: backend.URL}))
+
+		req := httptest.NewRequest("GET", "/api/users", nil)
+		req.Header.Set("X-Tier", "pro-standard")
+		rec := httptest.NewRecorder()
+		server.handleProxy(rec, req)
+		cleanup()
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		if !enabled {
+			if rec.Header().Get(LBScoreHeader) != "" || rec.Header().Get(LBTierHeader) != "" {
+				t.Errorf("Expected no routing headers when disabled, got %v", rec.Header())
+			}
+			continue
+		}
+
+		if got := rec.Header().Get(LBTierHeader); got != "pro-standard" {
+			t.Errorf("Expected %s pro-standard, got %q", LBTierHeader, got)
+		}
+		if got := rec.Header().Get(LBPendingAllocHeader); got != "1" {
+			t.Errorf("Expected this request's pending allocation to be counted, got %q", got)
+		}
+		if _, err := strconv.ParseFloat(rec.Header().Get(LBScoreHeader), 64); err != nil {
+			t.Errorf("Expected numeric %s, got %q", LBScoreHeader, rec.Header().Get(LBScoreHeader))
+		}
+		if got := rec.Header().Get(LBDistanceHeader); got != "0" {
+			t.Errorf("Expected distance 0 without geolocation, got %q", got)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// cronWindow is a parsed "minute hour day-of-month month day-of-week" expression
+// Each field is a bit set of the values it matches
+type cronWindow struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool // The field was "*", so only the other day field restricts days
+}
+
+// cronFieldRanges are the allowed values of each field; day-of-week also accepts 7 for Sunday
+var cronFieldRanges = [5]struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day-of-month", 1, 31},
+	{"month", 1, 12},
+	{"day-of-week", 0, 7},
+}
+
+// parseCronWindow parses a five-field cron expression; each field is "*", a value, a range "a-b"
+// or a comma-separated list of those, each optionally with a step ("*/15", "8-18/2")
+func parseCronWindow(expr string) (cronWindow, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return cronWindow{}, fmt.Errorf("window %q: expected 5 fields (minute hour day-of-month month day-of-week), got %d", expr, len(fields))
+	}
+
+	var sets [5]uint64
+	for i, field := range fields {
+		bits, err := parseCronField(field, cronFieldRanges[i].min, cronFieldRanges[i].max)
+		if err != nil {
+			return cronWindow{}, fmt.Errorf("window %q: %s: %w", expr, cronFieldRanges[i].name, err)
+		}
+		sets[i] = bits
+	}
+	// Sunday is both 0 and 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return cronWindow{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField turns one field into the bit set of values it matches
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+
+		low, high := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			from, to, _ := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = cronValue(from, min, max); err != nil {
+				return 0, err
+			}
+			if high, err = cronValue(to, min, max); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			value, err := cronValue(rangePart, min, max)
+			if err != nil {
+				return 0, err
+			}
+			low = value
+			if !hasStep {
+				high = value
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// cronValue parses a field value within its allowed range
+func cronValue(s string, min, max int) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("invalid value %q (expected %d-%d)", s, min, max)
+	}
+	return v, nil
+}
+
+// matches reports whether the minute containing t is in the window
+// As in cron, when both day fields are restricted a day matching either one qualifies
+func (w cronWindow) matches(t time.Time) bool {
+	if w.minute&(1<<uint(t.Minute())) == 0 || w.hour&(1<<uint(t.Hour())) == 0 || w.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domMatch := w.dom&(1<<uint(t.Day())) != 0
+	dowMatch := w.dow&(1<<uint(t.Weekday())) != 0
+	if w.domAny || w.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// routingSchedule is a validated schedule with its windows parsed and zone loaded
+type routingSchedule struct {
+	config    common.RoutingScheduleConfig
+	location  *time.Location
+	windows   []cronWindow
+	clientIDs map[string]bool
+	pools     map[string]bool
+}
+
+// RoutingSchedules adjusts backend scores by time window (routing_schedules)
+type RoutingSchedules struct {
+	schedules []routingSchedule
+}
+
+// validateRoutingSchedules checks each schedule names its backends, a known zone, valid windows and a penalty
+func validateRoutingSchedules(configs []common.RoutingScheduleConfig) error {
+	_, err := compileRoutingSchedules(configs)
+	return err
+}
+
+// compileRoutingSchedules parses windows and loads time zones, failing on the first invalid schedule
+func compileRoutingSchedules(configs []common.RoutingScheduleConfig) ([]routingSchedule, error) {
+	names := make(map[string]bool, len(configs))
+	schedules := make([]routingSchedule, 0, len(configs))
+	for i, config := range configs {
+		if config.Name == "" {
+			return nil, fmt.Errorf("routing_schedules[%d]: name is required", i)
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("routing_schedules: duplicate name %q", config.Name)
+		}
+		names[config.Name] = true
+		if len(config.ClientIDs) == 0 && len(config.Pools) == 0 {
+			return nil, fmt.Errorf("routing_schedules %s: set client_ids or pools", config.Name)
+		}
+		if len(config.Windows) == 0 {
+			return nil, fmt.Errorf("routing_schedules %s: windows is required", config.Name)
+		}
+		if config.ScorePenalty == 0 {
+			return nil, fmt.Errorf("routing_schedules %s: score_penalty is required", config.Name)
+		}
+
+		schedule := routingSchedule{
+			config:    config,
+			location:  time.UTC,
+			clientIDs: make(map[string]bool, len(config.ClientIDs)),
+			pools:     make(map[string]bool, len(config.Pools)),
+		}
+		if config.Timezone != "" {
+			location, err := time.LoadLocation(config.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("routing_schedules %s: unknown timezone %q", config.Name, config.Timezone)
+			}
+			schedule.location = location
+		}
+		for _, expr := range config.Windows {
+			window, err := parseCronWindow(expr)
+			if err != nil {
+				return nil, fmt.Errorf("routing_schedules %s: %w", config.Name, err)
+			}
+			schedule.windows = append(schedule.windows, window)
+		}
+		for _, id := range config.ClientIDs {
+			schedule.clientIDs[id] = true
+		}
+		for _, pool := range config.Pools {
+			schedule.pools[pool] = true
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
+
+// NewRoutingSchedules builds the schedules (nil if none are configured; configs must be validated)
+func NewRoutingSchedules(configs []common.RoutingScheduleConfig) *RoutingSchedules {
+	schedules, err := compileRoutingSchedules(configs)
+	if err != nil || len(schedules) == 0 {
+		return nil
+	}
+	return &RoutingSchedules{schedules: schedules}
+}
+
+// appliesTo reports whether the schedule covers a backend
+func (rs *routingSchedule) appliesTo(client *ClientState) bool {
+	return rs.clientIDs[client.Registration.ClientID] ||
+		(client.Registration.Pool != "" && rs.pools[client.Registration.Pool])
+}
+
+// active reports whether now falls in one of the schedule's windows, in its time zone
+func (rs *routingSchedule) active(now time.Time) bool {
+	local := now.In(rs.location)
+	for _, window := range rs.windows {
+		if window.matches(local) {
+			return true
+		}
+	}
+	return false
+}
+
+// Penalty sums the score_penalty of the schedules active for a backend now
+func (r *RoutingSchedules) Penalty(client *ClientState, now time.Time) float64 {
+	if r == nil {
+		return 0
+	}
+	penalty := 0.0
+	for i := range r.schedules {
+		if schedule := &r.schedules[i]; schedule.appliesTo(client) && schedule.active(now) {
+			penalty += schedule.config.ScorePenalty
+		}
+	}
+	return penalty
+}
+
+// Active lists the names of the schedules adjusting a backend's score now
+func (r *RoutingSchedules) Active(client *ClientState, now time.Time) []string {
+	if r == nil {
+		return nil
+	}
+	var names []string
+	for i := range r.schedules {
+		if schedule := &r.schedules[i]; schedule.appliesTo(client) && schedule.active(now) {
+			names = append(names, schedule.config.Name)
+		}
+	}
+	return names
+}
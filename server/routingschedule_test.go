@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestCronWindow_Matches verifies ranges, lists, steps, Sunday as 7 and cron's either-day rule
+func TestCronWindow_Matches(t *testing.T) {
+	// 2026-03-02 is a Monday
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 3, day, hour, minute, 0, 0, time.UTC) }
+
+	for _, tt := range []struct {
+		expr string
+		at   time.Time
+		want bool
+	}{
+		{"* 9-17 * * 1-5", at(2, 9, 0), true},
+		{"* 9-17 * * 1-5", at(2, 17, 59), true},
+		{"* 9-17 * * 1-5", at(2, 18, 0), false},
+		{"* 9-17 * * 1-5", at(7, 12, 0), false}, // Saturday
+		{"0,30 */6 * * *", at(3, 12, 30), true},
+		{"0,30 */6 * * *", at(3, 13, 30), false},
+		{"10-50/20 * * * *", at(3, 4, 30), true},
+		{"10-50/20 * * * *", at(3, 4, 40), false},
+		{"* * * * 7", at(8, 3, 0), true}, // Sunday
+		{"* * 1 * 1", at(2, 3, 0), true}, // A Monday that isn't the 1st
+		{"* * 1 * 1", at(3, 3, 0), false},
+		{"* * * 4 *", at(3, 3, 0), false},
+	} {
+		window, err := parseCronWindow(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+		if got := window.matches(tt.at); got != tt.want {
+			t.Errorf("%s at %s: expected %v, got %v", tt.expr, tt.at.Format(time.RFC1123), tt.want, got)
+		}
+	}
+
+	for _, expr := range []string{"* * * *", "60 * * * *", "* 5-2 * * *", "*/0 * * * *", "* * 0 * *", "mon * * * *"} {
+		if _, err := parseCronWindow(expr); err == nil {
+			t.Errorf("%s: expected an error", expr)
+		}
+	}
+}
+
+// TestRoutingSchedules_PenaltyInTimezone verifies windows are read in the schedule's zone and only cover its backends
+func TestRoutingSchedules_PenaltyInTimezone(t *testing.T) {
+	schedules := NewRoutingSchedules([]common.RoutingScheduleConfig{
+		{Name: "office-hours", Pools: []string{"office"}, Windows: []string{"* 9-17 * * 1-5"}, Timezone: "Europe/Berlin", ScorePenalty: 500},
+		{Name: "gpu-01-morning", ClientIDs: []string{"gpu-01"}, Windows: []string{"* 9 * * *"}, ScorePenalty: -50},
+	})
+	office := NewMockClient(MockClientOptions{ClientID: "gpu-01"})
+	office.Registration.Pool = "office"
+	other := NewMockClient(MockClientOptions{ClientID: "gpu-02"})
+
+	// 08:30 UTC is 09:30 in Berlin (CET) on a Monday
+	monday := time.Date(2026, 3, 2, 8, 30, 0, 0, time.UTC)
+	if got := schedules.Penalty(office, monday); got != 500 {
+		t.Errorf("Expected the office-hours penalty at 09:30 Berlin time, got %v", got)
+	}
+	if got := schedules.Penalty(office, monday.Add(-time.Hour)); got != 0 {
+		t.Errorf("Expected no penalty at 08:30 Berlin time, got %v", got)
+	}
+	if got := schedules.Penalty(other, monday); got != 0 {
+		t.Errorf("Expected backends outside the pool to be unaffected, got %v", got)
+	}
+	if got := schedules.Penalty(office, monday.Add(30*time.Minute)); got != 450 {
+		t.Errorf("Expected overlapping schedules to add up, got %v", got)
+	}
+	if names := schedules.Active(office, monday.Add(30*time.Minute)); len(names) != 2 {
+		t.Errorf("Expected both schedules to be active, got %v", names)
+	}
+	if (*RoutingSchedules)(nil).Penalty(office, monday) != 0 {
+		t.Error("Expected no penalty without schedules")
+	}
+}
+
+// TestRoutingSchedules_ShiftsPlacement verifies an active schedule moves new sessions off its backends
+func TestRoutingSchedules_ShiftsPlacement(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.RoutingSchedules = []common.RoutingScheduleConfig{
+			{Name: "always", ClientIDs: []string{"backend-a"}, Windows: []string{"* * * * *"}, ScorePenalty: 1000},
+		}
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-a", CPUUsageAvg: []float64{10, 10, 10, 10, 10, 10, 10, 10}}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-b", CPUUsageAvg: []float64{50, 50, 50, 50, 50, 50, 50, 50}}))
+
+	body, _ := json.Marshal(common.RoutingRequest{Tier: "lite"})
+	rec := httptest.NewRecorder()
+	server.handleRoute(rec, httptest.NewRequest(http.MethodPost, "/route", bytes.NewReader(body)))
+	var resp common.RoutingResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Expected a routing decision, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if resp.ClientID != "backend-b" {
+		t.Errorf("Expected the unscheduled backend despite its load, got %s", resp.ClientID)
+	}
+}
+
+// TestValidateRoutingSchedules verifies schedules need a name, backends, windows, a penalty and a known zone
+func TestValidateRoutingSchedules(t *testing.T) {
+	valid := common.RoutingScheduleConfig{Name: "office", Pools: []string{"office"}, Windows: []string{"* 9-17 * * 1-5"}, ScorePenalty: 200}
+	if err := validateRoutingSchedules([]common.RoutingScheduleConfig{valid}); err != nil {
+		t.Errorf("Expected a valid schedule, got %v", err)
+	}
+
+	for name, modify := range map[string]func(*common.RoutingScheduleConfig){
+		"no name":        func(c *common.RoutingScheduleConfig) { c.Name = "" },
+		"no backends":    func(c *common.RoutingScheduleConfig) { c.Pools = nil },
+		"no windows":     func(c *common.RoutingScheduleConfig) { c.Windows = nil },
+		"invalid window": func(c *common.RoutingScheduleConfig) { c.Windows = []string{"* 25 * * *"} },
+		"no penalty":     func(c *common.RoutingScheduleConfig) { c.ScorePenalty = 0 },
+		"unknown zone":   func(c *common.RoutingScheduleConfig) { c.Timezone = "Mars/Olympus" },
+	} {
+		config := valid
+		modify(&config)
+		if err := validateRoutingSchedules([]common.RoutingScheduleConfig{config}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if err := validateRoutingSchedules([]common.RoutingScheduleConfig{valid, valid}); err == nil {
+		t.Error("Expected duplicate names to be rejected")
+	}
+}
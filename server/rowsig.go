@@ -0,0 +1,37 @@
+package main
+
+import "cyqle.in/opsen/common"
+
+// dbSigningKey returns the key used to sign persisted rows (empty = signing disabled)
+func (s *Server) dbSigningKey() string {
+	if s.config == nil {
+		return ""
+	}
+	return s.config.DBSigningKey
+}
+
+// rowSignature returns the row_hmac value for a row about to be persisted
+// Returns nil so the column is stored as NULL when signing is disabled
+func (s *Server) rowSignature(table string, values ...interface{}) interface{} {
+	key := s.dbSigningKey()
+	if key == "" {
+		return nil
+	}
+	return common.SignRow(key, table, values...)
+}
+
+// signStatsRow returns the row_hmac for a stats row with the id SQLite assigned it on insert
+// values are the insert arguments, in common.SignedStatsColumns order after id
+func signStatsRow(key string, id int64, values []interface{}) string {
+	return common.SignRow(key, "stats", append([]interface{}{id}, values...)...)
+}
+
+// validRowSignature reports whether a loaded row may be trusted
+// Unsigned rows predate db_signing_key and are accepted; signed rows must match
+func (s *Server) validRowSignature(table, signature string, values ...interface{}) bool {
+	key := s.dbSigningKey()
+	if key == "" || signature == "" {
+		return true
+	}
+	return common.VerifyRow(key, table, signature, values...)
+}
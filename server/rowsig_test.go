@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestHandleStats_SignsRows verifies stats rows written inline and by the batching writer carry a signature
+// covering their id that verifies after reading back
+func TestHandleStats_SignsRows(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.DBSigningKey = "db-key"
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "signed-client"}))
+
+	post := func() {
+		body, _ := json.Marshal(common.ResourceStats{
+			ClientID:    "signed-client",
+			CPUCores:    4,
+			CPUUsageAvg: []float64{10.5, 20, 30, 40},
+			MemoryTotal: 16,
+			MemoryUsed:  8.25,
+			LoadAvg1:    0.5,
+			Timestamp:   time.Now(),
+		})
+		rec := httptest.NewRecorder()
+		server.handleStats(rec, httptest.NewRequest("POST", "/stats", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+	post()
+	server.statsWriter = NewStatsWriter(db, "db-key", 10, 60000, 100)
+	post()
+	server.statsWriter.Close()
+
+	query := fmt.Sprintf("SELECT %s, row_hmac FROM stats WHERE client_id = ?", strings.Join(common.SignedStatsColumns, ", "))
+	rows, err := db.Query(query, "signed-client")
+	if err != nil {
+		t.Fatalf("Failed to read stats rows: %v", err)
+	}
+	defer rows.Close()
+
+	checked := 0
+	for rows.Next() {
+		values := make([]interface{}, len(common.SignedStatsColumns))
+		ptrs := make([]interface{}, len(values)+1)
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		var signature string
+		ptrs[len(values)] = &signature
+		if err := rows.Scan(ptrs...); err != nil {
+			t.Fatalf("Failed to read stats row: %v", err)
+		}
+		if !common.VerifyRow("db-key", "stats", signature, values...) {
+			t.Errorf("Expected stored stats row %v to verify", values[0])
+		}
+		checked++
+	}
+	if checked != 2 {
+		t.Errorf("Expected 2 stats rows, got %d", checked)
+	}
+}
+
+// TestLoadStickyAssignments_RejectsTamperedRows verifies edited signed rows are ignored while unsigned legacy rows load
+func TestLoadStickyAssignments_RejectsTamperedRows(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.DBSigningKey = "db-key"
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "agent-1"}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "agent-2"}))
+
+	server.selectClientWithStickiness("signed", "lite", server.tierSpecs["lite"], 0, 0, "req-1")
+	server.ClearPendingAllocations()
+	db.Exec("INSERT INTO sticky_assignments (sticky_id, tier, client_id) VALUES ('legacy', 'lite', 'agent-2')")
+	db.Exec("INSERT INTO sticky_assignments (sticky_id, tier, client_id, row_hmac) VALUES ('forged', 'lite', 'agent-2', 'deadbeef')")
+
+	if err := server.loadStickyAssignments(); err != nil {
+		t.Fatalf("loadStickyAssignments failed: %v", err)
+	}
+	if _, ok := server.stickyAssignments["default:signed"]["lite"]; !ok {
+		t.Error("Expected signed assignment to load")
+	}
+	if server.stickyAssignments["legacy"]["lite"] != "agent-2" {
+		t.Error("Expected unsigned legacy assignment to load")
+	}
+	if _, ok := server.stickyAssignments["forged"]; ok {
+		t.Error("Expected assignment with an invalid signature to be ignored")
+	}
+}
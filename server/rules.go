@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// routingRule is a compiled routing_rules entry
+type routingRule struct {
+	common.RoutingRuleConfig
+	tiers     map[string]bool
+	countries map[string]bool
+	days      map[time.Weekday]bool
+	location  *time.Location
+	window    bool
+	start     int // Minutes after midnight, inclusive
+	end       int // Minutes after midnight, exclusive
+}
+
+var ruleWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// compileRoutingRules validates routing rules and prepares them for matching
+func compileRoutingRules(configs []common.RoutingRuleConfig) ([]*routingRule, error) {
+	rules := make([]*routingRule, 0, len(configs))
+	for i, config := range configs {
+		name := config.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+			config.Name = name
+		}
+
+		action := config.Action
+		if action.Tier == "" && action.Pool == "" && action.PreferPool == "" && action.DenyStatus == 0 &&
+			action.ServiceVersion == "" && action.PreferServiceVersion == "" {
+			return nil, fmt.Errorf("routing rule %s: action must set tier, pool, prefer_pool, service_version, prefer_service_version or deny_status", name)
+		}
+		if action.DenyStatus != 0 && (action.DenyStatus < 400 || action.DenyStatus > 599) {
+			return nil, fmt.Errorf("routing rule %s: deny_status must be a 4xx or 5xx status, got %d", name, action.DenyStatus)
+		}
+
+		rule := &routingRule{RoutingRuleConfig: config, location: time.UTC}
+		if len(config.Match.Tiers) > 0 {
+			rule.tiers = make(map[string]bool)
+			for _, tier := range config.Match.Tiers {
+				rule.tiers[tier] = true
+			}
+		}
+		if len(config.Match.Countries) > 0 {
+			rule.countries = make(map[string]bool)
+			for _, country := range config.Match.Countries {
+				rule.countries[strings.ToUpper(country)] = true
+			}
+		}
+		if len(config.Match.Days) > 0 {
+			rule.days = make(map[time.Weekday]bool)
+			for _, day := range config.Match.Days {
+				weekday, ok := ruleWeekdays[strings.ToLower(day)]
+				if !ok {
+					return nil, fmt.Errorf("routing rule %s: invalid day %q (expected mon-sun)", name, day)
+				}
+				rule.days[weekday] = true
+			}
+		}
+		if config.Match.Timezone != "" {
+			location, err := time.LoadLocation(config.Match.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("routing rule %s: invalid timezone: %w", name, err)
+			}
+			rule.location = location
+		}
+		if config.Match.TimeOfDay != "" {
+			start, end, ok := parseTimeWindow(config.Match.TimeOfDay)
+			if !ok {
+				return nil, fmt.Errorf("routing rule %s: invalid time_of_day %q (expected HH:MM-HH:MM)", name, config.Match.TimeOfDay)
+			}
+			rule.window, rule.start, rule.end = true, start, end
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// parseTimeWindow parses "HH:MM-HH:MM" into minutes after midnight
+func parseTimeWindow(window string) (int, int, bool) {
+	from, to, ok := strings.Cut(window, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	start, err1 := time.Parse("15:04", strings.TrimSpace(from))
+	end, err2 := time.Parse("15:04", strings.TrimSpace(to))
+	if err1 != nil || err2 != nil {
+		return 0, 0, false
+	}
+	return start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), true
+}
+
+// ruleRequest is what routing rules match against
+type ruleRequest struct {
+	tier    string
+	path    string
+	header  http.Header
+	country func() string // Resolved lazily; only rules with countries need a GeoIP lookup
+	now     time.Time
+}
+
+func (rule *routingRule) matches(req ruleRequest) bool {
+	match := rule.Match
+	if rule.tiers != nil && !rule.tiers[req.tier] {
+		return false
+	}
+	if match.PathPrefix != "" && !strings.HasPrefix(req.path, match.PathPrefix) {
+		return false
+	}
+	for name, value := range match.Headers {
+		got := req.header.Get(name)
+		if got == "" || (value != "*" && got != value) {
+			return false
+		}
+	}
+
+	if rule.days != nil || rule.window {
+		now := req.now.In(rule.location)
+		if rule.days != nil && !rule.days[now.Weekday()] {
+			return false
+		}
+		if rule.window {
+			minute := now.Hour()*60 + now.Minute()
+			inside := minute >= rule.start && minute < rule.end
+			if rule.start > rule.end { // Wraps midnight
+				inside = minute >= rule.start || minute < rule.end
+			}
+			if !inside {
+				return false
+			}
+		}
+	}
+
+	// Country last: it may cost a GeoIP lookup
+	if rule.countries != nil && !rule.countries[strings.ToUpper(req.country())] {
+		return false
+	}
+	return true
+}
+
+// matchRoutingRule returns the first routing rule matching the request, or nil
+func (s *Server) matchRoutingRule(r *http.Request, tier, path, clientIP string) *routingRule {
+	if len(s.routingRules) == 0 {
+		return nil
+	}
+
+	country := ""
+	resolved := false
+	req := ruleRequest{
+		tier:   tier,
+		path:   path,
+		header: r.Header,
+		now:    time.Now(),
+		country: func() string {
+			if !resolved {
+				resolved = true
+				if clientIP != "" {
+					info, _ := s.lookupIP(clientIP)
+					country = info.Country
+				}
+			}
+			return country
+		},
+	}
+
+	for _, rule := range s.routingRules {
+		if rule.matches(req) {
+			LogDebugWithData("Routing rule matched", map[string]interface{}{
+				"rule": rule.Name,
+				"tier": tier,
+				"path": path,
+			})
+			return rule
+		}
+	}
+	return nil
+}
+
+// deny writes the rule's rejection if it denies the request
+// Safe to call on a nil rule
+func (rule *routingRule) deny(w http.ResponseWriter) bool {
+	if rule == nil || rule.Action.DenyStatus == 0 {
+		return false
+	}
+	message := rule.Action.DenyMessage
+	if message == "" {
+		message = http.StatusText(rule.Action.DenyStatus)
+	}
+	http.Error(w, message, rule.Action.DenyStatus)
+	return true
+}
+
+// rewriteTier returns the tier to place the request with
+func (rule *routingRule) rewriteTier(tier string) string {
+	if rule == nil || rule.Action.Tier == "" {
+		return tier
+	}
+	return rule.Action.Tier
+}
+
+// apply narrows or biases placement for a matched request
+func (rule *routingRule) apply(tier *common.TierSpec) {
+	if rule == nil {
+		return
+	}
+	tier.Pool = rule.Action.Pool
+	tier.PreferPool = rule.Action.PreferPool
+	tier.PoolBonus = rule.Action.ScoreBonus
+
+	// Version rules override what the request asked for
+	if rule.Action.ServiceVersion != "" {
+		tier.ServiceVersion = rule.Action.ServiceVersion
+	}
+	if rule.Action.PreferServiceVersion != "" {
+		tier.PreferServiceVersion = rule.Action.PreferServiceVersion
+		tier.ServiceVersionBonus = rule.Action.ScoreBonus
+		if tier.ServiceVersionBonus == 0 {
+			tier.ServiceVersionBonus = defaultServiceVersionBonus
+		}
+	}
+}
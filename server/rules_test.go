@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestHandleRoute_RoutingRules verifies rules can deny, rewrite the tier, pin a pool and prefer a pool
+func TestHandleRoute_RoutingRules(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.RoutingHeaders = true
+	})
+	rules, err := compileRoutingRules([]common.RoutingRuleConfig{
+		{Name: "block", Match: common.RoutingRuleMatch{Headers: map[string]string{"X-Blocked": "*"}},
+			Action: common.RoutingRuleAction{DenyStatus: http.StatusUnavailableForLegalReasons, DenyMessage: "Blocked"}},
+		{Name: "free-to-eu", Match: common.RoutingRuleMatch{Tiers: []string{"free"}},
+			Action: common.RoutingRuleAction{Tier: "lite", Pool: "eu"}},
+		{Name: "batch-prefers-us", Match: common.RoutingRuleMatch{PathPrefix: "/batch"},
+			Action: common.RoutingRuleAction{PreferPool: "us", ScoreBonus: 1000}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+	server.routingRules = rules
+
+	// The us backend is busier, so it only wins when preferred
+	eu := NewMockClient(MockClientOptions{ClientID: "eu-1", CPUUsageAvg: []float64{5, 5, 5, 5, 5, 5, 5, 5}})
+	eu.Registration.Pool = "eu"
+	us := NewMockClient(MockClientOptions{ClientID: "us-1", CPUUsageAvg: []float64{60, 60, 60, 60, 60, 60, 60, 60}})
+	us.Registration.Pool = "us"
+	server.AddMockClient(eu)
+	server.AddMockClient(us)
+
+	route := func(req common.RoutingRequest, header map[string]string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		r := httptest.NewRequest("POST", "/route", bytes.NewReader(body))
+		for name, value := range header {
+			r.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		server.handleRoute(rec, r)
+		return rec
+	}
+	selected := func(rec *httptest.ResponseRecorder) string {
+		var resp common.RoutingResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp.ClientID
+	}
+
+	rec := route(common.RoutingRequest{Tier: "lite"}, map[string]string{"X-Blocked": "1"})
+	if rec.Code != http.StatusUnavailableForLegalReasons || rec.Header().Get(LBRuleHeader) != "block" {
+		t.Errorf("Expected 451 from the block rule, got %d (%s)", rec.Code, rec.Header().Get(LBRuleHeader))
+	}
+
+	rec = route(common.RoutingRequest{Tier: "free"}, nil)
+	if rec.Code != http.StatusOK || selected(rec) != "eu-1" {
+		t.Errorf("Expected free tier rewritten and pinned to the eu pool, got %d", rec.Code)
+	}
+
+	if got := selected(route(common.RoutingRequest{Tier: "lite", Path: "/batch/jobs"}, nil)); got != "us-1" {
+		t.Errorf("Expected preferred us pool to win with its bonus, got %s", got)
+	}
+	if got := selected(route(common.RoutingRequest{Tier: "lite", Path: "/api"}, nil)); got != "eu-1" {
+		t.Errorf("Expected least-loaded backend without a matching rule, got %s", got)
+	}
+}
+
+// TestRoutingRule_TimeWindow verifies time_of_day windows wrap midnight and days use the rule's timezone
+func TestRoutingRule_TimeWindow(t *testing.T) {
+	rules, err := compileRoutingRules([]common.RoutingRuleConfig{{
+		Match:  common.RoutingRuleMatch{TimeOfDay: "22:00-06:00", Days: []string{"fri", "sat"}},
+		Action: common.RoutingRuleAction{Tier: "free"},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+	rule := rules[0]
+
+	friday := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC) // A Friday
+	for _, tc := range []struct {
+		at    time.Time
+		match bool
+	}{
+		{friday.Add(23 * time.Hour), true},
+		{friday.Add(29 * time.Hour), true},  // Saturday 05:00
+		{friday.Add(12 * time.Hour), false}, // Outside the window
+		{friday.Add(-2 * time.Hour), false}, // Thursday 22:00
+	} {
+		if got := rule.matches(ruleRequest{now: tc.at}); got != tc.match {
+			t.Errorf("At %s: expected match=%v, got %v", tc.at.Format(time.RFC1123), tc.match, got)
+		}
+	}
+
+	for _, invalid := range []common.RoutingRuleConfig{
+		{Action: common.RoutingRuleAction{}},
+		{Action: common.RoutingRuleAction{DenyStatus: 200}},
+		{Match: common.RoutingRuleMatch{TimeOfDay: "9-5"}, Action: common.RoutingRuleAction{Tier: "free"}},
+		{Match: common.RoutingRuleMatch{Days: []string{"someday"}}, Action: common.RoutingRuleAction{Tier: "free"}},
+	} {
+		if _, err := compileRoutingRules([]common.RoutingRuleConfig{invalid}); err == nil {
+			t.Errorf("Expected invalid rule to be rejected: %+v", invalid)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"cyqle.in/opsen/common"
+)
+
+const (
+	// LBServiceVersionHeader pins a request to backends running this service_version;
+	// responses carry the selected backend's version under the same name
+	LBServiceVersionHeader = "X-LB-Service-Version"
+	// LBPreferServiceVersionHeader prefers backends running this service_version, falling back to others
+	LBPreferServiceVersionHeader = "X-LB-Prefer-Service-Version"
+)
+
+// defaultServiceVersionBonus is the score bonus for a preferred version when no score_bonus is set,
+// in km-equivalent points; large enough that the preferred version wins whenever it has capacity
+const defaultServiceVersionBonus = 1000.0
+
+// applyRequestServiceVersion pins or prefers a backend version asked for by the request
+// Routing rules are applied afterwards and override these
+func applyRequestServiceVersion(tier *common.TierSpec, pin, prefer string) {
+	if pin = strings.TrimSpace(pin); pin != "" {
+		tier.ServiceVersion = pin
+	}
+	if prefer = strings.TrimSpace(prefer); prefer != "" {
+		tier.PreferServiceVersion = prefer
+		tier.ServiceVersionBonus = defaultServiceVersionBonus
+	}
+}
+
+// requestServiceVersions reads the version pin and preference headers
+func requestServiceVersions(r *http.Request) (pin, prefer string) {
+	return r.Header.Get(LBServiceVersionHeader), r.Header.Get(LBPreferServiceVersionHeader)
+}
+
+// serviceVersionAllowed reports whether a backend runs the version a placement is pinned to
+func serviceVersionAllowed(client *ClientState, tier common.TierSpec) bool {
+	return tier.ServiceVersion == "" || client.Registration.ServiceVersion == tier.ServiceVersion
+}
+
+// serviceVersionBonus returns the score bonus for backends running the preferred version
+func serviceVersionBonus(client *ClientState, tier common.TierSpec) float64 {
+	if tier.PreferServiceVersion == "" || client.Registration.ServiceVersion != tier.PreferServiceVersion {
+		return 0
+	}
+	return tier.ServiceVersionBonus
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestHandleRoute_ServiceVersion verifies requests and rules can pin or prefer a backend software version
+func TestHandleRoute_ServiceVersion(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	rules, err := compileRoutingRules([]common.RoutingRuleConfig{
+		{Name: "canary", Match: common.RoutingRuleMatch{Headers: map[string]string{"X-Canary": "*"}},
+			Action: common.RoutingRuleAction{ServiceVersion: "green"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+	server.routingRules = rules
+
+	// The green backend is busier, so it only wins when pinned or preferred
+	blue := NewMockClient(MockClientOptions{ClientID: "blue-1", CPUUsageAvg: []float64{5, 5, 5, 5, 5, 5, 5, 5}})
+	blue.Registration.ServiceVersion = "blue"
+	green := NewMockClient(MockClientOptions{ClientID: "green-1", CPUUsageAvg: []float64{60, 60, 60, 60, 60, 60, 60, 60}})
+	green.Registration.ServiceVersion = "green"
+	server.AddMockClient(blue)
+	server.AddMockClient(green)
+
+	route := func(req common.RoutingRequest, header map[string]string) (*httptest.ResponseRecorder, common.RoutingResponse) {
+		body, _ := json.Marshal(req)
+		r := httptest.NewRequest("POST", "/route", bytes.NewReader(body))
+		for name, value := range header {
+			r.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		server.handleRoute(rec, r)
+		var resp common.RoutingResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp
+	}
+
+	if _, resp := route(common.RoutingRequest{Tier: "lite"}, nil); resp.ClientID != "blue-1" || resp.ServiceVersion != "blue" {
+		t.Errorf("Expected the least-loaded blue backend by default, got %s (%s)", resp.ClientID, resp.ServiceVersion)
+	}
+	if _, resp := route(common.RoutingRequest{Tier: "lite", ServiceVersion: "green"}, nil); resp.ClientID != "green-1" {
+		t.Errorf("Expected service_version to pin green, got %s", resp.ClientID)
+	}
+	if _, resp := route(common.RoutingRequest{Tier: "lite"}, map[string]string{LBServiceVersionHeader: "green"}); resp.ClientID != "green-1" {
+		t.Errorf("Expected the %s header to pin green, got %s", LBServiceVersionHeader, resp.ClientID)
+	}
+	if _, resp := route(common.RoutingRequest{Tier: "lite"}, map[string]string{LBPreferServiceVersionHeader: "green"}); resp.ClientID != "green-1" {
+		t.Errorf("Expected the preferred version to win, got %s", resp.ClientID)
+	}
+	if _, resp := route(common.RoutingRequest{Tier: "lite"}, map[string]string{"X-Canary": "1"}); resp.ClientID != "green-1" {
+		t.Errorf("Expected the canary rule to pin green, got %s", resp.ClientID)
+	}
+	if rec, _ := route(common.RoutingRequest{Tier: "lite", ServiceVersion: "purple"}, nil); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when no backend runs the pinned version, got %d", rec.Code)
+	}
+
+	// A preferred version without capacity falls back to the others
+	server.mu.Lock()
+	green.Stats.MemoryAvail = 0
+	server.mu.Unlock()
+	if _, resp := route(common.RoutingRequest{Tier: "lite", PreferServiceVersion: "green"}, nil); resp.ClientID != "blue-1" {
+		t.Errorf("Expected fallback to blue when green is full, got %s", resp.ClientID)
+	}
+}
+
+// TestRegister_ServiceVersionPersisted verifies the reported version survives a server restart
+func TestRegister_ServiceVersionPersisted(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	reg := common.ClientRegistration{ClientID: "v-1", EndpointURL: "http://10.0.0.1:11000", ServiceVersion: "2.4.1"}
+	if rec := postRegistration(server, reg); rec.Code != http.StatusOK {
+		t.Fatalf("Expected registration to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	restarted := NewTestServer(t, db)
+	if err := restarted.loadClients(); err != nil {
+		t.Fatalf("Failed to load clients: %v", err)
+	}
+	if got := restarted.clientCache["v-1"].Registration.ServiceVersion; got != "2.4.1" {
+		t.Errorf("Expected service_version 2.4.1 after reload, got %q", got)
+	}
+}
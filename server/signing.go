@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// validateAgentAuthMode rejects an unknown agent_auth_mode, which would otherwise fall back to key auth,
+// and hmac mode without the server_key that signs requests
+func validateAgentAuthMode(config *common.ServerConfig) error {
+	switch config.AgentAuthMode {
+	case "", common.AuthModeKey:
+	case common.AuthModeHMAC:
+		if config.ServerKey == "" {
+			return fmt.Errorf("agent_auth_mode: hmac requires server_key to be set")
+		}
+	default:
+		return fmt.Errorf("unknown agent_auth_mode %q (want %s or %s)", config.AgentAuthMode, common.AuthModeKey, common.AuthModeHMAC)
+	}
+	return nil
+}
+
+// HMACAuth middleware verifies signed agent requests and rejects stale or replayed signatures
+// Used for /register and /stats when agent_auth_mode is "hmac", so the shared secret never
+// travels in a header that intermediaries might log
+type HMACAuth struct {
+	secret    string
+	maxSkew   time.Duration
+	mu        sync.Mutex
+	nonces    map[string]time.Time // nonce → expiry
+	lastPrune time.Time
+}
+
+// NewHMACAuth creates an HMAC verifier accepting timestamps within maxSkew of server time
+func NewHMACAuth(secret string, maxSkew time.Duration) *HMACAuth {
+	return &HMACAuth{
+		secret:    secret,
+		maxSkew:   maxSkew,
+		nonces:    make(map[string]time.Time),
+		lastPrune: time.Now(),
+	}
+}
+
+func (h *HMACAuth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timestampStr := r.Header.Get(common.SignatureTimestampHeader)
+		nonce := r.Header.Get(common.SignatureNonceHeader)
+		signature := r.Header.Get(common.SignatureHeader)
+
+		if timestampStr == "" || nonce == "" || signature == "" {
+			log.Printf("Missing request signature from IP: %s (path: %s)", getClientIP(r), r.URL.Path)
+			http.Error(w, "Missing request signature", http.StatusUnauthorized)
+			return
+		}
+
+		timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid signature timestamp", http.StatusUnauthorized)
+			return
+		}
+
+		// Reject signatures outside the allowed clock skew
+		skew := time.Since(time.Unix(timestamp, 0))
+		if skew > h.maxSkew || skew < -h.maxSkew {
+			log.Printf("Stale request signature from IP: %s (path: %s, skew: %s)", getClientIP(r), r.URL.Path, skew)
+			http.Error(w, "Request signature expired", http.StatusUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if !common.VerifySignature(h.secret, timestamp, nonce, r.Method, r.URL.Path, body, signature) {
+			log.Printf("Invalid request signature from IP: %s (path: %s)", getClientIP(r), r.URL.Path)
+			http.Error(w, "Invalid request signature", http.StatusForbidden)
+			return
+		}
+
+		// Only record the nonce after the signature checks out, so forged requests can't burn nonces
+		if !h.recordNonce(nonce) {
+			log.Printf("Replayed request signature from IP: %s (path: %s)", getClientIP(r), r.URL.Path)
+			http.Error(w, "Request signature already used", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// recordNonce stores a nonce until it can no longer pass the skew check
+// Returns false if the nonce was already seen
+func (h *HMACAuth) recordNonce(nonce string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(h.lastPrune) > h.maxSkew {
+		for n, expiry := range h.nonces {
+			if now.After(expiry) {
+				delete(h.nonces, n)
+			}
+		}
+		h.lastPrune = now
+	}
+
+	if expiry, seen := h.nonces[nonce]; seen && now.Before(expiry) {
+		return false
+	}
+
+	// A timestamp can be up to maxSkew in the future, so keep nonces for twice the skew
+	h.nonces[nonce] = now.Add(2 * h.maxSkew)
+	return true
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+func newSignedRequest(t *testing.T, secret string, timestamp time.Time, nonce string, body []byte) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/stats", bytes.NewReader(body))
+	ts := timestamp.Unix()
+	req.Header.Set(common.SignatureTimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(common.SignatureNonceHeader, nonce)
+	req.Header.Set(common.SignatureHeader, common.SignRequest(secret, ts, nonce, "POST", "/stats", body))
+	return req
+}
+
+// echoBodyHandler verifies the body is still readable after signature verification
+func echoBodyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	})
+}
+
+// TestHMACAuth_ValidSignature verifies correctly signed requests pass with body intact
+func TestHMACAuth_ValidSignature(t *testing.T) {
+	auth := NewHMACAuth("secret", 5*time.Minute)
+	handler := auth.Middleware(echoBodyHandler())
+
+	body := []byte(`{"client_id":"agent-1"}`)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newSignedRequest(t, "secret", time.Now(), "nonce-1", body))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Body.String() != string(body) {
+		t.Errorf("Expected body to be passed through, got %q", rec.Body.String())
+	}
+}
+
+// TestHMACAuth_Rejections verifies missing, invalid, stale, and replayed signatures are rejected
+func TestHMACAuth_Rejections(t *testing.T) {
+	auth := NewHMACAuth("secret", 5*time.Minute)
+	handler := auth.Middleware(echoBodyHandler())
+	body := []byte(`{"client_id":"agent-1"}`)
+
+	// Missing headers
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/stats", bytes.NewReader(body)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for unsigned request, got %d", rec.Code)
+	}
+
+	// Wrong secret
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newSignedRequest(t, "wrong", time.Now(), "nonce-a", body))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for bad signature, got %d", rec.Code)
+	}
+
+	// Tampered body
+	req := newSignedRequest(t, "secret", time.Now(), "nonce-b", body)
+	req.Body = io.NopCloser(bytes.NewReader([]byte(`{"client_id":"evil"}`)))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for tampered body, got %d", rec.Code)
+	}
+
+	// Stale timestamp
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newSignedRequest(t, "secret", time.Now().Add(-10*time.Minute), "nonce-c", body))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for stale signature, got %d", rec.Code)
+	}
+
+	// Replay of an accepted request
+	now := time.Now()
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newSignedRequest(t, "secret", now, "nonce-d", body))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected first request to succeed, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newSignedRequest(t, "secret", now, "nonce-d", body))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for replayed signature, got %d", rec.Code)
+	}
+}
+
+// TestHMACAuth_ForgedRequestDoesNotBurnNonce verifies nonces are recorded only after verification
+func TestHMACAuth_ForgedRequestDoesNotBurnNonce(t *testing.T) {
+	auth := NewHMACAuth("secret", 5*time.Minute)
+	handler := auth.Middleware(echoBodyHandler())
+	body := []byte(`{}`)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newSignedRequest(t, "attacker", time.Now(), "shared-nonce", body))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("Expected forged request to be rejected, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newSignedRequest(t, "secret", time.Now(), "shared-nonce", body))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected legitimate request to succeed, got %d", rec.Code)
+	}
+}
+
+// TestValidateAgentAuthMode verifies unknown modes and hmac without a server key are rejected
+func TestValidateAgentAuthMode(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		serverKey string
+		wantErr   bool
+	}{
+		{"default", "", "", false},
+		{"key", common.AuthModeKey, "secret", false},
+		{"hmac", common.AuthModeHMAC, "secret", false},
+		{"hmac without server key", common.AuthModeHMAC, "", true},
+		{"typo", "hamc", "secret", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAgentAuthMode(&common.ServerConfig{AgentAuthMode: tt.mode, ServerKey: tt.serverKey})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateAgentAuthMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,632 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// defaultSimulationProfiles are the built-in fake backend shapes for --simulate
+var defaultSimulationProfiles = []common.SimulationProfile{
+	{Name: "small", CPU: 4, MemoryGB: 8, StorageGB: 100, BaseLoadPct: 10, LatencyMs: 20, JitterMs: 5, HourlyCost: 0.10},
+	{Name: "medium", CPU: 16, MemoryGB: 64, StorageGB: 500, BaseLoadPct: 15, LatencyMs: 30, JitterMs: 10, HourlyCost: 0.60},
+	{Name: "large", CPU: 64, MemoryGB: 256, StorageGB: 2000, BaseLoadPct: 20, LatencyMs: 40, JitterMs: 15, HourlyCost: 2.40},
+	{Name: "gpu", CPU: 32, MemoryGB: 128, StorageGB: 1000, GPUs: 4, GPUMemoryGB: 24, BaseLoadPct: 10, LatencyMs: 50, JitterMs: 20, HourlyCost: 4.00},
+}
+
+// simLocations spreads simulated backends and traffic across a few regions
+var simLocations = []struct {
+	Country string
+	City    string
+	Lat     float64
+	Lon     float64
+}{
+	{"US", "New York", 40.7128, -74.0060},
+	{"US", "San Francisco", 37.7749, -122.4194},
+	{"DE", "Frankfurt", 50.1109, 8.6821},
+	{"SG", "Singapore", 1.3521, 103.8198},
+	{"BR", "Sao Paulo", -23.5505, -46.6333},
+}
+
+// SimulationOptions configures the in-process fake fleet and traffic generator
+type SimulationOptions struct {
+	Backends        int                        // Number of fake backends to spawn
+	Profiles        []common.SimulationProfile // Profiles assigned round-robin to backends
+	TrafficRPS      float64                    // Route requests per second (0 = no traffic generator)
+	StickyUsers     int                        // Size of the simulated user pool for sticky IDs
+	SessionDuration time.Duration              // How long a routed session occupies its backend
+	StatsInterval   time.Duration              // How often each backend reports stats
+	Seed            int64                      // Random seed (0 = time-based)
+
+	ServerURL    string // Base URL of the load balancer under test
+	ServerKey    string // Server key for agent and management endpoints
+	AuthMode     string // Agent auth mode ("key" or "hmac")
+	StickyHeader string // Sticky header to send with generated route requests
+	InsecureTLS  bool   // Skip TLS verification when talking to the load balancer
+}
+
+// SimulationSummary reports what the traffic generator has observed so far
+type SimulationSummary struct {
+	Requests  int64            `json:"requests"`
+	Routed    int64            `json:"routed"`
+	Rejected  int64            `json:"rejected"`  // 503 - no backend with sufficient resources
+	Throttled int64            `json:"throttled"` // 429 - rate limited by the load balancer
+	Errors    int64            `json:"errors"`
+	PerClient map[string]int64 `json:"per_client"`
+}
+
+// simSession is a routed session occupying resources on a fake backend
+type simSession struct {
+	tier    common.TierSpec
+	expires time.Time
+}
+
+// simBackend is a fake backend with an HTTP endpoint and synthetic resource usage
+type simBackend struct {
+	id       string
+	profile  common.SimulationProfile
+	location int
+	endpoint string
+	server   *http.Server
+
+	mu       sync.Mutex
+	sessions []simSession
+}
+
+// Simulator drives fake backends and synthetic traffic against a running load balancer
+type Simulator struct {
+	opts       SimulationOptions
+	tiers      []common.TierSpec
+	httpClient *http.Client
+
+	backendsMu sync.RWMutex // Guards backends, byID and stopped: Stop and the traffic goroutines race with Start
+	backends   []*simBackend
+	byID       map[string]*simBackend
+	stopped    bool
+	stopOnce   sync.Once
+
+	rngMu sync.Mutex
+	rng   *rand.Rand
+
+	mu      sync.Mutex
+	summary SimulationSummary
+}
+
+// resolveSimulationProfiles picks profiles by name from the built-in and custom sets
+// Custom profiles override built-in ones with the same name; empty names select all built-ins
+func resolveSimulationProfiles(names string, custom []common.SimulationProfile) ([]common.SimulationProfile, error) {
+	available := make(map[string]common.SimulationProfile)
+	for _, profile := range defaultSimulationProfiles {
+		available[profile.Name] = profile
+	}
+	for _, profile := range custom {
+		if profile.Name == "" {
+			return nil, fmt.Errorf("simulation profile without a name")
+		}
+		if profile.CPU <= 0 || profile.MemoryGB <= 0 {
+			return nil, fmt.Errorf("simulation profile %q needs cpu and memory_gb", profile.Name)
+		}
+		available[profile.Name] = profile
+	}
+
+	if strings.TrimSpace(names) == "" {
+		return append([]common.SimulationProfile(nil), defaultSimulationProfiles[:3]...), nil
+	}
+
+	var profiles []common.SimulationProfile
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		profile, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown simulation profile: %s", name)
+		}
+		profiles = append(profiles, profile)
+	}
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no simulation profiles selected")
+	}
+	return profiles, nil
+}
+
+// NewSimulator creates a simulator for the given tiers
+func NewSimulator(opts SimulationOptions, tiers []common.TierSpec) *Simulator {
+	if opts.StickyUsers <= 0 {
+		opts.StickyUsers = 1000
+	}
+	if opts.SessionDuration <= 0 {
+		opts.SessionDuration = 5 * time.Minute
+	}
+	if opts.StatsInterval <= 0 {
+		opts.StatsInterval = 5 * time.Second
+	}
+	if len(opts.Profiles) == 0 {
+		opts.Profiles = defaultSimulationProfiles[:3]
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	transport := &http.Transport{}
+	if opts.InsecureTLS {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &Simulator{
+		opts:       opts,
+		tiers:      tiers,
+		httpClient: &http.Client{Timeout: 10 * time.Second, Transport: transport},
+		byID:       make(map[string]*simBackend),
+		rng:        rand.New(rand.NewSource(seed)),
+		summary:    SimulationSummary{PerClient: make(map[string]int64)},
+	}
+}
+
+// Start spawns the fake backends, registers them, and starts stats and traffic loops
+func (sim *Simulator) Start(ctx context.Context) error {
+	backends := make([]*simBackend, 0, sim.opts.Backends)
+	for i := 0; i < sim.opts.Backends; i++ {
+		profile := sim.opts.Profiles[i%len(sim.opts.Profiles)]
+		backend, err := sim.startBackend(i, profile)
+		if err != nil {
+			sim.Stop()
+			return err
+		}
+		sim.backendsMu.Lock()
+		stopped := sim.stopped
+		if !stopped {
+			sim.backends = append(sim.backends, backend)
+			sim.byID[backend.id] = backend
+		}
+		sim.backendsMu.Unlock()
+		if stopped {
+			// Stop already ran, so it won't close a backend added now
+			backend.server.Close()
+			return fmt.Errorf("simulator stopped while starting")
+		}
+		backends = append(backends, backend)
+	}
+
+	for _, backend := range backends {
+		if err := sim.register(backend); err != nil {
+			sim.Stop()
+			return fmt.Errorf("failed to register %s: %w", backend.id, err)
+		}
+		if err := sim.reportStats(backend); err != nil {
+			LogWarn(fmt.Sprintf("Simulated backend %s failed to report stats: %v", backend.id, err))
+		}
+		go sim.runStatsLoop(ctx, backend)
+	}
+
+	LogInfoWithData("Simulated backends started", map[string]interface{}{
+		"backends":    len(backends),
+		"profiles":    len(sim.opts.Profiles),
+		"traffic_rps": sim.opts.TrafficRPS,
+	})
+
+	if sim.opts.TrafficRPS > 0 {
+		go sim.runTraffic(ctx)
+	}
+
+	return nil
+}
+
+// Stop shuts down the fake backend listeners; calling it again is a no-op
+func (sim *Simulator) Stop() {
+	sim.stopOnce.Do(func() {
+		sim.backendsMu.Lock()
+		sim.stopped = true
+		backends := sim.backends
+		sim.backendsMu.Unlock()
+
+		for _, backend := range backends {
+			backend.server.Close()
+		}
+	})
+}
+
+// Summary returns a snapshot of the traffic generator counters
+func (sim *Simulator) Summary() SimulationSummary {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	snapshot := sim.summary
+	snapshot.PerClient = make(map[string]int64, len(sim.summary.PerClient))
+	for id, count := range sim.summary.PerClient {
+		snapshot.PerClient[id] = count
+	}
+	return snapshot
+}
+
+// startBackend opens a loopback listener serving the backend's latency profile
+func (sim *Simulator) startBackend(index int, profile common.SimulationProfile) (*simBackend, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start simulated backend: %w", err)
+	}
+
+	backend := &simBackend{
+		id:       fmt.Sprintf("sim-%s-%03d", profile.Name, index),
+		profile:  profile,
+		location: index % len(simLocations),
+		endpoint: "http://" + listener.Addr().String(),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(sim.latency(profile))
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]string{
+			"backend": backend.id,
+			"path":    r.URL.Path,
+		}); err != nil {
+			LogWarn(fmt.Sprintf("Simulated backend %s failed to encode response: %v", backend.id, err))
+		}
+	})
+	backend.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := backend.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			LogWarn(fmt.Sprintf("Simulated backend %s stopped: %v", backend.id, err))
+		}
+	}()
+
+	return backend, nil
+}
+
+// latency returns the profile latency with uniform jitter applied
+func (sim *Simulator) latency(profile common.SimulationProfile) time.Duration {
+	ms := profile.LatencyMs
+	if profile.JitterMs > 0 {
+		ms += (sim.randFloat()*2 - 1) * profile.JitterMs
+	}
+	if ms < 0 {
+		ms = 0
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+func (sim *Simulator) randFloat() float64 {
+	sim.rngMu.Lock()
+	defer sim.rngMu.Unlock()
+	return sim.rng.Float64()
+}
+
+func (sim *Simulator) randIntn(n int) int {
+	sim.rngMu.Lock()
+	defer sim.rngMu.Unlock()
+	return sim.rng.Intn(n)
+}
+
+// register sends the backend's registration to the load balancer
+func (sim *Simulator) register(backend *simBackend) error {
+	location := simLocations[backend.location]
+	gpuModels := make([]string, backend.profile.GPUs)
+	for i := range gpuModels {
+		gpuModels[i] = "Simulated GPU"
+	}
+
+	body, _ := json.Marshal(common.ClientRegistration{
+		ClientID:     backend.id,
+		Hostname:     backend.id,
+		PublicIP:     "127.0.0.1",
+		LocalIP:      "127.0.0.1",
+		Latitude:     location.Lat,
+		Longitude:    location.Lon,
+		Country:      location.Country,
+		City:         location.City,
+		TotalCPU:     backend.profile.CPU,
+		TotalMemory:  backend.profile.MemoryGB,
+		TotalStorage: backend.profile.StorageGB,
+		TotalGPUs:    backend.profile.GPUs,
+		GPUModels:    gpuModels,
+		EndpointURL:  backend.endpoint,
+		HourlyCost:   backend.profile.HourlyCost,
+	})
+
+	return sim.postAgent("/register", body)
+}
+
+// runStatsLoop periodically reports synthetic stats until the context is cancelled
+func (sim *Simulator) runStatsLoop(ctx context.Context, backend *simBackend) {
+	ticker := time.NewTicker(sim.opts.StatsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := sim.reportStats(backend); err != nil {
+				LogWarn(fmt.Sprintf("Simulated backend %s failed to report stats: %v", backend.id, err))
+			}
+		}
+	}
+}
+
+// reportStats sends the backend's current synthetic usage to the load balancer
+func (sim *Simulator) reportStats(backend *simBackend) error {
+	body, _ := json.Marshal(sim.buildStats(backend, time.Now()))
+	return sim.postAgent("/stats", body)
+}
+
+// buildStats derives resource usage from the backend's base load and active sessions
+// Each active session pins its tier's vCPUs near full usage and consumes its memory, disk, and GPUs
+func (sim *Simulator) buildStats(backend *simBackend, now time.Time) common.ResourceStats {
+	backend.mu.Lock()
+	active := backend.sessions[:0]
+	busyCores, gpuShares := 0, 0.0
+	memoryUsed, diskUsed, gpuMemoryUsed := 0.0, 0.0, 0.0
+	for _, session := range backend.sessions {
+		if now.After(session.expires) {
+			continue
+		}
+		active = append(active, session)
+		busyCores += session.tier.VCPU
+		gpuShares += session.tier.GPU
+		memoryUsed += session.tier.MemoryGB
+		diskUsed += float64(session.tier.StorageGB)
+		gpuMemoryUsed += session.tier.GPUMemoryGB
+	}
+	backend.sessions = active
+	backend.mu.Unlock()
+	busyGPUs := int(math.Ceil(gpuShares)) // Fractional sessions are packed onto as few devices as they fill
+
+	profile := backend.profile
+	cpuUsage := make([]float64, profile.CPU)
+	for i := range cpuUsage {
+		if i < busyCores {
+			cpuUsage[i] = 90 + sim.randFloat()*10
+		} else {
+			cpuUsage[i] = math.Max(0, profile.BaseLoadPct+(sim.randFloat()*2-1)*5)
+		}
+	}
+
+	// Baseline OS footprint of 10% memory and 5% disk
+	memoryUsed = math.Min(profile.MemoryGB, memoryUsed+profile.MemoryGB*0.10)
+	diskUsed = math.Min(profile.StorageGB, diskUsed+profile.StorageGB*0.05)
+
+	var gpus []common.GPUStats
+	for i := 0; i < profile.GPUs; i++ {
+		used := 0.0
+		utilization := 0.0
+		if i < busyGPUs {
+			used = math.Min(profile.GPUMemoryGB, gpuMemoryUsed/float64(busyGPUs))
+			utilization = 80 + sim.randFloat()*20
+		}
+		gpus = append(gpus, common.GPUStats{
+			DeviceID:       i,
+			Name:           "Simulated GPU",
+			UtilizationPct: utilization,
+			MemoryUsedGB:   used,
+			MemoryTotalGB:  profile.GPUMemoryGB,
+			TemperatureC:   40 + utilization/4,
+		})
+	}
+
+	location := simLocations[backend.location]
+	load := float64(busyCores) + float64(profile.CPU)*profile.BaseLoadPct/100
+	return common.ResourceStats{
+		ClientID:    backend.id,
+		Hostname:    backend.id,
+		Timestamp:   now,
+		CPUCores:    profile.CPU,
+		CPUUsageAvg: cpuUsage,
+		MemoryTotal: profile.MemoryGB,
+		MemoryUsed:  memoryUsed,
+		MemoryAvail: profile.MemoryGB - memoryUsed,
+		DiskTotal:   profile.StorageGB,
+		DiskUsed:    diskUsed,
+		DiskAvail:   profile.StorageGB - diskUsed,
+		GPUs:        gpus,
+		LoadAvg1:    load,
+		LoadAvg5:    load,
+		LoadAvg15:   load,
+		PublicIP:    "127.0.0.1",
+		Latitude:    location.Lat,
+		Longitude:   location.Lon,
+		Country:     location.Country,
+		City:        location.City,
+	}
+}
+
+// runTraffic issues route requests at the configured rate and logs a periodic summary
+func (sim *Simulator) runTraffic(ctx context.Context) {
+	interval := time.Duration(float64(time.Second) / sim.opts.TrafficRPS)
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	summaryTicker := time.NewTicker(30 * time.Second)
+	defer summaryTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			sim.logSummary()
+			return
+		case <-summaryTicker.C:
+			sim.logSummary()
+		case <-ticker.C:
+			go sim.sendRoute()
+		}
+	}
+}
+
+// sendRoute issues one synthetic /route request and attaches the session to the chosen backend
+func (sim *Simulator) sendRoute() {
+	if len(sim.tiers) == 0 {
+		return
+	}
+	tier := sim.tiers[sim.randIntn(len(sim.tiers))]
+	location := simLocations[sim.randIntn(len(simLocations))]
+
+	body, _ := json.Marshal(common.RoutingRequest{
+		Tier:      tier.Name,
+		ClientLat: location.Lat + (sim.randFloat()*2-1)*2,
+		ClientLon: location.Lon + (sim.randFloat()*2-1)*2,
+	})
+
+	req, err := http.NewRequest(http.MethodPost, sim.opts.ServerURL+"/route", bytes.NewReader(body))
+	if err != nil {
+		sim.record("", http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sim.opts.ServerKey != "" {
+		req.Header.Set("X-API-Key", sim.opts.ServerKey)
+	}
+	if sim.opts.StickyHeader != "" {
+		req.Header.Set(sim.opts.StickyHeader, fmt.Sprintf("sim-user-%d", sim.randIntn(sim.opts.StickyUsers)))
+	}
+
+	resp, err := sim.httpClient.Do(req)
+	if err != nil {
+		sim.record("", 0)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		sim.record("", resp.StatusCode)
+		return
+	}
+
+	var routing common.RoutingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&routing); err != nil {
+		sim.record("", 0)
+		return
+	}
+	sim.record(routing.ClientID, resp.StatusCode)
+
+	sim.backendsMu.RLock()
+	backend, ok := sim.byID[routing.ClientID]
+	sim.backendsMu.RUnlock()
+	if ok {
+		backend.mu.Lock()
+		backend.sessions = append(backend.sessions, simSession{
+			tier:    tier,
+			expires: time.Now().Add(sim.opts.SessionDuration),
+		})
+		backend.mu.Unlock()
+	}
+}
+
+// record updates the traffic counters for one route response
+func (sim *Simulator) record(clientID string, status int) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	sim.summary.Requests++
+	switch status {
+	case http.StatusOK:
+		sim.summary.Routed++
+		sim.summary.PerClient[clientID]++
+	case http.StatusServiceUnavailable:
+		sim.summary.Rejected++
+	case http.StatusTooManyRequests:
+		sim.summary.Throttled++
+	default:
+		sim.summary.Errors++
+	}
+}
+
+// logSummary logs the traffic counters and the busiest backends
+func (sim *Simulator) logSummary() {
+	summary := sim.Summary()
+
+	ids := make([]string, 0, len(summary.PerClient))
+	for id := range summary.PerClient {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return summary.PerClient[ids[i]] > summary.PerClient[ids[j]]
+	})
+	top := make([]string, 0, 5)
+	for i := 0; i < len(ids) && i < 5; i++ {
+		top = append(top, fmt.Sprintf("%s=%d", ids[i], summary.PerClient[ids[i]]))
+	}
+
+	LogInfoWithData("Simulation traffic summary", map[string]interface{}{
+		"requests":     summary.Requests,
+		"routed":       summary.Routed,
+		"rejected":     summary.Rejected,
+		"throttled":    summary.Throttled,
+		"errors":       summary.Errors,
+		"backends_hit": len(summary.PerClient),
+		"top_backends": strings.Join(top, ", "),
+	})
+}
+
+// postAgent sends an agent request (/register or /stats) using the configured auth mode
+func (sim *Simulator) postAgent(path string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, sim.opts.ServerURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if sim.opts.ServerKey != "" {
+		if sim.opts.AuthMode == common.AuthModeHMAC {
+			nonce, err := common.NewNonce()
+			if err != nil {
+				return fmt.Errorf("failed to generate nonce: %w", err)
+			}
+			timestamp := time.Now().Unix()
+			req.Header.Set(common.SignatureTimestampHeader, strconv.FormatInt(timestamp, 10))
+			req.Header.Set(common.SignatureNonceHeader, nonce)
+			req.Header.Set(common.SignatureHeader, common.SignRequest(sim.opts.ServerKey, timestamp, nonce, http.MethodPost, req.URL.Path, body))
+		} else {
+			req.Header.Set("X-API-Key", sim.opts.ServerKey)
+		}
+	}
+
+	resp, err := sim.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s failed: %s", path, resp.Status)
+	}
+	return nil
+}
+
+// waitForServer polls /health until the load balancer accepts connections
+func (sim *Simulator) waitForServer(ctx context.Context, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := sim.httpClient.Get(sim.opts.ServerURL + "/health")
+		if err == nil {
+			resp.Body.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("load balancer not reachable at %s: %w", sim.opts.ServerURL, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
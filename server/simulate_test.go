@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// newSimulationTarget serves the agent and routing handlers of a test server over HTTP
+func newSimulationTarget(t *testing.T, server *Server) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", server.handleRegister)
+	mux.HandleFunc("/stats", server.handleStats)
+	mux.HandleFunc("/route", server.handleRoute)
+	mux.HandleFunc("/health", server.handleHealth)
+	target := httptest.NewServer(mux)
+	t.Cleanup(target.Close)
+	return target
+}
+
+// TestResolveSimulationProfiles verifies built-in selection, custom overrides, and unknown names
+func TestResolveSimulationProfiles(t *testing.T) {
+	profiles, err := resolveSimulationProfiles("", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(profiles) != 3 || profiles[0].Name != "small" {
+		t.Errorf("Expected small/medium/large defaults, got %+v", profiles)
+	}
+
+	custom := []common.SimulationProfile{{Name: "small", CPU: 2, MemoryGB: 2}}
+	profiles, err = resolveSimulationProfiles("small, gpu", custom)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(profiles) != 2 || profiles[0].CPU != 2 || profiles[1].GPUs != 4 {
+		t.Errorf("Expected custom small and built-in gpu, got %+v", profiles)
+	}
+
+	if _, err := resolveSimulationProfiles("huge", nil); err == nil {
+		t.Error("Expected error for unknown profile")
+	}
+	if _, err := resolveSimulationProfiles("", []common.SimulationProfile{{Name: "bad"}}); err == nil {
+		t.Error("Expected error for profile without cpu and memory")
+	}
+}
+
+// TestSimulator_BuildStatsReflectsSessions verifies active sessions consume cores and memory until they expire
+func TestSimulator_BuildStatsReflectsSessions(t *testing.T) {
+	sim := NewSimulator(SimulationOptions{Seed: 1}, nil)
+	backend := &simBackend{
+		id:      "sim-small-000",
+		profile: common.SimulationProfile{Name: "small", CPU: 4, MemoryGB: 10, StorageGB: 100, BaseLoadPct: 10},
+	}
+
+	now := time.Now()
+	backend.sessions = []simSession{
+		{tier: common.TierSpec{VCPU: 2, MemoryGB: 4}, expires: now.Add(time.Minute)},
+		{tier: common.TierSpec{VCPU: 1, MemoryGB: 2}, expires: now.Add(-time.Second)},
+	}
+
+	stats := sim.buildStats(backend, now)
+
+	busy := 0
+	for _, usage := range stats.CPUUsageAvg {
+		if usage >= 80 {
+			busy++
+		}
+	}
+	if busy != 2 {
+		t.Errorf("Expected 2 busy cores, got %d (%v)", busy, stats.CPUUsageAvg)
+	}
+	if stats.MemoryUsed != 5 {
+		t.Errorf("Expected 5 GB used (4 GB session + 1 GB baseline), got %.1f", stats.MemoryUsed)
+	}
+	if len(backend.sessions) != 1 {
+		t.Errorf("Expected expired session to be pruned, got %d sessions", len(backend.sessions))
+	}
+}
+
+// TestSimulator_RegistersBackendsAndRoutesTraffic verifies fake backends register and receive routed sessions
+func TestSimulator_RegistersBackendsAndRoutesTraffic(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	target := newSimulationTarget(t, server)
+
+	sim := NewSimulator(SimulationOptions{
+		Backends:      3,
+		Profiles:      []common.SimulationProfile{{Name: "tiny", CPU: 4, MemoryGB: 8, StorageGB: 100}},
+		StatsInterval: time.Hour,
+		Seed:          42,
+		ServerURL:     target.URL,
+	}, []common.TierSpec{{Name: "lite", VCPU: 1, MemoryGB: 1, StorageGB: 5}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := sim.waitForServer(ctx, 5*time.Second); err != nil {
+		t.Fatalf("Server not reachable: %v", err)
+	}
+	if err := sim.Start(ctx); err != nil {
+		t.Fatalf("Failed to start simulation: %v", err)
+	}
+	defer sim.Stop()
+
+	server.mu.RLock()
+	registered := len(server.clientCache)
+	server.mu.RUnlock()
+	if registered != 3 {
+		t.Fatalf("Expected 3 simulated backends registered, got %d", registered)
+	}
+
+	for i := 0; i < 5; i++ {
+		sim.sendRoute()
+	}
+
+	summary := sim.Summary()
+	if summary.Requests != 5 || summary.Routed != 5 {
+		t.Errorf("Expected 5 routed requests, got %+v", summary)
+	}
+
+	sessions := 0
+	for _, backend := range sim.backends {
+		backend.mu.Lock()
+		sessions += len(backend.sessions)
+		backend.mu.Unlock()
+	}
+	if sessions != 5 {
+		t.Errorf("Expected 5 sessions attached to backends, got %d", sessions)
+	}
+}
+
+// TestSimulator_StopRacesStart verifies Stop can run while Start is spawning backends and is safe to call twice
+func TestSimulator_StopRacesStart(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	target := newSimulationTarget(t, server)
+
+	sim := NewSimulator(SimulationOptions{
+		Backends:      20,
+		Profiles:      []common.SimulationProfile{{Name: "tiny", CPU: 4, MemoryGB: 8, StorageGB: 100}},
+		StatsInterval: time.Hour,
+		Seed:          7,
+		ServerURL:     target.URL,
+	}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sim.Start(ctx) // Fails if Stop wins the race, which is fine here
+	}()
+	sim.Stop()
+	<-done
+	sim.Stop()
+
+	sim.backendsMu.RLock()
+	backends := sim.backends
+	sim.backendsMu.RUnlock()
+	for _, backend := range backends {
+		resp, err := http.Get(backend.endpoint)
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("Expected backend %s to be closed after Stop", backend.id)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// SLO kinds: what latency an objective measures
+const (
+	sloKindRoute     = "route"      // POST /route, from request to placement decision
+	sloKindProxyTTFB = "proxy_ttfb" // Proxied requests, from arrival to the backend's response headers
+)
+
+// sloCheckInterval is how often burn rates are evaluated for alerts and metrics
+const sloCheckInterval = 30 * time.Second
+
+// defaultSLOWindows are the multi-window, multi-burn-rate pairs used when an objective lists none:
+// a fast burn that spends 2% of a 30-day budget in an hour, and a slower one that spends 5% in six
+var defaultSLOWindows = []common.SLOWindowConfig{
+	{ShortMins: 5, LongMins: 60, BurnRate: 14.4},
+	{ShortMins: 30, LongMins: 360, BurnRate: 6},
+}
+
+// SLOTracker counts requests within and over each objective's latency threshold in one-minute buckets
+type SLOTracker struct {
+	mu   sync.Mutex
+	slos []*sloState
+}
+
+type sloState struct {
+	config  common.SLOConfig
+	buckets []sloBucket // Ring of one-minute buckets covering the longest window
+	firing  bool        // Alert state at the last evaluation (for transition webhooks)
+}
+
+type sloBucket struct {
+	minute int64 // Unix minute the counts belong to; a stale bucket is reset on reuse
+	good   int64
+	total  int64
+}
+
+// SLOStatus is an objective's burn rates and alert state (GET /slo)
+type SLOStatus struct {
+	Name        string            `json:"name"`
+	Kind        string            `json:"kind"`
+	ThresholdMs float64           `json:"threshold_ms"`
+	TargetPct   float64           `json:"target_pct"`
+	Firing      bool              `json:"firing"`
+	Windows     []SLOWindowStatus `json:"windows"`
+}
+
+// SLOWindowStatus is the burn rate over one short/long window pair
+type SLOWindowStatus struct {
+	ShortMins     int     `json:"short_window_minutes"`
+	LongMins      int     `json:"long_window_minutes"`
+	BurnRate      float64 `json:"burn_rate"` // Threshold both windows must reach
+	ShortBurnRate float64 `json:"short_burn_rate"`
+	LongBurnRate  float64 `json:"long_burn_rate"`
+	ShortRequests int64   `json:"short_requests"`
+	LongRequests  int64   `json:"long_requests"`
+	Firing        bool    `json:"firing"`
+}
+
+// NewSLOTracker creates a tracker, or returns nil if no objectives are configured
+func NewSLOTracker(configs []common.SLOConfig) *SLOTracker {
+	if len(configs) == 0 {
+		return nil
+	}
+	t := &SLOTracker{}
+	for _, config := range configs {
+		if len(config.Windows) == 0 {
+			config.Windows = defaultSLOWindows
+		}
+		longest := 0
+		for _, window := range config.Windows {
+			longest = max(longest, window.LongMins)
+		}
+		t.slos = append(t.slos, &sloState{config: config, buckets: make([]sloBucket, longest)})
+	}
+	return t
+}
+
+// validateSLOs checks objective names, kinds, thresholds and windows
+func validateSLOs(configs []common.SLOConfig) error {
+	names := make(map[string]bool, len(configs))
+	for _, slo := range configs {
+		if slo.Name == "" {
+			return fmt.Errorf("slos: every objective needs a name")
+		}
+		if names[slo.Name] {
+			return fmt.Errorf("slos: duplicate objective %q", slo.Name)
+		}
+		names[slo.Name] = true
+		if slo.Kind != sloKindRoute && slo.Kind != sloKindProxyTTFB {
+			return fmt.Errorf("slos: %s: kind must be %q or %q, got %q", slo.Name, sloKindRoute, sloKindProxyTTFB, slo.Kind)
+		}
+		if slo.ThresholdMs <= 0 {
+			return fmt.Errorf("slos: %s: threshold_ms must be positive", slo.Name)
+		}
+		if slo.TargetPct <= 0 || slo.TargetPct >= 100 {
+			return fmt.Errorf("slos: %s: need 0 < target_pct < 100 (got %g)", slo.Name, slo.TargetPct)
+		}
+		for _, window := range slo.Windows {
+			if window.ShortMins < 1 || window.LongMins <= window.ShortMins {
+				return fmt.Errorf("slos: %s: need 1 <= short_window_minutes < long_window_minutes (got %d and %d)",
+					slo.Name, window.ShortMins, window.LongMins)
+			}
+			if window.BurnRate <= 0 {
+				return fmt.Errorf("slos: %s: burn_rate must be positive", slo.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Observe records one request's latency against every objective of its kind
+func (t *SLOTracker) Observe(kind string, latency time.Duration, now time.Time) {
+	if t == nil {
+		return
+	}
+	minute := now.Unix() / 60
+	latencyMs := float64(latency) / float64(time.Millisecond)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, slo := range t.slos {
+		if slo.config.Kind != kind {
+			continue
+		}
+		bucket := &slo.buckets[minute%int64(len(slo.buckets))]
+		if bucket.minute != minute {
+			*bucket = sloBucket{minute: minute}
+		}
+		bucket.total++
+		if latencyMs <= slo.config.ThresholdMs {
+			bucket.good++
+		}
+	}
+}
+
+// burnRate returns how fast the last mins minutes (including the current one) spent the error budget,
+// and how many requests they saw; 1 means exactly at the objective, 0 with no requests
+func (slo *sloState) burnRate(mins int, minute int64) (float64, int64) {
+	var good, total int64
+	for _, bucket := range slo.buckets {
+		if bucket.total > 0 && bucket.minute > minute-int64(mins) && bucket.minute <= minute {
+			good += bucket.good
+			total += bucket.total
+		}
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	errorRate := float64(total-good) / float64(total)
+	return errorRate / (1 - slo.config.TargetPct/100), total
+}
+
+// status computes the objective's burn rates as of the given Unix minute
+func (slo *sloState) status(minute int64) SLOStatus {
+	status := SLOStatus{
+		Name:        slo.config.Name,
+		Kind:        slo.config.Kind,
+		ThresholdMs: slo.config.ThresholdMs,
+		TargetPct:   slo.config.TargetPct,
+		Windows:     make([]SLOWindowStatus, 0, len(slo.config.Windows)),
+	}
+	for _, window := range slo.config.Windows {
+		ws := SLOWindowStatus{ShortMins: window.ShortMins, LongMins: window.LongMins, BurnRate: window.BurnRate}
+		ws.ShortBurnRate, ws.ShortRequests = slo.burnRate(window.ShortMins, minute)
+		ws.LongBurnRate, ws.LongRequests = slo.burnRate(window.LongMins, minute)
+		ws.Firing = ws.ShortRequests > 0 && ws.ShortBurnRate >= window.BurnRate && ws.LongBurnRate >= window.BurnRate
+		status.Firing = status.Firing || ws.Firing
+		status.Windows = append(status.Windows, ws)
+	}
+	return status
+}
+
+// Status returns every objective's current burn rates without touching alert state
+func (t *SLOTracker) Status(now time.Time) []SLOStatus {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	statuses := make([]SLOStatus, 0, len(t.slos))
+	for _, slo := range t.slos {
+		statuses = append(statuses, slo.status(now.Unix()/60))
+	}
+	return statuses
+}
+
+// Evaluate computes every objective's burn rates and returns them with the ones whose alert state changed
+func (t *SLOTracker) Evaluate(now time.Time) (statuses []SLOStatus, changed []SLOStatus) {
+	if t == nil {
+		return nil, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, slo := range t.slos {
+		status := slo.status(now.Unix() / 60)
+		statuses = append(statuses, status)
+		if status.Firing != slo.firing {
+			slo.firing = status.Firing
+			changed = append(changed, status)
+		}
+	}
+	return statuses, changed
+}
+
+// observeSLO records a request's latency from start for objectives of the given kind
+func (s *Server) observeSLO(kind string, start time.Time) {
+	if s.slos == nil {
+		return
+	}
+	now := time.Now()
+	s.slos.Observe(kind, now.Sub(start), now)
+}
+
+// runSLOAlerts exports burn rates and alerts when an objective starts or stops burning too fast
+func (s *Server) runSLOAlerts(ctx context.Context) {
+	ticker := time.NewTicker(sloCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkSLOs()
+		}
+	}
+}
+
+// checkSLOs evaluates every objective once; webhooks fire only on transitions
+func (s *Server) checkSLOs() {
+	now := time.Now()
+	statuses, changed := s.slos.Evaluate(now)
+	s.exporters.ExportPoints(sloPoints(statuses, now))
+
+	for _, status := range changed {
+		data := map[string]interface{}{
+			"slo":          status.Name,
+			"kind":         status.Kind,
+			"threshold_ms": status.ThresholdMs,
+			"target_pct":   status.TargetPct,
+			"windows":      status.Windows,
+		}
+		if status.Firing {
+			LogWarnWithData("Latency SLO burning error budget too fast", data)
+			s.emit("slo.alert", data)
+		} else {
+			LogInfoWithData("Latency SLO burn rate back within budget", data)
+			s.emit("slo.resolved", data)
+		}
+	}
+}
+
+// sloPoints renders per-window burn rates and alert state for the stats exporters
+func sloPoints(statuses []SLOStatus, ts time.Time) []statsPoint {
+	var points []statsPoint
+	for _, status := range statuses {
+		labels := []statsLabel{{"slo", status.Name}, {"kind", status.Kind}}
+		firing := 0.0
+		if status.Firing {
+			firing = 1
+		}
+		points = append(points, statsPoint{"opsen_slo", "firing", labels, firing, ts})
+		for _, window := range status.Windows {
+			windowLabels := append(labels[:len(labels):len(labels)], statsLabel{"window", fmt.Sprintf("%dm/%dm", window.ShortMins, window.LongMins)})
+			points = append(points,
+				statsPoint{"opsen_slo", "short_burn_rate", windowLabels, window.ShortBurnRate, ts},
+				statsPoint{"opsen_slo", "long_burn_rate", windowLabels, window.LongBurnRate, ts},
+			)
+		}
+	}
+	return points
+}
+
+// handleSLO handles GET /slo: burn rates and alert state of each latency objective
+func (s *Server) handleSLO(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.slos == nil {
+		http.Error(w, "No SLOs configured", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	statuses := s.slos.Status(now)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"slos":         statuses,
+		"evaluated_at": now,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode SLO status: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestSLOTracker_BurnRateAlert verifies an alert fires only while both windows burn fast and resolves once the short one recovers
+func TestSLOTracker_BurnRateAlert(t *testing.T) {
+	tracker := NewSLOTracker([]common.SLOConfig{{
+		Name: "route-p99", Kind: sloKindRoute, ThresholdMs: 5, TargetPct: 99,
+		Windows: []common.SLOWindowConfig{{ShortMins: 5, LongMins: 60, BurnRate: 14.4}},
+	}})
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	observe := func(n int, latency time.Duration, at time.Time) {
+		for i := 0; i < n; i++ {
+			tracker.Observe(sloKindRoute, latency, at)
+		}
+	}
+
+	observe(100, time.Millisecond, now)
+	tracker.Observe(sloKindProxyTTFB, time.Second, now) // Other kinds don't count
+	if statuses, changed := tracker.Evaluate(now); statuses[0].Firing || len(changed) != 0 || statuses[0].Windows[0].LongRequests != 100 {
+		t.Fatalf("Expected no alert for fast requests, got %+v", statuses)
+	}
+
+	observe(20, 50*time.Millisecond, now)
+	statuses, changed := tracker.Evaluate(now)
+	window := statuses[0].Windows[0]
+	if len(changed) != 1 || !changed[0].Firing || window.ShortBurnRate < 16.6 || window.ShortBurnRate > 16.7 {
+		t.Fatalf("Expected the alert to fire at a burn rate of ~16.7, got %+v", statuses)
+	}
+	if _, changed := tracker.Evaluate(now); len(changed) != 0 {
+		t.Error("Expected no second transition while still firing")
+	}
+
+	// Ten minutes on, the long window still holds the slow requests but the short one is clean
+	later := now.Add(10 * time.Minute)
+	observe(50, time.Millisecond, later)
+	statuses, changed = tracker.Evaluate(later)
+	if window := statuses[0].Windows[0]; len(changed) != 1 || changed[0].Firing || window.ShortBurnRate != 0 || window.LongRequests != 170 {
+		t.Errorf("Expected the alert to resolve, got %+v", statuses)
+	}
+
+	// Buckets older than the longest window are not counted
+	if statuses := tracker.Status(now.Add(2 * time.Hour)); statuses[0].Windows[0].LongRequests != 0 {
+		t.Errorf("Expected expired buckets to be ignored, got %+v", statuses)
+	}
+}
+
+// TestSLO_ObservesRouteAndProxyLatency verifies routing decisions and proxied responses are counted and reported by GET /slo
+func TestSLO_ObservesRouteAndProxyLatency(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+	}))
+	defer backend.Close()
+
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.SLOs = []common.SLOConfig{
+			{Name: "route", Kind: sloKindRoute, ThresholdMs: 1000, TargetPct: 99},
+			{Name: "ttfb", Kind: sloKindProxyTTFB, ThresholdMs: 10, TargetPct: 95},
+		}
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-a", Endpoint: backend.URL}))
+
+	body, _ := json.Marshal(common.RoutingRequest{Tier: "lite"})
+	rec := httptest.NewRecorder()
+	server.handleRoute(rec, httptest.NewRequest(http.MethodPost, "/route", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 from /route, got %d: %s", rec.Code, rec.Body.String())
+	}
+	proxy := httptest.NewServer(http.HandlerFunc(server.handleProxy))
+	defer proxy.Close()
+	resp, err := http.Get(proxy.URL + "/app")
+	if err != nil {
+		t.Fatalf("Proxy request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	rec = httptest.NewRecorder()
+	server.handleSLO(rec, httptest.NewRequest(http.MethodGet, "/slo", nil))
+	var status struct {
+		SLOs []SLOStatus `json:"slos"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(status.SLOs) != 2 || len(status.SLOs[0].Windows) != len(defaultSLOWindows) {
+		t.Fatalf("Expected both objectives with the default windows, got %+v", status.SLOs)
+	}
+	if route := status.SLOs[0].Windows[0]; route.ShortRequests != 1 || route.ShortBurnRate != 0 {
+		t.Errorf("Expected one fast routing decision, got %+v", route)
+	}
+	if ttfb := status.SLOs[1].Windows[0]; ttfb.ShortRequests != 1 || math.Abs(ttfb.ShortBurnRate-20) > 0.01 || !status.SLOs[1].Firing {
+		t.Errorf("Expected one slow proxied response burning at 20x, got %+v", status.SLOs[1])
+	}
+}
+
+// TestValidateSLOs verifies objectives need a name, a known kind, a threshold, a target below 100 and ordered windows
+func TestValidateSLOs(t *testing.T) {
+	valid := common.SLOConfig{Name: "route", Kind: sloKindRoute, ThresholdMs: 5, TargetPct: 99}
+	if err := validateSLOs([]common.SLOConfig{valid}); err != nil {
+		t.Errorf("Expected a valid objective, got %v", err)
+	}
+
+	for name, modify := range map[string]func(*common.SLOConfig){
+		"no name":       func(c *common.SLOConfig) { c.Name = "" },
+		"unknown kind":  func(c *common.SLOConfig) { c.Kind = "ttlb" },
+		"no threshold":  func(c *common.SLOConfig) { c.ThresholdMs = 0 },
+		"target of 100": func(c *common.SLOConfig) { c.TargetPct = 100 },
+		"short >= long": func(c *common.SLOConfig) {
+			c.Windows = []common.SLOWindowConfig{{ShortMins: 60, LongMins: 60, BurnRate: 2}}
+		},
+		"zero burn rate": func(c *common.SLOConfig) { c.Windows = []common.SLOWindowConfig{{ShortMins: 5, LongMins: 60}} },
+	} {
+		config := valid
+		modify(&config)
+		if err := validateSLOs([]common.SLOConfig{config}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if err := validateSLOs([]common.SLOConfig{valid, valid}); err == nil {
+		t.Error("Expected duplicate names to be rejected")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"maps"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// RoutingSnapshot is an immutable copy of the fleet that placements score without holding s.mu,
+// so /route and /proxy do not contend with /stats ingestion and health checks for the lock.
+// Registrations, stats, health checks and admin changes invalidate it and the next placement
+// rebuilds it. Pending reservations change with every placement and are not part of it: the
+// scored candidates are confirmed against live state, in order, under a short read lock.
+type RoutingSnapshot struct {
+	backends []routingBackend
+}
+
+// routingBackend is one backend as the scoring loop sees it
+type routingBackend struct {
+	client   *ClientState    // Private copy; never mutated after the snapshot is built
+	headroom backendHeadroom // Reported availability after admin reservations and capacity overrides
+}
+
+// routingSnapshots holds the current snapshot and rebuilds it on demand
+type routingSnapshots struct {
+	current atomic.Pointer[RoutingSnapshot]
+	dirty   atomic.Bool
+	rebuild sync.Mutex // One rebuild at a time; concurrent placements wait for it instead of copying too
+}
+
+// scoredBackend is a placement candidate from the snapshot
+type scoredBackend struct {
+	client *ClientState
+	score  float64 // Placement score (lower is better)
+	weight uint64  // Rendezvous weight in hash sticky mode (higher is better)
+}
+
+// invalidateRoutingSnapshot marks the snapshot outdated after a change to backend state
+func (s *Server) invalidateRoutingSnapshot() {
+	s.routing.dirty.Store(true)
+}
+
+// routingSnapshot returns the current snapshot, rebuilding it if backend state changed since it was taken
+func (s *Server) routingSnapshot() *RoutingSnapshot {
+	if snapshot := s.routing.current.Load(); snapshot != nil && !s.routing.dirty.Load() {
+		return snapshot
+	}
+
+	s.routing.rebuild.Lock()
+	defer s.routing.rebuild.Unlock()
+	if snapshot := s.routing.current.Load(); snapshot != nil && !s.routing.dirty.Load() {
+		return snapshot
+	}
+
+	// Clear first: a change made while copying marks the new snapshot outdated again
+	s.routing.dirty.Store(false)
+
+	s.mu.RLock()
+	snapshot := &RoutingSnapshot{backends: make([]routingBackend, 0, len(s.clientCache))}
+	for _, client := range s.clientCache {
+		snapshot.backends = append(snapshot.backends, routingBackend{
+			client:   client.routingCopy(),
+			headroom: s.backendHeadroomLocked(client),
+		})
+	}
+	s.mu.RUnlock()
+
+	s.routing.current.Store(snapshot)
+	return snapshot
+}
+
+// routingCopy returns a copy of a backend's state that later updates do not touch
+// Updates replace slices and nested structs wholesale; maps updated in place are cloned
+func (c *ClientState) routingCopy() *ClientState {
+	copied := *c
+	copied.VantageLatencies = maps.Clone(c.VantageLatencies)
+	return &copied
+}
+
+// routable reports whether a snapshot backend is live and healthy
+func (s *Server) routable(client *ClientState) bool {
+	if s.isStale(client) || s.awaitingApproval(client) {
+		return false
+	}
+	return !s.config.HealthCheckEnabled || client.HealthStatus != "unhealthy"
+}
+
+// fitsSnapshot checks a snapshot backend against a tier, counting the indexed pending reservations
+// A backend failing here cannot fit live either: the index is updated under s.mu whenever allocations
+// change and is ignored once a lease in it expires, so it never counts more than is reserved
+func (s *Server) fitsSnapshot(backend routingBackend, tier common.TierSpec) bool {
+	if !s.routable(backend.client) {
+		return false
+	}
+	// New placements spill past backends at their proxy in-flight limit
+	if s.concurrency.Full(backend.client.Registration.ClientID) {
+		return false
+	}
+	reserved := s.reservations.get(backend.client.Registration.ClientID, time.Now())
+	headroom := s.withTierCPU(withTierMemory(backend.headroom, backend.client, tier), backend.client, tier)
+	return s.fitsTier(backend.client, tier, headroom, reserved)
+}
+
+// sortCandidates orders placement candidates by score (lower is better)
+func sortCandidates(candidates []scoredBackend) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score < candidates[j].score
+	})
+}
+
+// firstLiveFit returns the live state of the first candidate that still fits the tier once
+// pending reservations are counted, or nil. With admit, outlier re-admission ramps and half-open
+// circuit trials apply too
+func (s *Server) firstLiveFit(candidates []scoredBackend, tier common.TierSpec, admit bool) *ClientState {
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, candidate := range candidates {
+		client, ok := s.clientCache[candidate.client.Registration.ClientID]
+		if !ok || !s.routable(client) || !s.hasResourcesLocked(client, tier) {
+			continue
+		}
+		if admit && (!s.outliers.Admit(client.Registration.ClientID) || !s.breakers.Admit(client.Registration.ClientID)) {
+			continue
+		}
+		return client
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestRoutingSnapshot_RebuiltOnStats verifies placements score a stable copy of the fleet that a stats report replaces
+func TestRoutingSnapshot_RebuiltOnStats(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "a", CPUUsageAvg: []float64{10, 10, 10, 10, 10, 10, 10, 10}}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "b", CPUUsageAvg: []float64{40, 40, 40, 40, 40, 40, 40, 40}}))
+
+	tier := server.tierSpecs["lite"]
+	AssertClientSelected(t, server.findBestClient(tier, 0, 0), "a")
+
+	snapshot := server.routingSnapshot()
+	if server.routingSnapshot() != snapshot {
+		t.Fatal("Expected the snapshot to be reused while backend state is unchanged")
+	}
+
+	// The returned backend is the live state, not the snapshot's copy
+	server.mu.RLock()
+	live := server.clientCache["a"]
+	server.mu.RUnlock()
+	if client := server.findBestClient(tier, 0, 0); client != live {
+		t.Error("Expected the placement to return the live backend state")
+	}
+
+	stats := common.ResourceStats{
+		ClientID:    "a",
+		CPUCores:    8,
+		CPUUsageAvg: []float64{70, 70, 70, 70, 70, 70, 70, 70},
+		MemoryTotal: 32, MemoryUsed: 8, MemoryAvail: 24,
+		DiskTotal: 500, DiskUsed: 100, DiskAvail: 400,
+		Timestamp: time.Now(),
+	}
+	body, _ := json.Marshal(stats)
+	rec := httptest.NewRecorder()
+	server.handleStats(rec, httptest.NewRequest("POST", "/stats", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected stats to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if server.routingSnapshot() == snapshot {
+		t.Error("Expected a stats report to replace the snapshot")
+	}
+	AssertClientSelected(t, server.findBestClient(tier, 0, 0), "b")
+}
+
+// TestRoutingSnapshot_PendingReservationsLive verifies reservations made after the snapshot was taken still
+// keep a full backend from being chosen
+func TestRoutingSnapshot_PendingReservationsLive(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "a", TotalCPU: 2, CPUUsageAvg: []float64{5, 5}}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "b", TotalCPU: 2, CPUUsageAvg: []float64{50, 50}}))
+
+	tier := server.tierSpecs["pro-standard"]
+	snapshot := server.routingSnapshot()
+
+	AssertClientSelected(t, server.selectClientWithStickiness("", "pro-standard", tier, 0, 0, "req-1"), "a")
+	AssertClientSelected(t, server.selectClientWithStickiness("", "pro-standard", tier, 0, 0, "req-2"), "b")
+	if client := server.selectClientWithStickiness("", "pro-standard", tier, 0, 0, "req-3"); client != nil {
+		t.Errorf("Expected no capacity left, got %s", client.Registration.ClientID)
+	}
+	if server.routingSnapshot() != snapshot {
+		t.Error("Expected reservations not to rebuild the snapshot")
+	}
+}
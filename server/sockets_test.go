@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestSocketVeto_SkipsExhaustedBackend verifies backends out of ports or file descriptors are skipped
+// even when their CPU is idle
+func TestSocketVeto_SkipsExhaustedBackend(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.FDVetoPct = 90
+		c.EphemeralPortVetoPct = 85
+		c.TCPConnectionsVeto = 50000
+	})
+
+	noPorts := NewMockClient(MockClientOptions{ClientID: "no-ports", CPUUsageAvg: []float64{5, 5, 5, 5}})
+	noPorts.Stats.Sockets = &common.SocketStats{OpenFDs: 1000, MaxFDs: 100000, EphemeralPortsUsed: 27000, EphemeralPortsTotal: 28232}
+	server.AddMockClient(noPorts)
+
+	noFDs := NewMockClient(MockClientOptions{ClientID: "no-fds", CPUUsageAvg: []float64{5, 5, 5, 5}})
+	noFDs.Stats.Sockets = &common.SocketStats{OpenFDs: 95000, MaxFDs: 100000}
+	server.AddMockClient(noFDs)
+
+	busy := NewMockClient(MockClientOptions{ClientID: "busy", CPUUsageAvg: []float64{50, 50, 50, 50}})
+	busy.Stats.Sockets = &common.SocketStats{OpenFDs: 1000, MaxFDs: 100000, TCPConnections: 800, EphemeralPortsUsed: 500, EphemeralPortsTotal: 28232}
+	server.AddMockClient(busy)
+
+	client := server.findBestClient(server.tierSpecs["lite"], 0, 0)
+	AssertClientSelected(t, client, "busy")
+
+	busy.Stats.Sockets.TCPConnections = 60000
+	if server.hasResources(busy, server.tierSpecs["lite"]) {
+		t.Error("Expected a backend above tcp_connections_veto to be skipped")
+	}
+}
+
+// TestSocketVeto_DisabledByDefault verifies socket usage is ignored without thresholds
+func TestSocketVeto_DisabledByDefault(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+
+	client := NewMockClient(MockClientOptions{ClientID: "exhausted"})
+	client.Stats.Sockets = &common.SocketStats{OpenFDs: 100, MaxFDs: 100, EphemeralPortsUsed: 10, EphemeralPortsTotal: 10}
+	server.AddMockClient(client)
+
+	if !server.hasResources(client, server.tierSpecs["lite"]) {
+		t.Error("Expected socket usage to be ignored when no veto thresholds are configured")
+	}
+}
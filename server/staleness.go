@@ -0,0 +1,26 @@
+package main
+
+import "time"
+
+// defaultStaleMissedReports applies when stale_missed_reports is not set
+const defaultStaleMissedReports = 3
+
+// staleTimeoutFor is how long a backend may go without reporting before it leaves routing:
+// stale_missed_reports of the report interval it declared at registration, or stale_minutes
+// for agents that declare none
+func (s *Server) staleTimeoutFor(client *ClientState) time.Duration {
+	interval := client.Registration.ReportIntervalSecs
+	if interval <= 0 {
+		return s.staleTimeout
+	}
+	missed := s.config.StaleMissedReports
+	if missed <= 0 {
+		missed = defaultStaleMissedReports
+	}
+	return time.Duration(interval*missed) * time.Second
+}
+
+// isStale reports whether a backend has missed too many reports to be routed to
+func (s *Server) isStale(client *ClientState) bool {
+	return time.Since(client.LastSeen) > s.staleTimeoutFor(client)
+}
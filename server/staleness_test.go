@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestStaleness_PerClientInterval verifies each backend goes stale after missing its own reports,
+// and backends without a declared interval fall back to stale_minutes
+func TestStaleness_PerClientInterval(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	fast := NewMockClient(MockClientOptions{ClientID: "fast", CPUUsageAvg: []float64{5, 5, 5, 5, 5, 5, 5, 5}, LastSeen: time.Now().Add(-20 * time.Second)})
+	fast.Registration.ReportIntervalSecs = 5
+	slow := NewMockClient(MockClientOptions{ClientID: "slow", CPUUsageAvg: []float64{20, 20, 20, 20, 20, 20, 20, 20}, LastSeen: time.Now().Add(-2 * time.Minute)})
+	slow.Registration.ReportIntervalSecs = 60
+	legacy := NewMockClient(MockClientOptions{ClientID: "legacy", CPUUsageAvg: []float64{50, 50, 50, 50, 50, 50, 50, 50}, LastSeen: time.Now().Add(-4 * time.Minute)})
+	for _, client := range []*ClientState{fast, slow, legacy} {
+		server.AddMockClient(client)
+	}
+
+	if got := server.staleTimeoutFor(fast); got != 15*time.Second {
+		t.Errorf("Expected 3 x 5s for the fast reporter, got %s", got)
+	}
+	if !server.isStale(fast) {
+		t.Error("Expected the fast reporter to be stale after missing 3 reports")
+	}
+	if server.isStale(slow) {
+		t.Error("Expected the slow reporter to be live within 3 x 60s")
+	}
+	if server.isStale(legacy) {
+		t.Error("Expected the backend without an interval to use stale_minutes")
+	}
+
+	// The least loaded backend is stale and left out of placements
+	AssertClientSelected(t, server.findBestClient(server.tierSpecs["lite"], 0, 0), "slow")
+
+	ids, _ := server.deregisterStaleClients(1, "purged", false)
+	if len(ids) != 1 || ids[0] != "fast" {
+		t.Errorf("Expected only the fast reporter to be purged, got %v", ids)
+	}
+}
+
+// TestStaleness_IntervalPersisted verifies the declared interval survives a server restart and is validated
+func TestStaleness_IntervalPersisted(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServerWithConfig(t, db, func(cfg *common.ServerConfig) {
+		cfg.StaleMissedReports = 4
+	})
+
+	reg := common.ClientRegistration{ClientID: "gpu-01", EndpointURL: "http://10.0.0.1:11000", ReportIntervalSecs: 10}
+	if rec := postRegistration(server, reg); rec.Code != http.StatusOK {
+		t.Fatalf("Expected registration to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	restarted := NewTestServerWithConfig(t, db, func(cfg *common.ServerConfig) {
+		cfg.StaleMissedReports = 4
+	})
+	if err := restarted.loadClients(); err != nil {
+		t.Fatalf("Failed to load clients: %v", err)
+	}
+	restarted.mu.RLock()
+	client := restarted.clientCache["gpu-01"]
+	restarted.mu.RUnlock()
+	if client == nil || client.Registration.ReportIntervalSecs != 10 {
+		t.Fatalf("Expected the report interval to be loaded, got %+v", client)
+	}
+	if got := restarted.staleTimeoutFor(client); got != 40*time.Second {
+		t.Errorf("Expected 4 x 10s, got %s", got)
+	}
+
+	reg.ReportIntervalSecs = -1
+	if rec := postRegistration(server, reg); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a negative interval, got %d", rec.Code)
+	}
+}
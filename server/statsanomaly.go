@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+const (
+	// statsUsageTolerance absorbs rounding in used/total pairs converted to GB (fraction of total)
+	statsUsageTolerance = 0.01
+	// maxCoreUsagePct allows per-core averages slightly above 100% from sampling jitter
+	maxCoreUsagePct = 101.0
+)
+
+// StatsQuarantine returns why a backend is quarantined for implausible stats, or "" if it is not
+func (c *ClientState) StatsQuarantine(now time.Time) string {
+	if c.StatsAnomaly != "" && now.Before(c.StatsAnomalyUntil) {
+		return c.StatsAnomaly
+	}
+	return ""
+}
+
+// statsAnomalies lists what cannot be right about a report, given the backend's previous one
+func statsAnomalies(prev, cur common.ResourceStats, now time.Time, maxSkew time.Duration) []string {
+	var reasons []string
+
+	if cur.MemoryUsed < 0 || cur.MemoryAvail < 0 || cur.DiskUsed < 0 || cur.DiskAvail < 0 {
+		reasons = append(reasons, "negative memory or disk values")
+	}
+	if cur.MemoryTotal > 0 && cur.MemoryUsed > cur.MemoryTotal*(1+statsUsageTolerance) {
+		reasons = append(reasons, fmt.Sprintf("memory used %.1f GB exceeds total %.1f GB", cur.MemoryUsed, cur.MemoryTotal))
+	}
+	if cur.MemoryTotal > 0 && cur.MemoryAvail > cur.MemoryTotal*(1+statsUsageTolerance) {
+		reasons = append(reasons, fmt.Sprintf("memory available %.1f GB exceeds total %.1f GB", cur.MemoryAvail, cur.MemoryTotal))
+	}
+	if cur.DiskTotal > 0 && cur.DiskUsed > cur.DiskTotal*(1+statsUsageTolerance) {
+		reasons = append(reasons, fmt.Sprintf("disk used %.1f GB exceeds total %.1f GB", cur.DiskUsed, cur.DiskTotal))
+	}
+
+	for i, usage := range cur.CPUUsageAvg {
+		if usage < 0 || usage > maxCoreUsagePct {
+			reasons = append(reasons, fmt.Sprintf("core %d usage %.1f%% out of range", i, usage))
+			break
+		}
+	}
+	// Cores do not disappear while an agent stays registered; re-registration starts a fresh history
+	if len(cur.CPUUsageAvg) < len(prev.CPUUsageAvg) {
+		reasons = append(reasons, fmt.Sprintf("CPU array shrank from %d to %d cores", len(prev.CPUUsageAvg), len(cur.CPUUsageAvg)))
+	}
+
+	if maxSkew > 0 && cur.Timestamp.After(now.Add(maxSkew)) {
+		reasons = append(reasons, fmt.Sprintf("timestamp %s is %s in the future",
+			cur.Timestamp.UTC().Format(time.RFC3339), cur.Timestamp.Sub(now).Round(time.Second)))
+	}
+	return reasons
+}
+
+// statsFrozen reports whether a newer report carries exactly the previous report's measurements
+// Live hosts never repeat per-core averages to the last digit; a hung collector does
+func statsFrozen(prev, cur common.ResourceStats) bool {
+	return len(cur.CPUUsageAvg) > 0 &&
+		!cur.Timestamp.Equal(prev.Timestamp) &&
+		slices.Equal(cur.CPUUsageAvg, prev.CPUUsageAvg) &&
+		cur.MemoryUsed == prev.MemoryUsed &&
+		cur.MemoryAvail == prev.MemoryAvail &&
+		cur.DiskUsed == prev.DiskUsed &&
+		cur.LoadAvg1 == prev.LoadAvg1
+}
+
+// checkStatsAnomalyLocked quarantines a backend whose new report is implausible
+// Must be called with s.mu held, before the report replaces client.Stats
+func (s *Server) checkStatsAnomalyLocked(client *ClientState, stats common.ResourceStats, now time.Time) {
+	cfg := s.config.StatsAnomaly
+	if !cfg.Enabled {
+		return
+	}
+
+	reasons := statsAnomalies(client.Stats, stats, now, time.Duration(cfg.MaxClockSkewSecs)*time.Second)
+	if cfg.FrozenReports > 0 {
+		if statsFrozen(client.Stats, stats) {
+			client.frozenReports++
+		} else {
+			client.frozenReports = 0
+		}
+		if client.frozenReports >= cfg.FrozenReports {
+			reasons = append(reasons, fmt.Sprintf("stats unchanged for %d consecutive reports", client.frozenReports+1))
+		}
+	}
+	if len(reasons) == 0 {
+		return
+	}
+
+	wasQuarantined := client.StatsQuarantine(now) != ""
+	client.StatsAnomaly = strings.Join(reasons, "; ")
+	client.StatsAnomalyUntil = now.Add(time.Duration(cfg.QuarantineSecs) * time.Second)
+
+	if !wasQuarantined {
+		LogWarnWithData("Backend quarantined for implausible stats", map[string]interface{}{
+			"client_id": client.Registration.ClientID,
+			"reason":    client.StatsAnomaly,
+			"until":     client.StatsAnomalyUntil,
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+func newAnomalyTestServer(t *testing.T) (*Server, *ClientState, func()) {
+	t.Helper()
+	db, cleanup := CreateTestDB(t)
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.StatsAnomaly = common.StatsAnomalyConfig{
+			Enabled:          true,
+			QuarantineSecs:   300,
+			MaxClockSkewSecs: 300,
+			FrozenReports:    3,
+		}
+	})
+	client := NewMockClient(MockClientOptions{ClientID: "backend-1"})
+	server.AddMockClient(client)
+	return server, client, cleanup
+}
+
+func postAnomalyStats(t *testing.T, server *Server, stats common.ResourceStats) {
+	t.Helper()
+	body, _ := json.Marshal(stats)
+	rec := httptest.NewRecorder()
+	server.handleStats(rec, httptest.NewRequest("POST", "/stats", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected stats to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func plausibleStats(now time.Time, cpu float64) common.ResourceStats {
+	return common.ResourceStats{
+		ClientID:    "backend-1",
+		Timestamp:   now,
+		CPUCores:    8,
+		CPUUsageAvg: []float64{cpu, 10, 10, 10, 10, 10, 10, 10},
+		MemoryTotal: 32,
+		MemoryUsed:  8,
+		MemoryAvail: 24,
+		DiskTotal:   500,
+		DiskUsed:    100,
+		DiskAvail:   400,
+	}
+}
+
+// TestStatsAnomaly_Quarantine verifies each kind of implausible report keeps the backend out of routing
+func TestStatsAnomaly_Quarantine(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(stats *common.ResourceStats)
+		reason string
+	}{
+		{"memory used above total", func(s *common.ResourceStats) { s.MemoryUsed = 64 }, "memory used"},
+		{"disk used above total", func(s *common.ResourceStats) { s.DiskUsed = 900 }, "disk used"},
+		{"CPU array shrinks", func(s *common.ResourceStats) { s.CPUUsageAvg = s.CPUUsageAvg[:2] }, "CPU array shrank"},
+		{"core usage out of range", func(s *common.ResourceStats) { s.CPUUsageAvg[1] = 250 }, "out of range"},
+		{"timestamp in the future", func(s *common.ResourceStats) { s.Timestamp = s.Timestamp.Add(time.Hour) }, "in the future"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client, cleanup := newAnomalyTestServer(t)
+			defer cleanup()
+
+			now := time.Now()
+			postAnomalyStats(t, server, plausibleStats(now, 20))
+			if !server.hasResources(client, server.tierSpecs["lite"]) {
+				t.Fatal("Expected a backend with plausible stats to be routable")
+			}
+
+			stats := plausibleStats(now.Add(time.Second), 21)
+			tt.mutate(&stats)
+			postAnomalyStats(t, server, stats)
+
+			reason := client.StatsQuarantine(time.Now())
+			if !strings.Contains(reason, tt.reason) {
+				t.Errorf("Expected quarantine reason containing %q, got %q", tt.reason, reason)
+			}
+			if server.hasResources(client, server.tierSpecs["lite"]) {
+				t.Error("Expected a quarantined backend to be skipped")
+			}
+		})
+	}
+}
+
+// TestStatsAnomaly_FrozenValues verifies identical measurements across reports are flagged
+func TestStatsAnomaly_FrozenValues(t *testing.T) {
+	server, client, cleanup := newAnomalyTestServer(t)
+	defer cleanup()
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		postAnomalyStats(t, server, plausibleStats(now.Add(time.Duration(i)*time.Minute), 20))
+	}
+	if reason := client.StatsQuarantine(time.Now()); reason != "" {
+		t.Fatalf("Expected no quarantine below frozen_reports, got %q", reason)
+	}
+
+	postAnomalyStats(t, server, plausibleStats(now.Add(3*time.Minute), 20))
+	if reason := client.StatsQuarantine(time.Now()); !strings.Contains(reason, "unchanged") {
+		t.Fatalf("Expected frozen stats to quarantine the backend, got %q", reason)
+	}
+
+	// Moving values do not lift the quarantine early; it expires after quarantine_seconds
+	postAnomalyStats(t, server, plausibleStats(now.Add(4*time.Minute), 35))
+	if client.StatsQuarantine(time.Now()) == "" {
+		t.Error("Expected the quarantine to last until it expires")
+	}
+	if client.StatsQuarantine(time.Now().Add(301*time.Second)) != "" {
+		t.Error("Expected the quarantine to expire after quarantine_seconds")
+	}
+}
+
+// TestStatsAnomaly_Disabled verifies implausible stats are accepted as-is when detection is off
+func TestStatsAnomaly_Disabled(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	client := NewMockClient(MockClientOptions{ClientID: "backend-1"})
+	server.AddMockClient(client)
+
+	stats := plausibleStats(time.Now(), 20)
+	stats.MemoryUsed = 64
+	postAnomalyStats(t, server, stats)
+
+	if reason := client.StatsQuarantine(time.Now()); reason != "" {
+		t.Errorf("Expected no quarantine with stats_anomaly disabled, got %q", reason)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// maxStatsBatchReports caps the reports accepted in one POST /stats/batch
+const maxStatsBatchReports = 500
+
+// handleStatsBatch accepts reports an agent spooled while the server was unreachable
+// Reports are stored and exported like /stats, but only one newer than the cached report
+// updates routing state; replayed history never overrides what the agent reported live
+func (s *Server) handleStatsBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var batch common.StatsBatch
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON body: %v. Expected {\"reports\": [ResourceStats...]}.", err), http.StatusBadRequest)
+		return
+	}
+	if len(batch.Reports) > maxStatsBatchReports {
+		http.Error(w, fmt.Sprintf("Too many reports in batch: %d (max %d)", len(batch.Reports), maxStatsBatchReports), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	keyTenant, scoped := tenantFromContext(r)
+	accepted, rejected := 0, 0
+	for _, stats := range batch.Reports {
+		// Spooled reports are full snapshots; a delta has no base to apply to out of order
+		if stats.ClientID == "" || stats.Delta {
+			rejected++
+			continue
+		}
+		schemaVersion, err := common.NegotiateSchemaVersion(stats.SchemaVersion)
+		if err != nil {
+			rejected++
+			continue
+		}
+		stats.SchemaVersion = schemaVersion
+
+		s.mu.Lock()
+		s.invalidateRoutingSnapshot()
+		client, ok := s.clientCache[stats.ClientID]
+		if ok && scoped && normalizeTenant(client.Registration.Tenant) != keyTenant {
+			s.mu.Unlock()
+			http.Error(w, fmt.Sprintf("API key cannot report stats for client: %s", stats.ClientID), http.StatusForbidden)
+			return
+		}
+		if ok && stats.InstanceID != "" && client.Registration.InstanceID != "" && stats.InstanceID != client.Registration.InstanceID {
+			s.mu.Unlock()
+			w.Header().Set(LBErrorCodeHeader, errCodeDuplicateClientID)
+			http.Error(w, fmt.Sprintf("Client ID %s is registered by another agent instance", stats.ClientID), http.StatusConflict)
+			return
+		}
+		raw := stats
+		if _, invalid := s.checkStatsLocked(client, &stats, time.Now()); invalid {
+			s.mu.Unlock()
+			rejected++
+			continue
+		}
+		tenant, updated := "", false
+		if ok {
+			tenant = client.Registration.Tenant
+			if stats.Timestamp.After(client.Stats.Timestamp) {
+				s.checkStatsAnomalyLocked(client, raw, time.Now())
+				client.Stats = stats
+				s.updateGPUFaultLocked(client, stats.GPUs, time.Now())
+				updated = true
+			}
+		}
+		s.mu.Unlock()
+		if updated {
+			s.routeCache.Invalidate(stats.ClientID)
+		}
+
+		s.exporters.Export(stats, tenant)
+		s.persistStats(stats)
+		accepted++
+	}
+	LogDebugWithData("Stats batch received", map[string]interface{}{
+		"accepted": accepted,
+		"rejected": rejected,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "received",
+		"accepted": accepted,
+		"rejected": rejected,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode stats batch response: %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestStatsBatch_PersistsHistoryWithoutOverridingLiveStats verifies replayed reports are stored but older ones leave routing state alone
+func TestStatsBatch_PersistsHistoryWithoutOverridingLiveStats(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	live := NewMockClient(MockClientOptions{ClientID: "backend"})
+	live.Stats.Timestamp = time.Now()
+	live.Stats.CPUCores = 8
+	server.AddMockClient(live)
+
+	batch := common.StatsBatch{Reports: []common.ResourceStats{
+		{ClientID: "backend", Timestamp: time.Now().Add(-3 * time.Minute), CPUCores: 2},
+		{ClientID: "backend", Timestamp: time.Now().Add(-2 * time.Minute), CPUCores: 2},
+		{ClientID: "backend", Timestamp: time.Now().Add(-time.Minute), CPUCores: 2, Delta: true},
+	}}
+	body, _ := json.Marshal(batch)
+	rec := httptest.NewRecorder()
+	server.handleStatsBatch(rec, httptest.NewRequest("POST", "/stats/batch", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected batch to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp["accepted"] != 2.0 || resp["rejected"] != 1.0 {
+		t.Errorf("Expected 2 accepted and 1 rejected (delta), got %v", resp)
+	}
+	if count := countStatsRows(t, db, "backend"); count != 2 {
+		t.Errorf("Expected 2 replayed rows stored, got %d", count)
+	}
+
+	server.mu.RLock()
+	cores := server.clientCache["backend"].Stats.CPUCores
+	server.mu.RUnlock()
+	if cores != 8 {
+		t.Errorf("Expected older replayed reports not to replace live stats, got %d cores", cores)
+	}
+}
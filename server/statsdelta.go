@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+
+	"cyqle.in/opsen/common"
+)
+
+// mergeStatsDelta applies a delta stats report on top of the previous report
+// Fields present in the delta replace the base (null clears them); missing fields carry over
+func mergeStatsDelta(base common.ResourceStats, delta []byte) (common.ResourceStats, error) {
+	var merged common.ResourceStats
+
+	baseJSON, err := json.Marshal(base)
+	if err != nil {
+		return merged, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(baseJSON, &fields); err != nil {
+		return merged, err
+	}
+
+	var changes map[string]json.RawMessage
+	if err := json.Unmarshal(delta, &changes); err != nil {
+		return merged, err
+	}
+	for key, value := range changes {
+		fields[key] = value
+	}
+	delete(fields, "delta")
+	delete(fields, "base_seq")
+
+	mergedJSON, err := json.Marshal(fields)
+	if err != nil {
+		return merged, err
+	}
+	err = json.Unmarshal(mergedJSON, &merged)
+	return merged, err
+}
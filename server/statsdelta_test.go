@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestHandleStats_Delta verifies delta reports merge onto the previous report and mismatched bases are refused
+func TestHandleStats_Delta(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "delta-client"}))
+
+	post := func(payload interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		rec := httptest.NewRecorder()
+		server.handleStats(rec, httptest.NewRequest("POST", "/stats", bytes.NewReader(body)))
+		return rec
+	}
+
+	rec := post(common.ResourceStats{
+		ClientID:    "delta-client",
+		Seq:         1,
+		Timestamp:   time.Now(),
+		CPUCores:    4,
+		CPUUsageAvg: []float64{10, 20, 30, 40},
+		MemoryTotal: 16,
+		MemoryUsed:  4,
+		GPUs:        []common.GPUStats{{DeviceID: 0, UtilizationPct: 50}},
+	})
+	var resp map[string]string
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || resp["stats_delta"] != common.StatsDeltaSupported {
+		t.Fatalf("Expected full report to be accepted with delta support advertised, got %d %v", rec.Code, resp)
+	}
+
+	rec = post(map[string]interface{}{
+		"client_id": "delta-client", "seq": 2, "base_seq": 1, "delta": true,
+		"memory_used_gb": 6.5, "gpus": nil,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected delta to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	stats := server.clientCache["delta-client"].Stats
+	if stats.MemoryUsed != 6.5 || stats.MemoryTotal != 16 || len(stats.CPUUsageAvg) != 4 || stats.Seq != 2 {
+		t.Errorf("Expected changed fields applied and the rest carried over, got %+v", stats)
+	}
+	if len(stats.GPUs) != 0 {
+		t.Errorf("Expected null to clear GPUs, got %+v", stats.GPUs)
+	}
+	if stats.Delta || stats.BaseSeq != 0 {
+		t.Error("Expected merged stats to be stored as a full report")
+	}
+
+	rec = post(map[string]interface{}{"client_id": "delta-client", "seq": 3, "base_seq": 1, "delta": true})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a stale delta base, got %d", rec.Code)
+	}
+	rec = post(map[string]interface{}{"client_id": "unknown", "seq": 2, "base_seq": 1, "delta": true})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a delta from an unknown client, got %d", rec.Code)
+	}
+}
+
+// TestDecompressRequest verifies gzip bodies are decoded and oversized or unknown encodings rejected
+func TestDecompressRequest(t *testing.T) {
+	var received string
+	handler := DecompressRequest(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := new(bytes.Buffer)
+		if _, err := data.ReadFrom(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		received = data.String()
+	}))
+
+	compress := func(s string) *bytes.Buffer {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(s))
+		gz.Close()
+		return &buf
+	}
+
+	req := httptest.NewRequest("POST", "/stats", compress(`{"client_id":"a"}`))
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || received != `{"client_id":"a"}` {
+		t.Errorf("Expected decompressed body, got %d %q", rec.Code, received)
+	}
+
+	req = httptest.NewRequest("POST", "/stats", compress(strings.Repeat("a", 4096)))
+	req.Header.Set("Content-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected decompressed size limit to apply, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/stats", strings.NewReader("{}"))
+	req.Header.Set("Content-Encoding", "br")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for unsupported encoding, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// statsLabel is a Prometheus label or InfluxDB tag
+type statsLabel struct {
+	name  string
+	value string
+}
+
+// statsPoint is one value from a client stats report
+// Prometheus series are named <measurement>_<field>; InfluxDB lines group fields by measurement and tags
+type statsPoint struct {
+	measurement string
+	field       string
+	labels      []statsLabel
+	value       float64
+	timestamp   time.Time
+}
+
+// statsPoints flattens a stats report into per-core CPU, memory, disk, swap, load, per-device disk I/O and per-GPU points
+func statsPoints(stats common.ResourceStats, tenant string, extra map[string]string) []statsPoint {
+	ts := stats.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	base := []statsLabel{{"client_id", stats.ClientID}, {"tenant", normalizeTenant(tenant)}}
+	if stats.Hostname != "" {
+		base = append(base, statsLabel{"hostname", stats.Hostname})
+	}
+	for name, value := range extra {
+		base = append(base, statsLabel{name, value})
+	}
+	with := func(labels ...statsLabel) []statsLabel {
+		return append(append(make([]statsLabel, 0, len(base)+len(labels)), base...), labels...)
+	}
+
+	var points []statsPoint
+	add := func(measurement, field string, labels []statsLabel, value float64) {
+		points = append(points, statsPoint{measurement, field, labels, value, ts})
+	}
+
+	add("opsen_cpu", "cores", base, float64(stats.CPUCores))
+	for i, usage := range stats.CPUUsageAvg {
+		core := with(statsLabel{"core", strconv.Itoa(i)})
+		add("opsen_cpu_core", "usage_percent", core, usage)
+		if i < len(stats.CPUUsageP95) {
+			add("opsen_cpu_core", "usage_p95_percent", core, stats.CPUUsageP95[i])
+		}
+	}
+
+	add("opsen_memory", "total_gb", base, stats.MemoryTotal)
+	add("opsen_memory", "used_gb", base, stats.MemoryUsed)
+	add("opsen_memory", "avail_gb", base, stats.MemoryAvail)
+	if memory := stats.Memory; memory != nil {
+		add("opsen_memory", "free_gb", base, memory.FreeGB)
+		add("opsen_memory", "buffers_gb", base, memory.BuffersGB)
+		add("opsen_memory", "cached_gb", base, memory.CachedGB)
+		add("opsen_memory", "available_gb", base, memory.AvailableGB)
+		add("opsen_memory", "committed_gb", base, memory.CommittedGB)
+		add("opsen_memory", "commit_limit_gb", base, memory.CommitLimitGB)
+	}
+
+	add("opsen_disk", "total_gb", base, stats.DiskTotal)
+	add("opsen_disk", "used_gb", base, stats.DiskUsed)
+	add("opsen_disk", "avail_gb", base, stats.DiskAvail)
+
+	add("opsen_swap", "total_gb", base, stats.SwapTotal)
+	add("opsen_swap", "used_gb", base, stats.SwapUsed)
+
+	add("opsen_load", "avg_1", base, stats.LoadAvg1)
+	add("opsen_load", "avg_5", base, stats.LoadAvg5)
+	add("opsen_load", "avg_15", base, stats.LoadAvg15)
+
+	if thermal := stats.Thermal; thermal != nil {
+		add("opsen_thermal", "cpu_temp_c", base, thermal.CPUTempC)
+		add("opsen_thermal", "cpu_throttle_events", base, float64(thermal.CPUThrottleEvents))
+		if thermal.CPUPowerW > 0 {
+			add("opsen_thermal", "cpu_power_w", base, thermal.CPUPowerW)
+		}
+		if thermal.ChassisPowerW > 0 {
+			add("opsen_thermal", "chassis_power_w", base, thermal.ChassisPowerW)
+		}
+		for _, fan := range thermal.Fans {
+			add("opsen_fan", "rpm", with(statsLabel{"fan", fan.Name}), fan.RPM)
+		}
+	}
+
+	if inventory := stats.Inventory; inventory != nil {
+		labels := with(statsLabel{"runtime", inventory.Runtime})
+		add("opsen_inventory", "workloads", labels, float64(inventory.Total))
+		add("opsen_inventory", "running", labels, float64(inventory.Running))
+		add("opsen_inventory", "vcpu_limit", labels, inventory.VCPULimit)
+		add("opsen_inventory", "memory_limit_gb", labels, inventory.MemoryLimitGB)
+	}
+
+	for _, dev := range stats.DiskIO {
+		labels := with(statsLabel{"device", dev.Device})
+		add("opsen_disk_io", "read_mbps", labels, dev.ReadMBps)
+		add("opsen_disk_io", "write_mbps", labels, dev.WriteMBps)
+		add("opsen_disk_io", "read_iops", labels, dev.ReadIOPS)
+		add("opsen_disk_io", "write_iops", labels, dev.WriteIOPS)
+		add("opsen_disk_io", "queue_depth", labels, dev.QueueDepth)
+		add("opsen_disk_io", "util_percent", labels, dev.UtilPct)
+	}
+
+	for _, gpu := range stats.GPUs {
+		labels := with(statsLabel{"gpu", strconv.Itoa(gpu.DeviceID)})
+		if gpu.Name != "" {
+			labels = append(labels, statsLabel{"model", gpu.Name})
+		}
+		add("opsen_gpu", "utilization_percent", labels, gpu.UtilizationPct)
+		add("opsen_gpu", "memory_used_gb", labels, gpu.MemoryUsedGB)
+		add("opsen_gpu", "memory_total_gb", labels, gpu.MemoryTotalGB)
+		add("opsen_gpu", "temperature_c", labels, gpu.TemperatureC)
+		if gpu.PowerDrawW > 0 {
+			add("opsen_gpu", "power_draw_w", labels, gpu.PowerDrawW)
+		}
+	}
+
+	return points
+}
+
+// encodeRemoteWrite builds a snappy-compressed Prometheus remote-write (v1) WriteRequest
+// Samples of the same series are kept together in report order
+func encodeRemoteWrite(points []statsPoint) []byte {
+	type series struct {
+		labels  []statsLabel
+		samples []statsPoint
+	}
+	var order []*series
+	index := make(map[string]*series)
+
+	for _, p := range points {
+		labels := append([]statsLabel{{"__name__", p.measurement + "_" + p.field}}, p.labels...)
+		sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+
+		var key strings.Builder
+		for _, l := range labels {
+			key.WriteString(l.name + "\xff" + l.value + "\xff")
+		}
+		s, ok := index[key.String()]
+		if !ok {
+			s = &series{labels: labels}
+			index[key.String()] = s
+			order = append(order, s)
+		}
+		s.samples = append(s.samples, p)
+	}
+
+	var req []byte
+	for _, s := range order {
+		var ts []byte
+		for _, l := range s.labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l.name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l.value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+		for _, p := range s.samples {
+			var sample []byte
+			sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+			sample = protowire.AppendFixed64(sample, math.Float64bits(p.value))
+			sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+			sample = protowire.AppendVarint(sample, uint64(p.timestamp.UnixMilli()))
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, sample)
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+
+	return snappy.Encode(nil, req)
+}
+
+// influxEscaper escapes measurement names, tag keys/values and field keys in line protocol
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// encodeInfluxLines renders points as InfluxDB line protocol with nanosecond timestamps
+// Consecutive points sharing a measurement, tag set and timestamp become fields of one line
+func encodeInfluxLines(points []statsPoint) []byte {
+	var buf bytes.Buffer
+	var seriesKey string
+	var timestamp int64
+	for i, p := range points {
+		labels := append([]statsLabel(nil), p.labels...)
+		sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+		key := influxEscaper.Replace(p.measurement)
+		for _, l := range labels {
+			key += "," + influxEscaper.Replace(l.name) + "=" + influxEscaper.Replace(l.value)
+		}
+		field := influxEscaper.Replace(p.field) + "=" + strconv.FormatFloat(p.value, 'f', -1, 64)
+
+		if i > 0 && key == seriesKey && p.timestamp.UnixNano() == timestamp {
+			buf.WriteString("," + field)
+			continue
+		}
+		if i > 0 {
+			buf.WriteString(" " + strconv.FormatInt(timestamp, 10) + "\n")
+		}
+		seriesKey, timestamp = key, p.timestamp.UnixNano()
+		buf.WriteString(key + " " + field)
+	}
+	if len(points) > 0 {
+		buf.WriteString(" " + strconv.FormatInt(timestamp, 10) + "\n")
+	}
+	return buf.Bytes()
+}
+
+// statsExporter buffers points for one configured endpoint
+type statsExporter struct {
+	config   common.StatsExporterConfig
+	client   *http.Client
+	interval time.Duration
+	limit    int
+
+	mu     sync.Mutex
+	buffer []statsPoint
+}
+
+// StatsExporters forwards received client stats to Prometheus remote-write or InfluxDB endpoints
+// Points are buffered per endpoint and written every flush interval, so /stats never waits on the TSDB
+type StatsExporters struct {
+	exporters []*statsExporter
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewStatsExporters starts the configured exporters, or returns nil if none are configured
+func NewStatsExporters(configs []common.StatsExporterConfig) (*StatsExporters, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	e := &StatsExporters{stop: make(chan struct{})}
+	for i, config := range configs {
+		if config.Type != common.StatsExporterRemoteWrite && config.Type != common.StatsExporterInfluxDB {
+			return nil, fmt.Errorf("stats_exporters[%d]: unknown type %q (expected %s or %s)",
+				i, config.Type, common.StatsExporterRemoteWrite, common.StatsExporterInfluxDB)
+		}
+		if config.URL == "" {
+			return nil, fmt.Errorf("stats_exporters[%d]: url is required", i)
+		}
+
+		exporter := &statsExporter{
+			config:   config,
+			client:   &http.Client{Timeout: 5 * time.Second},
+			interval: 10 * time.Second,
+			limit:    100000,
+		}
+		if config.TimeoutMs > 0 {
+			exporter.client.Timeout = time.Duration(config.TimeoutMs) * time.Millisecond
+		}
+		if config.FlushIntervalSecs > 0 {
+			exporter.interval = time.Duration(config.FlushIntervalSecs) * time.Second
+		}
+		if config.MaxBufferedPoints > 0 {
+			exporter.limit = config.MaxBufferedPoints
+		}
+		e.exporters = append(e.exporters, exporter)
+	}
+
+	for _, exporter := range e.exporters {
+		e.wg.Add(1)
+		go func(exporter *statsExporter) {
+			defer e.wg.Done()
+			exporter.run(e.stop)
+		}(exporter)
+	}
+	return e, nil
+}
+
+// Export queues a stats report for every exporter
+func (e *StatsExporters) Export(stats common.ResourceStats, tenant string) {
+	if e == nil {
+		return
+	}
+	for _, exporter := range e.exporters {
+		exporter.add(statsPoints(stats, tenant, exporter.config.Labels))
+	}
+}
+
+// ExportPoints queues server-level points (not tied to a client report) for every exporter
+func (e *StatsExporters) ExportPoints(points []statsPoint) {
+	if e == nil || len(points) == 0 {
+		return
+	}
+	for _, exporter := range e.exporters {
+		labeled := points
+		if len(exporter.config.Labels) > 0 {
+			labeled = make([]statsPoint, len(points))
+			for i, p := range points {
+				p.labels = append([]statsLabel(nil), p.labels...)
+				for name, value := range exporter.config.Labels {
+					p.labels = append(p.labels, statsLabel{name, value})
+				}
+				labeled[i] = p
+			}
+		}
+		exporter.add(labeled)
+	}
+}
+
+// Close stops the flush loops after writing whatever is still buffered
+func (e *StatsExporters) Close() {
+	if e == nil {
+		return
+	}
+	close(e.stop)
+	e.wg.Wait()
+}
+
+// add buffers points, dropping the oldest once the buffer is full
+func (x *statsExporter) add(points []statsPoint) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.buffer = append(x.buffer, points...)
+	if over := len(x.buffer) - x.limit; over > 0 {
+		x.buffer = append(x.buffer[:0], x.buffer[over:]...)
+		LogWarn(fmt.Sprintf("Stats exporter buffer full, dropped %d points for %s", over, x.config.URL))
+	}
+}
+
+func (x *statsExporter) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(x.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			x.flush()
+		case <-stop:
+			x.flush()
+			return
+		}
+	}
+}
+
+// flush writes buffered points; retryable failures put them back for the next interval
+func (x *statsExporter) flush() {
+	x.mu.Lock()
+	points := x.buffer
+	x.buffer = nil
+	x.mu.Unlock()
+
+	if len(points) == 0 {
+		return
+	}
+
+	retry, err := x.write(points)
+	if err == nil {
+		return
+	}
+
+	LogWarnWithData("Stats export failed", map[string]interface{}{
+		"type":   x.config.Type,
+		"url":    x.config.URL,
+		"points": len(points),
+		"retry":  retry,
+		"error":  err.Error(),
+	})
+	if retry {
+		x.mu.Lock()
+		x.buffer = append(points, x.buffer...)
+		x.mu.Unlock()
+		x.add(nil) // Apply the buffer limit
+	}
+}
+
+// write sends one batch; the bool reports whether a failure is worth retrying (connection errors, 429, 5xx)
+func (x *statsExporter) write(points []statsPoint) (bool, error) {
+	var body []byte
+	if x.config.Type == common.StatsExporterRemoteWrite {
+		body = encodeRemoteWrite(points)
+	} else {
+		body = encodeInfluxLines(points)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, x.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	if x.config.Type == common.StatsExporterRemoteWrite {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	} else {
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	req.Header.Set("User-Agent", "opsen-server")
+	if x.config.Username != "" {
+		req.SetBasicAuth(x.config.Username, x.config.Password)
+	}
+	if x.config.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+x.config.BearerToken)
+	}
+	if x.config.Token != "" {
+		req.Header.Set("Authorization", "Token "+x.config.Token)
+	}
+	for name, value := range x.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := x.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(detail)))
+}
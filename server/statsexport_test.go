@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+	"github.com/golang/snappy"
+)
+
+func exportTestStats() common.ResourceStats {
+	return common.ResourceStats{
+		ClientID:    "backend-1",
+		Hostname:    "host 1",
+		Timestamp:   time.Unix(1700000000, 0),
+		CPUCores:    2,
+		CPUUsageAvg: []float64{12.5, 40},
+		MemoryTotal: 32, MemoryUsed: 8, MemoryAvail: 24,
+		DiskTotal: 500, DiskUsed: 100, DiskAvail: 400,
+		GPUs:      []common.GPUStats{{DeviceID: 0, Name: "A100", UtilizationPct: 55, MemoryUsedGB: 10, MemoryTotalGB: 40}},
+		Inventory: &common.InventoryStats{Runtime: "docker", Total: 3, Running: 2, VCPULimit: 1.5, MemoryLimitGB: 4},
+	}
+}
+
+// TestStatsExporters_InfluxDB verifies stats are written as line protocol grouped by measurement
+func TestStatsExporters_InfluxDB(t *testing.T) {
+	var body string
+	var auth string
+	influx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body, auth = string(data), r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer influx.Close()
+
+	exporters, err := NewStatsExporters([]common.StatsExporterConfig{{
+		Type:   common.StatsExporterInfluxDB,
+		URL:    influx.URL + "/api/v2/write?org=ops&bucket=opsen",
+		Token:  "secret",
+		Labels: map[string]string{"region": "eu"},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create exporters: %v", err)
+	}
+	exporters.Export(exportTestStats(), "")
+	exporters.Close() // Flushes the buffer
+
+	if auth != "Token secret" {
+		t.Errorf("Expected InfluxDB token auth, got %q", auth)
+	}
+	for _, line := range []string{
+		`opsen_memory,client_id=backend-1,hostname=host\ 1,region=eu,tenant=default total_gb=32,used_gb=8,avail_gb=24 1700000000000000000`,
+		`opsen_cpu_core,client_id=backend-1,core=1,hostname=host\ 1,region=eu,tenant=default usage_percent=40 1700000000000000000`,
+		`opsen_gpu,client_id=backend-1,gpu=0,hostname=host\ 1,model=A100,region=eu,tenant=default utilization_percent=55,memory_used_gb=10,memory_total_gb=40,temperature_c=0 1700000000000000000`,
+		`opsen_inventory,client_id=backend-1,hostname=host\ 1,region=eu,runtime=docker,tenant=default workloads=3,running=2,vcpu_limit=1.5,memory_limit_gb=4 1700000000000000000`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected line %q in body:\n%s", line, body)
+		}
+	}
+}
+
+// TestStatsExporters_RemoteWrite verifies remote-write requests are snappy-compressed protobuf with sorted labels
+// and that failed writes are retried on the next flush
+func TestStatsExporters_RemoteWrite(t *testing.T) {
+	var requests [][]byte
+	fail := true
+	prom := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("X-Prometheus-Remote-Write-Version") == "" {
+			http.Error(w, "bad headers", http.StatusBadRequest)
+			return
+		}
+		if fail {
+			fail = false
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		decoded, err := snappy.Decode(nil, data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, decoded)
+	}))
+	defer prom.Close()
+
+	exporters, err := NewStatsExporters([]common.StatsExporterConfig{{
+		Type:              common.StatsExporterRemoteWrite,
+		URL:               prom.URL + "/api/v1/write",
+		FlushIntervalSecs: 3600,
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create exporters: %v", err)
+	}
+	defer exporters.Close()
+
+	exporters.Export(exportTestStats(), "team-a")
+	exporter := exporters.exporters[0]
+	exporter.flush() // 503, kept for retry
+	if len(exporter.buffer) == 0 {
+		t.Fatal("Expected points to be kept after a retryable failure")
+	}
+	exporter.flush()
+	if len(requests) != 1 || len(exporter.buffer) != 0 {
+		t.Fatalf("Expected the retried batch to be written, got %d requests, %d buffered", len(requests), len(exporter.buffer))
+	}
+
+	// Labels are encoded in sorted order, __name__ first
+	series := "\n\x08__name__\x12\x14opsen_memory_used_gb\n\x16\n\tclient_id\x12\tbackend-1"
+	if !bytes.Contains(requests[0], []byte(series)) || !bytes.Contains(requests[0], []byte("team-a")) {
+		t.Errorf("Expected opsen_memory_used_gb series with sorted labels in write request")
+	}
+
+	if _, err := NewStatsExporters([]common.StatsExporterConfig{{Type: "graphite", URL: prom.URL}}); err == nil {
+		t.Error("Expected unknown exporter type to be rejected")
+	}
+}
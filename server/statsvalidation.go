@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// statsValidator collects the field errors of one report
+type statsValidator struct {
+	errs     []common.StatsFieldError
+	rejected bool
+}
+
+func (v *statsValidator) add(field string, value float64, action, reason string) {
+	v.errs = append(v.errs, common.StatsFieldError{
+		Field:  field,
+		Value:  strconv.FormatFloat(value, 'g', -1, 64),
+		Action: action,
+		Reason: reason,
+	})
+	if action == common.StatsFieldRejected {
+		v.rejected = true
+	}
+}
+
+// capacity refuses the report when a total the server places against is negative or not a number
+func (v *statsValidator) capacity(field string, value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		v.add(field, value, common.StatsFieldRejected, "not a finite number")
+	} else if value < 0 {
+		v.add(field, value, common.StatsFieldRejected, "negative capacity")
+	}
+}
+
+// bounded keeps *p within [lo, hi], replacing a non-number with fallback
+// Values above hi by less than statsUsageTolerance of it are rounding in GB conversions and left alone
+func (v *statsValidator) bounded(field string, p *float64, fallback, lo, hi float64) {
+	value := *p
+	switch {
+	case math.IsNaN(value) || math.IsInf(value, 0):
+		*p = fallback
+		v.add(field, value, common.StatsFieldDropped, "not a finite number")
+	case value < lo:
+		*p = lo
+		v.add(field, value, common.StatsFieldClamped, fmt.Sprintf("below %g", lo))
+	case value > hi*(1+statsUsageTolerance):
+		*p = hi
+		v.add(field, value, common.StatsFieldClamped, fmt.Sprintf("above %g", hi))
+	}
+}
+
+// usageOf returns the upper bound for a used/available value: its total, or unbounded if no total is reported
+func usageOf(total float64) float64 {
+	if total <= 0 {
+		return math.Inf(1)
+	}
+	return total
+}
+
+// previousAt returns values[i], or fallback when the previous report had no such element
+func previousAt(values []float64, i int, fallback float64) float64 {
+	if i < len(values) {
+		return values[i]
+	}
+	return fallback
+}
+
+// validateStats checks a report field by field against the backend's previous report. Out-of-range values
+// are clamped and non-numbers replaced with the previous value (or, for CPU and GPU usage, fully busy), so
+// the rest of the report is still used. Negative or non-numeric capacity totals reject the whole report
+func validateStats(stats *common.ResourceStats, prev common.ResourceStats) ([]common.StatsFieldError, bool) {
+	var v statsValidator
+
+	if stats.CPUCores < 0 {
+		v.add("cpu_cores", float64(stats.CPUCores), common.StatsFieldRejected, "negative capacity")
+	}
+	v.capacity("memory_total_gb", stats.MemoryTotal)
+	v.capacity("disk_total_gb", stats.DiskTotal)
+	if v.rejected {
+		return v.errs, true
+	}
+
+	// Corrections must not reach slices shared with the raw report
+	stats.CPUUsageAvg = slices.Clone(stats.CPUUsageAvg)
+	stats.CPUUsageP95 = slices.Clone(stats.CPUUsageP95)
+	stats.CPUUsageShort = slices.Clone(stats.CPUUsageShort)
+	stats.GPUs = slices.Clone(stats.GPUs)
+
+	for i := range stats.CPUUsageAvg {
+		v.bounded(fmt.Sprintf("cpu_usage_avg[%d]", i), &stats.CPUUsageAvg[i], previousAt(prev.CPUUsageAvg, i, 100), 0, 100)
+	}
+	for i := range stats.CPUUsageP95 {
+		v.bounded(fmt.Sprintf("cpu_usage_p95[%d]", i), &stats.CPUUsageP95[i], previousAt(prev.CPUUsageP95, i, 100), 0, 100)
+	}
+	for i := range stats.CPUUsageShort {
+		v.bounded(fmt.Sprintf("cpu_usage_short[%d]", i), &stats.CPUUsageShort[i], previousAt(prev.CPUUsageShort, i, 100), 0, 100)
+	}
+
+	memory, disk := usageOf(stats.MemoryTotal), usageOf(stats.DiskTotal)
+	v.bounded("memory_used_gb", &stats.MemoryUsed, prev.MemoryUsed, 0, memory)
+	v.bounded("memory_used_p95_gb", &stats.MemoryUsedP95, prev.MemoryUsedP95, 0, memory)
+	v.bounded("memory_avail_gb", &stats.MemoryAvail, prev.MemoryAvail, 0, memory)
+	v.bounded("disk_used_gb", &stats.DiskUsed, prev.DiskUsed, 0, disk)
+	v.bounded("disk_avail_gb", &stats.DiskAvail, prev.DiskAvail, 0, disk)
+	v.bounded("swap_total_gb", &stats.SwapTotal, prev.SwapTotal, 0, math.Inf(1))
+	v.bounded("swap_used_gb", &stats.SwapUsed, prev.SwapUsed, 0, usageOf(stats.SwapTotal))
+	v.bounded("load_avg_1", &stats.LoadAvg1, prev.LoadAvg1, 0, math.Inf(1))
+	v.bounded("load_avg_5", &stats.LoadAvg5, prev.LoadAvg5, 0, math.Inf(1))
+	v.bounded("load_avg_15", &stats.LoadAvg15, prev.LoadAvg15, 0, math.Inf(1))
+
+	for i := range stats.GPUs {
+		gpu := &stats.GPUs[i]
+		var prevGPU common.GPUStats
+		if i < len(prev.GPUs) {
+			prevGPU = prev.GPUs[i]
+		} else {
+			prevGPU.UtilizationPct = 100
+		}
+		v.bounded(fmt.Sprintf("gpus[%d].memory_total_gb", i), &gpu.MemoryTotalGB, prevGPU.MemoryTotalGB, 0, math.Inf(1))
+		v.bounded(fmt.Sprintf("gpus[%d].memory_used_gb", i), &gpu.MemoryUsedGB, prevGPU.MemoryUsedGB, 0, usageOf(gpu.MemoryTotalGB))
+		v.bounded(fmt.Sprintf("gpus[%d].utilization_pct", i), &gpu.UtilizationPct, prevGPU.UtilizationPct, 0, 100)
+	}
+
+	return v.errs, false
+}
+
+// recordBadStatsLocked counts a report with invalid fields against the backend
+// Must be called with s.mu held
+func (c *ClientState) recordBadStatsLocked(errs []common.StatsFieldError, now time.Time) {
+	c.BadStatsReports++
+	c.BadStatsAt = now
+	c.BadStatsErrors = errs
+}
+
+// checkStatsLocked validates a report for a cached backend (or nil for an unknown one) and counts invalid reports
+// Must be called with s.mu held, before the report replaces client.Stats
+func (s *Server) checkStatsLocked(client *ClientState, stats *common.ResourceStats, now time.Time) ([]common.StatsFieldError, bool) {
+	var prev common.ResourceStats
+	if client != nil {
+		prev = client.Stats
+	}
+	errs, rejected := validateStats(stats, prev)
+	if len(errs) == 0 {
+		return nil, false
+	}
+
+	data := map[string]interface{}{
+		"client_id":    stats.ClientID,
+		"field_errors": errs,
+	}
+	if rejected {
+		LogWarnWithData("Stats report rejected", data)
+	} else {
+		LogDebugWithData("Stats report had invalid fields", data)
+	}
+	if client != nil {
+		client.recordBadStatsLocked(errs, now)
+	}
+	return errs, rejected
+}
+
+// writeStatsRejected refuses a report with its per-field error report
+func writeStatsRejected(w http.ResponseWriter, errs []common.StatsFieldError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(common.StatsResponse{
+		Status:      "rejected",
+		Error:       "Invalid stats report, see field_errors",
+		FieldErrors: errs,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode stats response: %v", err)
+	}
+}
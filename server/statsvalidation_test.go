@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// postStatsReport sends a stats report to the server
+func postStatsReport(server *Server, stats common.ResourceStats) (*httptest.ResponseRecorder, common.StatsResponse) {
+	body, _ := json.Marshal(stats)
+	rec := httptest.NewRecorder()
+	server.handleStats(rec, httptest.NewRequest("POST", "/stats", bytes.NewReader(body)))
+	var resp common.StatsResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec, resp
+}
+
+// TestStatsValidation_ClampsInvalidFields verifies out-of-range fields are clamped, reported per field
+// and counted, while the rest of the report is stored
+func TestStatsValidation_ClampsInvalidFields(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "a", TotalCPU: 2}))
+
+	rec, resp := postStatsReport(server, common.ResourceStats{
+		ClientID:    "a",
+		CPUCores:    2,
+		CPUUsageAvg: []float64{-5, 140},
+		MemoryTotal: 16, MemoryUsed: -2, MemoryAvail: 12,
+		DiskTotal: 100, DiskUsed: 250, DiskAvail: 40,
+		LoadAvg1:  0.5,
+		Timestamp: time.Now(),
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the report to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	fields := map[string]string{}
+	for _, fieldErr := range resp.FieldErrors {
+		fields[fieldErr.Field] = fieldErr.Action
+	}
+	for _, field := range []string{"cpu_usage_avg[0]", "cpu_usage_avg[1]", "memory_used_gb", "disk_used_gb"} {
+		if fields[field] != common.StatsFieldClamped {
+			t.Errorf("Expected %s to be clamped, got %v", field, resp.FieldErrors)
+		}
+	}
+	if len(resp.FieldErrors) != 4 {
+		t.Errorf("Expected 4 field errors, got %+v", resp.FieldErrors)
+	}
+
+	server.mu.RLock()
+	client := server.clientCache["a"]
+	stats, reports := client.Stats, client.BadStatsReports
+	server.mu.RUnlock()
+	if stats.CPUUsageAvg[0] != 0 || stats.CPUUsageAvg[1] != 100 || stats.MemoryUsed != 0 || stats.DiskUsed != 100 {
+		t.Errorf("Expected clamped values to be stored, got %+v", stats)
+	}
+	if stats.MemoryAvail != 12 || stats.LoadAvg1 != 0.5 {
+		t.Errorf("Expected valid fields to be stored unchanged, got %+v", stats)
+	}
+	if reports != 1 {
+		t.Errorf("Expected 1 bad stats report, got %d", reports)
+	}
+
+	// A clean report leaves the counter alone and carries no field errors
+	rec, resp = postStatsReport(server, common.ResourceStats{
+		ClientID: "a", CPUCores: 2, CPUUsageAvg: []float64{10, 20},
+		MemoryTotal: 16, MemoryUsed: 4, MemoryAvail: 12, DiskTotal: 100, DiskUsed: 10, DiskAvail: 90,
+		Timestamp: time.Now(),
+	})
+	if rec.Code != http.StatusOK || len(resp.FieldErrors) != 0 || resp.StatsDelta != common.StatsDeltaSupported {
+		t.Errorf("Expected a clean acknowledgement, got %d: %s", rec.Code, rec.Body.String())
+	}
+	server.mu.RLock()
+	if n := server.clientCache["a"].BadStatsReports; n != 1 {
+		t.Errorf("Expected the counter to stay at 1, got %d", n)
+	}
+	server.mu.RUnlock()
+}
+
+// TestStatsValidation_RejectsInvalidCapacity verifies reports with unusable totals are refused and the previous stats kept
+func TestStatsValidation_RejectsInvalidCapacity(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "a"}))
+
+	rec, resp := postStatsReport(server, common.ResourceStats{
+		ClientID: "a", CPUCores: 8, MemoryTotal: -16, DiskTotal: 100, Timestamp: time.Now(),
+	})
+	if rec.Code != http.StatusBadRequest || resp.Status != "rejected" {
+		t.Fatalf("Expected the report to be rejected, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(resp.FieldErrors) != 1 || resp.FieldErrors[0].Field != "memory_total_gb" || resp.FieldErrors[0].Action != common.StatsFieldRejected {
+		t.Errorf("Expected a memory_total_gb error, got %+v", resp.FieldErrors)
+	}
+
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	if client := server.clientCache["a"]; client.Stats.MemoryTotal != 32 || client.BadStatsReports != 1 {
+		t.Errorf("Expected the previous stats to be kept and the report counted, got total=%.0f reports=%d",
+			client.Stats.MemoryTotal, client.BadStatsReports)
+	}
+}
+
+// TestValidateStats_NonFinite verifies values that are not numbers fall back to the previous report,
+// or to fully busy for usage without one
+func TestValidateStats_NonFinite(t *testing.T) {
+	prev := common.ResourceStats{CPUUsageAvg: []float64{30}, MemoryUsed: 6}
+	stats := common.ResourceStats{
+		CPUUsageAvg: []float64{math.NaN(), math.Inf(1)},
+		MemoryTotal: 16, MemoryUsed: math.NaN(),
+	}
+	errs, rejected := validateStats(&stats, prev)
+	if rejected || len(errs) != 3 {
+		t.Fatalf("Expected 3 dropped fields, got rejected=%v %+v", rejected, errs)
+	}
+	if stats.CPUUsageAvg[0] != 30 || stats.CPUUsageAvg[1] != 100 || stats.MemoryUsed != 6 {
+		t.Errorf("Unexpected replacements: %+v", stats)
+	}
+
+	if _, rejected := validateStats(&common.ResourceStats{DiskTotal: math.Inf(1)}, prev); !rejected {
+		t.Error("Expected an infinite disk total to reject the report")
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// insertStatsSQL persists one stats report (values in common.SignedStatsColumns order after id)
+const insertStatsSQL = `
+	INSERT INTO stats
+	(client_id, timestamp, cpu_cores, cpu_usage_json, memory_total, memory_used,
+	 memory_avail, disk_total, disk_used, disk_avail, gpu_stats_json,
+	 load_avg_1, load_avg_5, load_avg_15, swap_total, swap_used, psi_json)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+// signStatsSQL stores a stats row's signature once SQLite has assigned the id it covers
+const signStatsSQL = `UPDATE stats SET row_hmac = ? WHERE id = ?`
+
+type statsWrite struct {
+	clientID string
+	values   []interface{}
+}
+
+// StatsWriter persists stats reports in batches from a dedicated goroutine
+// /stats is acknowledged once the in-memory cache is updated; rows reach SQLite within one flush interval
+type StatsWriter struct {
+	db         *sql.DB
+	signingKey string // db_signing_key (empty = rows are stored unsigned)
+	batchSize  int
+	flushEvery time.Duration
+	queue      chan statsWrite
+	flushReq   chan chan struct{}
+	done       chan struct{}
+
+	mu     sync.RWMutex // Held for reading while sending to queue, so Close can't close it mid-send
+	closed bool
+}
+
+// NewStatsWriter starts a batching writer, or returns nil if batchSize is 0 (synchronous writes)
+func NewStatsWriter(db *sql.DB, signingKey string, batchSize, flushIntervalMs, queueSize int) *StatsWriter {
+	if batchSize <= 0 {
+		return nil
+	}
+	if flushIntervalMs <= 0 {
+		flushIntervalMs = 1000
+	}
+	if queueSize < batchSize {
+		queueSize = batchSize * 10
+	}
+
+	w := &StatsWriter{
+		db:         db,
+		signingKey: signingKey,
+		batchSize:  batchSize,
+		flushEvery: time.Duration(flushIntervalMs) * time.Millisecond,
+		queue:      make(chan statsWrite, queueSize),
+		flushReq:   make(chan chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Enqueue buffers a stats row for the next batch
+// Returns false if the writer is disabled (nil), closed or its queue is full; the caller then writes synchronously
+// A /stats request still in flight when shutdown times out lands here after Close
+func (w *StatsWriter) Enqueue(clientID string, values []interface{}) bool {
+	if w == nil {
+		return false
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return false
+	}
+	select {
+	case w.queue <- statsWrite{clientID: clientID, values: values}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Flush writes every queued row and waits until they are committed
+// Used before deleting a client's stats so buffered rows can't outlive the client
+func (w *StatsWriter) Flush() {
+	if w == nil {
+		return
+	}
+	ack := make(chan struct{})
+	select {
+	case w.flushReq <- ack:
+		<-ack
+	case <-w.done:
+	}
+}
+
+// Close stops accepting rows and waits until everything queued has been written
+func (w *StatsWriter) Close() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+	<-w.done
+}
+
+func (w *StatsWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.flushEvery)
+	defer ticker.Stop()
+
+	batch := make([]statsWrite, 0, w.batchSize)
+	for {
+		select {
+		case row, ok := <-w.queue:
+			if !ok {
+				w.write(batch)
+				return
+			}
+			batch = append(batch, row)
+			if len(batch) >= w.batchSize {
+				w.write(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			w.write(batch)
+			batch = batch[:0]
+		case ack := <-w.flushReq:
+			batch = w.drain(batch)
+			w.write(batch)
+			batch = batch[:0]
+			close(ack)
+		}
+	}
+}
+
+// drain moves rows already in the queue into the batch without blocking
+func (w *StatsWriter) drain(batch []statsWrite) []statsWrite {
+	for {
+		select {
+		case row, ok := <-w.queue:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, row)
+		default:
+			return batch
+		}
+	}
+}
+
+// write inserts a batch and bumps last_seen for its clients in one transaction
+func (w *StatsWriter) write(batch []statsWrite) {
+	if len(batch) == 0 {
+		return
+	}
+	start := time.Now()
+	if err := writeStatsBatch(w.db, w.signingKey, batch); err != nil {
+		log.Printf("Error persisting stats batch (%d rows): %v", len(batch), err)
+		return
+	}
+	LogDebugWithData("Stats batch persisted", map[string]interface{}{
+		"rows":        len(batch),
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+}
+
+// writeStatsBatch inserts stats rows and bumps last_seen for their clients in one transaction
+// With a signing key each row is signed together with its new id before the transaction commits,
+// so no row is ever stored unsigned
+func writeStatsBatch(db *sql.DB, signingKey string, batch []statsWrite) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.Prepare(insertStatsSQL)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	var sign *sql.Stmt
+	if signingKey != "" {
+		if sign, err = tx.Prepare(signStatsSQL); err != nil {
+			return err
+		}
+		defer sign.Close()
+	}
+
+	seen := make(map[string]bool)
+	for _, row := range batch {
+		result, err := insert.Exec(row.values...)
+		if err != nil {
+			return fmt.Errorf("insert stats for %s: %w", row.clientID, err)
+		}
+		if sign != nil {
+			id, err := result.LastInsertId()
+			if err != nil {
+				return fmt.Errorf("sign stats for %s: %w", row.clientID, err)
+			}
+			if _, err := sign.Exec(signStatsRow(signingKey, id, row.values), id); err != nil {
+				return fmt.Errorf("sign stats for %s: %w", row.clientID, err)
+			}
+		}
+		seen[row.clientID] = true
+	}
+
+	for clientID := range seen {
+		if _, err := tx.Exec("UPDATE clients SET last_seen = CURRENT_TIMESTAMP WHERE client_id = ?", clientID); err != nil {
+			return fmt.Errorf("update last_seen for %s: %w", clientID, err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+func countStatsRows(t *testing.T, db *sql.DB, clientID string) int {
+	t.Helper()
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM stats WHERE client_id = ?", clientID).Scan(&count); err != nil {
+		t.Fatalf("Failed to count stats rows: %v", err)
+	}
+	return count
+}
+
+func postStats(t *testing.T, server *Server, clientID string) {
+	t.Helper()
+	body, _ := json.Marshal(common.ResourceStats{ClientID: clientID, Timestamp: time.Now(), CPUCores: 4})
+	rec := httptest.NewRecorder()
+	server.handleStats(rec, httptest.NewRequest("POST", "/stats", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected stats to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestStatsWriter_BatchesAndFlushes verifies /stats rows are buffered and written in batches
+func TestStatsWriter_BatchesAndFlushes(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.StatsWriteBatchSize = 3
+		c.StatsWriteFlushMs = 60000 // Only size, Flush and Close trigger writes in this test
+		c.StatsWriteQueueSize = 100
+	})
+	defer server.statsWriter.Close()
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend"}))
+
+	postStats(t, server, "backend")
+	postStats(t, server, "backend")
+	if count := countStatsRows(t, db, "backend"); count != 0 {
+		t.Fatalf("Expected rows to stay buffered below the batch size, got %d", count)
+	}
+
+	// The third row fills the batch
+	postStats(t, server, "backend")
+	deadline := time.Now().Add(2 * time.Second)
+	for countStatsRows(t, db, "backend") != 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if count := countStatsRows(t, db, "backend"); count != 3 {
+		t.Fatalf("Expected a full batch of 3 rows, got %d", count)
+	}
+
+	postStats(t, server, "backend")
+	server.statsWriter.Flush()
+	if count := countStatsRows(t, db, "backend"); count != 4 {
+		t.Errorf("Expected Flush to write the buffered row, got %d rows", count)
+	}
+}
+
+// TestStatsWriter_CloseFlushesQueue verifies buffered rows are written on shutdown
+func TestStatsWriter_CloseFlushesQueue(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	writer := NewStatsWriter(db, "", 100, 60000, 1000)
+	for i := 0; i < 5; i++ {
+		row := []interface{}{"backend", time.Now(), 4, "[]", 0.0, 0.0, 0.0, 0.0, 0.0, 0.0, "[]", 0.0, 0.0, 0.0, 0.0, 0.0, nil}
+		if !writer.Enqueue("backend", row) {
+			t.Fatal("Expected row to be queued")
+		}
+	}
+	writer.Close()
+
+	if count := countStatsRows(t, db, "backend"); count != 5 {
+		t.Errorf("Expected 5 rows written on close, got %d", count)
+	}
+
+	var disabled *StatsWriter
+	if disabled.Enqueue("backend", nil) {
+		t.Error("Expected a nil writer to ask for a synchronous write")
+	}
+}
+
+// TestStatsWriter_EnqueueAfterClose verifies requests outliving shutdown fall back to synchronous writes instead of panicking
+func TestStatsWriter_EnqueueAfterClose(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	writer := NewStatsWriter(db, "", 100, 60000, 1000)
+	row := []interface{}{"backend", time.Now(), 4, "[]", 0.0, 0.0, 0.0, 0.0, 0.0, 0.0, "[]", 0.0, 0.0, 0.0, 0.0, 0.0, nil}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			writer.Enqueue("backend", row)
+		}
+	}()
+	writer.Close()
+	<-done
+
+	if writer.Enqueue("backend", row) {
+		t.Error("Expected a closed writer to refuse rows")
+	}
+	writer.Close() // A second Close is harmless
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+)
+
+// hashedStickyIDPrefix marks sticky IDs that were hashed with sticky_id_hash_key
+const hashedStickyIDPrefix = "h:"
+
+// hashedStickyIDPattern matches a hashed sticky ID, bare or tenant-scoped ("<tenant>:h:<hex>")
+var hashedStickyIDPattern = regexp.MustCompile(`(^|:)h:[0-9a-f]{64}$`)
+
+// requestStickyID extracts the sticky ID from the configured header or the client IP
+// With sticky_id_hash_key set, the raw value (often an e-mail address or IP) never leaves this function
+func (s *Server) requestStickyID(r *http.Request) string {
+	stickyID := ""
+	if s.stickyHeader != "" {
+		stickyID = r.Header.Get(s.stickyHeader)
+	}
+	// If no header value and sticky_by_ip enabled, use client IP
+	if stickyID == "" && s.stickyByIP {
+		stickyID = getClientIP(r)
+	}
+	return s.hashStickyID(stickyID)
+}
+
+// hashStickyID replaces a sticky ID with its keyed HMAC-SHA256 when sticky_id_hash_key is set
+// The mapping is stable, so stickiness is unaffected. Values that look hashed are hashed again: a client
+// presenting someone else's hashed ID must not land on their assignment
+func (s *Server) hashStickyID(stickyID string) string {
+	key := s.config.StickyIDHashKey
+	if key == "" || stickyID == "" {
+		return stickyID
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(stickyID))
+	return hashedStickyIDPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// adminStickyID hashes a sticky ID given by an operator, who may also pass the hashed form shown by
+// /sticky and /sticky/export. Only admin endpoints accept hashed IDs as-is
+func (s *Server) adminStickyID(stickyID string) string {
+	if isHashedStickyID(stickyID) {
+		return stickyID
+	}
+	return s.hashStickyID(stickyID)
+}
+
+// hashStoredStickyID scopes a stored assignment key to its tenant and hashes its sticky ID
+// Used for snapshots imported from instances that stored raw sticky IDs or bare default-tenant keys
+func (s *Server) hashStoredStickyID(key string) string {
+	key = s.scopedStickyKey(key)
+	tenant, stickyID, _ := splitStickyKey(key)
+	if s.config.StickyIDHashKey == "" || isHashedStickyID(stickyID) {
+		return key
+	}
+	return tenantStickyID(tenant, s.hashStickyID(stickyID))
+}
+
+func isHashedStickyID(stickyID string) bool {
+	return hashedStickyIDPattern.MatchString(stickyID)
+}
+
+// migrateStickyKeys moves assignments stored under bare default-tenant sticky IDs to tenant-scoped keys
+// Returns the number of assignments moved; keys that are already scoped are left alone
+func (s *Server) migrateStickyKeys() (int, error) {
+	assignments, err := s.stickyStore.List("")
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, assignment := range assignments {
+		key := s.scopedStickyKey(assignment.StickyID)
+		if key == assignment.StickyID {
+			continue
+		}
+		scoped := assignment
+		scoped.StickyID = key
+		if err := s.stickyStore.Set(scoped); err != nil {
+			return moved, err
+		}
+		if err := s.stickyStore.Delete(assignment.StickyID, assignment.Tier); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// purgeUnhashedStickyAssignments deletes assignments stored with raw sticky IDs before hashing was enabled
+// Returns the number of rows removed; those sessions are reassigned (hashed) on their next request
+func (s *Server) purgeUnhashedStickyAssignments() (int, error) {
+	if s.config.StickyIDHashKey == "" {
+		return 0, nil
+	}
+
+	assignments, err := s.stickyStore.List("")
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, assignment := range assignments {
+		if isHashedStickyID(assignment.StickyID) {
+			continue
+		}
+		if err := s.stickyStore.Delete(assignment.StickyID, assignment.Tier); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestStickyIDHashing_NoRawIDsStored verifies sticky IDs are hashed before reaching memory and the database
+func TestStickyIDHashing_NoRawIDsStored(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.StickyHeader = "X-User-Email"
+		c.StickyIDHashKey = "retention-secret"
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-a"}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-b"}))
+
+	route := func() string {
+		body, _ := json.Marshal(common.RoutingRequest{Tier: "lite", ClientIP: "1.2.3.4"})
+		req := httptest.NewRequest("POST", "/route", bytes.NewReader(body))
+		req.Header.Set("X-User-Email", "alice@example.com")
+		rec := httptest.NewRecorder()
+		server.handleRoute(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected route to succeed, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp common.RoutingResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp.ClientID
+	}
+
+	first := route()
+	if second := route(); second != first {
+		t.Errorf("Expected hashed sticky ID to stay on %s, got %s", first, second)
+	}
+
+	hashed := server.hashStickyID("alice@example.com")
+	if !strings.HasPrefix(hashed, hashedStickyIDPrefix) || strings.Contains(hashed, "alice") {
+		t.Fatalf("Expected an opaque hashed sticky ID, got %q", hashed)
+	}
+
+	server.mu.RLock()
+	_, stored := server.stickyAssignments[tenantStickyID(DefaultTenant, hashed)]
+	_, raw := server.stickyAssignments[tenantStickyID(DefaultTenant, "alice@example.com")]
+	server.mu.RUnlock()
+	if !stored || raw {
+		t.Errorf("Expected only the hashed sticky ID in memory (hashed=%v raw=%v)", stored, raw)
+	}
+
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM sticky_assignments WHERE sticky_id LIKE '%alice%'").Scan(&count)
+	if count != 0 {
+		t.Errorf("Expected no raw sticky IDs in the database, found %d", count)
+	}
+
+	// Admin endpoints take hashed IDs from /sticky/export back as-is
+	if server.adminStickyID(hashed) != hashed {
+		t.Error("Expected an already hashed sticky ID to be left unchanged on admin paths")
+	}
+
+	// A client sending alice's hashed ID in the sticky header gets its own assignment, not hers
+	if stolen := server.hashStickyID(hashed); stolen == hashed {
+		t.Error("Expected a hashed-looking sticky ID from a request to be hashed again")
+	}
+}
+
+// TestStickyIDHashing_PurgesRawAssignments verifies rows stored before hashing was enabled are removed
+func TestStickyIDHashing_PurgesRawAssignments(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	plain := NewTestServer(t, db)
+	plain.createStickyAssignment("bob@example.com", "lite", "backend-a")
+	plain.createStickyAssignment("team-a:carol@example.com", "lite", "backend-a")
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.StickyIDHashKey = "retention-secret"
+	})
+	server.createStickyAssignment(server.hashStickyID("dave@example.com"), "lite", "backend-b")
+
+	removed, err := server.purgeUnhashedStickyAssignments()
+	if err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("Expected 2 raw assignments purged, got %d", removed)
+	}
+
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM sticky_assignments").Scan(&count)
+	if count != 1 {
+		t.Errorf("Expected the hashed assignment to be kept, %d rows left", count)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"cyqle.in/opsen/common"
+)
+
+// errCodeStickyLimit is sent in X-LB-Error-Code when a sticky ID already holds as many sessions as it may
+const errCodeStickyLimit = "sticky_limit"
+
+const (
+	StickyLimitPolicyReject      = "reject"       // Refuse the new session with 429 (default)
+	StickyLimitPolicyEvictOldest = "evict_oldest" // Drop the least recently used assignment to make room
+)
+
+// validateStickyLimits checks the limits and policy
+func validateStickyLimits(config common.StickyLimitsConfig) error {
+	switch config.Policy {
+	case "", StickyLimitPolicyReject, StickyLimitPolicyEvictOldest:
+	default:
+		return fmt.Errorf("sticky_limits: unknown policy %q (want %s or %s)", config.Policy, StickyLimitPolicyReject, StickyLimitPolicyEvictOldest)
+	}
+	if config.MaxAssignments < 0 {
+		return fmt.Errorf("sticky_limits: max_assignments must be >= 0")
+	}
+	for tier, limit := range config.Tiers {
+		if limit < 0 {
+			return fmt.Errorf("sticky_limits: limit for tier %s must be >= 0", tier)
+		}
+	}
+	return nil
+}
+
+// stickyLimit returns how many assignments a sticky ID may hold when placing a new session of tier (0 = unlimited)
+func (s *Server) stickyLimit(tier string) int {
+	if limit, ok := s.config.StickyLimits.Tiers[tier]; ok {
+		return limit
+	}
+	return s.config.StickyLimits.MaxAssignments
+}
+
+// enforceStickyLimit makes room for a new sticky_id+tier assignment, evicting the oldest ones under evict_oldest
+// Returns false after answering 429 when the sticky ID is at its limit and the policy is reject
+// Sessions that already have an assignment for tier are never limited
+func (s *Server) enforceStickyLimit(w http.ResponseWriter, stickyID, tier string, tierSpec common.TierSpec) bool {
+	limit := s.stickyLimit(tier)
+	if limit <= 0 || stickyID == "" || s.isHashStickyMode() {
+		return true
+	}
+
+	key := tenantStickyID(tierSpec.Tenant, stickyID)
+	s.mu.RLock()
+	held := make([]string, 0, len(s.stickyAssignments[key]))
+	_, placed := s.stickyAssignments[key][tier]
+	for heldTier := range s.stickyAssignments[key] {
+		held = append(held, heldTier)
+	}
+	s.mu.RUnlock()
+
+	if placed || len(held) < limit {
+		return true
+	}
+
+	if s.config.StickyLimits.Policy != StickyLimitPolicyEvictOldest {
+		LogInfoWithData("Sticky session limit reached", map[string]interface{}{
+			"sticky_id": stickyID,
+			"tenant":    tierSpec.Tenant,
+			"tier":      tier,
+			"held":      held,
+			"limit":     limit,
+		})
+		w.Header().Set(LBErrorCodeHeader, errCodeStickyLimit)
+		http.Error(w, fmt.Sprintf("Session limit reached: %d of %d sessions in use for tier %s", len(held), limit, tier), http.StatusTooManyRequests)
+		return false
+	}
+
+	for _, evict := range s.oldestStickyTiers(key, held)[:len(held)-limit+1] {
+		s.evictStickyAssignment(stickyID, key, evict, tier, tierSpec.Tenant)
+	}
+	return true
+}
+
+// oldestStickyTiers orders a sticky ID's held tiers by last use, oldest first
+// Tiers missing from the store (e.g. after a failed write) come last in name order
+func (s *Server) oldestStickyTiers(key string, held []string) []string {
+	ordered := make([]string, 0, len(held))
+	assignments, err := s.stickyStore.List(key)
+	if err != nil {
+		log.Printf("Warning: Failed to order sticky assignments: %v", err)
+	}
+	for _, assignment := range assignments {
+		if slices.Contains(held, assignment.Tier) {
+			ordered = append(ordered, assignment.Tier)
+		}
+	}
+
+	rest := make([]string, 0, len(held))
+	for _, tier := range held {
+		if !slices.Contains(ordered, tier) {
+			rest = append(rest, tier)
+		}
+	}
+	slices.Sort(rest)
+	return append(ordered, rest...)
+}
+
+// evictStickyAssignment drops an assignment and its pending allocation so a newer session can take its place
+func (s *Server) evictStickyAssignment(stickyID, key, tier, forTier, tenant string) {
+	s.mu.Lock()
+	clientID := s.stickyAssignments[key][tier]
+	s.removePendingAllocationForStickyTierLocked(clientID, key, tier)
+	s.mu.Unlock()
+	s.removeStickyAssignment(key, tier)
+
+	LogInfoWithData("Sticky assignment evicted by session limit", map[string]interface{}{
+		"sticky_id": stickyID,
+		"tenant":    tenant,
+		"tier":      tier,
+		"client_id": clientID,
+		"for_tier":  forTier,
+	})
+	s.emit("sticky.evicted", map[string]interface{}{
+		"sticky_id": stickyID,
+		"tenant":    tenant,
+		"tier":      tier,
+		"client_id": clientID,
+		"for_tier":  forTier,
+	})
+}
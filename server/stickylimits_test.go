@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+func newStickyLimitServer(t *testing.T, limits common.StickyLimitsConfig) *Server {
+	t.Helper()
+	db, cleanup := CreateTestDB(t)
+	t.Cleanup(cleanup)
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.StickyLimits = limits
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-1"}))
+	return server
+}
+
+func routeSticky(server *Server, stickyID, tier string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(common.RoutingRequest{Tier: tier})
+	req := httptest.NewRequest("POST", "/route", bytes.NewReader(body))
+	req.Header.Set("X-Session-ID", stickyID)
+	rec := httptest.NewRecorder()
+	server.handleRoute(rec, req)
+	return rec
+}
+
+// TestStickyLimits_Reject verifies a sticky ID at its limit gets 429 for new sessions but keeps its existing ones
+func TestStickyLimits_Reject(t *testing.T) {
+	server := newStickyLimitServer(t, common.StickyLimitsConfig{
+		MaxAssignments: 2,
+		Tiers:          map[string]int{"lite": 1},
+	})
+
+	if rec := routeSticky(server, "user-1", "pro-standard"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected first session to be placed, got %d", rec.Code)
+	}
+	// Requesting lite allows only one session in total
+	rec := routeSticky(server, "user-1", "lite")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 for a lite session beyond the limit, got %d", rec.Code)
+	}
+	if got := rec.Header().Get(LBErrorCodeHeader); got != errCodeStickyLimit {
+		t.Errorf("Expected %s: %s, got %q", LBErrorCodeHeader, errCodeStickyLimit, got)
+	}
+
+	// Other tiers use max_assignments; existing sessions are never limited
+	for _, tier := range []string{"free", "pro-standard", "free"} {
+		if rec := routeSticky(server, "user-1", tier); rec.Code != http.StatusOK {
+			t.Errorf("Expected %s to be placed within max_assignments, got %d", tier, rec.Code)
+		}
+	}
+	if rec := routeSticky(server, "user-1", "pro-turbo"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected a third session to be rejected, got %d", rec.Code)
+	}
+	if rec := routeSticky(server, "user-2", "lite"); rec.Code != http.StatusOK {
+		t.Errorf("Expected other sticky IDs to be unaffected, got %d", rec.Code)
+	}
+}
+
+// TestStickyLimits_EvictOldest verifies the least recently used assignment makes room for a new session
+func TestStickyLimits_EvictOldest(t *testing.T) {
+	server := newStickyLimitServer(t, common.StickyLimitsConfig{
+		MaxAssignments: 2,
+		Policy:         StickyLimitPolicyEvictOldest,
+	})
+
+	for _, tier := range []string{"lite", "pro-standard", "pro-turbo"} {
+		if rec := routeSticky(server, "user-1", tier); rec.Code != http.StatusOK {
+			t.Fatalf("Expected %s to be placed, got %d", tier, rec.Code)
+		}
+	}
+
+	for tier, expected := range map[string]bool{"lite": false, "pro-standard": true, "pro-turbo": true} {
+		if got := server.hasStickyAssignment("default:user-1", tier); got != expected {
+			t.Errorf("Expected assignment for %s: %v, got %v", tier, expected, got)
+		}
+	}
+	if n := countRows(t, server, "sticky_assignments", "backend-1"); n != 2 {
+		t.Errorf("Expected 2 persisted assignments, got %d", n)
+	}
+
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	for _, alloc := range server.pendingAllocations["backend-1"] {
+		if alloc.Tier == "lite" {
+			t.Error("Expected the evicted session's pending allocation to be released")
+		}
+	}
+}
+
+// TestValidateStickyLimits verifies unknown policies and negative limits are rejected
+func TestValidateStickyLimits(t *testing.T) {
+	valid := common.StickyLimitsConfig{MaxAssignments: 1, Tiers: map[string]int{"lite": 0}, Policy: StickyLimitPolicyEvictOldest}
+	if err := validateStickyLimits(valid); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	for _, config := range []common.StickyLimitsConfig{
+		{Policy: "drop"},
+		{MaxAssignments: -1},
+		{Tiers: map[string]int{"lite": -2}},
+	} {
+		if err := validateStickyLimits(config); err == nil {
+			t.Errorf("Expected %+v to be rejected", config)
+		}
+	}
+}
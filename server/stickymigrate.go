@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// Hand-off notification sent to the old backend
+const (
+	defaultStickyMigrateNotifyPath = "/opsen/migrate"
+	stickyMigrateNotifyTimeout     = 10 * time.Second
+)
+
+// StickyMigrateRequest is the body of POST /sticky/{sticky_id}/migrate
+type StickyMigrateRequest struct {
+	Tier           string `json:"tier"`
+	TargetClientID string `json:"target_client_id,omitempty"` // Move to this backend instead of selecting one
+	Notify         bool   `json:"notify,omitempty"`           // Ask the old backend to checkpoint/hand off the session
+}
+
+// StickyMigrateNotification is POSTed to the old backend when a migration asks for a hand-off
+type StickyMigrateNotification struct {
+	StickyID      string `json:"sticky_id"`
+	Tier          string `json:"tier"`
+	NewClientID   string `json:"new_client_id"`
+	NewEndpoint   string `json:"new_endpoint"`
+	MigrationTime string `json:"migration_time"`
+}
+
+// handleStickyByID routes DELETE /sticky/{sticky_id}/{tier} and POST /sticky/{sticky_id}/migrate
+func (s *Server) handleStickyByID(w http.ResponseWriter, r *http.Request) {
+	stickyID, action, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/sticky/"), "/")
+	if !ok || stickyID == "" || action == "" || strings.Contains(action, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case r.Method == http.MethodDelete:
+		s.handleStickyDelete(w, r, stickyID, action)
+	case action != "migrate":
+		http.NotFound(w, r)
+	case r.Method != http.MethodPost:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		s.handleStickyMigrate(w, r, stickyID)
+	}
+}
+
+// handleStickyMigrate handles POST /sticky/{sticky_id}/migrate: moves a sticky assignment to another backend
+func (s *Server) handleStickyMigrate(w http.ResponseWriter, r *http.Request, stickyID string) {
+	if s.isHashStickyMode() {
+		http.Error(w, "Sticky assignments are derived by hashing (sticky_mode: hash) and cannot be migrated", http.StatusConflict)
+		return
+	}
+
+	var req StickyMigrateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Tier == "" {
+		http.Error(w, "tier is required", http.StatusBadRequest)
+		return
+	}
+
+	tierSpec, _, ok := s.resolveTier(r, req.Tier)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Invalid tier: %s", req.Tier), http.StatusBadRequest)
+		return
+	}
+	// Operators may pass the raw sticky ID or the hashed form shown by /sticky/export
+	stickyID = s.adminStickyID(stickyID)
+	key := tenantStickyID(tierSpec.Tenant, stickyID)
+	s.syncStickyAssignments(key)
+
+	s.mu.RLock()
+	fromClientID := s.stickyAssignments[key][req.Tier]
+	s.mu.RUnlock()
+	if fromClientID == "" {
+		http.Error(w, fmt.Sprintf("No %s assignment for sticky ID: %s", req.Tier, stickyID), http.StatusNotFound)
+		return
+	}
+
+	target, err := s.selectMigrationTarget(tierSpec, fromClientID, req.TargetClientID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if target == nil {
+		s.writeNoBackend(w, tierSpec, 0, 0, "No backend available to migrate to")
+		return
+	}
+	toClientID := target.Registration.ClientID
+
+	// Swap only if the assignment is still the one we migrated from, so concurrent migrations
+	// or reassignments by the routing path are never silently overwritten
+	s.mu.Lock()
+	if s.stickyAssignments[key][req.Tier] != fromClientID {
+		s.mu.Unlock()
+		http.Error(w, "Sticky assignment changed during migration, retry", http.StatusConflict)
+		return
+	}
+	s.stickyAssignments[key][req.Tier] = toClientID
+	fromClient := s.clientCache[fromClientID]
+	s.mu.Unlock()
+
+	if err := s.stickyStore.Set(StickyAssignment{StickyID: key, Tier: req.Tier, ClientID: toClientID}); err != nil {
+		LogError(fmt.Sprintf("Failed to save migrated sticky assignment: %v", err))
+	}
+
+	// Reserve the session's resources on the new backend until its next stats report
+	s.addPendingAllocation(toClientID, key, req.Tier, tierSpec, fmt.Sprintf("%d-%s", time.Now().UnixNano(), key))
+
+	LogInfoWithData("Sticky assignment migrated", map[string]interface{}{
+		"sticky_id": stickyID,
+		"tenant":    tierSpec.Tenant,
+		"tier":      req.Tier,
+		"from":      fromClientID,
+		"to":        toClientID,
+	})
+	s.emit("sticky.migrated", map[string]interface{}{
+		"sticky_id":      stickyID,
+		"tenant":         tierSpec.Tenant,
+		"tier":           req.Tier,
+		"from_client_id": fromClientID,
+		"to_client_id":   toClientID,
+		"endpoint":       target.Endpoint,
+	})
+
+	response := map[string]interface{}{
+		"status":         "migrated",
+		"sticky_id":      stickyID,
+		"tier":           req.Tier,
+		"from_client_id": fromClientID,
+		"to_client_id":   toClientID,
+		"endpoint":       target.Endpoint,
+		"notified":       false,
+	}
+	if req.Notify {
+		if err := s.notifyStickyMigration(fromClient, stickyID, req.Tier, target); err != nil {
+			LogWarnWithData("Failed to notify old backend of sticky migration", map[string]interface{}{
+				"sticky_id": stickyID,
+				"client_id": fromClientID,
+				"error":     err.Error(),
+			})
+			response["notify_error"] = err.Error()
+		} else {
+			response["notified"] = true
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Warning: Failed to encode sticky migrate response: %v", err)
+	}
+}
+
+// selectMigrationTarget picks the backend a sticky assignment moves to
+// An explicit target must be live, healthy, in the tier's tenant and have room for the tier;
+// otherwise the best backend other than the current one is selected (nil if none fits)
+func (s *Server) selectMigrationTarget(tierSpec common.TierSpec, fromClientID, targetClientID string) (*ClientState, error) {
+	if targetClientID == "" {
+		tierSpec.ExcludeClientID = fromClientID
+		return s.findBestClient(tierSpec, 0, 0), nil
+	}
+	if targetClientID == fromClientID {
+		return nil, fmt.Errorf("Sticky ID is already assigned to %s", targetClientID)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	target, exists := s.clientCache[targetClientID]
+	switch {
+	case !exists || s.isStale(target):
+		return nil, fmt.Errorf("Target backend is not registered: %s", targetClientID)
+	case s.config.HealthCheckEnabled && target.HealthStatus == "unhealthy":
+		return nil, fmt.Errorf("Target backend is unhealthy: %s", targetClientID)
+	case !s.hasResourcesLocked(target, tierSpec):
+		return nil, fmt.Errorf("Target backend cannot fit tier %s: %s", tierSpec.Name, targetClientID)
+	}
+	return target, nil
+}
+
+// notifyStickyMigration asks the old backend to checkpoint/hand off a session to its new backend
+func (s *Server) notifyStickyMigration(from *ClientState, stickyID, tier string, to *ClientState) error {
+	if from == nil || from.Endpoint == "" {
+		return fmt.Errorf("old backend is no longer registered")
+	}
+
+	body, err := json.Marshal(StickyMigrateNotification{
+		StickyID:      stickyID,
+		Tier:          tier,
+		NewClientID:   to.Registration.ClientID,
+		NewEndpoint:   to.Endpoint,
+		MigrationTime: time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	path := s.config.StickyMigrateNotifyPath
+	if path == "" {
+		path = defaultStickyMigrateNotifyPath
+	}
+
+	client := &http.Client{
+		Timeout: stickyMigrateNotifyTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: s.config.TLSInsecureSkipVerify,
+			},
+		},
+	}
+	resp, err := client.Post(strings.TrimSuffix(from.Endpoint, "/")+path,
+		"application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("old backend returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestHandleStickyMigrate verifies the assignment moves to another backend, a webhook is emitted
+// and the old backend is asked to hand off
+func TestHandleStickyMigrate(t *testing.T) {
+	events := make(chan *http.Request, 1)
+	eventBodies := make(chan WebhookEvent, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event WebhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- r
+		eventBodies <- event
+	}))
+	defer hook.Close()
+
+	handoffs := make(chan StickyMigrateNotification, 1)
+	oldBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/opsen/migrate" {
+			http.NotFound(w, r)
+			return
+		}
+		var notification StickyMigrateNotification
+		json.NewDecoder(r.Body).Decode(&notification)
+		handoffs <- notification
+	}))
+	defer oldBackend.Close()
+
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.Webhooks = []common.WebhookConfig{{URL: hook.URL, Events: []string{"sticky.migrated"}, Secret: "s3cret"}}
+	})
+	defer server.webhooks.Close()
+
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "old", Endpoint: oldBackend.URL}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "new", Endpoint: "http://10.0.0.2:11000"}))
+	server.createStickyAssignment("default:user-1", "lite", "old")
+
+	body, _ := json.Marshal(StickyMigrateRequest{Tier: "lite", Notify: true})
+	rec := httptest.NewRecorder()
+	server.handleStickyByID(rec, httptest.NewRequest("POST", "/sticky/user-1/migrate", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp["from_client_id"] != "old" || resp["to_client_id"] != "new" || resp["notified"] != true {
+		t.Errorf("Unexpected migrate response: %+v", resp)
+	}
+	if got := server.stickyAssignments["default:user-1"]["lite"]; got != "new" {
+		t.Errorf("Expected assignment to move to new, got %s", got)
+	}
+
+	var persisted string
+	db.QueryRow("SELECT client_id FROM sticky_assignments WHERE sticky_id = ? AND tier = ?", "default:user-1", "lite").Scan(&persisted)
+	if persisted != "new" {
+		t.Errorf("Expected persisted assignment new, got %s", persisted)
+	}
+
+	select {
+	case notification := <-handoffs:
+		if notification.StickyID != "user-1" || notification.NewClientID != "new" {
+			t.Errorf("Unexpected hand-off notification: %+v", notification)
+		}
+	default:
+		t.Error("Expected old backend to be notified")
+	}
+
+	select {
+	case r := <-events:
+		event := <-eventBodies
+		if r.Header.Get(WebhookEventHeader) != "sticky.migrated" || r.Header.Get(WebhookSignatureHeader) == "" {
+			t.Errorf("Expected signed sticky.migrated delivery, got headers %v", r.Header)
+		}
+		if event.Data["from_client_id"] != "old" || event.Data["to_client_id"] != "new" {
+			t.Errorf("Unexpected webhook payload: %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected sticky.migrated webhook")
+	}
+}
+
+// TestHandleStickyMigrate_Errors verifies unknown assignments, bad targets and exhausted capacity are rejected
+func TestHandleStickyMigrate_Errors(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "only"}))
+	server.createStickyAssignment("default:user-1", "lite", "only")
+
+	migrate := func(path string, req StickyMigrateRequest) int {
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		server.handleStickyByID(rec, httptest.NewRequest("POST", path, bytes.NewReader(body)))
+		return rec.Code
+	}
+
+	if code := migrate("/sticky/unknown/migrate", StickyMigrateRequest{Tier: "lite"}); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unassigned sticky ID, got %d", code)
+	}
+	if code := migrate("/sticky/user-1/migrate", StickyMigrateRequest{Tier: "lite"}); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 with no other backend, got %d", code)
+	}
+	if code := migrate("/sticky/user-1/migrate", StickyMigrateRequest{Tier: "lite", TargetClientID: "missing"}); code != http.StatusConflict {
+		t.Errorf("Expected 409 for unknown target, got %d", code)
+	}
+	if code := migrate("/sticky/user-1/other", StickyMigrateRequest{Tier: "lite"}); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown sticky action, got %d", code)
+	}
+	if got := server.stickyAssignments["default:user-1"]["lite"]; got != "only" {
+		t.Errorf("Expected failed migrations to keep the assignment, got %s", got)
+	}
+}
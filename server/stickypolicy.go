@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"cyqle.in/opsen/common"
+)
+
+// What happens to a sticky session whose assigned backend cannot take it (sticky_policy, per tier)
+const (
+	StickyPolicyPrefer  = "prefer"  // Move the session to another backend (default)
+	StickyPolicyStrict  = "strict"  // Keep the assignment and refuse the request with 503
+	StickyPolicyDegrade = "degrade" // Move the session and tell the caller with X-LB-Sticky-Relocated
+)
+
+// LBStickyRelocatedHeader names why a session was moved off its assigned backend (sticky_policy: degrade)
+const LBStickyRelocatedHeader = "X-LB-Sticky-Relocated"
+
+// errCodeStickyUnavailable is sent in X-LB-Error-Code when a strict session's backend cannot take the request
+const errCodeStickyUnavailable = "sticky_backend_unavailable"
+
+// Reasons an assigned backend cannot take a sticky session
+const (
+	stickyReasonOffline    = "offline"
+	stickyReasonUnhealthy  = "unhealthy"
+	stickyReasonOverloaded = "overloaded"
+	stickyReasonLatency    = "latency_budget"
+)
+
+// stickyOutcome describes what happened to an existing sticky assignment during a placement
+type stickyOutcome struct {
+	Reason    string // Why the assigned backend could not take the request (empty if it could or none existed)
+	ClientID  string // The assigned backend
+	Held      bool   // strict: the assignment was kept and no backend selected
+	Relocated bool   // degrade: the session was placed on another backend
+	Created   bool   // The request created the sticky assignment it was placed with
+}
+
+// validateStickyPolicy checks a tier's sticky_policy
+func validateStickyPolicy(tier common.TierSpec) error {
+	switch tier.StickyPolicy {
+	case "", StickyPolicyPrefer, StickyPolicyStrict, StickyPolicyDegrade:
+		return nil
+	default:
+		return fmt.Errorf("tier %s: unknown sticky_policy %q (want %s, %s or %s)", tier.Name, tier.StickyPolicy,
+			StickyPolicyPrefer, StickyPolicyStrict, StickyPolicyDegrade)
+	}
+}
+
+// holdStickyAssignment reports whether a strict tier keeps an assignment whose backend cannot take the request
+// Backends that went offline take the session state with them, so those assignments are always released
+func holdStickyAssignment(stickyID string, tierSpec common.TierSpec, clientID, reason string) bool {
+	if tierSpec.StickyPolicy != StickyPolicyStrict || reason == stickyReasonOffline {
+		return false
+	}
+	LogWarn(fmt.Sprintf("Sticky assignment backend %s, strict policy keeps the session: sticky_id=%s tier=%s client=%s",
+		reason, stickyID, tierSpec.Name, clientID))
+	return true
+}
+
+// writeStickyOutcome answers 503 for a held strict session, or marks a degraded relocation on the response
+// Returns false when the request was refused
+func writeStickyOutcome(w http.ResponseWriter, tierSpec common.TierSpec, outcome stickyOutcome) bool {
+	if outcome.Held {
+		w.Header().Set(LBErrorCodeHeader, errCodeStickyUnavailable)
+		http.Error(w, fmt.Sprintf("Assigned backend %s for tier %s is %s and the session cannot be moved (sticky_policy: strict)",
+			outcome.ClientID, tierSpec.Name, outcome.Reason), http.StatusServiceUnavailable)
+		return false
+	}
+	if outcome.Relocated {
+		w.Header().Set(LBStickyRelocatedHeader, outcome.Reason)
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// newStickyPolicyServer places user-1's session for tier on backend "a" and then overloads "a"
+func newStickyPolicyServer(t *testing.T, policy string) *Server {
+	t.Helper()
+	db, cleanup := CreateTestDB(t)
+	t.Cleanup(cleanup)
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.Tiers = append(c.Tiers, common.TierSpec{Name: "stateful", VCPU: 1, MemoryGB: 1.0, StorageGB: 5, StickyPolicy: policy})
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "a", CPUUsageAvg: []float64{5, 5, 5, 5, 5, 5, 5, 5}}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "b", CPUUsageAvg: []float64{30, 30, 30, 30, 30, 30, 30, 30}}))
+
+	if rec := routeSticky(server, "user-1", "stateful"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the session to be placed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	server.mu.Lock()
+	server.clientCache["a"].Stats.CPUUsageAvg = []float64{95, 95, 95, 95, 95, 95, 95, 95}
+	server.invalidateRoutingSnapshot()
+	server.mu.Unlock()
+	return server
+}
+
+// decodeRoutingClientID returns the backend a /route response placed the request on
+func decodeRoutingClientID(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp common.RoutingResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid routing response: %v", err)
+	}
+	return resp.ClientID
+}
+
+// TestStickyPolicy_Strict verifies a strict session is refused with 503 and keeps its assignment
+func TestStickyPolicy_Strict(t *testing.T) {
+	server := newStickyPolicyServer(t, StickyPolicyStrict)
+
+	rec := routeSticky(server, "user-1", "stateful")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 instead of moving the session, got %d", rec.Code)
+	}
+	if got := rec.Header().Get(LBErrorCodeHeader); got != errCodeStickyUnavailable {
+		t.Errorf("Expected %s: %s, got %q", LBErrorCodeHeader, errCodeStickyUnavailable, got)
+	}
+
+	// The session returns to its backend once it has capacity again
+	server.mu.Lock()
+	server.clientCache["a"].Stats.CPUUsageAvg = []float64{5, 5, 5, 5, 5, 5, 5, 5}
+	server.invalidateRoutingSnapshot()
+	server.mu.Unlock()
+	rec = routeSticky(server, "user-1", "stateful")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the session to be routed again, got %d", rec.Code)
+	}
+	if id := decodeRoutingClientID(t, rec); id != "a" {
+		t.Errorf("Expected the session to stay on a, got %s", id)
+	}
+}
+
+// TestStickyPolicy_Degrade verifies a degraded session moves and the response says why
+func TestStickyPolicy_Degrade(t *testing.T) {
+	server := newStickyPolicyServer(t, StickyPolicyDegrade)
+
+	rec := routeSticky(server, "user-1", "stateful")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the session to be moved, got %d", rec.Code)
+	}
+	if id := decodeRoutingClientID(t, rec); id != "b" {
+		t.Errorf("Expected the session on b, got %s", id)
+	}
+	if got := rec.Header().Get(LBStickyRelocatedHeader); got != stickyReasonOverloaded {
+		t.Errorf("Expected %s: %s, got %q", LBStickyRelocatedHeader, stickyReasonOverloaded, got)
+	}
+
+	// Later requests follow the new assignment without the header
+	rec = routeSticky(server, "user-1", "stateful")
+	if got := rec.Header().Get(LBStickyRelocatedHeader); got != "" {
+		t.Errorf("Expected no relocation header on the new backend, got %q", got)
+	}
+}
+
+// TestStickyPolicy_Prefer verifies the default policy moves the session silently
+func TestStickyPolicy_Prefer(t *testing.T) {
+	server := newStickyPolicyServer(t, "")
+
+	rec := routeSticky(server, "user-1", "stateful")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the session to be moved, got %d", rec.Code)
+	}
+	if id := decodeRoutingClientID(t, rec); id != "b" {
+		t.Errorf("Expected the session on b, got %s", id)
+	}
+	if got := rec.Header().Get(LBStickyRelocatedHeader); got != "" {
+		t.Errorf("Expected no relocation header, got %q", got)
+	}
+}
+
+// TestValidateStickyPolicy verifies unknown policies are rejected
+func TestValidateStickyPolicy(t *testing.T) {
+	if _, err := buildTierSpecs([]common.TierSpec{{Name: "lite", VCPU: 1, StickyPolicy: "sometimes"}}); err == nil {
+		t.Error("Expected an error for an unknown sticky_policy")
+	}
+	if _, err := buildTierSpecs([]common.TierSpec{{Name: "lite", VCPU: 1, StickyPolicy: StickyPolicyStrict}}); err != nil {
+		t.Errorf("Expected strict to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Page size of GET /sticky
+const (
+	defaultStickyListLimit = 100
+	maxStickyListLimit     = 1000
+)
+
+// StickyListEntry is one assignment returned by GET /sticky
+type StickyListEntry struct {
+	StickyID   string    `json:"sticky_id"`
+	Tier       string    `json:"tier"`
+	ClientID   string    `json:"client_id"`
+	Endpoint   string    `json:"endpoint,omitempty"` // Empty if the backend is not registered
+	CreatedAt  time.Time `json:"created_at,omitempty"`
+	LastUsed   time.Time `json:"last_used"`
+	Registered bool      `json:"registered"`
+}
+
+// handleStickyList answers "where is this session?": GET /sticky?sticky_id=&client_id=&tier=&limit=
+// Assignments are returned most recently used first
+func (s *Server) handleStickyList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.isHashStickyMode() {
+		http.Error(w, "Sticky assignments are derived by hashing (sticky_mode: hash) and are not stored", http.StatusConflict)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := defaultStickyListLimit
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid limit: %s", raw), http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxStickyListLimit)
+	}
+
+	// Operators may pass the raw sticky ID or the hashed form; tenant-scoped IDs are addressed with X-Tenant
+	key := ""
+	if stickyID := query.Get("sticky_id"); stickyID != "" {
+		key = tenantStickyID(requestTenant(r), s.adminStickyID(stickyID))
+	}
+	clientID, tier := query.Get("client_id"), query.Get("tier")
+
+	assignments, err := s.stickyStore.List(key)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to query sticky assignments: %v", err), http.StatusInternalServerError)
+		return
+	}
+	matched := assignments[:0]
+	for _, assignment := range assignments {
+		if (clientID == "" || assignment.ClientID == clientID) && (tier == "" || assignment.Tier == tier) {
+			matched = append(matched, assignment)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].LastUsed.After(matched[j].LastUsed)
+	})
+
+	total := len(matched)
+	if total > limit {
+		matched = matched[:limit]
+	}
+
+	entries := make([]StickyListEntry, 0, len(matched))
+	s.mu.RLock()
+	for _, assignment := range matched {
+		entry := StickyListEntry{
+			StickyID:  assignment.StickyID,
+			Tier:      assignment.Tier,
+			ClientID:  assignment.ClientID,
+			CreatedAt: assignment.CreatedAt,
+			LastUsed:  assignment.LastUsed,
+		}
+		if client, ok := s.clientCache[assignment.ClientID]; ok {
+			entry.Endpoint = client.Endpoint
+			entry.Registered = true
+		}
+		entries = append(entries, entry)
+	}
+	s.mu.RUnlock()
+
+	response := map[string]interface{}{
+		"assignments": entries,
+		"count":       len(entries),
+		"total":       total,
+		"truncated":   total > len(entries),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Warning: Failed to encode sticky list: %v", err)
+	}
+}
+
+// handleStickyDelete handles DELETE /sticky/{sticky_id}/{tier}: removes one assignment so the
+// session is placed afresh on its next request
+func (s *Server) handleStickyDelete(w http.ResponseWriter, r *http.Request, stickyID, tier string) {
+	if s.isHashStickyMode() {
+		http.Error(w, "Sticky assignments are derived by hashing (sticky_mode: hash) and cannot be removed", http.StatusConflict)
+		return
+	}
+
+	stickyID = s.adminStickyID(stickyID)
+	tenant := requestTenant(r)
+	key := tenantStickyID(tenant, stickyID)
+
+	assignment, err := s.stickyStore.Get(key, tier)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to query sticky assignment: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if assignment == nil {
+		http.Error(w, fmt.Sprintf("No %s assignment for sticky ID: %s", tier, stickyID), http.StatusNotFound)
+		return
+	}
+	s.removeStickyAssignment(key, tier)
+
+	LogInfoWithData("Sticky assignment removed", map[string]interface{}{
+		"sticky_id": stickyID,
+		"tenant":    tenant,
+		"tier":      tier,
+		"client_id": assignment.ClientID,
+		"actor":     requestActor(r),
+	})
+	s.emit("sticky.removed", map[string]interface{}{
+		"sticky_id": stickyID,
+		"tenant":    tenant,
+		"tier":      tier,
+		"client_id": assignment.ClientID,
+		"actor":     requestActor(r),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "removed",
+		"sticky_id": stickyID,
+		"tier":      tier,
+		"client_id": assignment.ClientID,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode sticky delete response: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type stickyListResponse struct {
+	Assignments []StickyListEntry `json:"assignments"`
+	Count       int               `json:"count"`
+	Total       int               `json:"total"`
+	Truncated   bool              `json:"truncated"`
+}
+
+func listSticky(t *testing.T, server *Server, query string) stickyListResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	server.handleStickyList(rec, httptest.NewRequest("GET", "/sticky"+query, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for %q, got %d: %s", query, rec.Code, rec.Body.String())
+	}
+	var response stickyListResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return response
+}
+
+// TestHandleStickyList verifies assignments are filtered by sticky ID, backend and tier with their timestamps
+func TestHandleStickyList(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-a", Endpoint: "http://10.0.0.1:11000"}))
+	server.createStickyAssignment("default:user-1", "lite", "backend-a")
+	server.createStickyAssignment("default:user-1", "pro-max", "backend-b")
+	server.createStickyAssignment("default:user-2", "lite", "backend-a")
+
+	held := listSticky(t, server, "?sticky_id=user-1")
+	if held.Count != 2 || held.Total != 2 {
+		t.Fatalf("Expected user-1's two assignments, got %+v", held)
+	}
+	for _, entry := range held.Assignments {
+		if entry.StickyID != "default:user-1" || entry.CreatedAt.IsZero() || entry.LastUsed.IsZero() {
+			t.Errorf("Expected user-1's assignment with timestamps, got %+v", entry)
+		}
+		if entry.ClientID == "backend-a" && (!entry.Registered || entry.Endpoint != "http://10.0.0.1:11000") {
+			t.Errorf("Expected the registered backend's endpoint, got %+v", entry)
+		}
+		if entry.ClientID == "backend-b" && entry.Registered {
+			t.Errorf("Expected an unregistered backend to be flagged, got %+v", entry)
+		}
+	}
+
+	if onA := listSticky(t, server, "?client_id=backend-a&tier=lite"); onA.Count != 2 {
+		t.Errorf("Expected both lite sessions on backend-a, got %+v", onA)
+	}
+	if page := listSticky(t, server, "?limit=1"); page.Count != 1 || page.Total != 3 || !page.Truncated {
+		t.Errorf("Expected one of three assignments, got %+v", page)
+	}
+
+	rec := httptest.NewRecorder()
+	server.handleStickyList(rec, httptest.NewRequest("GET", "/sticky?limit=zero", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid limit, got %d", rec.Code)
+	}
+}
+
+// TestHandleStickyDelete verifies DELETE /sticky/{sticky_id}/{tier} removes only that assignment
+func TestHandleStickyDelete(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	server.createStickyAssignment("default:user-1", "lite", "backend-a")
+	server.createStickyAssignment("default:user-1", "pro-max", "backend-b")
+
+	rec := httptest.NewRecorder()
+	server.handleStickyByID(rec, httptest.NewRequest("DELETE", "/sticky/user-1/lite", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	server.mu.RLock()
+	tiers := server.stickyAssignments["default:user-1"]
+	server.mu.RUnlock()
+	if _, ok := tiers["lite"]; ok || tiers["pro-max"] != "backend-b" {
+		t.Errorf("Expected only the lite assignment to be removed, got %v", tiers)
+	}
+	if remaining := listSticky(t, server, "?sticky_id=user-1"); remaining.Count != 1 || remaining.Assignments[0].Tier != "pro-max" {
+		t.Errorf("Expected the store to keep only pro-max, got %+v", remaining)
+	}
+
+	rec = httptest.NewRecorder()
+	server.handleStickyByID(rec, httptest.NewRequest("DELETE", "/sticky/user-1/lite", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a removed assignment, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	server.handleStickyByID(rec, httptest.NewRequest("GET", "/sticky/user-1/migrate", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET on migrate, got %d", rec.Code)
+	}
+}
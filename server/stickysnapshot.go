@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// sqliteTimeFormat matches CURRENT_TIMESTAMP so imported and native timestamps compare correctly
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+// StickySnapshotEntry is one exported sticky assignment
+type StickySnapshotEntry struct {
+	StickyID  string    `json:"sticky_id"`
+	Tier      string    `json:"tier"`
+	ClientID  string    `json:"client_id"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	LastUsed  time.Time `json:"last_used"`
+}
+
+// StickySnapshot is the payload of GET /sticky/export and POST /sticky/import
+type StickySnapshot struct {
+	ExportedAt  time.Time             `json:"exported_at"`
+	Assignments []StickySnapshotEntry `json:"assignments"`
+}
+
+// handleStickyExport returns all sticky assignments in the sticky store as a JSON snapshot
+func (s *Server) handleStickyExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	assignments, err := s.stickyStore.List("")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to query sticky assignments: %v", err), http.StatusInternalServerError)
+		return
+	}
+	sort.SliceStable(assignments, func(i, j int) bool {
+		if assignments[i].StickyID != assignments[j].StickyID {
+			return assignments[i].StickyID < assignments[j].StickyID
+		}
+		return assignments[i].Tier < assignments[j].Tier
+	})
+
+	snapshot := StickySnapshot{
+		ExportedAt:  time.Now().UTC(),
+		Assignments: make([]StickySnapshotEntry, 0, len(assignments)),
+	}
+	for _, assignment := range assignments {
+		snapshot.Assignments = append(snapshot.Assignments, StickySnapshotEntry{
+			StickyID:  assignment.StickyID,
+			Tier:      assignment.Tier,
+			ClientID:  assignment.ClientID,
+			CreatedAt: assignment.CreatedAt,
+			LastUsed:  assignment.LastUsed,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		log.Printf("Warning: Failed to encode sticky export: %v", err)
+	}
+}
+
+// handleStickyImport loads a sticky snapshot, e.g. to warm a standby instance before failover
+// Default mode "merge" keeps whichever assignment was used most recently; "replace" discards
+// existing assignments first
+func (s *Server) handleStickyImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = "merge"
+	}
+	if mode != "merge" && mode != "replace" {
+		http.Error(w, fmt.Sprintf("Invalid mode: %s (expected merge or replace)", mode), http.StatusBadRequest)
+		return
+	}
+
+	var snapshot StickySnapshot
+	if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if mode == "replace" {
+		existing, err := s.stickyStore.List("")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to clear sticky assignments: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for _, assignment := range existing {
+			if err := s.stickyStore.Delete(assignment.StickyID, assignment.Tier); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to clear sticky assignments: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	imported, skipped := 0, 0
+	now := time.Now().UTC()
+	for _, entry := range snapshot.Assignments {
+		if entry.StickyID == "" || entry.Tier == "" || entry.ClientID == "" {
+			skipped++
+			continue
+		}
+		entry.StickyID = s.hashStoredStickyID(entry.StickyID)
+		lastUsed := entry.LastUsed
+		if lastUsed.IsZero() {
+			lastUsed = now
+		}
+		createdAt := entry.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = lastUsed
+		}
+
+		// Keep whichever assignment was used most recently, to the second like CURRENT_TIMESTAMP
+		existing, err := s.stickyStore.Get(entry.StickyID, entry.Tier)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to import sticky assignment: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if existing != nil && !lastUsed.Truncate(time.Second).After(existing.LastUsed.Truncate(time.Second)) {
+			skipped++
+			continue
+		}
+		if err := s.stickyStore.Set(StickyAssignment{
+			StickyID:  entry.StickyID,
+			Tier:      entry.Tier,
+			ClientID:  entry.ClientID,
+			CreatedAt: createdAt,
+			LastUsed:  lastUsed,
+		}); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to import sticky assignment: %v", err), http.StatusInternalServerError)
+			return
+		}
+		imported++
+	}
+
+	// Rebuild the in-memory assignments from the merged store
+	if err := s.loadStickyAssignments(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reload sticky assignments: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Assignments to backends this instance has not seen yet are kept; they apply once the backend registers
+	s.mu.RLock()
+	unknownClients := make(map[string]bool)
+	for _, entry := range snapshot.Assignments {
+		if _, ok := s.clientCache[entry.ClientID]; !ok && entry.ClientID != "" {
+			unknownClients[entry.ClientID] = true
+		}
+	}
+	s.mu.RUnlock()
+
+	LogInfoWithData("Imported sticky assignments", map[string]interface{}{
+		"mode":            mode,
+		"imported":        imported,
+		"skipped":         skipped,
+		"unknown_clients": len(unknownClients),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":          "imported",
+		"mode":            mode,
+		"imported":        imported,
+		"skipped":         skipped,
+		"unknown_clients": len(unknownClients),
+	}); err != nil {
+		log.Printf("Warning: Failed to encode sticky import response: %v", err)
+	}
+}
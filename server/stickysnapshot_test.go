@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestStickySnapshot_ExportImportRoundTrip verifies a snapshot from one instance warms another
+func TestStickySnapshot_ExportImportRoundTrip(t *testing.T) {
+	primaryDB, cleanupPrimary := CreateTestDB(t)
+	defer cleanupPrimary()
+	standbyDB, cleanupStandby := CreateTestDB(t)
+	defer cleanupStandby()
+
+	primary := NewTestServer(t, primaryDB)
+	primary.createStickyAssignment("default:user-1", "lite", "backend-a")
+	primary.createStickyAssignment("default:user-2", "pro-max", "backend-b")
+
+	rec := httptest.NewRecorder()
+	primary.handleStickyExport(rec, httptest.NewRequest("GET", "/sticky/export", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected export to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var snapshot StickySnapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &snapshot); err != nil {
+		t.Fatalf("Failed to parse snapshot: %v", err)
+	}
+	if len(snapshot.Assignments) != 2 || snapshot.Assignments[0].LastUsed.IsZero() {
+		t.Fatalf("Expected 2 assignments with last_used, got %+v", snapshot.Assignments)
+	}
+
+	standby := NewTestServer(t, standbyDB)
+	body, _ := json.Marshal(snapshot)
+	rec = httptest.NewRecorder()
+	standby.handleStickyImport(rec, httptest.NewRequest("POST", "/sticky/import", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected import to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	if response["imported"] != float64(2) || response["unknown_clients"] != float64(2) {
+		t.Errorf("Expected 2 imported assignments for 2 unknown clients, got %v", response)
+	}
+
+	standby.mu.RLock()
+	clientID := standby.stickyAssignments["default:user-2"]["pro-max"]
+	standby.mu.RUnlock()
+	if clientID != "backend-b" {
+		t.Errorf("Expected user-2 pro-max on backend-b, got %q", clientID)
+	}
+}
+
+// TestStickyImport_MergeKeepsNewest verifies merge only overwrites assignments with older last_used
+func TestStickyImport_MergeKeepsNewest(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	server.createStickyAssignment("default:user-1", "lite", "backend-current")
+
+	snapshot := StickySnapshot{Assignments: []StickySnapshotEntry{
+		{StickyID: "user-1", Tier: "lite", ClientID: "backend-stale", LastUsed: time.Now().Add(-time.Hour)},
+		{StickyID: "user-2", Tier: "lite", ClientID: "backend-new", LastUsed: time.Now()},
+		{StickyID: "", Tier: "lite", ClientID: "backend-invalid"},
+	}}
+	body, _ := json.Marshal(snapshot)
+
+	rec := httptest.NewRecorder()
+	server.handleStickyImport(rec, httptest.NewRequest("POST", "/sticky/import", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected import to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	if got := server.stickyAssignments["default:user-1"]["lite"]; got != "backend-current" {
+		t.Errorf("Expected newer local assignment to win, got %q", got)
+	}
+	if got := server.stickyAssignments["default:user-2"]["lite"]; got != "backend-new" {
+		t.Errorf("Expected new assignment to be imported, got %q", got)
+	}
+}
+
+// TestStickyImport_Replace verifies replace mode discards existing assignments
+func TestStickyImport_Replace(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	server.createStickyAssignment("default:user-1", "lite", "backend-a")
+
+	body := []byte(`{"assignments":[{"sticky_id":"user-9","tier":"lite","client_id":"backend-z"}]}`)
+	rec := httptest.NewRecorder()
+	server.handleStickyImport(rec, httptest.NewRequest("POST", "/sticky/import?mode=replace", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected import to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	server.handleStickyImport(rec, httptest.NewRequest("POST", "/sticky/import?mode=bogus", bytes.NewReader(body)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid mode, got %d", rec.Code)
+	}
+
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	if _, exists := server.stickyAssignments["default:user-1"]; exists {
+		t.Error("Expected existing assignments to be replaced")
+	}
+	if got := server.stickyAssignments["default:user-9"]["lite"]; got != "backend-z" {
+		t.Errorf("Expected user-9 on backend-z, got %q", got)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// Sticky store backends (sticky_store)
+const (
+	StickyStoreSQLite = "sqlite" // sticky_assignments table of the server's database (default)
+	StickyStoreRedis  = "redis"  // Shared Redis, for several LB replicas
+)
+
+// StickyAssignment is one persisted sticky_id+tier → backend mapping
+type StickyAssignment struct {
+	StickyID  string
+	Tier      string
+	ClientID  string
+	CreatedAt time.Time
+	LastUsed  time.Time
+}
+
+// StickyStore persists sticky assignments
+// The server keeps every assignment it knows in memory; the store makes them survive restarts and,
+// when Shared, visible to other replicas, in which case the server reads a sticky ID through on use
+type StickyStore interface {
+	Get(stickyID, tier string) (*StickyAssignment, error) // nil if not assigned
+	Set(assignment StickyAssignment) error                // Zero CreatedAt/LastUsed mean now
+	Claim(assignment StickyAssignment) (string, error)    // Sets the assignment unless the tier is taken; returns the holder
+	Touch(stickyID, tier string) error                    // Marks an assignment used now
+	Delete(stickyID, tier string) error
+	List(stickyID string) ([]StickyAssignment, error) // Assignments of one sticky ID, or all for ""
+	Shared() bool                                     // Other replicas may change assignments
+}
+
+// SQLiteStickyStore keeps assignments in the sticky_assignments table, signed with db_signing_key when set
+type SQLiteStickyStore struct {
+	db         *sql.DB
+	signingKey string
+}
+
+// NewSQLiteStickyStore creates the default sticky store
+func NewSQLiteStickyStore(db *sql.DB, signingKey string) *SQLiteStickyStore {
+	return &SQLiteStickyStore{db: db, signingKey: signingKey}
+}
+
+// signature returns the row_hmac for an assignment (nil when signing is disabled)
+func (st *SQLiteStickyStore) signature(stickyID, tier, clientID string) interface{} {
+	if st.signingKey == "" {
+		return nil
+	}
+	return common.SignRow(st.signingKey, "sticky_assignments", stickyID, tier, clientID)
+}
+
+// validSignature reports whether a loaded row may be trusted; unsigned rows predate signing and are kept
+func (st *SQLiteStickyStore) validSignature(signature sql.NullString, stickyID, tier, clientID string) bool {
+	if st.signingKey == "" || signature.String == "" {
+		return true
+	}
+	return common.VerifyRow(st.signingKey, "sticky_assignments", signature.String, stickyID, tier, clientID)
+}
+
+func (st *SQLiteStickyStore) Get(stickyID, tier string) (*StickyAssignment, error) {
+	assignment := &StickyAssignment{StickyID: stickyID, Tier: tier}
+	var rowHMAC sql.NullString
+	err := st.db.QueryRow(`
+		SELECT client_id, created_at, last_used, row_hmac FROM sticky_assignments
+		WHERE sticky_id = ? AND tier = ?
+	`, stickyID, tier).Scan(&assignment.ClientID, &assignment.CreatedAt, &assignment.LastUsed, &rowHMAC)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !st.validSignature(rowHMAC, stickyID, tier, assignment.ClientID) {
+		return nil, nil
+	}
+	return assignment, nil
+}
+
+func (st *SQLiteStickyStore) Set(assignment StickyAssignment) error {
+	_, err := st.db.Exec(`
+		INSERT OR REPLACE INTO sticky_assignments (sticky_id, tier, client_id, row_hmac, created_at, last_used)
+		VALUES (?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP), COALESCE(?, CURRENT_TIMESTAMP))
+	`, assignment.StickyID, assignment.Tier, assignment.ClientID,
+		st.signature(assignment.StickyID, assignment.Tier, assignment.ClientID),
+		sqliteTime(assignment.CreatedAt), sqliteTime(assignment.LastUsed))
+	return err
+}
+
+// Claim inserts the assignment unless the sticky ID already holds the tier, and returns the backend holding it
+func (st *SQLiteStickyStore) Claim(assignment StickyAssignment) (string, error) {
+	if _, err := st.db.Exec(`
+		INSERT OR IGNORE INTO sticky_assignments (sticky_id, tier, client_id, row_hmac, created_at, last_used)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, assignment.StickyID, assignment.Tier, assignment.ClientID,
+		st.signature(assignment.StickyID, assignment.Tier, assignment.ClientID)); err != nil {
+		return "", err
+	}
+	existing, err := st.Get(assignment.StickyID, assignment.Tier)
+	if err != nil {
+		return "", err
+	}
+	if existing == nil {
+		// The held row failed its signature check; replace it
+		return assignment.ClientID, st.Set(assignment)
+	}
+	return existing.ClientID, nil
+}
+
+func (st *SQLiteStickyStore) Touch(stickyID, tier string) error {
+	_, err := st.db.Exec(`UPDATE sticky_assignments SET last_used = CURRENT_TIMESTAMP
+		WHERE sticky_id = ? AND tier = ?`, stickyID, tier)
+	return err
+}
+
+func (st *SQLiteStickyStore) Delete(stickyID, tier string) error {
+	_, err := st.db.Exec("DELETE FROM sticky_assignments WHERE sticky_id = ? AND tier = ?", stickyID, tier)
+	return err
+}
+
+// List returns assignments ordered by sticky ID, then least recently used first
+// Rows whose signature does not match are left out
+func (st *SQLiteStickyStore) List(stickyID string) ([]StickyAssignment, error) {
+	query := "SELECT sticky_id, tier, client_id, created_at, last_used, row_hmac FROM sticky_assignments"
+	var args []interface{}
+	if stickyID != "" {
+		query += " WHERE sticky_id = ?"
+		args = append(args, stickyID)
+	}
+	rows, err := st.db.Query(query+" ORDER BY sticky_id, last_used ASC, rowid ASC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var assignments []StickyAssignment
+	rejected := 0
+	for rows.Next() {
+		var assignment StickyAssignment
+		var rowHMAC sql.NullString
+		if err := rows.Scan(&assignment.StickyID, &assignment.Tier, &assignment.ClientID,
+			&assignment.CreatedAt, &assignment.LastUsed, &rowHMAC); err != nil {
+			log.Printf("Warning: Skipping unreadable sticky assignment: %v", err)
+			continue
+		}
+		if !st.validSignature(rowHMAC, assignment.StickyID, assignment.Tier, assignment.ClientID) {
+			rejected++
+			continue
+		}
+		assignments = append(assignments, assignment)
+	}
+	if rejected > 0 {
+		LogWarnWithData("Ignored sticky assignments with invalid row signatures", map[string]interface{}{
+			"count": rejected,
+		})
+	}
+	return assignments, rows.Err()
+}
+
+func (st *SQLiteStickyStore) Shared() bool {
+	return false
+}
+
+// sqliteTime formats a timestamp like CURRENT_TIMESTAMP, or returns nil for the zero time
+func sqliteTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(sqliteTimeFormat)
+}
+
+// syncStickyAssignments reads a sticky ID's assignments through from a shared store into memory,
+// so placements made (or dropped) by other replicas apply here. A failed read keeps the memory copy
+func (s *Server) syncStickyAssignments(stickyID string) {
+	if stickyID == "" || !s.stickyStore.Shared() {
+		return
+	}
+	assignments, err := s.stickyStore.List(stickyID)
+	if err != nil {
+		log.Printf("Warning: Failed to read sticky assignments from store: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(assignments) == 0 {
+		delete(s.stickyAssignments, stickyID)
+		return
+	}
+	tierMap := make(map[string]string, len(assignments))
+	for _, assignment := range assignments {
+		tierMap[assignment.Tier] = assignment.ClientID
+	}
+	s.stickyAssignments[stickyID] = tierMap
+}
+
+// syncRequestStickyAssignments reads a request's sticky assignments through from a shared store once;
+// shedding, session limits and placement for the request then consult memory only
+func (s *Server) syncRequestStickyAssignments(stickyID string, tierSpec common.TierSpec) {
+	if s.isHashStickyMode() {
+		return
+	}
+	s.syncStickyAssignments(tenantStickyID(tierSpec.Tenant, stickyID))
+}
+
+// validateStickyStore checks sticky_store and sticky_ttl_seconds
+func validateStickyStore(config *common.ServerConfig) error {
+	switch config.StickyStore {
+	case "", StickyStoreSQLite, StickyStoreRedis:
+	default:
+		return fmt.Errorf("invalid sticky_store: %s (expected %s or %s)", config.StickyStore, StickyStoreSQLite, StickyStoreRedis)
+	}
+	if config.StickyTTLSecs < 0 {
+		return fmt.Errorf("sticky_ttl_seconds must be >= 0")
+	}
+	if config.StickyTTLSecs > 0 && config.StickyStore != StickyStoreRedis {
+		return fmt.Errorf("sticky_ttl_seconds requires sticky_store: %s", StickyStoreRedis)
+	}
+	return nil
+}
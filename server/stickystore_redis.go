@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Field prefixes of a sticky ID's Redis hash; one field of each per tier
+const (
+	redisStickyClientField  = "client:"
+	redisStickyCreatedField = "created:"
+	redisStickyUsedField    = "used:"
+)
+
+// redisStickyTouchScript marks an assignment used and refreshes the sticky ID's TTL, if it still exists
+// KEYS[1] = sticky ID hash, ARGV = tier, now (ms), ttl (ms, 0 = none)
+var redisStickyTouchScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], 'client:' .. ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'used:' .. ARGV[1], ARGV[2])
+if tonumber(ARGV[3]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+return 1
+`)
+
+// redisStickyClaimScript assigns a tier unless another replica already did, and returns the assigned backend
+// KEYS[1] = sticky ID hash, ARGV = tier, client ID, now (ms), ttl (ms, 0 = none)
+var redisStickyClaimScript = redis.NewScript(`
+if redis.call('HSETNX', KEYS[1], 'client:' .. ARGV[1], ARGV[2]) == 0 then
+	return redis.call('HGET', KEYS[1], 'client:' .. ARGV[1])
+end
+redis.call('HSET', KEYS[1], 'created:' .. ARGV[1], ARGV[3], 'used:' .. ARGV[1], ARGV[3])
+if tonumber(ARGV[4]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+end
+return ARGV[2]
+`)
+
+// RedisStickyStore keeps sticky assignments in Redis so all LB replicas share them
+// Each sticky ID is one hash holding its tiers; it expires ttl after its last use, which
+// replaces any cleanup of abandoned sessions
+type RedisStickyStore struct {
+	client    *redis.Client
+	keyPrefix string
+	ttl       time.Duration // 0 = assignments never expire
+	timeout   time.Duration
+	now       func() time.Time
+}
+
+// NewRedisStickyStore creates a Redis-backed sticky store
+func NewRedisStickyStore(client *redis.Client, keyPrefix string, ttl time.Duration) *RedisStickyStore {
+	return &RedisStickyStore{
+		client:    client,
+		keyPrefix: keyPrefix,
+		ttl:       ttl,
+		timeout:   500 * time.Millisecond,
+		now:       time.Now,
+	}
+}
+
+// Ping checks that Redis is reachable
+func (st *RedisStickyStore) Ping(ctx context.Context) error {
+	return st.client.Ping(ctx).Err()
+}
+
+func (st *RedisStickyStore) key(stickyID string) string {
+	return st.keyPrefix + "sticky:" + stickyID
+}
+
+func (st *RedisStickyStore) Get(stickyID, tier string) (*StickyAssignment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), st.timeout)
+	defer cancel()
+
+	values, err := st.client.HMGet(ctx, st.key(stickyID),
+		redisStickyClientField+tier, redisStickyCreatedField+tier, redisStickyUsedField+tier).Result()
+	if err != nil {
+		return nil, err
+	}
+	clientID, _ := values[0].(string)
+	if clientID == "" {
+		return nil, nil
+	}
+	created, _ := values[1].(string)
+	used, _ := values[2].(string)
+	return &StickyAssignment{
+		StickyID:  stickyID,
+		Tier:      tier,
+		ClientID:  clientID,
+		CreatedAt: parseRedisMillis(created),
+		LastUsed:  parseRedisMillis(used),
+	}, nil
+}
+
+func (st *RedisStickyStore) Set(assignment StickyAssignment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), st.timeout)
+	defer cancel()
+
+	now := st.now()
+	if assignment.CreatedAt.IsZero() {
+		assignment.CreatedAt = now
+	}
+	if assignment.LastUsed.IsZero() {
+		assignment.LastUsed = now
+	}
+	key := st.key(assignment.StickyID)
+	_, err := st.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key,
+			redisStickyClientField+assignment.Tier, assignment.ClientID,
+			redisStickyCreatedField+assignment.Tier, assignment.CreatedAt.UnixMilli(),
+			redisStickyUsedField+assignment.Tier, assignment.LastUsed.UnixMilli())
+		if st.ttl > 0 {
+			pipe.PExpire(ctx, key, st.ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// Claim assigns a tier atomically, so replicas placing the same new session at once agree on one backend
+func (st *RedisStickyStore) Claim(assignment StickyAssignment) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), st.timeout)
+	defer cancel()
+
+	return redisStickyClaimScript.Run(ctx, st.client, []string{st.key(assignment.StickyID)},
+		assignment.Tier, assignment.ClientID, st.now().UnixMilli(), st.ttl.Milliseconds()).Text()
+}
+
+func (st *RedisStickyStore) Touch(stickyID, tier string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), st.timeout)
+	defer cancel()
+
+	return redisStickyTouchScript.Run(ctx, st.client, []string{st.key(stickyID)},
+		tier, st.now().UnixMilli(), st.ttl.Milliseconds()).Err()
+}
+
+// Delete removes one tier; Redis drops the hash with its last tier
+func (st *RedisStickyStore) Delete(stickyID, tier string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), st.timeout)
+	defer cancel()
+
+	return st.client.HDel(ctx, st.key(stickyID),
+		redisStickyClientField+tier, redisStickyCreatedField+tier, redisStickyUsedField+tier).Err()
+}
+
+// List reads one sticky ID's hash, or scans every sticky key for ""
+// Assignments are ordered by sticky ID, then least recently used first, as in the SQLite store
+func (st *RedisStickyStore) List(stickyID string) ([]StickyAssignment, error) {
+	if stickyID != "" {
+		return st.listKey(stickyID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*st.timeout)
+	defer cancel()
+
+	var stickyIDs []string
+	iter := st.client.Scan(ctx, 0, st.key("*"), 1000).Iterator()
+	for iter.Next(ctx) {
+		stickyIDs = append(stickyIDs, strings.TrimPrefix(iter.Val(), st.key("")))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(stickyIDs)
+
+	var assignments []StickyAssignment
+	for _, id := range stickyIDs {
+		held, err := st.listKey(id)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, held...)
+	}
+	return assignments, nil
+}
+
+// listKey returns the assignments in one sticky ID's hash
+func (st *RedisStickyStore) listKey(stickyID string) ([]StickyAssignment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), st.timeout)
+	defer cancel()
+
+	fields, err := st.client.HGetAll(ctx, st.key(stickyID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var assignments []StickyAssignment
+	for field, clientID := range fields {
+		tier, ok := strings.CutPrefix(field, redisStickyClientField)
+		if !ok {
+			continue
+		}
+		assignments = append(assignments, StickyAssignment{
+			StickyID:  stickyID,
+			Tier:      tier,
+			ClientID:  clientID,
+			CreatedAt: parseRedisMillis(fields[redisStickyCreatedField+tier]),
+			LastUsed:  parseRedisMillis(fields[redisStickyUsedField+tier]),
+		})
+	}
+	sort.Slice(assignments, func(i, j int) bool {
+		if !assignments[i].LastUsed.Equal(assignments[j].LastUsed) {
+			return assignments[i].LastUsed.Before(assignments[j].LastUsed)
+		}
+		return assignments[i].Tier < assignments[j].Tier
+	})
+	return assignments, nil
+}
+
+func (st *RedisStickyStore) Shared() bool {
+	return true
+}
+
+// parseRedisMillis reads a Unix millisecond timestamp stored by the sticky store (zero if unset)
+func parseRedisMillis(value string) time.Time {
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms).UTC()
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"cyqle.in/opsen/common"
+)
+
+func newTestRedisStickyStore(t *testing.T, mr *miniredis.Miniredis, ttl time.Duration) *RedisStickyStore {
+	t.Helper()
+	client := newRedisClient(common.RedisConfig{Address: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisStickyStore(client, "opsen:", ttl)
+}
+
+// TestStickyStores verifies both stores get, touch, list and delete assignments alike
+func TestStickyStores(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	stores := map[string]StickyStore{
+		StickyStoreSQLite: NewSQLiteStickyStore(db, "signing-key"),
+		StickyStoreRedis:  newTestRedisStickyStore(t, miniredis.RunT(t), 0),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			earlier := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+			for _, assignment := range []StickyAssignment{
+				{StickyID: "user-1", Tier: "lite", ClientID: "backend-a", CreatedAt: earlier, LastUsed: earlier},
+				{StickyID: "user-1", Tier: "pro-max", ClientID: "backend-b", CreatedAt: earlier, LastUsed: earlier.Add(time.Minute)},
+				{StickyID: "user-2", Tier: "lite", ClientID: "backend-a"},
+			} {
+				if err := store.Set(assignment); err != nil {
+					t.Fatalf("Set failed: %v", err)
+				}
+			}
+
+			got, err := store.Get("user-1", "pro-max")
+			if err != nil || got == nil || got.ClientID != "backend-b" || !got.CreatedAt.Equal(earlier) {
+				t.Fatalf("Expected the stored assignment, got %+v (%v)", got, err)
+			}
+			if got, err := store.Get("user-1", "free"); err != nil || got != nil {
+				t.Errorf("Expected no assignment for an unplaced tier, got %+v (%v)", got, err)
+			}
+
+			// Touching lite makes it the most recently used of user-1's tiers
+			if err := store.Touch("user-1", "lite"); err != nil {
+				t.Fatalf("Touch failed: %v", err)
+			}
+			held, err := store.List("user-1")
+			if err != nil || len(held) != 2 || held[0].Tier != "pro-max" || held[1].Tier != "lite" {
+				t.Errorf("Expected user-1's tiers least recently used first, got %+v (%v)", held, err)
+			}
+
+			if err := store.Delete("user-1", "lite"); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			all, err := store.List("")
+			if err != nil || len(all) != 2 || all[0].StickyID != "user-1" || all[1].StickyID != "user-2" {
+				t.Errorf("Expected the two remaining assignments, got %+v (%v)", all, err)
+			}
+		})
+	}
+}
+
+// TestRedisStickyStore_TTL verifies a sticky ID's assignments expire after ttl without use, and use extends them
+func TestRedisStickyStore_TTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := newTestRedisStickyStore(t, mr, 10*time.Minute)
+
+	if err := store.Set(StickyAssignment{StickyID: "user-1", Tier: "lite", ClientID: "backend-a"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	mr.FastForward(8 * time.Minute)
+	if err := store.Touch("user-1", "lite"); err != nil {
+		t.Fatalf("Touch failed: %v", err)
+	}
+	mr.FastForward(8 * time.Minute)
+	if got, _ := store.Get("user-1", "lite"); got == nil {
+		t.Fatal("Expected a used assignment to outlive its original TTL")
+	}
+
+	mr.FastForward(11 * time.Minute)
+	if got, _ := store.Get("user-1", "lite"); got != nil {
+		t.Errorf("Expected the idle assignment to expire, got %+v", got)
+	}
+}
+
+// TestRedisStickyStore_SharedAcrossReplicas verifies replicas route a sticky ID to the backend another replica placed it on
+func TestRedisStickyStore_SharedAcrossReplicas(t *testing.T) {
+	mr := miniredis.RunT(t)
+	newReplica := func() *Server {
+		db, cleanup := CreateTestDB(t)
+		t.Cleanup(cleanup)
+		server := NewTestServer(t, db)
+		server.stickyStore = newTestRedisStickyStore(t, mr, time.Hour)
+		for _, id := range []string{"backend-a", "backend-b", "backend-c"} {
+			server.AddMockClient(NewMockClient(MockClientOptions{ClientID: id}))
+		}
+		return server
+	}
+	replicaA, replicaB := newReplica(), newReplica()
+
+	placed := func(server *Server) string {
+		rec := routeSticky(server, "user-1", "lite")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected placement to succeed, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var response common.RoutingResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return response.ClientID
+	}
+
+	first := placed(replicaA)
+	// Replica B has never seen user-1; only the shared store knows its backend, read once per request
+	replicaB.syncRequestStickyAssignments("user-1", replicaB.tierSpecs["lite"])
+	if client, _ := replicaB.findStickyAssignment("default:user-1", "lite", replicaB.tierSpecs["lite"]); client == nil || client.Registration.ClientID != first {
+		t.Fatalf("Expected replica B to find replica A's assignment to %s, got %v", first, client)
+	}
+	if got := placed(replicaB); got != first {
+		t.Errorf("Expected replica B to route to %s, got %s", first, got)
+	}
+
+	replicaB.removeStickyAssignment("default:user-1", "lite")
+	replicaA.syncStickyAssignments("default:user-1")
+	replicaA.mu.RLock()
+	_, held := replicaA.stickyAssignments["default:user-1"]
+	replicaA.mu.RUnlock()
+	if held {
+		t.Error("Expected replica A to drop an assignment removed by replica B")
+	}
+}
+
+// TestRedisStickyStore_ConcurrentPlacement verifies replicas placing the same new session at once agree on one backend
+func TestRedisStickyStore_ConcurrentPlacement(t *testing.T) {
+	mr := miniredis.RunT(t)
+	replicas := make([]*Server, 4)
+	for i := range replicas {
+		db, cleanup := CreateTestDB(t)
+		t.Cleanup(cleanup)
+		replicas[i] = NewTestServer(t, db)
+		replicas[i].stickyStore = newTestRedisStickyStore(t, mr, time.Hour)
+	}
+
+	holders := make(chan string, len(replicas))
+	for i, replica := range replicas {
+		go func() {
+			holders <- replica.createStickyAssignment("default:user-1", "lite", fmt.Sprintf("backend-%d", i))
+		}()
+	}
+	first := <-holders
+	for range replicas[1:] {
+		if holder := <-holders; holder != first {
+			t.Errorf("Expected every replica to settle on %s, got %s", first, holder)
+		}
+	}
+	if stored, _ := replicas[0].stickyStore.Get("default:user-1", "lite"); stored == nil || stored.ClientID != first {
+		t.Errorf("Expected the store to hold %s, got %+v", first, stored)
+	}
+}
+
+// TestValidateStickyStore verifies unknown stores and a TTL outside Redis are rejected
+func TestValidateStickyStore(t *testing.T) {
+	if err := validateStickyStore(&common.ServerConfig{StickyStore: StickyStoreRedis, StickyTTLSecs: 3600}); err != nil {
+		t.Errorf("Expected a valid redis store, got %v", err)
+	}
+	if err := validateStickyStore(&common.ServerConfig{StickyStore: "memcached"}); err == nil {
+		t.Error("Expected an unknown sticky_store to be rejected")
+	}
+	if err := validateStickyStore(&common.ServerConfig{StickyStore: StickyStoreSQLite, StickyTTLSecs: 60}); err == nil {
+		t.Error("Expected sticky_ttl_seconds to require the redis store")
+	}
+}
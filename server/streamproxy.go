@@ -0,0 +1,574 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+const (
+	streamProtocolTCP = "tcp"
+	streamProtocolUDP = "udp"
+
+	defaultStreamConnectTimeout = 5 * time.Second
+	defaultStreamUDPIdleTimeout = 60 * time.Second
+	maxStreamDatagramBytes      = 64 << 10
+)
+
+// validateStreamProxy checks the stream_proxy listeners
+func validateStreamProxy(listeners []common.StreamListenerConfig) error {
+	seen := make(map[string]bool)
+	for i, listener := range listeners {
+		if listener.Listen == "" {
+			return fmt.Errorf("stream_proxy[%d]: listen is required", i)
+		}
+		name := streamListenerName(listener)
+		protocol := streamListenerProtocol(listener)
+		switch protocol {
+		case streamProtocolTCP, streamProtocolUDP:
+		default:
+			return fmt.Errorf("stream_proxy %s: unknown protocol %q (want %s or %s)", name, listener.Protocol, streamProtocolTCP, streamProtocolUDP)
+		}
+		if seen[protocol+" "+listener.Listen] {
+			return fmt.Errorf("stream_proxy %s: %s %s is already used by another listener", name, protocol, listener.Listen)
+		}
+		seen[protocol+" "+listener.Listen] = true
+
+		if listener.BackendPort <= 0 || listener.BackendPort > 65535 {
+			return fmt.Errorf("stream_proxy %s: backend_port must be between 1 and 65535", name)
+		}
+		if protocol == streamProtocolUDP && (len(listener.SNITiers) > 0 || listener.ProxyProtocol) {
+			return fmt.Errorf("stream_proxy %s: sni_tiers and proxy_protocol need protocol: tcp", name)
+		}
+		for port := range listener.PortTiers {
+			if port <= 0 || port > 65535 {
+				return fmt.Errorf("stream_proxy %s: port_tiers port %d out of range", name, port)
+			}
+		}
+		if listener.ConnectTimeoutSecs < 0 || listener.IdleTimeoutSecs < 0 {
+			return fmt.Errorf("stream_proxy %s: connect_timeout_seconds and idle_timeout_seconds must be >= 0", name)
+		}
+	}
+	return nil
+}
+
+func streamListenerName(config common.StreamListenerConfig) string {
+	if config.Name != "" {
+		return config.Name
+	}
+	return config.Listen
+}
+
+func streamListenerProtocol(config common.StreamListenerConfig) string {
+	if config.Protocol == "" {
+		return streamProtocolTCP
+	}
+	return strings.ToLower(config.Protocol)
+}
+
+// StreamProxy accepts Layer-4 connections and splices them to backends picked by the routing engine
+type StreamProxy struct {
+	server    *Server
+	listeners []*streamListener
+	wg        sync.WaitGroup
+}
+
+// streamListener is one bound stream_proxy entry
+type streamListener struct {
+	config   common.StreamListenerConfig
+	name     string
+	port     int               // Local port (the destination port when there is no PROXY header)
+	sniTiers map[string]string // Lower-cased sni_tiers
+	tcp      net.Listener
+	udp      net.PacketConn
+
+	mu       sync.Mutex
+	sessions map[string]*udpSession // UDP source address → its backend socket
+	closed   bool
+}
+
+// udpSession relays one end user's datagrams to the backend picked for their first one
+type udpSession struct {
+	backend    net.Conn
+	clientID   string
+	lastActive atomic.Int64 // Unix nanoseconds of the latest datagram in either direction
+}
+
+// NewStreamProxy binds the stream_proxy listeners. Returns nil when none are configured
+func NewStreamProxy(server *Server, configs []common.StreamListenerConfig) (*StreamProxy, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	p := &StreamProxy{server: server}
+	for _, config := range configs {
+		l := &streamListener{
+			config:   config,
+			name:     streamListenerName(config),
+			sniTiers: make(map[string]string, len(config.SNITiers)),
+		}
+		for serverName, tier := range config.SNITiers {
+			l.sniTiers[strings.ToLower(serverName)] = tier
+		}
+
+		var addr net.Addr
+		var err error
+		if streamListenerProtocol(config) == streamProtocolUDP {
+			l.udp, err = net.ListenPacket("udp", config.Listen)
+			if err == nil {
+				addr = l.udp.LocalAddr()
+				l.sessions = make(map[string]*udpSession)
+			}
+		} else {
+			l.tcp, err = net.Listen("tcp", config.Listen)
+			if err == nil {
+				addr = l.tcp.Addr()
+			}
+		}
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("stream_proxy %s: %w", l.name, err)
+		}
+		_, port, _ := net.SplitHostPort(addr.String())
+		l.port, _ = strconv.Atoi(port)
+		p.listeners = append(p.listeners, l)
+	}
+	return p, nil
+}
+
+// Run accepts connections and datagrams until Close
+func (p *StreamProxy) Run() {
+	for _, l := range p.listeners {
+		p.wg.Add(1)
+		if l.udp != nil {
+			go p.serveUDP(l)
+		} else {
+			go p.serveTCP(l)
+		}
+		LogInfoWithData("Stream proxy listening", map[string]interface{}{
+			"name":         l.name,
+			"listen":       l.config.Listen,
+			"protocol":     streamListenerProtocol(l.config),
+			"backend_port": l.config.BackendPort,
+		})
+	}
+}
+
+// Close stops accepting new streams. Established TCP streams run until either side closes them
+func (p *StreamProxy) Close() {
+	if p == nil {
+		return
+	}
+	for _, l := range p.listeners {
+		l.mu.Lock()
+		l.closed = true
+		for source, session := range l.sessions {
+			session.backend.Close()
+			delete(l.sessions, source)
+		}
+		l.mu.Unlock()
+
+		if l.tcp != nil {
+			l.tcp.Close()
+		}
+		if l.udp != nil {
+			l.udp.Close()
+		}
+	}
+	p.wg.Wait()
+}
+
+func (l *streamListener) connectTimeout() time.Duration {
+	if l.config.ConnectTimeoutSecs > 0 {
+		return time.Duration(l.config.ConnectTimeoutSecs) * time.Second
+	}
+	return defaultStreamConnectTimeout
+}
+
+func (l *streamListener) idleTimeout() time.Duration {
+	if l.config.IdleTimeoutSecs > 0 {
+		return time.Duration(l.config.IdleTimeoutSecs) * time.Second
+	}
+	if l.udp != nil {
+		return defaultStreamUDPIdleTimeout
+	}
+	return 0
+}
+
+// tierFor resolves a stream's tier: the TLS server name (exact, then "*.parent" wildcard), the destination
+// port, then the listener's tier
+func (l *streamListener) tierFor(serverName string, destPort int) string {
+	if serverName = strings.ToLower(serverName); serverName != "" {
+		if tier, ok := l.sniTiers[serverName]; ok {
+			return tier
+		}
+		if _, parent, found := strings.Cut(serverName, "."); found {
+			if tier, ok := l.sniTiers["*."+parent]; ok {
+				return tier
+			}
+		}
+	}
+	if tier, ok := l.config.PortTiers[destPort]; ok {
+		return tier
+	}
+	if l.config.Tier != "" {
+		return l.config.Tier
+	}
+	return "lite"
+}
+
+// placeStream selects a backend for a new stream the way handleProxy places a request and returns the
+// address to dial on it
+func (s *Server) placeStream(config common.StreamListenerConfig, tier, clientIP string) (*ClientState, string, error) {
+	if s.inMaintenance() {
+		return nil, "", fmt.Errorf("maintenance mode")
+	}
+	tierSpec, _, ok := s.lookupTier(normalizeTenant(config.Tenant), tier, "")
+	if !ok {
+		return nil, "", fmt.Errorf("unknown tier: %s", tier)
+	}
+
+	if s.config.GeoIP.PreferSameASN {
+		if info, ok := s.lookupIP(clientIP); ok {
+			tierSpec.ClientASN = info.ASN
+		}
+	}
+	clientLat, clientLon := s.lookupIPLocation(clientIP)
+	s.applyVantageRegion(&tierSpec, clientLat, clientLon, clientIP)
+
+	// Streams carry no headers, so sticky_by_ip is the only way to keep an end user on one backend
+	stickyID := ""
+	if s.stickyByIP {
+		stickyID = s.hashStickyID(clientIP)
+	}
+	s.syncRequestStickyAssignments(stickyID, tierSpec)
+	if s.shedder != nil && !s.hasStickyAssignment(tenantStickyID(tierSpec.Tenant, stickyID), tier) && s.shedder.Shed(tierSpec) {
+		return nil, "", fmt.Errorf("tier %s is being shed", tier)
+	}
+
+	requestID := fmt.Sprintf("%d-%s", time.Now().UnixNano(), stickyID)
+	client, outcome := s.selectClientWithStickyPolicy(stickyID, tier, tierSpec, clientLat, clientLon, requestID)
+	if outcome.Held {
+		return nil, "", fmt.Errorf("assigned backend %s is %s (sticky_policy: strict)", outcome.ClientID, outcome.Reason)
+	}
+	if client == nil {
+		return nil, "", fmt.Errorf("no available backends with sufficient resources for tier %s", tier)
+	}
+
+	endpoint, err := url.Parse(client.SelectEndpoint(""))
+	if err != nil || endpoint.Hostname() == "" {
+		return nil, "", fmt.Errorf("backend %s has no usable endpoint host", client.Registration.ClientID)
+	}
+	return client, net.JoinHostPort(endpoint.Hostname(), strconv.Itoa(config.BackendPort)), nil
+}
+
+func (p *StreamProxy) serveTCP(l *streamListener) {
+	defer p.wg.Done()
+	for {
+		conn, err := l.tcp.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			LogWarn(fmt.Sprintf("Stream proxy %s: accept failed: %v", l.name, err))
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		go p.handleTCP(l, conn)
+	}
+}
+
+// handleTCP reads the optional PROXY header and ClientHello, places the stream and splices it to the backend
+func (p *StreamProxy) handleTCP(l *streamListener, conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	clientIP, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	destPort := l.port
+	serverName := ""
+	var preamble []byte
+
+	// The PROXY header and ClientHello must arrive promptly; a client that speaks second (VNC) is
+	// placed on the port or default tier once the timeout passes
+	conn.SetReadDeadline(time.Now().Add(l.connectTimeout()))
+	if l.config.ProxyProtocol {
+		header, err := readProxyHeader(reader)
+		if err != nil {
+			LogWarn(fmt.Sprintf("Stream proxy %s: dropping connection from %s: %v", l.name, clientIP, err))
+			return
+		}
+		if header.Source != nil {
+			clientIP = header.Source.String()
+		}
+		if header.DestPort > 0 {
+			destPort = header.DestPort
+		}
+		serverName = header.Authority
+	}
+	if len(l.sniTiers) > 0 && serverName == "" {
+		serverName, preamble = peekServerName(reader)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	tier := l.tierFor(serverName, destPort)
+	client, addr, err := p.server.placeStream(l.config, tier, clientIP)
+	if err != nil {
+		LogWarnWithData("Stream not placed", map[string]interface{}{
+			"listener":  l.name,
+			"tier":      tier,
+			"client_ip": clientIP,
+			"error":     err.Error(),
+		})
+		return
+	}
+	clientID := client.Registration.ClientID
+
+	backend, err := net.DialTimeout("tcp", addr, l.connectTimeout())
+	if err != nil {
+		p.server.recordProxyOutcome(clientID, true)
+		LogWarn(fmt.Sprintf("Stream proxy %s: backend %s unreachable at %s: %v", l.name, clientID, addr, err))
+		return
+	}
+	defer backend.Close()
+	p.server.recordProxyOutcome(clientID, false)
+
+	if len(preamble) > 0 {
+		if _, err := backend.Write(preamble); err != nil {
+			return
+		}
+	}
+
+	LogInfoWithData("Stream opened", map[string]interface{}{
+		"listener":    l.name,
+		"tier":        tier,
+		"server_name": serverName,
+		"client_ip":   clientIP,
+		"client_id":   clientID,
+		"backend":     addr,
+	})
+	start := time.Now()
+	up, down := spliceStream(conn, reader, backend, l.idleTimeout())
+	LogInfoWithData("Stream closed", map[string]interface{}{
+		"listener":   l.name,
+		"client_id":  clientID,
+		"bytes_up":   up + int64(len(preamble)),
+		"bytes_down": down,
+		"duration":   time.Since(start).Round(time.Millisecond).String(),
+	})
+}
+
+// spliceStream copies both directions until both are done or the stream has been idle for idle (0 = no limit)
+// A side that finishes sending is half-closed so the other can still answer
+func spliceStream(client net.Conn, clientReader io.Reader, backend net.Conn, idle time.Duration) (up, down int64) {
+	var lastActive atomic.Int64
+	touch := func() { lastActive.Store(time.Now().UnixNano()) }
+	touch()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		var err error
+		up, err = io.Copy(activityWriter{backend, touch}, clientReader)
+		finishStreamDirection(backend, client, err)
+	}()
+	go func() {
+		defer wg.Done()
+		var err error
+		down, err = io.Copy(activityWriter{client, touch}, backend)
+		finishStreamDirection(client, backend, err)
+	}()
+
+	done := make(chan struct{})
+	if idle > 0 {
+		go func() {
+			ticker := time.NewTicker(max(idle/4, 10*time.Millisecond))
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if time.Since(time.Unix(0, lastActive.Load())) >= idle {
+						client.Close()
+						backend.Close()
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	return up, down
+}
+
+// finishStreamDirection half-closes dst after its source reached EOF, or tears down both sides on an error
+func finishStreamDirection(dst, src net.Conn, err error) {
+	if closer, ok := dst.(interface{ CloseWrite() error }); ok && err == nil {
+		closer.CloseWrite()
+		return
+	}
+	dst.Close()
+	src.Close()
+}
+
+// activityWriter records when data last moved through a stream
+type activityWriter struct {
+	w     io.Writer
+	touch func()
+}
+
+func (a activityWriter) Write(p []byte) (int, error) {
+	a.touch()
+	return a.w.Write(p)
+}
+
+// errClientHelloRead stops a peeking handshake once the ClientHello has been parsed
+var errClientHelloRead = errors.New("client hello read")
+
+// peekServerName reads a TLS ClientHello and returns its server name together with every byte consumed,
+// which must be sent on to the backend. TLS is not terminated; non-TLS streams return no name
+func peekServerName(r io.Reader) (string, []byte) {
+	var consumed bytes.Buffer
+	serverName := ""
+	tls.Server(helloConn{Reader: io.TeeReader(r, &consumed)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			return nil, errClientHelloRead
+		},
+	}).Handshake()
+	return serverName, consumed.Bytes()
+}
+
+// helloConn feeds a TLS handshake from a reader and discards its replies (the alert sent on abort)
+type helloConn struct {
+	io.Reader
+}
+
+func (helloConn) Write(p []byte) (int, error)      { return len(p), nil }
+func (helloConn) Close() error                     { return nil }
+func (helloConn) LocalAddr() net.Addr              { return &net.TCPAddr{} }
+func (helloConn) RemoteAddr() net.Addr             { return &net.TCPAddr{} }
+func (helloConn) SetDeadline(time.Time) error      { return nil }
+func (helloConn) SetReadDeadline(time.Time) error  { return nil }
+func (helloConn) SetWriteDeadline(time.Time) error { return nil }
+
+func (p *StreamProxy) serveUDP(l *streamListener) {
+	defer p.wg.Done()
+	buf := make([]byte, maxStreamDatagramBytes)
+	for {
+		n, source, err := l.udp.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			LogWarn(fmt.Sprintf("Stream proxy %s: read failed: %v", l.name, err))
+			continue
+		}
+		session := p.udpSession(l, source)
+		if session == nil {
+			continue
+		}
+		session.lastActive.Store(time.Now().UnixNano())
+		session.backend.Write(buf[:n])
+	}
+}
+
+// udpSession returns the backend socket for a source address, placing a new session on its first datagram
+// Returns nil if the datagram cannot be placed (it is dropped)
+func (p *StreamProxy) udpSession(l *streamListener, source net.Addr) *udpSession {
+	key := source.String()
+	l.mu.Lock()
+	session, ok := l.sessions[key]
+	l.mu.Unlock()
+	if ok {
+		return session
+	}
+
+	clientIP, _, _ := net.SplitHostPort(key)
+	tier := l.tierFor("", l.port)
+	client, addr, err := p.server.placeStream(l.config, tier, clientIP)
+	if err != nil {
+		LogWarnWithData("Stream not placed", map[string]interface{}{
+			"listener":  l.name,
+			"tier":      tier,
+			"client_ip": clientIP,
+			"error":     err.Error(),
+		})
+		return nil
+	}
+	clientID := client.Registration.ClientID
+	backend, err := net.DialTimeout("udp", addr, l.connectTimeout())
+	if err != nil {
+		p.server.recordProxyOutcome(clientID, true)
+		LogWarn(fmt.Sprintf("Stream proxy %s: backend %s unreachable at %s: %v", l.name, clientID, addr, err))
+		return nil
+	}
+
+	session = &udpSession{backend: backend, clientID: clientID}
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		backend.Close()
+		return nil
+	}
+	l.sessions[key] = session
+	l.mu.Unlock()
+
+	LogInfoWithData("Stream opened", map[string]interface{}{
+		"listener":  l.name,
+		"tier":      tier,
+		"client_ip": clientIP,
+		"client_id": clientID,
+		"backend":   addr,
+	})
+	go p.relayUDPReplies(l, source, session)
+	return session
+}
+
+// relayUDPReplies sends the backend's datagrams back to the end user until the session goes idle
+func (p *StreamProxy) relayUDPReplies(l *streamListener, source net.Addr, session *udpSession) {
+	idle := l.idleTimeout()
+	buf := make([]byte, maxStreamDatagramBytes)
+	defer func() {
+		l.mu.Lock()
+		if l.sessions[source.String()] == session {
+			delete(l.sessions, source.String())
+		}
+		l.mu.Unlock()
+		session.backend.Close()
+		LogDebugWithData("Stream closed", map[string]interface{}{
+			"listener":  l.name,
+			"client_id": session.clientID,
+		})
+	}()
+
+	for {
+		session.backend.SetReadDeadline(time.Unix(0, session.lastActive.Load()).Add(idle))
+		n, err := session.backend.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && time.Since(time.Unix(0, session.lastActive.Load())) < idle {
+				continue // The end user sent something in the meantime
+			}
+			return
+		}
+		session.lastActive.Store(time.Now().UnixNano())
+		if _, err := l.udp.WriteTo(buf[:n], source); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// startStreamProxy runs one stream_proxy listener in front of a backend on 127.0.0.1:backendPort
+func startStreamProxy(t *testing.T, listener common.StreamListenerConfig) *StreamProxy {
+	t.Helper()
+	db, cleanup := CreateTestDB(t)
+	t.Cleanup(cleanup)
+
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "rdp-host", Endpoint: "http://127.0.0.1:11000"}))
+
+	proxy, err := NewStreamProxy(server, []common.StreamListenerConfig{listener})
+	if err != nil {
+		t.Fatalf("Failed to start stream proxy: %v", err)
+	}
+	proxy.Run()
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+// TestStreamProxy_TCP verifies a TCP stream is spliced to the backend port in both directions
+func TestStreamProxy_TCP(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	proxy := startStreamProxy(t, common.StreamListenerConfig{
+		Listen:      "127.0.0.1:0",
+		BackendPort: backend.Addr().(*net.TCPAddr).Port,
+	})
+
+	conn, err := net.Dial("tcp", proxy.listeners[0].tcp.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	conn.(*net.TCPConn).CloseWrite()
+	echoed, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("Failed to read from the stream: %v", err)
+	}
+	if string(echoed) != "hello" {
+		t.Errorf("Expected the backend's echo, got %q", echoed)
+	}
+}
+
+// TestStreamProxy_UDP verifies datagrams are relayed to the backend and its replies returned to the sender
+func TestStreamProxy_UDP(t *testing.T) {
+	backend, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := backend.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			backend.WriteTo(bytes.ToUpper(buf[:n]), addr)
+		}
+	}()
+
+	proxy := startStreamProxy(t, common.StreamListenerConfig{
+		Listen:      "127.0.0.1:0",
+		Protocol:    streamProtocolUDP,
+		BackendPort: backend.LocalAddr().(*net.UDPAddr).Port,
+	})
+
+	conn, err := net.Dial("udp", proxy.listeners[0].udp.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	for _, message := range []string{"ping", "again"} {
+		if _, err := conn.Write([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 1500)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("No reply relayed: %v", err)
+		}
+		if got := string(buf[:n]); got != strings.ToUpper(message) {
+			t.Errorf("Expected %q, got %q", strings.ToUpper(message), got)
+		}
+	}
+}
+
+// TestStreamTierFor verifies tiers come from the server name, then the destination port, then the listener
+func TestStreamTierFor(t *testing.T) {
+	l := &streamListener{
+		config: common.StreamListenerConfig{
+			Tier:      "standard",
+			PortTiers: map[int]string{5900: "lite"},
+		},
+		sniTiers: map[string]string{"gpu.example.com": "gpu", "*.desk.example.com": "pro"},
+	}
+
+	cases := []struct {
+		serverName string
+		port       int
+		want       string
+	}{
+		{"GPU.example.com", 5900, "gpu"},
+		{"alice.desk.example.com", 3389, "pro"},
+		{"other.example.com", 5900, "lite"},
+		{"", 3389, "standard"},
+	}
+	for _, c := range cases {
+		if got := l.tierFor(c.serverName, c.port); got != c.want {
+			t.Errorf("tierFor(%q, %d) = %s, want %s", c.serverName, c.port, got, c.want)
+		}
+	}
+}
+
+// TestPeekServerName verifies the SNI is read from a ClientHello and every byte consumed is returned
+func TestPeekServerName(t *testing.T) {
+	clientSide, proxySide := net.Pipe()
+	defer clientSide.Close()
+	go tls.Client(clientSide, &tls.Config{ServerName: "gpu.example.com", InsecureSkipVerify: true}).Handshake()
+
+	serverName, consumed := peekServerName(proxySide)
+	proxySide.Close()
+	if serverName != "gpu.example.com" {
+		t.Errorf("Expected gpu.example.com, got %q", serverName)
+	}
+	if len(consumed) == 0 || consumed[0] != 0x16 {
+		t.Errorf("Expected the ClientHello record to be returned for replay, got %d bytes", len(consumed))
+	}
+
+	// Protocols that are not TLS keep their first bytes
+	serverName, consumed = peekServerName(strings.NewReader("RFB 003.008\n"))
+	if serverName != "" || string(consumed) != "RFB 003.008\n" {
+		t.Errorf("Expected no server name and the original bytes, got %q and %q", serverName, consumed)
+	}
+}
+
+// TestReadProxyHeader verifies PROXY protocol v1 and v2 headers are parsed and the stream after them is kept
+func TestReadProxyHeader(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("PROXY TCP4 203.0.113.7 10.0.0.1 51234 3389\r\nRDP"))
+	header, err := readProxyHeader(r)
+	if err != nil {
+		t.Fatalf("v1: %v", err)
+	}
+	if header.Source.String() != "203.0.113.7" || header.DestPort != 3389 {
+		t.Errorf("v1: unexpected header %+v", header)
+	}
+	if rest, _ := io.ReadAll(r); string(rest) != "RDP" {
+		t.Errorf("v1: expected the stream to follow the header, got %q", rest)
+	}
+
+	authority := []byte("gpu.example.com")
+	payload := []byte{203, 0, 113, 8, 10, 0, 0, 1, 0xc8, 0x22, 0x0d, 0x3d} // ports 51234 → 3389
+	payload = append(payload, proxyProtocolV2Authority, 0, byte(len(authority)))
+	payload = append(payload, authority...)
+	v2 := append([]byte{}, proxyProtocolV2Signature...)
+	v2 = append(v2, 0x21, 0x11) // v2 PROXY, TCP over IPv4
+	v2 = binary.BigEndian.AppendUint16(v2, uint16(len(payload)))
+	v2 = append(v2, payload...)
+
+	header, err = readProxyHeader(bufio.NewReader(bytes.NewReader(v2)))
+	if err != nil {
+		t.Fatalf("v2: %v", err)
+	}
+	if header.Source.String() != "203.0.113.8" || header.DestPort != 3389 || header.Authority != "gpu.example.com" {
+		t.Errorf("v2: unexpected header %+v", header)
+	}
+
+	if _, err := readProxyHeader(bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n\r\n"))); err == nil {
+		t.Error("Expected an error for a connection without a PROXY header")
+	}
+}
+
+// TestValidateStreamProxy verifies listeners without a backend port or with TCP-only options on UDP are rejected
+func TestValidateStreamProxy(t *testing.T) {
+	invalid := []common.StreamListenerConfig{
+		{Listen: ":3389"},
+		{Listen: ":3389", BackendPort: 3389, Protocol: "sctp"},
+		{Listen: ":3478", BackendPort: 3478, Protocol: streamProtocolUDP, ProxyProtocol: true},
+	}
+	for _, listener := range invalid {
+		if err := validateStreamProxy([]common.StreamListenerConfig{listener}); err == nil {
+			t.Errorf("Expected an error for %+v", listener)
+		}
+	}
+	if err := validateStreamProxy([]common.StreamListenerConfig{{Listen: ":3389", BackendPort: 3389, ProxyProtocol: true}}); err != nil {
+		t.Errorf("Expected a valid listener, got %v", err)
+	}
+}
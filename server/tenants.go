@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"cyqle.in/opsen/common"
+)
+
+// DefaultTenant owns backends, tiers and requests that do not name a tenant
+const DefaultTenant = "default"
+
+// TenantHeader lets callers authenticated with a global key act for a tenant
+const TenantHeader = "X-Tenant"
+
+type tenantContextKey struct{}
+
+// normalizeTenant maps an empty tenant name to the default tenant
+func normalizeTenant(name string) string {
+	if name == "" {
+		return DefaultTenant
+	}
+	return name
+}
+
+// withTenant binds a request to a tenant (tenant API keys, proxy routes)
+func withTenant(r *http.Request, tenant string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, normalizeTenant(tenant)))
+}
+
+// tenantFromContext returns the tenant bound to a request, if any
+func tenantFromContext(r *http.Request) (string, bool) {
+	tenant, ok := r.Context().Value(tenantContextKey{}).(string)
+	return tenant, ok
+}
+
+// requestTenant returns the tenant a request acts for
+// Tenant keys and proxy routes bind the tenant; callers with a global key may pick one with X-Tenant
+func requestTenant(r *http.Request) string {
+	if tenant, ok := tenantFromContext(r); ok {
+		return tenant
+	}
+	return normalizeTenant(r.Header.Get(TenantHeader))
+}
+
+// stickyKeyTenantEscaper escapes the tenant part of a sticky assignment key
+var stickyKeyTenantEscaper = strings.NewReplacer("%", "%25", ":", "%3A")
+
+// tenantStickyID scopes a sticky ID to its tenant ("<tenant>:<sticky_id>") so identical IDs from different
+// tenants never share assignments. The default tenant is encoded too, and ':' in tenant names is escaped,
+// so a key splits at its first ':' whatever the sticky ID contains
+func tenantStickyID(tenant, stickyID string) string {
+	if stickyID == "" {
+		return stickyID
+	}
+	return stickyKeyTenantEscaper.Replace(normalizeTenant(tenant)) + ":" + stickyID
+}
+
+// splitStickyKey returns the tenant and sticky ID of a key built by tenantStickyID
+func splitStickyKey(key string) (string, string, bool) {
+	escaped, stickyID, ok := strings.Cut(key, ":")
+	if !ok {
+		return "", "", false
+	}
+	tenant, err := url.PathUnescape(escaped)
+	if err != nil {
+		return "", "", false
+	}
+	return tenant, stickyID, true
+}
+
+// scopedStickyKey converts a stored key to the tenantStickyID form. Before the default tenant was encoded,
+// its keys were bare sticky IDs; keys that already start with a configured tenant are returned unchanged
+func (s *Server) scopedStickyKey(key string) string {
+	if tenant, _, ok := splitStickyKey(key); ok && s.knownTenant(tenant) {
+		return key
+	}
+	return tenantStickyID(DefaultTenant, key)
+}
+
+// validateTenants checks tenant definitions and tenant references at startup
+func validateTenants(config *common.ServerConfig) error {
+	names := map[string]bool{DefaultTenant: true}
+	keys := make(map[string]string)
+	for _, key := range config.APIKeys {
+		keys[key] = "api_keys"
+	}
+	if config.ServerKey != "" {
+		keys[config.ServerKey] = "server_key"
+	}
+
+	for i, tenant := range config.Tenants {
+		if tenant.Name == "" {
+			return fmt.Errorf("tenants[%d]: name is required", i)
+		}
+		if names[tenant.Name] && tenant.Name != DefaultTenant {
+			return fmt.Errorf("duplicate tenant: %s", tenant.Name)
+		}
+		names[tenant.Name] = true
+
+		for _, key := range tenant.APIKeys {
+			if key == "" {
+				return fmt.Errorf("tenant %s: empty API key", tenant.Name)
+			}
+			if owner, exists := keys[key]; exists {
+				return fmt.Errorf("tenant %s: API key already used by %s", tenant.Name, owner)
+			}
+			keys[key] = "tenant " + tenant.Name
+		}
+
+		if len(tenant.Tiers) > 0 {
+			if _, err := buildTierSpecs(tenant.Tiers); err != nil {
+				return fmt.Errorf("tenant %s: %w", tenant.Name, err)
+			}
+		}
+	}
+
+	for _, route := range config.ProxyRoutes {
+		if route.Tenant != "" && !names[route.Tenant] {
+			return fmt.Errorf("proxy_routes %s: unknown tenant %s", route.Prefix, route.Tenant)
+		}
+	}
+	return nil
+}
+
+// buildTenantTiers returns the tenant-specific tier sets and their versions
+// Tenants without their own tiers use the global tier set
+func buildTenantTiers(tenants []common.TenantConfig) (map[string]map[string]common.TierSpec, map[string]string) {
+	specs := make(map[string]map[string]common.TierSpec)
+	versions := make(map[string]string)
+	for _, tenant := range tenants {
+		if len(tenant.Tiers) == 0 {
+			continue
+		}
+		tierSpecs, err := buildTierSpecs(tenant.Tiers)
+		if err != nil {
+			continue // Rejected by validateTenants at startup
+		}
+		specs[tenant.Name] = tierSpecs
+		versions[tenant.Name] = tierSetVersion(tierSpecs)
+	}
+	return specs, versions
+}
+
+// tenantTierSetsLocked returns the tier set each tenant places with: its own tiers, or the global set
+// (caller must hold s.mu)
+func (s *Server) tenantTierSetsLocked() map[string]map[string]common.TierSpec {
+	sets := map[string]map[string]common.TierSpec{DefaultTenant: s.tierSpecs}
+	for _, tenant := range s.config.Tenants {
+		sets[tenant.Name] = s.tierSpecs
+		if specs, ok := s.tenantTierSpecs[tenant.Name]; ok {
+			sets[tenant.Name] = specs
+		}
+	}
+	return sets
+}
+
+// tenantAPIKeys maps each tenant API key to its tenant
+func tenantAPIKeys(tenants []common.TenantConfig) map[string]string {
+	keys := make(map[string]string)
+	for _, tenant := range tenants {
+		for _, key := range tenant.APIKeys {
+			keys[key] = tenant.Name
+		}
+	}
+	return keys
+}
+
+// knownTenant reports whether a tenant is configured (the default tenant always exists)
+func (s *Server) knownTenant(name string) bool {
+	if name == DefaultTenant {
+		return true
+	}
+	for _, tenant := range s.config.Tenants {
+		if tenant.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GlobalKeyOnly rejects requests authenticated with a tenant API key
+// Used for instance-wide admin endpoints that would otherwise let one tenant affect others
+func GlobalKeyOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tenant, scoped := tenantFromContext(r); scoped {
+			http.Error(w, fmt.Sprintf("Tenant API key (%s) cannot use this endpoint", tenant), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
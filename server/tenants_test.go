@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// newTenantTestServer creates a server with tenants team-a (own tiers) and team-b (global tiers)
+func newTenantTestServer(t *testing.T) *Server {
+	t.Helper()
+	db, cleanup := CreateTestDB(t)
+	t.Cleanup(cleanup)
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.Tenants = []common.TenantConfig{
+			{
+				Name:    "team-a",
+				APIKeys: []string{"key-a"},
+				Tiers:   []common.TierSpec{{Name: "lite", VCPU: 2, MemoryGB: 2.0, StorageGB: 5}},
+			},
+			{Name: "team-b", APIKeys: []string{"key-b"}},
+		}
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "default-backend", Endpoint: "http://10.0.0.1:11000"}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "a-backend", Endpoint: "http://10.0.0.2:11000", Tenant: "team-a"}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "b-backend", Endpoint: "http://10.0.0.3:11000", Tenant: "team-b"}))
+	return server
+}
+
+// routeForTenant posts a /route request bound to a tenant and returns the selected backend
+func routeForTenant(t *testing.T, server *Server, tenant, sessionID string) string {
+	t.Helper()
+	body, _ := json.Marshal(common.RoutingRequest{Tier: "lite"})
+	req := httptest.NewRequest("POST", "/route", bytes.NewReader(body))
+	if sessionID != "" {
+		req.Header.Set("X-Session-ID", sessionID)
+	}
+	if tenant != "" {
+		req = withTenant(req, tenant)
+	}
+	rec := httptest.NewRecorder()
+	server.handleRoute(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 routing for tenant %q, got %d: %s", tenant, rec.Code, rec.Body.String())
+	}
+
+	var resp common.RoutingResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode routing response: %v", err)
+	}
+	return resp.ClientID
+}
+
+// TestTenants_RoutingIsolation verifies routing never crosses tenants and tenants use their own tiers
+func TestTenants_RoutingIsolation(t *testing.T) {
+	server := newTenantTestServer(t)
+
+	cases := map[string]string{
+		"":       "default-backend",
+		"team-a": "a-backend",
+		"team-b": "b-backend",
+	}
+	for tenant, expected := range cases {
+		for i := 0; i < 3; i++ {
+			server.ClearPendingAllocations()
+			if got := routeForTenant(t, server, tenant, ""); got != expected {
+				t.Errorf("Expected tenant %q to route to %s, got %s", tenant, expected, got)
+			}
+		}
+	}
+
+	spec, _, _ := server.resolveTier(withTenant(httptest.NewRequest("POST", "/route", nil), "team-a"), "lite")
+	if spec.VCPU != 2 || spec.Tenant != "team-a" {
+		t.Errorf("Expected team-a's own lite tier, got %+v", spec)
+	}
+
+	// A tenant without backends gets no capacity from other tenants
+	server.mu.Lock()
+	delete(server.clientCache, "b-backend")
+	server.mu.Unlock()
+	body, _ := json.Marshal(common.RoutingRequest{Tier: "lite"})
+	rec := httptest.NewRecorder()
+	server.handleRoute(rec, withTenant(httptest.NewRequest("POST", "/route", bytes.NewReader(body)), "team-b"))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 for a tenant without backends, got %d", rec.Code)
+	}
+}
+
+// TestTenants_StickyScoping verifies identical sticky IDs from different tenants get separate assignments
+func TestTenants_StickyScoping(t *testing.T) {
+	server := newTenantTestServer(t)
+
+	if got := routeForTenant(t, server, "team-a", "session-1"); got != "a-backend" {
+		t.Fatalf("Expected team-a session on a-backend, got %s", got)
+	}
+	if got := routeForTenant(t, server, "team-b", "session-1"); got != "b-backend" {
+		t.Errorf("Expected team-b session on b-backend, got %s", got)
+	}
+
+	server.mu.RLock()
+	_, scoped := server.stickyAssignments["team-a:session-1"]
+	_, unscoped := server.stickyAssignments["session-1"]
+	server.mu.RUnlock()
+	if !scoped || unscoped {
+		t.Errorf("Expected sticky assignment stored under the tenant-scoped ID, got %v", server.stickyAssignments)
+	}
+}
+
+// TestTenants_DefaultStickyIDCannotCollide verifies a default-tenant sticky ID shaped like "<tenant>:<id>"
+// gets its own assignment instead of reading another tenant's
+func TestTenants_DefaultStickyIDCannotCollide(t *testing.T) {
+	server := newTenantTestServer(t)
+
+	if got := routeForTenant(t, server, "team-a", "session-1"); got != "a-backend" {
+		t.Fatalf("Expected team-a session on a-backend, got %s", got)
+	}
+	if got := routeForTenant(t, server, "", "team-a:session-1"); got != "default-backend" {
+		t.Errorf("Expected default caller routed to default-backend, got %s", got)
+	}
+
+	server.mu.RLock()
+	teamA := server.stickyAssignments[tenantStickyID("team-a", "session-1")]["lite"]
+	defaultCaller := server.stickyAssignments[tenantStickyID(DefaultTenant, "team-a:session-1")]["lite"]
+	server.mu.RUnlock()
+	if teamA != "a-backend" || defaultCaller != "default-backend" {
+		t.Errorf("Expected separate assignments, got team-a=%q default=%q", teamA, defaultCaller)
+	}
+}
+
+// TestTenants_MigrateStickyKeys verifies bare assignments stored before tenant scoping move under the
+// default tenant, and keys already scoped are left alone
+func TestTenants_MigrateStickyKeys(t *testing.T) {
+	server := newTenantTestServer(t)
+	server.stickyStore.Set(StickyAssignment{StickyID: "session-1", Tier: "lite", ClientID: "default-backend"})
+	server.stickyStore.Set(StickyAssignment{StickyID: "team-a:session-2", Tier: "lite", ClientID: "a-backend"})
+
+	moved, err := server.migrateStickyKeys()
+	if err != nil || moved != 1 {
+		t.Fatalf("Expected 1 key moved, got %d (%v)", moved, err)
+	}
+	if got, _ := server.stickyStore.Get("session-1", "lite"); got != nil {
+		t.Errorf("Expected the bare key to be removed, got %+v", got)
+	}
+	if got, _ := server.stickyStore.Get("default:session-1", "lite"); got == nil || got.ClientID != "default-backend" {
+		t.Errorf("Expected the assignment under default:session-1, got %+v", got)
+	}
+	if got, _ := server.stickyStore.Get("team-a:session-2", "lite"); got == nil || got.ClientID != "a-backend" {
+		t.Errorf("Expected team-a's key unchanged, got %+v", got)
+	}
+
+	if moved, _ := server.migrateStickyKeys(); moved != 0 {
+		t.Errorf("Expected a second run to move nothing, got %d", moved)
+	}
+}
+
+// TestTenants_APIKeys verifies tenant keys register into their own tenant and cannot reach admin endpoints
+func TestTenants_APIKeys(t *testing.T) {
+	server := newTenantTestServer(t)
+	auth := NewAPIKeyAuth("server-key", nil)
+	auth.SetTenantKeys(tenantAPIKeys(server.config.Tenants))
+	register := auth.Middleware(http.HandlerFunc(server.handleRegister))
+
+	doRegister := func(key, clientID, tenant string) int {
+		body, _ := json.Marshal(common.ClientRegistration{
+			ClientID:    clientID,
+			EndpointURL: "http://10.0.1.1:11000",
+			Tenant:      tenant,
+		})
+		req := httptest.NewRequest("POST", "/register", bytes.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		register.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := doRegister("key-a", "new-a", "team-b"); code != http.StatusForbidden {
+		t.Errorf("Expected 403 registering into another tenant, got %d", code)
+	}
+	if code := doRegister("key-a", "new-a", ""); code != http.StatusOK {
+		t.Fatalf("Expected 200 registering with a tenant key, got %d", code)
+	}
+	if tenant := server.clientCache["new-a"].Registration.Tenant; tenant != "team-a" {
+		t.Errorf("Expected backend registered into team-a, got %q", tenant)
+	}
+	if code := doRegister("key-b", "a-backend", ""); code != http.StatusConflict {
+		t.Errorf("Expected 409 taking over another tenant's client ID, got %d", code)
+	}
+	if code := doRegister("server-key", "new-c", "team-c"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown tenant, got %d", code)
+	}
+
+	admin := auth.Middleware(GlobalKeyOnly(http.HandlerFunc(server.handleCosts)))
+	req := httptest.NewRequest("GET", "/costs", nil)
+	req.Header.Set("X-API-Key", "key-a")
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a tenant key on an admin endpoint, got %d", rec.Code)
+	}
+
+	if err := validateTenants(&common.ServerConfig{
+		ServerKey: "shared",
+		Tenants:   []common.TenantConfig{{Name: "team-a", APIKeys: []string{"shared"}}},
+	}); err == nil {
+		t.Error("Expected a tenant key equal to server_key to be rejected")
+	}
+}
@@ -3,14 +3,13 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
-	"fmt"
-	"math/rand"
 	"os"
 	"testing"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"cyqle.in/opsen/common"
+	"cyqle.in/opsen/opsentest"
 )
 
 // CreateTestDB creates a temporary test database and returns cleanup function
@@ -47,152 +46,20 @@ func NewTestServer(t *testing.T, db *sql.DB) *Server {
 // NewTestServerWithConfig creates a server instance with custom configuration
 func NewTestServerWithConfig(t *testing.T, db *sql.DB, configModifier func(*common.ServerConfig)) *Server {
 	t.Helper()
-
-	config := &common.ServerConfig{
-		Port:                         8080,
-		StaleMinutes:                 5,
-		CleanupIntervalSecs:          60,
-		StickyHeader:                 "X-Session-ID",
-		StickyAffinityEnabled:        true,
-		PendingAllocationTimeoutSecs: 120,
-		TierFieldName:                "tier",   // Default tier field name
-		TierHeader:                   "X-Tier", // Default tier header
-
-		// Health check defaults
-		HealthCheckEnabled:            true,
-		HealthCheckIntervalSecs:       10,
-		HealthCheckTimeoutSecs:        2,
-		HealthCheckType:               "tcp",
-		HealthCheckPath:               "/health",
-		HealthCheckUnhealthyThreshold: 3,
-		HealthCheckHealthyThreshold:   2,
-
-		Tiers: []common.TierSpec{
-			{Name: "free", VCPU: 1, MemoryGB: 1.0, StorageGB: 0},
-			{Name: "lite", VCPU: 1, MemoryGB: 1.0, StorageGB: 5},
-			{Name: "pro-standard", VCPU: 2, MemoryGB: 4.0, StorageGB: 20},
-			{Name: "pro-turbo", VCPU: 4, MemoryGB: 8.0, StorageGB: 30},
-			{Name: "pro-max", VCPU: 8, MemoryGB: 16.0, StorageGB: 40},
-		},
-	}
-
-	// Apply custom configuration if provided
-	if configModifier != nil {
-		configModifier(config)
-	}
-
-	tierSpecs := make(map[string]common.TierSpec)
-	for _, tier := range config.Tiers {
-		tierSpecs[tier.Name] = tier
-	}
-
-	return &Server{
-		db:                    db,
-		clientCache:           make(map[string]*ClientState),
-		stickyAssignments:     make(map[string]map[string]string),
-		pendingAllocations:    make(map[string][]PendingAllocation),
-		stickyHeader:          config.StickyHeader,
-		stickyByIP:            config.StickyByIP,
-		stickyAffinityEnabled: config.StickyAffinityEnabled,
-		staleTimeout:          time.Duration(config.StaleMinutes) * time.Minute,
-		cleanupInterval:       time.Duration(config.CleanupIntervalSecs) * time.Second,
-		tierSpecs:             tierSpecs,
-		config:                config,
-	}
+	return NewServer(db, opsentest.NewServerConfig(configModifier))
 }
 
-// MockClient creates a test client with specified resources
-type MockClientOptions struct {
-	ClientID      string
-	Hostname      string
-	Latitude      float64
-	Longitude     float64
-	TotalCPU      int
-	TotalMemory   float64
-	TotalStorage  float64
-	TotalGPUs     int               // Number of GPUs
-	GPUModels     []string          // GPU model names
-	CPUUsageAvg   []float64         // Per-core usage (0-100)
-	MemoryUsed    float64
-	MemoryAvail   float64
-	DiskUsed      float64
-	DiskAvail     float64
-	GPUs          []common.GPUStats // GPU metrics
-	LastSeen      time.Time
-	Endpoint      string
-}
+// MockClientOptions describes a test client's resources (shared with the public opsentest package)
+type MockClientOptions = opsentest.MockClientOptions
 
+// NewMockClient creates a test client with specified resources
 func NewMockClient(opts MockClientOptions) *ClientState {
-	// Apply defaults
-	if opts.ClientID == "" {
-		opts.ClientID = fmt.Sprintf("client-%d", rand.Intn(10000))
-	}
-	if opts.Hostname == "" {
-		opts.Hostname = opts.ClientID
-	}
-	if opts.TotalCPU == 0 {
-		opts.TotalCPU = 8
-	}
-	if opts.TotalMemory == 0 {
-		opts.TotalMemory = 32.0
-	}
-	if opts.TotalStorage == 0 {
-		opts.TotalStorage = 500.0
-	}
-	if opts.LastSeen.IsZero() {
-		opts.LastSeen = time.Now()
-	}
-	if opts.Endpoint == "" {
-		opts.Endpoint = "http://localhost:11000"
-	}
-
-	// Generate default CPU usage if not provided
-	if len(opts.CPUUsageAvg) == 0 {
-		opts.CPUUsageAvg = make([]float64, opts.TotalCPU)
-		for i := 0; i < opts.TotalCPU; i++ {
-			opts.CPUUsageAvg[i] = 20.0 // Low usage by default
-		}
-	}
-
-	// Calculate memory if not specified
-	if opts.MemoryUsed == 0 && opts.MemoryAvail == 0 {
-		opts.MemoryUsed = 8.0
-		opts.MemoryAvail = opts.TotalMemory - opts.MemoryUsed
-	}
-
-	// Calculate disk if not specified
-	if opts.DiskUsed == 0 && opts.DiskAvail == 0 {
-		opts.DiskUsed = 100.0
-		opts.DiskAvail = opts.TotalStorage - opts.DiskUsed
-	}
-
+	mock := opsentest.NewMockClient(opts)
 	return &ClientState{
-		Registration: common.ClientRegistration{
-			ClientID:     opts.ClientID,
-			Hostname:     opts.Hostname,
-			Latitude:     opts.Latitude,
-			Longitude:    opts.Longitude,
-			TotalCPU:     opts.TotalCPU,
-			TotalMemory:  opts.TotalMemory,
-			TotalStorage: opts.TotalStorage,
-			TotalGPUs:    opts.TotalGPUs,
-			GPUModels:    opts.GPUModels,
-		},
-		Stats: common.ResourceStats{
-			ClientID:    opts.ClientID,
-			Hostname:    opts.Hostname,
-			CPUCores:    opts.TotalCPU,
-			CPUUsageAvg: opts.CPUUsageAvg,
-			MemoryTotal: opts.TotalMemory,
-			MemoryUsed:  opts.MemoryUsed,
-			MemoryAvail: opts.MemoryAvail,
-			DiskTotal:   opts.TotalStorage,
-			DiskUsed:    opts.DiskUsed,
-			DiskAvail:   opts.DiskAvail,
-			GPUs:        opts.GPUs,
-		},
-		LastSeen:     opts.LastSeen,
-		Endpoint:     opts.Endpoint,
+		Registration: mock.Registration,
+		Stats:        mock.Stats,
+		LastSeen:     mock.LastSeen,
+		Endpoint:     mock.Endpoint,
 		HealthStatus: "unknown", // Default health status
 	}
 }
@@ -202,6 +69,7 @@ func (s *Server) AddMockClient(client *ClientState) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.clientCache[client.Registration.ClientID] = client
+	s.invalidateRoutingSnapshot()
 }
 
 // RegisterMockClientInDB registers a mock client in the database
@@ -292,4 +160,5 @@ func (s *Server) ClearPendingAllocations() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.pendingAllocations = make(map[string][]PendingAllocation)
+	s.reservations.reset()
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestThermalPenalty_DeprioritizesThrottledBackend verifies throttling backends lose to equivalent cool ones
+func TestThermalPenalty_DeprioritizesThrottledBackend(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.ThermalThrottlePenalty = 100.0
+		c.CPUTempPenaltyC = 90.0
+	})
+
+	// Idle-looking backend whose CPUs are throttling
+	throttled := NewMockClient(MockClientOptions{ClientID: "throttled", CPUUsageAvg: []float64{5, 5, 5, 5}})
+	throttled.Stats.Thermal = &common.ThermalStats{CPUTempC: 80.0, CPUThrottling: true, CPUThrottleEvents: 12}
+	server.AddMockClient(throttled)
+
+	// Busier backend running cool
+	cool := NewMockClient(MockClientOptions{ClientID: "cool", CPUUsageAvg: []float64{40, 40, 40, 40}})
+	cool.Stats.Thermal = &common.ThermalStats{CPUTempC: 55.0}
+	server.AddMockClient(cool)
+
+	client := server.findBestClient(server.tierSpecs["lite"], 0, 0)
+	AssertClientSelected(t, client, "cool")
+
+	// Still eligible: the penalty only reorders backends
+	if !server.hasResources(throttled, server.tierSpecs["lite"]) {
+		t.Error("Expected throttled backend to remain eligible")
+	}
+
+	throttled.Stats.Thermal = &common.ThermalStats{CPUTempC: 95.0}
+	if !server.isThermallyThrottled(throttled) {
+		t.Error("Expected package temperature above cpu_temp_penalty_c to be penalized")
+	}
+}
+
+// TestThermalPenalty_DisabledByDefault verifies thermal telemetry is ignored without a penalty
+func TestThermalPenalty_DisabledByDefault(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+
+	client := NewMockClient(MockClientOptions{ClientID: "hot"})
+	client.Stats.Thermal = &common.ThermalStats{CPUTempC: 100.0, CPUThrottling: true}
+	if server.isThermallyThrottled(client) {
+		t.Error("Expected thermal telemetry to be ignored when thermal_throttle_penalty is 0")
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"cyqle.in/opsen/common"
+)
+
+// TierVersionHeader opts a request into the staged tier set ("next") and reports the
+// tier set version a request was placed with
+const TierVersionHeader = "X-Tier-Version"
+
+// tierSetRequest is the payload for PUT /tiers/next
+type tierSetRequest struct {
+	Tiers []common.TierSpec `json:"tiers"`
+}
+
+// tierSetVersion returns a short content hash identifying a tier set
+// The hash is independent of tier order, so reordering the config does not change it
+func tierSetVersion(specs map[string]common.TierSpec) string {
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ordered := make([]common.TierSpec, 0, len(names))
+	for _, name := range names {
+		ordered = append(ordered, specs[name])
+	}
+	data, _ := json.Marshal(ordered)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// buildTierSpecs validates a tier list and indexes it by name
+func buildTierSpecs(tiers []common.TierSpec) (map[string]common.TierSpec, error) {
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("tier set must contain at least one tier")
+	}
+
+	specs := make(map[string]common.TierSpec, len(tiers))
+	for _, tier := range tiers {
+		if tier.Name == "" {
+			return nil, fmt.Errorf("tier name is required")
+		}
+		if _, exists := specs[tier.Name]; exists {
+			return nil, fmt.Errorf("duplicate tier: %s", tier.Name)
+		}
+		if tier.VCPU < 0 || tier.MemoryGB < 0 || tier.StorageGB < 0 || tier.GPU < 0 || tier.GPUMemoryGB < 0 {
+			return nil, fmt.Errorf("tier %s: resource requirements must not be negative", tier.Name)
+		}
+		if tier.MaxLatencyMs < 0 || tier.MaxDistanceKm < 0 {
+			return nil, fmt.Errorf("tier %s: max_latency_ms and max_distance_km must not be negative", tier.Name)
+		}
+		if tier.MinDiskMBps < 0 {
+			return nil, fmt.Errorf("tier %s: min_disk_mbps must not be negative", tier.Name)
+		}
+		if tier.MinBandwidthMbps < 0 {
+			return nil, fmt.Errorf("tier %s: min_bandwidth_mbps must not be negative", tier.Name)
+		}
+		if err := validateGPUShare(tier); err != nil {
+			return nil, err
+		}
+		if err := validateGPURequirements(tier); err != nil {
+			return nil, err
+		}
+		if err := validateMemoryAvailable(tier); err != nil {
+			return nil, err
+		}
+		if err := validateCPUWindow(tier); err != nil {
+			return nil, err
+		}
+		if err := validateTierCPUHeadroom(tier); err != nil {
+			return nil, err
+		}
+		if err := validateStickyPolicy(tier); err != nil {
+			return nil, err
+		}
+		specs[tier.Name] = tier
+	}
+	return specs, nil
+}
+
+// sortedTierList returns tier specs ordered by name
+func sortedTierList(specs map[string]common.TierSpec) []common.TierSpec {
+	tiers := make([]common.TierSpec, 0, len(specs))
+	for _, spec := range specs {
+		tiers = append(tiers, spec)
+	}
+	sort.Slice(tiers, func(i, j int) bool {
+		return tiers[i].Name < tiers[j].Name
+	})
+	return tiers
+}
+
+// resolveTier returns the spec and tier set version to place a request with
+// Requests carrying X-Tier-Version: next (or the staged version hash) use the staged tier set
+// when one exists; everyone else keeps the current set
+// Tenants with their own tiers always use them (staged tier sets apply to the global set only)
+func (s *Server) resolveTier(r *http.Request, tier string) (common.TierSpec, string, bool) {
+	return s.lookupTier(requestTenant(r), tier, strings.TrimSpace(r.Header.Get(TierVersionHeader)))
+}
+
+// lookupTier is resolveTier for a tenant and requested tier set version ("", "next" or a version hash)
+func (s *Server) lookupTier(tenant, tier, requested string) (common.TierSpec, string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	specs, version := s.tierSpecs, s.tierVersion
+	if tenantSpecs, ok := s.tenantTierSpecs[tenant]; ok {
+		specs, version = tenantSpecs, s.tenantTierVersions[tenant]
+	} else if s.nextTierSpecs != nil {
+		if strings.EqualFold(requested, "next") || requested == s.nextTierVersion {
+			specs, version = s.nextTierSpecs, s.nextTierVersion
+		}
+	}
+
+	spec, ok := specs[tier]
+	spec.Tenant = tenant
+	return spec, version, ok
+}
+
+// handleNextTiers shows (GET), stages (PUT), or discards (DELETE) the next tier set
+func (s *Server) handleNextTiers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.writeTierSets(w)
+	case http.MethodPut, http.MethodPost:
+		var req tierSetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		specs, err := buildTierSpecs(req.Tiers)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		version := tierSetVersion(specs)
+
+		s.mu.Lock()
+		s.nextTierSpecs = specs
+		s.nextTierVersion = version
+		currentVersion := s.tierVersion
+		s.mu.Unlock()
+
+		LogInfoWithData("Staged next tier set", map[string]interface{}{
+			"version":         version,
+			"current_version": currentVersion,
+			"tiers":           len(specs),
+		})
+		s.writeTierSets(w)
+	case http.MethodDelete:
+		s.mu.Lock()
+		discarded := s.nextTierVersion
+		s.nextTierSpecs = nil
+		s.nextTierVersion = ""
+		s.mu.Unlock()
+
+		if discarded != "" {
+			LogInfoWithData("Discarded staged tier set", map[string]interface{}{
+				"version": discarded,
+			})
+		}
+		s.writeTierSets(w)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePromoteTiers makes the staged tier set current for all requests
+// Promotion is runtime-only: use PUT /admin/tiers or update tiers in the config file to keep it across restarts
+func (s *Server) handlePromoteTiers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	if s.nextTierSpecs == nil {
+		s.mu.Unlock()
+		http.Error(w, "No staged tier set to promote", http.StatusConflict)
+		return
+	}
+	previous := s.tierVersion
+	s.tierSpecs = s.nextTierSpecs
+	s.tierVersion = s.nextTierVersion
+	s.nextTierSpecs = nil
+	s.nextTierVersion = ""
+	promoted := s.tierVersion
+	s.mu.Unlock()
+
+	LogInfoWithData("Promoted tier set", map[string]interface{}{
+		"version":          promoted,
+		"previous_version": previous,
+	})
+	LogWarn("Promoted tier set is not persisted and will be replaced on restart (use PUT /admin/tiers to keep it)")
+
+	s.writeTierSets(w)
+}
+
+// writeTierSets encodes the current and staged tier sets
+func (s *Server) writeTierSets(w http.ResponseWriter) {
+	s.mu.RLock()
+	response := map[string]interface{}{
+		"current": map[string]interface{}{
+			"version": s.tierVersion,
+			"tiers":   sortedTierList(s.tierSpecs),
+		},
+		"next": nil,
+	}
+	if s.nextTierSpecs != nil {
+		response["next"] = map[string]interface{}{
+			"version": s.nextTierVersion,
+			"tiers":   sortedTierList(s.nextTierSpecs),
+		}
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Warning: Failed to encode tier sets: %v", err)
+	}
+}
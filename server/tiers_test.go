@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestTierSetVersion_ContentHash verifies the version ignores tier order but tracks spec changes
+func TestTierSetVersion_ContentHash(t *testing.T) {
+	a, _ := buildTierSpecs([]common.TierSpec{
+		{Name: "lite", VCPU: 1, MemoryGB: 1.0},
+		{Name: "pro", VCPU: 4, MemoryGB: 8.0},
+	})
+	b, _ := buildTierSpecs([]common.TierSpec{
+		{Name: "pro", VCPU: 4, MemoryGB: 8.0},
+		{Name: "lite", VCPU: 1, MemoryGB: 1.0},
+	})
+	c, _ := buildTierSpecs([]common.TierSpec{
+		{Name: "lite", VCPU: 1, MemoryGB: 2.0},
+		{Name: "pro", VCPU: 4, MemoryGB: 8.0},
+	})
+
+	if tierSetVersion(a) != tierSetVersion(b) {
+		t.Errorf("Expected reordered tier sets to share a version, got %s and %s", tierSetVersion(a), tierSetVersion(b))
+	}
+	if tierSetVersion(a) == tierSetVersion(c) {
+		t.Errorf("Expected changed memory requirement to change the version, got %s", tierSetVersion(c))
+	}
+}
+
+// TestHandleRoute_StagedTierSet verifies only X-Tier-Version: next requests see staged tiers until promotion
+func TestHandleRoute_StagedTierSet(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-1", TotalMemory: 32.0}))
+	currentVersion := server.tierVersion
+
+	// Stage a lite tier that no backend can fit
+	staged := `{"tiers":[{"name":"lite","vcpu":1,"memory_gb":64}]}`
+	rec := httptest.NewRecorder()
+	server.handleNextTiers(rec, httptest.NewRequest("PUT", "/tiers/next", bytes.NewReader([]byte(staged))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected staging to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	nextVersion := server.nextTierVersion
+
+	route := func(header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/route", bytes.NewReader([]byte(`{"tier":"lite"}`)))
+		if header != "" {
+			req.Header.Set(TierVersionHeader, header)
+		}
+		rec := httptest.NewRecorder()
+		server.handleRoute(rec, req)
+		server.ClearPendingAllocations()
+		return rec
+	}
+
+	rec = route("")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected current tier set to route, got %d", rec.Code)
+	}
+	var response common.RoutingResponse
+	json.NewDecoder(rec.Body).Decode(&response)
+	if response.TierVersion != currentVersion || rec.Header().Get(TierVersionHeader) != currentVersion {
+		t.Errorf("Expected tier version %s, got %s", currentVersion, response.TierVersion)
+	}
+
+	if rec := route("next"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected staged tier set to apply to next requests, got %d", rec.Code)
+	}
+	if rec := route(nextVersion); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected staged version hash to select the staged set, got %d", rec.Code)
+	}
+
+	// Promotion applies the staged set to everyone
+	rec = httptest.NewRecorder()
+	server.handlePromoteTiers(rec, httptest.NewRequest("POST", "/tiers/promote", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected promotion to succeed, got %d", rec.Code)
+	}
+	if server.tierVersion != nextVersion || server.nextTierSpecs != nil {
+		t.Errorf("Expected version %s to be current with nothing staged, got %s", nextVersion, server.tierVersion)
+	}
+	if rec := route(""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected promoted tier set to apply to all requests, got %d", rec.Code)
+	}
+}
+
+// TestHandleNextTiers_Validation verifies invalid tier sets are rejected and promotion requires a staged set
+func TestHandleNextTiers_Validation(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+
+	server := NewTestServer(t, db)
+
+	payloads := []string{
+		`{"tiers":[]}`,
+		`{"tiers":[{"vcpu":1}]}`,
+		`{"tiers":[{"name":"lite"},{"name":"lite"}]}`,
+		`{"tiers":[{"name":"lite","memory_gb":-1}]}`,
+	}
+	for _, payload := range payloads {
+		rec := httptest.NewRecorder()
+		server.handleNextTiers(rec, httptest.NewRequest("PUT", "/tiers/next", bytes.NewReader([]byte(payload))))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", payload, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	server.handlePromoteTiers(rec, httptest.NewRequest("POST", "/tiers/promote", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 without a staged tier set, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TierUtilization is a tier's spec plus current fleet-wide capacity, as reported by GET /tiers
+type TierUtilization struct {
+	common.TierSpec
+	EligibleBackends   int             `json:"eligible_backends"`          // Live, healthy backends that can take a new session now
+	CapacitySessions   int             `json:"capacity_sessions"`          // New sessions of this tier that fit across those backends
+	PendingAllocations int             `json:"pending_allocations"`        // In-flight placements of this tier
+	StickyAssignments  int             `json:"sticky_assignments"`         // Sticky sessions currently assigned for this tier
+	ShedProbability    float64         `json:"shed_probability,omitempty"` // Share of new proxy requests currently shed (load_shedding)
+	CPUCapacity        CPUCapacityRule `json:"cpu_capacity"`               // How free vCPUs are counted for this tier
+}
+
+// handleTiers handles GET /tiers: each tier's spec with current utilization
+// Tenant API keys see their own tier set and backends; global keys may pick one with ?tenant=
+func (s *Server) handleTiers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tenant, scoped := tenantFromContext(r)
+	if !scoped {
+		tenant = normalizeTenant(r.URL.Query().Get("tenant"))
+	}
+	if !s.knownTenant(tenant) {
+		http.Error(w, "Unknown tenant: "+tenant, http.StatusNotFound)
+		return
+	}
+
+	s.mu.RLock()
+	specs, version := s.tierSpecs, s.tierVersion
+	if tenantSpecs, ok := s.tenantTierSpecs[tenant]; ok {
+		specs, version = tenantSpecs, s.tenantTierVersions[tenant]
+	}
+	tiers := s.tierUtilizationLocked(sortedTierList(specs), tenant)
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"tenant":       tenant,
+		"tier_version": version,
+		"tiers":        tiers,
+		"timestamp":    time.Now(),
+	}); err != nil {
+		log.Printf("Warning: Failed to encode tiers response: %v", err)
+	}
+}
+
+// tierUtilizationLocked computes utilization for a tenant's tiers (caller must hold s.mu)
+func (s *Server) tierUtilizationLocked(specs []common.TierSpec, tenant string) []TierUtilization {
+	// Live, healthy backends of the tenant, i.e. the ones placement would consider
+	var candidates []*ClientState
+	for _, client := range s.clientCache {
+		if normalizeTenant(client.Registration.Tenant) != tenant || s.isStale(client) || s.awaitingApproval(client) {
+			continue
+		}
+		if s.config.HealthCheckEnabled && client.HealthStatus == "unhealthy" {
+			continue
+		}
+		candidates = append(candidates, client)
+	}
+
+	usage := make([]TierUtilization, 0, len(specs))
+	index := make(map[string]int, len(specs))
+	for _, spec := range specs {
+		spec.Tenant = tenant
+		tier := TierUtilization{
+			TierSpec:        spec,
+			ShedProbability: s.shedder.Probability(spec.Priority),
+			CPUCapacity:     s.cpuCapacityRule(spec).describe(),
+		}
+		for _, client := range candidates {
+			if !s.hasResourcesLocked(client, spec) {
+				continue
+			}
+			tier.EligibleBackends++
+			tier.CapacitySessions += s.tierCapacityLocked(client, spec)
+		}
+		index[spec.Name] = len(usage)
+		usage = append(usage, tier)
+	}
+
+	now := time.Now()
+	for clientID, allocations := range s.pendingAllocations {
+		if client, ok := s.clientCache[clientID]; !ok || normalizeTenant(client.Registration.Tenant) != tenant {
+			continue
+		}
+		for _, pending := range allocations {
+			if pending.expired(now) {
+				continue
+			}
+			if i, ok := index[pending.Tier]; ok {
+				usage[i].PendingAllocations++
+			}
+		}
+	}
+
+	for _, tierMap := range s.stickyAssignments {
+		for tierName, clientID := range tierMap {
+			i, ok := index[tierName]
+			if !ok {
+				continue
+			}
+			if client, ok := s.clientCache[clientID]; ok && normalizeTenant(client.Registration.Tenant) == tenant {
+				usage[i].StickyAssignments++
+			}
+		}
+	}
+
+	return usage
+}
+
+// tierCapacityLocked returns how many more sessions of a tier fit on a backend that passed
+// hasResourcesLocked, using the same rules: free vCPUs under the tier's cpu_capacity rule, available memory, disk
+// and GPUs, minus pending allocations
+func (s *Server) tierCapacityLocked(client *ClientState, tier common.TierSpec) int {
+	return s.tierCapacity(client, tier, s.tierHeadroomLocked(client, tier), s.pendingReservationLocked(client.Registration.ClientID))
+}
+
+// tierCapacity counts the sessions of a tier that fit in a backend's tier headroom after the given pending reservations
+func (s *Server) tierCapacity(client *ClientState, tier common.TierSpec, headroom backendHeadroom, pending pendingReservation) int {
+	capacity := math.MaxInt
+
+	fit := func(available, required float64) {
+		if required > 0 {
+			capacity = min(capacity, int(math.Floor(available/required)))
+		}
+	}
+
+	fit(float64(headroom.VCPU-pending.VCPU), float64(tier.VCPU))
+	fit(headroom.MemoryGB-pending.MemoryGB, tier.MemoryGB)
+	fit(headroom.StorageGB-float64(pending.StorageGB), float64(tier.StorageGB))
+
+	if fractionalGPU(tier) {
+		capacity = min(capacity, gpuSharesAvailable(client, tier, headroom, pending))
+	} else if tier.GPU > 0 {
+		fit(float64(headroom.GPUs)-busyGPUDevices(pending), tier.GPU)
+		if tier.GPUMemoryGB > 0 && len(client.Stats.GPUs) > 0 {
+			fit(headroom.GPUMemoryGB-pending.GPUMemoryGB, tier.GPUMemoryGB)
+		}
+	}
+
+	if s.config.MaxPendingPerBackend > 0 {
+		capacity = min(capacity, s.config.MaxPendingPerBackend-pending.allocations)
+	}
+
+	// A tier without resource requirements is limited by nothing; count the backend once
+	if capacity == math.MaxInt {
+		return 1
+	}
+	return max(capacity, 0)
+}
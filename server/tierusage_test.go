@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestHandleTiers verifies each tier reports eligible backends, session capacity,
+// pending allocations and sticky assignments
+func TestHandleTiers(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	// 8 idle cores, 24GB memory and 400GB disk available
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "idle"}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "busy", CPUUsageAvg: []float64{90, 90, 90, 90, 90, 90, 90, 90}}))
+	server.addPendingAllocation("idle", "user-1", "lite", server.tierSpecs["lite"], "req-1")
+	server.createStickyAssignment("user-1", "lite", "idle")
+
+	rec := httptest.NewRecorder()
+	server.handleTiers(rec, httptest.NewRequest("GET", "/tiers", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		TierVersion string            `json:"tier_version"`
+		Tiers       []TierUtilization `json:"tiers"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.TierVersion != server.tierVersion || len(resp.Tiers) != len(server.tierSpecs) {
+		t.Fatalf("Expected all %d tiers at version %s, got %+v", len(server.tierSpecs), server.tierVersion, resp)
+	}
+
+	tiers := make(map[string]TierUtilization)
+	for _, tier := range resp.Tiers {
+		tiers[tier.Name] = tier
+	}
+
+	// One core and 1GB are reserved by the pending lite allocation
+	lite := tiers["lite"]
+	if lite.VCPU != 1 || lite.EligibleBackends != 1 || lite.CapacitySessions != 7 {
+		t.Errorf("Expected lite: 1 vcpu, 1 eligible backend, 7 sessions, got %+v", lite)
+	}
+	if lite.PendingAllocations != 1 || lite.StickyAssignments != 1 {
+		t.Errorf("Expected lite: 1 pending allocation and 1 sticky assignment, got %+v", lite)
+	}
+
+	// 7 cores / 2 per session
+	if standard := tiers["pro-standard"]; standard.CapacitySessions != 3 || standard.PendingAllocations != 0 {
+		t.Errorf("Expected pro-standard: 3 sessions and no pending allocations, got %+v", standard)
+	}
+	if maxTier := tiers["pro-max"]; maxTier.EligibleBackends != 0 || maxTier.CapacitySessions != 0 {
+		t.Errorf("Expected pro-max to have no capacity, got %+v", maxTier)
+	}
+}
+
+// TestHandleTiers_UnknownTenant verifies unknown tenants are rejected
+func TestHandleTiers_UnknownTenant(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	rec := httptest.NewRecorder()
+	server.handleTiers(rec, httptest.NewRequest("GET", "/tiers?tenant=nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown tenant, got %d", rec.Code)
+	}
+}
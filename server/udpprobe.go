@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// probeUDP sends health_check_udp_payload to a backend and waits for a reply
+// An ICMP port unreachable fails the probe. Silence is ambiguous for UDP, since many services only answer
+// their own protocol: without health_check_udp_expect the host is pinged instead, so a live host
+// with nothing refusing the port counts as healthy
+func (s *Server) probeUDP(endpoint string, timeout time.Duration) (bool, time.Duration) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		LogWarn(fmt.Sprintf("Failed to parse endpoint for health check: %s", endpoint))
+		return false, 0
+	}
+	port := parsed.Port()
+	if s.config.HealthCheckUDPPort > 0 {
+		port = strconv.Itoa(s.config.HealthCheckUDPPort)
+	}
+	if port == "" {
+		return false, 0
+	}
+
+	start := time.Now()
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(parsed.Hostname(), port), timeout)
+	if err != nil {
+		return false, time.Since(start)
+	}
+	defer conn.Close()
+	conn.SetDeadline(start.Add(timeout))
+
+	if _, err := conn.Write([]byte(s.config.HealthCheckUDPPayload)); err != nil {
+		return false, time.Since(start)
+	}
+	buf := make([]byte, 2048)
+	n, err := conn.Read(buf)
+	latency := time.Since(start)
+	if err == nil {
+		return bytes.Contains(buf[:n], []byte(s.config.HealthCheckUDPExpect)), latency
+	}
+
+	var netErr net.Error
+	silent := errors.As(err, &netErr) && netErr.Timeout() && !errors.Is(err, syscall.ECONNREFUSED)
+	if !silent || s.config.HealthCheckUDPExpect != "" || s.pinger == nil {
+		return false, latency
+	}
+	return s.pinger.Ping(parsed.Hostname(), timeout)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// startUDPService answers each datagram with reply, or stays silent if reply is nil
+func startUDPService(t *testing.T, reply []byte) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			_, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if reply != nil {
+				conn.WriteTo(reply, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// TestProbeUDP verifies replies, health_check_udp_expect and refused ports decide UDP health
+func TestProbeUDP(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.HealthCheckType = HealthCheckTypeUDP
+		c.HealthCheckUDPPayload = "status"
+	})
+
+	answering := startUDPService(t, []byte("OK ready"))
+	if ok, _, _ := server.probeEndpoint("udp://"+answering, time.Second); !ok {
+		t.Error("Expected a backend that replies to be healthy")
+	}
+
+	server.config.HealthCheckUDPExpect = "ready"
+	if ok, _, _ := server.probeEndpoint("udp://"+answering, time.Second); !ok {
+		t.Error("Expected a reply containing the expected text to be healthy")
+	}
+	server.config.HealthCheckUDPExpect = "PONG"
+	if ok, _, _ := server.probeEndpoint("udp://"+answering, time.Second); ok {
+		t.Error("Expected a reply without the expected text to be unhealthy")
+	}
+
+	// Silence is a failure when a reply is expected
+	silent := startUDPService(t, nil)
+	if ok, _, _ := server.probeEndpoint("udp://"+silent, 200*time.Millisecond); ok {
+		t.Error("Expected a silent backend to be unhealthy when a reply is expected")
+	}
+
+	// Nothing listening: the kernel answers with port unreachable
+	server.config.HealthCheckUDPExpect = ""
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	closed := conn.LocalAddr().String()
+	conn.Close()
+	if ok, _, _ := server.probeEndpoint("udp://"+closed, time.Second); ok {
+		t.Error("Expected a closed port to be unhealthy")
+	}
+}
+
+// TestProbeUDP_PingFallback verifies a silent service counts as healthy when its host answers ping
+func TestProbeUDP_PingFallback(t *testing.T) {
+	pinger, err := NewICMPPinger()
+	if err != nil {
+		t.Skipf("ICMP sockets unavailable: %v", err)
+	}
+	defer pinger.Close()
+
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.HealthCheckType = HealthCheckTypeUDP
+	})
+	silent := startUDPService(t, nil)
+	if ok, _, _ := server.probeEndpoint("udp://"+silent, 200*time.Millisecond); ok {
+		t.Error("Expected a silent backend to be unhealthy without ping")
+	}
+
+	server.pinger = pinger
+	if ok, _ := pinger.Ping("127.0.0.1", time.Second); !ok {
+		t.Skip("Loopback does not answer ping in this environment")
+	}
+	if ok, _, _ := server.probeEndpoint("udp://"+silent, 200*time.Millisecond); !ok {
+		t.Error("Expected a silent backend on a host that answers ping to be healthy")
+	}
+
+	server.config.HealthCheckType = HealthCheckTypeICMP
+	if ok, _, _ := server.probeEndpoint("http://127.0.0.1:11000", time.Second); !ok {
+		t.Error("Expected an icmp probe of loopback to succeed")
+	}
+	// A different address must not be satisfied by another request's reply
+	if ok, _ := pinger.Ping("203.0.113.7", 200*time.Millisecond); ok {
+		t.Error("Expected no reply from a documentation address")
+	}
+}
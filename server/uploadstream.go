@@ -0,0 +1,153 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// uploadThroughputAlpha weighs the latest upload in a backend's throughput average
+const uploadThroughputAlpha = 0.3
+
+// UploadStatus is a backend's streamed upload history reported by /clients
+type UploadStatus struct {
+	Uploads        int64   `json:"uploads"`
+	Bytes          int64   `json:"bytes"`
+	ThroughputMBps float64 `json:"throughput_mbps"` // EWMA over completed uploads
+	LastMBps       float64 `json:"last_mbps"`
+}
+
+// UploadMeter tracks upload throughput of request bodies streamed to each backend
+type UploadMeter struct {
+	mu     sync.Mutex
+	status map[string]*UploadStatus
+}
+
+// NewUploadMeter creates a meter, or returns nil if no proxy route streams request bodies
+func NewUploadMeter(routes []common.ProxyRouteConfig) *UploadMeter {
+	for _, route := range routes {
+		if route.StreamRequestBody {
+			return &UploadMeter{status: make(map[string]*UploadStatus)}
+		}
+	}
+	return nil
+}
+
+// Record adds a finished (or aborted) upload and returns the backend's updated status
+func (m *UploadMeter) Record(clientID string, bytes int64, elapsed time.Duration) UploadStatus {
+	if m == nil {
+		return UploadStatus{}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status, ok := m.status[clientID]
+	if !ok {
+		status = &UploadStatus{}
+		m.status[clientID] = status
+	}
+	status.Uploads++
+	status.Bytes += bytes
+	if elapsed > 0 {
+		status.LastMBps = float64(bytes) / 1024 / 1024 / elapsed.Seconds()
+		if status.ThroughputMBps == 0 {
+			status.ThroughputMBps = status.LastMBps
+		} else {
+			status.ThroughputMBps = uploadThroughputAlpha*status.LastMBps + (1-uploadThroughputAlpha)*status.ThroughputMBps
+		}
+	}
+	return *status
+}
+
+// Status returns a backend's upload history (false if it received no streamed uploads)
+func (m *UploadMeter) Status(clientID string) (UploadStatus, bool) {
+	if m == nil {
+		return UploadStatus{}, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status, ok := m.status[clientID]
+	if !ok {
+		return UploadStatus{}, false
+	}
+	return *status, true
+}
+
+// Remove forgets a deregistered backend
+func (m *UploadMeter) Remove(clientID string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	delete(m.status, clientID)
+	m.mu.Unlock()
+}
+
+// meteredUploadBody passes a client's request body through to the backend unbuffered,
+// counting bytes until the body ends or the transport closes it
+type meteredUploadBody struct {
+	body  io.ReadCloser
+	start time.Time
+	bytes int64
+	once  sync.Once
+	done  func(bytes int64, elapsed time.Duration)
+}
+
+func newMeteredUploadBody(body io.ReadCloser, done func(bytes int64, elapsed time.Duration)) *meteredUploadBody {
+	return &meteredUploadBody{body: body, start: time.Now(), done: done}
+}
+
+func (b *meteredUploadBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.bytes += int64(n)
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *meteredUploadBody) Close() error {
+	b.finish()
+	return b.body.Close()
+}
+
+func (b *meteredUploadBody) finish() {
+	b.once.Do(func() {
+		if b.bytes > 0 {
+			b.done(b.bytes, time.Since(b.start))
+		}
+	})
+}
+
+// recordUpload stores a streamed upload's throughput and exports it
+func (s *Server) recordUpload(client *ClientState, bytes int64, elapsed time.Duration) {
+	status := s.uploads.Record(client.Registration.ClientID, bytes, elapsed)
+
+	LogDebugWithData("Streamed upload finished", map[string]interface{}{
+		"client_id":       client.Registration.ClientID,
+		"bytes":           bytes,
+		"elapsed":         elapsed.String(),
+		"throughput_mbps": status.LastMBps,
+	})
+
+	now := time.Now()
+	labels := []statsLabel{{"client_id", client.Registration.ClientID}, {"tenant", normalizeTenant(client.Registration.Tenant)}}
+	s.exporters.ExportPoints([]statsPoint{
+		{"opsen_proxy_upload", "throughput_mbps", labels, status.LastMBps, now},
+		{"opsen_proxy_upload", "bytes_total", labels, float64(status.Bytes), now},
+		{"opsen_proxy_upload", "uploads_total", labels, float64(status.Uploads), now},
+	})
+}
+
+// proxyMaxBodyBytes returns the request body limit for a proxied path (0 = unlimited)
+// Routes that stream uploads usually raise it well above max_request_body_bytes
+func (s *Server) proxyMaxBodyBytes(r *http.Request) int64 {
+	if route := s.proxyRouteFor(r.URL.Path); route != nil && route.MaxBodyBytes != 0 {
+		return max(route.MaxBodyBytes, 0)
+	}
+	return s.config.MaxRequestBodyBytes
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// newUploadTestServer creates a proxy with one backend that echoes how many body bytes it received
+func newUploadTestServer(t *testing.T, routes []common.ProxyRouteConfig) (*Server, *httptest.Server) {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := io.Copy(io.Discard, r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("X-Received-Bytes", strconv.FormatInt(n, 10))
+		w.Header().Set("X-Received-Chunked", strconv.FormatBool(len(r.TransferEncoding) > 0))
+	}))
+	t.Cleanup(backend.Close)
+
+	db, cleanup := CreateTestDB(t)
+	t.Cleanup(cleanup)
+
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.ProxyRoutes = routes
+		c.MaxRequestBodyBytes = 1024
+	})
+	server.AddMockClient(NewMockClient(MockClientOptions{
+		ClientID:    "upload-backend",
+		Endpoint:    backend.URL,
+		CPUUsageAvg: []float64{10, 10, 10, 10, 10, 10, 10, 10},
+		MemoryAvail: 50.0,
+		DiskAvail:   100.0,
+	}))
+
+	proxy := httptest.NewServer(ChainMiddleware(http.HandlerFunc(server.handleProxyOrNotFound), RequestSizeLimitFunc(server.proxyMaxBodyBytes)))
+	t.Cleanup(proxy.Close)
+	return server, proxy
+}
+
+// TestStreamRequestBody_ChunkedUpload verifies a chunked upload larger than the global limit reaches the backend and is metered
+func TestStreamRequestBody_ChunkedUpload(t *testing.T) {
+	server, proxy := newUploadTestServer(t, []common.ProxyRouteConfig{
+		{Prefix: "/upload", StreamRequestBody: true, MaxBodyBytes: -1},
+	})
+
+	const size = 8 << 20
+	body := io.LimitReader(strings.NewReader(strings.Repeat("x", size)), size)
+	req, _ := http.NewRequest("PUT", proxy.URL+"/upload/file?tier=lite", io.NopCloser(body)) // Unknown length: sent chunked
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("X-Received-Bytes"); got != strconv.Itoa(size) {
+		t.Errorf("Expected backend to receive %d bytes, got %s", size, got)
+	}
+	if resp.Header.Get("X-Received-Chunked") != "true" {
+		t.Error("Expected the upload to stay chunked to the backend")
+	}
+
+	// The meter is updated when the transport closes the body, which may trail the response
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		status, ok := server.uploads.Status("upload-backend")
+		if ok {
+			if status.Uploads != 1 || status.Bytes != size || status.ThroughputMBps <= 0 {
+				t.Errorf("Unexpected upload status: %+v", status)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the upload to be metered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestStreamRequestBody_Limits verifies per-route body limits on streamed and buffered prefixes
+func TestStreamRequestBody_Limits(t *testing.T) {
+	_, proxy := newUploadTestServer(t, []common.ProxyRouteConfig{
+		{Prefix: "/upload", StreamRequestBody: true, MaxBodyBytes: 4096},
+		{Prefix: "/api"},
+	})
+
+	tests := []struct {
+		path     string
+		size     int
+		expected int
+	}{
+		{"/upload/ok", 4096, http.StatusOK},
+		{"/upload/big", 8192, http.StatusRequestEntityTooLarge},
+		{"/api/small", 512, http.StatusOK},
+		{"/api/big", 2048, http.StatusBadRequest}, // Buffered prefixes keep max_request_body_bytes
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", proxy.URL+tt.path, bytes.NewReader(bytes.Repeat([]byte("x"), tt.size)))
+		req.Header.Set("X-Tier", "lite")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tt.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.expected {
+			t.Errorf("%s: expected %d, got %d", tt.path, tt.expected, resp.StatusCode)
+		}
+	}
+}
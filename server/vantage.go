@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// Vantage probe limits
+const (
+	maxVantageResultsPerReport = 10000           // Bounds a single probe report
+	defaultVantageMaxAge       = 5 * time.Minute // When vantage_probes.max_age_seconds is not set
+)
+
+// VantageProbe is the location of a probe agent and when it last reported
+type VantageProbe struct {
+	Region     string
+	Latitude   float64
+	Longitude  float64
+	LastReport time.Time
+}
+
+// VantageLatency is a backend's latency as measured from one probe region
+type VantageLatency struct {
+	LatencyMs  float64
+	Error      string // Dial error when the backend was unreachable from the probe
+	MeasuredAt time.Time
+}
+
+// handleVantageTargets lists the live backends a probe agent should measure
+// Tenant API keys only see their own tenant's backends
+func (s *Server) handleVantageTargets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	keyTenant, scoped := tenantFromContext(r)
+
+	s.mu.RLock()
+	response := common.VantageTargetsResponse{Targets: []common.VantageTarget{}}
+	for clientID, client := range s.clientCache {
+		if s.isStale(client) || client.Endpoint == "" {
+			continue
+		}
+		if scoped && normalizeTenant(client.Registration.Tenant) != keyTenant {
+			continue
+		}
+		response.Targets = append(response.Targets, common.VantageTarget{ClientID: clientID, Endpoint: client.Endpoint})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(response.Targets, func(i, j int) bool {
+		return response.Targets[i].ClientID < response.Targets[j].ClientID
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Warning: Failed to encode vantage targets response: %v", err)
+	}
+}
+
+// handleVantageReport stores the latencies a probe agent measured from its region
+// Each report replaces the region's previous measurements for the backends the key can see
+func (s *Server) handleVantageReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var report common.VantageReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON body: %v. Expected {\"region\": ..., \"latitude\": ..., \"longitude\": ..., \"results\": [...]}.", err), http.StatusBadRequest)
+		return
+	}
+	if report.Region == "" {
+		http.Error(w, "Missing required field: region", http.StatusBadRequest)
+		return
+	}
+	if report.Latitude == 0 && report.Longitude == 0 {
+		http.Error(w, "Missing required fields: latitude, longitude (end users are matched to the nearest probe)", http.StatusBadRequest)
+		return
+	}
+	if len(report.Results) > maxVantageResultsPerReport {
+		http.Error(w, fmt.Sprintf("Too many results in report: %d (max %d)", len(report.Results), maxVantageResultsPerReport), http.StatusRequestEntityTooLarge)
+		return
+	}
+	keyTenant, scoped := tenantFromContext(r)
+
+	now := time.Now()
+	maxAge := s.vantageMaxAge()
+	accepted := 0
+
+	s.mu.Lock()
+	s.invalidateRoutingSnapshot()
+	results := make(map[string]common.VantageResult, len(report.Results))
+	for _, result := range report.Results {
+		results[result.ClientID] = result
+	}
+	for clientID, client := range s.clientCache {
+		if scoped && normalizeTenant(client.Registration.Tenant) != keyTenant {
+			// Drop what other reports left behind once it is too old to route on
+			if measured, ok := client.VantageLatencies[report.Region]; ok && now.Sub(measured.MeasuredAt) > maxAge {
+				delete(client.VantageLatencies, report.Region)
+			}
+			continue
+		}
+		result, ok := results[clientID]
+		if !ok || result.LatencyMs < 0 || math.IsNaN(result.LatencyMs) || math.IsInf(result.LatencyMs, 0) {
+			delete(client.VantageLatencies, report.Region)
+			continue
+		}
+		if client.VantageLatencies == nil {
+			client.VantageLatencies = make(map[string]VantageLatency)
+		}
+		client.VantageLatencies[report.Region] = VantageLatency{LatencyMs: result.LatencyMs, Error: result.Error, MeasuredAt: now}
+		accepted++
+	}
+	ignored := len(results) - accepted
+	s.vantageProbes[report.Region] = &VantageProbe{
+		Region:     report.Region,
+		Latitude:   report.Latitude,
+		Longitude:  report.Longitude,
+		LastReport: now,
+	}
+	s.mu.Unlock()
+
+	LogInfoWithData("Vantage probe report received", map[string]interface{}{
+		"region":   report.Region,
+		"accepted": accepted,
+		"ignored":  ignored,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"region":   report.Region,
+		"accepted": accepted,
+		"ignored":  ignored,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode vantage report response: %v", err)
+	}
+}
+
+// nearestVantageRegion returns the region of the fresh probe closest to the end user
+// Returns "" when the user's location is unknown or no probe qualifies
+func (s *Server) nearestVantageRegion(clientLat, clientLon float64) string {
+	if clientLat == 0 && clientLon == 0 {
+		return ""
+	}
+	maxAge := s.vantageMaxAge()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	best, bestDistance := "", math.MaxFloat64
+	for region, probe := range s.vantageProbes {
+		if time.Since(probe.LastReport) > maxAge {
+			continue
+		}
+		distance := haversineDistance(clientLat, clientLon, probe.Latitude, probe.Longitude)
+		if s.config.VantageProbes.MaxDistanceKm > 0 && distance > s.config.VantageProbes.MaxDistanceKm {
+			continue
+		}
+		if distance < bestDistance || (distance == bestDistance && region < best) {
+			best, bestDistance = region, distance
+		}
+	}
+	return best
+}
+
+// applyVantageRegion selects the probe region whose latencies the placement uses
+// The end user's location comes from the request, or from GeoIP when the request has none
+func (s *Server) applyVantageRegion(tierSpec *common.TierSpec, clientLat, clientLon float64, clientIP string) {
+	s.mu.RLock()
+	hasProbes := len(s.vantageProbes) > 0
+	s.mu.RUnlock()
+	if !hasProbes {
+		return
+	}
+
+	if clientLat == 0 && clientLon == 0 && clientIP != "" {
+		info, _ := s.lookupIP(clientIP)
+		clientLat, clientLon = info.Latitude, info.Longitude
+	}
+	tierSpec.VantageRegion = s.nearestVantageRegion(clientLat, clientLon)
+}
+
+// vantageMaxAge is how long a probe's report stays usable for routing
+func (s *Server) vantageMaxAge() time.Duration {
+	if s.config.VantageProbes.MaxAgeSecs <= 0 {
+		return defaultVantageMaxAge
+	}
+	return time.Duration(s.config.VantageProbes.MaxAgeSecs) * time.Second
+}
+
+// backendLatency is the latency routing uses for a backend: as measured from the end user's probe
+// region when that region has measured it, otherwise the load balancer's own health check EWMA
+func backendLatency(client *ClientState, tier common.TierSpec) float64 {
+	if tier.VantageRegion != "" {
+		if measured, ok := client.VantageLatencies[tier.VantageRegion]; ok {
+			return measured.LatencyMs
+		}
+	}
+	return client.LatencyMs
+}
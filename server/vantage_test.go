@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// postVantageReport sends a probe report to the server
+func postVantageReport(t *testing.T, server *Server, report common.VantageReport) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(report)
+	rec := httptest.NewRecorder()
+	server.handleVantageReport(rec, httptest.NewRequest("POST", "/vantage/report", bytes.NewReader(body)))
+	return rec
+}
+
+// TestVantageProbes_RouteUsesNearestRegion verifies placements use the latency measured from the probe
+// region closest to the end user, and the load balancer's own latency when no probe applies
+func TestVantageProbes_RouteUsesNearestRegion(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	europe := NewMockClient(MockClientOptions{ClientID: "europe"})
+	europe.LatencyMs = 10
+	asia := NewMockClient(MockClientOptions{ClientID: "asia"})
+	asia.LatencyMs = 80
+	server.AddMockClient(europe)
+	server.AddMockClient(asia)
+
+	reports := []common.VantageReport{
+		{Region: "eu-central", Latitude: 50.1, Longitude: 8.7, Results: []common.VantageResult{
+			{ClientID: "europe", LatencyMs: 15}, {ClientID: "asia", LatencyMs: 150}}},
+		{Region: "ap-south", Latitude: 19.1, Longitude: 72.9, Results: []common.VantageResult{
+			{ClientID: "europe", LatencyMs: 140}, {ClientID: "asia", LatencyMs: 12}, {ClientID: "unknown", LatencyMs: 1}}},
+	}
+	for _, report := range reports {
+		if rec := postVantageReport(t, server, report); rec.Code != http.StatusOK {
+			t.Fatalf("Expected report from %s to be accepted, got %d: %s", report.Region, rec.Code, rec.Body.String())
+		}
+	}
+
+	route := func(lat, lon float64) string {
+		t.Helper()
+		body, _ := json.Marshal(common.RoutingRequest{Tier: "lite", ClientLat: lat, ClientLon: lon})
+		rec := httptest.NewRecorder()
+		server.handleRoute(rec, httptest.NewRequest("POST", "/route", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp common.RoutingResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp.ClientID
+	}
+
+	// Backends have no location, so latency decides the placement
+	if got := route(28.6, 77.2); got != "asia" {
+		t.Errorf("Expected a user in Delhi to be placed via ap-south measurements on asia, got %s", got)
+	}
+	if got := route(48.9, 2.4); got != "europe" {
+		t.Errorf("Expected a user in Paris to be placed via eu-central measurements on europe, got %s", got)
+	}
+	if got := route(0, 0); got != "europe" {
+		t.Errorf("Expected a user without location to be placed by the LB's own latency on europe, got %s", got)
+	}
+
+	// Probes that stopped reporting are no longer used
+	server.mu.Lock()
+	server.vantageProbes["ap-south"].LastReport = time.Now().Add(-time.Hour)
+	server.mu.Unlock()
+	if region := server.nearestVantageRegion(28.6, 77.2); region != "eu-central" {
+		t.Errorf("Expected the stale ap-south probe to be skipped, got %q", region)
+	}
+}
+
+// TestVantageProbes_ReportReplacesRegion verifies a report replaces its region's measurements and is validated
+func TestVantageProbes_ReportReplacesRegion(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "a"}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "b"}))
+
+	postVantageReport(t, server, common.VantageReport{Region: "us-east", Latitude: 39, Longitude: -77,
+		Results: []common.VantageResult{{ClientID: "a", LatencyMs: 20}, {ClientID: "b", LatencyMs: 30}}})
+	postVantageReport(t, server, common.VantageReport{Region: "us-east", Latitude: 39, Longitude: -77,
+		Results: []common.VantageResult{{ClientID: "a", LatencyMs: 2000, Error: "i/o timeout"}}})
+
+	server.mu.RLock()
+	a, b := server.clientCache["a"].VantageLatencies["us-east"], server.clientCache["b"].VantageLatencies
+	server.mu.RUnlock()
+	if a.LatencyMs != 2000 || a.Error == "" {
+		t.Errorf("Expected the latest measurement of a with its error, got %+v", a)
+	}
+	if _, ok := b["us-east"]; ok {
+		t.Error("Expected b's measurement to be dropped when the region's latest report omits it")
+	}
+
+	for name, report := range map[string]common.VantageReport{
+		"missing region":   {Latitude: 39, Longitude: -77},
+		"missing location": {Region: "us-east"},
+	} {
+		if rec := postVantageReport(t, server, report); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, rec.Code)
+		}
+	}
+}
+
+// TestVantageTargets_TenantScoped verifies tenant API keys only receive their own backends as probe targets
+func TestVantageTargets_TenantScoped(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "shared"}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "acme-1", Tenant: "acme"}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "old", LastSeen: time.Now().Add(-time.Hour)}))
+
+	targets := func(r *http.Request) []string {
+		rec := httptest.NewRecorder()
+		server.handleVantageTargets(rec, r)
+		var resp common.VantageTargetsResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		ids := []string{}
+		for _, target := range resp.Targets {
+			ids = append(ids, target.ClientID)
+		}
+		return ids
+	}
+
+	if got := targets(httptest.NewRequest("GET", "/vantage/targets", nil)); len(got) != 2 || got[0] != "acme-1" || got[1] != "shared" {
+		t.Errorf("Expected the live backends acme-1 and shared, got %v", got)
+	}
+	scoped := withTenant(httptest.NewRequest("GET", "/vantage/targets", nil), "acme")
+	if got := targets(scoped); len(got) != 1 || got[0] != "acme-1" {
+		t.Errorf("Expected only acme-1 for the acme tenant, got %v", got)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Slow start modes
+const (
+	slowStartPenalty = "penalty" // Score penalty fading out over the window
+	slowStartRamp    = "ramp"    // Share of new placements growing linearly over the window
+)
+
+// defaultSlowStartPenalty is the initial score penalty when score_penalty is unset
+const defaultSlowStartPenalty = 100.0
+
+// slowStartWindow returns the configured warm-up length (0 = disabled)
+func (s *Server) slowStartWindow() time.Duration {
+	return time.Duration(s.config.SlowStart.WindowSecs) * time.Second
+}
+
+// startWarmupLocked puts a backend into its slow-start window (lock must be held)
+func (s *Server) startWarmupLocked(client *ClientState, reason string) {
+	if s.slowStartWindow() <= 0 {
+		return
+	}
+	client.WarmingSince = time.Now()
+	LogInfoWithData("Backend warming up", map[string]interface{}{
+		"client_id": client.Registration.ClientID,
+		"reason":    reason,
+		"window":    s.slowStartWindow().String(),
+		"mode":      s.slowStartMode(),
+	})
+}
+
+func (s *Server) slowStartMode() string {
+	if s.config.SlowStart.Mode == slowStartRamp {
+		return slowStartRamp
+	}
+	return slowStartPenalty
+}
+
+// warmupProgress returns how far a backend is through its slow-start window (0 = just started, 1 = warm)
+func (s *Server) warmupProgress(client *ClientState, now time.Time) float64 {
+	window := s.slowStartWindow()
+	if window <= 0 || client.WarmingSince.IsZero() {
+		return 1
+	}
+	elapsed := now.Sub(client.WarmingSince)
+	if elapsed >= window {
+		return 1
+	}
+	if elapsed < 0 {
+		return 0
+	}
+	return float64(elapsed) / float64(window)
+}
+
+// warmupPenalty returns the score penalty for a warming backend in penalty mode
+func (s *Server) warmupPenalty(progress float64) float64 {
+	if progress >= 1 || s.slowStartMode() != slowStartPenalty {
+		return 0
+	}
+	penalty := s.config.SlowStart.ScorePenalty
+	if penalty <= 0 {
+		penalty = defaultSlowStartPenalty
+	}
+	return penalty * (1 - progress)
+}
+
+// warmupAdmit reports whether a warming backend may take a new placement in ramp mode
+func (s *Server) warmupAdmit(progress float64) bool {
+	if progress >= 1 || s.slowStartMode() != slowStartRamp {
+		return true
+	}
+	return rand.Float64() < progress
+}
+
+// warmupStatus describes a backend's warm-up for /clients (empty when warm)
+func (s *Server) warmupStatus(client *ClientState, now time.Time) string {
+	progress := s.warmupProgress(client, now)
+	if progress >= 1 {
+		return ""
+	}
+	return fmt.Sprintf("%.0f%%", progress*100)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestFindBestClient_SlowStartPenalty verifies a warming backend loses to a slightly busier warm one until the window ends
+func TestFindBestClient_SlowStartPenalty(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.SlowStart = common.SlowStartConfig{WindowSecs: 60, Mode: "penalty", ScorePenalty: 100}
+	})
+
+	warm := NewMockClient(MockClientOptions{ClientID: "warm", CPUUsageAvg: []float64{30, 30, 30, 30, 30, 30, 30, 30}})
+	cold := NewMockClient(MockClientOptions{ClientID: "cold", CPUUsageAvg: []float64{5, 5, 5, 5, 5, 5, 5, 5}})
+	cold.WarmingSince = time.Now()
+	server.AddMockClient(warm)
+	server.AddMockClient(cold)
+
+	tier := server.tierSpecs["lite"]
+	AssertClientSelected(t, server.findBestClient(tier, 0, 0), "warm")
+
+	cold.WarmingSince = time.Now().Add(-2 * time.Minute)
+	server.invalidateRoutingSnapshot()
+	AssertClientSelected(t, server.findBestClient(tier, 0, 0), "cold")
+}
+
+// TestFindBestClient_SlowStartRamp verifies ramp mode holds a just-registered backend back unless it is the only option
+func TestFindBestClient_SlowStartRamp(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.SlowStart = common.SlowStartConfig{WindowSecs: 60, Mode: "ramp"}
+	})
+
+	warm := NewMockClient(MockClientOptions{ClientID: "warm", CPUUsageAvg: []float64{50, 50, 50, 50, 50, 50, 50, 50}})
+	cold := NewMockClient(MockClientOptions{ClientID: "cold", CPUUsageAvg: []float64{5, 5, 5, 5, 5, 5, 5, 5}})
+	cold.WarmingSince = time.Now().Add(time.Second) // Progress stays at 0 for the whole test
+	server.AddMockClient(warm)
+	server.AddMockClient(cold)
+
+	tier := server.tierSpecs["lite"]
+	for i := 0; i < 20; i++ {
+		AssertClientSelected(t, server.findBestClient(tier, 0, 0), "warm")
+	}
+
+	server.mu.Lock()
+	delete(server.clientCache, "warm")
+	server.mu.Unlock()
+	AssertClientSelected(t, server.findBestClient(tier, 0, 0), "cold")
+}
+
+// TestSlowStart_Triggers verifies warm-up starts on first registration and health recovery, but not on re-registration
+func TestSlowStart_Triggers(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServerWithConfig(t, db, func(c *common.ServerConfig) {
+		c.SlowStart = common.SlowStartConfig{WindowSecs: 60}
+	})
+
+	register := func() {
+		body, _ := json.Marshal(common.ClientRegistration{ClientID: "backend-1", EndpointURL: "http://10.0.0.1:8000"})
+		server.handleRegister(httptest.NewRecorder(), httptest.NewRequest("POST", "/register", bytes.NewReader(body)))
+	}
+
+	register()
+	client := server.clientCache["backend-1"]
+	if client.WarmingSince.IsZero() {
+		t.Fatal("Expected a new backend to start warming up")
+	}
+
+	client.WarmingSince = time.Time{}
+	register()
+	client = server.clientCache["backend-1"]
+	if !client.WarmingSince.IsZero() {
+		t.Error("Expected a live backend re-registering to stay warm")
+	}
+
+	client.HealthStatus = "unhealthy"
+	for i := 0; i < server.config.HealthCheckHealthyThreshold; i++ {
+		server.updateHealthStatus(client, true, time.Millisecond)
+	}
+	if client.HealthStatus != "healthy" || client.WarmingSince.IsZero() {
+		t.Errorf("Expected recovery to start warm-up, got status=%s warming_since=%v", client.HealthStatus, client.WarmingSince)
+	}
+}
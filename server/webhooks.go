@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// Webhook delivery headers
+const (
+	WebhookEventHeader     = "X-Opsen-Event"
+	WebhookSignatureHeader = "X-Opsen-Webhook-Signature" // "sha256=<hex HMAC of the body>"
+)
+
+// webhookAttempts is how many times a delivery is tried before it is dropped
+const webhookAttempts = 3
+
+// WebhookEvent is the JSON body delivered to webhooks
+type WebhookEvent struct {
+	Event     string                 `json:"event"`
+	Timestamp time.Time              `json:"timestamp"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+type webhookDelivery struct {
+	hook common.WebhookConfig
+	body []byte
+	name string
+}
+
+// WebhookDispatcher delivers events to configured webhooks in the background
+// Deliveries are queued so request handlers never wait on slow receivers; a full queue drops events
+type WebhookDispatcher struct {
+	hooks  []common.WebhookConfig
+	client *http.Client
+	queue  chan webhookDelivery
+	done   chan struct{}
+	retry  time.Duration // Base delay between attempts (doubles each retry)
+
+	mu     sync.RWMutex // Held for reading while sending to queue, so Close can't close it mid-send
+	closed bool
+}
+
+// NewWebhookDispatcher starts a dispatcher, or returns nil if no webhooks are configured
+func NewWebhookDispatcher(hooks []common.WebhookConfig) *WebhookDispatcher {
+	if len(hooks) == 0 {
+		return nil
+	}
+	d := &WebhookDispatcher{
+		hooks:  hooks,
+		client: &http.Client{},
+		queue:  make(chan webhookDelivery, 1000),
+		done:   make(chan struct{}),
+		retry:  time.Second,
+	}
+	go d.run()
+	return d
+}
+
+// Emit queues an event for every webhook subscribed to it
+func (d *WebhookDispatcher) Emit(event string, data map[string]interface{}) {
+	if d == nil {
+		return
+	}
+
+	body, err := json.Marshal(WebhookEvent{Event: event, Timestamp: time.Now().UTC(), Data: data})
+	if err != nil {
+		log.Printf("Warning: Failed to encode webhook event %s: %v", event, err)
+		return
+	}
+
+	// Events raised by requests still in flight when shutdown times out land here after Close
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+	for _, hook := range d.hooks {
+		if !webhookSubscribed(hook, event) {
+			continue
+		}
+		select {
+		case d.queue <- webhookDelivery{hook: hook, body: body, name: event}:
+		default:
+			LogWarn(fmt.Sprintf("Webhook queue full, dropping %s event for %s", event, hook.URL))
+		}
+	}
+}
+
+// Close stops accepting events and waits for queued deliveries
+func (d *WebhookDispatcher) Close() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+	<-d.done
+}
+
+func webhookSubscribed(hook common.WebhookConfig, event string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, e := range hook.Events {
+		if e == event || e == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *WebhookDispatcher) run() {
+	defer close(d.done)
+	for delivery := range d.queue {
+		d.deliver(delivery)
+	}
+}
+
+// deliver posts one event, retrying connection errors and 5xx responses with backoff
+func (d *WebhookDispatcher) deliver(delivery webhookDelivery) {
+	timeout := time.Duration(delivery.hook.TimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	var lastErr error
+	delay := d.retry
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		if lastErr = d.post(delivery, timeout); lastErr == nil {
+			return
+		}
+		if attempt < webhookAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+
+	LogWarnWithData("Webhook delivery failed", map[string]interface{}{
+		"event": delivery.name,
+		"url":   delivery.hook.URL,
+		"error": lastErr.Error(),
+	})
+}
+
+func (d *WebhookDispatcher) post(delivery webhookDelivery, timeout time.Duration) error {
+	req, err := http.NewRequest(http.MethodPost, delivery.hook.URL, bytes.NewReader(delivery.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, delivery.name)
+	if delivery.hook.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, webhookSignature(delivery.hook.Secret, delivery.body))
+	}
+
+	client := *d.client
+	client.Timeout = timeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// webhookSignature returns the X-Opsen-Webhook-Signature value for a body
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
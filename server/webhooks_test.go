@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cyqle.in/opsen/common"
+)
+
+// TestWebhookDispatcher_EmitAfterClose verifies events raised by requests outliving shutdown are dropped instead of panicking
+func TestWebhookDispatcher_EmitAfterClose(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer hook.Close()
+
+	dispatcher := NewWebhookDispatcher([]common.WebhookConfig{{URL: hook.URL}})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			dispatcher.Emit("client.registered", map[string]interface{}{"client_id": "backend"})
+		}
+	}()
+	dispatcher.Close()
+	<-done
+
+	dispatcher.Emit("client.registered", map[string]interface{}{"client_id": "backend"})
+	dispatcher.Close() // A second Close is harmless
+}
@@ -285,7 +285,7 @@ func TestHandleProxy_StickySessionsWithWebSocket(t *testing.T) {
 
 	// Capture which client was selected
 	server.mu.RLock()
-	if tierMap, ok := server.stickyAssignments[sessionID]; ok {
+	if tierMap, ok := server.stickyAssignments[tenantStickyID(DefaultTenant, sessionID)]; ok {
 		if clientID, ok := tierMap[tier]; ok {
 			firstClientID = clientID
 		}
@@ -307,7 +307,7 @@ func TestHandleProxy_StickySessionsWithWebSocket(t *testing.T) {
 
 	// Verify same client was selected
 	server.mu.RLock()
-	tierMap, ok := server.stickyAssignments[sessionID]
+	tierMap, ok := server.stickyAssignments[tenantStickyID(DefaultTenant, sessionID)]
 	server.mu.RUnlock()
 
 	if !ok {
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"cyqle.in/opsen/common"
+)
+
+// maxSimulatedSessions caps the sessions one POST /simulate may place
+const maxSimulatedSessions = 10000
+
+// PlacementSimulationRequest is a hypothetical batch of new sessions for POST /simulate
+type PlacementSimulationRequest struct {
+	Requests []SimulatedDemand `json:"requests"`
+}
+
+// SimulatedDemand asks for count new sessions of a tier from end users at a location
+type SimulatedDemand struct {
+	Tier      string  `json:"tier"`
+	Count     int     `json:"count"` // Sessions to place (default: 1)
+	ClientLat float64 `json:"client_lat"`
+	ClientLon float64 `json:"client_lon"`
+}
+
+// SimulatedPlacement is where one demand's sessions would go
+type SimulatedPlacement struct {
+	Tier      string         `json:"tier"`
+	Requested int            `json:"requested"`
+	Placed    int            `json:"placed"`
+	Unplaced  int            `json:"unplaced"`
+	Backends  map[string]int `json:"backends"` // Client ID → sessions placed there
+}
+
+// SimulatedCapacity is a tier's spare capacity before and after the simulated sessions
+type SimulatedCapacity struct {
+	Tier                   string `json:"tier"`
+	CapacitySessionsBefore int    `json:"capacity_sessions_before"`
+	CapacitySessions       int    `json:"capacity_sessions"`
+	EligibleBackends       int    `json:"eligible_backends"` // Backends that can still take a session afterwards
+}
+
+// placementPlan is a private copy of the fleet and its pending allocations that simulated sessions
+// are reserved against, so the real scheduler's checks see them without touching live state
+type placementPlan struct {
+	backends    []routingBackend
+	allocations map[string][]PendingAllocation
+	now         time.Time
+}
+
+// newPlacementPlan copies the routing snapshot's backends of a tenant with their pending allocations
+func (s *Server) newPlacementPlan(tenant string, now time.Time) *placementPlan {
+	plan := &placementPlan{allocations: make(map[string][]PendingAllocation), now: now}
+	for _, backend := range s.routingSnapshot().backends {
+		if normalizeTenant(backend.client.Registration.Tenant) == tenant {
+			plan.backends = append(plan.backends, backend)
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, backend := range plan.backends {
+		id := backend.client.Registration.ClientID
+		plan.allocations[id] = slices.Clone(s.pendingAllocations[id])
+	}
+	return plan
+}
+
+// planFits checks a planned backend against a tier the way placement does, counting simulated sessions as pending
+func (s *Server) planFits(plan *placementPlan, backend routingBackend, tier common.TierSpec) (backendHeadroom, pendingReservation, bool) {
+	client := backend.client
+	pending, _ := reservationTotals(plan.allocations[client.Registration.ClientID], plan.now)
+	headroom := s.withTierCPU(withTierMemory(backend.headroom, client, tier), client, tier)
+	if !s.routable(client) || s.concurrency.Full(client.Registration.ClientID) || sessionsFull(client, pending.allocations) {
+		return headroom, pending, false
+	}
+	return headroom, pending, s.fitsTier(client, tier, headroom, pending)
+}
+
+// planPlace picks a backend for one new session like findBestClient and reserves the tier on it
+// Warming backends keep their score penalty but are not held back at random in ramp mode
+func (s *Server) planPlace(plan *placementPlan, tier common.TierSpec, clientLat, clientLon float64) *ClientState {
+	var ready, degraded []scoredBackend
+	byID := make(map[string]routingBackend)
+	for _, backend := range plan.backends {
+		client := backend.client
+		if _, _, ok := s.planFits(plan, backend, tier); !ok {
+			continue
+		}
+		distance := backendDistance(client, clientLat, clientLon)
+		score := s.placementScore(client, tier, distance) + s.warmupPenalty(s.warmupProgress(client, plan.now))
+		byID[client.Registration.ClientID] = backend
+		if !withinLatencyBudget(client, tier, distance) {
+			if tier.AllowDegraded {
+				degraded = append(degraded, scoredBackend{client: client, score: score})
+			}
+			continue
+		}
+		ready = append(ready, scoredBackend{client: client, score: score})
+	}
+
+	for _, candidates := range [][]scoredBackend{ready, degraded} {
+		if len(candidates) == 0 {
+			continue
+		}
+		sortCandidates(candidates)
+		client := candidates[0].client
+		id := client.Registration.ClientID
+		_, pending, _ := s.planFits(plan, byID[id], tier)
+		plan.allocations[id] = append(plan.allocations[id], PendingAllocation{
+			Tier:      tier.Name,
+			TierSpec:  tier,
+			Timestamp: plan.now,
+			GPUSet:    pickGPUSet(client, tier, byID[id].headroom, pending),
+			ExpiresAt: plan.now.Add(s.leaseTTL()),
+		})
+		return client
+	}
+	return nil
+}
+
+// planCapacity sums a tier's spare sessions and eligible backends across the plan
+func (s *Server) planCapacity(plan *placementPlan, tier common.TierSpec) (sessions, backends int) {
+	for _, backend := range plan.backends {
+		headroom, pending, ok := s.planFits(plan, backend, tier)
+		if !ok {
+			continue
+		}
+		backends++
+		sessions += s.tierCapacity(backend.client, tier, headroom, pending)
+	}
+	return sessions, backends
+}
+
+// handleSimulate handles POST /simulate: places a hypothetical batch of new sessions with the real
+// placement checks and scoring, on a copy of the fleet, and reports where they would go and what capacity
+// would be left. Nothing is reserved, so it is safe to ask "would 200 more pro-turbo sessions fit?"
+// Sessions are placed in request order as if they arrived together: later ones see earlier ones as
+// pending allocations, but backend stats stay as last reported. Sticky assignments and routing rules don't apply
+func (s *Server) handleSimulate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PlacementSimulationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Requests) == 0 {
+		http.Error(w, "requests must not be empty", http.StatusBadRequest)
+		return
+	}
+	tenant := requestTenant(r)
+	if !s.knownTenant(tenant) {
+		http.Error(w, fmt.Sprintf("Unknown tenant: %s", tenant), http.StatusBadRequest)
+		return
+	}
+
+	specs := make([]common.TierSpec, len(req.Requests))
+	var tierVersion string
+	total := 0
+	for i, demand := range req.Requests {
+		if demand.Count < 0 {
+			http.Error(w, fmt.Sprintf("requests[%d]: count must not be negative", i), http.StatusBadRequest)
+			return
+		}
+		if demand.Count == 0 {
+			req.Requests[i].Count = 1
+		}
+		total += req.Requests[i].Count
+		spec, version, ok := s.resolveTier(r, demand.Tier)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown tier: %s", demand.Tier), http.StatusBadRequest)
+			return
+		}
+		specs[i], tierVersion = spec, version
+	}
+	if total > maxSimulatedSessions {
+		http.Error(w, fmt.Sprintf("At most %d sessions per simulation (got %d)", maxSimulatedSessions, total), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	plan := s.newPlacementPlan(tenant, now)
+
+	// Capacity before is taken once per tier, ahead of any simulated session
+	var capacity []SimulatedCapacity
+	capacityIndex := make(map[string]int)
+	for _, spec := range specs {
+		if _, ok := capacityIndex[spec.Name]; ok {
+			continue
+		}
+		before, _ := s.planCapacity(plan, spec)
+		capacityIndex[spec.Name] = len(capacity)
+		capacity = append(capacity, SimulatedCapacity{Tier: spec.Name, CapacitySessionsBefore: before})
+	}
+
+	placements := make([]SimulatedPlacement, len(req.Requests))
+	placed := 0
+	for i, demand := range req.Requests {
+		placement := SimulatedPlacement{Tier: demand.Tier, Requested: demand.Count, Backends: make(map[string]int)}
+		for n := 0; n < demand.Count; n++ {
+			client := s.planPlace(plan, specs[i], demand.ClientLat, demand.ClientLon)
+			if client == nil {
+				// Nothing changed since the last miss, so the rest of this demand can't fit either
+				placement.Unplaced = demand.Count - placement.Placed
+				break
+			}
+			placement.Placed++
+			placement.Backends[client.Registration.ClientID]++
+		}
+		placed += placement.Placed
+		placements[i] = placement
+	}
+
+	for _, spec := range specs {
+		c := &capacity[capacityIndex[spec.Name]]
+		c.CapacitySessions, c.EligibleBackends = s.planCapacity(plan, spec)
+	}
+
+	LogInfoWithData("Simulated placement", map[string]interface{}{
+		"tenant":   tenant,
+		"sessions": total,
+		"placed":   placed,
+		"actor":    requestActor(r),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"tenant":             tenant,
+		"tier_version":       tierVersion,
+		"feasible":           placed == total,
+		"placed":             placed,
+		"unplaced":           total - placed,
+		"placements":         placements,
+		"remaining_capacity": capacity,
+		"timestamp":          now,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode simulation response: %v", err)
+	}
+}
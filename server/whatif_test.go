@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type simulateResponse struct {
+	Feasible          bool                 `json:"feasible"`
+	Placed            int                  `json:"placed"`
+	Unplaced          int                  `json:"unplaced"`
+	Placements        []SimulatedPlacement `json:"placements"`
+	RemainingCapacity []SimulatedCapacity  `json:"remaining_capacity"`
+}
+
+func postSimulate(t *testing.T, server *Server, body string) (int, simulateResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	server.handleSimulate(rec, httptest.NewRequest(http.MethodPost, "/simulate", bytes.NewReader([]byte(body))))
+	var resp simulateResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+	}
+	return rec.Code, resp
+}
+
+// TestSimulate_PlacesBatchWithoutReserving verifies a batch is placed against real capacity, pending allocations
+// included, and leaves nothing reserved
+func TestSimulate_PlacesBatchWithoutReserving(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-a"}))
+	server.AddMockClient(NewMockClient(MockClientOptions{ClientID: "backend-b"}))
+
+	// Each 8-core backend takes two pro-turbo sessions; one is already pending on backend-a
+	turbo, _, _ := server.lookupTier(DefaultTenant, "pro-turbo", "")
+	server.addPendingAllocation("backend-a", "", "pro-turbo", turbo, "existing")
+
+	code, resp := postSimulate(t, server, `{"requests": [{"tier": "pro-turbo", "count": 5}, {"tier": "lite"}]}`)
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if resp.Feasible || resp.Placed != 3 || resp.Unplaced != 3 {
+		t.Fatalf("Expected 3 of 6 sessions placed, got %+v", resp)
+	}
+	if turbo := resp.Placements[0]; turbo.Placed != 3 || turbo.Unplaced != 2 || turbo.Backends["backend-a"] != 1 || turbo.Backends["backend-b"] != 2 {
+		t.Errorf("Unexpected pro-turbo placement: %+v", turbo)
+	}
+	if lite := resp.Placements[1]; lite.Placed != 0 || lite.Unplaced != 1 {
+		t.Errorf("Expected no vCPU left for the lite session, got %+v", lite)
+	}
+	if c := resp.RemainingCapacity[0]; c.Tier != "pro-turbo" || c.CapacitySessionsBefore != 3 || c.CapacitySessions != 0 || c.EligibleBackends != 0 {
+		t.Errorf("Unexpected pro-turbo capacity: %+v", c)
+	}
+	if c := resp.RemainingCapacity[1]; c.Tier != "lite" || c.CapacitySessionsBefore != 12 || c.CapacitySessions != 0 {
+		t.Errorf("Unexpected lite capacity: %+v", c)
+	}
+
+	server.mu.RLock()
+	pending := len(server.pendingAllocations["backend-a"]) + len(server.pendingAllocations["backend-b"])
+	server.mu.RUnlock()
+	if pending != 1 {
+		t.Errorf("Expected only the existing allocation to be pending, got %d", pending)
+	}
+	if _, again := postSimulate(t, server, `{"requests": [{"tier": "pro-turbo", "count": 3}]}`); !again.Feasible {
+		t.Errorf("Expected a repeated simulation to see the same capacity, got %+v", again)
+	}
+}
+
+// TestSimulate_RejectsInvalidBatches verifies unknown tiers, negative counts and oversized batches are rejected
+func TestSimulate_RejectsInvalidBatches(t *testing.T) {
+	db, cleanup := CreateTestDB(t)
+	defer cleanup()
+	server := NewTestServer(t, db)
+
+	for _, body := range []string{
+		`{"requests": []}`,
+		`{"requests": [{"tier": "mega"}]}`,
+		`{"requests": [{"tier": "lite", "count": -1}]}`,
+		`{"requests": [{"tier": "lite", "count": 10001}]}`,
+		`not json`,
+	} {
+		if code, _ := postSimulate(t, server, body); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, code)
+		}
+	}
+}